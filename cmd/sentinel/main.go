@@ -22,6 +22,7 @@ func main() {
 	quorum := flag.Int("quorum", 2, "Number of Sentinels that need to agree")
 	downAfter := flag.Int("down-after-ms", 30000, "Milliseconds before marking instance down")
 	failoverTimeout := flag.Int("failover-timeout-ms", 180000, "Milliseconds for failover timeout")
+	maxReplicaLag := flag.Int64("max-replica-lag", 0, "Max bytes a replica may lag the master and still be promoted (0 = no limit)")
 	sentinelAddrs := flag.String("sentinel-addrs", "", "Comma-separated list of other Sentinel addresses (e.g., 'host1:26379,host2:26379')")
 
 	flag.Parse()
@@ -49,6 +50,7 @@ func main() {
 		Quorum:          *quorum,
 		DownAfterMillis: *downAfter,
 		FailoverTimeout: *failoverTimeout,
+		MaxReplicaLag:   *maxReplicaLag,
 		MaxConnections:  10000,
 	}
 
@@ -3,14 +3,20 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"redis/internal/aof"
+	"redis/internal/handler"
+	"redis/internal/protocol"
 	"redis/internal/server"
+	"redis/internal/storage"
 )
 
 func main() {
@@ -21,31 +27,148 @@ func main() {
 	replicationMasterHost := flag.String("replication-master-host", "", "Master host for replica")
 	replicationMasterPort := flag.Int("replication-master-port", 6379, "Master port for replica")
 	replicaPriority := flag.Int("replica-priority", 100, "Replica priority for failover")
+	replicaServeStaleData := flag.Bool("replica-serve-stale-data", true, "Serve reads on a replica while the link with the master is down")
+	replicaAnnounceIP := flag.String("replica-announce-ip", "", "IP address advertised to the master (for replicas behind NAT)")
+	replicaAnnouncePort := flag.Int("replica-announce-port", 0, "Port advertised to the master (0 = use -port)")
+	maxClients := flag.Int("maxclients", 10000, "Max number of simultaneous client connections")
+	tcpKeepAlive := flag.Int("tcp-keepalive", 300, "TCP keepalive period in seconds for client connections (0 = Go's default of 15s, negative to disable)")
+	tcpBacklog := flag.Int("tcp-backlog", 511, "TCP listen backlog")
+	unixSocket := flag.String("unixsocket", "", "Path of a UNIX domain socket to accept connections on, in addition to TCP")
+	unixSocketPerm := flag.String("unixsocketperm", "", "Octal permissions of the unixsocket file, e.g. 700 (default: umask)")
+	protoMaxBulkLen := flag.Int64("proto-max-bulk-len", protocol.DefaultMaxBulkLen, "Max size in bytes of a single bulk string in a request")
+	expireJitterPercent := flag.Int("expire-jitter-percentage", 0, "Randomly spread TTLs from SET EX/PX, SETEX, PSETEX and EXPIRE by up to this ±percentage (0-100, 0 to disable)")
+	metricsPort := flag.Int("metrics-port", 0, "Port for the Prometheus /metrics HTTP endpoint (0 to disable)")
+	pubsubBufferSize := flag.Int("client-output-buffer-limit-pubsub", storage.DefaultSubscriberBufferSize, "Messages buffered per pub/sub subscriber; publishes to a subscriber with a full buffer are dropped")
+	pubsubPingInterval := flag.Int("pubsub-ping-interval", 0, "Seconds between keepalive pings sent to pub/sub subscribers (0 to disable)")
+	listMaxListpackSize := flag.Int("list-max-listpack-size", storage.DefaultListMaxListpackSize, "Max size of a list kept in the listpack encoding: entries if positive, -1..-5 for 4KB..64KB of elements")
+	zsetMaxListpackEntries := flag.Int("zset-max-listpack-entries", storage.DefaultZSetMaxListpackEntries, "Max members of a sorted set kept in the compact listpack encoding")
+	zsetMaxListpackValue := flag.Int("zset-max-listpack-value", storage.DefaultZSetMaxListpackValue, "Max member length in bytes of a sorted set kept in the listpack encoding")
+	hashMaxListpackEntries := flag.Int("hash-max-listpack-entries", storage.DefaultHashMaxListpackEntries, "Max fields of a hash kept in the compact listpack encoding")
+	hashMaxListpackValue := flag.Int("hash-max-listpack-value", storage.DefaultHashMaxListpackValue, "Max field or value length in bytes of a hash kept in the listpack encoding")
+	keyLockStripes := flag.Int("key-lock-stripes", 0, "Per-key lock stripes that let GET, SET, INCR and the other single-key string commands on different keys run in parallel (0 to run every command on the processor goroutine)")
+	luaTimeLimit := flag.Int("lua-time-limit", 5000, "Milliseconds a script may run before the server replies BUSY (0 = never)")
+	slowlogMaxArgs := flag.Int("slowlog-max-args", handler.DefaultSlowLogMaxArgs, "Arguments kept per slow log entry, command name included; the rest are replaced by a count")
+	slowlogMaxArgLen := flag.Int("slowlog-max-arg-len", handler.DefaultSlowLogMaxArgLen, "Bytes kept of each argument in a slow log entry")
+	pipelineMaxPendingBytes := flag.Int("pipeline-max-pending-bytes", 64*1024, "Unflushed pipelined reply bytes that force an early flush, allocated per connection (0 = write buffer size)")
+	loadShedQueueDepth := flag.Int("loadshed-queue-depth", 0, "Processor queue depth past which commands are refused with OVERLOADED, e.g. 900 of 1000 (0 to disable)")
+	loadShedWait := flag.Int("loadshed-wait-ms", 50, "Milliseconds a command may wait for queue room before being shed")
+	rejectWritesDuringSave := flag.Bool("reject-writes-during-save", false, "Reject writes while BGSAVE/BGREWRITEAOF is running")
+	appendFsync := flag.String("appendfsync", "everysec", "When to fsync the AOF: always, everysec or no")
+	aofFsyncWorkers := flag.Int("aof-fsync-workers", 1, "Background fsync workers for appendfsync always; concurrent writes share each fsync")
+	aofGroupCommitWindow := flag.Int("aof-group-commit-window-us", 0, "Microseconds an appendfsync always fsync waits to batch more writes (0 = none)")
+	renameCommands := make(map[string]string)
+	flag.Func("rename-command", "Rename a command: \"OLD NEW\" (\"OLD\" alone disables it); may be repeated", func(value string) error {
+		fields := strings.Fields(value)
+		switch len(fields) {
+		case 1:
+			renameCommands[fields[0]] = ""
+		case 2:
+			newName := fields[1]
+			if newName == `""` {
+				newName = ""
+			}
+			renameCommands[fields[0]] = newName
+		default:
+			return fmt.Errorf("expected \"OLD NEW\", got %q", value)
+		}
+		return nil
+	})
 	flag.Parse()
 
+	if *expireJitterPercent < 0 || *expireJitterPercent > 100 {
+		log.Fatalf("expire-jitter-percentage must be between 0 and 100, got %d", *expireJitterPercent)
+	}
+	var socketPerm os.FileMode
+	if *unixSocketPerm != "" {
+		perm, err := strconv.ParseUint(*unixSocketPerm, 8, 32)
+		if err != nil || perm > 0777 {
+			log.Fatalf("unixsocketperm must be octal permissions such as 700, got %q", *unixSocketPerm)
+		}
+		socketPerm = os.FileMode(perm)
+	}
+	syncPolicy, err := aof.ParseSyncPolicy(*appendFsync)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	cfg := &server.Config{
 		Host:            *host,
 		Port:            *port,
-		MaxConnections:  10000,
+		MaxConnections:  *maxClients,
 		ReadBufferSize:  4096,
 		WriteBufferSize: 4096,
 
+		// TCP configuration
+		TCPKeepAlive: time.Duration(*tcpKeepAlive) * time.Second,
+		TCPBacklog:   *tcpBacklog,
+
+		// UNIX socket configuration
+		UnixSocket:     *unixSocket,
+		UnixSocketPerm: socketPerm,
+
+		// Protocol limits
+		ProtoMaxBulkLen: *protoMaxBulkLen,
+
 		// Pipeline configuration
-		MaxPipelineCommands: 1000,
-		SlowLogThreshold:    10 * time.Millisecond, // 10 milliseconds
-		CommandTimeout:      30 * time.Second,      // 30 seconds
-		ReadTimeout:         60 * time.Second,      // 60 seconds
-		PipelineTimeout:     1 * time.Second,       // 1 second
+		MaxPipelineCommands:     1000,
+		SlowLogThreshold:        10 * time.Millisecond, // 10 milliseconds
+		CommandTimeout:          30 * time.Second,      // 30 seconds
+		ReadTimeout:             60 * time.Second,      // 60 seconds
+		PipelineTimeout:         1 * time.Second,       // 1 second
+		PipelineMaxPendingBytes: *pipelineMaxPendingBytes,
+
+		// Slow log configuration
+		SlowLogMaxArgs:   *slowlogMaxArgs,
+		SlowLogMaxArgLen: *slowlogMaxArgLen,
+
+		// Load shedding
+		LoadShedQueueDepth: *loadShedQueueDepth,
+		LoadShedWait:       time.Duration(*loadShedWait) * time.Millisecond,
+
+		// Active expiry configuration
+		ActiveExpireInterval:   100 * time.Millisecond, // 10 cycles per second
+		ActiveExpireSampleSize: 20,                     // 20 keys per sample
+		ActiveExpireTimeBudget: 1 * time.Millisecond,   // 1 millisecond per cycle
+
+		// Expiry randomization
+		ExpireJitterPercent: *expireJitterPercent,
+
+		// Pub/sub configuration
+		PubSubPingInterval: time.Duration(*pubsubPingInterval) * time.Second,
+		PubSubBufferSize:   *pubsubBufferSize,
+
+		// Observability configuration
+		MetricsPort: *metricsPort,
+
+		// Scripting configuration
+		LuaTimeLimit: time.Duration(*luaTimeLimit) * time.Millisecond,
+
+		// Encoding configuration
+		ListMaxListpackSize:    *listMaxListpackSize,
+		SetMaxIntsetEntries:    512, // Redis default
+		ZSetMaxListpackEntries: *zsetMaxListpackEntries,
+		ZSetMaxListpackValue:   *zsetMaxListpackValue,
+		HashMaxListpackEntries: *hashMaxListpackEntries,
+		HashMaxListpackValue:   *hashMaxListpackValue,
+
+		// Concurrency configuration
+		KeyLockStripes: *keyLockStripes,
+
+		// Security configuration
+		RenameCommands: renameCommands,
 
 		// AOF configuration
 		AOF: aof.Config{
 			Enabled:    true,
 			Filepath:   "appendonly.aof",
-			SyncPolicy: aof.SyncEverySecond,
+			SyncPolicy: syncPolicy,
 			BufferSize: 4096,
+
+			SyncWorkers:       *aofFsyncWorkers,
+			GroupCommitWindow: time.Duration(*aofGroupCommitWindow) * time.Microsecond,
 		},
 
 		// RDB configuration
@@ -54,9 +177,13 @@ func main() {
 			Seconds: 60,
 			Changes: 1000,
 		},
+		RejectWritesDuringSave: *rejectWritesDuringSave,
 
 		// Replication defaults
 		ReplicaPriority:       *replicaPriority,
+		ReplicaServeStaleData: *replicaServeStaleData,
+		ReplicaAnnounceIP:     *replicaAnnounceIP,
+		ReplicaAnnouncePort:   *replicaAnnouncePort,
 		ReplicationRole:       *replicationRole,
 		ReplicationMasterHost: *replicationMasterHost,
 		ReplicationMasterPort: *replicationMasterPort,
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -13,9 +14,10 @@ import (
 type SyncPolicy int
 
 const (
-	// SyncAlways fsyncs after every write (safest, slowest)
+	// SyncAlways fsyncs every write before returning (safest, slowest)
 	// Data loss: None (every command is persisted before returning to client)
-	// Performance: ~1000 commands/sec (limited by disk I/O)
+	// Performance: bounded by disk I/O; concurrent writes share one fsync
+	// (group commit), so throughput grows with the number of clients
 	SyncAlways SyncPolicy = iota
 
 	// SyncEverySecond fsyncs once per second (good balance) - Redis default
@@ -35,6 +37,10 @@ type Config struct {
 	Filepath   string     // Path to AOF file
 	SyncPolicy SyncPolicy // When to sync to disk
 	BufferSize int        // Write buffer size in bytes
+
+	// Group commit (SyncAlways only)
+	SyncWorkers       int           // Background fsync workers (<= 0 means 1)
+	GroupCommitWindow time.Duration // Extra wait before an fsync to batch more writes (0 = none)
 }
 
 // DefaultConfig returns default AOF configuration
@@ -44,9 +50,24 @@ func DefaultConfig() Config {
 		Filepath:   "appendonly.aof",
 		SyncPolicy: SyncEverySecond,
 		BufferSize: 4096,
+
+		SyncWorkers: 1,
 	}
 }
 
+// ParseSyncPolicy parses an appendfsync setting: always, everysec or no
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch strings.ToLower(name) {
+	case "always":
+		return SyncAlways, nil
+	case "everysec":
+		return SyncEverySecond, nil
+	case "no":
+		return SyncNo, nil
+	}
+	return 0, fmt.Errorf("invalid appendfsync policy %q (want always, everysec or no)", name)
+}
+
 // Writer handles append-only file writes for persistence
 // Thread-safe for concurrent command logging
 type Writer struct {
@@ -62,14 +83,24 @@ type Writer struct {
 	isRewriting   bool        // Whether rewrite is in progress
 
 	// Metrics
-	totalWrites int64
-	totalBytes  int64
-	lastSync    time.Time
+	totalWrites  int64
+	totalBytes   int64
+	lastSync     time.Time
+	lastWriteErr error // Error of the last write, flush or sync (nil if it succeeded)
 
 	// For SyncEverySecond policy
 	syncTicker *time.Ticker
 	stopChan   chan struct{}
 	closed     bool
+
+	// Group commit for SyncAlways: writers wait on syncCond (guarded by mu)
+	// until a sync worker has flushed and fsynced past their write
+	syncCond   *sync.Cond
+	writeSeq   uint64       // Writes buffered so far
+	claimedSeq uint64       // Writes flushed by a worker, fsync pending or done
+	syncedSeq  uint64       // Writes known to be on disk
+	failedSeq  uint64       // Writes whose fsync failed (unless later synced)
+	fileMu     sync.RWMutex // Held shared during an fsync, exclusively while Rewrite swaps the file
 }
 
 // NewWriter creates a new AOF writer
@@ -115,6 +146,18 @@ func NewWriter(config Config) (*Writer, error) {
 		go w.backgroundSync()
 	}
 
+	// Start the group commit workers for SyncAlways policy
+	if config.SyncPolicy == SyncAlways {
+		w.syncCond = sync.NewCond(&w.mu)
+		workers := config.SyncWorkers
+		if workers <= 0 {
+			workers = 1
+		}
+		for i := 0; i < workers; i++ {
+			go w.syncWorker()
+		}
+	}
+
 	return w, nil
 }
 
@@ -125,10 +168,12 @@ func (w *Writer) backgroundSync() {
 		case <-w.syncTicker.C:
 			w.mu.Lock()
 			if !w.closed && w.file != nil {
-				// Flush buffer to OS
-				w.writer.Flush()
-				// Sync to disk
-				w.file.Sync()
+				// Flush buffer to OS, then sync to disk
+				err := w.writer.Flush()
+				if err == nil {
+					err = w.file.Sync()
+				}
+				w.lastWriteErr = err
 				w.lastSync = time.Now()
 			}
 			w.mu.Unlock()
@@ -151,21 +196,84 @@ func (w *Writer) backgroundSync() {
 //	$5\r\n       <- third element is 5 bytes
 //	value\r\n    <- the value
 func (w *Writer) WriteCommand(args []string) error {
+	return w.WriteCommands([][]string{args})
+}
+
+// WriteCommands writes several commands to the AOF file as one unit: no
+// command written concurrently can land between them, and with appendfsync
+// always they are synced together (used for MULTI ... EXEC blocks)
+func (w *Writer) WriteCommands(commands [][]string) error {
 	if !w.config.Enabled || w.closed {
 		return nil
 	}
 
 	w.mu.Lock()
 
-	// Encode as RESP array
+	for _, args := range commands {
+		bytesWritten, err := w.writeArgs(args)
+		if err != nil {
+			w.lastWriteErr = err
+			w.mu.Unlock()
+			return err
+		}
+		w.totalWrites++
+		w.totalBytes += int64(bytesWritten)
+	}
+	w.lastWriteErr = nil
+	w.writeSeq++
+
+	// Handle sync policy
+	switch w.config.SyncPolicy {
+	case SyncAlways:
+		// Wait for a sync worker to fsync this write, together with any
+		// other writes buffered meanwhile
+		err := w.waitForSync(w.writeSeq)
+		w.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+	case SyncEverySecond:
+		// Background goroutine handles syncing
+		// Just make sure buffer is flushed to OS
+		// (actual disk sync happens in backgroundSync)
+		w.mu.Unlock()
+
+	case SyncNo:
+		// Let OS handle flushing
+		w.mu.Unlock()
+	}
+
+	// HYBRID APPROACH: Also buffer command if rewrite is in progress
+	// This ensures no commands are lost during AOF rewrite
+	// We write to BOTH main AOF (for crash safety) AND buffer (for rewrite completion)
+	w.rewriteMu.Lock()
+	isRewriting := w.isRewriting
+	if isRewriting {
+		for _, args := range commands {
+			// Make a copy of args to avoid mutations
+			argsCopy := make([]string, len(args))
+			copy(argsCopy, args)
+			// Append to buffer (pointer dereference)
+			*w.rewriteBuffer = append(*w.rewriteBuffer, argsCopy)
+		}
+	}
+	w.rewriteMu.Unlock()
+
+	return nil
+}
+
+// writeArgs encodes one command as a RESP array into the buffered writer
+// Returns the number of bytes written
+// Caller must hold w.mu
+func (w *Writer) writeArgs(args []string) (int, error) {
 	bytesWritten := 0
 
 	// Array header: *<count>\r\n
 	header := fmt.Sprintf("*%d\r\n", len(args))
 	n, err := w.writer.WriteString(header)
 	if err != nil {
-		w.mu.Unlock()
-		return fmt.Errorf("failed to write array header: %w", err)
+		return bytesWritten, fmt.Errorf("failed to write array header: %w", err)
 	}
 	bytesWritten += n
 
@@ -175,72 +283,103 @@ func (w *Writer) WriteCommand(args []string) error {
 		prefix := fmt.Sprintf("$%d\r\n", len(arg))
 		n, err = w.writer.WriteString(prefix)
 		if err != nil {
-			w.mu.Unlock()
-			return fmt.Errorf("failed to write bulk prefix: %w", err)
+			return bytesWritten, fmt.Errorf("failed to write bulk prefix: %w", err)
 		}
 		bytesWritten += n
 
 		// Data
 		n, err = w.writer.WriteString(arg)
 		if err != nil {
-			w.mu.Unlock()
-			return fmt.Errorf("failed to write bulk data: %w", err)
+			return bytesWritten, fmt.Errorf("failed to write bulk data: %w", err)
 		}
 		bytesWritten += n
 
 		// CRLF
 		n, err = w.writer.WriteString("\r\n")
 		if err != nil {
-			w.mu.Unlock()
-			return fmt.Errorf("failed to write CRLF: %w", err)
+			return bytesWritten, fmt.Errorf("failed to write CRLF: %w", err)
 		}
 		bytesWritten += n
 	}
 
-	w.totalWrites++
-	w.totalBytes += int64(bytesWritten)
+	return bytesWritten, nil
+}
 
-	// Handle sync policy
-	switch w.config.SyncPolicy {
-	case SyncAlways:
-		// Flush buffer and sync immediately
-		if err := w.writer.Flush(); err != nil {
-			w.mu.Unlock()
-			return fmt.Errorf("failed to flush: %w", err)
+// waitForSync blocks until the write numbered seq is on disk
+// Caller must hold w.mu; it is released while waiting
+func (w *Writer) waitForSync(seq uint64) error {
+	w.syncCond.Broadcast() // Wake an idle worker
+	for w.syncedSeq < seq && w.failedSeq < seq && !w.closed {
+		w.syncCond.Wait()
+	}
+	if w.syncedSeq >= seq || w.closed {
+		// Close flushes and fsyncs everything still pending
+		return nil
+	}
+	return fmt.Errorf("failed to sync: %w", w.lastWriteErr)
+}
+
+// syncWorker is a SyncAlways group commit worker: it flushes every write
+// buffered so far and fsyncs them with a single call, then wakes their writers
+// While one worker is in fsync, writes keep buffering and another worker
+// (if configured) can already claim them, so disk latency is overlapped
+func (w *Writer) syncWorker() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for {
+		for w.claimedSeq >= w.writeSeq && !w.closed {
+			w.syncCond.Wait()
 		}
-		if err := w.file.Sync(); err != nil {
-			w.mu.Unlock()
-			return fmt.Errorf("failed to sync: %w", err)
+		if w.closed {
+			return
 		}
-		w.lastSync = time.Now()
-		w.mu.Unlock()
 
-	case SyncEverySecond:
-		// Background goroutine handles syncing
-		// Just make sure buffer is flushed to OS
-		// (actual disk sync happens in backgroundSync)
+		// Give concurrent writers a moment to join this batch, then take
+		// fileMu before w.mu (the order Rewrite and Close use) so the file
+		// can't be swapped or closed until the fsync is done
 		w.mu.Unlock()
+		if window := w.config.GroupCommitWindow; window > 0 {
+			time.Sleep(window)
+		}
+		w.fileMu.RLock()
+		w.mu.Lock()
+		if w.closed {
+			w.fileMu.RUnlock()
+			return
+		}
+		seq := w.writeSeq
+		if seq <= w.claimedSeq {
+			// Another worker claimed these writes meanwhile
+			w.fileMu.RUnlock()
+			continue
+		}
 
-	case SyncNo:
-		// Let OS handle flushing
+		w.claimedSeq = seq
+		err := w.writer.Flush()
+		file := w.file
+
+		// fsync without w.mu so writes can keep buffering meanwhile
 		w.mu.Unlock()
-	}
+		if err == nil {
+			err = file.Sync()
+		}
+		w.fileMu.RUnlock()
+		w.mu.Lock()
 
-	// HYBRID APPROACH: Also buffer command if rewrite is in progress
-	// This ensures no commands are lost during AOF rewrite
-	// We write to BOTH main AOF (for crash safety) AND buffer (for rewrite completion)
-	w.rewriteMu.Lock()
-	isRewriting := w.isRewriting
-	if isRewriting {
-		// Make a copy of args to avoid mutations
-		argsCopy := make([]string, len(args))
-		copy(argsCopy, args)
-		// Append to buffer (pointer dereference)
-		*w.rewriteBuffer = append(*w.rewriteBuffer, argsCopy)
+		w.lastWriteErr = err
+		if err != nil {
+			if seq > w.failedSeq {
+				w.failedSeq = seq
+			}
+		} else {
+			w.lastSync = time.Now()
+			if seq > w.syncedSeq {
+				w.syncedSeq = seq
+			}
+		}
+		w.syncCond.Broadcast()
 	}
-	w.rewriteMu.Unlock()
-
-	return nil
 }
 
 // Sync forces a sync to disk (useful for shutdown)
@@ -268,6 +407,9 @@ func (w *Writer) Close() error {
 		return nil
 	}
 
+	// fileMu first, so no group commit worker is in fsync on the file
+	w.fileMu.Lock()
+	defer w.fileMu.Unlock()
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
@@ -283,6 +425,12 @@ func (w *Writer) Close() error {
 		close(w.stopChan)
 	}
 
+	// Stop the group commit workers; writers still waiting are covered by
+	// the final flush and sync below
+	if w.syncCond != nil {
+		w.syncCond.Broadcast()
+	}
+
 	// Flush and sync remaining data
 	if w.writer != nil {
 		if err := w.writer.Flush(); err != nil {
@@ -310,6 +458,7 @@ type Stats struct {
 	FilePath    string
 	Enabled     bool
 	SyncPolicy  string
+	LastWriteOK bool // Whether the last write, flush or sync succeeded
 }
 
 // GetStats returns current AOF statistics
@@ -334,51 +483,7 @@ func (w *Writer) GetStats() Stats {
 		FilePath:    w.config.Filepath,
 		Enabled:     w.config.Enabled,
 		SyncPolicy:  policyName,
-	}
-}
-
-// IsWriteCommand checks if a command modifies data (should be logged to AOF)
-// Read-only commands are not logged
-func IsWriteCommand(cmd string) bool {
-	switch cmd {
-	// String write commands
-	case "SET", "SETNX", "SETEX", "PSETEX", "MSET", "MSETNX", "APPEND",
-		"INCR", "INCRBY", "INCRBYFLOAT", "DECR", "DECRBY", "GETSET", "SETRANGE":
-		return true
-
-	// List write commands
-	case "LPUSH", "LPUSHX", "RPUSH", "RPUSHX", "LPOP", "RPOP",
-		"LSET", "LREM", "LTRIM", "LINSERT", "LMOVE", "RPOPLPUSH":
-		return true
-
-	// Blocking list commands (also write)
-	case "BLPOP", "BRPOP", "BLMOVE", "BRPOPLPUSH":
-		return true
-
-	// Hash write commands
-	case "HSET", "HSETNX", "HMSET", "HDEL", "HINCRBY", "HINCRBYFLOAT":
-		return true
-
-	// Set write commands
-	case "SADD", "SREM", "SPOP", "SMOVE", "SUNIONSTORE", "SINTERSTORE", "SDIFFSTORE":
-		return true
-
-	// Key write commands
-	case "DEL", "UNLINK", "RENAME", "RENAMENX", "COPY",
-		"EXPIRE", "EXPIREAT", "PEXPIRE", "PEXPIREAT", "PERSIST":
-		return true
-
-	// Database commands
-	case "FLUSHALL", "FLUSHDB", "SELECT":
-		return true
-
-	// Transaction commands are not logged directly
-	// Individual commands within transactions are logged at EXEC time
-	case "MULTI", "EXEC", "DISCARD", "WATCH", "UNWATCH":
-		return false
-
-	default:
-		return false
+		LastWriteOK: w.lastWriteErr == nil,
 	}
 }
 
@@ -468,6 +573,9 @@ func (w *Writer) Rewrite(snapshotFunc func() [][]string) error {
 	tempFile.Close()
 
 	// Phase 5: Atomically swap files (hold both locks)
+	// fileMu first, so no group commit worker is in fsync on the old file
+	w.fileMu.Lock()
+	defer w.fileMu.Unlock()
 	w.mu.Lock()
 	w.rewriteMu.Lock()
 
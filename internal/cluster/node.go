@@ -107,8 +107,9 @@ const (
 )
 
 // Cluster manages the entire distributed Redis cluster topology and slot assignments.
-// It maintains a view of all nodes in the cluster, tracks which node owns each of the 16384 hash slots,
-// and provides routing logic to determine which node should handle a given key.
+// It maintains a view of all nodes in the cluster, tracks which node owns each hash slot
+// (16384 by default, see SlotConfig), and provides routing logic to determine which node
+// should handle a given key.
 type Cluster struct {
 	mu sync.RWMutex
 
@@ -119,7 +120,10 @@ type Cluster struct {
 	Nodes map[string]*Node // nodeID -> Node
 
 	// Slot assignments: slot -> nodeID
-	SlotMap [NumSlots]string
+	SlotMap []string
+
+	// Slot count and key hash function
+	slotConfig SlotConfig
 
 	// State of the cluster
 	State ClusterState
@@ -131,8 +135,21 @@ type Cluster struct {
 	AssignedSlots int
 }
 
-// NewCluster creates a new cluster instance
+// NewCluster creates a new cluster instance with the default CRC16/16384 slot layout
 func NewCluster(nodeID, address string, port int) *Cluster {
+	return NewClusterWithSlots(nodeID, address, port, DefaultSlotConfig())
+}
+
+// NewClusterWithSlots creates a new cluster instance with a custom slot count
+// and hash function; unset fields fall back to the defaults
+func NewClusterWithSlots(nodeID, address string, port int, slotConfig SlotConfig) *Cluster {
+	if slotConfig.NumSlots <= 0 {
+		slotConfig.NumSlots = NumSlots
+	}
+	if slotConfig.Hash == nil {
+		slotConfig.Hash = CRC16
+	}
+
 	myself := &Node{
 		ID:      nodeID,
 		Address: address,
@@ -144,6 +161,8 @@ func NewCluster(nodeID, address string, port int) *Cluster {
 	c := &Cluster{
 		MySelf:        myself,
 		Nodes:         make(map[string]*Node),
+		SlotMap:       make([]string, slotConfig.NumSlots),
+		slotConfig:    slotConfig,
 		State:         ClusterStateFail, // Start in fail state until slots are assigned
 		Enabled:       false,
 		AssignedSlots: 0, // No slots assigned initially
@@ -154,6 +173,31 @@ func NewCluster(nodeID, address string, port int) *Cluster {
 	return c
 }
 
+// NumSlots returns the number of hash slots in this cluster
+func (c *Cluster) NumSlots() int {
+	return c.slotConfig.NumSlots
+}
+
+// KeySlot calculates the hash slot for a key using this cluster's slot configuration
+func (c *Cluster) KeySlot(key string) int {
+	return c.slotConfig.KeySlot(key)
+}
+
+// KeysInSameSlot checks if all keys map to the same hash slot in this cluster
+func (c *Cluster) KeysInSameSlot(keys []string) bool {
+	if len(keys) <= 1 {
+		return true
+	}
+
+	firstSlot := c.KeySlot(keys[0])
+	for _, key := range keys[1:] {
+		if c.KeySlot(key) != firstSlot {
+			return false
+		}
+	}
+	return true
+}
+
 // Enable enables cluster mode
 func (c *Cluster) Enable() {
 	c.mu.Lock()
@@ -181,7 +225,7 @@ func (c *Cluster) AssignSlots(slots []int) {
 	defer c.mu.Unlock()
 
 	for _, slot := range slots {
-		if slot >= 0 && slot < NumSlots {
+		if slot >= 0 && slot < c.slotConfig.NumSlots {
 			// Only increment if slot was previously unassigned
 			if c.SlotMap[slot] == "" {
 				c.AssignedSlots++
@@ -208,7 +252,7 @@ func (c *Cluster) GetSlotNode(slot int) string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if slot < 0 || slot >= NumSlots {
+	if slot < 0 || slot >= c.slotConfig.NumSlots {
 		return ""
 	}
 
@@ -220,7 +264,7 @@ func (c *Cluster) IsSlotOwner(slot int) bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if slot < 0 || slot >= NumSlots {
+	if slot < 0 || slot >= c.slotConfig.NumSlots {
 		return false
 	}
 
@@ -229,7 +273,7 @@ func (c *Cluster) IsSlotOwner(slot int) bool {
 
 // IsKeyOwner checks if the current node owns the key
 func (c *Cluster) IsKeyOwner(key string) bool {
-	slot := KeyHashSlot(key)
+	slot := c.KeySlot(key)
 	return c.IsSlotOwner(slot)
 }
 
@@ -238,7 +282,7 @@ func (c *Cluster) GetKeyNode(key string) *Node {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	slot := KeyHashSlot(key)
+	slot := c.KeySlot(key)
 	nodeID := c.SlotMap[slot]
 
 	return c.Nodes[nodeID]
@@ -253,7 +297,7 @@ func (c *Cluster) AddNode(node *Node) {
 
 	// Update slot map with this node's slots
 	for _, slot := range node.Slots {
-		if slot >= 0 && slot < NumSlots {
+		if slot >= 0 && slot < c.slotConfig.NumSlots {
 			// Only increment if slot was previously unassigned
 			if c.SlotMap[slot] == "" {
 				c.AssignedSlots++
@@ -366,11 +410,11 @@ func (c *Cluster) GetState() ClusterState {
 }
 
 // updateState updates cluster state based on slot coverage.
-// Uses cached AssignedSlots counter for O(1) performance instead of O(16384) loop.
+// Uses cached AssignedSlots counter for O(1) performance instead of a loop over every slot.
 // Must be called with lock held.
 func (c *Cluster) updateState() {
 	// Check if all slots are assigned using cached counter
-	if c.AssignedSlots == NumSlots {
+	if c.AssignedSlots == c.slotConfig.NumSlots {
 		c.State = ClusterStateOK
 	} else {
 		c.State = ClusterStateFail
@@ -388,7 +432,7 @@ func (c *Cluster) GetClusterInfo() map[string]interface{} {
 		"cluster_slots_assigned": c.AssignedSlots,
 		"cluster_slots_ok":       c.AssignedSlots,
 		"cluster_slots_pfail":    0,
-		"cluster_slots_fail":     NumSlots - c.AssignedSlots,
+		"cluster_slots_fail":     c.slotConfig.NumSlots - c.AssignedSlots,
 		"cluster_known_nodes":    len(c.Nodes),
 		"cluster_size":           len(c.Nodes),
 		"cluster_my_epoch":       1,
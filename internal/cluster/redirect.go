@@ -58,7 +58,7 @@ func (c *Cluster) CheckKeyOwnership(key string) error {
 		return nil // Cluster mode disabled, allow all operations
 	}
 
-	slot := KeyHashSlot(key)
+	slot := c.KeySlot(key)
 
 	if c.IsSlotOwner(slot) {
 		return nil // This node owns the slot
@@ -87,7 +87,7 @@ func (c *Cluster) CheckMultiKeyOwnership(keys []string) error {
 	}
 
 	// Check if all keys are in the same slot
-	if !KeysInSameSlot(keys) {
+	if !c.KeysInSameSlot(keys) {
 		return fmt.Errorf("CROSSSLOT Keys in request don't hash to the same slot")
 	}
 
@@ -6,6 +6,32 @@ import "strings"
 // Each key is mapped to a slot using CRC16(key) % 16384
 const NumSlots = 16384
 
+// HashFunc hashes a key (after hash tag extraction) for slot routing
+// The slot is the hash modulo the slot count
+type HashFunc func(data []byte) uint32
+
+// SlotConfig defines how keys are mapped to slots
+// A small slot space makes cluster logic easy to exercise in tests, and a
+// different count or hash allows interop with other fixed-slot systems
+type SlotConfig struct {
+	NumSlots int      // Number of hash slots (default 16384)
+	Hash     HashFunc // Key hash function (default CRC16)
+}
+
+// DefaultSlotConfig returns the Redis Cluster slot layout: CRC16 over 16384 slots
+func DefaultSlotConfig() SlotConfig {
+	return SlotConfig{
+		NumSlots: NumSlots,
+		Hash:     CRC16,
+	}
+}
+
+// KeySlot calculates the hash slot for a key under this configuration
+// Hash tags are honoured the same way as in KeyHashSlot
+func (sc SlotConfig) KeySlot(key string) int {
+	return int(sc.Hash([]byte(extractHashTag(key))) % uint32(sc.NumSlots))
+}
+
 // CRC16 lookup table for XMODEM variant (used by Redis)
 var crc16tab = [256]uint16{
 	0x0000, 0x1021, 0x2042, 0x3063, 0x4084, 0x50a5, 0x60c6, 0x70e7,
@@ -52,6 +78,11 @@ func crc16(data []byte) uint16 {
 	return crc
 }
 
+// CRC16 is the default HashFunc: the XMODEM CRC16 used by Redis Cluster
+func CRC16(data []byte) uint32 {
+	return uint32(crc16(data))
+}
+
 // KeyHashSlot calculates the hash slot for a given key (0-16383)
 // Supports hash tags: if key contains {}, only the part inside {} is hashed
 //
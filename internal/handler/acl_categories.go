@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"redis/internal/protocol"
+)
+
+// ==================== ACL CATEGORIES ====================
+// Every command belongs to a few ACL categories (@read, @write, @admin, ...)
+// so access rules can name a whole group of commands instead of listing them.
+// The categories follow Redis's:
+//
+//   - read, write, fast/slow, admin, pubsub and blocking come from the
+//     command flags; a command the AOF logs (isLoggedCommand) is @write even
+//     if its entry lacks the flag
+//   - every @admin command is also @dangerous
+//   - the data-type categories and keyspace, connection, transaction,
+//     scripting and dangerous are listed below by command name
+//
+// A subcommand gets the categories its own flags imply plus those listed for
+// it ("client|id") or for its container ("client").
+
+// aclCategoryNames lists every category in Redis's order (ACL CAT)
+var aclCategoryNames = []string{
+	"keyspace", "read", "write", "set", "sortedset", "list", "hash", "string",
+	"bitmap", "hyperloglog", "geo", "stream", "pubsub", "admin", "fast", "slow",
+	"blocking", "dangerous", "connection", "transaction", "scripting",
+	"bloom", "cuckoo", "cms",
+}
+
+// aclCategoryCommands lists the commands of the categories not derived from flags
+var aclCategoryCommands = map[string][]string{
+	"keyspace": {
+		"del", "exists", "keys", "scan", "dbsize", "flushall", "flushdb", "expire",
+		"pexpireat", "ttl", "copy", "dump", "restore", "object",
+	},
+	"string": {
+		"set", "setex", "psetex", "get", "incr", "incrby", "decr", "decrby",
+		"append", "strlen", "getrange", "substr", "setrange",
+	},
+	"list": {
+		"lpush", "rpush", "lpop", "rpop", "llen", "lrange", "lindex", "lset",
+		"lrem", "ltrim", "linsert", "lpos", "lmpop", "blpop", "brpop", "blmove",
+		"brpoplpush", "blmpop",
+	},
+	"hash": {
+		"hset", "hget", "hmget", "hdel", "hexists", "hlen", "hkeys", "hvals",
+		"hgetall", "hsetnx", "hincrby", "hincrbyfloat", "hrandfield", "hexpire",
+		"hpexpire", "hexpireat", "hpexpireat", "httl", "hpttl", "hpersist",
+		"hgetdel", "hgetex",
+	},
+	"set": {
+		"sadd", "srem", "sismember", "smembers", "scard", "spop", "srandmember",
+		"sunion", "sinter", "sdiff", "smove", "sunionstore", "sinterstore",
+		"sdiffstore",
+	},
+	"sortedset": {
+		"zadd", "zrem", "zscore", "zrank", "zrevrank", "zcard", "zrange",
+		"zrevrange", "zrangebyscore", "zrevrangebyscore", "zincrby", "zcount",
+		"zpopmin", "zpopmax", "zremrangebyscore", "zremrangebyrank", "zmpop",
+		"bzmpop", "bzpopmin", "bzpopmax",
+	},
+	"geo":         {"geoadd", "geopos", "geodist", "geohash", "georadius", "georadiusbymember"},
+	"hyperloglog": {"pfadd", "pfcount", "pfmerge"},
+	"bitmap":      {"setbit", "getbit", "bitcount", "bitpos", "bitop"},
+	"bloom":       {"bf.reserve", "bf.add", "bf.madd", "bf.exists", "bf.mexists", "bf.info", "bf.insert"},
+	"cuckoo":      {"cf.reserve", "cf.add", "cf.exists", "cf.del", "cf.count", "cf.info"},
+	"cms":         {"cms.initbydim", "cms.incrby", "cms.query", "cms.info"},
+	"connection": {
+		"ping", "echo", "hello", "auth", "client", "quit", "command", "wait", "waitoffset",
+	},
+	"transaction": {"multi", "exec", "discard", "watch", "unwatch"},
+	"scripting":   {"eval", "evalsha", "script"},
+	"dangerous":   {"flushall", "flushdb", "keys", "info", "restore"},
+}
+
+// aclCategoryMembers indexes aclCategoryCommands by command name
+var aclCategoryMembers = func() map[string]map[string]bool {
+	members := make(map[string]map[string]bool)
+	for category, names := range aclCategoryCommands {
+		for _, name := range names {
+			if members[name] == nil {
+				members[name] = make(map[string]bool)
+			}
+			members[name][category] = true
+		}
+	}
+	return members
+}()
+
+// commandCategories derives the ACL categories of a command (or subcommand)
+// from its flags and the lists above, in aclCategoryNames order
+func commandCategories(info *CommandInfo) []string {
+	has := make(map[string]bool)
+	for _, flag := range info.Flags {
+		switch flag {
+		case "write":
+			has["write"] = true
+		case "readonly":
+			has["read"] = true
+		case "admin":
+			has["admin"] = true
+			has["dangerous"] = true
+		case "pubsub":
+			has["pubsub"] = true
+		case "blocking":
+			has["blocking"] = true
+		case "fast":
+			has["fast"] = true
+		}
+	}
+
+	container, _, isSub := strings.Cut(info.Name, "|")
+	if !isSub && isLoggedCommand(strings.ToUpper(info.Name)) {
+		has["write"] = true
+		delete(has, "read")
+	}
+	if !has["fast"] {
+		has["slow"] = true
+	}
+	for category := range aclCategoryMembers[container] {
+		has[category] = true
+	}
+	for category := range aclCategoryMembers[info.Name] {
+		has[category] = true
+	}
+
+	categories := make([]string, 0, len(has))
+	for _, category := range aclCategoryNames {
+		if has[category] {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// isACLCategory reports whether category (without the "@") exists
+func isACLCategory(category string) bool {
+	for _, name := range aclCategoryNames {
+		if name == category {
+			return true
+		}
+	}
+	return false
+}
+
+// commandInCategory reports whether a command or subcommand belongs to an ACL
+// category, for rules like +@read or -@admin
+func commandInCategory(info *CommandInfo, category string) bool {
+	for _, c := range info.Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// commandsInCategory returns the names of the commands and subcommands
+// ("client|id") in an ACL category, sorted
+func commandsInCategory(category string) []string {
+	var names []string
+	for _, info := range commandTable {
+		if commandInCategory(info, category) {
+			names = append(names, info.Name)
+		}
+		for _, sub := range info.Subcommands {
+			if commandInCategory(sub, category) {
+				names = append(names, sub.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handleACL handles ACL command
+// ACL CAT - List the ACL categories
+// ACL CAT category - List the commands in a category
+// ACL HELP - List available subcommands
+func (h *CommandHandler) handleACL(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'acl' command")
+	}
+
+	switch strings.ToUpper(cmd.Args[1]) {
+	case "CAT":
+		switch len(cmd.Args) {
+		case 2:
+			return protocol.EncodeArray(aclCategoryNames)
+		case 3:
+			category := strings.ToLower(strings.TrimPrefix(cmd.Args[2], "@"))
+			if !isACLCategory(category) {
+				return protocol.EncodeError(fmt.Sprintf("ERR Unknown category '%s'", cmd.Args[2]))
+			}
+			return protocol.EncodeArray(commandsInCategory(category))
+		default:
+			return protocol.EncodeError("ERR wrong number of arguments for 'acl|cat' command")
+		}
+	case "HELP":
+		return protocol.EncodeArray([]string{
+			"ACL <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"CAT [<category>]",
+			"    List all commands that belong to <category>, or all command categories",
+			"    when no category is specified.",
+			"HELP",
+			"    Print this help.",
+		})
+	default:
+		return protocol.EncodeError(fmt.Sprintf("ERR unknown subcommand '%s'. Try ACL HELP.", cmd.Args[1]))
+	}
+}
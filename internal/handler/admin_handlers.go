@@ -1,13 +1,57 @@
 package handler
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"redis/internal/processor"
 	"redis/internal/protocol"
+	"redis/internal/replication"
+	"redis/internal/storage"
+	"redis/internal/version"
 )
 
+// waitPollInterval is how often WAIT and WAITOFFSET re-check the offsets they wait for
+const waitPollInterval = 10 * time.Millisecond
+
+// pollUntil checks cond every waitPollInterval until it holds, timeout
+// elapses (0 = never) or ctx is done, and reports whether it held
+func pollUntil(ctx context.Context, timeout time.Duration, cond func() bool) bool {
+	if cond() {
+		return true
+	}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline:
+			return cond()
+		case <-ticker.C:
+			if cond() {
+				return true
+			}
+		}
+	}
+}
+
 // handleSlowLog handles SLOWLOG command
 // SLOWLOG GET [count] - Get slow log entries
 // SLOWLOG LEN - Get slow log length
@@ -45,28 +89,21 @@ func (h *CommandHandler) handleSlowLogGet(cmd *protocol.Command) []byte {
 	entries := h.slowLog.Get(count)
 
 	// Build response as array of arrays
-	// Each entry: [id, timestamp, duration_microseconds, [command, args...], client_id]
-	result := make([]interface{}, len(entries))
+	// Each entry: [id, timestamp, duration_microseconds, [command, args...], client_addr, client_name]
+	result := make([][]byte, len(entries))
 	for i, entry := range entries {
-		// Build command array
-		cmdArgs := make([]interface{}, len(entry.Args)+1)
-		cmdArgs[0] = entry.Command
-		for j, arg := range entry.Args {
-			cmdArgs[j+1] = arg
-		}
-
-		// Entry as array: [id, timestamp, duration_us, command_array, client_id]
-		entryArray := []interface{}{
-			entry.ID,
-			entry.Timestamp.Unix(),
-			entry.Duration.Microseconds(),
-			cmdArgs,
-			fmt.Sprintf("client-%d", entry.ClientID),
-		}
-		result[i] = entryArray
+		cmdArgs := append([]string{entry.Command}, entry.Args...)
+		result[i] = protocol.EncodeRawArray([][]byte{
+			protocol.EncodeInteger64(entry.ID),
+			protocol.EncodeInteger64(entry.Timestamp.Unix()),
+			protocol.EncodeInteger64(entry.Duration.Microseconds()),
+			protocol.EncodeArray(cmdArgs),
+			protocol.EncodeBulkString(entry.ClientAddr),
+			protocol.EncodeBulkString(entry.ClientName),
+		})
 	}
 
-	return protocol.EncodeInterfaceArray(result)
+	return protocol.EncodeRawArray(result)
 }
 
 // handleSlowLogLen returns slow log length
@@ -79,3 +116,404 @@ func (h *CommandHandler) handleSlowLogReset() []byte {
 	h.slowLog.Reset()
 	return protocol.EncodeSimpleString("OK")
 }
+
+// handleObject handles OBJECT command
+// OBJECT ENCODING key - Get the internal encoding of a key
+// OBJECT HELP - List available subcommands
+func (h *CommandHandler) handleObject(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'object' command")
+	}
+
+	subcommand := strings.ToUpper(cmd.Args[1])
+
+	switch subcommand {
+	case "ENCODING":
+		return h.handleObjectEncoding(cmd)
+	case "HELP":
+		return protocol.EncodeArray([]string{
+			"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"ENCODING <key>",
+			"    Return the kind of internal representation used in order to store the value",
+			"    associated with a <key>.",
+			"HELP",
+			"    Print this help.",
+		})
+	default:
+		return protocol.EncodeError(fmt.Sprintf("ERR unknown subcommand '%s'. Try OBJECT HELP.", cmd.Args[1]))
+	}
+}
+
+// handleObjectEncoding returns the internal encoding of a key
+func (h *CommandHandler) handleObjectEncoding(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'object|encoding' command")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdObjectEncoding,
+		Key:      cmd.Args[2],
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	result := <-procCmd.Response
+
+	res := result.(processor.GetResult)
+	if !res.Exists {
+		return protocol.EncodeNullBulkString()
+	}
+
+	return protocol.EncodeBulkString(res.Value.(string))
+}
+
+// handleShutdown handles SHUTDOWN [NOSAVE | SAVE] [FAILOVER [TIMEOUT ms]]
+// Saves an RDB snapshot unless NOSAVE is given, then stops the server.
+// FAILOVER first hands the master role to an up-to-date replica (see
+// shutdown_failover.go) and fails, leaving the server running, if none
+// catches up within TIMEOUT milliseconds (10s by default).
+// On success the connection is closed without a reply, like Redis
+func (h *CommandHandler) handleShutdown(cmd *protocol.Command) []byte {
+	save := true
+	failover := false
+	failoverTimeout := defaultFailoverTimeout
+	hasTimeout := false
+
+	for i := 1; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "NOSAVE":
+			save = false
+		case "SAVE":
+			save = true
+		case "FAILOVER":
+			failover = true
+		case "TIMEOUT":
+			if i+1 >= len(cmd.Args) {
+				return protocol.EncodeError("ERR syntax error")
+			}
+			i++
+			ms, err := strconv.ParseInt(cmd.Args[i], 10, 64)
+			if err != nil || ms <= 0 {
+				return protocol.EncodeError("ERR timeout is not a positive integer or out of range")
+			}
+			failoverTimeout = time.Duration(ms) * time.Millisecond
+			hasTimeout = true
+		default:
+			return protocol.EncodeError("ERR syntax error")
+		}
+	}
+	if hasTimeout && !failover {
+		return protocol.EncodeError("ERR TIMEOUT requires FAILOVER")
+	}
+
+	if h.shutdownFunc == nil {
+		return protocol.EncodeError("ERR SHUTDOWN is not supported by this server")
+	}
+
+	var candidates []failoverCandidate
+	if failover {
+		if !h.failoverInProgress.CompareAndSwap(false, true) {
+			return protocol.EncodeError("ERR FAILOVER already in progress")
+		}
+		var err error
+		if candidates, err = h.awaitFailoverTarget(failoverTimeout); err != nil {
+			h.failoverInProgress.Store(false)
+			return protocol.EncodeError(err.Error())
+		}
+	}
+
+	if save {
+		if err := h.saveRDB(); err != nil {
+			h.failoverInProgress.Store(false)
+			return protocol.EncodeError("ERR Errors trying to SHUTDOWN. Check logs.")
+		}
+	}
+
+	if failover {
+		if err := h.promoteFailoverTarget(candidates); err != nil {
+			h.failoverInProgress.Store(false)
+			return protocol.EncodeError(err.Error())
+		}
+	}
+
+	log.Printf("User requested shutdown (save=%v, failover=%v)", save, failover)
+	go h.shutdownFunc()
+	return nil
+}
+
+// handleLolwut handles LOLWUT [VERSION version]
+// Instead of Redis' generative art it returns the version and build string,
+// which makes it a cheap health check that also identifies the binary
+func (h *CommandHandler) handleLolwut(cmd *protocol.Command) []byte {
+	switch {
+	case len(cmd.Args) == 1:
+	case len(cmd.Args) == 3 && strings.ToUpper(cmd.Args[1]) == "VERSION":
+		if _, err := strconv.Atoi(cmd.Args[2]); err != nil {
+			return protocol.EncodeError("ERR value is not an integer or out of range")
+		}
+	default:
+		return protocol.EncodeError("ERR syntax error")
+	}
+
+	return protocol.EncodeBulkString(version.String() + "\n")
+}
+
+// handleWait handles WAIT numreplicas timeout
+// Blocks until numreplicas replicas acknowledged every write made before the
+// call, or until timeout milliseconds elapse (0 = wait forever), and returns
+// the number of replicas that acknowledged. Without replicas it returns 0,
+// immediately when numreplicas is 0 and after the timeout otherwise
+func (h *CommandHandler) handleWait(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'wait' command")
+	}
+
+	numReplicas, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return protocol.EncodeError("ERR value is not an integer or out of range")
+	}
+
+	timeoutMs, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+	if err != nil {
+		return protocol.EncodeError("ERR timeout is not an integer or out of range")
+	}
+	if timeoutMs < 0 {
+		return protocol.EncodeError("ERR timeout is negative")
+	}
+
+	if h.isReplica() {
+		return protocol.EncodeError("ERR WAIT cannot be used with replica instances")
+	}
+
+	return protocol.EncodeInteger(h.waitForReplicas(cmd.Context(), numReplicas, time.Duration(timeoutMs)*time.Millisecond))
+}
+
+// waitForReplicas blocks until numReplicas replicas acknowledged every write
+// propagated so far, until timeout elapses (0 = wait forever) or until ctx is
+// done. Returns the number of replicas that acknowledged
+func (h *CommandHandler) waitForReplicas(ctx context.Context, numReplicas int, timeout time.Duration) int {
+	replMgr, _ := h.replicationMgr.(*replication.ReplicationManager)
+
+	// Offset every counted replica must have acknowledged
+	var target int64
+	if replMgr != nil && len(replMgr.GetAllReplicas()) > 0 {
+		var err error
+		if target, err = replMgr.RequestAck(ctx); err != nil {
+			return 0
+		}
+	}
+
+	count := 0
+	pollUntil(ctx, timeout, func() bool {
+		if replMgr != nil {
+			count = replMgr.CountAckedReplicas(target)
+		}
+		return count >= numReplicas
+	})
+	return count
+}
+
+// errNoReplicas is returned for an EXEC whose implicit WAIT could not be met
+// by the replicas online, before any of its commands run
+const errNoReplicas = "NOREPLICAS Not enough good replicas to write."
+
+// onlineReplicas returns how many replicas are online, the most that can
+// acknowledge a write
+func (h *CommandHandler) onlineReplicas() int {
+	replMgr, ok := h.replicationMgr.(*replication.ReplicationManager)
+	if !ok {
+		return 0
+	}
+	return replMgr.CountAckedReplicas(0)
+}
+
+// handleWaitOffset handles WAITOFFSET offset timeout
+// Blocks until this server applied the replication stream up to offset (as
+// returned by a write on the master with CLIENT REPLOFFSET ON), or until
+// timeout milliseconds elapse (0 = wait forever), and returns the applied
+// offset; a result below offset means the wait timed out. A master has
+// applied its own writes and returns immediately
+func (h *CommandHandler) handleWaitOffset(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'waitoffset' command")
+	}
+
+	target, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil || target < 0 {
+		return protocol.EncodeError("ERR value is not an integer or out of range")
+	}
+
+	timeoutMs, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+	if err != nil {
+		return protocol.EncodeError("ERR timeout is not an integer or out of range")
+	}
+	if timeoutMs < 0 {
+		return protocol.EncodeError("ERR timeout is negative")
+	}
+
+	replMgr, _ := h.replicationMgr.(*replication.ReplicationManager)
+	if replMgr == nil {
+		return protocol.EncodeInteger64(0)
+	}
+	if !h.isReplica() {
+		offset, err := replMgr.SyncOffset(cmd.Context())
+		if err != nil {
+			return protocol.EncodeError(fmt.Sprintf("ERR %v", err))
+		}
+		return protocol.EncodeInteger64(offset)
+	}
+
+	var applied int64
+	pollUntil(cmd.Context(), time.Duration(timeoutMs)*time.Millisecond, func() bool {
+		applied = replMgr.AppliedOffset()
+		return applied >= target
+	})
+	return protocol.EncodeInteger64(applied)
+}
+
+// handleMemory handles MEMORY command
+// MEMORY STATS - Go heap statistics, fragmentation and per-type key/byte counts
+// MEMORY PURGE - Run a GC and return freed memory to the OS
+// MEMORY HELP - List available subcommands
+func (h *CommandHandler) handleMemory(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'memory' command")
+	}
+
+	switch strings.ToUpper(cmd.Args[1]) {
+	case "STATS":
+		return h.handleMemoryStats()
+	case "PURGE":
+		return h.handleMemoryPurge()
+	case "USAGE":
+		return h.handleMemoryUsage(cmd)
+	case "HELP":
+		return protocol.EncodeArray([]string{
+			"MEMORY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"STATS",
+			"    Return information about the memory usage of the server.",
+			"PURGE",
+			"    Force a garbage collection and return unused memory to the operating system.",
+			"USAGE <key> [SAMPLES <count>]",
+			"    Return the estimated memory usage in bytes of <key> and its value.",
+			"HELP",
+			"    Print this help.",
+		})
+	default:
+		return protocol.EncodeError(fmt.Sprintf("ERR unknown subcommand '%s'. Try MEMORY HELP.", cmd.Args[1]))
+	}
+}
+
+// handleMemoryStats reports Go runtime memory usage plus per-type key counts and
+// sizes; the sizes are estimated from a sample of the keys (see MemoryStatsByType)
+// used_memory_rss approximates RSS as memory obtained from the OS minus what the
+// runtime has already released back; the fragmentation ratio compares it to the in-use heap
+func (h *CommandHandler) handleMemoryStats() []byte {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	rss := ms.Sys - ms.HeapReleased
+	fragmentation := 0.0
+	if ms.HeapInuse > 0 {
+		fragmentation = float64(rss) / float64(ms.HeapInuse)
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdMemoryStats,
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	byType := (<-procCmd.Response).(map[string]storage.TypeMemoryStats)
+
+	totalKeys := int64(0)
+	totalBytes := int64(0)
+	for _, stats := range byType {
+		totalKeys += stats.Keys
+		totalBytes += stats.Bytes
+	}
+
+	result := []interface{}{
+		"used_memory", ms.HeapAlloc,
+		"used_memory_rss", rss,
+		"heap_inuse", ms.HeapInuse,
+		"heap_idle", ms.HeapIdle,
+		"heap_released", ms.HeapReleased,
+		"heap_objects", ms.HeapObjects,
+		"mem_fragmentation_ratio", fmt.Sprintf("%.2f", fragmentation),
+		"num_gc", ms.NumGC,
+		"keys.count", totalKeys,
+		"dataset.bytes", totalBytes,
+	}
+
+	types := make([]string, 0, len(byType))
+	for name := range byType {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	for _, name := range types {
+		result = append(result,
+			"keys."+name, byType[name].Keys,
+			"bytes."+name, byType[name].Bytes)
+	}
+
+	return protocol.EncodeInterfaceArray(result)
+}
+
+// handleMemoryUsage handles MEMORY USAGE key [SAMPLES count]
+// Returns the estimated bytes used by the key and its value (Bloom filters
+// count their whole bit array), or a null bulk string if the key does not
+// exist. SAMPLES is accepted for compatibility; every element is counted
+func (h *CommandHandler) handleMemoryUsage(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 && len(cmd.Args) != 5 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'memory|usage' command")
+	}
+	if len(cmd.Args) == 5 {
+		if strings.ToUpper(cmd.Args[3]) != "SAMPLES" {
+			return protocol.EncodeError("ERR syntax error")
+		}
+		if n, err := strconv.Atoi(cmd.Args[4]); err != nil || n < 0 {
+			return protocol.EncodeError("ERR value is not an integer or out of range")
+		}
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdMemoryUsage,
+		Key:      cmd.Args[2],
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+
+	result := (<-procCmd.Response).(processor.GetResult)
+	if !result.Exists {
+		return protocol.EncodeNullBulkString()
+	}
+	return protocol.EncodeInteger64(result.Value.(int64))
+}
+
+// handleMemoryPurge forces a GC and returns as much memory as possible to the OS
+// Useful after a large flush, when the runtime would otherwise keep the freed
+// spans around and RSS stays high
+func (h *CommandHandler) handleMemoryPurge() []byte {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	debug.FreeOSMemory()
+
+	runtime.ReadMemStats(&after)
+
+	rssBefore := before.Sys - before.HeapReleased
+	rssAfter := after.Sys - after.HeapReleased
+	freed := int64(rssBefore) - int64(rssAfter)
+	if freed < 0 {
+		freed = 0
+	}
+
+	log.Printf("MEMORY PURGE: heap %d -> %d bytes, returned %d bytes to the OS", before.HeapAlloc, after.HeapAlloc, freed)
+
+	return protocol.EncodeInterfaceArray([]interface{}{
+		"used_memory_before", before.HeapAlloc,
+		"used_memory_after", after.HeapAlloc,
+		"used_memory_rss_before", rssBefore,
+		"used_memory_rss_after", rssAfter,
+		"freed_to_os", freed,
+	})
+}
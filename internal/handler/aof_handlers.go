@@ -1,8 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"redis/internal/protocol"
@@ -15,130 +19,24 @@ func (h *CommandHandler) handleBGRewriteAOF(cmd *protocol.Command) []byte {
 	if h.aofWriter == nil {
 		return protocol.EncodeError("ERR AOF is not enabled")
 	}
+	if !h.aofRewrite.start() {
+		return protocol.EncodeError("ERR Background append only file rewriting already in progress")
+	}
 
 	// Start rewrite in background
+	h.beginSave()
 	go func() {
+		defer h.endSave()
 		log.Println("Starting AOF rewrite...")
 
-		// Get snapshot of current database state (shallow copy with COW)
-		snapshotFunc := func() [][]string {
-			// Get raw data snapshot from processor (fast - just shallow copy)
-			allData := h.processor.GetSnapshot()
-
-			// Filter and convert to commands in background (doesn't block processor!)
-			commands := make([][]string, 0)
-			now := time.Now()
-			filtered := 0
-
-			for key, value := range allData {
-				// Skip expired keys
-				if value.ExpiresAt != nil && now.After(*value.ExpiresAt) {
-					filtered++
-					continue
-				}
-
-				switch value.Type {
-				case 0: // StringType
-					if str, ok := value.Data.(string); ok {
-						commands = append(commands, []string{"SET", key, str})
-						if value.ExpiresAt != nil {
-							ttl := int(time.Until(*value.ExpiresAt).Seconds())
-							if ttl > 0 {
-								commands = append(commands, []string{"EXPIRE", key, fmt.Sprintf("%d", ttl)})
-							}
-						}
-					}
-
-				case 1: // ListType
-					if list, ok := value.Data.([]string); ok && len(list) > 0 {
-						listCmd := []string{"RPUSH", key}
-						listCmd = append(listCmd, list...)
-						commands = append(commands, listCmd)
-						if value.ExpiresAt != nil {
-							ttl := int(time.Until(*value.ExpiresAt).Seconds())
-							if ttl > 0 {
-								commands = append(commands, []string{"EXPIRE", key, fmt.Sprintf("%d", ttl)})
-							}
-						}
-					}
-
-				case 2: // SetType
-					// Access the Set struct and its Members map
-					if setStruct, ok := value.Data.(*storage.Set); ok && setStruct != nil && len(setStruct.Members) > 0 {
-						setCmd := []string{"SADD", key}
-						for member := range setStruct.Members {
-							setCmd = append(setCmd, member)
-						}
-						commands = append(commands, setCmd)
-						if value.ExpiresAt != nil {
-							ttl := int(time.Until(*value.ExpiresAt).Seconds())
-							if ttl > 0 {
-								commands = append(commands, []string{"EXPIRE", key, fmt.Sprintf("%d", ttl)})
-							}
-						}
-					}
-
-				case 3: // HashType
-					if hash, ok := value.Data.(map[string]string); ok && len(hash) > 0 {
-						hashCmd := []string{"HSET", key}
-						for field, val := range hash {
-							hashCmd = append(hashCmd, field, val)
-						}
-						commands = append(commands, hashCmd)
-						if value.ExpiresAt != nil {
-							ttl := int(time.Until(*value.ExpiresAt).Seconds())
-							if ttl > 0 {
-								commands = append(commands, []string{"EXPIRE", key, fmt.Sprintf("%d", ttl)})
-							}
-						}
-					}
-
-				case 4: // ZSetType
-					// Access the ZSet struct and get all members with scores
-					if zsetStruct, ok := value.Data.(*storage.ZSet); ok && zsetStruct != nil && zsetStruct.Len() > 0 {
-						members := zsetStruct.GetAll()
-						if len(members) > 0 {
-							zsetCmd := []string{"ZADD", key}
-							for _, member := range members {
-								zsetCmd = append(zsetCmd, fmt.Sprintf("%f", member.Score), member.Member)
-							}
-							commands = append(commands, zsetCmd)
-							if value.ExpiresAt != nil {
-								ttl := int(time.Until(*value.ExpiresAt).Seconds())
-								if ttl > 0 {
-									commands = append(commands, []string{"EXPIRE", key, fmt.Sprintf("%d", ttl)})
-								}
-							}
-						}
-					}
-
-				case 5: // BloomFilterType
-					// Bloom filters require special handling - they can't be reconstructed from members
-					// Skip in AOF as they're probabilistic structures that should be rebuilt
-					// Alternative: could implement BF.RESERVE + BF.DUMP/BF.RESTORE commands
-					log.Printf("Skipping BloomFilter key '%s' in AOF (not supported in AOF rewrite)", key)
-
-				case 6: // HyperLogLogType
-					// HyperLogLog also requires special handling - it's a cardinality estimator
-					// Skip in AOF as it can't be reconstructed from individual elements
-					// Alternative: could implement PFMERGE or raw register export
-					log.Printf("Skipping HyperLogLog key '%s' in AOF (not supported in AOF rewrite)", key)
-				}
-			}
-
-			if filtered > 0 {
-				log.Printf("Filtered %d expired keys from AOF rewrite snapshot", filtered)
-			}
-
-			return commands
-		}
-
 		// Perform rewrite
-		if err := h.aofWriter.Rewrite(snapshotFunc); err != nil {
+		err := h.aofWriter.Rewrite(h.aofRewriteSnapshot)
+		if err != nil {
 			log.Printf("AOF rewrite failed: %v", err)
 		} else {
 			log.Println("AOF rewrite completed successfully")
 		}
+		h.aofRewrite.finish(err)
 
 		// Release snapshot reference (COW optimization)
 		h.processor.ReleaseSnapshot()
@@ -147,42 +45,276 @@ func (h *CommandHandler) handleBGRewriteAOF(cmd *protocol.Command) []byte {
 	return protocol.EncodeSimpleString("Background append only file rewriting started")
 }
 
+// aofRewriteSnapshot returns the commands that rebuild the current dataset
+// It reads a copy-on-write snapshot of the data; the caller must release it
+// with ReleaseSnapshot once the commands are written
+// TTLs are written as PEXPIREAT with the key's absolute deadline, so replaying
+// the rewritten file later restores the same remaining TTL instead of a fresh one
+func (h *CommandHandler) aofRewriteSnapshot() [][]string {
+	// Get raw data snapshot from processor (fast - just shallow copy)
+	allData := h.processor.GetSnapshot()
+
+	// Filter and convert to commands in background (doesn't block processor!)
+	commands := make([][]string, 0)
+	now := time.Now()
+	filtered := 0
+
+	for key, value := range allData {
+		// Skip expired keys
+		if value.ExpiresAt != nil && now.After(*value.ExpiresAt) {
+			filtered++
+			continue
+		}
+
+		// A tombstone is only valid with its TTL, so it is one SET ... PXAT ... NEGATIVE
+		if value.Negative && value.ExpiresAt != nil {
+			if str, ok := value.StringValue(); ok {
+				commands = append(commands, []string{"SET", key, str,
+					"PXAT", strconv.FormatInt(value.ExpiresAt.UnixMilli(), 10), "NEGATIVE"})
+				continue
+			}
+		}
+
+		rebuilt := aofRewriteValue(key, value, now)
+		if len(rebuilt) == 0 {
+			continue
+		}
+		commands = append(commands, rebuilt...)
+		if value.ExpiresAt != nil {
+			expire := []string{"PEXPIREAT", key, strconv.FormatInt(value.ExpiresAt.UnixMilli(), 10)}
+			if value.SlidingTTL != 0 {
+				expire = append(expire, "SLIDING", strconv.FormatInt(value.SlidingTTL.Milliseconds(), 10))
+			}
+			commands = append(commands, expire)
+		}
+	}
+
+	if filtered > 0 {
+		log.Printf("Filtered %d expired keys from AOF rewrite snapshot", filtered)
+	}
+
+	return commands
+}
+
+// aofRewriteValue returns the commands that recreate one value, without its TTL
+// Returns nil for empty collections and for types that can't be replayed
+func aofRewriteValue(key string, value *storage.Value, now time.Time) [][]string {
+	switch value.Type {
+	case storage.StringType:
+		if str, ok := value.StringValue(); ok {
+			return [][]string{{"SET", key, str}}
+		}
+
+	case storage.ListType:
+		if list, ok := value.Data.(*storage.List); ok && list.Length > 0 {
+			return [][]string{append([]string{"RPUSH", key}, list.ToSlice()...)}
+		}
+
+	case storage.SetType:
+		if set, ok := value.Data.(*storage.Set); ok && set.Len() > 0 {
+			return [][]string{append([]string{"SADD", key}, set.GetMembers()...)}
+		}
+
+	case storage.HashType:
+		hash, ok := value.Data.(*storage.Hash)
+		if !ok {
+			return nil
+		}
+		hashCmd := []string{"HSET", key}
+		var fieldExpiries [][]string
+		pairs := hash.GetAll()
+		for i := 0; i < len(pairs); i += 2 {
+			field := pairs[i]
+			at, hasTTL := hash.FieldExpiry(field)
+			if hasTTL && !at.After(now) {
+				continue // Field already expired
+			}
+			hashCmd = append(hashCmd, field, pairs[i+1])
+			if hasTTL {
+				fieldExpiries = append(fieldExpiries, []string{"HPEXPIREAT", key, strconv.FormatInt(at.UnixMilli(), 10), "FIELDS", "1", field})
+			}
+		}
+		if len(hashCmd) == 2 {
+			return nil
+		}
+		return append([][]string{hashCmd}, fieldExpiries...)
+
+	case storage.ZSetType:
+		if zset, ok := value.Data.(*storage.ZSet); ok && zset.Len() > 0 {
+			zsetCmd := []string{"ZADD", key}
+			for _, member := range zset.GetAll() {
+				zsetCmd = append(zsetCmd, strconv.FormatFloat(member.Score, 'g', -1, 64), member.Member)
+			}
+			return [][]string{zsetCmd}
+		}
+
+	case storage.BloomFilterType:
+		// Bloom filters require special handling - they can't be reconstructed from members
+		// Skip in AOF as they're probabilistic structures that should be rebuilt
+		// Alternative: could implement BF.RESERVE + BF.DUMP/BF.RESTORE commands
+		log.Printf("Skipping BloomFilter key '%s' in AOF (not supported in AOF rewrite)", key)
+
+	case storage.HyperLogLogType:
+		// HyperLogLog also requires special handling - it's a cardinality estimator
+		// Skip in AOF as it can't be reconstructed from individual elements
+		// Alternative: could implement PFMERGE or raw register export
+		log.Printf("Skipping HyperLogLog key '%s' in AOF (not supported in AOF rewrite)", key)
+
+	case storage.CuckooFilterType, storage.CountMinSketchType:
+		// Only fingerprints (or counters merging many items) are stored, so
+		// the items can't be replayed; the value is restored whole from its
+		// DUMP payload instead
+		payload, err := rdb.EncodeDump(value)
+		if err != nil {
+			log.Printf("Skipping key '%s' in AOF: %v", key, err)
+			return nil
+		}
+		return [][]string{{"RESTORE", key, "0", string(payload), "REPLACE"}}
+	}
+	return nil
+}
+
 // handleBGSave triggers RDB snapshot in the background
 func (h *CommandHandler) handleBGSave(cmd *protocol.Command) []byte {
+	if err := h.BackgroundSave(); err != nil {
+		return protocol.EncodeError(err.Error())
+	}
+	return protocol.EncodeSimpleString("Background saving started")
+}
+
+// errBGSaveInProgress is returned when a BGSAVE is started while one runs
+var errBGSaveInProgress = errors.New("ERR Background save already in progress")
+
+// BackgroundSave starts an RDB snapshot in the background, for BGSAVE and the
+// auto-save ticker alike, so both report in INFO persistence. Once the save
+// succeeds, only the writes counted before it started are cleared from
+// rdb_changes_since_last_save: later ones may have missed the snapshot
+func (h *CommandHandler) BackgroundSave() error {
+	if !h.bgsave.start() {
+		return errBGSaveInProgress
+	}
+
+	var changes int64
+	if h.changesSinceSave != nil {
+		changes = h.changesSinceSave()
+	}
+
 	// Start snapshot in background
+	h.beginSave()
 	go func() {
+		defer h.endSave()
 		log.Println("Starting RDB snapshot (BGSAVE)...")
+		err := h.saveRDB()
+		if err == nil && h.onSaved != nil {
+			h.onSaved(changes)
+		}
+		h.bgsave.finish(err)
+	}()
+	return nil
+}
 
-		// Create RDB writer
-		rdbWriter := rdb.NewWriter("dump.rdb")
+// bgJobStatus tracks a kind of background job (BGSAVE, BGREWRITEAOF) for
+// INFO persistence and to refuse starting a second one while it runs
+type bgJobStatus struct {
+	inProgress atomic.Bool
+	lastFailed atomic.Bool
+}
 
-		// Get actual data snapshot through processor (shallow copy with COW!)
-		dataSnapshot := h.processor.GetDataSnapshot()
+// start marks the job as running; returns false if one already is
+func (s *bgJobStatus) start() bool {
+	return s.inProgress.CompareAndSwap(false, true)
+}
 
-		// Filter expired keys in background (doesn't block processor!)
-		now := time.Now()
-		filtered := 0
-		for key, value := range dataSnapshot {
-			if value.ExpiresAt != nil && now.After(*value.ExpiresAt) {
-				delete(dataSnapshot, key)
-				filtered++
-			}
-		}
+// finish records the outcome of the running job
+func (s *bgJobStatus) finish(err error) {
+	s.lastFailed.Store(err != nil)
+	s.inProgress.Store(false)
+}
 
-		if filtered > 0 {
-			log.Printf("Filtered %d expired keys from RDB snapshot", filtered)
-		}
+// inProgressFlag reports whether the job is running the way INFO does (1 or 0)
+func (s *bgJobStatus) inProgressFlag() int {
+	if s.inProgress.Load() {
+		return 1
+	}
+	return 0
+}
 
-		// Perform save
-		if err := rdbWriter.Save(dataSnapshot); err != nil {
-			log.Printf("RDB snapshot failed: %v", err)
-		} else {
-			log.Println("RDB snapshot completed successfully")
+// statusString reports the last outcome the way INFO does ("ok" or "err")
+func (s *bgJobStatus) statusString() string {
+	if s.lastFailed.Load() {
+		return "err"
+	}
+	return "ok"
+}
+
+// saveRDB writes an RDB snapshot of the dataset to the configured RDB file,
+// the one the server loads at startup and DEBUG RELOAD loads back
+// Used by BGSAVE (in a goroutine) and SHUTDOWN (synchronously)
+func (h *CommandHandler) saveRDB() error {
+	path := h.rdbFilepath
+	if path == "" {
+		path = "dump.rdb"
+	}
+
+	// Create RDB writer
+	rdbWriter := rdb.NewWriter(path)
+
+	// Get actual data snapshot through processor (shallow copy with COW!)
+	dataSnapshot := h.processor.GetDataSnapshot()
+
+	// Release snapshot reference (COW optimization)
+	defer h.processor.ReleaseSnapshot()
+
+	// Filter expired keys in background (doesn't block processor!)
+	now := time.Now()
+	filtered := 0
+	for key, value := range dataSnapshot {
+		if value.ExpiresAt != nil && now.After(*value.ExpiresAt) {
+			delete(dataSnapshot, key)
+			filtered++
 		}
+	}
 
-		// Release snapshot reference (COW optimization)
-		h.processor.ReleaseSnapshot()
-	}()
+	if filtered > 0 {
+		log.Printf("Filtered %d expired keys from RDB snapshot", filtered)
+	}
 
-	return protocol.EncodeSimpleString("Background saving started")
+	// Perform save
+	if err := rdbWriter.Save(dataSnapshot); err != nil {
+		log.Printf("RDB snapshot failed: %v", err)
+		return err
+	}
+	log.Println("RDB snapshot completed successfully")
+	return nil
+}
+
+// persistenceInfo renders the INFO persistence section: background save and
+// AOF rewrite state, and whether the last AOF write reached the file
+func (h *CommandHandler) persistenceInfo() string {
+	var changes int64
+	if h.changesSinceSave != nil {
+		changes = h.changesSinceSave()
+	}
+
+	aofEnabled, aofWriteStatus := 0, "ok"
+	if h.aofWriter != nil {
+		stats := h.aofWriter.GetStats()
+		if stats.Enabled {
+			aofEnabled = 1
+		}
+		if !stats.LastWriteOK {
+			aofWriteStatus = "err"
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# Persistence\r\n")
+	b.WriteString(fmt.Sprintf("rdb_changes_since_last_save:%d\r\n", changes))
+	b.WriteString(fmt.Sprintf("rdb_bgsave_in_progress:%d\r\n", h.bgsave.inProgressFlag()))
+	b.WriteString(fmt.Sprintf("rdb_last_bgsave_status:%s\r\n", h.bgsave.statusString()))
+	b.WriteString(fmt.Sprintf("aof_enabled:%d\r\n", aofEnabled))
+	b.WriteString(fmt.Sprintf("aof_rewrite_in_progress:%d\r\n", h.aofRewrite.inProgressFlag()))
+	b.WriteString(fmt.Sprintf("aof_last_bgrewrite_status:%s\r\n", h.aofRewrite.statusString()))
+	b.WriteString(fmt.Sprintf("aof_last_write_status:%s\r\n", aofWriteStatus))
+	return b.String()
 }
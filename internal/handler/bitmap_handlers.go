@@ -82,8 +82,8 @@ func (h *CommandHandler) handleGetBit(cmd *protocol.Command) []byte {
 }
 
 // handleBitCount returns the count of bits set to 1
-// BITCOUNT key [start end]
-// Start and end are byte indices (not bit indices)
+// BITCOUNT key [start end [BYTE|BIT]]
+// Start and end are byte indices unless the BIT unit is given
 func (h *CommandHandler) handleBitCount(cmd *protocol.Command) []byte {
 	if len(cmd.Args) < 2 {
 		return protocol.EncodeError("ERR wrong number of arguments for 'bitcount' command")
@@ -92,8 +92,19 @@ func (h *CommandHandler) handleBitCount(cmd *protocol.Command) []byte {
 	key := cmd.Args[1]
 
 	var start, end *int64
+	bitUnit := false
 
-	// Parse optional start and end
+	// Parse optional start, end and unit
+	if len(cmd.Args) > 5 {
+		return protocol.EncodeError("ERR syntax error")
+	}
+	if len(cmd.Args) == 5 {
+		unit, err := parseBitUnit(cmd.Args[4])
+		if err != nil {
+			return protocol.EncodeError(err.Error())
+		}
+		bitUnit = unit
+	}
 	if len(cmd.Args) >= 4 {
 		s, err := strconv.ParseInt(cmd.Args[2], 10, 64)
 		if err != nil {
@@ -113,7 +124,7 @@ func (h *CommandHandler) handleBitCount(cmd *protocol.Command) []byte {
 	procCmd := &processor.Command{
 		Type:     processor.CmdBitCount,
 		Key:      key,
-		Args:     []interface{}{start, end},
+		Args:     []interface{}{start, end, bitUnit},
 		Response: make(chan interface{}, 1),
 	}
 	h.processor.Submit(procCmd)
@@ -128,8 +139,8 @@ func (h *CommandHandler) handleBitCount(cmd *protocol.Command) []byte {
 }
 
 // handleBitPos finds the position of the first bit set to 0 or 1
-// BITPOS key bit [start] [end]
-// Start and end are byte indices
+// BITPOS key bit [start [end [BYTE|BIT]]]
+// Start and end are byte indices unless the BIT unit is given
 func (h *CommandHandler) handleBitPos(cmd *protocol.Command) []byte {
 	if len(cmd.Args) < 3 {
 		return protocol.EncodeError("ERR wrong number of arguments for 'bitpos' command")
@@ -144,6 +155,19 @@ func (h *CommandHandler) handleBitPos(cmd *protocol.Command) []byte {
 	}
 
 	var start, end *int64
+	bitUnit := false
+
+	// Parse optional unit
+	if len(cmd.Args) > 6 {
+		return protocol.EncodeError("ERR syntax error")
+	}
+	if len(cmd.Args) == 6 {
+		unit, err := parseBitUnit(cmd.Args[5])
+		if err != nil {
+			return protocol.EncodeError(err.Error())
+		}
+		bitUnit = unit
+	}
 
 	// Parse optional start
 	if len(cmd.Args) >= 4 {
@@ -166,7 +190,7 @@ func (h *CommandHandler) handleBitPos(cmd *protocol.Command) []byte {
 	procCmd := &processor.Command{
 		Type:     processor.CmdBitPos,
 		Key:      key,
-		Args:     []interface{}{bit, start, end},
+		Args:     []interface{}{bit, start, end, bitUnit},
 		Response: make(chan interface{}, 1),
 	}
 	h.processor.Submit(procCmd)
@@ -180,6 +204,19 @@ func (h *CommandHandler) handleBitPos(cmd *protocol.Command) []byte {
 	return protocol.EncodeInteger(res.Result)
 }
 
+// parseBitUnit parses the BYTE|BIT range unit of BITCOUNT and BITPOS
+// Returns true for BIT
+func parseBitUnit(arg string) (bool, error) {
+	switch strings.ToUpper(arg) {
+	case "BYTE":
+		return false, nil
+	case "BIT":
+		return true, nil
+	default:
+		return false, errSyntax
+	}
+}
+
 // handleBitOp performs bitwise operations between strings
 // BITOP operation destkey srckey [srckey ...]
 // Operations: AND, OR, XOR, NOT
@@ -27,6 +27,10 @@ type BlockedClient struct {
 	DestKey string            // Destination key (empty for BLPOP/BRPOP)
 	DestDir BlockingDirection // Direction for destination (BLMOVE)
 
+	// For BLMPOP/BZMPOP: pops from a key and returns the encoded reply
+	// (nil for commands served by the notifier's popFunc)
+	PopFunc BlockingPopFunc
+
 	// Redis-style: store list.Element pointers for O(1) removal
 	// Maps key → position in that key's blocked client list
 	listNodes map[string]*list.Element
@@ -36,9 +40,14 @@ type BlockedClient struct {
 type BlockingResult struct {
 	Key   string // The key that had data
 	Value string // The popped value
+	Reply []byte // Encoded reply built by the client's PopFunc (BLMPOP/BZMPOP)
 	Err   error  // Error if any (timeout, etc.)
 }
 
+// BlockingPopFunc pops data for a blocked client from key, returning the
+// encoded reply and whether anything was popped
+type BlockingPopFunc func(key string) ([]byte, bool)
+
 // BlockingManager manages blocked clients waiting for list data
 // Uses Redis-style architecture with doubly-linked lists for O(1) removal
 type BlockingManager struct {
@@ -71,6 +80,7 @@ func (bm *BlockingManager) BlockClient(
 	timeout time.Duration,
 	destKey string,
 	destDir BlockingDirection,
+	popFunc BlockingPopFunc,
 ) <-chan BlockingResult {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
@@ -85,6 +95,7 @@ func (bm *BlockingManager) BlockClient(
 		ResponseCh: make(chan BlockingResult, 1),
 		DestKey:    destKey,
 		DestDir:    destDir,
+		PopFunc:    popFunc,
 		listNodes:  make(map[string]*list.Element),
 	}
 
@@ -143,7 +154,10 @@ func (bm *BlockingManager) handleTimeout(bc *BlockedClient) {
 }
 
 // UnblockClientWithData attempts to unblock clients waiting on the given key
-// Called when data is pushed to a list
+// Called when data is pushed to a list or added to a sorted set
+// Clients are tried in FIFO order and the first one that can pop is served;
+// clients with a PopFunc pop through it, the others through popFunc (nil when
+// the key is not a list)
 // Returns true if a client was unblocked (data was consumed)
 func (bm *BlockingManager) UnblockClientWithData(key string, popFunc func(direction BlockingDirection) (string, bool), pushFunc func(destKey string, value string, direction BlockingDirection)) bool {
 	bm.mu.Lock()
@@ -154,32 +168,47 @@ func (bm *BlockingManager) UnblockClientWithData(key string, popFunc func(direct
 		return false // No one waiting
 	}
 
-	// Get the first waiting client (FIFO) - O(1)
-	elem := blockedList.Front()
-	bc := elem.Value.(*BlockedClient)
+	for elem := blockedList.Front(); elem != nil; elem = elem.Next() {
+		bc := elem.Value.(*BlockedClient)
 
-	// Try to pop the value
-	value, ok := popFunc(bc.Direction)
-	if !ok {
-		return false // No data (shouldn't happen if called correctly)
-	}
+		// Try to pop for this client
+		var result BlockingResult
+		if bc.PopFunc != nil {
+			reply, ok := bc.PopFunc(key)
+			if !ok {
+				continue
+			}
+			result = BlockingResult{Key: key, Reply: reply}
+		} else {
+			if popFunc == nil {
+				continue
+			}
+			value, ok := popFunc(bc.Direction)
+			if !ok {
+				continue
+			}
 
-	// If this is a BLMOVE, push to destination
-	if bc.DestKey != "" {
-		pushFunc(bc.DestKey, value, bc.DestDir)
-	}
+			// If this is a BLMOVE, push to destination
+			if bc.DestKey != "" {
+				pushFunc(bc.DestKey, value, bc.DestDir)
+			}
+			result = BlockingResult{Key: key, Value: value}
+		}
 
-	// Remove client from all data structures - O(1) per key!
-	bm.removeBlockedClientLocked(bc)
+		// Remove client from all data structures - O(1) per key!
+		bm.removeBlockedClientLocked(bc)
 
-	// Send result to client
-	select {
-	case bc.ResponseCh <- BlockingResult{Key: key, Value: value}:
-	default:
+		// Send result to client
+		select {
+		case bc.ResponseCh <- result:
+		default:
+		}
+		close(bc.ResponseCh)
+
+		return true
 	}
-	close(bc.ResponseCh)
 
-	return true
+	return false // No client could pop (e.g. the key holds another type)
 }
 
 // removeBlockedClientLocked removes a blocked client from all data structures
@@ -1,11 +1,14 @@
 package handler
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"redis/internal/processor"
 	"redis/internal/protocol"
+	"redis/internal/storage"
 )
 
 // BlockingCommandFunc is a function type for blocking command handlers
@@ -20,6 +23,10 @@ type BlockingConfig struct {
 	DestKey   string            // For BLMOVE
 	DestDir   BlockingDirection // For BLMOVE
 	ActualKey string            // Which key actually provided data (set on immediate returns)
+
+	// For BLMPOP/BZMPOP
+	Count   int             // Maximum number of elements to pop
+	PopFunc BlockingPopFunc // Pops from the key that received data
 }
 
 // handleBLPop handles the BLPOP command
@@ -237,6 +244,215 @@ func (h *CommandHandler) handleBRPopLPush(cmd *protocol.Command, clientID int64)
 	}
 }
 
+// handleBLMPop handles the BLMPOP command
+// BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func (h *CommandHandler) handleBLMPop(cmd *protocol.Command, clientID int64) ([]byte, bool, *BlockingConfig) {
+	if len(cmd.Args) < 5 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'blmpop' command"), false, nil
+	}
+
+	timeout, errReply := parseBlockingTimeout(cmd.Args[1])
+	if errReply != nil {
+		return errReply, false, nil
+	}
+	parsed, errReply := parseMPopArgs(cmd.Args[2:], "LEFT", "RIGHT")
+	if errReply != nil {
+		return errReply, false, nil
+	}
+
+	direction := BlockRight
+	if parsed.first {
+		direction = BlockLeft
+	}
+	config := &BlockingConfig{
+		Keys:      parsed.keys,
+		Direction: direction,
+		Timeout:   timeout,
+		Count:     parsed.count,
+		PopFunc: func(key string) ([]byte, bool) {
+			res := h.lmpop([]string{key}, parsed.first, parsed.count)
+			if res.Err != nil || res.Key == "" {
+				return nil, false
+			}
+			return encodeLMPopReply(res.Key, res.Elements), true
+		},
+	}
+
+	// Try to pop from the keys in order (non-blocking first attempt)
+	res := h.lmpop(parsed.keys, parsed.first, parsed.count)
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error()), false, nil
+	}
+	if res.Key != "" {
+		h.txManager.TouchKeys([]string{res.Key})
+		config.ActualKey = res.Key
+		return encodeLMPopReply(res.Key, res.Elements), false, config
+	}
+
+	// No data available - need to block
+	if config.Timeout == 0 {
+		config.Timeout = 365 * 24 * time.Hour
+	}
+	return nil, true, config
+}
+
+// handleBZMPop handles the BZMPOP command
+// BZMPOP timeout numkeys key [key ...] MIN|MAX [COUNT count]
+func (h *CommandHandler) handleBZMPop(cmd *protocol.Command, clientID int64) ([]byte, bool, *BlockingConfig) {
+	if len(cmd.Args) < 5 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'bzmpop' command"), false, nil
+	}
+
+	timeout, errReply := parseBlockingTimeout(cmd.Args[1])
+	if errReply != nil {
+		return errReply, false, nil
+	}
+	parsed, errReply := parseMPopArgs(cmd.Args[2:], "MIN", "MAX")
+	if errReply != nil {
+		return errReply, false, nil
+	}
+
+	// Direction is BlockLeft for MIN and BlockRight for MAX
+	direction := BlockRight
+	if parsed.first {
+		direction = BlockLeft
+	}
+	config := &BlockingConfig{
+		Keys:      parsed.keys,
+		Direction: direction,
+		Timeout:   timeout,
+		Count:     parsed.count,
+		PopFunc: func(key string) ([]byte, bool) {
+			res := h.zmpop([]string{key}, !parsed.first, parsed.count)
+			if res.Err != nil || res.Key == "" {
+				return nil, false
+			}
+			return encodeZMPopReply(res.Key, res.Members), true
+		},
+	}
+
+	// Try to pop from the keys in order (non-blocking first attempt)
+	res := h.zmpop(parsed.keys, !parsed.first, parsed.count)
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error()), false, nil
+	}
+	if res.Key != "" {
+		h.txManager.TouchKeys([]string{res.Key})
+		config.ActualKey = res.Key
+		return encodeZMPopReply(res.Key, res.Members), false, config
+	}
+
+	// No data available - need to block
+	if config.Timeout == 0 {
+		config.Timeout = 365 * 24 * time.Hour
+	}
+	return nil, true, config
+}
+
+// handleBZPopMin handles the BZPOPMIN command
+// BZPOPMIN key [key ...] timeout
+func (h *CommandHandler) handleBZPopMin(cmd *protocol.Command, clientID int64) ([]byte, bool, *BlockingConfig) {
+	return h.handleBZPop(cmd, "bzpopmin", false)
+}
+
+// handleBZPopMax handles the BZPOPMAX command
+// BZPOPMAX key [key ...] timeout
+func (h *CommandHandler) handleBZPopMax(cmd *protocol.Command, clientID int64) ([]byte, bool, *BlockingConfig) {
+	return h.handleBZPop(cmd, "bzpopmax", true)
+}
+
+// handleBZPop pops the lowest (or highest, if max) scored member from the
+// first non-empty sorted set, replying [key, member, score]
+func (h *CommandHandler) handleBZPop(cmd *protocol.Command, name string, max bool) ([]byte, bool, *BlockingConfig) {
+	if len(cmd.Args) < 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for '" + name + "' command"), false, nil
+	}
+
+	// Parse timeout (last argument)
+	timeout, errReply := parseBlockingTimeout(cmd.Args[len(cmd.Args)-1])
+	if errReply != nil {
+		return errReply, false, nil
+	}
+
+	keys := cmd.Args[1 : len(cmd.Args)-1]
+
+	// Direction is BlockLeft for BZPOPMIN and BlockRight for BZPOPMAX
+	direction := BlockLeft
+	if max {
+		direction = BlockRight
+	}
+	config := &BlockingConfig{
+		Keys:      keys,
+		Direction: direction,
+		Timeout:   timeout,
+		Count:     1,
+		PopFunc: func(key string) ([]byte, bool) {
+			res := h.zmpop([]string{key}, max, 1)
+			if res.Err != nil || res.Key == "" {
+				return nil, false
+			}
+			return encodeBZPopReply(res.Key, res.Members[0]), true
+		},
+	}
+
+	// Try to pop from the keys in order (non-blocking first attempt)
+	res := h.zmpop(keys, max, 1)
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error()), false, nil
+	}
+	if res.Key != "" {
+		h.txManager.TouchKeys([]string{res.Key})
+		config.ActualKey = res.Key
+		return encodeBZPopReply(res.Key, res.Members[0]), false, config
+	}
+
+	// No data available - need to block
+	if config.Timeout == 0 {
+		config.Timeout = 365 * 24 * time.Hour
+	}
+	return nil, true, config
+}
+
+// encodeBZPopReply encodes the [key, member, score] reply of BZPOPMIN/BZPOPMAX
+func encodeBZPopReply(key string, member storage.ZSetMember) []byte {
+	return protocol.EncodeArray([]string{key, member.Member, fmt.Sprintf("%.17g", member.Score)})
+}
+
+// parseBlockingTimeout parses a timeout in seconds (0 = block forever)
+// Returns the error reply to send if it is invalid
+func parseBlockingTimeout(arg string) (time.Duration, []byte) {
+	timeoutSecs, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, protocol.EncodeError("ERR timeout is not a float or out of range")
+	}
+	if timeoutSecs < 0 {
+		return 0, protocol.EncodeError("ERR timeout is negative")
+	}
+	return time.Duration(timeoutSecs * float64(time.Second)), nil
+}
+
+// lmpop pops up to count elements from the first non-empty list among keys
+func (h *CommandHandler) lmpop(keys []string, left bool, count int) processor.MPopResult {
+	procCmd := &processor.Command{
+		Type:     processor.CmdLMPop,
+		Args:     []interface{}{keys, left, count},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	return (<-procCmd.Response).(processor.MPopResult)
+}
+
+// zmpop pops up to count members from the first non-empty sorted set among keys
+func (h *CommandHandler) zmpop(keys []string, max bool, count int) processor.ZMPopResult {
+	procCmd := &processor.Command{
+		Type:     processor.CmdZMPop,
+		Args:     []interface{}{keys, max, count},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	return (<-procCmd.Response).(processor.ZMPopResult)
+}
+
 // NotifyListPush should be called when data is pushed to a list
 // This wakes up any blocked clients waiting on that key
 func (h *CommandHandler) NotifyListPush(key string) {
@@ -267,10 +483,24 @@ func (h *CommandHandler) NotifyListPush(key string) {
 	h.blockingManager.UnblockClientWithData(key, popFunc, pushFunc)
 }
 
+// NotifyZSetAdd should be called when members are added to a sorted set
+// This wakes up a BZMPOP/BZPOPMIN/BZPOPMAX client waiting on that key
+func (h *CommandHandler) NotifyZSetAdd(key string) {
+	if !h.blockingManager.HasBlockedClients(key) {
+		return
+	}
+
+	// Sorted set waiters pop through their own PopFunc; keep serving them
+	// until the set runs out of members or no one is left waiting
+	for h.blockingManager.UnblockClientWithData(key, nil, nil) {
+	}
+}
+
 // IsBlockingCommand checks if a command is a blocking command
 func IsBlockingCommand(cmd string) bool {
 	switch cmd {
-	case "BLPOP", "BRPOP", "BLMOVE", "BRPOPLPUSH":
+	case "BLPOP", "BRPOP", "BLMOVE", "BRPOPLPUSH", "BLMPOP", "BZMPOP",
+		"BZPOPMIN", "BZPOPMAX":
 		return true
 	}
 	return false
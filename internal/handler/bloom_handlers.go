@@ -1,15 +1,20 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"redis/internal/processor"
 	"redis/internal/protocol"
+	"redis/internal/storage"
 )
 
 // handleBFReserve creates a new Bloom filter
-// BF.RESERVE key error_rate capacity
+// BF.RESERVE key error_rate capacity [EXPANSION expansion] [NONSCALING]
+// Once full, the filter adds a sub-filter expansion times larger (2 by
+// default); a NONSCALING filter refuses new items instead
 func (h *CommandHandler) handleBFReserve(cmd *protocol.Command) []byte {
 	if len(cmd.Args) < 4 {
 		return protocol.EncodeError("ERR wrong number of arguments for 'bf.reserve' command")
@@ -36,11 +41,36 @@ func (h *CommandHandler) handleBFReserve(cmd *protocol.Command) []byte {
 	if capacity == 0 {
 		return protocol.EncodeError("ERR capacity must be greater than 0")
 	}
+	if capacity > storage.MaxBloomCapacity {
+		return protocol.EncodeError(errBloomCapacityTooLarge)
+	}
+
+	expansion := uint32(storage.DefaultBloomExpansion)
+	nonScaling := false
+	for i := 4; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "EXPANSION":
+			if i+1 >= len(cmd.Args) {
+				return protocol.EncodeError("ERR syntax error")
+			}
+			i++
+			if expansion, err = parseBloomExpansion(cmd.Args[i]); err != nil {
+				return protocol.EncodeError(err.Error())
+			}
+		case "NONSCALING":
+			nonScaling = true
+		default:
+			return protocol.EncodeError("ERR syntax error")
+		}
+	}
+	if nonScaling {
+		expansion = 0
+	}
 
 	procCmd := &processor.Command{
 		Type:     processor.CmdBFReserve,
 		Key:      key,
-		Args:     []interface{}{errorRate, capacity},
+		Args:     []interface{}{errorRate, capacity, expansion},
 		Response: make(chan interface{}, 1),
 	}
 	h.processor.Submit(procCmd)
@@ -202,15 +232,136 @@ func (h *CommandHandler) handleBFInfo(cmd *protocol.Command) []byte {
 
 	info := res.Info
 
+	// A non-scaling filter has no expansion rate
+	expansion := protocol.EncodeNullBulkString()
+	if info.Expansion > 0 {
+		expansion = protocol.EncodeInteger(info.Expansion)
+	}
+
 	// Encode as array with field-value pairs
-	response := []interface{}{
-		"Capacity", fmt.Sprintf("%d", info.Capacity),
-		"Size", fmt.Sprintf("%d", info.Size),
-		"Number of filters", fmt.Sprintf("%d", info.NumHashes),
-		"Number of items inserted", fmt.Sprintf("%d", info.Count),
-		"Expansion rate", fmt.Sprintf("%.6f", info.ErrorRate),
-		"Bits per item", fmt.Sprintf("%.2f", info.BitsPerItem),
+	// Size is the memory used by the filter in bytes, like RedisBloom
+	return protocol.EncodeRawArray([][]byte{
+		protocol.EncodeBulkString("Capacity"), protocol.EncodeInteger64(int64(info.Capacity)),
+		protocol.EncodeBulkString("Size"), protocol.EncodeInteger64(info.Bytes),
+		protocol.EncodeBulkString("Number of filters"), protocol.EncodeInteger(info.NumFilters),
+		protocol.EncodeBulkString("Number of items inserted"), protocol.EncodeInteger64(int64(info.Count)),
+		protocol.EncodeBulkString("Expansion rate"), expansion,
+		protocol.EncodeBulkString("Error rate"), protocol.EncodeBulkString(strconv.FormatFloat(info.ErrorRate, 'f', -1, 64)),
+		protocol.EncodeBulkString("Hash functions"), protocol.EncodeInteger(int(info.NumHashes)),
+		protocol.EncodeBulkString("Bits per item"), protocol.EncodeBulkString(fmt.Sprintf("%.2f", info.BitsPerItem)),
+		protocol.EncodeBulkString("Fill ratio"), protocol.EncodeBulkString(fmt.Sprintf("%.4f", info.FillRatio)),
+	})
+}
+
+// handleBFInsert adds items to a Bloom filter, creating it first if needed
+// BF.INSERT key [CAPACITY capacity] [ERROR error] [EXPANSION expansion] [NOCREATE] [NONSCALING] ITEMS item [item ...]
+// The creation options only apply when the filter does not exist yet
+func (h *CommandHandler) handleBFInsert(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 4 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'bf.insert' command")
+	}
+
+	key := cmd.Args[1]
+	opts := storage.BloomInsertOptions{
+		Capacity:  storage.DefaultBloomCapacity,
+		ErrorRate: storage.DefaultBloomErrorRate,
+		Expansion: storage.DefaultBloomExpansion,
+	}
+	nonScaling := false
+
+	i := 2
+	for ; i < len(cmd.Args); i++ {
+		option := strings.ToUpper(cmd.Args[i])
+		if option == "ITEMS" {
+			break
+		}
+
+		switch option {
+		case "NOCREATE":
+			opts.NoCreate = true
+			continue
+		case "NONSCALING":
+			nonScaling = true
+			continue
+		case "CAPACITY", "ERROR", "EXPANSION":
+		default:
+			return protocol.EncodeError("ERR syntax error")
+		}
+
+		if i+1 >= len(cmd.Args) {
+			return protocol.EncodeError("ERR syntax error")
+		}
+		i++
+		value := cmd.Args[i]
+
+		var err error
+		switch option {
+		case "CAPACITY":
+			opts.Capacity, err = strconv.ParseUint(value, 10, 64)
+			if err != nil || opts.Capacity == 0 {
+				return protocol.EncodeError("ERR capacity must be a positive integer")
+			}
+			if opts.Capacity > storage.MaxBloomCapacity {
+				return protocol.EncodeError(errBloomCapacityTooLarge)
+			}
+		case "ERROR":
+			opts.ErrorRate, err = strconv.ParseFloat(value, 64)
+			if err != nil || opts.ErrorRate <= 0 || opts.ErrorRate >= 1 {
+				return protocol.EncodeError("ERR error rate must be between 0 and 1")
+			}
+		case "EXPANSION":
+			if opts.Expansion, err = parseBloomExpansion(value); err != nil {
+				return protocol.EncodeError(err.Error())
+			}
+		}
+	}
+
+	if i >= len(cmd.Args)-1 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'bf.insert' command")
+	}
+	if nonScaling {
+		opts.Expansion = 0
 	}
 
+	procCmd := &processor.Command{
+		Type:     processor.CmdBFInsert,
+		Key:      key,
+		Args:     []interface{}{opts, cmd.Args[i+1:]},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	result := <-procCmd.Response
+
+	res := result.(processor.BoolSliceResult)
+	if res.Err == storage.ErrKeyNotFound {
+		return protocol.EncodeError("ERR not found")
+	}
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+
+	response := make([]interface{}, len(res.Results))
+	for j, added := range res.Results {
+		if added {
+			response[j] = "1"
+		} else {
+			response[j] = "0"
+		}
+	}
 	return protocol.EncodeInterfaceArray(response)
 }
+
+// errBloomCapacityTooLarge is returned for capacities above storage.MaxBloomCapacity
+const errBloomCapacityTooLarge = "ERR BF: capacity is too large"
+
+// parseBloomExpansion parses the EXPANSION argument of BF.RESERVE and BF.INSERT
+func parseBloomExpansion(value string) (uint32, error) {
+	expansion, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || expansion < 1 {
+		return 0, errors.New("ERR expansion must be a positive integer")
+	}
+	if expansion > storage.MaxBloomExpansion {
+		return 0, fmt.Errorf("ERR expansion must be at most %d", storage.MaxBloomExpansion)
+	}
+	return uint32(expansion), nil
+}
@@ -0,0 +1,365 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"redis/internal/protocol"
+	"redis/internal/replication"
+	"redis/internal/version"
+)
+
+// handleClientCommand handles CLIENT subcommands, which read or change the
+// state of the calling connection
+// CLIENT ID - Return the connection ID
+// CLIENT INFO - Describe the calling connection
+// CLIENT LIST [ID id ...] - Describe every connection (or the given ones)
+// CLIENT WAIT-DEFAULT numreplicas timeout - Make every EXEC wait for replica ACKs
+// CLIENT WAIT-DEFAULT - Return the current numreplicas and timeout
+// CLIENT REPLOFFSET ON|OFF - Append the master offset to write replies
+// CLIENT TRACKING ON|OFF [REDIRECT id] - Send invalidations for keys read (see tracking.go)
+// CLIENT GETREDIR - Return the tracking redirect (-1 = tracking off, 0 = none)
+// CLIENT SETNAME name / CLIENT GETNAME - Name the connection or return its name
+// CLIENT SETINFO LIB-NAME|LIB-VER value - Record the client library
+func (h *CommandHandler) handleClientCommand(cmd *protocol.Command, client *Client) []byte {
+	if len(cmd.Args) < 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'client' command")
+	}
+
+	subcommand := strings.ToUpper(cmd.Args[1])
+	switch subcommand {
+	case "ID":
+		if len(cmd.Args) != 2 {
+			return protocol.EncodeError("ERR wrong number of arguments for 'client|id' command")
+		}
+		return protocol.EncodeInteger64(client.ID)
+
+	case "INFO":
+		if len(cmd.Args) != 2 {
+			return protocol.EncodeError("ERR wrong number of arguments for 'client|info' command")
+		}
+		return protocol.EncodeBulkString(h.clientInfoLine(client))
+
+	case "LIST":
+		return h.handleClientList(cmd)
+
+	case "WAIT-DEFAULT":
+		return h.handleClientWaitDefault(cmd, client)
+
+	case "REPLOFFSET":
+		if len(cmd.Args) != 3 {
+			return protocol.EncodeError("ERR wrong number of arguments for 'client|reploffset' command")
+		}
+		switch strings.ToUpper(cmd.Args[2]) {
+		case "ON":
+			client.ReplOffset = true
+		case "OFF":
+			client.ReplOffset = false
+		default:
+			return protocol.EncodeError("ERR syntax error")
+		}
+		return OKResponse
+
+	case "TRACKING":
+		return h.handleClientTracking(cmd, client)
+
+	case "GETREDIR":
+		if len(cmd.Args) != 2 {
+			return protocol.EncodeError("ERR wrong number of arguments for 'client|getredir' command")
+		}
+		redirect, tracking := h.tracking.Redirect(client.ID)
+		if !tracking {
+			return protocol.EncodeInteger64(-1)
+		}
+		return protocol.EncodeInteger64(redirect)
+
+	case "SETNAME":
+		if len(cmd.Args) != 3 {
+			return protocol.EncodeError("ERR wrong number of arguments for 'client|setname' command")
+		}
+		if !validClientAttr(cmd.Args[2]) {
+			return protocol.EncodeError("ERR Client names cannot contain spaces, newlines or special characters.")
+		}
+		client.updateState(func(s *ConnState) { s.Name = cmd.Args[2] })
+		return OKResponse
+
+	case "GETNAME":
+		if len(cmd.Args) != 2 {
+			return protocol.EncodeError("ERR wrong number of arguments for 'client|getname' command")
+		}
+		name := client.State().Name
+		if name == "" {
+			return protocol.EncodeNullBulkString()
+		}
+		return protocol.EncodeBulkString(name)
+
+	case "SETINFO":
+		return h.handleClientSetInfo(cmd, client)
+
+	default:
+		return protocol.EncodeError(fmt.Sprintf("ERR unknown subcommand '%s'. Try CLIENT ID, CLIENT INFO, CLIENT LIST, CLIENT WAIT-DEFAULT, CLIENT REPLOFFSET, CLIENT TRACKING, CLIENT GETREDIR, CLIENT SETNAME, CLIENT GETNAME, CLIENT SETINFO", cmd.Args[1]))
+	}
+}
+
+// handleClientList handles CLIENT LIST [TYPE normal|pubsub] [ID id ...]
+// Returns one line per connection, ordered by ID
+func (h *CommandHandler) handleClientList(cmd *protocol.Command) []byte {
+	var ids map[int64]bool
+	typeFilter := ""
+	for i := 2; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "TYPE":
+			if i+1 >= len(cmd.Args) {
+				return protocol.EncodeError("ERR syntax error")
+			}
+			i++
+			typeFilter = strings.ToLower(cmd.Args[i])
+			if typeFilter != "normal" && typeFilter != "pubsub" {
+				return protocol.EncodeError(fmt.Sprintf("ERR Unknown client type '%s'", cmd.Args[i]))
+			}
+		case "ID":
+			if i+1 >= len(cmd.Args) {
+				return protocol.EncodeError("ERR syntax error")
+			}
+			ids = make(map[int64]bool)
+			for i++; i < len(cmd.Args); i++ {
+				id, err := strconv.ParseInt(cmd.Args[i], 10, 64)
+				if err != nil || id <= 0 {
+					return protocol.EncodeError("ERR Invalid client ID")
+				}
+				ids[id] = true
+			}
+		default:
+			return protocol.EncodeError("ERR syntax error")
+		}
+	}
+
+	clients := make([]*Client, 0)
+	h.clients.Range(func(_, value interface{}) bool {
+		c := value.(*Client)
+		if ids == nil || ids[c.ID] {
+			clients = append(clients, c)
+		}
+		return true
+	})
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+
+	var b strings.Builder
+	for _, c := range clients {
+		sub, psub := h.clientSubscriptionCounts(c)
+		if typeFilter != "" && (typeFilter == "pubsub") != (sub+psub > 0) {
+			continue
+		}
+		b.WriteString(h.clientInfoLine(c))
+	}
+	return protocol.EncodeBulkString(b.String())
+}
+
+// clientSubscriptionCounts returns how many channels and patterns a client
+// is subscribed to
+// Counts come from the shared PubSub registry, which is safe to read from any
+// connection's goroutine, unlike the per-connection Client fields
+func (h *CommandHandler) clientSubscriptionCounts(c *Client) (int, int) {
+	subscriberID := fmt.Sprintf("client:%d", c.ID)
+	pubsub := h.processor.GetStore().PubSub
+	return len(pubsub.SubscriberChannels(subscriberID)), len(pubsub.SubscriberPatterns(subscriberID))
+}
+
+// clientInfoLine formats a connection the way CLIENT INFO and CLIENT LIST report it
+// flags come from clientFlags; ssub is always 0 as shard channels
+// (SSUBSCRIBE) are not implemented
+func (h *CommandHandler) clientInfoLine(c *Client) string {
+	sub, psub := h.clientSubscriptionCounts(c)
+	state := c.State()
+
+	age := int64(0)
+	if !c.CreatedAt.IsZero() {
+		age = int64(time.Since(c.CreatedAt) / time.Second)
+	}
+
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d flags=%s db=%d sub=%d psub=%d ssub=0 user=%s resp=%d lib-name=%s lib-ver=%s\n",
+		c.ID, c.Conn.RemoteAddr(), c.Conn.LocalAddr(), state.Name, age, clientFlags(state, sub+psub),
+		state.DB, sub, psub, state.User, state.Protocol, state.LibName, state.LibVer)
+}
+
+// handleClientWaitDefault sets or reports the connection's durability level
+// With numreplicas > 0, EXEC of a transaction that wrote anything only replies
+// after numreplicas replicas acknowledged its writes, waiting at most timeout
+// milliseconds (0 = forever). With fewer replicas online the transaction is
+// refused with NOREPLICAS before it runs. numreplicas 0 turns the implicit
+// WAIT off
+func (h *CommandHandler) handleClientWaitDefault(cmd *protocol.Command, client *Client) []byte {
+	if len(cmd.Args) == 2 {
+		return protocol.EncodeIntegerArray([]int{
+			client.WaitReplicas,
+			int(client.WaitTimeout / time.Millisecond),
+		})
+	}
+	if len(cmd.Args) != 4 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'client|wait-default' command")
+	}
+
+	numReplicas, err := strconv.Atoi(cmd.Args[2])
+	if err != nil || numReplicas < 0 {
+		return protocol.EncodeError("ERR value is not an integer or out of range")
+	}
+	timeoutMs, err := strconv.ParseInt(cmd.Args[3], 10, 64)
+	if err != nil {
+		return protocol.EncodeError("ERR timeout is not an integer or out of range")
+	}
+	if timeoutMs < 0 {
+		return protocol.EncodeError("ERR timeout is negative")
+	}
+	if numReplicas > 0 && h.isReplica() {
+		return protocol.EncodeError("ERR WAIT cannot be used with replica instances")
+	}
+
+	client.WaitReplicas = numReplicas
+	client.WaitTimeout = time.Duration(timeoutMs) * time.Millisecond
+	return OKResponse
+}
+
+// handleClientTracking turns client side caching on or off for the calling
+// connection. Invalidations go to the connection itself as RESP3 pushes, so a
+// RESP2 connection has to redirect them to a client subscribed to
+// __redis__:invalidate. Turning tracking off forgets the keys read so far
+func (h *CommandHandler) handleClientTracking(cmd *protocol.Command, client *Client) []byte {
+	if len(cmd.Args) < 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'client|tracking' command")
+	}
+
+	var redirect int64
+	for i := 3; i < len(cmd.Args); i++ {
+		if strings.ToUpper(cmd.Args[i]) != "REDIRECT" || i+1 >= len(cmd.Args) {
+			return protocol.EncodeError("ERR syntax error")
+		}
+		i++
+		id, err := strconv.ParseInt(cmd.Args[i], 10, 64)
+		if err != nil {
+			return protocol.EncodeError("ERR value is not an integer or out of range")
+		}
+		if _, exists := h.clients.Load(id); !exists || id == client.ID {
+			return protocol.EncodeError("ERR The client ID you want redirect to does not exist")
+		}
+		redirect = id
+	}
+
+	switch strings.ToUpper(cmd.Args[2]) {
+	case "ON":
+		if redirect == 0 && client.State().Protocol != 3 {
+			return protocol.EncodeError("ERR Tracking on a RESP2 connection needs REDIRECT to a client subscribed to " + trackingInvalidateChannel + ", or HELLO 3")
+		}
+		h.tracking.Enable(client.ID, redirect)
+		client.updateState(func(s *ConnState) { s.Tracking = true })
+	case "OFF":
+		h.tracking.Disable(client.ID)
+		client.updateState(func(s *ConnState) { s.Tracking = false })
+	default:
+		return protocol.EncodeError("ERR syntax error")
+	}
+	return OKResponse
+}
+
+// handleHello handles HELLO [protover [AUTH username password] [SETNAME name]],
+// which switches the connection to RESP2 or RESP3 and describes the server
+// AUTH authenticates before the protocol changes: a failed AUTH leaves the
+// connection as it was. RESP3 only changes how this reply and pushes are
+// encoded; other replies keep their RESP2 form, which RESP3 clients also read
+func (h *CommandHandler) handleHello(cmd *protocol.Command, client *Client) []byte {
+	state := client.State()
+	proto := state.Protocol
+	if len(cmd.Args) >= 2 {
+		var err error
+		proto, err = strconv.Atoi(cmd.Args[1])
+		if err != nil {
+			return protocol.EncodeError("ERR Protocol version is not an integer or out of range")
+		}
+		if proto != 2 && proto != 3 {
+			return protocol.EncodeError("NOPROTO unsupported protocol version")
+		}
+	}
+
+	var username, password, name string
+	var withAuth, withName bool
+	for i := 2; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "AUTH":
+			if i+2 >= len(cmd.Args) {
+				return protocol.EncodeError(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", cmd.Args[i]))
+			}
+			username, password = cmd.Args[i+1], cmd.Args[i+2]
+			withAuth = true
+			i += 2
+		case "SETNAME":
+			if i+1 >= len(cmd.Args) {
+				return protocol.EncodeError(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", cmd.Args[i]))
+			}
+			name = cmd.Args[i+1]
+			withName = true
+			i++
+		default:
+			return protocol.EncodeError(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", cmd.Args[i]))
+		}
+	}
+
+	if withAuth && !authenticateUser(username, password) {
+		return protocol.EncodeError(errWrongPass)
+	}
+	if withName && !validClientAttr(name) {
+		return protocol.EncodeError("ERR Client names cannot contain spaces, newlines or special characters.")
+	}
+
+	client.updateState(func(s *ConnState) {
+		s.Protocol = proto
+		if withAuth {
+			s.User = username
+		}
+		if withName {
+			s.Name = name
+		}
+	})
+
+	role := "master"
+	if h.isReplica() {
+		role = "replica"
+	}
+	fields := [][]byte{
+		protocol.EncodeBulkString("server"), protocol.EncodeBulkString("redis"),
+		protocol.EncodeBulkString("version"), protocol.EncodeBulkString(version.Version),
+		protocol.EncodeBulkString("proto"), protocol.EncodeInteger(proto),
+		protocol.EncodeBulkString("id"), protocol.EncodeInteger64(client.ID),
+		protocol.EncodeBulkString("mode"), protocol.EncodeBulkString("standalone"),
+		protocol.EncodeBulkString("role"), protocol.EncodeBulkString(role),
+		protocol.EncodeBulkString("modules"), protocol.EncodeArray(nil),
+	}
+	if proto == 3 {
+		return protocol.EncodeRawMap(fields)
+	}
+	return protocol.EncodeRawArray(fields)
+}
+
+// withReplOffset wraps a reply as [reply, offset] for a connection that
+// turned on CLIENT REPLOFFSET, where offset is the master replication offset
+// once the writes it made are queued for propagation
+// Error replies, and every reply when the option is off, pass through unchanged,
+// as does a reply whose offset could not be had before ctx was done
+func (h *CommandHandler) withReplOffset(ctx context.Context, client *Client, response []byte) []byte {
+	if !client.ReplOffset || len(response) == 0 || response[0] == '-' {
+		return response
+	}
+
+	replMgr, ok := h.replicationMgr.(*replication.ReplicationManager)
+	if !ok || replMgr == nil {
+		return response
+	}
+
+	offset, err := replMgr.SyncOffset(ctx)
+	if err != nil {
+		return response
+	}
+	return protocol.EncodeRawArray([][]byte{response, protocol.EncodeInteger64(offset)})
+}
@@ -120,6 +120,8 @@ func (h *CommandHandler) handleClusterNodes(cmd *protocol.Command) []byte {
 }
 
 // handleClusterKeySlot returns the hash slot for a given key
+// Uses the cluster's slot configuration when cluster mode is set up, and the
+// default CRC16/16384 layout otherwise
 // CLUSTER KEYSLOT <key>
 func (h *CommandHandler) handleClusterKeySlot(cmd *protocol.Command) []byte {
 	if len(cmd.Args) < 3 {
@@ -128,6 +130,9 @@ func (h *CommandHandler) handleClusterKeySlot(cmd *protocol.Command) []byte {
 
 	key := cmd.Args[2]
 	slot := cluster.KeyHashSlot(key)
+	if h.store.Cluster != nil {
+		slot = h.store.Cluster.KeySlot(key)
+	}
 
 	return protocol.EncodeInteger(slot)
 }
@@ -170,7 +175,7 @@ func (h *CommandHandler) handleClusterAddSlots(cmd *protocol.Command) []byte {
 
 	for i := 2; i < len(cmd.Args); i++ {
 		slot, err := strconv.Atoi(cmd.Args[i])
-		if err != nil || slot < 0 || slot >= cluster.NumSlots {
+		if err != nil || slot < 0 || slot >= h.store.Cluster.NumSlots() {
 			return protocol.EncodeError(fmt.Sprintf("ERR Invalid slot %s", cmd.Args[i]))
 		}
 		slots = append(slots, slot)
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CommandStats counts executed commands, overall and per command name
+// Safe for concurrent use by every connection goroutine
+type CommandStats struct {
+	total atomic.Int64
+	calls sync.Map // lowercase command name -> *atomic.Int64
+}
+
+// Record counts one execution of command
+// Names outside the command table are not counted: they were rejected as
+// unknown, and keeping a counter per arbitrary client-sent name would let
+// clients grow the map (and the metrics output) without bound
+func (s *CommandStats) Record(command string) {
+	info, known := commandTable[strings.ToUpper(command)]
+	if !known {
+		return
+	}
+	s.total.Add(1)
+
+	name := info.Name
+	counter, ok := s.calls.Load(name)
+	if !ok {
+		counter, _ = s.calls.LoadOrStore(name, new(atomic.Int64))
+	}
+	counter.(*atomic.Int64).Add(1)
+}
+
+// Total returns the number of commands executed since startup
+func (s *CommandStats) Total() int64 {
+	return s.total.Load()
+}
+
+// Calls returns the number of executions per command name
+func (s *CommandStats) Calls() map[string]int64 {
+	calls := make(map[string]int64)
+	s.calls.Range(func(key, value interface{}) bool {
+		calls[key.(string)] = value.(*atomic.Int64).Load()
+		return true
+	})
+	return calls
+}
@@ -0,0 +1,565 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"redis/internal/protocol"
+	"redis/internal/storage"
+)
+
+// CommandInfo describes a command for COMMAND / COMMAND INFO
+// Container commands (OBJECT, CLUSTER, SLOWLOG, ...) list their subcommands,
+// which are named "container|subcommand" like in Redis
+type CommandInfo struct {
+	Name        string
+	Arity       int      // Positive = exact arg count, negative = minimum (command name included)
+	Flags       []string // Command flags (write, readonly, fast, ...)
+	FirstKey    int      // Position of the first key (0 = no keys)
+	LastKey     int      // Position of the last key (-1 = last argument)
+	Step        int      // Step between keys
+	Categories  []string // ACL categories without the "@", derived from the rest (see acl_categories.go)
+	Subcommands []*CommandInfo
+}
+
+// Common flag sets
+var (
+	flagsWrite         = []string{"write"}
+	flagsWriteFast     = []string{"write", "fast"}
+	flagsWriteDenyOOM  = []string{"write", "denyoom"}
+	flagsWriteDenyFast = []string{"write", "denyoom", "fast"}
+	flagsRead          = []string{"readonly"}
+	flagsReadFast      = []string{"readonly", "fast"}
+	flagsAdmin         = []string{"admin", "noscript"}
+	flagsAdminStale    = []string{"admin", "noscript", "loading", "stale"}
+	flagsBlocking      = []string{"write", "blocking"}
+	flagsPubSub        = []string{"pubsub", "noscript", "loading", "stale"}
+	flagsTransaction   = []string{"noscript", "loading", "stale", "fast"}
+	flagsServerFast    = []string{"loading", "stale", "fast"}
+	flagsServer        = []string{"loading", "stale"}
+	flagsScript        = []string{"noscript", "movablekeys"}
+	flagsWriteMovable  = []string{"write", "movablekeys"}
+	flagsBlockMovable  = []string{"write", "blocking", "movablekeys"}
+)
+
+// commandTable holds metadata for every supported command, keyed by uppercase name
+var commandTable = buildCommandTable([]*CommandInfo{
+	// String/Basic commands
+	{Name: "ping", Arity: -1, Flags: flagsServerFast},
+	{Name: "echo", Arity: 2, Flags: flagsServerFast},
+	{Name: "set", Arity: -3, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "setex", Arity: 4, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "psetex", Arity: 4, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "get", Arity: 2, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "del", Arity: -2, Flags: flagsWrite, FirstKey: 1, LastKey: -1, Step: 1},
+	{Name: "exists", Arity: -2, Flags: flagsReadFast, FirstKey: 1, LastKey: -1, Step: 1},
+	{Name: "keys", Arity: 2, Flags: flagsRead},
+	{Name: "scan", Arity: -2, Flags: flagsRead},
+	{Name: "dbsize", Arity: 1, Flags: flagsReadFast},
+	{Name: "flushall", Arity: -1, Flags: flagsWrite},
+	{Name: "flushdb", Arity: -1, Flags: flagsWrite},
+	{Name: "expire", Arity: -3, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "pexpireat", Arity: -3, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "ttl", Arity: 2, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "copy", Arity: -3, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 2, Step: 1},
+	{Name: "dump", Arity: 2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "restore", Arity: -4, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "incr", Arity: 2, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "incrby", Arity: 3, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "decr", Arity: 2, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "decrby", Arity: 3, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "append", Arity: 3, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "strlen", Arity: 2, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "getrange", Arity: 4, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "substr", Arity: 4, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "setrange", Arity: 4, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "command", Arity: -1, Flags: flagsServer, Subcommands: []*CommandInfo{
+		{Name: "count", Arity: 2, Flags: flagsServer},
+		{Name: "info", Arity: -2, Flags: flagsServer},
+		{Name: "list", Arity: -2, Flags: flagsServer},
+		{Name: "getkeys", Arity: -3, Flags: flagsServer},
+		{Name: "help", Arity: 2, Flags: flagsServer},
+	}},
+
+	// List commands
+	{Name: "lpush", Arity: -3, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "rpush", Arity: -3, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "lpop", Arity: -2, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "rpop", Arity: -2, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "llen", Arity: 2, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "lrange", Arity: 4, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "lindex", Arity: 3, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "lset", Arity: 4, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "lrem", Arity: 4, Flags: flagsWrite, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "ltrim", Arity: 4, Flags: flagsWrite, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "linsert", Arity: 5, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "lpos", Arity: -3, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "lmpop", Arity: -4, Flags: flagsWriteMovable},
+	{Name: "blpop", Arity: -3, Flags: flagsBlocking, FirstKey: 1, LastKey: -2, Step: 1},
+	{Name: "brpop", Arity: -3, Flags: flagsBlocking, FirstKey: 1, LastKey: -2, Step: 1},
+	{Name: "blmove", Arity: 6, Flags: flagsBlocking, FirstKey: 1, LastKey: 2, Step: 1},
+	{Name: "brpoplpush", Arity: 4, Flags: flagsBlocking, FirstKey: 1, LastKey: 2, Step: 1},
+	{Name: "blmpop", Arity: -5, Flags: flagsBlockMovable},
+
+	// Hash commands
+	{Name: "hset", Arity: -4, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hget", Arity: 3, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hmget", Arity: -3, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hdel", Arity: -3, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hexists", Arity: 3, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hlen", Arity: 2, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hkeys", Arity: 2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hvals", Arity: 2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hgetall", Arity: 2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hsetnx", Arity: 4, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hincrby", Arity: 4, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hincrbyfloat", Arity: 4, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hrandfield", Arity: -2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hexpire", Arity: -6, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hpexpire", Arity: -6, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hexpireat", Arity: -6, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hpexpireat", Arity: -6, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "httl", Arity: -5, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hpttl", Arity: -5, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hpersist", Arity: -5, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hgetdel", Arity: -5, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "hgetex", Arity: -5, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+
+	// Set commands
+	{Name: "sadd", Arity: -3, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "srem", Arity: -3, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "sismember", Arity: 3, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "smembers", Arity: 2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "scard", Arity: 2, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "spop", Arity: -2, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "srandmember", Arity: -2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "sunion", Arity: -2, Flags: flagsRead, FirstKey: 1, LastKey: -1, Step: 1},
+	{Name: "sinter", Arity: -2, Flags: flagsRead, FirstKey: 1, LastKey: -1, Step: 1},
+	{Name: "sdiff", Arity: -2, Flags: flagsRead, FirstKey: 1, LastKey: -1, Step: 1},
+	{Name: "smove", Arity: 4, Flags: flagsWriteFast, FirstKey: 1, LastKey: 2, Step: 1},
+	{Name: "sunionstore", Arity: -3, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: -1, Step: 1},
+	{Name: "sinterstore", Arity: -3, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: -1, Step: 1},
+	{Name: "sdiffstore", Arity: -3, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: -1, Step: 1},
+
+	// Sorted Set commands
+	{Name: "zadd", Arity: -4, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zrem", Arity: -3, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zscore", Arity: 3, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zrank", Arity: 3, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zrevrank", Arity: 3, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zcard", Arity: 2, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zrange", Arity: -4, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zrevrange", Arity: -4, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zrangebyscore", Arity: -4, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zrevrangebyscore", Arity: -4, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zincrby", Arity: 4, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zcount", Arity: 4, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zpopmin", Arity: -2, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zpopmax", Arity: -2, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zremrangebyscore", Arity: 4, Flags: flagsWrite, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zremrangebyrank", Arity: 4, Flags: flagsWrite, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "zmpop", Arity: -4, Flags: flagsWriteMovable},
+	{Name: "bzmpop", Arity: -5, Flags: flagsBlockMovable},
+	{Name: "bzpopmin", Arity: -3, Flags: flagsBlocking, FirstKey: 1, LastKey: -2, Step: 1},
+	{Name: "bzpopmax", Arity: -3, Flags: flagsBlocking, FirstKey: 1, LastKey: -2, Step: 1},
+
+	// Geospatial commands
+	{Name: "geoadd", Arity: -5, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "geopos", Arity: -2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "geodist", Arity: -4, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "geohash", Arity: -2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "georadius", Arity: -6, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "georadiusbymember", Arity: -5, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+
+	// Bloom Filter commands
+	{Name: "bf.reserve", Arity: -4, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "bf.add", Arity: 3, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "bf.madd", Arity: -3, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "bf.exists", Arity: 3, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "bf.mexists", Arity: -3, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "bf.info", Arity: -2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "bf.insert", Arity: -4, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+
+	// Cuckoo Filter commands
+	{Name: "cf.reserve", Arity: 3, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "cf.add", Arity: 3, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "cf.exists", Arity: 3, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "cf.del", Arity: 3, Flags: flagsWriteFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "cf.count", Arity: 3, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "cf.info", Arity: 2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+
+	// Count-Min Sketch commands
+	{Name: "cms.initbydim", Arity: 4, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "cms.incrby", Arity: -4, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "cms.query", Arity: -3, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "cms.info", Arity: 2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+
+	// HyperLogLog commands
+	{Name: "pfadd", Arity: -2, Flags: flagsWriteDenyFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "pfcount", Arity: -2, Flags: flagsRead, FirstKey: 1, LastKey: -1, Step: 1},
+	{Name: "pfmerge", Arity: -2, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: -1, Step: 1},
+
+	// Bitmap commands
+	{Name: "setbit", Arity: 4, Flags: flagsWriteDenyOOM, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "getbit", Arity: 3, Flags: flagsReadFast, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "bitcount", Arity: -2, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "bitpos", Arity: -3, Flags: flagsRead, FirstKey: 1, LastKey: 1, Step: 1},
+	{Name: "bitop", Arity: -4, Flags: flagsWriteDenyOOM, FirstKey: 2, LastKey: -1, Step: 1},
+
+	// Pub/Sub commands
+	{Name: "publish", Arity: 3, Flags: []string{"pubsub", "loading", "stale", "fast"}},
+	{Name: "subscribe", Arity: -2, Flags: flagsPubSub},
+	{Name: "unsubscribe", Arity: -1, Flags: flagsPubSub},
+	{Name: "psubscribe", Arity: -2, Flags: flagsPubSub},
+	{Name: "punsubscribe", Arity: -1, Flags: flagsPubSub},
+	{Name: "pubsub", Arity: -2, Subcommands: []*CommandInfo{
+		{Name: "channels", Arity: -2, Flags: flagsPubSub},
+		{Name: "numsub", Arity: -2, Flags: flagsPubSub},
+		{Name: "numpat", Arity: 2, Flags: flagsPubSub},
+	}},
+
+	// Transaction commands
+	{Name: "multi", Arity: 1, Flags: flagsTransaction},
+	{Name: "exec", Arity: 1, Flags: []string{"noscript", "loading", "stale", "skip_slowlog"}},
+	{Name: "discard", Arity: 1, Flags: flagsTransaction},
+	{Name: "watch", Arity: -2, Flags: flagsTransaction, FirstKey: 1, LastKey: -1, Step: 1},
+	{Name: "unwatch", Arity: 1, Flags: flagsTransaction},
+
+	// Cluster commands
+	{Name: "cluster", Arity: -2, Subcommands: []*CommandInfo{
+		{Name: "slots", Arity: 2, Flags: flagsServer},
+		{Name: "nodes", Arity: 2, Flags: flagsServer},
+		{Name: "keyslot", Arity: 3, Flags: flagsServer},
+		{Name: "info", Arity: 2, Flags: flagsServer},
+		{Name: "addslots", Arity: -3, Flags: flagsAdminStale},
+		{Name: "myid", Arity: 2, Flags: flagsServer},
+		{Name: "enabled", Arity: 2, Flags: flagsServer},
+	}},
+
+	// Lua scripting commands
+	{Name: "eval", Arity: -3, Flags: flagsScript},
+	{Name: "evalsha", Arity: -3, Flags: flagsScript},
+	{Name: "script", Arity: -2, Subcommands: []*CommandInfo{
+		{Name: "load", Arity: 3, Flags: []string{"noscript", "stale"}},
+		{Name: "exists", Arity: -3, Flags: []string{"noscript"}},
+		{Name: "flush", Arity: -2, Flags: []string{"noscript"}},
+		{Name: "kill", Arity: 2, Flags: []string{"noscript", "allow_busy"}},
+	}},
+
+	// Admin/Debug commands
+	{Name: "slowlog", Arity: -2, Subcommands: []*CommandInfo{
+		{Name: "get", Arity: -2, Flags: flagsAdminStale},
+		{Name: "len", Arity: 2, Flags: flagsAdminStale},
+		{Name: "reset", Arity: 2, Flags: flagsAdminStale},
+	}},
+	{Name: "object", Arity: -2, Subcommands: []*CommandInfo{
+		{Name: "encoding", Arity: 3, Flags: flagsRead, FirstKey: 2, LastKey: 2, Step: 1},
+		{Name: "help", Arity: 2, Flags: flagsServer},
+	}},
+	{Name: "debug", Arity: -2, Flags: flagsAdminStale},
+	{Name: "memory", Arity: -2, Subcommands: []*CommandInfo{
+		{Name: "stats", Arity: 2, Flags: flagsServer},
+		{Name: "purge", Arity: 2, Flags: flagsServer},
+		{Name: "usage", Arity: -3, Flags: flagsRead, FirstKey: 2, LastKey: 2, Step: 1},
+		{Name: "help", Arity: 2, Flags: flagsServer},
+	}},
+	{Name: "bgrewriteaof", Arity: 1, Flags: flagsAdmin},
+	{Name: "bgsave", Arity: -1, Flags: flagsAdmin},
+	{Name: "shutdown", Arity: -1, Flags: []string{"admin", "noscript", "loading", "stale", "allow_busy"}},
+	{Name: "wait", Arity: 3, Flags: []string{"noscript"}},
+	{Name: "waitoffset", Arity: 3, Flags: []string{"readonly", "noscript", "stale"}},
+	{Name: "lolwut", Arity: -1, Flags: flagsReadFast},
+	{Name: "client", Arity: -2, Subcommands: []*CommandInfo{
+		{Name: "id", Arity: 2, Flags: []string{"noscript", "loading", "stale"}},
+		{Name: "wait-default", Arity: -2, Flags: []string{"noscript", "loading", "stale"}},
+		{Name: "reploffset", Arity: 3, Flags: []string{"noscript", "loading", "stale"}},
+		{Name: "tracking", Arity: -3, Flags: []string{"noscript", "loading", "stale"}},
+		{Name: "getredir", Arity: 2, Flags: []string{"noscript", "loading", "stale"}},
+		{Name: "setname", Arity: 3, Flags: []string{"noscript", "loading", "stale"}},
+		{Name: "getname", Arity: 2, Flags: []string{"noscript", "loading", "stale"}},
+		{Name: "setinfo", Arity: 4, Flags: []string{"noscript", "loading", "stale"}},
+	}},
+	{Name: "hello", Arity: -1, Flags: []string{"noscript", "loading", "stale", "fast"}},
+	{Name: "auth", Arity: -2, Flags: []string{"noscript", "loading", "stale", "fast"}},
+	{Name: "acl", Arity: -2, Subcommands: []*CommandInfo{
+		{Name: "cat", Arity: -2, Flags: []string{"noscript", "loading", "stale"}},
+		{Name: "help", Arity: 2, Flags: []string{"loading", "stale"}},
+	}},
+
+	// Replication commands (handled via pipeline interception)
+	{Name: "info", Arity: -1, Flags: flagsServer},
+	{Name: "replicaof", Arity: 3, Flags: []string{"admin", "noscript", "stale"}},
+	{Name: "slaveof", Arity: 3, Flags: []string{"admin", "noscript", "stale"}},
+	{Name: "replconf", Arity: -1, Flags: flagsAdminStale},
+	{Name: "psync", Arity: -3, Flags: flagsAdmin},
+	{Name: "quit", Arity: -1, Flags: []string{"noscript", "loading", "stale", "fast"}},
+})
+
+// buildCommandTable indexes command metadata by uppercase name, prefixes
+// subcommand names with their container ("object|encoding") and fills in
+// the ACL categories
+func buildCommandTable(infos []*CommandInfo) map[string]*CommandInfo {
+	table := make(map[string]*CommandInfo, len(infos))
+	for _, info := range infos {
+		for _, sub := range info.Subcommands {
+			sub.Name = info.Name + "|" + sub.Name
+			sub.Categories = commandCategories(sub)
+		}
+		info.Categories = commandCategories(info)
+		table[strings.ToUpper(info.Name)] = info
+	}
+	return table
+}
+
+// LookupCommandInfo returns the metadata for a command, or for a subcommand
+// when given as "container|subcommand"
+func LookupCommandInfo(name string) (*CommandInfo, bool) {
+	container, subcommand, hasSub := strings.Cut(strings.ToLower(name), "|")
+
+	info, exists := commandTable[strings.ToUpper(container)]
+	if !exists || !hasSub {
+		return info, exists
+	}
+
+	for _, sub := range info.Subcommands {
+		if sub.Name == container+"|"+subcommand {
+			return sub, true
+		}
+	}
+	return nil, false
+}
+
+// commandAllowsStale reports whether a command may run on a replica with a broken master link
+// Unknown commands are let through so they fail with the usual unknown-command error
+func commandAllowsStale(name string) bool {
+	if _, exists := LookupCommandInfo(name); !exists {
+		return true
+	}
+	return commandHasFlag(name, "stale")
+}
+
+// commandHasFlag reports whether a known command carries the given flag
+func commandHasFlag(name, flag string) bool {
+	info, exists := LookupCommandInfo(name)
+	if !exists {
+		return false
+	}
+	for _, f := range info.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArity reports whether args (command name included) satisfy an arity
+func checkArity(arity int, args []string) bool {
+	if arity >= 0 {
+		return len(args) == arity
+	}
+	return len(args) >= -arity
+}
+
+// numKeysPositions gives, for movablekeys commands, the position of the
+// numkeys argument; the keys follow it
+var numKeysPositions = map[string]int{
+	"eval":    2,
+	"evalsha": 2,
+	"lmpop":   1,
+	"zmpop":   1,
+	"blmpop":  2,
+	"bzmpop":  2,
+}
+
+// commandKeys returns the key arguments of a command invocation (args[0] is
+// the command name), as used by COMMAND GETKEYS and key-based routing
+// Keys come from the table's key positions, or from the numkeys argument for
+// movablekeys commands
+func commandKeys(info *CommandInfo, args []string) []string {
+	if pos, movable := numKeysPositions[info.Name]; movable {
+		if pos >= len(args) {
+			return nil
+		}
+		numKeys, err := strconv.Atoi(args[pos])
+		if err != nil || numKeys <= 0 || pos+numKeys >= len(args) {
+			return nil
+		}
+		return args[pos+1 : pos+1+numKeys]
+	}
+
+	if info.FirstKey <= 0 || info.FirstKey >= len(args) {
+		return nil
+	}
+
+	last := info.LastKey
+	if last < 0 {
+		last += len(args)
+	}
+	step := info.Step
+	if step <= 0 {
+		step = 1
+	}
+
+	var keys []string
+	for i := info.FirstKey; i <= last && i < len(args); i += step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// encodeCommandInfo renders command metadata in the Redis 7 COMMAND reply format:
+// [name, arity, flags, first key, last key, step, acl categories, tips, key specs, subcommands]
+func encodeCommandInfo(info *CommandInfo) []byte {
+	flags := make([][]byte, len(info.Flags))
+	for i, flag := range info.Flags {
+		flags[i] = protocol.EncodeSimpleString(flag)
+	}
+
+	categories := make([][]byte, len(info.Categories))
+	for i, category := range info.Categories {
+		categories[i] = protocol.EncodeSimpleString("@" + category)
+	}
+
+	subcommands := make([][]byte, len(info.Subcommands))
+	for i, sub := range info.Subcommands {
+		subcommands[i] = encodeCommandInfo(sub)
+	}
+
+	return protocol.EncodeRawArray([][]byte{
+		protocol.EncodeBulkString(info.Name),
+		protocol.EncodeInteger(info.Arity),
+		protocol.EncodeRawArray(flags),
+		protocol.EncodeInteger(info.FirstKey),
+		protocol.EncodeInteger(info.LastKey),
+		protocol.EncodeInteger(info.Step),
+		protocol.EncodeRawArray(categories),
+		protocol.EncodeRawArray(nil), // Tips
+		protocol.EncodeRawArray(nil), // Key specs
+		protocol.EncodeRawArray(subcommands),
+	})
+}
+
+// sortedCommandNames returns all top-level command names in alphabetical order
+func sortedCommandNames() []string {
+	names := make([]string, 0, len(commandTable))
+	for _, info := range commandTable {
+		names = append(names, info.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// listCommandsFilteredBy handles COMMAND LIST FILTERBY
+// Subcommands are included as "container|subcommand". No command comes from
+// a module, so MODULE always gives an empty list
+func listCommandsFilteredBy(filter, value string) []byte {
+	switch filter {
+	case "MODULE":
+		return protocol.EncodeArray(nil)
+	case "ACLCAT":
+		category := strings.ToLower(value)
+		if !isACLCategory(category) {
+			return protocol.EncodeArray(nil)
+		}
+		return protocol.EncodeArray(commandsInCategory(category))
+	case "PATTERN":
+		var names []string
+		for _, info := range commandTable {
+			if storage.GlobMatch(strings.ToLower(value), info.Name) {
+				names = append(names, info.Name)
+			}
+			for _, sub := range info.Subcommands {
+				if storage.GlobMatch(strings.ToLower(value), sub.Name) {
+					names = append(names, sub.Name)
+				}
+			}
+		}
+		sort.Strings(names)
+		return protocol.EncodeArray(names)
+	default:
+		return protocol.EncodeError("ERR syntax error")
+	}
+}
+
+// handleCommand handles COMMAND command
+// COMMAND - Describe all commands
+// COMMAND COUNT - Number of commands
+// COMMAND INFO [command ...] - Describe specific commands (or subcommands as "container|sub")
+// COMMAND LIST [FILTERBY MODULE name | ACLCAT category | PATTERN pattern] - Names of all commands
+// COMMAND GETKEYS command [arg ...] - Key arguments of a full command
+func (h *CommandHandler) handleCommand(cmd *protocol.Command) []byte {
+	if len(cmd.Args) == 1 {
+		names := sortedCommandNames()
+		items := make([][]byte, len(names))
+		for i, name := range names {
+			items[i] = encodeCommandInfo(commandTable[strings.ToUpper(name)])
+		}
+		return protocol.EncodeRawArray(items)
+	}
+
+	subcommand := strings.ToUpper(cmd.Args[1])
+
+	switch subcommand {
+	case "COUNT":
+		return protocol.EncodeInteger(len(commandTable))
+	case "INFO":
+		if len(cmd.Args) == 2 {
+			return h.handleCommand(&protocol.Command{Args: cmd.Args[:1]})
+		}
+		items := make([][]byte, 0, len(cmd.Args)-2)
+		for _, name := range cmd.Args[2:] {
+			if info, exists := LookupCommandInfo(name); exists {
+				items = append(items, encodeCommandInfo(info))
+			} else {
+				items = append(items, protocol.EncodeNilArray())
+			}
+		}
+		return protocol.EncodeRawArray(items)
+	case "LIST":
+		if len(cmd.Args) == 2 {
+			return protocol.EncodeArray(sortedCommandNames())
+		}
+		if len(cmd.Args) != 5 || strings.ToUpper(cmd.Args[2]) != "FILTERBY" {
+			return protocol.EncodeError("ERR syntax error")
+		}
+		return listCommandsFilteredBy(strings.ToUpper(cmd.Args[3]), cmd.Args[4])
+	case "GETKEYS":
+		if len(cmd.Args) < 3 {
+			return protocol.EncodeError("ERR wrong number of arguments for 'command|getkeys' command")
+		}
+		args := cmd.Args[2:]
+		info, exists := commandTable[strings.ToUpper(args[0])]
+		if !exists {
+			return protocol.EncodeError("ERR Invalid command specified")
+		}
+		if !checkArity(info.Arity, args) {
+			return protocol.EncodeError("ERR Invalid number of arguments specified for command")
+		}
+		keys := commandKeys(info, args)
+		if len(keys) == 0 {
+			return protocol.EncodeError("ERR The command has no key arguments")
+		}
+		return protocol.EncodeArray(keys)
+	case "HELP":
+		return protocol.EncodeArray([]string{
+			"COMMAND <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"(no subcommand)",
+			"    Return details about all commands.",
+			"COUNT",
+			"    Return the total number of commands in this server.",
+			"LIST [FILTERBY (MODULE <module-name>|ACLCAT <category>|PATTERN <pattern>)]",
+			"    Return a list of all commands in this server, or those matching the filter.",
+			"INFO [<command-name> ...]",
+			"    Return details about the specified commands. If no command names are given,",
+			"    documentation details for all commands are returned.",
+			"GETKEYS <full-command>",
+			"    Return the keys from a full Redis command.",
+			"HELP",
+			"    Print this help.",
+		})
+	default:
+		return protocol.EncodeError(fmt.Sprintf("ERR unknown subcommand '%s'. Try COMMAND HELP.", cmd.Args[1]))
+	}
+}
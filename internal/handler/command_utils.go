@@ -6,36 +6,50 @@ var writeCommands = map[string]bool{
 	// String commands
 	"SET": true, "SETEX": true, "SETNX": true, "PSETEX": true,
 	"APPEND": true, "INCR": true, "DECR": true, "INCRBY": true, "DECRBY": true,
-	"GETSET": true, "MSET": true, "MSETNX": true,
+	"GETSET": true, "MSET": true, "MSETNX": true, "SETRANGE": true, "INCRBYFLOAT": true,
+	"SETBIT": true, "BITOP": true,
 	
 	// Key commands
 	"DEL": true, "UNLINK": true, "EXPIRE": true, "EXPIREAT": true,
 	"PEXPIRE": true, "PEXPIREAT": true, "PERSIST": true, "RENAME": true,
-	"RENAMENX": true, "MOVE": true,
+	"RENAMENX": true, "MOVE": true, "COPY": true, "RESTORE": true,
 	
 	// Hash commands
 	"HSET": true, "HSETNX": true, "HMSET": true, "HDEL": true,
-	"HINCRBY": true, "HINCRBYFLOAT": true,
+	"HINCRBY": true, "HINCRBYFLOAT": true, "HEXPIRE": true, "HPEXPIRE": true,
+	"HEXPIREAT": true, "HPEXPIREAT": true, "HPERSIST": true, "HGETDEL": true,
+	"HGETEX": true,
 	
 	// List commands
 	"LPUSH": true, "RPUSH": true, "LPUSHX": true, "RPUSHX": true,
 	"LPOP": true, "RPOP": true, "LSET": true, "LINSERT": true,
-	"LREM": true, "LTRIM": true, "RPOPLPUSH": true,
-	"BLPOP": true, "BRPOP": true, "BRPOPLPUSH": true,
+	"LREM": true, "LTRIM": true, "RPOPLPUSH": true, "LMPOP": true, "LMOVE": true,
+	"BLPOP": true, "BRPOP": true, "BRPOPLPUSH": true, "BLMPOP": true,
+	"BLMOVE": true,
 	
 	// Set commands
 	"SADD": true, "SREM": true, "SPOP": true, "SMOVE": true,
+	"SUNIONSTORE": true, "SINTERSTORE": true, "SDIFFSTORE": true,
 	
 	// Sorted set commands
 	"ZADD": true, "ZREM": true, "ZINCRBY": true, "ZREMRANGEBYRANK": true,
 	"ZREMRANGEBYSCORE": true, "ZREMRANGEBYLEX": true, "ZPOPMIN": true,
-	"ZPOPMAX": true, "BZPOPMIN": true, "BZPOPMAX": true,
+	"ZPOPMAX": true, "BZPOPMIN": true, "BZPOPMAX": true, "ZMPOP": true, "BZMPOP": true,
 	
 	// Geo commands
 	"GEOADD": true,
+
+	// HyperLogLog commands
+	"PFADD": true, "PFMERGE": true,
 	
 	// Bloom filter commands
-	"BF.ADD": true, "BF.MADD": true,
+	"BF.RESERVE": true, "BF.ADD": true, "BF.MADD": true, "BF.INSERT": true,
+	
+	// Cuckoo filter commands
+	"CF.RESERVE": true, "CF.ADD": true, "CF.DEL": true,
+	
+	// Count-Min sketch commands
+	"CMS.INITBYDIM": true, "CMS.INCRBY": true,
 	
 	// Pub/Sub commands (writes to pub/sub state)
 	"PUBLISH": true,
@@ -49,3 +63,20 @@ var writeCommands = map[string]bool{
 func IsWriteCommand(cmd string) bool {
 	return writeCommands[cmd]
 }
+
+// isLoggedCommand reports whether a successful command (uppercase) is logged
+// to the AOF: the writes, except PUBLISH, whose messages only go to the
+// subscribers connected at the time
+func isLoggedCommand(cmd string) bool {
+	return cmd != "PUBLISH" && IsWriteCommand(cmd)
+}
+
+// isReplicatedCommand reports whether a successful command (uppercase) goes
+// to replicas: the writes, and scripts, which replicas run themselves
+func isReplicatedCommand(cmd string) bool {
+	switch cmd {
+	case "EVAL", "EVALSHA":
+		return true
+	}
+	return IsWriteCommand(cmd)
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"redis/internal/protocol"
+)
+
+// ==================== CONNECTION STATE ====================
+// ConnState holds what a connection negotiated or chose for itself: HELLO
+// sets the protocol (and may authenticate and name the client), AUTH the
+// user, CLIENT SETNAME/SETINFO the name and library, CLIENT TRACKING the
+// tracking flag.
+//
+// Only the connection's own goroutine changes its state (updateState), but
+// other connections read it: CLIENT LIST describes every client and
+// invalidations are encoded for the target's protocol. Both go through
+// Client.State, which returns a copy taken under the client's lock.
+//
+// There is no requirepass or ACL user yet, so the only user is "default"
+// and, like Redis's default user without a password ("nopass"), it accepts
+// any password. authenticateUser is where a password check belongs.
+
+// defaultUser is the user every connection starts authenticated as
+const defaultUser = "default"
+
+// errWrongPass is returned by AUTH and HELLO AUTH for unknown users
+const errWrongPass = "WRONGPASS invalid username-password pair or user is disabled."
+
+// ConnState is the per-connection state commands read and change
+type ConnState struct {
+	Protocol int    // RESP version: 2, or 3 after HELLO 3
+	User     string // Authenticated user
+	DB       int    // Selected database (always 0, there is a single keyspace)
+	Name     string // Set by HELLO SETNAME or CLIENT SETNAME ("" = none)
+	Tracking bool   // Set by CLIENT TRACKING ON
+	LibName  string // Set by CLIENT SETINFO LIB-NAME
+	LibVer   string // Set by CLIENT SETINFO LIB-VER
+}
+
+// newConnState returns the state of a freshly accepted connection
+func newConnState() ConnState {
+	return ConnState{Protocol: 2, User: defaultUser}
+}
+
+// State returns a copy of the client's connection state
+// Safe to call from any goroutine
+func (c *Client) State() ConnState {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.state
+}
+
+// updateState changes the client's connection state under its lock
+// Called from the connection's own goroutine
+func (c *Client) updateState(update func(*ConnState)) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	update(&c.state)
+}
+
+// authenticateUser checks a username/password pair
+// The default user has no password, so any password is accepted for it
+func authenticateUser(username, password string) bool {
+	return username == defaultUser
+}
+
+// validClientAttr reports whether a client name or library attribute only
+// holds printable ASCII without spaces, so CLIENT LIST lines stay parseable
+func validClientAttr(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] < '!' || value[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// handleAuth handles AUTH [username] password for the calling connection
+// Without a username the default user is meant; as it has no password, that
+// form is refused like in Redis rather than silently accepted
+func (h *CommandHandler) handleAuth(cmd *protocol.Command, client *Client) []byte {
+	switch len(cmd.Args) {
+	case 2:
+		return protocol.EncodeError("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	case 3:
+		if !authenticateUser(cmd.Args[1], cmd.Args[2]) {
+			return protocol.EncodeError(errWrongPass)
+		}
+		client.updateState(func(s *ConnState) { s.User = cmd.Args[1] })
+		return OKResponse
+	default:
+		return protocol.EncodeError("ERR wrong number of arguments for 'auth' command")
+	}
+}
+
+// clientFlags returns the flags CLIENT LIST shows for a connection: P for a
+// pub/sub subscriber, t for tracking, N when there is none
+func clientFlags(state ConnState, subscriptions int) string {
+	var flags strings.Builder
+	if subscriptions > 0 {
+		flags.WriteByte('P')
+	}
+	if state.Tracking {
+		flags.WriteByte('t')
+	}
+	if flags.Len() == 0 {
+		return "N"
+	}
+	return flags.String()
+}
+
+// handleClientSetInfo handles CLIENT SETINFO LIB-NAME|LIB-VER value, which
+// client libraries send after connecting so CLIENT LIST shows who they are
+func (h *CommandHandler) handleClientSetInfo(cmd *protocol.Command, client *Client) []byte {
+	if len(cmd.Args) != 4 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'client|setinfo' command")
+	}
+
+	attr := strings.ToLower(cmd.Args[2])
+	value := cmd.Args[3]
+	if attr != "lib-name" && attr != "lib-ver" {
+		return protocol.EncodeError(fmt.Sprintf("ERR Unrecognized option '%s'", cmd.Args[2]))
+	}
+	if !validClientAttr(value) {
+		return protocol.EncodeError(fmt.Sprintf("ERR %s cannot contain spaces, newlines or special characters.", attr))
+	}
+
+	client.updateState(func(s *ConnState) {
+		if attr == "lib-name" {
+			s.LibName = value
+		} else {
+			s.LibVer = value
+		}
+	})
+	return OKResponse
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"strconv"
+
+	"redis/internal/processor"
+	"redis/internal/protocol"
+	"redis/internal/storage"
+)
+
+// maxCMSCounters caps width * depth of a new sketch (8 bytes per counter)
+const maxCMSCounters = 1 << 28
+
+// handleCMSInitByDim creates a new Count-Min sketch
+// CMS.INITBYDIM key width depth
+// The estimate of an item overcounts by about total/width, with a failure
+// probability that halves with every extra row of depth
+func (h *CommandHandler) handleCMSInitByDim(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 4 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'cms.initbydim' command")
+	}
+
+	width, err := strconv.ParseUint(cmd.Args[2], 10, 32)
+	if err != nil || width == 0 {
+		return protocol.EncodeError("ERR CMS: invalid width")
+	}
+
+	depth, err := strconv.ParseUint(cmd.Args[3], 10, 32)
+	if err != nil || depth == 0 {
+		return protocol.EncodeError("ERR CMS: invalid depth")
+	}
+
+	// Counters are allocated up front, so refuse sketches that could not fit in memory
+	if width*depth > maxCMSCounters {
+		return protocol.EncodeError("ERR CMS: width * depth is too large")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdCMSInitByDim,
+		Key:      cmd.Args[1],
+		Args:     []interface{}{uint32(width), uint32(depth)},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	result := <-procCmd.Response
+
+	res := result.(processor.StringResult)
+	if res.Err == storage.ErrInvalidOperation {
+		return protocol.EncodeError("ERR CMS: key already exists")
+	}
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return protocol.EncodeSimpleString(res.Result)
+}
+
+// handleCMSIncrBy increments the counts of items
+// CMS.INCRBY key item increment [item increment ...]
+// Returns the new estimated count of every item
+func (h *CommandHandler) handleCMSIncrBy(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 4 || len(cmd.Args)%2 != 0 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'cms.incrby' command")
+	}
+
+	pairs := (len(cmd.Args) - 2) / 2
+	items := make([]string, pairs)
+	increments := make([]int64, pairs)
+	for i := 0; i < pairs; i++ {
+		items[i] = cmd.Args[2+2*i]
+		increment, err := strconv.ParseInt(cmd.Args[3+2*i], 10, 64)
+		if err != nil || increment < 0 {
+			return protocol.EncodeError("ERR CMS: Cannot parse number")
+		}
+		increments[i] = increment
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdCMSIncrBy,
+		Key:      cmd.Args[1],
+		Args:     []interface{}{items, increments},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+
+	return encodeCMSCounts((<-procCmd.Response).(processor.Int64SliceResult))
+}
+
+// handleCMSQuery returns the estimated counts of items
+// CMS.QUERY key item [item ...]
+func (h *CommandHandler) handleCMSQuery(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'cms.query' command")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdCMSQuery,
+		Key:      cmd.Args[1],
+		Args:     []interface{}{cmd.Args[2:]},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+
+	return encodeCMSCounts((<-procCmd.Response).(processor.Int64SliceResult))
+}
+
+// encodeCMSCounts encodes the per-item counts of CMS.INCRBY and CMS.QUERY
+func encodeCMSCounts(res processor.Int64SliceResult) []byte {
+	if res.Err == storage.ErrKeyNotFound {
+		return protocol.EncodeError("ERR CMS: key does not exist")
+	}
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+
+	counts := make([][]byte, len(res.Result))
+	for i, count := range res.Result {
+		counts[i] = protocol.EncodeInteger64(count)
+	}
+	return protocol.EncodeRawArray(counts)
+}
+
+// handleCMSInfo returns information about the Count-Min sketch
+// CMS.INFO key
+func (h *CommandHandler) handleCMSInfo(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'cms.info' command")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdCMSInfo,
+		Key:      cmd.Args[1],
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+
+	res := (<-procCmd.Response).(processor.CountMinSketchInfoResult)
+	if res.Err == storage.ErrKeyNotFound {
+		return protocol.EncodeError("ERR CMS: key does not exist")
+	}
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+
+	return protocol.EncodeRawArray([][]byte{
+		protocol.EncodeBulkString("width"), protocol.EncodeInteger64(int64(res.Info.Width)),
+		protocol.EncodeBulkString("depth"), protocol.EncodeInteger64(int64(res.Info.Depth)),
+		protocol.EncodeBulkString("count"), protocol.EncodeInteger64(res.Info.Count),
+	})
+}
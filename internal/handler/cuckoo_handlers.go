@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"strconv"
+
+	"redis/internal/processor"
+	"redis/internal/protocol"
+	"redis/internal/storage"
+)
+
+// handleCFReserve creates a new Cuckoo filter
+// CF.RESERVE key capacity
+func (h *CommandHandler) handleCFReserve(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'cf.reserve' command")
+	}
+
+	capacity, err := strconv.ParseUint(cmd.Args[2], 10, 64)
+	if err != nil || capacity == 0 {
+		return protocol.EncodeError("ERR capacity must be a positive integer")
+	}
+	// Buckets are allocated up front, so refuse filters that could not fit in memory
+	if capacity > storage.MaxCuckooCapacity {
+		return protocol.EncodeError("ERR CF: capacity is too large")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdCFReserve,
+		Key:      cmd.Args[1],
+		Args:     []interface{}{capacity},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	result := <-procCmd.Response
+
+	res := result.(processor.StringResult)
+	if res.Err == storage.ErrInvalidOperation {
+		return protocol.EncodeError("ERR item exists")
+	}
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return protocol.EncodeSimpleString(res.Result)
+}
+
+// handleCFAdd adds an item to the Cuckoo filter, creating it if needed
+// CF.ADD key item
+func (h *CommandHandler) handleCFAdd(cmd *protocol.Command) []byte {
+	return h.cuckooItemCommand(cmd, processor.CmdCFAdd, "cf.add")
+}
+
+// handleCFExists checks if an item exists in the Cuckoo filter
+// CF.EXISTS key item
+func (h *CommandHandler) handleCFExists(cmd *protocol.Command) []byte {
+	return h.cuckooItemCommand(cmd, processor.CmdCFExists, "cf.exists")
+}
+
+// handleCFDel removes one copy of an item from the Cuckoo filter
+// CF.DEL key item
+func (h *CommandHandler) handleCFDel(cmd *protocol.Command) []byte {
+	return h.cuckooItemCommand(cmd, processor.CmdCFDel, "cf.del")
+}
+
+// handleCFCount returns how many times an item may have been added
+// CF.COUNT key item
+func (h *CommandHandler) handleCFCount(cmd *protocol.Command) []byte {
+	return h.cuckooItemCommand(cmd, processor.CmdCFCount, "cf.count")
+}
+
+// cuckooItemCommand runs a Cuckoo filter command of the form CMD key item
+// and replies with its integer result
+func (h *CommandHandler) cuckooItemCommand(cmd *protocol.Command, cmdType processor.CommandType, name string) []byte {
+	if len(cmd.Args) != 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for '" + name + "' command")
+	}
+
+	procCmd := &processor.Command{
+		Type:     cmdType,
+		Key:      cmd.Args[1],
+		Args:     []interface{}{cmd.Args[2]},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	result := <-procCmd.Response
+
+	res := result.(processor.IntResult)
+	if res.Err == storage.ErrKeyNotFound {
+		return protocol.EncodeError("ERR not found")
+	}
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return protocol.EncodeInteger(res.Result)
+}
+
+// handleCFInfo returns information about the Cuckoo filter
+// CF.INFO key
+func (h *CommandHandler) handleCFInfo(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'cf.info' command")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdCFInfo,
+		Key:      cmd.Args[1],
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	result := <-procCmd.Response
+
+	res := result.(processor.CuckooFilterInfoResult)
+	if res.Err == storage.ErrKeyNotFound {
+		return protocol.EncodeError("ERR not found")
+	}
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+
+	info := res.Info
+	return protocol.EncodeRawArray([][]byte{
+		protocol.EncodeBulkString("Size"), protocol.EncodeInteger64(info.Bytes),
+		protocol.EncodeBulkString("Capacity"), protocol.EncodeInteger64(int64(info.Capacity)),
+		protocol.EncodeBulkString("Number of buckets"), protocol.EncodeInteger64(int64(info.NumBuckets)),
+		protocol.EncodeBulkString("Bucket size"), protocol.EncodeInteger(info.BucketSize),
+		protocol.EncodeBulkString("Number of items inserted"), protocol.EncodeInteger64(int64(info.Count)),
+		protocol.EncodeBulkString("Number of items deleted"), protocol.EncodeInteger64(int64(info.Deleted)),
+	})
+}
@@ -0,0 +1,442 @@
+package handler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"redis/internal/processor"
+	"redis/internal/protocol"
+	"redis/internal/rdb"
+	"redis/internal/replication"
+	"redis/internal/storage"
+)
+
+// handleDebug handles DEBUG command
+// DEBUG OBJECT key - Show low-level info about a key (DUMP size, list node statistics for lists)
+// DEBUG DUMP-JSON key - Dump type, TTL and all elements of a key as JSON
+// DEBUG DIGEST - Order-independent digest of the whole keyspace
+// DEBUG DIGEST-VALUE key [key ...] - Digest of the value of each key
+// DEBUG LISTPACK-ENTRIES key - Number of entries a key holds in listpack encoding
+// DEBUG CONVERT key - Force a listpack-encoded list/hash/sorted set into quicklist/hashtable/skiplist
+// DEBUG SET-ACTIVE-EXPIRE <0|1> - Pause or resume the active expiry cycle
+// DEBUG RELOAD [NOSAVE] - Save (unless NOSAVE), flush and reload the RDB file
+// DEBUG LOADRDB <base64> - Load an RDB payload into a throwaway store through the replication loader (fuzzing)
+// DEBUG RELOAD-VERIFY - Check that both the RDB and the AOF round-trip the dataset
+// DEBUG CHANGE-REPL-ID - Generate a new replication ID
+// DEBUG PUBSUB-SIZES - Number of entries in each pub/sub map (leak check)
+// DEBUG STRINGMATCH-LEN pattern string - 1 if string matches the glob pattern, else 0
+// DEBUG HELP - List available subcommands
+func (h *CommandHandler) handleDebug(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'debug' command")
+	}
+
+	subcommand := strings.ToUpper(cmd.Args[1])
+
+	switch subcommand {
+	case "OBJECT":
+		return h.handleDebugObject(cmd)
+	case "DUMP-JSON":
+		return h.handleDebugDumpJSON(cmd)
+	case "DIGEST":
+		return h.handleDebugDigest(cmd)
+	case "DIGEST-VALUE":
+		return h.handleDebugDigestValue(cmd)
+	case "LISTPACK-ENTRIES":
+		return h.handleDebugListpackEntries(cmd)
+	case "CONVERT":
+		return h.handleDebugConvert(cmd)
+	case "SET-ACTIVE-EXPIRE":
+		return h.handleDebugSetActiveExpire(cmd)
+	case "RELOAD":
+		return h.handleDebugReload(cmd)
+	case "RELOAD-VERIFY":
+		return h.handleDebugReloadVerify(cmd)
+	case "LOADRDB":
+		return h.handleDebugLoadRDB(cmd)
+	case "CHANGE-REPL-ID":
+		return h.handleDebugChangeReplID()
+	case "PUBSUB-SIZES":
+		return h.handleDebugPubSubSizes()
+	case "STRINGMATCH-LEN":
+		return h.handleDebugStringMatchLen(cmd)
+	case "HELP":
+		return h.handleDebugHelp()
+	default:
+		return protocol.EncodeError(fmt.Sprintf("ERR unknown subcommand '%s'. Try DEBUG HELP.", cmd.Args[1]))
+	}
+}
+
+// handleDebugObject reports the internal representation of a key
+// For quicklist-encoded lists it adds the node statistics Redis reports:
+// ql_nodes, ql_avg_node (elements per node), ql_max_node (most elements in
+// one node), ql_listpack_max (list-max-listpack-size), ql_compressed (always 0,
+// nodes are never compressed) and ql_uncompressed_size (element bytes)
+func (h *CommandHandler) handleDebugObject(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'debug|object' command")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdDebugObject,
+		Key:      cmd.Args[2],
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	result := <-procCmd.Response
+
+	res := result.(processor.GetResult)
+	if !res.Exists {
+		return protocol.EncodeError("ERR no such key")
+	}
+	info := res.Value.(storage.ObjectDebugInfo)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Value at:%s refcount:1 encoding:%s serializedlength:%d",
+		info.Address, info.Encoding, h.serializedLength(cmd.Args[2]))
+
+	if info.Type == storage.ListType && info.Encoding == storage.EncodingQuicklist {
+		avgNode := 0.0
+		if info.ListNodes > 0 {
+			avgNode = float64(info.ListEntries) / float64(info.ListNodes)
+		}
+		fmt.Fprintf(&sb, " ql_nodes:%d ql_avg_node:%.2f ql_max_node:%d ql_listpack_max:%d ql_compressed:0 ql_uncompressed_size:%d",
+			info.ListNodes, avgNode, info.ListMaxNodeEntries, info.ListMaxListpackSize, info.ListUncompressedSize)
+	}
+
+	return protocol.EncodeSimpleString(sb.String())
+}
+
+// serializedLength returns the size of the payload DUMP would return for key,
+// computed with the same encoder, or 0 if the key is gone or its type has no
+// DUMP encoding
+func (h *CommandHandler) serializedLength(key string) int {
+	procCmd := &processor.Command{
+		Type:     processor.CmdDump,
+		Key:      key,
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+
+	result := (<-procCmd.Response).(processor.GetResult)
+	if !result.Exists {
+		return 0
+	}
+
+	length, err := rdb.DumpLength(result.Value.(*storage.Value))
+	if err != nil {
+		return 0
+	}
+	return length
+}
+
+// handleDebugListpackEntries returns the number of entries a key holds in the
+// listpack encoding, or 0 once it has been converted to quicklist/hashtable/skiplist
+// Together with the list-max-listpack-size, hash-max-listpack-* and
+// zset-max-listpack-* thresholds this lets tests sit exactly on the
+// conversion boundary
+func (h *CommandHandler) handleDebugListpackEntries(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'debug|listpack-entries' command")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdDebugListpackEntries,
+		Key:      cmd.Args[2],
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	res := (<-procCmd.Response).(processor.GetResult)
+
+	if !res.Exists {
+		return protocol.EncodeError("ERR no such key")
+	}
+	return protocol.EncodeInteger(res.Value.(int))
+}
+
+// handleDebugConvert forces a listpack-encoded list, hash or sorted set into
+// its large encoding and replies with the resulting encoding
+func (h *CommandHandler) handleDebugConvert(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'debug|convert' command")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdDebugConvert,
+		Key:      cmd.Args[2],
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	res := (<-procCmd.Response).(processor.StringResult)
+
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return protocol.EncodeSimpleString(res.Result)
+}
+
+// handleDebugDumpJSON returns a canonical JSON document describing a key
+// Meant for test harnesses comparing state across nodes or after AOF replay
+func (h *CommandHandler) handleDebugDumpJSON(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'debug|dump-json' command")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdDebugDumpJSON,
+		Key:      cmd.Args[2],
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	res := (<-procCmd.Response).(processor.StringResult)
+
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return protocol.EncodeBulkString(res.Result)
+}
+
+// handleDebugDigest returns a 40 hex char digest of the whole keyspace
+// Identical datasets give identical digests, so comparing the output of master
+// and replica detects divergence after a failover or resync
+func (h *CommandHandler) handleDebugDigest(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'debug|digest' command")
+	}
+
+	return protocol.EncodeSimpleString(h.datasetDigest())
+}
+
+// handleDebugDigestValue returns the value digest of each given key
+// Used to pinpoint which keys differ once DEBUG DIGEST reports a mismatch
+func (h *CommandHandler) handleDebugDigestValue(cmd *protocol.Command) []byte {
+	procCmd := &processor.Command{
+		Type:     processor.CmdDebugDigestValue,
+		Args:     []interface{}{cmd.Args[2:]},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	res := (<-procCmd.Response).(processor.StringSliceResult)
+
+	return protocol.EncodeArray(res.Result)
+}
+
+// handleDebugSetActiveExpire pauses (0) or resumes (1) the active expiry cycle
+func (h *CommandHandler) handleDebugSetActiveExpire(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'debug|set-active-expire' command")
+	}
+
+	switch cmd.Args[2] {
+	case "0":
+		h.processor.SetActiveExpireEnabled(false)
+	case "1":
+		h.processor.SetActiveExpireEnabled(true)
+	default:
+		return protocol.EncodeError("ERR value is not an integer or out of range")
+	}
+
+	return protocol.EncodeSimpleString("OK")
+}
+
+// handleDebugReload saves the dataset and loads it back from the RDB file
+// The file is loaded into a staging store that replaces the dataset only once
+// it loaded in full, so a missing or broken RDB leaves the dataset as it was
+// With NOSAVE the existing file is loaded as-is, so a known RDB fixture can be
+// dropped in place to exercise the load path on its own
+func (h *CommandHandler) handleDebugReload(cmd *protocol.Command) []byte {
+	save := true
+	switch {
+	case len(cmd.Args) == 3 && strings.ToUpper(cmd.Args[2]) == "NOSAVE":
+		save = false
+	case len(cmd.Args) != 2:
+		return protocol.EncodeError("ERR syntax error")
+	}
+
+	if h.reloadFunc == nil {
+		return protocol.EncodeError("ERR DEBUG RELOAD is not supported")
+	}
+
+	// Writes landing between the save and the swap would be lost
+	h.writeGate.Lock()
+	defer h.writeGate.Unlock()
+
+	if save {
+		if err := h.saveRDB(); err != nil {
+			return protocol.EncodeError(fmt.Sprintf("ERR Error trying to save the RDB dump: %v", err))
+		}
+	}
+
+	staged, err := h.reloadFunc()
+	if err != nil {
+		return protocol.EncodeError(fmt.Sprintf("ERR Error trying to load the RDB dump: %v", err))
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdReplaceDataset,
+		Value:    staged,
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	<-procCmd.Response
+
+	return protocol.EncodeSimpleString("OK")
+}
+
+// handleDebugReloadVerify checks that both persistence paths reproduce the
+// dataset exactly: it rewrites the AOF and saves the RDB from the current
+// data, loads each file into its own throwaway store, then compares their
+// digests with the digest taken before the files were written
+// The live dataset is only read, never replaced
+// Replies OK when they match, or an error listing the three digests
+func (h *CommandHandler) handleDebugReloadVerify(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'debug|reload-verify' command")
+	}
+	if h.rdbDigestFunc == nil || h.aofDigestFunc == nil {
+		return protocol.EncodeError("ERR DEBUG RELOAD-VERIFY is not supported")
+	}
+	if h.aofWriter == nil {
+		return protocol.EncodeError("ERR AOF is not enabled")
+	}
+	if !h.aofRewrite.start() {
+		return protocol.EncodeError("ERR Background append only file rewriting already in progress")
+	}
+
+	datasetDigest := h.datasetDigest()
+
+	// Both files are written from the same dataset
+	h.beginSave()
+	err := h.aofWriter.Rewrite(h.aofRewriteSnapshot)
+	h.processor.ReleaseSnapshot()
+	h.endSave()
+	h.aofRewrite.finish(err)
+	if err != nil {
+		return protocol.EncodeError(fmt.Sprintf("ERR Error trying to rewrite the AOF: %v", err))
+	}
+
+	if err := h.saveRDB(); err != nil {
+		return protocol.EncodeError(fmt.Sprintf("ERR Error trying to save the RDB dump: %v", err))
+	}
+
+	rdbDigest, err := h.rdbDigestFunc()
+	if err != nil {
+		return protocol.EncodeError(fmt.Sprintf("ERR Error trying to load the RDB dump: %v", err))
+	}
+
+	aofDigest, err := h.aofDigestFunc()
+	if err != nil {
+		return protocol.EncodeError(fmt.Sprintf("ERR Error trying to load the AOF: %v", err))
+	}
+
+	if rdbDigest != datasetDigest || aofDigest != datasetDigest {
+		return protocol.EncodeError(fmt.Sprintf("ERR digest mismatch: dataset %s rdb %s aof %s",
+			datasetDigest, rdbDigest, aofDigest))
+	}
+	return protocol.EncodeSimpleString("OK")
+}
+
+// datasetDigest returns the DEBUG DIGEST of the current dataset
+func (h *CommandHandler) datasetDigest() string {
+	procCmd := &processor.Command{
+		Type:     processor.CmdDebugDigest,
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	return (<-procCmd.Response).(string)
+}
+
+// handleDebugLoadRDB decodes a base64 RDB payload and loads it into a
+// throwaway store through the loader replicas use for a full resync
+// Meant for fuzzing: malformed payloads must come back as an error reply,
+// never crash the server; the live dataset is never touched
+func (h *CommandHandler) handleDebugLoadRDB(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'debug|loadrdb' command")
+	}
+	if h.rdbCheckFunc == nil {
+		return protocol.EncodeError("ERR DEBUG LOADRDB is not supported")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(cmd.Args[2])
+	if err != nil {
+		return protocol.EncodeError(fmt.Sprintf("ERR invalid base64 payload: %v", err))
+	}
+
+	if err := h.rdbCheckFunc(data); err != nil {
+		return protocol.EncodeError(fmt.Sprintf("ERR Error loading the RDB payload: %v", err))
+	}
+	return protocol.EncodeSimpleString("OK")
+}
+
+// handleDebugChangeReplID forces a new replication ID
+// Replicas requesting a partial resync with the old ID get a full resync instead
+func (h *CommandHandler) handleDebugChangeReplID() []byte {
+	replMgr, ok := h.replicationMgr.(*replication.ReplicationManager)
+	if !ok || replMgr == nil {
+		return protocol.EncodeError("ERR replication is not enabled")
+	}
+
+	replMgr.ChangeReplID()
+	return protocol.EncodeSimpleString("OK")
+}
+
+// handleDebugPubSubSizes reports the size of every pub/sub map
+// With no subscribed clients all sizes must be 0; anything else is a
+// subscriber that was not cleaned up on unsubscribe or disconnect
+func (h *CommandHandler) handleDebugPubSubSizes() []byte {
+	sizes := h.processor.GetStore().PubSub.Sizes()
+	return protocol.EncodeBulkString(fmt.Sprintf(
+		"channels:%d patterns:%d subscribers:%d subscriber_channels:%d subscriber_patterns:%d",
+		sizes.Channels, sizes.Patterns, sizes.Subscribers,
+		sizes.SubscriberChannels, sizes.SubscriberPatterns))
+}
+
+// handleDebugStringMatchLen matches a string against a glob pattern with the
+// matcher KEYS, SCAN MATCH, PSUBSCRIBE and PUBSUB CHANNELS use, so its
+// semantics can be checked without creating keys or subscriptions
+func (h *CommandHandler) handleDebugStringMatchLen(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 4 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'debug|stringmatch-len' command")
+	}
+	if storage.GlobMatch(cmd.Args[2], cmd.Args[3]) {
+		return protocol.EncodeInteger(1)
+	}
+	return protocol.EncodeInteger(0)
+}
+
+// handleDebugHelp returns the list of DEBUG subcommands
+func (h *CommandHandler) handleDebugHelp() []byte {
+	return protocol.EncodeArray([]string{
+		"DEBUG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+		"OBJECT <key>",
+		"    Show low-level info about the <key> and associated value.",
+		"DUMP-JSON <key>",
+		"    Dump the type, TTL and all elements of <key> as JSON in a canonical order.",
+		"DIGEST",
+		"    Output a hex signature representing the current dataset (keys, values and expiries).",
+		"DIGEST-VALUE <key> [<key> ...]",
+		"    Output a hex signature of the values of all the specified keys.",
+		"LISTPACK-ENTRIES <key>",
+		"    Show the number of entries <key> holds in listpack encoding (0 once converted).",
+		"CONVERT <key>",
+		"    Force a listpack-encoded list, hash or sorted set into quicklist, hashtable or skiplist encoding.",
+		"SET-ACTIVE-EXPIRE <0|1>",
+		"    Pause (0) or resume (1) the active expiry cycle.",
+		"RELOAD [NOSAVE]",
+		"    Save the RDB on disk (unless NOSAVE) and replace the dataset with the RDB once it loaded in full.",
+		"RELOAD-VERIFY",
+		"    Rewrite the AOF and save the RDB, load each into a throwaway store and check that their digests match the dataset.",
+		"LOADRDB <base64>",
+		"    Load a base64-encoded RDB payload into a throwaway store through the replication loader; malformed input replies an error.",
+		"CHANGE-REPL-ID",
+		"    Generate a new replication ID, forcing replicas into a full resync.",
+		"PUBSUB-SIZES",
+		"    Show the number of entries in each pub/sub map; all are 0 when no client is subscribed.",
+		"STRINGMATCH-LEN <pattern> <string>",
+		"    Return 1 if <string> matches the glob-style <pattern> (as in KEYS and PSUBSCRIBE), 0 otherwise.",
+		"HELP",
+		"    Print this help.",
+	})
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==================== ABSOLUTE EXPIRY PROPAGATION ====================
+// A relative TTL (EXPIRE key 60) replayed from the AOF or applied by a replica
+// would count from the moment it is read, not from when the master ran it.
+// Writes that set a relative TTL are therefore logged and replicated with the
+// absolute deadline as PEXPIREAT (SET as SET ... PXAT, HEXPIRE as
+// HPEXPIREAT, RESTORE as RESTORE ... ABSTTL), so every copy expires the key
+// or field at the same instant.
+// Handlers record the deadline they actually set (after expiry jitter) in
+// the command's context, and that deadline is the one propagated, so
+// replicas and the AOF keep the jittered TTL rather than recomputing it.
+
+// appliedExpiryKey is the context key of a command's *appliedExpiry
+type appliedExpiryKey struct{}
+
+// appliedExpiry is the deadline a handler set for a relative TTL
+type appliedExpiry struct {
+	at time.Time
+}
+
+// withAppliedExpiry returns a context in which recordAppliedExpiry stores
+// the deadline the command sets, and the slot it is stored in
+func withAppliedExpiry(ctx context.Context) (context.Context, *appliedExpiry) {
+	applied := &appliedExpiry{}
+	return context.WithValue(ctx, appliedExpiryKey{}, applied), applied
+}
+
+// recordAppliedExpiry notes the deadline a command set from a relative TTL
+// Without a slot (AOF replay, scripts) there is nothing to propagate
+func recordAppliedExpiry(ctx context.Context, at time.Time) {
+	if applied, ok := ctx.Value(appliedExpiryKey{}).(*appliedExpiry); ok {
+		applied.at = at
+	}
+}
+
+// absoluteExpiryCommands rewrites a successful write into the commands that
+// reproduce it with absolute expiry times
+// applied is the deadline the command recorded (zero if none); otherwise
+// the deadline is its TTL counted from now
+// Commands without a relative TTL are returned unchanged
+func absoluteExpiryCommands(args []string, now, applied time.Time) [][]string {
+	if len(args) < 3 {
+		return [][]string{args}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "EXPIRE":
+		deadline, ok := relativeDeadline(args[2], time.Second, now, applied)
+		if !ok {
+			break
+		}
+		// SLIDING keeps its window, so copies still slide after a failover
+		if len(args) == 4 && strings.ToUpper(args[3]) == "SLIDING" {
+			if seconds, err := strconv.ParseInt(args[2], 10, 64); err == nil {
+				window := strconv.FormatInt(seconds*1000, 10)
+				return [][]string{{"PEXPIREAT", args[1], deadline, "SLIDING", window}}
+			}
+		}
+		return [][]string{{"PEXPIREAT", args[1], deadline}}
+
+	case "SETEX", "PSETEX":
+		unit := time.Second
+		if strings.ToUpper(args[0]) == "PSETEX" {
+			unit = time.Millisecond
+		}
+		// One SET, so the value never exists without its TTL on replay
+		if len(args) == 4 {
+			if deadline, ok := relativeDeadline(args[2], unit, now, applied); ok {
+				return [][]string{{"SET", args[1], args[3], "PXAT", deadline}}
+			}
+		}
+
+	case "SET":
+		return absoluteSetCommands(args, now, applied)
+
+	case "HEXPIRE", "HPEXPIRE":
+		unit := time.Second
+		if strings.ToUpper(args[0]) == "HPEXPIRE" {
+			unit = time.Millisecond
+		}
+		// The condition and FIELDS block carry over unchanged
+		if deadline, ok := relativeDeadline(args[2], unit, now, time.Time{}); ok {
+			return [][]string{append([]string{"HPEXPIREAT", args[1], deadline}, args[3:]...)}
+		}
+
+	case "HGETEX":
+		return absoluteHGetExCommands(args, now)
+
+	case "RESTORE":
+		return absoluteRestoreCommands(args, now, applied)
+	}
+
+	return [][]string{args}
+}
+
+// absoluteSetCommands rewrites SET key value ... EX|PX ttl as the same SET
+// with PXAT deadline
+// Keeping it a single command preserves NX/XX (the deadline only applies
+// when the conditional SET does) and NEGATIVE (which needs its TTL); SET
+// with EXAT/PXAT or no expiry is already absolute and returned unchanged
+func absoluteSetCommands(args []string, now, applied time.Time) [][]string {
+	for i := 3; i < len(args)-1; i++ {
+		option := strings.ToUpper(args[i])
+		if option != "EX" && option != "PX" {
+			continue
+		}
+
+		unit := time.Second
+		if option == "PX" {
+			unit = time.Millisecond
+		}
+		deadline, ok := relativeDeadline(args[i+1], unit, now, applied)
+		if !ok {
+			return [][]string{args}
+		}
+
+		setArgs := make([]string, 0, len(args))
+		setArgs = append(setArgs, args[:i]...)
+		setArgs = append(setArgs, "PXAT", deadline)
+		setArgs = append(setArgs, args[i+2:]...)
+		return [][]string{setArgs}
+	}
+
+	return [][]string{args}
+}
+
+// absoluteRestoreCommands rewrites RESTORE key ttl payload ... with a
+// relative TTL as the same RESTORE with the deadline and ABSTTL
+// A TTL of 0 (no expiry) or one already absolute is returned unchanged
+func absoluteRestoreCommands(args []string, now, applied time.Time) [][]string {
+	if len(args) < 4 {
+		return [][]string{args}
+	}
+	for _, option := range args[4:] {
+		if strings.ToUpper(option) == "ABSTTL" {
+			return [][]string{args}
+		}
+	}
+
+	deadline, ok := relativeDeadline(args[2], time.Millisecond, now, applied)
+	if !ok {
+		return [][]string{args}
+	}
+
+	restoreArgs := make([]string, 0, len(args)+1)
+	restoreArgs = append(restoreArgs, args[0], args[1], deadline)
+	restoreArgs = append(restoreArgs, args[3:]...)
+	restoreArgs = append(restoreArgs, "ABSTTL")
+	return [][]string{restoreArgs}
+}
+
+// absoluteHGetExCommands replays the side effect of HGETEX key <option> FIELDS ...
+// as HPEXPIREAT (EX/PX/EXAT/PXAT) or HPERSIST (PERSIST); a plain HGETEX only
+// reads and produces nothing
+func absoluteHGetExCommands(args []string, now time.Time) [][]string {
+	if len(args) < 4 {
+		return [][]string{args}
+	}
+
+	key, option := args[1], strings.ToUpper(args[2])
+	switch option {
+	case "PERSIST":
+		return [][]string{append([]string{"HPERSIST", key}, args[3:]...)}
+
+	case "EX", "PX", "EXAT", "PXAT":
+		if len(args) < 5 {
+			return [][]string{args}
+		}
+		n, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return [][]string{args}
+		}
+
+		var deadline int64
+		switch option {
+		case "EX":
+			deadline = now.Add(time.Duration(n) * time.Second).UnixMilli()
+		case "PX":
+			deadline = now.Add(time.Duration(n) * time.Millisecond).UnixMilli()
+		case "EXAT":
+			deadline = n * 1000
+		case "PXAT":
+			deadline = n
+		}
+		return [][]string{append([]string{"HPEXPIREAT", key, strconv.FormatInt(deadline, 10)}, args[4:]...)}
+	}
+
+	return nil
+}
+
+// relativeDeadline converts a TTL in the given unit to a Unix time in
+// milliseconds: applied if the command recorded one, else counted from now
+func relativeDeadline(ttl string, unit time.Duration, now, applied time.Time) (string, bool) {
+	n, err := strconv.ParseInt(ttl, 10, 64)
+	if err != nil || n <= 0 {
+		return "", false
+	}
+	if !applied.IsZero() {
+		return strconv.FormatInt(applied.UnixMilli(), 10), true
+	}
+	return strconv.FormatInt(now.Add(time.Duration(n)*unit).UnixMilli(), 10), true
+}
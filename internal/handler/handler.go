@@ -4,11 +4,12 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	"io"
 	"log"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"redis/internal/aof"
@@ -25,15 +26,47 @@ type CommandFunc func(cmd *protocol.Command) []byte
 type Client struct {
 	ID         int64
 	Conn       net.Conn
+	CreatedAt  time.Time           // When the connection was accepted (for CLIENT LIST age)
 	Subscriber *storage.Subscriber // Pub/Sub subscriber (nil if not in pub/sub mode)
 	InPubSub   bool                // True if client is in pub/sub mode
+
+	// Durability level set by CLIENT WAIT-DEFAULT: EXEC waits until
+	// WaitReplicas replicas acknowledged its writes (0 = don't wait)
+	WaitReplicas int
+	WaitTimeout  time.Duration // Max time EXEC waits for the ACKs (0 = forever)
+
+	// Set by CLIENT REPLOFFSET ON: successful writes and EXEC reply with
+	// [reply, master offset] so a later read can WAITOFFSET on a replica
+	ReplOffset bool
+
+	// Protocol, user, name, tracking... (see conn_state.go); read by other
+	// connections through State, e.g. when delivering invalidations
+	state   ConnState
+	stateMu sync.Mutex
+
+	// Pushes (tracking invalidations) queued for the push pump, which writes
+	// them while writeSlot is free, i.e. between two reply batches
+	pushes    chan []byte
+	writeSlot chan struct{}
 }
 
 // HandlerConfig holds all handler configuration
 type HandlerConfig struct {
-	ReadBufferSize  int
-	WriteBufferSize int
-	Pipeline        PipelineConfig
+	ReadBufferSize         int
+	WriteBufferSize        int
+	Pipeline               PipelineConfig
+	RejectWritesDuringSave bool              // Reject writes with a retryable error while a snapshot is in progress
+	ReplicaServeStaleData  bool              // Serve reads on a replica whose master link is down (MASTERDOWN otherwise)
+	LuaTimeLimit           time.Duration     // Scripts running longer than this make the server reply BUSY (0 = never)
+	PubSubPingInterval     time.Duration     // Keepalive ping period for subscribers (0 = disabled)
+	PubSubBufferSize       int               // Messages buffered per subscriber before publishes to it are dropped
+	RenameCommands         map[string]string // rename-command: OLD -> NEW ("" disables the command)
+	LoadShedQueueDepth     int               // Processor queue depth past which commands are shed (0 = never)
+	LoadShedWait           time.Duration     // How long a command may wait for queue room before being shed
+	ExpireJitterPercent    int               // Random ±% applied to TTLs set by SET EX/PX, SETEX, PSETEX and EXPIRE (0 = off)
+	SlowLogMaxArgs         int               // Arguments kept per slow log entry, command name included (0 = default)
+	SlowLogMaxArgLen       int               // Bytes kept of each slow log argument (0 = default)
+	RDBFilepath            string            // File BGSAVE, SAVE and DEBUG RELOAD write the RDB snapshot to
 }
 
 // DefaultHandlerConfig returns default handler configuration
@@ -47,7 +80,13 @@ func DefaultHandlerConfig() HandlerConfig {
 			CommandTimeout:  30 * time.Second,
 			ReadTimeout:     60 * time.Second,
 			PipelineTimeout: 1 * time.Second,
+			MaxPendingBytes: 64 * 1024,
 		},
+		ReplicaServeStaleData: true,
+		LuaTimeLimit:          lua.DefaultTimeLimit,
+		LoadShedQueueDepth:    0, // Off unless configured
+		LoadShedWait:          50 * time.Millisecond,
+		RDBFilepath:           "dump.rdb",
 	}
 }
 
@@ -61,19 +100,87 @@ type CommandHandler struct {
 	slowLog         *SlowLog
 	txManager       *TransactionManager
 	blockingManager *BlockingManager
+	tracking        *TrackingManager
 	aofWriter       *aof.Writer
 	replicationMgr  interface{}       // ReplicationManager interface (avoid circular import)
 	serverPort      int               // Server's listening port
 	onChange        func()            // Callback for tracking changes (for RDB auto-save)
 	luaEngine       *lua.ScriptEngine // Lua scripting engine
 	pendingPorts    map[string]int    // Temporary storage for listening ports by connection address
-	pendingPortsMu  sync.RWMutex      // Protects pendingPorts map
+	pendingIPs      map[string]string // Temporary storage for announced IPs by connection address
+	pendingPortsMu  sync.RWMutex      // Protects pendingPorts and pendingIPs maps
+	clients         sync.Map          // Connected clients by ID (for CLIENT LIST)
+
+	// Snapshot backpressure
+	rejectWritesDuringSave bool         // Reject writes while saveInProgress > 0
+	saveInProgress         atomic.Int32 // Number of running BGSAVE/BGREWRITEAOF snapshots
+
+	// INFO persistence support
+	bgsave           bgJobStatus  // BGSAVE state
+	aofRewrite       bgJobStatus  // BGREWRITEAOF state
+	changesSinceSave func() int64 // Writes since the last successful save (installed by the server)
+	onSaved          func(int64)  // Called once a BGSAVE succeeds with the changes it saved (installed by the server)
+
+	// Replica read gating
+	replicaServeStaleData bool // Serve reads while the master link is down
+
+	// SHUTDOWN support (installed by the server)
+	shutdownFunc       func()
+	failoverInProgress atomic.Bool // SHUTDOWN FAILOVER is handing the master role to a replica
+
+	// Held shared by writes until they are propagated (see write_gate.go)
+	writeGate sync.RWMutex
+
+	// DEBUG RELOAD support (installed by the server)
+	reloadFunc func() (*storage.Store, error)
+
+	// DEBUG RELOAD-VERIFY support (installed by the server)
+	aofDigestFunc func() (string, error)
+	rdbDigestFunc func() (string, error)
+
+	// DEBUG LOADRDB support (installed by the server)
+	rdbCheckFunc func(data []byte) error
+
+	// INFO Clients/Stats support (installed by the server)
+	connStatsFunc func() ConnStats
+
+	// Pub/sub keepalive
+	pubsubPingInterval time.Duration // Period of server-initiated pings to subscribers (0 = disabled)
+	pubsubBufferSize   int           // Message channel size of new subscribers (client-output-buffer-limit pubsub)
+
+	// Command renaming
+	renameCommands map[string]string // OLD -> NEW applied at registration ("" disables)
+	commandAliases map[string]string // Renamed name -> canonical name
+	hiddenCommands map[string]bool   // Canonical names clients can no longer call by name
+
+	// Load shedding
+	loadShedQueueDepth int           // Processor queue depth past which commands are shed (0 = never)
+	loadShedWait       time.Duration // Max wait for queue room before shedding
+
+	// TTL randomization (expire-jitter-percentage)
+	expireJitterPercent int
+
+	// RDB snapshot file (dbfilename)
+	rdbFilepath string
+
+	// Executed command counters (exported through metrics)
+	stats CommandStats
+
+	// Command tracing (nil = disabled)
+	traceHook TraceHook
+
+	// Held exclusively while a MULTI ... EXEC block from the master is applied,
+	// and shared by client commands (by an EXEC for all of its commands), so
+	// clients never see part of the block
+	replTxMu sync.RWMutex
 }
 
 func NewCommandHandler(proc *processor.Processor, config HandlerConfig, aofWriter *aof.Writer, replMgr interface{}, serverPort int) *CommandHandler {
 	// Create Lua engine with Redis executor
 	executor := lua.NewRedisExecutor(proc.GetStore())
 	luaEngine := lua.NewScriptEngine(executor)
+	luaEngine.SetTimeLimit(config.LuaTimeLimit)
+	luaEngine.SetWriteCommandChecker(IsWriteCommand)
 
 	h := &CommandHandler{
 		processor:       proc,
@@ -84,12 +191,28 @@ func NewCommandHandler(proc *processor.Processor, config HandlerConfig, aofWrite
 		slowLog:         NewSlowLog(128, config.Pipeline.SlowThreshold),
 		txManager:       NewTransactionManager(),
 		blockingManager: NewBlockingManager(),
+		tracking:        NewTrackingManager(),
 		aofWriter:       aofWriter,
 		replicationMgr:  replMgr,
 		serverPort:      serverPort,
 		luaEngine:       luaEngine,
 		pendingPorts:    make(map[string]int),
+		pendingIPs:      make(map[string]string),
+
+		rejectWritesDuringSave: config.RejectWritesDuringSave,
+		replicaServeStaleData:  config.ReplicaServeStaleData,
+		pubsubPingInterval:     config.PubSubPingInterval,
+		pubsubBufferSize:       config.PubSubBufferSize,
+		renameCommands:         config.RenameCommands,
+		loadShedQueueDepth:     config.LoadShedQueueDepth,
+		loadShedWait:           config.LoadShedWait,
+		expireJitterPercent:    config.ExpireJitterPercent,
+		rdbFilepath:            config.RDBFilepath,
 	}
+	h.slowLog.SetArgLimits(config.SlowLogMaxArgs, config.SlowLogMaxArgLen)
+	luaEngine.SetWriteNotifier(func(args []string) {
+		h.invalidateWrittenKeys(args[0], args)
+	})
 	h.registerCommands()
 	return h
 }
@@ -108,19 +231,18 @@ func (h *CommandHandler) GetSlowLog() *SlowLog {
 // LogToAOF logs a write command to the AOF file
 // Called after successful command execution
 func (h *CommandHandler) LogToAOF(command string, args []string) {
-	if h.aofWriter == nil {
-		return
-	}
-
 	// Only log write commands
-	if !aof.IsWriteCommand(command) {
+	if !isLoggedCommand(command) {
 		return
 	}
 
-	// Track change for RDB auto-save
+	// Track change for RDB auto-save, which runs with or without the AOF
 	if h.onChange != nil {
 		h.onChange()
 	}
+	if h.aofWriter == nil {
+		return
+	}
 
 	// Build full command args (command + arguments)
 	fullArgs := make([]string, 0, len(args)+1)
@@ -133,6 +255,71 @@ func (h *CommandHandler) LogToAOF(command string, args []string) {
 	}
 }
 
+// LogTransactionToAOF logs the commands of an EXEC to the AOF file wrapped in
+// MULTI/EXEC, so a crash mid-write leaves an incomplete block that is skipped
+// on load instead of a partially applied transaction
+// Non-write commands are dropped as in LogToAOF; a single write needs no wrapping
+func (h *CommandHandler) LogTransactionToAOF(cmds [][]string) {
+	writes := make([][]string, 0, len(cmds))
+	for _, args := range cmds {
+		if isLoggedCommand(args[0]) {
+			writes = append(writes, args)
+		}
+	}
+	if len(writes) < 2 {
+		for _, args := range writes {
+			h.LogToAOF(args[0], args[1:])
+		}
+		return
+	}
+
+	// Track change for RDB auto-save
+	if h.onChange != nil {
+		for range writes {
+			h.onChange()
+		}
+	}
+	if h.aofWriter == nil {
+		return
+	}
+
+	block := make([][]string, 0, len(writes)+2)
+	block = append(block, []string{"MULTI"})
+	block = append(block, writes...)
+	block = append(block, []string{"EXEC"})
+	if err := h.aofWriter.WriteCommands(block); err != nil {
+		log.Printf("AOF write error: %v", err)
+	}
+}
+
+// PropagateExpiredKeys logs a DEL for every key removed by lazy or active
+// expiry and forwards it to replicas, so the deletion is durable and replicated
+func (h *CommandHandler) PropagateExpiredKeys(keys []string) {
+	replMgr, _ := h.replicationMgr.(*replication.ReplicationManager)
+	for _, key := range keys {
+		h.LogToAOF("DEL", []string{key})
+		if replMgr != nil {
+			replMgr.PropagateCommand([]string{"DEL", key})
+		}
+	}
+	h.sendInvalidations(h.tracking.Invalidate(keys))
+}
+
+// PropagateRefreshedExpiries logs a PEXPIREAT ... SLIDING for every sliding
+// expiry that GET pushed past its last propagated deadline and forwards it to
+// replicas, which follow the master's deadline rather than refreshing on reads
+func (h *CommandHandler) PropagateRefreshedExpiries(refreshed []storage.RefreshedExpiry) {
+	replMgr, _ := h.replicationMgr.(*replication.ReplicationManager)
+	for _, r := range refreshed {
+		args := []string{r.Key, strconv.FormatInt(r.ExpiresAt.UnixMilli(), 10),
+			"SLIDING", strconv.FormatInt(r.Window.Milliseconds(), 10)}
+		h.LogToAOF("PEXPIREAT", args)
+		if replMgr != nil {
+			replMgr.PropagateCommand(append([]string{"PEXPIREAT"}, args...))
+		}
+	}
+}
+
 // registerCommands initializes the command map with all supported commands
 func (h *CommandHandler) registerCommands() {
 	h.commands = make(map[string]CommandFunc)
@@ -157,6 +344,8 @@ func (h *CommandHandler) registerCommands() {
 
 	// Bloom Filter commands
 	h.registerBloomCommands()
+	h.registerCuckooCommands()
+	h.registerCountMinCommands()
 
 	// HyperLogLog commands
 	h.registerHyperLogLogCommands()
@@ -178,6 +367,69 @@ func (h *CommandHandler) registerCommands() {
 
 	// Admin/Debug commands
 	h.registerAdminCommands()
+
+	// rename-command must run last so it sees every registered name
+	h.applyCommandRenames()
+}
+
+// connectionCommands are handled before the command map is consulted, as
+// they need the connection or its transaction; rename-command covers them too
+var connectionCommands = map[string]bool{
+	"AUTH": true, "CLIENT": true, "HELLO": true,
+	"SUBSCRIBE": true, "UNSUBSCRIBE": true, "PSUBSCRIBE": true, "PUNSUBSCRIBE": true,
+	"PSYNC": true, "REPLCONF": true, "INFO": true, "REPLICAOF": true, "SLAVEOF": true,
+}
+
+// applyCommandRenames builds the alias table for rename-command
+// The command map keeps the canonical names: clients' names are resolved by
+// resolveCommand before dispatch, so the AOF, replication and every lookup by
+// name see the canonical one. Swapping two names (A->B, B->A) works as expected
+func (h *CommandHandler) applyCommandRenames() {
+	if len(h.renameCommands) == 0 {
+		return
+	}
+
+	h.commandAliases = make(map[string]string, len(h.renameCommands))
+	h.hiddenCommands = make(map[string]bool, len(h.renameCommands))
+	for oldName, newName := range h.renameCommands {
+		oldName = strings.ToUpper(oldName)
+		if _, exists := h.commands[oldName]; !exists && !connectionCommands[oldName] {
+			log.Printf("rename-command: unknown command '%s', ignoring", oldName)
+			continue
+		}
+		h.hiddenCommands[oldName] = true
+		if newName != "" {
+			h.commandAliases[strings.ToUpper(newName)] = oldName
+		}
+	}
+}
+
+// resolveCommand maps the name a client sent to the canonical command name
+// It reports false for a name taken away by rename-command (renamed or
+// disabled), which must be answered as an unknown command
+func (h *CommandHandler) resolveCommand(name string) (string, bool) {
+	name = strings.ToUpper(name)
+	if canonical, ok := h.commandAliases[name]; ok {
+		return canonical, true
+	}
+	if h.hiddenCommands[name] {
+		return "", false
+	}
+	return name, true
+}
+
+// resolveClientCommand rewrites a client command's name to the canonical one
+// It returns the error reply for a name taken away by rename-command
+func (h *CommandHandler) resolveClientCommand(cmd *protocol.Command) []byte {
+	if cmd == nil || len(cmd.Args) == 0 {
+		return nil
+	}
+	canonical, ok := h.resolveCommand(cmd.Args[0])
+	if !ok {
+		return protocol.EncodeError(fmt.Sprintf("ERR unknown command '%s'", strings.ToUpper(cmd.Args[0])))
+	}
+	cmd.Args[0] = canonical
+	return nil
 }
 
 // registerClusterCommands registers cluster commands
@@ -197,6 +449,14 @@ func (h *CommandHandler) registerAdminCommands() {
 	h.commands["SLOWLOG"] = h.handleSlowLog
 	h.commands["BGREWRITEAOF"] = h.handleBGRewriteAOF
 	h.commands["BGSAVE"] = h.handleBGSave
+	h.commands["SHUTDOWN"] = h.handleShutdown
+	h.commands["WAIT"] = h.handleWait
+	h.commands["WAITOFFSET"] = h.handleWaitOffset
+	h.commands["DEBUG"] = h.handleDebug
+	h.commands["MEMORY"] = h.handleMemory
+	h.commands["OBJECT"] = h.handleObject
+	h.commands["LOLWUT"] = h.handleLolwut
+	h.commands["ACL"] = h.handleACL
 	// Note: SENTINEL commands removed - use standalone Sentinel server instead
 	// Note: INFO, REPLICAOF, SLAVEOF are handled in replication_handlers.go via pipeline interception
 }
@@ -216,18 +476,31 @@ func (h *CommandHandler) registerStringCommands() {
 	h.commands["ECHO"] = h.handleEcho
 	h.commands["SET"] = h.handleSet
 	h.commands["SETEX"] = h.handleSetEx
+	h.commands["PSETEX"] = h.handlePSetEx
 	h.commands["GET"] = h.handleGet
 	h.commands["DEL"] = h.handleDel
 	h.commands["EXISTS"] = h.handleExists
 	h.commands["KEYS"] = h.handleKeys
+	h.commands["SCAN"] = h.handleScan
+	h.commands["DBSIZE"] = h.handleDBSize
 	h.commands["FLUSHALL"] = h.handleFlushAll
+	h.commands["FLUSHDB"] = h.handleFlushAll // Single database, so FLUSHDB is FLUSHALL
 	h.commands["COMMAND"] = h.handleCommand
 	h.commands["EXPIRE"] = h.handleExpire
+	h.commands["PEXPIREAT"] = h.handlePExpireAt
 	h.commands["TTL"] = h.handleTTL
+	h.commands["COPY"] = h.handleCopy
+	h.commands["DUMP"] = h.handleDump
+	h.commands["RESTORE"] = h.handleRestore
 	h.commands["INCR"] = h.handleIncr
 	h.commands["INCRBY"] = h.handleIncrBy
 	h.commands["DECR"] = h.handleDecr
 	h.commands["DECRBY"] = h.handleDecrBy
+	h.commands["APPEND"] = h.handleAppend
+	h.commands["STRLEN"] = h.handleStrLen
+	h.commands["GETRANGE"] = h.handleGetRange
+	h.commands["SUBSTR"] = h.handleGetRange
+	h.commands["SETRANGE"] = h.handleSetRange
 }
 
 // registerListCommands registers all list commands
@@ -243,7 +516,9 @@ func (h *CommandHandler) registerListCommands() {
 	h.commands["LREM"] = h.handleLRem
 	h.commands["LTRIM"] = h.handleLTrim
 	h.commands["LINSERT"] = h.handleLInsert
-	// Note: Blocking commands (BLPOP, BRPOP, BLMOVE, BRPOPLPUSH) are handled
+	h.commands["LPOS"] = h.handleLPos
+	h.commands["LMPOP"] = h.handleLMPop
+	// Note: Blocking commands (BLPOP, BRPOP, BLMOVE, BRPOPLPUSH, BLMPOP) are handled
 	// specially in the pipeline, not through the regular command map
 }
 
@@ -261,6 +536,16 @@ func (h *CommandHandler) registerHashCommands() {
 	h.commands["HSETNX"] = h.handleHSetNX
 	h.commands["HINCRBY"] = h.handleHIncrBy
 	h.commands["HINCRBYFLOAT"] = h.handleHIncrByFloat
+	h.commands["HRANDFIELD"] = h.handleHRandField
+	h.commands["HEXPIRE"] = h.handleHExpire
+	h.commands["HPEXPIRE"] = h.handleHPExpire
+	h.commands["HEXPIREAT"] = h.handleHExpireAt
+	h.commands["HPEXPIREAT"] = h.handleHPExpireAt
+	h.commands["HTTL"] = h.handleHTTL
+	h.commands["HPTTL"] = h.handleHPTTL
+	h.commands["HPERSIST"] = h.handleHPersist
+	h.commands["HGETDEL"] = h.handleHGetDel
+	h.commands["HGETEX"] = h.handleHGetEx
 }
 
 // registerSetCommands registers all set commands
@@ -299,6 +584,7 @@ func (h *CommandHandler) registerZSetCommands() {
 	h.commands["ZPOPMAX"] = h.handleZPopMax
 	h.commands["ZREMRANGEBYSCORE"] = h.handleZRemRangeByScore
 	h.commands["ZREMRANGEBYRANK"] = h.handleZRemRangeByRank
+	h.commands["ZMPOP"] = h.handleZMPop
 }
 
 // registerGeoCommands registers all geospatial commands
@@ -319,6 +605,25 @@ func (h *CommandHandler) registerBloomCommands() {
 	h.commands["BF.EXISTS"] = h.handleBFExists
 	h.commands["BF.MEXISTS"] = h.handleBFMExists
 	h.commands["BF.INFO"] = h.handleBFInfo
+	h.commands["BF.INSERT"] = h.handleBFInsert
+}
+
+// registerCuckooCommands registers all Cuckoo filter commands
+func (h *CommandHandler) registerCuckooCommands() {
+	h.commands["CF.RESERVE"] = h.handleCFReserve
+	h.commands["CF.ADD"] = h.handleCFAdd
+	h.commands["CF.EXISTS"] = h.handleCFExists
+	h.commands["CF.DEL"] = h.handleCFDel
+	h.commands["CF.COUNT"] = h.handleCFCount
+	h.commands["CF.INFO"] = h.handleCFInfo
+}
+
+// registerCountMinCommands registers all Count-Min sketch commands
+func (h *CommandHandler) registerCountMinCommands() {
+	h.commands["CMS.INITBYDIM"] = h.handleCMSInitByDim
+	h.commands["CMS.INCRBY"] = h.handleCMSIncrBy
+	h.commands["CMS.QUERY"] = h.handleCMSQuery
+	h.commands["CMS.INFO"] = h.handleCMSInfo
 }
 
 // registerHyperLogLogCommands registers all HyperLogLog commands
@@ -344,6 +649,14 @@ func (h *CommandHandler) registerPubSubCommands() {
 }
 
 func (h *CommandHandler) Handle(ctx context.Context, client *Client) {
+	// Set up before the client is visible to other connections' invalidations
+	client.state = newConnState()
+	client.pushes = make(chan []byte, pushBufferSize)
+	client.writeSlot = make(chan struct{}, 1)
+
+	h.clients.Store(client.ID, client)
+	defer h.clients.Delete(client.ID)
+
 	// Use pipeline handler for all connections
 	h.HandlePipeline(ctx, client, h.pipelineConfig)
 }
@@ -369,20 +682,26 @@ func (h *CommandHandler) HandleLegacy(ctx context.Context, client *Client) {
 
 			cmd, err := protocol.ParseCommand(reader)
 			if err != nil {
-				if err == io.EOF {
+				if connectionLost(err) {
 					return
 				}
 				log.Printf("Error parsing command: %v", err)
 				response := protocol.EncodeError(fmt.Sprintf("ERR %v", err))
 				writer.Write(response)
 				writer.Flush()
+				if protocol.IsProtocolError(err) {
+					return // Stream can't be resynchronized
+				}
 				continue
 			}
 
 			// Clear deadline for command execution
 			client.Conn.SetReadDeadline(time.Time{})
 
-			response := h.executeCommand(cmd)
+			response := h.resolveClientCommand(cmd)
+			if response == nil {
+				response = h.executeCommand(cmd)
+			}
 			writer.Write(response)
 			writer.Flush()
 		}
@@ -401,6 +720,15 @@ func (h *CommandHandler) executeCommand(cmd *protocol.Command) []byte {
 		return protocol.EncodeError("READONLY You can't write against a read only replica")
 	}
 
+	// Apply backpressure while a snapshot is being written
+	if h.isWriteRejectedDuringSave(command) {
+		return protocol.EncodeError(errSaveInProgress)
+	}
+
+	if h.isWriteRejectedDuringFailover(command) {
+		return protocol.EncodeError(errFailoverInProgress)
+	}
+
 	// Check for replication commands first
 	if h.replicationMgr != nil {
 		if replMgr, ok := h.replicationMgr.(*replication.ReplicationManager); ok {
@@ -437,12 +765,83 @@ func (h *CommandHandler) ExecuteReplicatedCommand(cmd *protocol.Command) []byte
 	// even on replicas since they're coming from the master
 
 	if handler, exists := h.commands[command]; exists {
-		return handler(cmd)
+		response := handler(cmd)
+		h.invalidateWrittenKeys(command, cmd.Args)
+		return response
 	}
 
 	return protocol.EncodeError(fmt.Sprintf("ERR unknown command '%s'", command))
 }
 
+// ExecuteReplicatedTransaction applies the commands of a MULTI ... EXEC block
+// received from master with client commands held off, so the block becomes
+// visible all at once
+// Like EXEC, a failing command does not stop the others; the first error is returned
+func (h *CommandHandler) ExecuteReplicatedTransaction(cmds [][]string) error {
+	h.replTxMu.Lock()
+	defer h.replTxMu.Unlock()
+
+	var firstErr error
+	for _, args := range cmds {
+		response := h.ExecuteReplicatedCommand(&protocol.Command{Args: args})
+		if len(response) > 0 && response[0] == '-' && firstErr == nil {
+			firstErr = fmt.Errorf("command %v failed: %s", args, strings.TrimSpace(string(response)))
+		}
+	}
+	return firstErr
+}
+
+// errSaveInProgress is returned for writes rejected while a snapshot is in progress
+const errSaveInProgress = "TRYAGAIN Background save in progress, writes are temporarily rejected"
+
+// beginSave marks a snapshot (BGSAVE or AOF rewrite) as in progress
+func (h *CommandHandler) beginSave() {
+	h.saveInProgress.Add(1)
+}
+
+// endSave marks a snapshot as finished
+func (h *CommandHandler) endSave() {
+	h.saveInProgress.Add(-1)
+}
+
+// IsSaveInProgress reports whether a BGSAVE or AOF rewrite is currently running
+func (h *CommandHandler) IsSaveInProgress() bool {
+	return h.saveInProgress.Load() > 0
+}
+
+// isWriteRejectedDuringSave checks if a write must be rejected to bound COW memory growth
+// Only applies when reject-writes-during-save is enabled; scripts count as
+// writes, as they may call any write command
+func (h *CommandHandler) isWriteRejectedDuringSave(command string) bool {
+	return h.rejectWritesDuringSave && isGatedWrite(command) && h.IsSaveInProgress()
+}
+
+// errExecSaveInProgress is returned for a transaction with writes discarded
+// while a snapshot is in progress
+const errExecSaveInProgress = "EXECABORT Transaction discarded because of: " + errSaveInProgress
+
+// Stats returns the executed command counters
+func (h *CommandHandler) Stats() *CommandStats {
+	return &h.stats
+}
+
+// errOverloaded is returned for commands shed while the processor queue is
+// saturated; its own code, so clients don't take it for a script's BUSY
+const errOverloaded = "OVERLOADED Server is overloaded, command queue is full. Try again later."
+
+// admitCommand waits for room in the processor queue, bounded by both the
+// command deadline and loadShedWait. Returns false if the command must be shed.
+// SHUTDOWN is always admitted so an overloaded server can still be stopped.
+func (h *CommandHandler) admitCommand(ctx context.Context, command string) bool {
+	if h.loadShedQueueDepth <= 0 || command == "SHUTDOWN" {
+		return true
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, h.loadShedWait)
+	defer cancel()
+	return h.processor.WaitForCapacity(waitCtx, h.loadShedQueueDepth)
+}
+
 // isReplica checks if server is currently running as a replica
 func (h *CommandHandler) isReplica() bool {
 	if h.replicationMgr == nil {
@@ -454,6 +853,93 @@ func (h *CommandHandler) isReplica() bool {
 	return false
 }
 
+// errBusyScript is returned while a script runs past lua-time-limit
+const errBusyScript = "BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE."
+
+// isBlockedByBusyScript reports whether a command must be refused with BUSY
+// Only SCRIPT KILL and SHUTDOWN NOSAVE get through while a script is over its time limit
+func (h *CommandHandler) isBlockedByBusyScript(args []string) bool {
+	if !h.luaEngine.IsBusy() {
+		return false
+	}
+
+	command := strings.ToUpper(args[0])
+	switch {
+	case command == "SCRIPT" && len(args) == 2 && strings.ToUpper(args[1]) == "KILL":
+		return false
+	case command == "SHUTDOWN" && len(args) == 2 && strings.ToUpper(args[1]) == "NOSAVE":
+		return false
+	}
+	return true
+}
+
+// SetShutdownFunc installs the function SHUTDOWN calls to stop the server
+func (h *CommandHandler) SetShutdownFunc(fn func()) {
+	h.shutdownFunc = fn
+}
+
+// SetReloadFunc installs the function DEBUG RELOAD calls to load the RDB file
+// into a staging store
+func (h *CommandHandler) SetReloadFunc(fn func() (*storage.Store, error)) {
+	h.reloadFunc = fn
+}
+
+// SetAOFDigestFunc installs the function DEBUG RELOAD-VERIFY calls to load the
+// AOF file into a throwaway store and digest it
+func (h *CommandHandler) SetAOFDigestFunc(fn func() (string, error)) {
+	h.aofDigestFunc = fn
+}
+
+// SetRDBDigestFunc installs the function DEBUG RELOAD-VERIFY calls to load the
+// RDB file into a throwaway store and digest it
+func (h *CommandHandler) SetRDBDigestFunc(fn func() (string, error)) {
+	h.rdbDigestFunc = fn
+}
+
+// SetRDBCheckFunc installs the function DEBUG LOADRDB calls to load an RDB
+// payload into a throwaway store
+func (h *CommandHandler) SetRDBCheckFunc(fn func(data []byte) error) {
+	h.rdbCheckFunc = fn
+}
+
+// ConnStats is a snapshot of the server's client connection counters
+type ConnStats struct {
+	Connected     int64 // Currently open client connections
+	MaxClients    int64 // Configured connection limit
+	TotalReceived int64 // Connections accepted since startup
+	Rejected      int64 // Connections refused because MaxClients was reached
+}
+
+// SetSaveCounter installs the functions that read the count of writes since
+// the last successful save (rdb_changes_since_last_save) and take the writes
+// a save covered off it
+func (h *CommandHandler) SetSaveCounter(changes func() int64, onSaved func(saved int64)) {
+	h.changesSinceSave = changes
+	h.onSaved = onSaved
+}
+
+// SetConnStatsFunc installs the function INFO calls to read connection counters
+func (h *CommandHandler) SetConnStatsFunc(fn func() ConnStats) {
+	h.connStatsFunc = fn
+}
+
+// errMasterDown is returned for commands refused while the master link is down
+const errMasterDown = "MASTERDOWN Link with MASTER is down and replica-serve-stale-data is set to 'no'"
+
+// isStaleReadRejected reports whether a command must fail with MASTERDOWN
+// This happens on a replica whose master link is down when replica-serve-stale-data is off;
+// commands flagged "stale" (INFO, PING, REPLICAOF, ...) are still allowed
+func (h *CommandHandler) isStaleReadRejected(command string) bool {
+	if h.replicaServeStaleData || !h.isReplica() {
+		return false
+	}
+	replMgr, ok := h.replicationMgr.(*replication.ReplicationManager)
+	if !ok || replMgr.IsMasterLinkUp() {
+		return false
+	}
+	return !commandAllowsStale(command)
+}
+
 // handleReplicationCommand handles all replication commands through a unified interface
 // All replication commands (PING, REPLCONF, PSYNC, INFO, REPLICAOF, SLAVEOF) are handled in replication_handlers.go
 // Returns true if the command was handled (and should not be processed further)
@@ -471,7 +957,12 @@ func (h *CommandHandler) handleReplicationCommand(conn net.Conn, reader *bufio.R
 		return false
 	}
 
-	command := strings.ToUpper(cmd.Args[0])
+	// A renamed command is routed by its canonical name; executeTraced
+	// answers a name taken away by rename-command
+	command, ok := h.resolveCommand(cmd.Args[0])
+	if !ok {
+		return false
+	}
 	args := cmd.Args[1:]
 
 	// Route all replication commands to HandleReplicationCommand in replication_handlers.go
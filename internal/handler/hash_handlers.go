@@ -2,7 +2,10 @@ package handler
 
 import (
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
+	"time"
 
 	"redis/internal/processor"
 	"redis/internal/protocol"
@@ -212,6 +215,7 @@ func (h *CommandHandler) handleHGetAll(cmd *protocol.Command) []byte {
 	procCmd := &processor.Command{
 		Type:     processor.CmdHGetAll,
 		Key:      key,
+		Ctx:      cmd.Context(),
 		Response: make(chan interface{}, 1),
 	}
 	h.processor.Submit(procCmd)
@@ -309,3 +313,297 @@ func (h *CommandHandler) handleHIncrByFloat(cmd *protocol.Command) []byte {
 	}
 	return protocol.EncodeBulkString(fmt.Sprintf("%v", res.Result))
 }
+
+// handleHRandField handles HRANDFIELD key [count [WITHVALUES]]
+func (h *CommandHandler) handleHRandField(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 2 || len(cmd.Args) > 4 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'hrandfield' command")
+	}
+
+	key := cmd.Args[1]
+	count := 1
+	withValues := false
+
+	if len(cmd.Args) >= 3 {
+		var err error
+		count, err = strconv.Atoi(cmd.Args[2])
+		if err != nil {
+			return protocol.EncodeError("ERR value is not an integer or out of range")
+		}
+	}
+	if len(cmd.Args) == 4 {
+		if strings.ToUpper(cmd.Args[3]) != "WITHVALUES" {
+			return protocol.EncodeError("ERR syntax error")
+		}
+		withValues = true
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdHRandField,
+		Key:      key,
+		Args:     []interface{}{count, withValues},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	res := (<-procCmd.Response).(processor.StringSliceResult)
+
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+
+	// Without a count the reply is a single field (or nil)
+	if len(cmd.Args) == 2 {
+		if len(res.Result) == 0 {
+			return protocol.EncodeNullBulkString()
+		}
+		return protocol.EncodeBulkString(res.Result[0])
+	}
+	return protocol.EncodeArray(res.Result)
+}
+
+// parseHashFieldList parses the trailing "FIELDS numfields field [field ...]"
+// block shared by the hash field-expiration commands
+func parseHashFieldList(args []string) ([]string, []byte) {
+	if len(args) < 3 || strings.ToUpper(args[0]) != "FIELDS" {
+		return nil, protocol.EncodeError("ERR Mandatory argument FIELDS is missing or not at the right position")
+	}
+	numFields, err := strconv.Atoi(args[1])
+	if err != nil || numFields <= 0 {
+		return nil, protocol.EncodeError("ERR Parameter `numFields` should be greater than 0")
+	}
+	if numFields != len(args)-2 {
+		return nil, protocol.EncodeError("ERR The `numfields` parameter must match the number of arguments")
+	}
+	return args[2:], nil
+}
+
+// handleHExpireCommand implements HEXPIRE/HPEXPIRE/HEXPIREAT/HPEXPIREAT:
+// CMD key time [NX | XX | GT | LT] FIELDS numfields field [field ...]
+// unit converts the time argument to a duration; absolute marks a Unix timestamp
+func (h *CommandHandler) handleHExpireCommand(cmd *protocol.Command, unit time.Duration, absolute bool) []byte {
+	name := strings.ToLower(cmd.Args[0])
+	if len(cmd.Args) < 6 {
+		return protocol.EncodeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+
+	key := cmd.Args[1]
+	amount, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+	if err != nil || amount < 0 {
+		return protocol.EncodeError("ERR value is not an integer or out of range")
+	}
+	// Reject times whose nanoseconds would overflow
+	if amount > math.MaxInt64/int64(unit) {
+		return protocol.EncodeError(fmt.Sprintf("ERR invalid expire time in '%s' command", name))
+	}
+
+	rest := cmd.Args[3:]
+	condition := ""
+	switch strings.ToUpper(rest[0]) {
+	case "NX", "XX", "GT", "LT":
+		condition = strings.ToUpper(rest[0])
+		rest = rest[1:]
+	}
+
+	fields, errReply := parseHashFieldList(rest)
+	if errReply != nil {
+		return errReply
+	}
+
+	var expiry time.Time
+	if absolute {
+		expiry = time.Unix(0, 0).Add(time.Duration(amount) * unit)
+	} else {
+		expiry = time.Now().Add(time.Duration(amount) * unit)
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdHExpire,
+		Key:      key,
+		Expiry:   &expiry,
+		Args:     []interface{}{condition, fields},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	res := (<-procCmd.Response).(processor.IntSliceResult)
+
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return protocol.EncodeIntegerArray(res.Result)
+}
+
+func (h *CommandHandler) handleHExpire(cmd *protocol.Command) []byte {
+	return h.handleHExpireCommand(cmd, time.Second, false)
+}
+
+func (h *CommandHandler) handleHPExpire(cmd *protocol.Command) []byte {
+	return h.handleHExpireCommand(cmd, time.Millisecond, false)
+}
+
+func (h *CommandHandler) handleHExpireAt(cmd *protocol.Command) []byte {
+	return h.handleHExpireCommand(cmd, time.Second, true)
+}
+
+func (h *CommandHandler) handleHPExpireAt(cmd *protocol.Command) []byte {
+	return h.handleHExpireCommand(cmd, time.Millisecond, true)
+}
+
+// handleHFieldTTL implements HTTL/HPTTL: CMD key FIELDS numfields field [field ...]
+func (h *CommandHandler) handleHFieldTTL(cmd *protocol.Command, unit time.Duration) []byte {
+	name := strings.ToLower(cmd.Args[0])
+	if len(cmd.Args) < 5 {
+		return protocol.EncodeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+
+	fields, errReply := parseHashFieldList(cmd.Args[2:])
+	if errReply != nil {
+		return errReply
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdHTTL,
+		Key:      cmd.Args[1],
+		Args:     []interface{}{fields},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	res := (<-procCmd.Response).(processor.Int64SliceResult)
+
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+
+	// Negative values are the -2/-1 status codes; round real TTLs to the unit
+	ttls := make([]int, len(res.Result))
+	for i, ms := range res.Result {
+		if ms < 0 {
+			ttls[i] = int(ms)
+			continue
+		}
+		ttls[i] = int((time.Duration(ms)*time.Millisecond + unit/2) / unit)
+	}
+	return protocol.EncodeIntegerArray(ttls)
+}
+
+func (h *CommandHandler) handleHTTL(cmd *protocol.Command) []byte {
+	return h.handleHFieldTTL(cmd, time.Second)
+}
+
+func (h *CommandHandler) handleHPTTL(cmd *protocol.Command) []byte {
+	return h.handleHFieldTTL(cmd, time.Millisecond)
+}
+
+// handleHPersist implements HPERSIST key FIELDS numfields field [field ...]
+func (h *CommandHandler) handleHPersist(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 5 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'hpersist' command")
+	}
+
+	fields, errReply := parseHashFieldList(cmd.Args[2:])
+	if errReply != nil {
+		return errReply
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdHPersist,
+		Key:      cmd.Args[1],
+		Args:     []interface{}{fields},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	res := (<-procCmd.Response).(processor.IntSliceResult)
+
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return protocol.EncodeIntegerArray(res.Result)
+}
+
+// handleHGetDel implements HGETDEL key FIELDS numfields field [field ...]
+// Returns the value of each field (null if missing) and deletes the fields
+// in one step, so a field can be claimed by exactly one client
+func (h *CommandHandler) handleHGetDel(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 5 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'hgetdel' command")
+	}
+
+	fields, errReply := parseHashFieldList(cmd.Args[2:])
+	if errReply != nil {
+		return errReply
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdHGetDel,
+		Key:      cmd.Args[1],
+		Args:     []interface{}{fields},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	res := (<-procCmd.Response).(processor.InterfaceSliceResult)
+
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return protocol.EncodeInterfaceArray(res.Result)
+}
+
+// handleHGetEx implements
+// HGETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST] FIELDS numfields field [field ...]
+// Returns the value of each field (null if missing) and updates the TTL of
+// the existing ones in the same step
+func (h *CommandHandler) handleHGetEx(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 5 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'hgetex' command")
+	}
+
+	rest := cmd.Args[2:]
+	var expiry *time.Time
+	persist := false
+	switch option := strings.ToUpper(rest[0]); option {
+	case "EX", "PX", "EXAT", "PXAT":
+		if len(rest) < 2 {
+			return protocol.EncodeError("ERR syntax error")
+		}
+		// Range-checked like SET, before the time is scaled to a duration
+		var at time.Time
+		var err error
+		switch option {
+		case "EX":
+			at, err = parseExpireTime(rest[1], time.Second, "hgetex")
+		case "PX":
+			at, err = parseExpireTime(rest[1], time.Millisecond, "hgetex")
+		case "EXAT":
+			at, err = parseExpireAtTime(rest[1], time.Second, "hgetex")
+		case "PXAT":
+			at, err = parseExpireAtTime(rest[1], time.Millisecond, "hgetex")
+		}
+		if err != nil {
+			return protocol.EncodeError(err.Error())
+		}
+		expiry = &at
+		rest = rest[2:]
+	case "PERSIST":
+		persist = true
+		rest = rest[1:]
+	}
+
+	fields, errReply := parseHashFieldList(rest)
+	if errReply != nil {
+		return errReply
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdHGetEx,
+		Key:      cmd.Args[1],
+		Expiry:   expiry,
+		Args:     []interface{}{fields, persist},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	res := (<-procCmd.Response).(processor.InterfaceSliceResult)
+
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return protocol.EncodeInterfaceArray(res.Result)
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"redis/internal/processor"
+	"redis/internal/protocol"
+	"redis/internal/rdb"
+	"redis/internal/storage"
+)
+
+// ==================== COPY / DUMP / RESTORE ====================
+// DUMP and RESTORE serialize values with the same per-type RDB encoder as
+// BGSAVE and replication full sync, so sorted sets keep every member and score
+
+// handleCopy handles COPY source destination [DB destination-db] [REPLACE]
+// The copy keeps the source's remaining TTL
+func (h *CommandHandler) handleCopy(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'copy' command")
+	}
+
+	src, dst := cmd.Args[1], cmd.Args[2]
+	replace := false
+	for i := 3; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(cmd.Args) {
+				return protocol.EncodeError("ERR syntax error")
+			}
+			i++
+			db, err := strconv.Atoi(cmd.Args[i])
+			if err != nil {
+				return protocol.EncodeError("ERR value is not an integer or out of range")
+			}
+			// Only database 0 exists
+			if db != 0 {
+				return protocol.EncodeError("ERR DB index is out of range")
+			}
+		default:
+			return protocol.EncodeError("ERR syntax error")
+		}
+	}
+
+	if src == dst {
+		return protocol.EncodeError("ERR source and destination objects are the same")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdCopy,
+		Key:      src,
+		Args:     []interface{}{dst, replace},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+
+	if (<-procCmd.Response).(bool) {
+		return protocol.EncodeInteger(1)
+	}
+	return protocol.EncodeInteger(0)
+}
+
+// handleDump handles DUMP key
+// Returns the serialized value, or a null bulk string if the key does not exist
+func (h *CommandHandler) handleDump(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'dump' command")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdDump,
+		Key:      cmd.Args[1],
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+
+	result := (<-procCmd.Response).(processor.GetResult)
+	if !result.Exists {
+		return protocol.EncodeNullBulkString()
+	}
+
+	payload, err := rdb.EncodeDump(result.Value.(*storage.Value))
+	if err != nil {
+		return protocol.EncodeError(err.Error())
+	}
+	return protocol.EncodeBulkString(string(payload))
+}
+
+// handleRestore handles RESTORE key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+// ttl is in milliseconds (0 = no expiry); with ABSTTL it is a Unix time in milliseconds
+// IDLETIME and FREQ are accepted for compatibility but ignored, as there is no eviction policy
+func (h *CommandHandler) handleRestore(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 4 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'restore' command")
+	}
+
+	key := cmd.Args[1]
+	ttl, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+	if err != nil {
+		return protocol.EncodeError("ERR value is not an integer or out of range")
+	}
+	if ttl < 0 {
+		return protocol.EncodeError("ERR Invalid TTL value, must be >= 0")
+	}
+
+	replace, absTTL := false, false
+	for i := 4; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		case "IDLETIME", "FREQ":
+			if i+1 >= len(cmd.Args) {
+				return protocol.EncodeError("ERR syntax error")
+			}
+			i++
+			if n, err := strconv.ParseInt(cmd.Args[i], 10, 64); err != nil || n < 0 {
+				return protocol.EncodeError("ERR Invalid IDLETIME or FREQ value, must be >= 0")
+			}
+		default:
+			return protocol.EncodeError("ERR syntax error")
+		}
+	}
+
+	value, err := rdb.DecodeDump([]byte(cmd.Args[3]))
+	if err != nil {
+		return protocol.EncodeError(err.Error())
+	}
+
+	// A relative TTL is recorded so the AOF and replicas get the same
+	// deadline, as RESTORE ... ABSTTL
+	var expiry *time.Time
+	if ttl > 0 {
+		var at time.Time
+		if absTTL {
+			at, err = parseExpireAtTime(cmd.Args[2], time.Millisecond, "restore")
+		} else {
+			at, err = parseExpireTime(cmd.Args[2], time.Millisecond, "restore")
+			recordAppliedExpiry(cmd.Context(), at)
+		}
+		if err != nil {
+			return protocol.EncodeError(err.Error())
+		}
+		expiry = &at
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdRestore,
+		Key:      key,
+		Value:    value,
+		Expiry:   expiry,
+		Args:     []interface{}{replace},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+
+	if err, ok := (<-procCmd.Response).(error); ok && err != nil {
+		return protocol.EncodeError(err.Error())
+	}
+	return protocol.EncodeSimpleString("OK")
+}
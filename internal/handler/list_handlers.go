@@ -2,6 +2,8 @@ package handler
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 
 	"redis/internal/processor"
@@ -192,6 +194,7 @@ func (h *CommandHandler) handleLRange(cmd *protocol.Command) []byte {
 		Type:     processor.CmdLRange,
 		Key:      key,
 		Args:     []interface{}{start, stop},
+		Ctx:      cmd.Context(),
 		Response: make(chan interface{}, 1),
 	}
 	h.processor.Submit(procCmd)
@@ -266,15 +269,17 @@ func (h *CommandHandler) handleLSet(cmd *protocol.Command) []byte {
 	return protocol.EncodeSimpleString("OK")
 }
 
+// handleLRem removes occurrences of an element from a list
+// LREM key count element - count > 0 removes from the head, count < 0 from
+// the tail, 0 removes them all
 func (h *CommandHandler) handleLRem(cmd *protocol.Command) []byte {
-	if len(cmd.Args) < 4 {
+	if len(cmd.Args) != 4 {
 		return protocol.EncodeError("ERR wrong number of arguments for 'lrem' command")
 	}
 
 	key := cmd.Args[1]
-	var count int
-
-	if _, err := fmt.Sscanf(cmd.Args[2], "%d", &count); err != nil {
+	count, err := strconv.Atoi(cmd.Args[2])
+	if err != nil {
 		return protocol.EncodeError("ERR value is not an integer or out of range")
 	}
 	value := cmd.Args[3]
@@ -326,8 +331,11 @@ func (h *CommandHandler) handleLTrim(cmd *protocol.Command) []byte {
 	return protocol.EncodeSimpleString("OK")
 }
 
+// handleLInsert inserts an element before or after a pivot
+// LINSERT key BEFORE|AFTER pivot element - returns the new length, -1 when the
+// pivot isn't found and 0 when the key doesn't exist
 func (h *CommandHandler) handleLInsert(cmd *protocol.Command) []byte {
-	if len(cmd.Args) < 5 {
+	if len(cmd.Args) != 5 {
 		return protocol.EncodeError("ERR wrong number of arguments for 'linsert' command")
 	}
 
@@ -354,13 +362,156 @@ func (h *CommandHandler) handleLInsert(cmd *protocol.Command) []byte {
 	h.processor.Submit(procCmd)
 	result := <-procCmd.Response
 
-	res := result.(struct {
-		Result int
-		Err    error
-	})
+	res := result.(processor.IntResult)
 
 	if res.Err != nil {
 		return protocol.EncodeError(res.Err.Error())
 	}
 	return protocol.EncodeInteger(res.Result)
 }
+
+// handleLPos returns the index of the elements matching a value
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+// Without COUNT the reply is the first match's index or nil, with COUNT an
+// array of up to num-matches indexes (0 = all of them)
+func (h *CommandHandler) handleLPos(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'lpos' command")
+	}
+
+	key := cmd.Args[1]
+	value := cmd.Args[2]
+	rank, count, maxLen := 1, 1, 0
+	withCount := false
+
+	for i := 3; i < len(cmd.Args); i += 2 {
+		if i+1 >= len(cmd.Args) {
+			return protocol.EncodeError("ERR syntax error")
+		}
+		n, err := strconv.Atoi(cmd.Args[i+1])
+		if err != nil {
+			return protocol.EncodeError("ERR value is not an integer or out of range")
+		}
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "RANK":
+			if n == 0 {
+				return protocol.EncodeError("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the last match")
+			}
+			if n == math.MinInt64 {
+				// -rank would overflow when scanning from the tail
+				return protocol.EncodeError("ERR value is out of range, value must between -9223372036854775807 and 9223372036854775807")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return protocol.EncodeError("ERR COUNT can't be negative")
+			}
+			count = n
+			withCount = true
+		case "MAXLEN":
+			if n < 0 {
+				return protocol.EncodeError("ERR MAXLEN can't be negative")
+			}
+			maxLen = n
+		default:
+			return protocol.EncodeError("ERR syntax error")
+		}
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdLPos,
+		Key:      key,
+		Args:     []interface{}{value, rank, count, maxLen},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	res := (<-procCmd.Response).(processor.IntSliceResult)
+
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	if withCount {
+		return protocol.EncodeIntegerArray(res.Result)
+	}
+	if len(res.Result) == 0 {
+		return protocol.EncodeNullBulkString()
+	}
+	return protocol.EncodeInteger(res.Result[0])
+}
+
+// handleLMPop pops elements from the first non-empty list among several keys
+// LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func (h *CommandHandler) handleLMPop(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 4 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'lmpop' command")
+	}
+
+	parsed, errReply := parseMPopArgs(cmd.Args[1:], "LEFT", "RIGHT")
+	if errReply != nil {
+		return errReply
+	}
+
+	res := h.lmpop(parsed.keys, parsed.first, parsed.count)
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return encodeLMPopReply(res.Key, res.Elements)
+}
+
+// encodeLMPopReply encodes [key, [element ...]], or a null array if nothing was popped
+func encodeLMPopReply(key string, elements []string) []byte {
+	if key == "" {
+		return protocol.EncodeNilArray()
+	}
+	return protocol.EncodeRawArray([][]byte{
+		protocol.EncodeBulkString(key),
+		protocol.EncodeArray(elements),
+	})
+}
+
+// mpopArgs holds the parsed arguments of LMPOP and ZMPOP
+type mpopArgs struct {
+	keys  []string
+	first bool // LEFT for LMPOP, MIN for ZMPOP
+	count int
+}
+
+// parseMPopArgs parses numkeys key [key ...] <first>|<second> [COUNT count],
+// the arguments LMPOP and ZMPOP share
+// Returns the error reply to send if they are invalid
+func parseMPopArgs(args []string, first, second string) (*mpopArgs, []byte) {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, protocol.EncodeError("ERR value is not an integer or out of range")
+	}
+	if numKeys <= 0 {
+		return nil, protocol.EncodeError("ERR numkeys should be greater than 0")
+	}
+	if len(args) < numKeys+2 {
+		return nil, protocol.EncodeError("ERR syntax error")
+	}
+
+	parsed := &mpopArgs{keys: args[1 : 1+numKeys], count: 1}
+	switch strings.ToUpper(args[1+numKeys]) {
+	case first:
+		parsed.first = true
+	case second:
+	default:
+		return nil, protocol.EncodeError("ERR syntax error")
+	}
+
+	rest := args[2+numKeys:]
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.ToUpper(rest[0]) == "COUNT":
+		count, err := strconv.Atoi(rest[1])
+		if err != nil || count <= 0 {
+			return nil, protocol.EncodeError("ERR count should be greater than 0")
+		}
+		parsed.count = count
+	default:
+		return nil, protocol.EncodeError("ERR syntax error")
+	}
+
+	return parsed, nil
+}
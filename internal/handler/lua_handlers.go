@@ -35,8 +35,11 @@ func (h *CommandHandler) handleEval(cmd *protocol.Command) []byte {
 		args[i] = cmd.Args[3+numKeys+i]
 	}
 
-	// Execute the script
-	result, err := h.luaEngine.Eval(script, keys, args)
+	// Execute the script on the processor goroutine so it runs atomically
+	var result interface{}
+	h.processor.RunScript(func() {
+		result, err = h.luaEngine.Eval(script, keys, args)
+	})
 	if err != nil {
 		return protocol.EncodeError(fmt.Sprintf("ERR %s", err.Error()))
 	}
@@ -73,8 +76,11 @@ func (h *CommandHandler) handleEvalSHA(cmd *protocol.Command) []byte {
 		args[i] = cmd.Args[3+numKeys+i]
 	}
 
-	// Execute the cached script
-	result, err := h.luaEngine.EvalSHA(sha1Hash, keys, args)
+	// Execute the cached script on the processor goroutine so it runs atomically
+	var result interface{}
+	h.processor.RunScript(func() {
+		result, err = h.luaEngine.EvalSHA(sha1Hash, keys, args)
+	})
 	if err != nil {
 		return protocol.EncodeError(fmt.Sprintf("ERR %s", err.Error()))
 	}
@@ -83,6 +89,19 @@ func (h *CommandHandler) handleEvalSHA(cmd *protocol.Command) []byte {
 	return h.convertLuaResultToRESP(result)
 }
 
+// evalForReplicas returns EVALSHA args as the EVAL of the same script, as a
+// replica only has the scripts it is sent; other commands are returned as is
+func (h *CommandHandler) evalForReplicas(args []string) []string {
+	if len(args) < 2 || strings.ToUpper(args[0]) != "EVALSHA" {
+		return args
+	}
+	script, ok := h.luaEngine.ScriptSource(args[1])
+	if !ok {
+		return args
+	}
+	return append([]string{"EVAL", script}, args[2:]...)
+}
+
 // handleScript handles SCRIPT subcommands
 // SCRIPT LOAD | EXISTS | FLUSH | DEBUG | KILL
 func (h *CommandHandler) handleScript(cmd *protocol.Command) []byte {
@@ -99,6 +118,8 @@ func (h *CommandHandler) handleScript(cmd *protocol.Command) []byte {
 		return h.handleScriptExists(cmd)
 	case "FLUSH":
 		return h.handleScriptFlush(cmd)
+	case "KILL":
+		return h.handleScriptKill(cmd)
 	default:
 		return protocol.EncodeError(fmt.Sprintf("ERR unknown SCRIPT subcommand '%s'", subcommand))
 	}
@@ -147,10 +168,23 @@ func (h *CommandHandler) handleScriptFlush(cmd *protocol.Command) []byte {
 	return protocol.EncodeSimpleString("OK")
 }
 
+// handleScriptKill stops the running script if it hasn't written anything yet
+// SCRIPT KILL
+func (h *CommandHandler) handleScriptKill(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'script|kill' command")
+	}
+
+	if err := h.luaEngine.Kill(); err != nil {
+		return protocol.EncodeError(err.Error())
+	}
+	return protocol.EncodeSimpleString("OK")
+}
+
 // convertLuaResultToRESP converts Lua result to RESP format
 func (h *CommandHandler) convertLuaResultToRESP(result interface{}) []byte {
 	if result == nil {
-		return protocol.EncodeBulkString("") // Null bulk string
+		return protocol.EncodeNullBulkString()
 	}
 
 	switch v := result.(type) {
@@ -173,12 +207,12 @@ func (h *CommandHandler) convertLuaResultToRESP(result interface{}) []byte {
 		return protocol.EncodeBulkString(v)
 
 	case []interface{}:
-		// Convert array to string array for protocol encoding
-		strArray := make([]string, len(v))
+		// Items keep their own types: integers stay integers, nils stay null
+		items := make([][]byte, len(v))
 		for i, item := range v {
-			strArray[i] = fmt.Sprintf("%v", item)
+			items[i] = h.convertLuaResultToRESP(item)
 		}
-		return protocol.EncodeArray(strArray)
+		return protocol.EncodeRawArray(items)
 
 	case map[string]interface{}:
 		// Check if it's a status reply
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"redis/internal/protocol"
+	"redis/internal/storage"
 )
 
 var (
@@ -26,6 +27,7 @@ type PipelineConfig struct {
 	CommandTimeout  time.Duration // Timeout for individual command execution
 	ReadTimeout     time.Duration // Timeout for reading client data (idle timeout)
 	PipelineTimeout time.Duration // Short timeout for waiting for in-flight pipelined commands
+	MaxPendingBytes int           // Unflushed response bytes that force an intermediate flush (0 = the write buffer size)
 }
 
 // PipelineResult holds the result of a pipelined command
@@ -35,6 +37,7 @@ type PipelineResult struct {
 	Command  string
 	Args     []string
 	Err      error
+	Expiry   time.Time // Deadline the command set from a relative TTL (zero if none), for propagation
 }
 
 // HandlePipeline processes commands with pipelining support using Redis-style streaming.
@@ -42,26 +45,49 @@ type PipelineResult struct {
 // Benefits: O(1) memory per command, immediate execution, matches real Redis behavior
 func (h *CommandHandler) HandlePipeline(ctx context.Context, client *Client, config PipelineConfig) {
 	reader := bufio.NewReaderSize(client.Conn, h.readBufferSize)
-	writer := bufio.NewWriterSize(client.Conn, h.writeBufferSize)
+	writer := bufio.NewWriterSize(client.Conn, pipelineWriterSize(h.writeBufferSize, config.MaxPendingBytes))
 
-	slowLog := NewSlowLog(128, config.SlowThreshold)
+	// Slow commands go to the shared log that SLOWLOG reads
+	slowLog := h.slowLog
 	consecutiveSlowCommands := 0
 	const maxConsecutiveSlow = 10 // Disconnect after 10 consecutive slow commands
 
 	// Get transaction state for this client
 	tx := h.txManager.GetTransaction(client.ID)
 	defer h.txManager.RemoveClient(client.ID) // Cleanup on disconnect
+	defer h.tracking.Disable(client.ID)
+
+	// Tracking invalidations are written between reply batches (see tracking.go)
+	pushCtx, stopPushes := context.WithCancel(ctx)
+	defer stopPushes()
+	h.startPushPump(pushCtx, client)
 
 	// Cleanup pub/sub on disconnect
+	// Runs on every exit path (EOF, read/write/flush error, timeout, context
+	// cancel) and regardless of InPubSub, since RemoveSubscriber is a no-op
+	// for a client that never subscribed
 	defer func() {
-		if client.InPubSub && client.Subscriber != nil {
-			subscriberID := fmt.Sprintf("client:%d", client.ID)
-			h.processor.GetStore().PubSub.RemoveSubscriber(subscriberID)
-		}
+		subscriberID := fmt.Sprintf("client:%d", client.ID)
+		h.processor.GetStore().PubSub.RemoveSubscriber(subscriberID)
+		client.InPubSub = false
+		client.Subscriber = nil
 	}()
 
-	// Message pump started flag
-	messagePumpStarted := false
+	// Message pump for the current subscriber, stopped when the connection
+	// ends or the client re-subscribes after leaving pub/sub mode
+	var pumpSubscriber *storage.Subscriber
+	stopPump := func() {}
+	defer func() { stopPump() }()
+	ensureMessagePump := func() {
+		if !client.InPubSub || client.Subscriber == nil || client.Subscriber == pumpSubscriber {
+			return
+		}
+		stopPump()
+		pumpCtx, cancel := context.WithCancel(ctx)
+		stopPump = cancel
+		pumpSubscriber = client.Subscriber
+		h.StartMessagePump(pumpCtx, client, client.Conn)
+	}
 
 	// Default pipeline timeout to 1ms if not set (very short - just to catch in-flight data)
 	pipelineTimeout := config.PipelineTimeout
@@ -88,8 +114,13 @@ func (h *CommandHandler) HandlePipeline(ctx context.Context, client *Client, con
 
 			// Wait for first command (this blocks - waiting for client to initiate)
 			cmd, err := protocol.ParseCommand(reader)
+
+			// Hold off pushes until this batch's replies are flushed, the
+			// first one included, whatever it is
+			client.writeSlot <- struct{}{}
+
 			if err != nil {
-				if err == io.EOF {
+				if connectionLost(err) {
 					return
 				}
 				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
@@ -100,6 +131,10 @@ func (h *CommandHandler) HandlePipeline(ctx context.Context, client *Client, con
 				response := protocol.EncodeError(fmt.Sprintf("ERR %v", err))
 				writer.Write(response)
 				writer.Flush()
+				if protocol.IsProtocolError(err) {
+					return // Stream can't be resynchronized
+				}
+				<-client.writeSlot
 				continue
 			}
 
@@ -111,19 +146,17 @@ func (h *CommandHandler) HandlePipeline(ctx context.Context, client *Client, con
 			if h.handleReplicationCommand(client.Conn, reader, writer, cmd) {
 				// Replication command was handled, continue to next iteration
 				// Note: PSYNC may keep connection alive for replication stream
+				<-client.writeSlot
 				continue
 			}
 
 			commandsInBatch := 0
 
 			// Process first command (with transaction support)
-			result := h.executeWithTransaction(ctx, client, cmd, tx, config.CommandTimeout)
+			result := h.executeTraced(ctx, client, cmd, tx, config.CommandTimeout)
 
 			// Start message pump if client just entered pub/sub mode
-			if client.InPubSub && !messagePumpStarted {
-				h.StartMessagePump(ctx, client, client.Conn)
-				messagePumpStarted = true
-			}
+			ensureMessagePump()
 
 			if h.handleCommandResult(result, &consecutiveSlowCommands, maxConsecutiveSlow, slowLog, client, writer) {
 				return
@@ -142,6 +175,7 @@ func (h *CommandHandler) HandlePipeline(ctx context.Context, client *Client, con
 					log.Printf("Error flushing response: %v", err)
 					return
 				}
+				<-client.writeSlot
 
 				// Enter pub/sub mode - only handle SUBSCRIBE/UNSUBSCRIBE/PING/QUIT
 				// This returns when client exits pub/sub or disconnects
@@ -161,6 +195,10 @@ func (h *CommandHandler) HandlePipeline(ctx context.Context, client *Client, con
 					cmd, err := protocol.ParseCommand(reader)
 					if err != nil {
 						writer.Write(protocol.EncodeError(fmt.Sprintf("ERR %v", err)))
+						if protocol.IsProtocolError(err) {
+							writer.Flush()
+							return
+						}
 						break
 					}
 
@@ -169,13 +207,10 @@ func (h *CommandHandler) HandlePipeline(ctx context.Context, client *Client, con
 						continue
 					}
 
-					result := h.executeWithTransaction(ctx, client, cmd, tx, config.CommandTimeout)
+					result := h.executeTraced(ctx, client, cmd, tx, config.CommandTimeout)
 
 					// Start message pump if client just entered pub/sub mode
-					if client.InPubSub && !messagePumpStarted {
-						h.StartMessagePump(ctx, client, client.Conn)
-						messagePumpStarted = true
-					}
+					ensureMessagePump()
 
 					if h.handleCommandResult(result, &consecutiveSlowCommands, maxConsecutiveSlow, slowLog, client, writer) {
 						return
@@ -206,13 +241,17 @@ func (h *CommandHandler) HandlePipeline(ctx context.Context, client *Client, con
 					if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 						break // No more commands, flush what we have
 					}
-					if err == io.EOF {
+					if connectionLost(err) {
 						// Client disconnected - flush remaining responses and exit
 						writer.Flush()
 						return
 					}
 					// Actual error
 					writer.Write(protocol.EncodeError(fmt.Sprintf("ERR %v", err)))
+					if protocol.IsProtocolError(err) {
+						writer.Flush()
+						return
+					}
 					break
 				}
 
@@ -222,13 +261,10 @@ func (h *CommandHandler) HandlePipeline(ctx context.Context, client *Client, con
 					continue
 				}
 
-				result := h.executeWithTransaction(ctx, client, cmd, tx, config.CommandTimeout)
+				result := h.executeTraced(ctx, client, cmd, tx, config.CommandTimeout)
 
 				// Start message pump if client just entered pub/sub mode
-				if client.InPubSub && !messagePumpStarted {
-					h.StartMessagePump(ctx, client, client.Conn)
-					messagePumpStarted = true
-				}
+				ensureMessagePump()
 
 				if h.handleCommandResult(result, &consecutiveSlowCommands, maxConsecutiveSlow, slowLog, client, writer) {
 					return
@@ -245,10 +281,33 @@ func (h *CommandHandler) HandlePipeline(ctx context.Context, client *Client, con
 				log.Printf("Error flushing response: %v", err)
 				return
 			}
+			<-client.writeSlot
 		}
 	}
 }
 
+// pipelineWriterSize returns the size of a connection's reply buffer
+// Replies queue in it for the batch flush, and bufio flushes it early once
+// it is full, so maxPending bounds the unflushed replies of a client that
+// pipelines far more commands than it reads replies for
+func pipelineWriterSize(writeBufferSize, maxPending int) int {
+	if maxPending > 0 {
+		return maxPending
+	}
+	return writeBufferSize
+}
+
+// connectionLost reports whether a read error means the connection is gone:
+// EOF, a reset, or a close by shutdown. Retrying the read would fail the same
+// way forever, unlike a malformed command or a read deadline
+func connectionLost(err error) bool {
+	if errors.Is(err, io.EOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && !netErr.Timeout()
+}
+
 // handleCommandResult processes a command result, checking for timeouts and slow commands.
 // Returns true if the client should be disconnected.
 func (h *CommandHandler) handleCommandResult(
@@ -259,6 +318,8 @@ func (h *CommandHandler) handleCommandResult(
 	client *Client,
 	writer *bufio.Writer,
 ) bool {
+	h.stats.Record(result.Command)
+
 	// Check for command timeout
 	if result.Err != nil {
 		if errors.Is(result.Err, ErrCommandTimeout) {
@@ -271,7 +332,7 @@ func (h *CommandHandler) handleCommandResult(
 	}
 
 	// Track consecutive slow commands
-	if slowLog.LogIfSlow(client.ID, result.Command, result.Args, result.Duration) {
+	if slowLog.LogIfSlow(client.ID, client.Conn.RemoteAddr().String(), client.State().Name, result.Command, result.Args, result.Duration) {
 		*consecutiveSlowCommands++
 		if *consecutiveSlowCommands >= maxConsecutiveSlow {
 			log.Printf("Client %d disconnected: too many slow commands", client.ID)
@@ -319,14 +380,18 @@ func (h *CommandHandler) HandlePubSubMode(
 				return false // Error
 			}
 
+			// Pushes wait for the reply, as in the pipeline
+			client.writeSlot <- struct{}{}
+
 			// Execute the command
-			result := h.executeWithTransaction(ctx, client, cmd, tx, config.CommandTimeout)
+			result := h.executeTraced(ctx, client, cmd, tx, config.CommandTimeout)
 
 			// Check if client exited pub/sub mode
 			if !client.InPubSub {
 				// Client unsubscribed from all channels, exit pub/sub mode
 				writer.Write(result.Response)
 				writer.Flush()
+				<-client.writeSlot
 				return true // Exited cleanly, continue in normal mode
 			}
 
@@ -344,6 +409,7 @@ func (h *CommandHandler) HandlePubSubMode(
 				log.Printf("Error flushing response: %v", err)
 				return false // Flush error
 			}
+			<-client.writeSlot
 		}
 	}
 }
@@ -1,13 +1,16 @@
 package handler
 
 import (
+	"strconv"
+
 	"redis/internal/replication"
 )
 
 // logBlockingToAOF logs a blocking command to AOF using the non-blocking equivalent
+// and propagates that to replicas; LogToAOF skips the file when AOF is off
 // Works for both immediate returns and blocked operations
 func (h *CommandHandler) logBlockingToAOF(command string, actualKey string, config *BlockingConfig) {
-	if h.aofWriter == nil || config == nil || actualKey == "" {
+	if config == nil || actualKey == "" {
 		return
 	}
 
@@ -68,5 +71,29 @@ func (h *CommandHandler) logBlockingToAOF(command string, actualKey string, conf
 				}
 			}
 		}
+
+	case "BLMPOP", "BZMPOP", "BZPOPMIN", "BZPOPMAX":
+		// BLMPOP timeout numkeys key1 key2 ... LEFT COUNT n → LMPOP 1 actualKey LEFT COUNT n
+		// BZMPOP timeout numkeys key1 key2 ... MIN COUNT n → ZMPOP 1 actualKey MIN COUNT n
+		// BZPOPMIN key1 key2 timeout → ZMPOP 1 actualKey MIN COUNT 1
+		name, where := "LMPOP", "LEFT"
+		if config.Direction == BlockRight {
+			where = "RIGHT"
+		}
+		if command != "BLMPOP" {
+			name, where = "ZMPOP", "MIN"
+			if config.Direction == BlockRight {
+				where = "MAX"
+			}
+		}
+		args := []string{"1", actualKey, where, "COUNT", strconv.Itoa(config.Count)}
+		h.LogToAOF(name, args)
+
+		// Propagate write commands to replicas
+		if h.replicationMgr != nil {
+			if replMgr, ok := h.replicationMgr.(*replication.ReplicationManager); ok {
+				replMgr.PropagateCommand(append([]string{name}, args...))
+			}
+		}
 	}
 }
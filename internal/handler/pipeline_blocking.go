@@ -13,6 +13,18 @@ func (h *CommandHandler) executeBlockingCommand(ctx context.Context, client *Cli
 	var shouldBlock bool
 	var blockConfig *BlockingConfig
 
+	// The first attempt pops like any write; once blocked the client holds
+	// nothing (see write_gate.go)
+	release, admitted := h.holdWriteGate()
+	if !admitted {
+		return PipelineResult{
+			Response: protocol.EncodeError(errFailoverInProgress),
+			Duration: time.Since(start),
+			Command:  command,
+			Args:     cmd.Args[1:],
+		}
+	}
+
 	switch command {
 	case "BLPOP":
 		response, shouldBlock, blockConfig = h.handleBLPop(cmd, client.ID)
@@ -22,10 +34,21 @@ func (h *CommandHandler) executeBlockingCommand(ctx context.Context, client *Cli
 		response, shouldBlock, blockConfig = h.handleBLMove(cmd, client.ID)
 	case "BRPOPLPUSH":
 		response, shouldBlock, blockConfig = h.handleBRPopLPush(cmd, client.ID)
+	case "BLMPOP":
+		response, shouldBlock, blockConfig = h.handleBLMPop(cmd, client.ID)
+	case "BZMPOP":
+		response, shouldBlock, blockConfig = h.handleBZMPop(cmd, client.ID)
+	case "BZPOPMIN":
+		response, shouldBlock, blockConfig = h.handleBZPopMin(cmd, client.ID)
+	case "BZPOPMAX":
+		response, shouldBlock, blockConfig = h.handleBZPopMax(cmd, client.ID)
 	default:
 		response = protocol.EncodeError("ERR unknown blocking command")
 		shouldBlock = false
 	}
+	if shouldBlock {
+		release()
+	}
 
 	// If we got data immediately, return it and log to AOF
 	if !shouldBlock {
@@ -33,6 +56,7 @@ func (h *CommandHandler) executeBlockingCommand(ctx context.Context, client *Cli
 		if len(response) > 0 && response[0] != '-' && blockConfig != nil && blockConfig.ActualKey != "" {
 			h.logBlockingToAOF(command, blockConfig.ActualKey, blockConfig)
 		}
+		release()
 
 		return PipelineResult{
 			Response: response,
@@ -50,6 +74,7 @@ func (h *CommandHandler) executeBlockingCommand(ctx context.Context, client *Cli
 		blockConfig.Timeout,
 		blockConfig.DestKey,
 		blockConfig.DestDir,
+		blockConfig.PopFunc,
 	)
 
 	// Wait for result or context cancellation
@@ -77,7 +102,10 @@ func (h *CommandHandler) executeBlockingCommand(ctx context.Context, client *Cli
 
 		// Got data - format response based on command type
 		var resp []byte
-		if blockConfig.DestKey != "" {
+		if result.Reply != nil {
+			// BLMPOP/BZMPOP/BZPOPMIN/BZPOPMAX - reply built by the client's PopFunc
+			resp = result.Reply
+		} else if blockConfig.DestKey != "" {
 			// BLMOVE/BRPOPLPUSH - return just the value
 			resp = protocol.EncodeBulkString(result.Value)
 		} else {
@@ -95,6 +123,7 @@ func (h *CommandHandler) executeBlockingCommand(ctx context.Context, client *Cli
 			keys = append(keys, blockConfig.DestKey)
 		}
 		h.txManager.TouchKeys(keys)
+		h.sendInvalidations(h.tracking.Invalidate(keys))
 
 		return PipelineResult{
 			Response: resp,
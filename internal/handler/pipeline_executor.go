@@ -75,6 +75,34 @@ func (h *CommandHandler) executeWithTransaction(ctx context.Context, client *Cli
 		}
 	}
 
+	// CLIENT, HELLO and AUTH read and change per-connection state
+	switch command {
+	case "AUTH":
+		response := h.handleAuth(cmd, client)
+		return PipelineResult{
+			Response: response,
+			Duration: time.Since(start),
+			Command:  command,
+			Args:     cmd.Args[1:],
+		}
+	case "CLIENT":
+		response := h.handleClientCommand(cmd, client)
+		return PipelineResult{
+			Response: response,
+			Duration: time.Since(start),
+			Command:  command,
+			Args:     cmd.Args[1:],
+		}
+	case "HELLO":
+		response := h.handleHello(cmd, client)
+		return PipelineResult{
+			Response: response,
+			Duration: time.Since(start),
+			Command:  command,
+			Args:     cmd.Args[1:],
+		}
+	}
+
 	// Handle transaction control commands specially
 	switch command {
 	case "MULTI":
@@ -87,7 +115,7 @@ func (h *CommandHandler) executeWithTransaction(ctx context.Context, client *Cli
 		}
 
 	case "EXEC":
-		response := h.handleExecCommand(ctx, client, tx, timeout)
+		response := h.withReplOffset(ctx, client, h.handleExecCommand(ctx, client, tx, timeout))
 		return PipelineResult{
 			Response: response,
 			Duration: time.Since(start),
@@ -153,6 +181,7 @@ func (h *CommandHandler) executeWithTransaction(ctx context.Context, client *Cli
 	}
 
 	// Normal execution (not in transaction)
+	h.trackReads(client, command, cmd.Args)
 	result := h.executeWithTimeout(ctx, cmd, timeout)
 
 	// Touch watched keys for any clients watching these keys
@@ -160,6 +189,11 @@ func (h *CommandHandler) executeWithTransaction(ctx context.Context, client *Cli
 	if writeKeys := GetWriteKeys(command, cmd.Args[1:]); len(writeKeys) > 0 {
 		h.txManager.TouchKeys(writeKeys)
 	}
+	h.invalidateWrittenKeys(command, cmd.Args)
+
+	if IsWriteCommand(command) {
+		result.Response = h.withReplOffset(ctx, client, result.Response)
+	}
 
 	return result
 }
@@ -177,7 +211,15 @@ func (h *CommandHandler) executeWithTimeout(ctx context.Context, cmd *protocol.C
 	command := strings.ToUpper(cmd.Args[0])
 
 	// Create a context with timeout
-	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	// Commands that block for a timeout of their own are only cut short when
+	// the connection goes away, like blocking pops
+	var cmdCtx context.Context
+	var cancel context.CancelFunc
+	if isSelfTimedCommand(command) {
+		cmdCtx, cancel = context.WithCancel(ctx)
+	} else {
+		cmdCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
 	defer cancel()
 
 	start := time.Now()
@@ -192,11 +234,70 @@ func (h *CommandHandler) executeWithTimeout(ctx context.Context, cmd *protocol.C
 		}
 	}
 
+	// Only SCRIPT KILL / SHUTDOWN NOSAVE may run while a script is over lua-time-limit
+	if h.isBlockedByBusyScript(cmd.Args) {
+		return PipelineResult{
+			Response: protocol.EncodeError(errBusyScript),
+			Duration: time.Since(start),
+			Command:  command,
+			Args:     cmd.Args[1:],
+		}
+	}
+
+	// Refuse stale reads while the master link is down (replica-serve-stale-data no)
+	if h.isStaleReadRejected(command) {
+		return PipelineResult{
+			Response: protocol.EncodeError(errMasterDown),
+			Duration: time.Since(start),
+			Command:  command,
+			Args:     cmd.Args[1:],
+		}
+	}
+
+	// Apply backpressure while a snapshot is being written
+	if h.isWriteRejectedDuringSave(command) {
+		return PipelineResult{
+			Response: protocol.EncodeError(errSaveInProgress),
+			Duration: time.Since(start),
+			Command:  command,
+			Args:     cmd.Args[1:],
+		}
+	}
+
+	// Refuse writes while SHUTDOWN FAILOVER waits for a replica to catch up;
+	// an admitted write holds failover off until it is propagated
+	release, admitted := h.enterWriteGate(command)
+	if !admitted {
+		return PipelineResult{
+			Response: protocol.EncodeError(errFailoverInProgress),
+			Duration: time.Since(start),
+			Command:  command,
+			Args:     cmd.Args[1:],
+		}
+	}
+	defer release()
+
+	// Shed load rather than queueing behind a saturated processor
+	if !h.admitCommand(cmdCtx, command) {
+		return PipelineResult{
+			Response: protocol.EncodeError(errOverloaded),
+			Duration: time.Since(start),
+			Command:  command,
+			Args:     cmd.Args[1:],
+		}
+	}
+
 	// Execute command in channel to support timeout
+	// The deadline also travels with the command so long scans can stop early
 	resultChan := make(chan []byte, 1)
+	handlerCtx, applied := withAppliedExpiry(cmdCtx)
 	go func() {
+		// Wait out a replicated transaction being applied
+		h.replTxMu.RLock()
+		defer h.replTxMu.RUnlock()
+
 		if handler, exists := h.commands[command]; exists {
-			resultChan <- handler(cmd)
+			resultChan <- handler(cmd.WithContext(handlerCtx))
 		} else {
 			resultChan <- protocol.EncodeError(fmt.Sprintf("ERR unknown command '%s'", command))
 		}
@@ -217,13 +318,18 @@ func (h *CommandHandler) executeWithTimeout(ctx context.Context, cmd *protocol.C
 
 		// Log successful write commands to AOF
 		// We check if response is not an error before logging
+		// Relative TTLs are logged and replicated as absolute deadlines
 		if len(response) > 0 && response[0] != '-' {
-			h.LogToAOF(command, cmd.Args[1:])
-
-			// Propagate write commands to replicas
-			if h.replicationMgr != nil {
-				if replMgr, ok := h.replicationMgr.(*replication.ReplicationManager); ok {
-					replMgr.PropagateCommand(cmd.Args)
+			for _, args := range absoluteExpiryCommands(cmd.Args, start, applied.at) {
+				name := strings.ToUpper(args[0])
+				h.LogToAOF(name, args[1:])
+
+				// Propagate writes to replicas; anything else (reads, WAITOFFSET,
+				// DEBUG RELOAD, CONFIG SET, ...) only concerns this server
+				if h.replicationMgr != nil && isReplicatedCommand(name) {
+					if replMgr, ok := h.replicationMgr.(*replication.ReplicationManager); ok {
+						replMgr.PropagateCommand(h.evalForReplicas(args))
+					}
 				}
 			}
 		}
@@ -239,6 +345,7 @@ func (h *CommandHandler) executeWithTimeout(ctx context.Context, cmd *protocol.C
 
 // executeWithTimeoutNoAOF executes a command without AOF logging
 // Used for transaction commands where we batch log after EXEC
+// The caller must hold replTxMu
 func (h *CommandHandler) executeWithTimeoutNoAOF(ctx context.Context, cmd *protocol.Command, timeout time.Duration) PipelineResult {
 	if cmd == nil || len(cmd.Args) == 0 {
 		return PipelineResult{
@@ -266,11 +373,34 @@ func (h *CommandHandler) executeWithTimeoutNoAOF(ctx context.Context, cmd *proto
 		}
 	}
 
+	// Only SCRIPT KILL / SHUTDOWN NOSAVE may run while a script is over lua-time-limit
+	if h.isBlockedByBusyScript(cmd.Args) {
+		return PipelineResult{
+			Response: protocol.EncodeError(errBusyScript),
+			Duration: time.Since(start),
+			Command:  command,
+			Args:     cmd.Args[1:],
+		}
+	}
+
+	// Refuse stale reads while the master link is down (replica-serve-stale-data no)
+	if h.isStaleReadRejected(command) {
+		return PipelineResult{
+			Response: protocol.EncodeError(errMasterDown),
+			Duration: time.Since(start),
+			Command:  command,
+			Args:     cmd.Args[1:],
+		}
+	}
+
 	// Execute command in channel to support timeout
+	// The deadline also travels with the command so long scans can stop early
+	// EXEC holds replTxMu for the whole transaction, so it isn't taken here
 	resultChan := make(chan []byte, 1)
+	handlerCtx, applied := withAppliedExpiry(cmdCtx)
 	go func() {
 		if handler, exists := h.commands[command]; exists {
-			resultChan <- handler(cmd)
+			resultChan <- handler(cmd.WithContext(handlerCtx))
 		} else {
 			resultChan <- protocol.EncodeError(fmt.Sprintf("ERR unknown command '%s'", command))
 		}
@@ -294,6 +424,13 @@ func (h *CommandHandler) executeWithTimeoutNoAOF(ctx context.Context, cmd *proto
 			Duration: duration,
 			Command:  command,
 			Args:     cmd.Args[1:],
+			Expiry:   applied.at,
 		}
 	}
 }
+
+// isSelfTimedCommand reports whether a command blocks for a timeout given as
+// its own argument, so the command timeout must not apply to it
+func isSelfTimedCommand(command string) bool {
+	return command == "WAIT" || command == "WAITOFFSET"
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"redis/internal/protocol"
@@ -24,6 +25,11 @@ func (h *CommandHandler) handleExecCommand(ctx context.Context, client *Client,
 		return protocol.EncodeError("ERR EXEC without MULTI")
 	}
 
+	// Pure-read transactions have nothing to log, replicate or wait for
+	if isReadOnlyTransaction(tx.Queue) {
+		return h.execReadOnlyTransaction(ctx, client, tx, timeout)
+	}
+
 	// Check if transaction is dirty (a watched key was modified)
 	// This is O(1) - just check the dirty flag!
 	if h.txManager.IsTransactionDirty(tx) {
@@ -33,9 +39,41 @@ func (h *CommandHandler) handleExecCommand(ctx context.Context, client *Client,
 		return NilResponse // Return nil array (transaction aborted)
 	}
 
+	// With an implicit WAIT, refuse up front when too few replicas are online
+	// to ever acknowledge the writes: an error after EXEC would read as a
+	// failed transaction although it was applied
+	if client.WaitReplicas > 0 && h.onlineReplicas() < client.WaitReplicas {
+		tx.Reset()
+		h.txManager.UnwatchAllKeys(client.ID)
+		return protocol.EncodeError(errNoReplicas)
+	}
+
+	// Refuse the transaction while SHUTDOWN FAILOVER runs; otherwise hold
+	// the write gate until its writes are propagated
+	release, admitted := h.holdWriteGate()
+	if !admitted {
+		tx.Reset()
+		h.txManager.UnwatchAllKeys(client.ID)
+		return protocol.EncodeError(errFailoverInProgress)
+	}
+
+	// Apply save backpressure to the transaction as a whole, once: a save
+	// started while it runs must not leave it half applied
+	if h.rejectWritesDuringSave && h.IsSaveInProgress() && hasGatedWrite(tx.Queue) {
+		release()
+		tx.Reset()
+		h.txManager.UnwatchAllKeys(client.ID)
+		return protocol.EncodeError(errExecSaveInProgress)
+	}
+
+	// On a replica, a replicated MULTI block must not land between two of
+	// the transaction's commands
+	h.replTxMu.RLock()
+
 	// Execute all queued commands
 	results := make([][]byte, len(tx.Queue))
 	successfulCmds := make([]QueuedCommand, 0, len(tx.Queue))
+	appliedExpiries := make([]time.Time, 0, len(tx.Queue)) // Per successful command
 
 	for i, qcmd := range tx.Queue {
 		// Reconstruct the command
@@ -43,6 +81,7 @@ func (h *CommandHandler) handleExecCommand(ctx context.Context, client *Client,
 		cmd := &protocol.Command{Args: args}
 
 		// Execute with timeout (but don't log to AOF yet - we'll batch log after)
+		h.trackReads(client, qcmd.Name, args)
 		result := h.executeWithTimeoutNoAOF(ctx, cmd, timeout)
 		results[i] = result.Response
 
@@ -50,37 +89,123 @@ func (h *CommandHandler) handleExecCommand(ctx context.Context, client *Client,
 		// Only log commands that succeeded (not errors) because Redis logs after execution
 		if len(result.Response) > 0 && result.Response[0] != '-' {
 			successfulCmds = append(successfulCmds, qcmd)
+			appliedExpiries = append(appliedExpiries, result.Expiry)
 		}
 
 		// Touch watched keys for any clients watching these keys
 		if writeKeys := GetWriteKeys(qcmd.Name, qcmd.Args); len(writeKeys) > 0 {
 			h.txManager.TouchKeys(writeKeys)
 		}
+		h.invalidateWrittenKeys(qcmd.Name, args)
 	}
 
 	// Log only successful write commands to AOF after execution
 	// Redis logs to AOF after execution, so we only log commands that actually succeeded
-	for _, qcmd := range successfulCmds {
-		h.LogToAOF(qcmd.Name, qcmd.Args)
-
-		// Propagate write commands to replicas
-		if h.replicationMgr != nil {
-			if replMgr, ok := h.replicationMgr.(*replication.ReplicationManager); ok {
-				// Build full command args (command + arguments)
-				fullArgs := append([]string{qcmd.Name}, qcmd.Args...)
-				replMgr.PropagateCommand(fullArgs)
+	// Relative TTLs are logged and replicated as absolute deadlines
+	// The writes are wrapped in MULTI/EXEC in both so that a replica or an AOF
+	// reload applies the whole transaction or none of it
+	now := time.Now()
+	var aofCmds, replCmds [][]string
+	for i, qcmd := range successfulCmds {
+		// Build full command args (command + arguments)
+		fullArgs := append([]string{qcmd.Name}, qcmd.Args...)
+		for _, args := range absoluteExpiryCommands(fullArgs, now, appliedExpiries[i]) {
+			args[0] = strings.ToUpper(args[0])
+			aofCmds = append(aofCmds, args)
+
+			// Propagate write commands to replicas (reads have nothing to replay)
+			if isReplicatedCommand(args[0]) {
+				replCmds = append(replCmds, h.evalForReplicas(args))
 			}
 		}
 	}
+	h.LogTransactionToAOF(aofCmds)
+	if h.replicationMgr != nil && len(replCmds) > 0 {
+		if replMgr, ok := h.replicationMgr.(*replication.ReplicationManager); ok {
+			replMgr.PropagateTransaction(replCmds)
+		}
+	}
+	h.replTxMu.RUnlock()
+	release()
 
 	// Reset transaction state and clear watches
 	tx.Reset()
 	h.txManager.UnwatchAllKeys(client.ID)
 
+	// Implicit WAIT (CLIENT WAIT-DEFAULT): the writes above are already queued
+	// for propagation, so the ACK target offset covers the whole transaction
+	// The transaction is applied either way, so like WAIT a timeout still
+	// replies with its results
+	if client.WaitReplicas > 0 && hasWriteCommand(successfulCmds) {
+		h.waitForReplicas(ctx, client.WaitReplicas, client.WaitTimeout)
+	}
+
 	// Return array of results
 	return protocol.EncodeRawArray(results)
 }
 
+// isReadOnlyTransaction reports whether every queued command only reads data
+func isReadOnlyTransaction(queue []QueuedCommand) bool {
+	for _, qcmd := range queue {
+		if !commandHasFlag(qcmd.Name, "readonly") {
+			return false
+		}
+	}
+	return true
+}
+
+// execReadOnlyTransaction runs a transaction made only of reads
+// It skips the write path of EXEC: no watched keys are touched, nothing is
+// logged to the AOF or propagated to replicas, and no implicit WAIT applies
+// Writes are held off for the duration, so the reads form a consistent view
+func (h *CommandHandler) execReadOnlyTransaction(ctx context.Context, client *Client, tx *Transaction, timeout time.Duration) []byte {
+	// No write lands between the reads: neither one from a client, held off
+	// by the write gate, nor a replicated MULTI block
+	h.writeGate.Lock()
+	defer h.writeGate.Unlock()
+	h.replTxMu.RLock()
+	defer h.replTxMu.RUnlock()
+
+	// A watched key modified before the lock was taken aborts the transaction
+	if h.txManager.IsTransactionDirty(tx) {
+		tx.Reset()
+		h.txManager.UnwatchAllKeys(client.ID)
+		return NilResponse
+	}
+
+	results := make([][]byte, len(tx.Queue))
+	for i, qcmd := range tx.Queue {
+		args := append([]string{qcmd.Name}, qcmd.Args...)
+		h.trackReads(client, qcmd.Name, args)
+		results[i] = h.executeWithTimeoutNoAOF(ctx, &protocol.Command{Args: args}, timeout).Response
+	}
+
+	tx.Reset()
+	h.txManager.UnwatchAllKeys(client.ID)
+
+	return protocol.EncodeRawArray(results)
+}
+
+// hasGatedWrite reports whether any of the commands goes through the write gate
+func hasGatedWrite(cmds []QueuedCommand) bool {
+	for _, qcmd := range cmds {
+		if isGatedWrite(qcmd.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWriteCommand reports whether any of the commands modifies data
+func hasWriteCommand(cmds []QueuedCommand) bool {
+	for _, qcmd := range cmds {
+		if IsWriteCommand(qcmd.Name) {
+			return true
+		}
+	}
+	return false
+}
+
 // handleDiscardCommand handles the DISCARD command
 func (h *CommandHandler) handleDiscardCommand(tx *Transaction) []byte {
 	if tx.State != TxStarted {
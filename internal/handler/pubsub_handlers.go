@@ -165,18 +165,10 @@ func encodePubSubMessage(msg *storage.Message) []byte {
 	switch msg.Type {
 	case "subscribe", "unsubscribe":
 		// Array: [type, channel, count]
-		return protocol.EncodeInterfaceArray([]interface{}{
-			msg.Type,
-			msg.Channel,
-			msg.Count,
-		})
+		return encodeSubscriptionMessage(msg.Type, msg.Channel, msg.Count)
 	case "psubscribe", "punsubscribe":
 		// Array: [type, pattern, count]
-		return protocol.EncodeInterfaceArray([]interface{}{
-			msg.Type,
-			msg.Pattern,
-			msg.Count,
-		})
+		return encodeSubscriptionMessage(msg.Type, msg.Pattern, msg.Count)
 	case "message":
 		// Array: [type, channel, payload]
 		return protocol.EncodeInterfaceArray([]interface{}{
@@ -197,8 +189,30 @@ func encodePubSubMessage(msg *storage.Message) []byte {
 	}
 }
 
+// encodeSubscriptionMessage encodes a (un)subscribe confirmation
+// The count is an integer reply, and the name is null when an argument-less
+// UNSUBSCRIBE/PUNSUBSCRIBE had nothing to remove
+func encodeSubscriptionMessage(kind, name string, count int) []byte {
+	nameReply := protocol.EncodeBulkString(name)
+	if name == "" && (kind == "unsubscribe" || kind == "punsubscribe") {
+		nameReply = protocol.EncodeNullBulkString()
+	}
+	return protocol.EncodeRawArray([][]byte{
+		protocol.EncodeBulkString(kind),
+		nameReply,
+		protocol.EncodeInteger(count),
+	})
+}
+
 // ==================== SUBSCRIPTION COMMANDS (Pub/Sub Mode) ====================
 
+// newSubscriber creates the subscriber used if the client is not subscribed yet
+// Its message buffer is sized by client-output-buffer-limit pubsub: messages
+// published while the buffer is full are dropped for this client
+func (h *CommandHandler) newSubscriber(client *Client) *storage.Subscriber {
+	return storage.NewSubscriber(fmt.Sprintf("client:%d", client.ID), h.pubsubBufferSize)
+}
+
 // handleSubscribe handles SUBSCRIBE command
 // SUBSCRIBE channel [channel ...]
 // This command enters pub/sub mode
@@ -218,6 +232,7 @@ func (h *CommandHandler) handleSubscribe(cmd *protocol.Command, client *Client)
 	procCmd := &processor.Command{
 		Type:     processor.CmdSubscribe,
 		Args:     procArgs,
+		Value:    h.newSubscriber(client),
 		ClientID: client.ID,
 		Response: make(chan interface{}, 1),
 	}
@@ -310,6 +325,7 @@ func (h *CommandHandler) handlePSubscribe(cmd *protocol.Command, client *Client)
 	procCmd := &processor.Command{
 		Type:     processor.CmdPSubscribe,
 		Args:     procArgs,
+		Value:    h.newSubscriber(client),
 		ClientID: client.ID,
 		Response: make(chan interface{}, 1),
 	}
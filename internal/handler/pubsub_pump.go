@@ -4,22 +4,60 @@ import (
 	"context"
 	"log"
 	"net"
+	"time"
+
+	"redis/internal/protocol"
 )
 
+// pubsubPingMessage is the keepalive pushed to idle subscribers
+var pubsubPingMessage = protocol.EncodeRawArray([][]byte{
+	protocol.EncodeBulkString("ping"),
+	protocol.EncodeBulkString(""),
+})
+
 // StartMessagePump starts the message pump for a pub/sub subscriber
 // This goroutine reads from the subscriber's message channel and sends directly to the client connection
 // Writes directly to connection to bypass buffered writer (pub/sub messages are sent immediately)
+// If a pub/sub ping interval is configured, idle subscribers also receive a periodic
+// ping; a failed ping closes the connection so dead subscribers are reaped promptly
 func (h *CommandHandler) StartMessagePump(ctx context.Context, client *Client, conn net.Conn) {
-	if client.Subscriber == nil {
+	// Captured once: UNSUBSCRIBE clears client.Subscriber while the pump runs
+	subscriber := client.Subscriber
+	if subscriber == nil {
 		return
 	}
 
 	go func() {
+		// A nil channel never fires, which disables the keepalive
+		var pingChan <-chan time.Time
+		if h.pubsubPingInterval > 0 {
+			ticker := time.NewTicker(h.pubsubPingInterval)
+			defer ticker.Stop()
+			pingChan = ticker.C
+		}
+		lastWrite := time.Now()
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case msg, ok := <-client.Subscriber.Channels:
+			case <-pingChan:
+				// Only idle subscribers need a keepalive
+				if time.Since(lastWrite) < h.pubsubPingInterval {
+					continue
+				}
+
+				// Bound the write so a peer that stopped reading can't block us forever
+				conn.SetWriteDeadline(time.Now().Add(h.pubsubPingInterval))
+				_, err := conn.Write(pubsubPingMessage)
+				conn.SetWriteDeadline(time.Time{})
+				if err != nil {
+					log.Printf("Client %d: pub/sub keepalive failed, closing connection: %v", client.ID, err)
+					conn.Close() // Unblocks the reader, which unsubscribes the client
+					return
+				}
+				lastWrite = time.Now()
+			case msg, ok := <-subscriber.Channels:
 				if !ok {
 					// Channel closed, exit
 					return
@@ -35,6 +73,7 @@ func (h *CommandHandler) StartMessagePump(ctx context.Context, client *Client, c
 					log.Printf("Error writing pub/sub message to client %d: %v", client.ID, err)
 					return
 				}
+				lastWrite = time.Now()
 			}
 		}
 	}()
@@ -8,13 +8,16 @@ import (
 	"hash/crc64"
 	"log"
 	"net"
+	"os"
+	"runtime"
 	"strconv"
 	"strings"
-	"time"
 
 	"redis/internal/protocol"
+	"redis/internal/rdb"
 	"redis/internal/replication"
 	"redis/internal/storage"
+	"redis/internal/version"
 )
 
 // ==================== REPLICATION COMMAND HANDLERS ====================
@@ -73,6 +76,21 @@ func handleReplConf(conn net.Conn, writer *bufio.Writer, args []string, rm *repl
 
 		writeSimpleString(writer, "OK")
 
+	case "ip-address":
+		// Replica is telling us the address it wants to be advertised under
+		// (replica-announce-ip), e.g. when its source address is behind NAT
+		ip := args[1]
+		log.Printf("[REPLICATION] Replica announced ip %s", ip)
+
+		// Store temporarily - will be applied when replica is added during PSYNC
+		if h, ok := handler.(*CommandHandler); ok {
+			h.pendingPortsMu.Lock()
+			h.pendingIPs[conn.RemoteAddr().String()] = ip
+			h.pendingPortsMu.Unlock()
+		}
+
+		writeSimpleString(writer, "OK")
+
 	case "capa":
 		// Replica is telling us its capabilities
 		capability := args[1]
@@ -111,6 +129,29 @@ func handleReplConf(conn net.Conn, writer *bufio.Writer, args []string, rm *repl
 	}
 }
 
+// applyPendingReplicaAddr applies the listening port and ip-address sent via REPLCONF
+// before PSYNC to the newly registered replica
+func applyPendingReplicaAddr(conn net.Conn, rm *replication.ReplicationManager, replica *replication.ReplicaInfo, handler interface{}) {
+	h, ok := handler.(*CommandHandler)
+	if !ok {
+		return
+	}
+
+	addr := conn.RemoteAddr().String()
+	h.pendingPortsMu.Lock()
+	defer h.pendingPortsMu.Unlock()
+
+	if port, exists := h.pendingPorts[addr]; exists {
+		rm.SetReplicaListeningPort(replica.ID, port)
+		delete(h.pendingPorts, addr)
+		log.Printf("[REPLICATION] Applied pending port %d to replica %s", port, replica.ID)
+	}
+	if ip, exists := h.pendingIPs[addr]; exists {
+		rm.SetReplicaAnnounceIP(replica.ID, ip)
+		delete(h.pendingIPs, addr)
+	}
+}
+
 // handlePSync handles PSYNC command (partial/full synchronization)
 func handlePSync(conn net.Conn, writer *bufio.Writer, args []string, rm *replication.ReplicationManager, handler interface{}) {
 	if len(args) != 2 {
@@ -149,8 +190,8 @@ func handlePSync(conn net.Conn, writer *bufio.Writer, args []string, rm *replica
 				// Generate replica ID and add to manager
 				replicaID := fmt.Sprintf("replica-%s", conn.RemoteAddr().String())
 				replica := rm.AddReplica(conn, replicaID)
-				replica.State = replication.ReplicaStateOnline
-				replica.Offset = offset
+				rm.MarkReplicaOnline(replicaID, offset)
+				applyPendingReplicaAddr(conn, rm, replica, handler)
 
 				log.Printf("[REPLICATION] Partial resync complete")
 				return
@@ -174,16 +215,8 @@ func handlePSync(conn net.Conn, writer *bufio.Writer, args []string, rm *replica
 	// Add replica to replication manager
 	replica := rm.AddReplica(conn, replicaID)
 
-	// Apply pending listening port if available
-	if h, ok := handler.(*CommandHandler); ok {
-		h.pendingPortsMu.Lock()
-		if port, exists := h.pendingPorts[conn.RemoteAddr().String()]; exists {
-			rm.SetReplicaListeningPort(replica.ID, port)
-			delete(h.pendingPorts, conn.RemoteAddr().String())
-			log.Printf("[REPLICATION] Applied pending port %d to replica %s", port, replica.ID)
-		}
-		h.pendingPortsMu.Unlock()
-	}
+	// Apply pending listening port and announced ip if available
+	applyPendingReplicaAddr(conn, rm, replica, handler)
 
 	// Send RDB snapshot with actual data
 	rdbData := generateRDB(rm)
@@ -194,14 +227,14 @@ func handlePSync(conn net.Conn, writer *bufio.Writer, args []string, rm *replica
 	log.Printf("[REPLICATION] Sent RDB snapshot (%d bytes)", len(rdbData))
 
 	// Mark replica as online
-	replica.State = replication.ReplicaStateOnline
+	rm.MarkReplicaOnline(replicaID, offset)
 
 	// Keep connection alive for replication stream
 	// The client's read loop will handle incoming REPLCONF ACK commands
 }
 
-// handleInfo handles INFO command with replication section
-func handleInfo(writer *bufio.Writer, args []string, rm *replication.ReplicationManager) {
+// handleInfo handles INFO command with server and replication sections
+func handleInfo(writer *bufio.Writer, args []string, rm *replication.ReplicationManager, handler interface{}) {
 	section := "all"
 	if len(args) > 0 {
 		section = strings.ToLower(args[0])
@@ -209,6 +242,90 @@ func handleInfo(writer *bufio.Writer, args []string, rm *replication.Replication
 
 	var response strings.Builder
 
+	// Server section
+	if section == "all" || section == "server" {
+		response.WriteString("# Server\r\n")
+		response.WriteString(fmt.Sprintf("redis_version:%s\r\n", version.Version))
+		response.WriteString(fmt.Sprintf("redis_git_sha1:%s\r\n", version.GitSHA))
+		response.WriteString(fmt.Sprintf("redis_build_id:%s\r\n", version.BuildID))
+		response.WriteString(fmt.Sprintf("os:%s %s\r\n", runtime.GOOS, runtime.GOARCH))
+		response.WriteString(fmt.Sprintf("arch_bits:%d\r\n", strconv.IntSize))
+		response.WriteString(fmt.Sprintf("go_version:%s\r\n", runtime.Version()))
+		response.WriteString(fmt.Sprintf("process_id:%d\r\n", os.Getpid()))
+		if section == "all" {
+			response.WriteString("\r\n")
+		}
+	}
+
+	// Clients and Stats sections (connection counters are owned by the server)
+	var stats ConnStats
+	if h, ok := handler.(*CommandHandler); ok && h.connStatsFunc != nil {
+		stats = h.connStatsFunc()
+	}
+
+	if section == "all" || section == "clients" {
+		response.WriteString("# Clients\r\n")
+		response.WriteString(fmt.Sprintf("connected_clients:%d\r\n", stats.Connected))
+		response.WriteString(fmt.Sprintf("maxclients:%d\r\n", stats.MaxClients))
+		if h, ok := handler.(*CommandHandler); ok {
+			trackingClients, _ := h.tracking.Sizes()
+			response.WriteString(fmt.Sprintf("tracking_clients:%d\r\n", trackingClients))
+		}
+		if section == "all" {
+			response.WriteString("\r\n")
+		}
+	}
+
+	// Persistence section
+	if h, ok := handler.(*CommandHandler); ok && (section == "all" || section == "persistence") {
+		response.WriteString(h.persistenceInfo())
+		if section == "all" {
+			response.WriteString("\r\n")
+		}
+	}
+
+	if section == "all" || section == "stats" {
+		response.WriteString("# Stats\r\n")
+		response.WriteString(fmt.Sprintf("total_connections_received:%d\r\n", stats.TotalReceived))
+		response.WriteString(fmt.Sprintf("rejected_connections:%d\r\n", stats.Rejected))
+		if h, ok := handler.(*CommandHandler); ok {
+			keyspace := h.processor.KeyspaceStats()
+			response.WriteString(fmt.Sprintf("keyspace_hits:%d\r\n", keyspace.Hits))
+			response.WriteString(fmt.Sprintf("keyspace_misses:%d\r\n", keyspace.Misses))
+			_, trackedKeys := h.tracking.Sizes()
+			response.WriteString(fmt.Sprintf("tracking_total_keys:%d\r\n", trackedKeys))
+		}
+		if section == "all" {
+			response.WriteString("\r\n")
+		}
+	}
+
+	// Keyspace section (only database 0 exists, so its hits and misses are the global ones)
+	if h, ok := handler.(*CommandHandler); ok && (section == "all" || section == "keyspace") {
+		response.WriteString("# Keyspace\r\n")
+		if keys, expires := h.processor.KeyspaceSize(); keys > 0 {
+			keyspace := h.processor.KeyspaceStats()
+			response.WriteString(fmt.Sprintf("db0:keys=%d,expires=%d,keyspace_hits=%d,keyspace_misses=%d\r\n",
+				keys, expires, keyspace.Hits, keyspace.Misses))
+		}
+		if section == "all" {
+			response.WriteString("\r\n")
+		}
+	}
+
+	// Encodings section: keys per encoding class, to spot collections that
+	// unexpectedly outgrew their compact encoding
+	if h, ok := handler.(*CommandHandler); ok && (section == "all" || section == "encodings") {
+		response.WriteString("# Encodings\r\n")
+		for _, stats := range h.processor.EncodingStats() {
+			response.WriteString(fmt.Sprintf("encoding_%s:compact=%d,large=%d,conversions=%d\r\n",
+				stats.Type, stats.Compact, stats.Large, stats.Conversions))
+		}
+		if section == "all" {
+			response.WriteString("\r\n")
+		}
+	}
+
 	// Replication section
 	if section == "all" || section == "replication" {
 		info := rm.GetInfo()
@@ -238,6 +355,7 @@ func handleInfo(writer *bufio.Writer, args []string, rm *replication.Replication
 			response.WriteString(fmt.Sprintf("master_port:%d\r\n", info["master_port"]))
 			response.WriteString(fmt.Sprintf("master_link_status:%s\r\n", info["master_link_status"]))
 			response.WriteString(fmt.Sprintf("slave_repl_offset:%d\r\n", info["slave_repl_offset"]))
+			response.WriteString(fmt.Sprintf("slave_priority:%d\r\n", info["slave_priority"]))
 			if replid, ok := info["master_replid"].(string); ok && replid != "" {
 				response.WriteString(fmt.Sprintf("master_replid:%s\r\n", replid))
 			}
@@ -271,6 +389,12 @@ func handleReplicaOf(writer *bufio.Writer, args []string, rm *replication.Replic
 		return
 	}
 
+	// Refuse to replicate from ourselves or from one of our own replicas
+	if err := rm.ValidateMasterAddress(host, port); err != nil {
+		writeError(writer, err.Error())
+		return
+	}
+
 	// Connect to master
 	err = rm.ConnectToMaster(host, port)
 	if err != nil {
@@ -324,75 +448,9 @@ func generateRDB(rm *replication.ReplicationManager) []byte {
 	writeLength(buf, len(data))
 	writeLength(buf, 0) // Expires hash table size
 
-	// Write all key-value pairs
+	// Write all key-value pairs through the shared RDB encoder
 	for key, value := range data {
-		// Check if value has expiry
-		if value.ExpiresAt != nil && value.ExpiresAt.After(time.Now()) {
-			// Write expiry in milliseconds
-			buf.WriteByte(0xFC) // RDB_OPCODE_EXPIRETIME_MS
-			expiryMs := value.ExpiresAt.UnixNano() / int64(time.Millisecond)
-			binary.Write(buf, binary.LittleEndian, uint64(expiryMs))
-		}
-
-		// Write value based on type
-		switch value.Type {
-		case storage.StringType:
-			// String type
-			buf.WriteByte(0) // RDB_TYPE_STRING
-			writeString(buf, key)
-			if str, ok := value.Data.(string); ok {
-				writeString(buf, str)
-			} else {
-				writeString(buf, fmt.Sprintf("%v", value.Data))
-			}
-
-		case storage.ListType:
-			// List type
-			buf.WriteByte(1) // RDB_TYPE_LIST
-			writeString(buf, key)
-			if list, ok := value.Data.([]string); ok {
-				writeLength(buf, len(list))
-				for _, item := range list {
-					writeString(buf, item)
-				}
-			}
-
-		case storage.SetType:
-			// Set type
-			buf.WriteByte(2) // RDB_TYPE_SET
-			writeString(buf, key)
-			if set, ok := value.Data.(map[string]struct{}); ok {
-				writeLength(buf, len(set))
-				for member := range set {
-					writeString(buf, member)
-				}
-			}
-
-		case storage.HashType:
-			// Hash type
-			buf.WriteByte(4) // RDB_TYPE_HASH
-			writeString(buf, key)
-			if hash, ok := value.Data.(map[string]string); ok {
-				writeLength(buf, len(hash))
-				for field, val := range hash {
-					writeString(buf, field)
-					writeString(buf, val)
-				}
-			}
-
-		case storage.ZSetType:
-			// Sorted set type
-			buf.WriteByte(3) // RDB_TYPE_ZSET
-			writeString(buf, key)
-			// For ZSet, we need special handling as it has scores
-			// Simplified: just write count as 0 for now
-			writeLength(buf, 0)
-
-		default:
-			// Unknown type, skip
-			log.Printf("[REPLICATION] Skipping unknown type for key %s: %v", key, value.Type)
-			continue
-		}
+		rdb.WriteEntry(buf, key, value)
 	}
 
 	// EOF opcode
@@ -433,12 +491,6 @@ func writeLength(buf *bytes.Buffer, length int) {
 	}
 }
 
-// writeString writes a length-prefixed string to RDB
-func writeString(buf *bytes.Buffer, s string) {
-	writeLength(buf, len(s))
-	buf.WriteString(s)
-}
-
 // generateEmptyRDB generates an empty RDB file
 // This is a minimal RDB file that represents an empty database
 func generateEmptyRDB() []byte {
@@ -509,7 +561,7 @@ func HandleReplicationCommand(conn net.Conn, reader *bufio.Reader, writer *bufio
 
 	case "INFO":
 		// Display server and replication information
-		handleInfo(writer, args, rm)
+		handleInfo(writer, args, rm, handler)
 		return true
 
 	case "REPLICAOF", "SLAVEOF":
@@ -96,6 +96,7 @@ func (h *CommandHandler) handleSMembers(cmd *protocol.Command) []byte {
 	procCmd := &processor.Command{
 		Type:     processor.CmdSMembers,
 		Key:      key,
+		Ctx:      cmd.Context(),
 		Response: make(chan interface{}, 1),
 	}
 
@@ -148,7 +149,7 @@ func (h *CommandHandler) handleSPop(cmd *protocol.Command) []byte {
 			return protocol.EncodeError("ERR value is not an integer or out of range")
 		}
 		if count < 0 {
-			return protocol.EncodeError("ERR value is negative")
+			return protocol.EncodeError("ERR value is out of range, must be positive")
 		}
 		returnSingle = false
 	}
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"redis/internal/protocol"
+	"redis/internal/replication"
+)
+
+// ==================== SHUTDOWN FAILOVER ====================
+// SHUTDOWN FAILOVER hands the master role to a replica before the server
+// exits, so a planned stop doesn't cost a down-after period of failed writes:
+//
+//  1. Writes are refused from here on (TRYAGAIN), the master stops changing
+//  2. The master waits for a promotable replica to acknowledge its offset
+//  3. The RDB snapshot is saved as for any SHUTDOWN
+//  4. That replica gets REPLICAOF NO ONE; the other replicas are pointed at it
+//  5. The server shuts down
+//
+// Sentinels notice the promotion when the master goes down: a replica that
+// already reports role master is adopted at once (see adoptPromotedReplica).
+// If no replica catches up before the timeout, or none can be promoted,
+// SHUTDOWN fails, writes are accepted again and the server keeps running.
+
+// defaultFailoverTimeout bounds the wait for a replica when SHUTDOWN FAILOVER
+// is given no TIMEOUT
+const defaultFailoverTimeout = 10 * time.Second
+
+// failoverDialTimeout bounds a command sent to a replica, connection included
+const failoverDialTimeout = 5 * time.Second
+
+// errFailoverInProgress is returned for writes refused while SHUTDOWN FAILOVER runs
+const errFailoverInProgress = "TRYAGAIN Failover in progress, writes are temporarily rejected"
+
+// isWriteRejectedDuringFailover checks if a write must be refused because
+// SHUTDOWN FAILOVER is moving the master role to a replica
+func (h *CommandHandler) isWriteRejectedDuringFailover(command string) bool {
+	return h.failoverInProgress.Load() && isGatedWrite(command)
+}
+
+// failoverCandidate is a replica that may be promoted, at its advertised address
+type failoverCandidate struct {
+	replica   *replication.ReplicaInfo
+	host      string
+	port      int
+	ackOffset int64 // Offset acknowledged once caught up
+}
+
+// awaitFailoverTarget waits until a promotable replica acknowledged every
+// write made so far, or until timeout elapses, and returns the caught-up
+// candidates, most advanced first. Writes must already be refused
+func (h *CommandHandler) awaitFailoverTarget(timeout time.Duration) ([]failoverCandidate, error) {
+	replMgr, _ := h.replicationMgr.(*replication.ReplicationManager)
+	if replMgr == nil || h.isReplica() {
+		return nil, fmt.Errorf("ERR FAILOVER is only allowed on a master")
+	}
+	deadline := time.Now().Add(timeout)
+
+	// Replicas configured with priority 0 must never be promoted
+	var candidates []failoverCandidate
+	for _, replica := range replMgr.GetAllReplicas() {
+		if _, online := replMgr.ReplicaAckOffset(replica.ID); !online {
+			continue
+		}
+		host, port := replica.AdvertisedAddr()
+		info, err := queryReplica(min(failoverDialTimeout, time.Until(deadline)), host, port, "INFO", "replication")
+		if err != nil {
+			log.Printf("[FAILOVER] Replica %s:%d unreachable: %v", host, port, err)
+			continue
+		}
+		if priority, ok := infoField(info, "slave_priority"); ok && priority == "0" {
+			continue
+		}
+		candidates = append(candidates, failoverCandidate{replica: replica, host: host, port: port})
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("ERR FAILOVER requires a connected replica that can be promoted")
+	}
+
+	// Offset every write made before writes were refused ends at, once the
+	// writes still in flight when failover started were propagated
+	h.drainWriteGate()
+	ackCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	target, err := replMgr.RequestAck(ackCtx)
+	if err != nil {
+		return nil, fmt.Errorf("ERR FAILOVER timed out waiting for a replica to catch up")
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		var caughtUp []failoverCandidate
+		for _, c := range candidates {
+			if acked, online := replMgr.ReplicaAckOffset(c.replica.ID); online && acked >= target {
+				c.ackOffset = acked
+				caughtUp = append(caughtUp, c)
+			}
+		}
+		if len(caughtUp) > 0 {
+			sort.SliceStable(caughtUp, func(i, j int) bool {
+				return caughtUp[i].ackOffset > caughtUp[j].ackOffset
+			})
+			return caughtUp, nil
+		}
+
+		select {
+		case <-timer.C:
+			return nil, fmt.Errorf("ERR FAILOVER timed out waiting for a replica to catch up")
+		case <-ticker.C:
+		}
+	}
+}
+
+// promoteFailoverTarget promotes the first candidate that accepts REPLICAOF
+// NO ONE and points every other replica at it
+func (h *CommandHandler) promoteFailoverTarget(candidates []failoverCandidate) error {
+	var promoted *failoverCandidate
+	for i := range candidates {
+		c := &candidates[i]
+		if reply, err := queryReplica(failoverDialTimeout, c.host, c.port, "REPLICAOF", "NO", "ONE"); err != nil || reply != "OK" {
+			log.Printf("[FAILOVER] Failed to promote %s:%d: %v %s", c.host, c.port, err, reply)
+			continue
+		}
+		promoted = c
+		break
+	}
+	if promoted == nil {
+		return fmt.Errorf("ERR FAILOVER could not promote any replica")
+	}
+	log.Printf("[FAILOVER] Promoted replica %s:%d to master", promoted.host, promoted.port)
+
+	// Best effort: a replica that misses this is fixed up by Sentinel, or
+	// keeps retrying its old master until reconfigured
+	replMgr := h.replicationMgr.(*replication.ReplicationManager)
+	for _, replica := range replMgr.GetAllReplicas() {
+		if replica == promoted.replica {
+			continue
+		}
+		host, port := replica.AdvertisedAddr()
+		if reply, err := queryReplica(failoverDialTimeout, host, port, "REPLICAOF", promoted.host, strconv.Itoa(promoted.port)); err != nil || reply != "OK" {
+			log.Printf("[FAILOVER] Failed to point %s:%d at the new master: %v %s", host, port, err, reply)
+		}
+	}
+	return nil
+}
+
+// queryReplica sends one command to another server and returns the simple
+// string or bulk string it replies with, giving up after timeout
+// An error reply is returned as an error
+func queryReplica(timeout time.Duration, host string, port int, args ...string) (string, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write(protocol.EncodeArray(args)); err != nil {
+		return "", err
+	}
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("%s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("unexpected reply %q", line)
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	}
+	return "", fmt.Errorf("unexpected reply %q", line)
+}
+
+// infoField returns the value of field in an INFO reply
+func infoField(info, field string) (string, bool) {
+	for _, line := range strings.Split(info, "\r\n") {
+		if name, value, found := strings.Cut(line, ":"); found && name == field {
+			return value, true
+		}
+	}
+	return "", false
+}
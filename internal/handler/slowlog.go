@@ -1,19 +1,28 @@
 package handler
 
 import (
+	"fmt"
 	"log"
 	"sync"
 	"time"
 )
 
+// Default limits on the arguments kept per slow log entry (same as Redis)
+const (
+	DefaultSlowLogMaxArgs   = 32  // Arguments kept, command name included
+	DefaultSlowLogMaxArgLen = 128 // Bytes kept of each argument
+)
+
 // SlowLogEntry represents a slow command entry
 type SlowLogEntry struct {
-	ID        int64
-	Timestamp time.Time
-	Duration  time.Duration
-	ClientID  int64
-	Command   string
-	Args      []string
+	ID         int64
+	Timestamp  time.Time
+	Duration   time.Duration
+	ClientID   int64
+	ClientAddr string
+	ClientName string // Set by CLIENT SETNAME or HELLO SETNAME when the command ran
+	Command    string
+	Args       []string // Truncated to the slow log's argument limits
 }
 
 // SlowLog tracks slow commands like Redis SLOWLOG
@@ -23,6 +32,8 @@ type SlowLog struct {
 	maxLen    int
 	threshold time.Duration
 	idCounter int64
+	maxArgs   int // Arguments kept per entry, command name included
+	maxArgLen int // Bytes kept of each argument
 }
 
 // NewSlowLog creates a new slow log with given max entries and threshold
@@ -31,12 +42,28 @@ func NewSlowLog(maxLen int, threshold time.Duration) *SlowLog {
 		entries:   make([]SlowLogEntry, 0, maxLen),
 		maxLen:    maxLen,
 		threshold: threshold,
+		maxArgs:   DefaultSlowLogMaxArgs,
+		maxArgLen: DefaultSlowLogMaxArgLen,
+	}
+}
+
+// SetArgLimits sets how many arguments (command name included) and how many
+// bytes of each argument are kept per entry; values <= 0 keep the default
+func (s *SlowLog) SetArgLimits(maxArgs, maxArgLen int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if maxArgs > 0 {
+		s.maxArgs = maxArgs
+	}
+	if maxArgLen > 0 {
+		s.maxArgLen = maxArgLen
 	}
 }
 
 // LogIfSlow logs a command if it exceeds the threshold
 // Returns true if the command was slow
-func (s *SlowLog) LogIfSlow(clientID int64, command string, args []string, duration time.Duration) bool {
+func (s *SlowLog) LogIfSlow(clientID int64, clientAddr, clientName string, command string, args []string, duration time.Duration) bool {
 	if duration < s.threshold {
 		return false
 	}
@@ -46,12 +73,14 @@ func (s *SlowLog) LogIfSlow(clientID int64, command string, args []string, durat
 
 	s.idCounter++
 	entry := SlowLogEntry{
-		ID:        s.idCounter,
-		Timestamp: time.Now(),
-		Duration:  duration,
-		ClientID:  clientID,
-		Command:   command,
-		Args:      args,
+		ID:         s.idCounter,
+		Timestamp:  time.Now(),
+		Duration:   duration,
+		ClientID:   clientID,
+		ClientAddr: clientAddr,
+		ClientName: clientName,
+		Command:    command,
+		Args:       s.truncateArgs(args),
 	}
 
 	// Add to front (newest first)
@@ -66,6 +95,33 @@ func (s *SlowLog) LogIfSlow(clientID int64, command string, args []string, durat
 	return true
 }
 
+// truncateArgs copies args within the argument limits, so an entry never
+// keeps a large request alive or exposes more of its values than needed
+// Like Redis, a dropped tail is replaced by "... (N more arguments)" and a
+// cut argument ends with "... (N more bytes)"
+func (s *SlowLog) truncateArgs(args []string) []string {
+	// The command name counts towards maxArgs
+	kept := len(args)
+	if kept+1 > s.maxArgs {
+		kept = s.maxArgs - 2
+		if kept < 0 {
+			kept = 0
+		}
+	}
+
+	result := make([]string, 0, kept+1)
+	for _, arg := range args[:kept] {
+		if len(arg) > s.maxArgLen {
+			arg = fmt.Sprintf("%s... (%d more bytes)", arg[:s.maxArgLen], len(arg)-s.maxArgLen)
+		}
+		result = append(result, arg)
+	}
+	if kept < len(args) {
+		result = append(result, fmt.Sprintf("... (%d more arguments)", len(args)-kept))
+	}
+	return result
+}
+
 // Get returns the last n slow log entries
 func (s *SlowLog) Get(count int) []SlowLogEntry {
 	s.mu.RLock()
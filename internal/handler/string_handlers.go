@@ -1,15 +1,27 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
 	"time"
 
 	"redis/internal/processor"
 	"redis/internal/protocol"
+	"redis/internal/storage"
 )
 
+// handlePing handles PING [message]
+// With a message it is echoed back as a bulk string, so probes can be correlated
 func (h *CommandHandler) handlePing(cmd *protocol.Command) []byte {
-	if len(cmd.Args) > 1 {
+	if len(cmd.Args) > 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'ping' command")
+	}
+	if len(cmd.Args) == 2 {
 		return protocol.EncodeBulkString(cmd.Args[1])
 	}
 	return protocol.EncodeSimpleString("PONG")
@@ -22,6 +34,12 @@ func (h *CommandHandler) handleEcho(cmd *protocol.Command) []byte {
 	return protocol.EncodeBulkString(cmd.Args[1])
 }
 
+// handleSet handles SET key value [NX | XX] [GET] [EX seconds | PX milliseconds |
+// EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL] [NEGATIVE]
+// NEGATIVE stores a short-lived negative-cache tombstone: GET answers it with
+// a NEGATIVE error instead of the value, while other commands see the value
+// With NX it lets the first client that misses an absent key claim it
+// atomically, so concurrent misses don't all hit the backing store
 func (h *CommandHandler) handleSet(cmd *protocol.Command) []byte {
 	if len(cmd.Args) < 3 {
 		return protocol.EncodeError("ERR wrong number of arguments for 'set' command")
@@ -30,34 +48,202 @@ func (h *CommandHandler) handleSet(cmd *protocol.Command) []byte {
 	key := cmd.Args[1]
 	value := cmd.Args[2]
 
+	opts, absolute, err := parseSetOptions(cmd.Args[3:])
+	if err != nil {
+		return protocol.EncodeError(err.Error())
+	}
+	// EXAT/PXAT deadlines are kept exact; only relative TTLs are jittered
+	if opts.Expiry != nil && !absolute {
+		jittered := h.applyExpireJitter(cmd.Context(), *opts.Expiry)
+		opts.Expiry = &jittered
+	}
+
 	procCmd := &processor.Command{
 		Type:     processor.CmdSet,
 		Key:      key,
 		Value:    value,
+		Args:     []interface{}{opts},
 		Response: make(chan interface{}, 1),
 	}
 	h.processor.Submit(procCmd)
-	<-procCmd.Response
 
+	if opts.Get {
+		res := (<-procCmd.Response).(processor.IndexResult)
+		if res.Err != nil {
+			return protocol.EncodeError(res.Err.Error())
+		}
+		if !res.Exists {
+			return protocol.EncodeNullBulkString()
+		}
+		return protocol.EncodeBulkString(res.Value)
+	}
+
+	written := (<-procCmd.Response).(bool)
+
+	if !written {
+		return protocol.EncodeNullBulkString()
+	}
 	return protocol.EncodeSimpleString("OK")
 }
 
+// parseSetOptions parses the options following SET key value
+// absolute reports whether the expiry was given as a deadline (EXAT/PXAT)
+// rather than a TTL (EX/PX)
+func parseSetOptions(args []string) (opts storage.SetOptions, absolute bool, err error) {
+	hasExpiry := false
+
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			if opts.XX {
+				return opts, false, errSyntax
+			}
+			opts.NX = true
+		case "XX":
+			if opts.NX {
+				return opts, false, errSyntax
+			}
+			opts.XX = true
+		case "KEEPTTL":
+			if hasExpiry {
+				return opts, false, errSyntax
+			}
+			opts.KeepTTL = true
+		case "GET":
+			opts.Get = true
+		case "NEGATIVE":
+			opts.Negative = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExpiry || opts.KeepTTL || i+1 >= len(args) {
+				return opts, false, errSyntax
+			}
+			option := strings.ToUpper(args[i])
+			unit := time.Second
+			if option == "PX" || option == "PXAT" {
+				unit = time.Millisecond
+			}
+			absolute = option == "EXAT" || option == "PXAT"
+
+			var expiry time.Time
+			if absolute {
+				expiry, err = parseExpireAtTime(args[i+1], unit, "set")
+			} else {
+				expiry, err = parseExpireTime(args[i+1], unit, "set")
+			}
+			if err != nil {
+				return opts, false, err
+			}
+			opts.Expiry = &expiry
+			hasExpiry = true
+			i++
+		default:
+			return opts, false, errSyntax
+		}
+	}
+
+	// A tombstone must expire, or the key would read as absent forever
+	if opts.Negative && !hasExpiry {
+		return opts, false, errors.New("ERR NEGATIVE requires EX, PX, EXAT or PXAT")
+	}
+
+	return opts, absolute, nil
+}
+
+// negativeCacheReply is the GET reply for a key written with SET ... NEGATIVE
+const negativeCacheReply = "NEGATIVE key is cached as absent"
+
+// errSyntax is the generic Redis syntax error
+var errSyntax = errors.New("ERR syntax error")
+
+// parseExpireTime parses a relative TTL argument (in the given unit) into an absolute deadline
+// Shared by SET EX/PX, SETEX and PSETEX so they validate TTLs identically
+func parseExpireTime(arg string, unit time.Duration, command string) (time.Time, error) {
+	ttl, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("ERR value is not an integer or out of range")
+	}
+
+	// Reject non-positive TTLs and values whose duration would overflow
+	if ttl <= 0 || ttl > math.MaxInt64/int64(unit) {
+		return time.Time{}, fmt.Errorf("ERR invalid expire time in '%s' command", command)
+	}
+
+	return time.Now().Add(time.Duration(ttl) * unit), nil
+}
+
+// parseExpireAtTime parses an absolute Unix time argument (in seconds or
+// milliseconds, per unit) into a deadline, validated like parseExpireTime
+// A deadline already in the past is accepted; the key then expires at once
+func parseExpireAtTime(arg string, unit time.Duration, command string) (time.Time, error) {
+	at, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("ERR value is not an integer or out of range")
+	}
+
+	// Reject non-positive times and values whose nanoseconds would overflow
+	if at <= 0 || at > math.MaxInt64/int64(unit) {
+		return time.Time{}, fmt.Errorf("ERR invalid expire time in '%s' command", command)
+	}
+
+	return time.Unix(0, at*int64(unit)), nil
+}
+
+// applyExpireJitter applies expiry jitter to the deadline of a relative TTL
+// and records the result in ctx, so the write propagates this exact deadline
+func (h *CommandHandler) applyExpireJitter(ctx context.Context, expiry time.Time) time.Time {
+	expiry = h.jitterExpiry(expiry)
+	recordAppliedExpiry(ctx, expiry)
+	return expiry
+}
+
+// jitterExpiry randomly moves expiry by up to ±expire-jitter-percentage of
+// the remaining TTL, so keys written with the same TTL don't all expire at once
+// The jittered TTL never drops below 1ms
+// A replica applies the deadlines its master sent and never jitters
+func (h *CommandHandler) jitterExpiry(expiry time.Time) time.Time {
+	if h.expireJitterPercent <= 0 || h.isReplica() {
+		return expiry
+	}
+
+	now := time.Now()
+	ttl := expiry.Sub(now)
+	if ttl <= 0 {
+		return expiry
+	}
+
+	spread := float64(ttl) * float64(h.expireJitterPercent) / 100
+	jittered := ttl + time.Duration((rand.Float64()*2-1)*spread)
+	if jittered < time.Millisecond {
+		jittered = time.Millisecond
+	}
+	return now.Add(jittered)
+}
+
+// handleSetEx handles SETEX key seconds value
 func (h *CommandHandler) handleSetEx(cmd *protocol.Command) []byte {
-	if len(cmd.Args) < 4 {
-		return protocol.EncodeError("ERR wrong number of arguments for 'setex' command")
+	return h.setWithTTL(cmd, time.Second, "setex")
+}
+
+// handlePSetEx handles PSETEX key milliseconds value
+func (h *CommandHandler) handlePSetEx(cmd *protocol.Command) []byte {
+	return h.setWithTTL(cmd, time.Millisecond, "psetex")
+}
+
+// setWithTTL implements SETEX/PSETEX, which differ only in the TTL unit
+func (h *CommandHandler) setWithTTL(cmd *protocol.Command, unit time.Duration, command string) []byte {
+	if len(cmd.Args) != 4 {
+		return protocol.EncodeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", command))
 	}
 
 	key := cmd.Args[1]
-	seconds := cmd.Args[2]
 	value := cmd.Args[3]
 
-	// Parse seconds
-	var sec int
-	if _, err := fmt.Sscanf(seconds, "%d", &sec); err != nil || sec <= 0 {
-		return protocol.EncodeError("ERR invalid expire time in 'setex' command")
+	expiry, err := parseExpireTime(cmd.Args[2], unit, command)
+	if err != nil {
+		return protocol.EncodeError(err.Error())
 	}
+	expiry = h.applyExpireJitter(cmd.Context(), expiry)
 
-	expiry := time.Now().Add(time.Duration(sec) * time.Second)
 	procCmd := &processor.Command{
 		Type:     processor.CmdSet,
 		Key:      key,
@@ -92,6 +278,12 @@ func (h *CommandHandler) handleGet(cmd *protocol.Command) []byte {
 		return protocol.EncodeNullBulkString()
 	}
 
+	// A tombstone answers with its own error so the caller can tell a cached
+	// miss from a key that was never looked up
+	if res.Negative {
+		return protocol.EncodeError(negativeCacheReply)
+	}
+
 	if str, ok := res.Value.(string); ok {
 		return protocol.EncodeBulkString(str)
 	}
@@ -121,43 +313,133 @@ func (h *CommandHandler) handleDel(cmd *protocol.Command) []byte {
 	return protocol.EncodeInteger(count)
 }
 
+// handleExists handles EXISTS key [key ...]
+// Keys named more than once are counted once per occurrence, like Redis.
+// All keys are checked in a single processor operation so the count is consistent
 func (h *CommandHandler) handleExists(cmd *protocol.Command) []byte {
 	if len(cmd.Args) < 2 {
 		return protocol.EncodeError("ERR wrong number of arguments for 'exists' command")
 	}
 
-	count := 0
-	for i := 1; i < len(cmd.Args); i++ {
-		procCmd := &processor.Command{
-			Type:     processor.CmdExists,
-			Key:      cmd.Args[i],
-			Response: make(chan interface{}, 1),
-		}
-		h.processor.Submit(procCmd)
-		result := <-procCmd.Response
-		if result.(bool) {
-			count++
-		}
+	procCmd := &processor.Command{
+		Type:     processor.CmdExists,
+		Args:     []interface{}{cmd.Args[1:]},
+		Response: make(chan interface{}, 1),
 	}
+	h.processor.Submit(procCmd)
+	count := (<-procCmd.Response).(int)
 
 	return protocol.EncodeInteger(count)
 }
 
+// handleKeys returns the keys matching a glob-style pattern
+// KEYS pattern - supports *, ?, [...] classes and \ escapes
 func (h *CommandHandler) handleKeys(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'keys' command")
+	}
+
 	procCmd := &processor.Command{
 		Type:     processor.CmdKeys,
+		Args:     []interface{}{cmd.Args[1]},
+		Ctx:      cmd.Context(),
 		Response: make(chan interface{}, 1),
 	}
 	h.processor.Submit(procCmd)
 	result := <-procCmd.Response
 
-	keys := result.([]string)
-	return protocol.EncodeArray(keys)
+	keysResult := result.(processor.StringSliceResult)
+	if keysResult.Err != nil {
+		return protocol.EncodeError(keysResult.Err.Error())
+	}
+	return protocol.EncodeArray(keysResult.Result)
+}
+
+// handleScan handles SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+// Every key that exists for the whole iteration is returned at least once,
+// even if the keyspace grows or shrinks between calls
+func (h *CommandHandler) handleScan(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'scan' command")
+	}
+
+	cursor, err := strconv.ParseUint(cmd.Args[1], 10, 64)
+	if err != nil {
+		return protocol.EncodeError("ERR invalid cursor")
+	}
+
+	pattern, count, typeName := "*", 10, ""
+	for i := 2; i < len(cmd.Args); i += 2 {
+		if i+1 >= len(cmd.Args) {
+			return protocol.EncodeError("ERR syntax error")
+		}
+		value := cmd.Args[i+1]
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "MATCH":
+			pattern = value
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return protocol.EncodeError("ERR value is not an integer or out of range")
+			}
+			if n < 1 {
+				return protocol.EncodeError("ERR syntax error")
+			}
+			count = n
+		case "TYPE":
+			typeName = strings.ToLower(value)
+		default:
+			return protocol.EncodeError("ERR syntax error")
+		}
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdScan,
+		Args:     []interface{}{cursor, pattern, count, typeName},
+		Ctx:      cmd.Context(),
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	result := (<-procCmd.Response).(processor.ScanResult)
+	if result.Err != nil {
+		return protocol.EncodeError(result.Err.Error())
+	}
+
+	return protocol.EncodeRawArray([][]byte{
+		protocol.EncodeBulkString(strconv.FormatUint(result.Cursor, 10)),
+		protocol.EncodeArray(result.Keys),
+	})
 }
 
+// handleDBSize handles DBSIZE
+func (h *CommandHandler) handleDBSize(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 1 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'dbsize' command")
+	}
+	keys, _ := h.processor.KeyspaceSize()
+	return protocol.EncodeInteger(keys)
+}
+
+// handleFlushAll handles FLUSHALL [ASYNC | SYNC] and FLUSHDB [ASYNC | SYNC]
+// ASYNC replies as soon as the empty keyspace is in place and frees the old one in the background
 func (h *CommandHandler) handleFlushAll(cmd *protocol.Command) []byte {
+	async := false
+	if len(cmd.Args) > 2 {
+		return protocol.EncodeError("ERR syntax error")
+	}
+	if len(cmd.Args) == 2 {
+		switch strings.ToUpper(cmd.Args[1]) {
+		case "ASYNC":
+			async = true
+		case "SYNC":
+		default:
+			return protocol.EncodeError("ERR syntax error")
+		}
+	}
+
 	procCmd := &processor.Command{
 		Type:     processor.CmdFlush,
+		Args:     []interface{}{async},
 		Response: make(chan interface{}, 1),
 	}
 	h.processor.Submit(procCmd)
@@ -166,29 +448,34 @@ func (h *CommandHandler) handleFlushAll(cmd *protocol.Command) []byte {
 	return protocol.EncodeSimpleString("OK")
 }
 
-func (h *CommandHandler) handleCommand(cmd *protocol.Command) []byte {
-	return protocol.EncodeArray([]string{})
-}
-
+// handleExpire handles EXPIRE key seconds [SLIDING]
 func (h *CommandHandler) handleExpire(cmd *protocol.Command) []byte {
 	if len(cmd.Args) < 3 {
 		return protocol.EncodeError("ERR wrong number of arguments for 'expire' command")
 	}
 
 	key := cmd.Args[1]
-	seconds := cmd.Args[2]
+	deadline, err := parseExpireTime(cmd.Args[2], time.Second, "expire")
+	if err != nil {
+		return protocol.EncodeError(err.Error())
+	}
 
-	// Parse seconds
-	var sec int
-	if _, err := fmt.Sscanf(seconds, "%d", &sec); err != nil || sec <= 0 {
-		return protocol.EncodeError("ERR invalid expire time in 'expire' command")
+	// EXPIRE key seconds SLIDING makes every GET extend the TTL back to seconds
+	var args []interface{}
+	if len(cmd.Args) > 3 {
+		if len(cmd.Args) != 4 || strings.ToUpper(cmd.Args[3]) != "SLIDING" {
+			return protocol.EncodeError("ERR syntax error")
+		}
+		sec, _ := strconv.ParseInt(cmd.Args[2], 10, 64) // Validated by parseExpireTime
+		args = []interface{}{time.Duration(sec) * time.Second}
 	}
 
-	expiry := time.Now().Add(time.Duration(sec) * time.Second)
+	expiry := h.applyExpireJitter(cmd.Context(), deadline)
 	procCmd := &processor.Command{
 		Type:     processor.CmdExpire,
 		Key:      key,
 		Expiry:   &expiry,
+		Args:     args,
 		Response: make(chan interface{}, 1),
 	}
 	h.processor.Submit(procCmd)
@@ -200,6 +487,48 @@ func (h *CommandHandler) handleExpire(cmd *protocol.Command) []byte {
 	return protocol.EncodeInteger(0) // Key doesn't exist
 }
 
+// handlePExpireAt handles PEXPIREAT key unix-time-milliseconds [SLIDING window-milliseconds]
+// Relative expiries are logged and replicated in this form, so it applies the
+// deadline as is, without expiry jitter; a deadline in the past deletes the key
+// SLIDING carries the window of EXPIRE ... SLIDING, so copies keep the key sliding
+func (h *CommandHandler) handlePExpireAt(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 && len(cmd.Args) != 5 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'pexpireat' command")
+	}
+
+	ms, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+	if err != nil {
+		return protocol.EncodeError("ERR value is not an integer or out of range")
+	}
+
+	var args []interface{}
+	if len(cmd.Args) == 5 {
+		if strings.ToUpper(cmd.Args[3]) != "SLIDING" {
+			return protocol.EncodeError("ERR syntax error")
+		}
+		window, err := strconv.ParseInt(cmd.Args[4], 10, 64)
+		if err != nil || window <= 0 || window > math.MaxInt64/int64(time.Millisecond) {
+			return protocol.EncodeError("ERR invalid expire time in 'pexpireat' command")
+		}
+		args = []interface{}{time.Duration(window) * time.Millisecond}
+	}
+
+	expiry := time.UnixMilli(ms)
+	procCmd := &processor.Command{
+		Type:     processor.CmdExpire,
+		Key:      cmd.Args[1],
+		Expiry:   &expiry,
+		Args:     args,
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+
+	if (<-procCmd.Response).(bool) {
+		return protocol.EncodeInteger(1)
+	}
+	return protocol.EncodeInteger(0)
+}
+
 func (h *CommandHandler) handleTTL(cmd *protocol.Command) []byte {
 	if len(cmd.Args) < 2 {
 		return protocol.EncodeError("ERR wrong number of arguments for 'ttl' command")
@@ -234,12 +563,7 @@ func (h *CommandHandler) handleIncr(cmd *protocol.Command) []byte {
 	h.processor.Submit(procCmd)
 	result := <-procCmd.Response
 
-	res := result.(processor.Int64Result)
-	if res.Err != nil {
-		return protocol.EncodeError(fmt.Sprintf("ERR %v", res.Err))
-	}
-
-	return protocol.EncodeInteger(int(res.Result))
+	return encodeIncrResult(result.(processor.Int64Result))
 }
 
 func (h *CommandHandler) handleIncrBy(cmd *protocol.Command) []byte {
@@ -265,8 +589,113 @@ func (h *CommandHandler) handleIncrBy(cmd *protocol.Command) []byte {
 	h.processor.Submit(procCmd)
 	result := <-procCmd.Response
 
-	res := result.(processor.Int64Result)
+	return encodeIncrResult(result.(processor.Int64Result))
+}
+
+// handleAppend handles APPEND key value
+// Returns the length of the string after the append, in bytes
+func (h *CommandHandler) handleAppend(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 3 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'append' command")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdAppend,
+		Key:      cmd.Args[1],
+		Value:    cmd.Args[2],
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	return encodeInt64Result((<-procCmd.Response).(processor.Int64Result))
+}
+
+// handleStrLen handles STRLEN key
+// The length is in bytes, so multibyte and binary values are counted exactly
+func (h *CommandHandler) handleStrLen(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 2 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'strlen' command")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdStrLen,
+		Key:      cmd.Args[1],
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	return encodeInt64Result((<-procCmd.Response).(processor.Int64Result))
+}
+
+// handleGetRange handles GETRANGE key start end (and its old name SUBSTR)
+// Offsets are byte offsets; negative ones count from the end of the string
+func (h *CommandHandler) handleGetRange(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 4 {
+		return protocol.EncodeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Args[0])))
+	}
+
+	start, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+	if err != nil {
+		return protocol.EncodeError("ERR value is not an integer or out of range")
+	}
+	end, err := strconv.ParseInt(cmd.Args[3], 10, 64)
+	if err != nil {
+		return protocol.EncodeError("ERR value is not an integer or out of range")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdGetRange,
+		Key:      cmd.Args[1],
+		Args:     []interface{}{start, end},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	res := (<-procCmd.Response).(processor.StringResult)
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return protocol.EncodeBulkString(res.Result)
+}
+
+// handleSetRange handles SETRANGE key offset value
+// Returns the length of the string after the write, in bytes
+func (h *CommandHandler) handleSetRange(cmd *protocol.Command) []byte {
+	if len(cmd.Args) != 4 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'setrange' command")
+	}
+
+	offset, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+	if err != nil {
+		return protocol.EncodeError("ERR value is not an integer or out of range")
+	}
+	if offset < 0 {
+		return protocol.EncodeError("ERR offset is out of range")
+	}
+
+	procCmd := &processor.Command{
+		Type:     processor.CmdSetRange,
+		Key:      cmd.Args[1],
+		Value:    cmd.Args[3],
+		Args:     []interface{}{offset},
+		Response: make(chan interface{}, 1),
+	}
+	h.processor.Submit(procCmd)
+	return encodeInt64Result((<-procCmd.Response).(processor.Int64Result))
+}
+
+// encodeInt64Result encodes an integer reply, or the error it carries
+func encodeInt64Result(res processor.Int64Result) []byte {
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return protocol.EncodeInteger64(res.Result)
+}
+
+// encodeIncrResult encodes the reply shared by INCR/INCRBY/DECR/DECRBY
+func encodeIncrResult(res processor.Int64Result) []byte {
 	if res.Err != nil {
+		// Overflow errors already carry their own prefix
+		if errors.Is(res.Err, storage.ErrIncrOverflow) {
+			return protocol.EncodeError(res.Err.Error())
+		}
 		return protocol.EncodeError(fmt.Sprintf("ERR %v", res.Err))
 	}
 
@@ -288,12 +717,7 @@ func (h *CommandHandler) handleDecr(cmd *protocol.Command) []byte {
 	h.processor.Submit(procCmd)
 	result := <-procCmd.Response
 
-	res := result.(processor.Int64Result)
-	if res.Err != nil {
-		return protocol.EncodeError(fmt.Sprintf("ERR %v", res.Err))
-	}
-
-	return protocol.EncodeInteger(int(res.Result))
+	return encodeIncrResult(result.(processor.Int64Result))
 }
 
 func (h *CommandHandler) handleDecrBy(cmd *protocol.Command) []byte {
@@ -319,10 +743,5 @@ func (h *CommandHandler) handleDecrBy(cmd *protocol.Command) []byte {
 	h.processor.Submit(procCmd)
 	result := <-procCmd.Response
 
-	res := result.(processor.Int64Result)
-	if res.Err != nil {
-		return protocol.EncodeError(fmt.Sprintf("ERR %v", res.Err))
-	}
-
-	return protocol.EncodeInteger(int(res.Result))
+	return encodeIncrResult(result.(processor.Int64Result))
 }
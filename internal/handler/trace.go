@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"redis/internal/protocol"
+)
+
+// TraceHook is notified around every command a client connection runs, e.g.
+// to emit tracing spans or custom latency metrics
+// Calls come from the connection goroutines, so implementations must be safe
+// for concurrent use
+type TraceHook interface {
+	// BeforeCommand is called before the command runs; the returned context
+	// (e.g. carrying a span) is passed to AfterCommand and to the command
+	BeforeCommand(ctx context.Context, command, key string) context.Context
+
+	// AfterCommand is called once the reply is ready; err is set when the
+	// reply is an error or the command failed (e.g. timed out)
+	AfterCommand(ctx context.Context, command, key string, duration time.Duration, err error)
+}
+
+// SetTraceHook installs the hook called around every client command (nil
+// disables tracing)
+// It must be set before the server starts accepting connections
+func (h *CommandHandler) SetTraceHook(hook TraceHook) {
+	h.traceHook = hook
+}
+
+// executeTraced runs executeWithTransaction, reporting the command to the
+// trace hook when one is installed
+// It is the single entry point of client commands, so it also resolves the
+// name a client sent to the canonical one (rename-command)
+func (h *CommandHandler) executeTraced(ctx context.Context, client *Client, cmd *protocol.Command, tx *Transaction, timeout time.Duration) PipelineResult {
+	if errReply := h.resolveClientCommand(cmd); errReply != nil {
+		return PipelineResult{
+			Response: errReply,
+			Command:  strings.ToUpper(cmd.Args[0]),
+			Args:     cmd.Args[1:],
+		}
+	}
+	if h.traceHook == nil || cmd == nil || len(cmd.Args) == 0 {
+		return h.executeWithTransaction(ctx, client, cmd, tx, timeout)
+	}
+
+	command := strings.ToUpper(cmd.Args[0])
+	key := traceKey(command, cmd.Args)
+
+	ctx = h.traceHook.BeforeCommand(ctx, command, key)
+	result := h.executeWithTransaction(ctx, client, cmd, tx, timeout)
+	h.traceHook.AfterCommand(ctx, command, key, result.Duration, traceError(result))
+	return result
+}
+
+// traceKey returns the first key of a command ("" for keyless commands)
+func traceKey(command string, args []string) string {
+	info, exists := commandTable[command]
+	if !exists {
+		return ""
+	}
+	keys := commandKeys(info, args)
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
+
+// traceError returns the error reported to the trace hook for a result
+// Error replies are turned into an error holding the reply's message
+func traceError(result PipelineResult) error {
+	if result.Err != nil {
+		return result.Err
+	}
+	if len(result.Response) > 0 && result.Response[0] == '-' {
+		return errors.New(strings.TrimRight(string(result.Response[1:]), "\r\n"))
+	}
+	return nil
+}
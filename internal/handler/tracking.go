@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"redis/internal/protocol"
+)
+
+// ==================== CLIENT TRACKING ====================
+// With CLIENT TRACKING ON the server remembers the keys a connection reads and
+// sends it an invalidation once one of them is modified, so the client can
+// keep a local cache of those keys. As in Redis, a key is invalidated once:
+// the client stops being one of its readers until it reads the key again.
+//
+// Invalidations are RESP3 pushes (>2 invalidate [key ...]), so a connection
+// tracking for itself must have switched to RESP3 with HELLO 3. A RESP2
+// connection redirects them to another client instead (REDIRECT id), which
+// subscribes to __redis__:invalidate and receives them as pub/sub messages.
+// FLUSHALL and FLUSHDB invalidate every cached key with a null key list.
+//
+// Reads are recorded before the command runs. A write that lands between the
+// read and its reply then still produces an invalidation; the client may get
+// it before the reply, as it can in Redis.
+
+// trackingInvalidateChannel is the channel RESP2 redirect targets subscribe to
+const trackingInvalidateChannel = "__redis__:invalidate"
+
+// pushBufferSize is how many pushes a connection queues before it is closed
+// An invalidation can't be dropped without leaving a stale cache entry, so a
+// client that stopped reading is disconnected, which drops its whole cache
+const pushBufferSize = 1024
+
+// pushWriteTimeout bounds the write of a single push to a connection
+const pushWriteTimeout = 5 * time.Second
+
+// trackingState is the tracking configuration of one client
+type trackingState struct {
+	redirect int64               // Client receiving the invalidations (0 = this client)
+	keys     map[string]struct{} // Keys read since they were last invalidated
+}
+
+// TrackingManager records which tracking clients read which keys
+// Like TransactionManager it keeps a reverse index (key → clients), so a
+// write only looks at the clients that actually read the key
+type TrackingManager struct {
+	mu      sync.Mutex
+	clients map[int64]*trackingState      // clientID -> tracking state
+	readers map[string]map[int64]struct{} // key -> tracking clients that read it
+	count   atomic.Int32                  // len(clients), checked by every write without the lock
+}
+
+// NewTrackingManager creates an empty tracking table
+func NewTrackingManager() *TrackingManager {
+	return &TrackingManager{
+		clients: make(map[int64]*trackingState),
+		readers: make(map[string]map[int64]struct{}),
+	}
+}
+
+// Enable turns tracking on for a client, sending its invalidations to
+// redirect (0 = the client itself)
+// Enabling it again only changes the redirect; the keys read so far stay tracked
+func (tm *TrackingManager) Enable(clientID, redirect int64) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if state, exists := tm.clients[clientID]; exists {
+		state.redirect = redirect
+		return
+	}
+	tm.clients[clientID] = &trackingState{redirect: redirect, keys: make(map[string]struct{})}
+	tm.count.Add(1)
+}
+
+// Disable turns tracking off for a client and forgets the keys it read
+// Also called on disconnect; a no-op for a client that was not tracking
+func (tm *TrackingManager) Disable(clientID int64) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	state, exists := tm.clients[clientID]
+	if !exists {
+		return
+	}
+	for key := range state.keys {
+		tm.removeReader(key, clientID)
+	}
+	delete(tm.clients, clientID)
+	tm.count.Add(-1)
+}
+
+// Redirect returns the client a tracking client's invalidations go to (0 =
+// itself), or false if tracking is off
+func (tm *TrackingManager) Redirect(clientID int64) (int64, bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	state, exists := tm.clients[clientID]
+	if !exists {
+		return 0, false
+	}
+	return state.redirect, true
+}
+
+// Track records that a tracking client read keys
+func (tm *TrackingManager) Track(clientID int64, keys []string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	state, exists := tm.clients[clientID]
+	if !exists {
+		return
+	}
+	for _, key := range keys {
+		state.keys[key] = struct{}{}
+		if _, ok := tm.readers[key]; !ok {
+			tm.readers[key] = make(map[int64]struct{})
+		}
+		tm.readers[key][clientID] = struct{}{}
+	}
+}
+
+// Invalidate forgets every reader of keys and returns, for each client that
+// must be notified, the keys to send it
+// The client notified is the reader's redirect target when it has one
+func (tm *TrackingManager) Invalidate(keys []string) map[int64][]string {
+	if tm.count.Load() == 0 || len(keys) == 0 {
+		return nil
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	var targets map[int64][]string
+	for _, key := range keys {
+		readers, exists := tm.readers[key]
+		if !exists {
+			continue
+		}
+		for clientID := range readers {
+			state := tm.clients[clientID]
+			delete(state.keys, key)
+
+			target := clientID
+			if state.redirect != 0 {
+				target = state.redirect
+			}
+			if targets == nil {
+				targets = make(map[int64][]string)
+			}
+			targets[target] = append(targets[target], key)
+		}
+		delete(tm.readers, key)
+	}
+	return targets
+}
+
+// InvalidateAll forgets every tracked key and returns the clients to notify
+// with a null key list (FLUSHALL / FLUSHDB)
+// The returned lists are nil: the notification names no key
+func (tm *TrackingManager) InvalidateAll() map[int64][]string {
+	if tm.count.Load() == 0 {
+		return nil
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	targets := make(map[int64][]string, len(tm.clients))
+	for clientID, state := range tm.clients {
+		state.keys = make(map[string]struct{})
+
+		target := clientID
+		if state.redirect != 0 {
+			target = state.redirect
+		}
+		targets[target] = nil
+	}
+	tm.readers = make(map[string]map[int64]struct{})
+	return targets
+}
+
+// Sizes returns the number of tracking clients and of keys with at least one
+// tracking reader (INFO tracking_clients / tracking_total_keys)
+func (tm *TrackingManager) Sizes() (clients, keys int) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return len(tm.clients), len(tm.readers)
+}
+
+// removeReader drops clientID from the readers of key; callers hold tm.mu
+func (tm *TrackingManager) removeReader(key string, clientID int64) {
+	if readers, ok := tm.readers[key]; ok {
+		delete(readers, clientID)
+		if len(readers) == 0 {
+			delete(tm.readers, key)
+		}
+	}
+}
+
+// trackReads records the keys a read command is about to read for a tracking client
+func (h *CommandHandler) trackReads(client *Client, command string, args []string) {
+	if !client.State().Tracking || !commandHasFlag(command, "readonly") {
+		return
+	}
+	if info, ok := LookupCommandInfo(command); ok {
+		h.tracking.Track(client.ID, commandKeys(info, args))
+	}
+}
+
+// invalidateWrittenKeys sends invalidations for the keys a command may have
+// modified (args[0] is the command name)
+// Keys come from GetWriteKeys, falling back to the command table's key
+// positions for the writes WATCH does not cover. Any command that is not
+// read-only counts. A script is not: the script engine reports each write it
+// makes instead, whatever keys the script declared
+func (h *CommandHandler) invalidateWrittenKeys(command string, args []string) {
+	if h.tracking.count.Load() == 0 || commandHasFlag(command, "readonly") {
+		return
+	}
+
+	switch command {
+	case "FLUSHALL", "FLUSHDB":
+		h.sendInvalidations(h.tracking.InvalidateAll())
+		return
+	case "EVAL", "EVALSHA":
+		return
+	}
+
+	keys := GetWriteKeys(command, args[1:])
+	if len(keys) == 0 {
+		if info, ok := LookupCommandInfo(command); ok {
+			keys = commandKeys(info, args)
+		}
+	}
+	h.sendInvalidations(h.tracking.Invalidate(keys))
+}
+
+// sendInvalidations queues an invalidation for every target client
+// A RESP3 client gets a push; a RESP2 redirect target gets a pub/sub message,
+// provided it subscribed to __redis__:invalidate. A nil key list means
+// every key (flush)
+func (h *CommandHandler) sendInvalidations(targets map[int64][]string) {
+	for clientID, keys := range targets {
+		value, ok := h.clients.Load(clientID)
+		if !ok {
+			continue // Redirect target disconnected
+		}
+		target := value.(*Client)
+
+		keyList := protocol.EncodeNullBulkString()
+		if keys != nil {
+			keyList = protocol.EncodeArray(keys)
+		}
+
+		var msg []byte
+		if target.State().Protocol == 3 {
+			msg = protocol.EncodePush([][]byte{protocol.EncodeBulkString("invalidate"), keyList})
+		} else if h.isSubscribedToInvalidations(target) {
+			msg = protocol.EncodeRawArray([][]byte{
+				protocol.EncodeBulkString("message"),
+				protocol.EncodeBulkString(trackingInvalidateChannel),
+				keyList,
+			})
+		} else {
+			continue
+		}
+		h.queuePush(target, msg)
+	}
+}
+
+// isSubscribedToInvalidations reports whether a client subscribed to __redis__:invalidate
+func (h *CommandHandler) isSubscribedToInvalidations(c *Client) bool {
+	channels := h.processor.GetStore().PubSub.SubscriberChannels(fmt.Sprintf("client:%d", c.ID))
+	for _, channel := range channels {
+		if channel == trackingInvalidateChannel {
+			return true
+		}
+	}
+	return false
+}
+
+// queuePush hands a push to a client's push pump without blocking
+// A client whose queue is full is disconnected rather than left with a
+// cache that missed an invalidation
+func (h *CommandHandler) queuePush(c *Client, msg []byte) {
+	select {
+	case c.pushes <- msg:
+	default:
+		log.Printf("Client %d: push queue full, closing connection", c.ID)
+		c.Conn.Close()
+	}
+}
+
+// startPushPump writes the client's queued pushes until ctx is done
+// A push is written only while writeSlot is free, which the pipeline holds
+// from the first command of a batch until its replies are flushed, so a push
+// never lands in the middle of a reply
+func (h *CommandHandler) startPushPump(ctx context.Context, client *Client) {
+	go func() {
+		for {
+			var msg []byte
+			select {
+			case <-ctx.Done():
+				return
+			case msg = <-client.pushes:
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case client.writeSlot <- struct{}{}:
+			}
+			client.Conn.SetWriteDeadline(time.Now().Add(pushWriteTimeout))
+			_, err := client.Conn.Write(msg)
+			client.Conn.SetWriteDeadline(time.Time{})
+			<-client.writeSlot
+
+			if err != nil {
+				log.Printf("Client %d: error writing push: %v", client.ID, err)
+				client.Conn.Close()
+				return
+			}
+		}
+	}()
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"strconv"
 	"sync"
 
 	"redis/internal/protocol"
@@ -265,7 +266,7 @@ func GetWriteKeys(cmd string, args []string) []string {
 
 	switch cmd {
 	// String commands
-	case "SET", "SETEX", "SETNX", "GETSET", "INCR", "INCRBY", "INCRBYFLOAT", "DECR", "DECRBY", "APPEND":
+	case "SET", "SETEX", "SETNX", "GETSET", "INCR", "INCRBY", "INCRBYFLOAT", "DECR", "DECRBY", "APPEND", "SETRANGE":
 		return []string{args[0]}
 	case "MSET", "MSETNX":
 		// MSET key1 val1 key2 val2 ...
@@ -284,8 +285,20 @@ func GetWriteKeys(cmd string, args []string) []string {
 		}
 		return []string{args[0]}
 
+	// Multi-key pop commands: LMPOP/ZMPOP numkeys key [key ...] ...
+	case "LMPOP", "ZMPOP":
+		if len(args) == 0 {
+			return nil
+		}
+		numKeys, err := strconv.Atoi(args[0])
+		if err != nil || numKeys <= 0 || numKeys >= len(args) {
+			return nil
+		}
+		return args[1 : 1+numKeys]
+
 	// Hash commands
-	case "HSET", "HSETNX", "HDEL", "HINCRBY", "HINCRBYFLOAT":
+	case "HSET", "HSETNX", "HDEL", "HINCRBY", "HINCRBYFLOAT",
+		"HEXPIRE", "HPEXPIRE", "HEXPIREAT", "HPEXPIREAT", "HPERSIST", "HGETDEL", "HGETEX":
 		return []string{args[0]}
 
 	// Set commands
@@ -302,8 +315,13 @@ func GetWriteKeys(cmd string, args []string) []string {
 			return []string{args[0], args[1]}
 		}
 		return []string{args[0]}
-	case "EXPIRE", "EXPIREAT", "PEXPIRE", "PEXPIREAT", "PERSIST":
+	case "EXPIRE", "EXPIREAT", "PEXPIRE", "PEXPIREAT", "PERSIST", "RESTORE":
 		return []string{args[0]}
+	case "COPY":
+		if len(args) >= 2 {
+			return []string{args[1]} // destination key
+		}
+		return nil
 
 	// FLUSHALL, FLUSHDB write to all keys - return nil to indicate special handling
 	case "FLUSHALL", "FLUSHDB":
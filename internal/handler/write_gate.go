@@ -0,0 +1,54 @@
+package handler
+
+// ==================== WRITE GATE ====================
+// writeGate is held shared by every write from its admission until it was
+// logged and propagated (by a write EXEC for the whole transaction). Taking
+// it exclusively waits for the writes in flight and keeps new ones out:
+//
+//   - SHUTDOWN FAILOVER drains it once, so every write admitted before
+//     writes were refused is in the offset it waits for
+//   - a read-only EXEC holds it while its reads run, so they all see the
+//     dataset in the same state
+//   - DEBUG RELOAD holds it from the save to the swap of the reloaded
+//     dataset, so no write is lost in between
+//
+// Blocked clients hold nothing while they wait: they could keep the gate
+// indefinitely, and a push that serves one holds it already.
+
+// isGatedWrite reports whether a command goes through the write gate:
+// anything that writes, scripts included as they may call any write command
+func isGatedWrite(command string) bool {
+	switch command {
+	case "EVAL", "EVALSHA":
+		return true
+	}
+	return IsWriteCommand(command) || commandHasFlag(command, "write")
+}
+
+// enterWriteGate admits a command past the write gate
+// It reports false for a write while SHUTDOWN FAILOVER runs; otherwise the
+// returned release must be called once the command was logged and propagated
+func (h *CommandHandler) enterWriteGate(command string) (release func(), ok bool) {
+	if !isGatedWrite(command) {
+		return func() {}, true
+	}
+	return h.holdWriteGate()
+}
+
+// holdWriteGate is enterWriteGate for a command known to write, such as EXEC
+// of a transaction with writes or the first attempt of a blocking pop
+func (h *CommandHandler) holdWriteGate() (release func(), ok bool) {
+	h.writeGate.RLock()
+	if h.failoverInProgress.Load() {
+		h.writeGate.RUnlock()
+		return nil, false
+	}
+	return h.writeGate.RUnlock, true
+}
+
+// drainWriteGate waits for the writes in flight to be logged and propagated
+// Writes admitted afterwards see whatever state the caller set before
+func (h *CommandHandler) drainWriteGate() {
+	h.writeGate.Lock()
+	h.writeGate.Unlock()
+}
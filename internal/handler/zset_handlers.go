@@ -2,7 +2,9 @@ package handler
 
 import (
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 
 	"redis/internal/processor"
 	"redis/internal/protocol"
@@ -10,18 +12,59 @@ import (
 )
 
 // handleZAdd adds members with scores to a sorted set
-// ZADD key score1 member1 [score2 member2 ...]
+// ZADD key [NX | XX] [GT | LT] [CH] [INCR] score1 member1 [score2 member2 ...]
+// With INCR it behaves like ZINCRBY and replies with the new score, or a null
+// when NX/XX/GT/LT prevented the increment
 func (h *CommandHandler) handleZAdd(cmd *protocol.Command) []byte {
-	if len(cmd.Args) < 4 || len(cmd.Args)%2 != 0 {
+	if len(cmd.Args) < 4 {
 		return protocol.EncodeError("ERR wrong number of arguments for 'zadd' command")
 	}
 
 	key := cmd.Args[1]
-	members := make([]storage.ZSetMember, 0)
+
+	// Parse flags preceding the score-member pairs
+	var opts storage.ZAddOptions
+	incr := false
+	pos := 2
+parseFlags:
+	for ; pos < len(cmd.Args); pos++ {
+		switch strings.ToUpper(cmd.Args[pos]) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		case "CH":
+			opts.CH = true
+		case "INCR":
+			incr = true
+		default:
+			break parseFlags
+		}
+	}
+
+	pairs := len(cmd.Args) - pos
+	if pairs == 0 || pairs%2 != 0 {
+		return protocol.EncodeError("ERR syntax error")
+	}
+	if opts.NX && opts.XX {
+		return protocol.EncodeError("ERR XX and NX options at the same time are not compatible")
+	}
+	if (opts.GT && opts.LT) || (opts.NX && (opts.GT || opts.LT)) {
+		return protocol.EncodeError("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && pairs > 2 {
+		return protocol.EncodeError("ERR INCR option supports a single increment-element pair")
+	}
+
+	members := make([]storage.ZSetMember, 0, pairs/2)
 
 	// Parse score-member pairs
-	for i := 2; i < len(cmd.Args); i += 2 {
-		score, err := strconv.ParseFloat(cmd.Args[i], 64)
+	for i := pos; i < len(cmd.Args); i += 2 {
+		score, err := parseScore(cmd.Args[i])
 		if err != nil {
 			return protocol.EncodeError("ERR value is not a valid float")
 		}
@@ -32,14 +75,33 @@ func (h *CommandHandler) handleZAdd(cmd *protocol.Command) []byte {
 	procCmd := &processor.Command{
 		Type:     processor.CmdZAdd,
 		Key:      key,
-		Args:     []interface{}{members},
+		Args:     []interface{}{members, opts, incr},
 		Response: make(chan interface{}, 1),
 	}
 	h.processor.Submit(procCmd)
 	result := <-procCmd.Response
 
-	added := result.(processor.IntResult).Result
-	return protocol.EncodeInteger(added)
+	if incr {
+		incrResult := result.(processor.ZAddIncrResult)
+		if incrResult.Err != nil {
+			return protocol.EncodeError(incrResult.Err.Error())
+		}
+		if !incrResult.Applied {
+			return protocol.EncodeNullBulkString()
+		}
+		h.NotifyZSetAdd(key)
+		return protocol.EncodeBulkString(fmt.Sprintf("%.17g", incrResult.Score))
+	}
+
+	addResult := result.(processor.IntResult)
+	if addResult.Err != nil {
+		return protocol.EncodeError(addResult.Err.Error())
+	}
+
+	// Notify any blocked clients waiting on this key
+	h.NotifyZSetAdd(key)
+
+	return protocol.EncodeInteger(addResult.Result)
 }
 
 // handleZRem removes members from a sorted set
@@ -241,23 +303,20 @@ func (h *CommandHandler) handleZRangeByScore(cmd *protocol.Command) []byte {
 	}
 
 	key := cmd.Args[1]
-	min, err1 := strconv.ParseFloat(cmd.Args[2], 64)
-	max, err2 := strconv.ParseFloat(cmd.Args[3], 64)
+	min, err1 := parseScore(cmd.Args[2])
+	max, err2 := parseScore(cmd.Args[3])
 
 	if err1 != nil || err2 != nil {
 		return protocol.EncodeError("ERR min or max is not a float")
 	}
 
-	offset := 0
-	count := -1
-
-	// Parse LIMIT clause
-	for i := 4; i < len(cmd.Args); i++ {
-		if cmd.Args[i] == "LIMIT" && i+2 < len(cmd.Args) {
-			offset, _ = strconv.Atoi(cmd.Args[i+1])
-			count, _ = strconv.Atoi(cmd.Args[i+2])
-			break
-		}
+	offset, count, errResp := parseZRangeLimit(cmd.Args[4:])
+	if errResp != nil {
+		return errResp
+	}
+	if offset < 0 {
+		// Like Redis, a negative offset matches nothing
+		return protocol.EncodeArray([]string{})
 	}
 
 	procCmd := &processor.Command{
@@ -280,22 +339,20 @@ func (h *CommandHandler) handleZRevRangeByScore(cmd *protocol.Command) []byte {
 	}
 
 	key := cmd.Args[1]
-	max, err1 := strconv.ParseFloat(cmd.Args[2], 64)
-	min, err2 := strconv.ParseFloat(cmd.Args[3], 64)
+	max, err1 := parseScore(cmd.Args[2])
+	min, err2 := parseScore(cmd.Args[3])
 
 	if err1 != nil || err2 != nil {
 		return protocol.EncodeError("ERR min or max is not a float")
 	}
 
-	offset := 0
-	count := -1
-
-	for i := 4; i < len(cmd.Args); i++ {
-		if cmd.Args[i] == "LIMIT" && i+2 < len(cmd.Args) {
-			offset, _ = strconv.Atoi(cmd.Args[i+1])
-			count, _ = strconv.Atoi(cmd.Args[i+2])
-			break
-		}
+	offset, count, errResp := parseZRangeLimit(cmd.Args[4:])
+	if errResp != nil {
+		return errResp
+	}
+	if offset < 0 {
+		// Like Redis, a negative offset matches nothing
+		return protocol.EncodeArray([]string{})
 	}
 
 	procCmd := &processor.Command{
@@ -311,6 +368,43 @@ func (h *CommandHandler) handleZRevRangeByScore(cmd *protocol.Command) []byte {
 	return encodeZSetMembers(members, false)
 }
 
+// parseZRangeLimit parses the optional "LIMIT offset count" clause of
+// ZRANGEBYSCORE and ZREVRANGEBYSCORE
+// Returns offset 0 and count -1 (no limit) without the clause; a negative
+// count also means no limit
+func parseZRangeLimit(args []string) (int, int, []byte) {
+	offset, count := 0, -1
+	for i := 0; i < len(args); i++ {
+		if strings.ToUpper(args[i]) != "LIMIT" {
+			continue
+		}
+		if i+2 >= len(args) {
+			return 0, 0, protocol.EncodeError("ERR syntax error")
+		}
+		var err1, err2 error
+		offset, err1 = strconv.Atoi(args[i+1])
+		count, err2 = strconv.Atoi(args[i+2])
+		if err1 != nil || err2 != nil {
+			return 0, 0, protocol.EncodeError("ERR value is not an integer or out of range")
+		}
+		if count < 0 {
+			count = -1
+		}
+		break
+	}
+	return offset, count, nil
+}
+
+// parseScore parses a score or score bound; like Redis it refuses NaN, which
+// would break the ordering of the set
+func parseScore(s string) (float64, error) {
+	score, err := strconv.ParseFloat(s, 64)
+	if err == nil && math.IsNaN(score) {
+		return 0, strconv.ErrSyntax
+	}
+	return score, err
+}
+
 // handleZIncrBy increments the score of a member
 // ZINCRBY key increment member
 func (h *CommandHandler) handleZIncrBy(cmd *protocol.Command) []byte {
@@ -319,7 +413,7 @@ func (h *CommandHandler) handleZIncrBy(cmd *protocol.Command) []byte {
 	}
 
 	key := cmd.Args[1]
-	delta, err := strconv.ParseFloat(cmd.Args[2], 64)
+	delta, err := parseScore(cmd.Args[2])
 	if err != nil {
 		return protocol.EncodeError("ERR value is not a valid float")
 	}
@@ -339,6 +433,9 @@ func (h *CommandHandler) handleZIncrBy(cmd *protocol.Command) []byte {
 		return protocol.EncodeError(scoreResult.Err.Error())
 	}
 
+	// Notify any blocked clients waiting on this key
+	h.NotifyZSetAdd(key)
+
 	return protocol.EncodeBulkString(fmt.Sprintf("%.17g", scoreResult.Result))
 }
 
@@ -350,8 +447,8 @@ func (h *CommandHandler) handleZCount(cmd *protocol.Command) []byte {
 	}
 
 	key := cmd.Args[1]
-	min, err1 := strconv.ParseFloat(cmd.Args[2], 64)
-	max, err2 := strconv.ParseFloat(cmd.Args[3], 64)
+	min, err1 := parseScore(cmd.Args[2])
+	max, err2 := parseScore(cmd.Args[3])
 
 	if err1 != nil || err2 != nil {
 		return protocol.EncodeError("ERR min or max is not a float")
@@ -428,8 +525,8 @@ func (h *CommandHandler) handleZRemRangeByScore(cmd *protocol.Command) []byte {
 	}
 
 	key := cmd.Args[1]
-	min, err1 := strconv.ParseFloat(cmd.Args[2], 64)
-	max, err2 := strconv.ParseFloat(cmd.Args[3], 64)
+	min, err1 := parseScore(cmd.Args[2])
+	max, err2 := parseScore(cmd.Args[3])
 
 	if err1 != nil || err2 != nil {
 		return protocol.EncodeError("ERR min or max is not a float")
@@ -497,3 +594,38 @@ func encodeZSetMembers(members []storage.ZSetMember, withScores bool) []byte {
 	}
 	return protocol.EncodeArray(result)
 }
+
+// handleZMPop pops members from the first non-empty sorted set among several keys
+// ZMPOP numkeys key [key ...] MIN|MAX [COUNT count]
+func (h *CommandHandler) handleZMPop(cmd *protocol.Command) []byte {
+	if len(cmd.Args) < 4 {
+		return protocol.EncodeError("ERR wrong number of arguments for 'zmpop' command")
+	}
+
+	parsed, errReply := parseMPopArgs(cmd.Args[1:], "MIN", "MAX")
+	if errReply != nil {
+		return errReply
+	}
+
+	res := h.zmpop(parsed.keys, !parsed.first, parsed.count)
+	if res.Err != nil {
+		return protocol.EncodeError(res.Err.Error())
+	}
+	return encodeZMPopReply(res.Key, res.Members)
+}
+
+// encodeZMPopReply encodes [key, [[member, score] ...]], or a null array if
+// nothing was popped
+func encodeZMPopReply(key string, members []storage.ZSetMember) []byte {
+	if key == "" {
+		return protocol.EncodeNilArray()
+	}
+	pairs := make([][]byte, len(members))
+	for i, member := range members {
+		pairs[i] = protocol.EncodeArray([]string{member.Member, fmt.Sprintf("%.17g", member.Score)})
+	}
+	return protocol.EncodeRawArray([][]byte{
+		protocol.EncodeBulkString(key),
+		protocol.EncodeRawArray(pairs),
+	})
+}
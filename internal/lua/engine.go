@@ -1,32 +1,168 @@
 package lua
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	lua "github.com/yuin/gopher-lua"
 )
 
+// DefaultTimeLimit is the default lua-time-limit (same as Redis)
+const DefaultTimeLimit = 5 * time.Second
+
+var (
+	// ErrNotBusy is returned by Kill when no script is running
+	ErrNotBusy = errors.New("NOTBUSY No scripts in execution right now.")
+	// ErrUnkillable is returned by Kill when the running script already wrote to the dataset
+	ErrUnkillable = errors.New("UNKILLABLE Sorry the script already executed write commands against the dataset. " +
+		"You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command.")
+	// ErrScriptKilled is returned to the caller of a script stopped by SCRIPT KILL
+	ErrScriptKilled = errors.New("Script killed by user with SCRIPT KILL...")
+)
+
 // ScriptEngine manages Lua script execution and caching
 type ScriptEngine struct {
 	scriptCache   map[string]string // SHA1 -> script source
 	redisExecutor *RedisExecutor    // Executor for Redis commands
+
+	// Busy-script protection
+	timeLimit      time.Duration     // lua-time-limit: after this a running script makes the server BUSY
+	isWriteCommand func(string) bool // Classifies redis.call commands as writes (for SCRIPT KILL)
+	onWrite        func([]string)    // Told about every write command a script executed
+	execMu         sync.Mutex        // Scripts run one at a time
+	runningMu      sync.Mutex        // Protects running
+	running        *runningScript    // Currently executing script (nil if none)
+}
+
+// runningScript tracks the script currently executing
+type runningScript struct {
+	start     time.Time
+	cancel    context.CancelFunc
+	wroteData bool // Performed a write; such scripts can't be killed
+	killed    bool
 }
 
 // NewScriptEngine creates a new Lua script engine
 func NewScriptEngine(executor *RedisExecutor) *ScriptEngine {
 	return &ScriptEngine{
-		scriptCache:   make(map[string]string),
-		redisExecutor: executor,
+		scriptCache:    make(map[string]string),
+		redisExecutor:  executor,
+		timeLimit:      DefaultTimeLimit,
+		isWriteCommand: func(string) bool { return false },
+		onWrite:        func([]string) {},
+	}
+}
+
+// SetTimeLimit sets lua-time-limit (0 disables BUSY replies)
+func (se *ScriptEngine) SetTimeLimit(limit time.Duration) {
+	se.timeLimit = limit
+}
+
+// SetWriteCommandChecker sets the function used to detect writes made by scripts
+// Command names are passed in uppercase
+func (se *ScriptEngine) SetWriteCommandChecker(isWrite func(string) bool) {
+	se.isWriteCommand = isWrite
+}
+
+// SetWriteNotifier sets the function told about every write command a
+// script executed, with the uppercase command name in args[0]
+// It runs inside the script, before redis.call returns
+func (se *ScriptEngine) SetWriteNotifier(notify func(args []string)) {
+	se.onWrite = notify
+}
+
+// IsBusy reports whether a script has been running for longer than lua-time-limit
+func (se *ScriptEngine) IsBusy() bool {
+	se.runningMu.Lock()
+	defer se.runningMu.Unlock()
+
+	return se.running != nil && se.timeLimit > 0 && time.Since(se.running.start) > se.timeLimit
+}
+
+// Kill stops the running script, unless it has already written to the dataset
+func (se *ScriptEngine) Kill() error {
+	se.runningMu.Lock()
+	defer se.runningMu.Unlock()
+
+	if se.running == nil {
+		return ErrNotBusy
+	}
+	if se.running.wroteData {
+		return ErrUnkillable
+	}
+
+	se.running.killed = true
+	se.running.cancel()
+	return nil
+}
+
+// markWrite records that the running script is about to execute a write
+// command, so that SCRIPT KILL can no longer stop it halfway through
+// Returns false if the script was killed first: the command must not run
+func (se *ScriptEngine) markWrite(cmdName string) bool {
+	if !se.isWriteCommand(strings.ToUpper(cmdName)) {
+		return true
 	}
+
+	se.runningMu.Lock()
+	defer se.runningMu.Unlock()
+
+	if se.running == nil {
+		return true
+	}
+	if se.running.killed {
+		return false
+	}
+	se.running.wroteData = true
+	return true
+}
+
+// notifyWrite passes a write command the script executed to the write notifier
+// Arguments are formatted as ExecuteCommand formats them
+func (se *ScriptEngine) notifyWrite(cmdName string, args []interface{}) {
+	name := strings.ToUpper(cmdName)
+	if !se.isWriteCommand(name) {
+		return
+	}
+
+	cmdArgs := make([]string, 0, len(args)+1)
+	cmdArgs = append(cmdArgs, name)
+	for _, arg := range args {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("%v", arg))
+	}
+	se.onWrite(cmdArgs)
 }
 
 // Eval executes a Lua script with given keys and arguments
 func (se *ScriptEngine) Eval(script string, keys []string, args []string) (interface{}, error) {
+	se.execMu.Lock()
+	defer se.execMu.Unlock()
+
 	L := lua.NewState()
 	defer L.Close()
 
+	// The context lets SCRIPT KILL interrupt the VM between instructions
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	L.SetContext(ctx)
+
+	run := &runningScript{start: time.Now(), cancel: cancel}
+	se.runningMu.Lock()
+	se.running = run
+	se.runningMu.Unlock()
+
+	defer func() {
+		se.runningMu.Lock()
+		se.running = nil
+		se.runningMu.Unlock()
+	}()
+
 	// Register Redis API functions
 	se.registerRedisAPI(L)
 
@@ -35,6 +171,12 @@ func (se *ScriptEngine) Eval(script string, keys []string, args []string) (inter
 
 	// Execute the script
 	if err := L.DoString(script); err != nil {
+		se.runningMu.Lock()
+		killed := run.killed
+		se.runningMu.Unlock()
+		if killed {
+			return nil, ErrScriptKilled
+		}
 		return nil, fmt.Errorf("ERR Error running script: %v", err)
 	}
 
@@ -60,6 +202,12 @@ func (se *ScriptEngine) LoadScript(script string) string {
 	return hash
 }
 
+// ScriptSource returns the source of a cached script
+func (se *ScriptEngine) ScriptSource(sha1Hash string) (string, bool) {
+	script, exists := se.scriptCache[sha1Hash]
+	return script, exists
+}
+
 // ScriptExists checks if scripts exist in cache
 func (se *ScriptEngine) ScriptExists(sha1Hashes []string) []bool {
 	results := make([]bool, len(sha1Hashes))
@@ -94,11 +242,17 @@ func (se *ScriptEngine) registerRedisAPI(L *lua.LState) {
 			args[i-2] = se.convertLuaToGo(L.Get(i))
 		}
 
+		if !se.markWrite(cmdName) {
+			L.RaiseError(ErrScriptKilled.Error())
+			return 0
+		}
+
 		result, err := se.redisExecutor.ExecuteCommand(cmdName, args...)
 		if err != nil {
 			L.RaiseError(err.Error())
 			return 0
 		}
+		se.notifyWrite(cmdName, args)
 
 		L.Push(se.convertGoToLua(L, result))
 		return 1
@@ -120,6 +274,11 @@ func (se *ScriptEngine) registerRedisAPI(L *lua.LState) {
 			args[i-2] = se.convertLuaToGo(L.Get(i))
 		}
 
+		if !se.markWrite(cmdName) {
+			L.RaiseError(ErrScriptKilled.Error())
+			return 0
+		}
+
 		result, err := se.redisExecutor.ExecuteCommand(cmdName, args...)
 		if err != nil {
 			errorTable := L.NewTable()
@@ -127,6 +286,7 @@ func (se *ScriptEngine) registerRedisAPI(L *lua.LState) {
 			L.Push(errorTable)
 			return 1
 		}
+		se.notifyWrite(cmdName, args)
 
 		L.Push(se.convertGoToLua(L, result))
 		return 1
@@ -2,6 +2,7 @@ package lua
 
 import (
 	"fmt"
+	"math"
 	"redis/internal/storage"
 	"strconv"
 	"strings"
@@ -106,110 +107,49 @@ func (r *RedisExecutor) ExecuteCommand(cmdName string, args ...interface{}) (int
 		if err != nil {
 			return nil, fmt.Errorf("ERR value is not an integer or out of range")
 		}
+		if delta == math.MinInt64 {
+			return nil, storage.ErrIncrOverflow
+		}
 		return r.increment(stringArgs[0], -delta)
 
 	case "APPEND":
 		if len(stringArgs) < 2 {
 			return nil, fmt.Errorf("ERR wrong number of arguments for 'append' command")
 		}
-		value, exists := r.store.Get(stringArgs[0])
-		var current string
-		if exists {
-			current, _ = value.(string)
-		}
-		newValue := current + stringArgs[1]
-		r.store.Set(stringArgs[0], newValue, nil)
-		return int64(len(newValue)), nil
+		return r.store.Append(stringArgs[0], stringArgs[1])
 
 	case "STRLEN":
 		if len(stringArgs) < 1 {
 			return nil, fmt.Errorf("ERR wrong number of arguments for 'strlen' command")
 		}
-		value, exists := r.store.Get(stringArgs[0])
-		if !exists {
-			return int64(0), nil
-		}
-		if str, ok := value.(string); ok {
-			return int64(len(str)), nil
-		}
-		return int64(0), nil
+		return r.store.StrLen(stringArgs[0])
 
 	case "GETRANGE":
 		if len(stringArgs) < 3 {
 			return nil, fmt.Errorf("ERR wrong number of arguments for 'getrange' command")
 		}
-		value, exists := r.store.Get(stringArgs[0])
-		if !exists {
-			return "", nil
-		}
-		str, ok := value.(string)
-		if !ok {
-			return nil, fmt.Errorf("WRONGTYPE Operation against a key holding the wrong kind of value")
-		}
-		start, err := strconv.Atoi(stringArgs[1])
+		start, err := strconv.ParseInt(stringArgs[1], 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("ERR value is not an integer or out of range")
 		}
-		end, err := strconv.Atoi(stringArgs[2])
+		end, err := strconv.ParseInt(stringArgs[2], 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("ERR value is not an integer or out of range")
 		}
-
-		// Handle negative indices
-		length := len(str)
-		if start < 0 {
-			start = length + start
-		}
-		if end < 0 {
-			end = length + end
-		}
-
-		// Clamp indices
-		if start < 0 {
-			start = 0
-		}
-		if end >= length {
-			end = length - 1
-		}
-		if start > end || start >= length {
-			return "", nil
-		}
-
-		return str[start : end+1], nil
+		return r.store.GetRange(stringArgs[0], start, end)
 
 	case "SETRANGE":
 		if len(stringArgs) < 3 {
 			return nil, fmt.Errorf("ERR wrong number of arguments for 'setrange' command")
 		}
-		offset, err := strconv.Atoi(stringArgs[1])
-		if err != nil || offset < 0 {
-			return nil, fmt.Errorf("ERR offset is out of range")
-		}
-
-		value, exists := r.store.Get(stringArgs[0])
-		var current string
-		if exists {
-			current, _ = value.(string)
-		}
-
-		// Extend string with nulls if needed
-		if offset > len(current) {
-			current = current + string(make([]byte, offset-len(current)))
-		}
-
-		newValue := stringArgs[2]
-		if offset == 0 {
-			result := newValue + current[len(newValue):]
-			r.store.Set(stringArgs[0], result, nil)
-			return int64(len(result)), nil
+		offset, err := strconv.ParseInt(stringArgs[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ERR value is not an integer or out of range")
 		}
-
-		result := current[:offset] + newValue
-		if offset+len(newValue) < len(current) {
-			result += current[offset+len(newValue):]
+		if offset < 0 {
+			return nil, fmt.Errorf("ERR offset is out of range")
 		}
-		r.store.Set(stringArgs[0], result, nil)
-		return int64(len(result)), nil
+		return r.store.SetRange(stringArgs[0], offset, stringArgs[2])
 
 	case "MGET":
 		if len(stringArgs) < 1 {
@@ -311,13 +251,15 @@ func (r *RedisExecutor) ExecuteCommand(cmdName string, args ...interface{}) (int
 		return value, nil
 
 	case "LSET":
-		if len(stringArgs) < 3 {
+		if len(stringArgs) != 3 {
 			return nil, fmt.Errorf("ERR wrong number of arguments for 'lset' command")
 		}
 		index, err := strconv.Atoi(stringArgs[1])
 		if err != nil {
 			return nil, fmt.Errorf("ERR value is not an integer or out of range")
 		}
+		// Store errors already carry the Redis replies:
+		// ERR no such key, ERR index out of range and WRONGTYPE
 		err = r.store.LSet(stringArgs[0], index, stringArgs[2])
 		if err != nil {
 			return nil, err
@@ -343,16 +285,94 @@ func (r *RedisExecutor) ExecuteCommand(cmdName string, args ...interface{}) (int
 		return "OK", nil
 
 	case "LINSERT":
-		if len(stringArgs) < 4 {
+		if len(stringArgs) != 4 {
 			return nil, fmt.Errorf("ERR wrong number of arguments for 'linsert' command")
 		}
-		before := strings.ToUpper(stringArgs[1]) == "BEFORE"
+		var before bool
+		switch strings.ToUpper(stringArgs[1]) {
+		case "BEFORE":
+			before = true
+		case "AFTER":
+			before = false
+		default:
+			return nil, fmt.Errorf("ERR syntax error")
+		}
+		// Returns the new length, -1 if the pivot was not found, 0 if the key is missing
 		count, err := r.store.LInsert(stringArgs[0], before, stringArgs[2], stringArgs[3])
 		if err != nil {
 			return nil, err
 		}
 		return int64(count), nil
 
+	case "LREM":
+		if len(stringArgs) != 3 {
+			return nil, fmt.Errorf("ERR wrong number of arguments for 'lrem' command")
+		}
+		count, err := strconv.Atoi(stringArgs[1])
+		if err != nil {
+			return nil, fmt.Errorf("ERR value is not an integer or out of range")
+		}
+		// Positive counts remove from the head, negative ones from the tail, 0 all
+		removed, err := r.store.LRem(stringArgs[0], count, stringArgs[2])
+		if err != nil {
+			return nil, err
+		}
+		return int64(removed), nil
+
+	case "LPOS":
+		if len(stringArgs) < 2 {
+			return nil, fmt.Errorf("ERR wrong number of arguments for 'lpos' command")
+		}
+		rank, count, maxLen := 1, 1, 0
+		withCount := false
+		for i := 2; i < len(stringArgs); i += 2 {
+			if i+1 >= len(stringArgs) {
+				return nil, fmt.Errorf("ERR syntax error")
+			}
+			n, err := strconv.Atoi(stringArgs[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("ERR value is not an integer or out of range")
+			}
+			switch strings.ToUpper(stringArgs[i]) {
+			case "RANK":
+				if n == 0 {
+					return nil, fmt.Errorf("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the last match")
+				}
+				if n == math.MinInt64 {
+					return nil, fmt.Errorf("ERR value is out of range, value must between -9223372036854775807 and 9223372036854775807")
+				}
+				rank = n
+			case "COUNT":
+				if n < 0 {
+					return nil, fmt.Errorf("ERR COUNT can't be negative")
+				}
+				count = n
+				withCount = true
+			case "MAXLEN":
+				if n < 0 {
+					return nil, fmt.Errorf("ERR MAXLEN can't be negative")
+				}
+				maxLen = n
+			default:
+				return nil, fmt.Errorf("ERR syntax error")
+			}
+		}
+		positions, err := r.store.LPos(stringArgs[0], stringArgs[1], rank, count, maxLen)
+		if err != nil {
+			return nil, err
+		}
+		if !withCount {
+			if len(positions) == 0 {
+				return nil, nil
+			}
+			return int64(positions[0]), nil
+		}
+		result := make([]interface{}, len(positions))
+		for i, pos := range positions {
+			result[i] = int64(pos)
+		}
+		return result, nil
+
 	// ==================== HASH COMMANDS ====================
 	case "HSET":
 		if len(stringArgs) < 3 {
@@ -389,6 +409,42 @@ func (r *RedisExecutor) ExecuteCommand(cmdName string, args ...interface{}) (int
 		}
 		return result, nil
 
+	case "HRANDFIELD":
+		if len(stringArgs) < 1 || len(stringArgs) > 3 {
+			return nil, fmt.Errorf("ERR wrong number of arguments for 'hrandfield' command")
+		}
+		count := 1
+		withValues := false
+		if len(stringArgs) >= 2 {
+			var err error
+			count, err = strconv.Atoi(stringArgs[1])
+			if err != nil {
+				return nil, fmt.Errorf("ERR value is not an integer or out of range")
+			}
+		}
+		if len(stringArgs) == 3 {
+			if strings.ToUpper(stringArgs[2]) != "WITHVALUES" {
+				return nil, fmt.Errorf("ERR syntax error")
+			}
+			withValues = true
+		}
+		fields, err := r.store.HRandField(stringArgs[0], count, withValues)
+		if err != nil {
+			return nil, err
+		}
+		if len(stringArgs) == 1 {
+			// Without a count, return a single field
+			if len(fields) == 0 {
+				return nil, nil
+			}
+			return fields[0], nil
+		}
+		result := make([]interface{}, len(fields))
+		for i, f := range fields {
+			result[i] = f
+		}
+		return result, nil
+
 	case "HEXISTS":
 		if len(stringArgs) < 2 {
 			return nil, fmt.Errorf("ERR wrong number of arguments for 'hexists' command")
@@ -520,13 +576,16 @@ func (r *RedisExecutor) ExecuteCommand(cmdName string, args ...interface{}) (int
 			if err != nil {
 				return nil, fmt.Errorf("ERR value is not an integer or out of range")
 			}
+			if count < 0 {
+				return nil, fmt.Errorf("ERR value is out of range, must be positive")
+			}
 		}
 		members := r.store.SPop(stringArgs[0], count)
-		if len(members) == 0 {
-			return nil, nil
-		}
 		if len(stringArgs) == 1 {
-			// Single SPOP returns string
+			// Single SPOP returns string, or nil for an empty set
+			if len(members) == 0 {
+				return nil, nil
+			}
 			return members[0], nil
 		}
 		// Multiple SPOP returns array
@@ -548,12 +607,15 @@ func (r *RedisExecutor) ExecuteCommand(cmdName string, args ...interface{}) (int
 				return nil, fmt.Errorf("ERR value is not an integer or out of range")
 			}
 		}
-		members := r.store.SRandMember(stringArgs[0], count)
-		if len(members) == 0 {
-			return nil, nil
+		members, err := r.store.SRandMember(stringArgs[0], count)
+		if err != nil {
+			return nil, err
 		}
 		if len(stringArgs) == 1 {
-			// Single SRANDMEMBER returns string
+			// Single SRANDMEMBER returns string, or nil for an empty set
+			if len(members) == 0 {
+				return nil, nil
+			}
 			return members[0], nil
 		}
 		// Multiple SRANDMEMBER returns array
@@ -585,6 +647,36 @@ func (r *RedisExecutor) ExecuteCommand(cmdName string, args ...interface{}) (int
 		}
 		return result, nil
 
+	case "SINTERCARD":
+		// SINTERCARD numkeys key [key ...] [LIMIT limit]
+		if len(stringArgs) < 2 {
+			return nil, fmt.Errorf("ERR wrong number of arguments for 'sintercard' command")
+		}
+		numKeys, err := strconv.Atoi(stringArgs[0])
+		if err != nil || numKeys <= 0 {
+			return nil, fmt.Errorf("ERR numkeys should be greater than 0")
+		}
+		if len(stringArgs) < 1+numKeys {
+			return nil, fmt.Errorf("ERR Number of keys can't be greater than number of args")
+		}
+		keys := stringArgs[1 : 1+numKeys]
+		limit := 0
+		rest := stringArgs[1+numKeys:]
+		if len(rest) > 0 {
+			if len(rest) != 2 || strings.ToUpper(rest[0]) != "LIMIT" {
+				return nil, fmt.Errorf("ERR syntax error")
+			}
+			limit, err = strconv.Atoi(rest[1])
+			if err != nil || limit < 0 {
+				return nil, fmt.Errorf("ERR LIMIT can't be negative")
+			}
+		}
+		count, err := r.store.SInterCard(keys, limit)
+		if err != nil {
+			return nil, err
+		}
+		return int64(count), nil
+
 	case "SDIFF":
 		if len(stringArgs) < 1 {
 			return nil, fmt.Errorf("ERR wrong number of arguments for 'sdiff' command")
@@ -828,8 +920,10 @@ func (r *RedisExecutor) ExecuteCommand(cmdName string, args ...interface{}) (int
 		return ttl, nil
 
 	case "KEYS":
-		// Note: Keys() returns all keys, pattern matching not implemented in storage layer
-		keys := r.store.Keys()
+		if len(stringArgs) != 1 {
+			return nil, fmt.Errorf("ERR wrong number of arguments for 'keys' command")
+		}
+		keys := r.store.Keys(stringArgs[0])
 		result := make([]interface{}, len(keys))
 		for i, k := range keys {
 			result[i] = k
@@ -842,27 +936,15 @@ func (r *RedisExecutor) ExecuteCommand(cmdName string, args ...interface{}) (int
 }
 
 // increment increments a key's value
+// It is a single store operation, like INCRBY on the processor, so the
+// read-modify-write can't interleave with anything else
 func (r *RedisExecutor) increment(key string, delta int64) (int64, error) {
-	value, exists := r.store.Get(key)
-	if !exists {
-		// Key doesn't exist, set to 0 + delta
-		r.store.Set(key, fmt.Sprintf("%d", delta), nil)
-		return delta, nil
-	}
-
-	// Parse current value as integer
-	valueStr, ok := value.(string)
-	if !ok {
-		return 0, fmt.Errorf("ERR value is not an integer or out of range")
-	}
-
-	current, err := strconv.ParseInt(valueStr, 10, 64)
+	newValue, err := r.store.IncrBy(key, delta)
 	if err != nil {
+		if err == storage.ErrIncrOverflow {
+			return 0, err
+		}
 		return 0, fmt.Errorf("ERR value is not an integer or out of range")
 	}
-
-	// Calculate new value
-	newValue := current + delta
-	r.store.Set(key, fmt.Sprintf("%d", newValue), nil)
 	return newValue, nil
 }
@@ -72,9 +72,10 @@ func executeGetBit(cmd *Command, store *storage.Store) interface{} {
 }
 
 // executeBitCount counts the number of bits set to 1
-// Args: [start *int64, end *int64] (optional)
+// Args: [start *int64, end *int64, bitUnit bool] (optional)
 func executeBitCount(cmd *Command, store *storage.Store) interface{} {
 	var start, end *int64
+	bitUnit := false
 
 	if len(cmd.Args) >= 1 {
 		if s, ok := cmd.Args[0].(*int64); ok {
@@ -88,7 +89,11 @@ func executeBitCount(cmd *Command, store *storage.Store) interface{} {
 		}
 	}
 
-	count, err := store.BitCount(cmd.Key, start, end)
+	if len(cmd.Args) >= 3 {
+		bitUnit, _ = cmd.Args[2].(bool)
+	}
+
+	count, err := store.BitCount(cmd.Key, start, end, bitUnit)
 	if err != nil {
 		return IntResult{Result: 0, Err: err}
 	}
@@ -97,7 +102,7 @@ func executeBitCount(cmd *Command, store *storage.Store) interface{} {
 }
 
 // executeBitPos finds the position of the first bit set to 0 or 1
-// Args: [bit int, start *int64, end *int64]
+// Args: [bit int, start *int64, end *int64, bitUnit bool]
 func executeBitPos(cmd *Command, store *storage.Store) interface{} {
 	if len(cmd.Args) < 1 {
 		return IntResult{Result: 0, Err: ErrInvalidOperation}
@@ -122,7 +127,12 @@ func executeBitPos(cmd *Command, store *storage.Store) interface{} {
 		}
 	}
 
-	pos, err := store.BitPos(cmd.Key, bit, start, end)
+	bitUnit := false
+	if len(cmd.Args) >= 4 {
+		bitUnit, _ = cmd.Args[3].(bool)
+	}
+
+	pos, err := store.BitPos(cmd.Key, bit, start, end, bitUnit)
 	if err != nil {
 		return IntResult{Result: 0, Err: err}
 	}
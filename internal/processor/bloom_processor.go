@@ -31,6 +31,8 @@ func (p *Processor) executeBloomCommand(cmd *Command) {
 		result = executeBFMExists(cmd, p.store)
 	case CmdBFInfo:
 		result = executeBFInfo(cmd, p.store)
+	case CmdBFInsert:
+		result = executeBFInsert(cmd, p.store)
 	default:
 		result = IntResult{Result: 0, Err: ErrInvalidOperation}
 	}
@@ -39,9 +41,9 @@ func (p *Processor) executeBloomCommand(cmd *Command) {
 }
 
 // executeBFReserve creates a new Bloom filter
-// Args: [errorRate, capacity]
+// Args: [errorRate, capacity, expansion]
 func executeBFReserve(cmd *Command, store *storage.Store) interface{} {
-	if len(cmd.Args) < 2 {
+	if len(cmd.Args) < 3 {
 		return StringResult{Result: "", Err: ErrInvalidOperation}
 	}
 
@@ -55,7 +57,12 @@ func executeBFReserve(cmd *Command, store *storage.Store) interface{} {
 		return StringResult{Result: "", Err: ErrInvalidOperation}
 	}
 
-	err := store.BFReserve(cmd.Key, errorRate, capacity)
+	expansion, ok := cmd.Args[2].(uint32)
+	if !ok {
+		return StringResult{Result: "", Err: ErrInvalidOperation}
+	}
+
+	err := store.BFReserve(cmd.Key, errorRate, capacity, expansion)
 	if err != nil {
 		return StringResult{Result: "", Err: err}
 	}
@@ -161,3 +168,28 @@ func executeBFInfo(cmd *Command, store *storage.Store) interface{} {
 
 	return BloomFilterInfoResult{Info: info, Err: nil}
 }
+
+// executeBFInsert adds items to a Bloom filter, creating it if needed
+// Args: [options, items]
+func executeBFInsert(cmd *Command, store *storage.Store) interface{} {
+	if len(cmd.Args) < 2 {
+		return BoolSliceResult{Results: nil, Err: ErrInvalidOperation}
+	}
+
+	opts, ok := cmd.Args[0].(storage.BloomInsertOptions)
+	if !ok {
+		return BoolSliceResult{Results: nil, Err: ErrInvalidOperation}
+	}
+
+	items, ok := cmd.Args[1].([]string)
+	if !ok {
+		return BoolSliceResult{Results: nil, Err: ErrInvalidOperation}
+	}
+
+	results, err := store.BFInsert(cmd.Key, opts, items)
+	if err != nil {
+		return BoolSliceResult{Results: nil, Err: err}
+	}
+
+	return BoolSliceResult{Results: results, Err: nil}
+}
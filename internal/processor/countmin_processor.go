@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"redis/internal/storage"
+)
+
+// CountMinSketchInfoResult wraps a CountMinSketchInfo result
+type CountMinSketchInfoResult struct {
+	Info *storage.CountMinSketchInfo
+	Err  error
+}
+
+// executeCountMinCommand routes Count-Min sketch commands to their executors
+func (p *Processor) executeCountMinCommand(cmd *Command) {
+	var result interface{}
+
+	switch cmd.Type {
+	case CmdCMSInitByDim:
+		result = executeCMSInitByDim(cmd, p.store)
+	case CmdCMSIncrBy:
+		result = executeCMSIncrBy(cmd, p.store)
+	case CmdCMSQuery:
+		result = executeCMSQuery(cmd, p.store)
+	case CmdCMSInfo:
+		result = executeCMSInfo(cmd, p.store)
+	default:
+		result = IntResult{Result: 0, Err: ErrInvalidOperation}
+	}
+
+	cmd.Response <- result
+}
+
+// executeCMSInitByDim creates a new Count-Min sketch
+// Args: [width, depth]
+func executeCMSInitByDim(cmd *Command, store *storage.Store) interface{} {
+	if len(cmd.Args) < 2 {
+		return StringResult{Result: "", Err: ErrInvalidOperation}
+	}
+
+	width, ok := cmd.Args[0].(uint32)
+	if !ok {
+		return StringResult{Result: "", Err: ErrInvalidOperation}
+	}
+
+	depth, ok := cmd.Args[1].(uint32)
+	if !ok {
+		return StringResult{Result: "", Err: ErrInvalidOperation}
+	}
+
+	if err := store.CMSInitByDim(cmd.Key, width, depth); err != nil {
+		return StringResult{Result: "", Err: err}
+	}
+
+	return StringResult{Result: "OK", Err: nil}
+}
+
+// executeCMSIncrBy increments the counts of items
+// Args: [items, increments]
+func executeCMSIncrBy(cmd *Command, store *storage.Store) interface{} {
+	if len(cmd.Args) < 2 {
+		return Int64SliceResult{Result: nil, Err: ErrInvalidOperation}
+	}
+
+	items, ok := cmd.Args[0].([]string)
+	if !ok {
+		return Int64SliceResult{Result: nil, Err: ErrInvalidOperation}
+	}
+
+	increments, ok := cmd.Args[1].([]int64)
+	if !ok || len(increments) != len(items) {
+		return Int64SliceResult{Result: nil, Err: ErrInvalidOperation}
+	}
+
+	results, err := store.CMSIncrBy(cmd.Key, items, increments)
+	return Int64SliceResult{Result: results, Err: err}
+}
+
+// executeCMSQuery returns the estimated counts of items
+// Args: [items]
+func executeCMSQuery(cmd *Command, store *storage.Store) interface{} {
+	if len(cmd.Args) < 1 {
+		return Int64SliceResult{Result: nil, Err: ErrInvalidOperation}
+	}
+
+	items, ok := cmd.Args[0].([]string)
+	if !ok {
+		return Int64SliceResult{Result: nil, Err: ErrInvalidOperation}
+	}
+
+	results, err := store.CMSQuery(cmd.Key, items)
+	return Int64SliceResult{Result: results, Err: err}
+}
+
+// executeCMSInfo returns information about the Count-Min sketch
+// Args: []
+func executeCMSInfo(cmd *Command, store *storage.Store) interface{} {
+	info, err := store.CMSInfo(cmd.Key)
+	if err != nil {
+		return CountMinSketchInfoResult{Info: nil, Err: err}
+	}
+
+	return CountMinSketchInfoResult{Info: info, Err: nil}
+}
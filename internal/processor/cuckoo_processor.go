@@ -0,0 +1,151 @@
+package processor
+
+import (
+	"redis/internal/storage"
+)
+
+// CuckooFilterInfoResult wraps a CuckooFilterInfo result
+type CuckooFilterInfoResult struct {
+	Info *storage.CuckooFilterInfo
+	Err  error
+}
+
+// executeCuckooCommand routes Cuckoo filter commands to their executors
+func (p *Processor) executeCuckooCommand(cmd *Command) {
+	var result interface{}
+
+	switch cmd.Type {
+	case CmdCFReserve:
+		result = executeCFReserve(cmd, p.store)
+	case CmdCFAdd:
+		result = executeCFAdd(cmd, p.store)
+	case CmdCFExists:
+		result = executeCFExists(cmd, p.store)
+	case CmdCFDel:
+		result = executeCFDel(cmd, p.store)
+	case CmdCFCount:
+		result = executeCFCount(cmd, p.store)
+	case CmdCFInfo:
+		result = executeCFInfo(cmd, p.store)
+	default:
+		result = IntResult{Result: 0, Err: ErrInvalidOperation}
+	}
+
+	cmd.Response <- result
+}
+
+// executeCFReserve creates a new Cuckoo filter
+// Args: [capacity]
+func executeCFReserve(cmd *Command, store *storage.Store) interface{} {
+	if len(cmd.Args) < 1 {
+		return StringResult{Result: "", Err: ErrInvalidOperation}
+	}
+
+	capacity, ok := cmd.Args[0].(uint64)
+	if !ok {
+		return StringResult{Result: "", Err: ErrInvalidOperation}
+	}
+
+	if err := store.CFReserve(cmd.Key, capacity); err != nil {
+		return StringResult{Result: "", Err: err}
+	}
+
+	return StringResult{Result: "OK", Err: nil}
+}
+
+// executeCFAdd adds an item to the Cuckoo filter
+// Args: [item]
+func executeCFAdd(cmd *Command, store *storage.Store) interface{} {
+	if len(cmd.Args) < 1 {
+		return IntResult{Result: 0, Err: ErrInvalidOperation}
+	}
+
+	item, ok := cmd.Args[0].(string)
+	if !ok {
+		return IntResult{Result: 0, Err: ErrInvalidOperation}
+	}
+
+	if err := store.CFAdd(cmd.Key, item); err != nil {
+		return IntResult{Result: 0, Err: err}
+	}
+
+	return IntResult{Result: 1, Err: nil}
+}
+
+// executeCFExists checks if an item exists in the Cuckoo filter
+// Args: [item]
+func executeCFExists(cmd *Command, store *storage.Store) interface{} {
+	if len(cmd.Args) < 1 {
+		return IntResult{Result: 0, Err: ErrInvalidOperation}
+	}
+
+	item, ok := cmd.Args[0].(string)
+	if !ok {
+		return IntResult{Result: 0, Err: ErrInvalidOperation}
+	}
+
+	exists, err := store.CFExists(cmd.Key, item)
+	if err != nil {
+		return IntResult{Result: 0, Err: err}
+	}
+
+	// Return 1 if might exist, 0 if definitely doesn't exist
+	if exists {
+		return IntResult{Result: 1, Err: nil}
+	}
+	return IntResult{Result: 0, Err: nil}
+}
+
+// executeCFDel removes one copy of an item from the Cuckoo filter
+// Args: [item]
+func executeCFDel(cmd *Command, store *storage.Store) interface{} {
+	if len(cmd.Args) < 1 {
+		return IntResult{Result: 0, Err: ErrInvalidOperation}
+	}
+
+	item, ok := cmd.Args[0].(string)
+	if !ok {
+		return IntResult{Result: 0, Err: ErrInvalidOperation}
+	}
+
+	deleted, err := store.CFDel(cmd.Key, item)
+	if err != nil {
+		return IntResult{Result: 0, Err: err}
+	}
+
+	if deleted {
+		return IntResult{Result: 1, Err: nil}
+	}
+	return IntResult{Result: 0, Err: nil}
+}
+
+// executeCFCount returns how many times an item may have been added
+// Args: [item]
+func executeCFCount(cmd *Command, store *storage.Store) interface{} {
+	if len(cmd.Args) < 1 {
+		return IntResult{Result: 0, Err: ErrInvalidOperation}
+	}
+
+	item, ok := cmd.Args[0].(string)
+	if !ok {
+		return IntResult{Result: 0, Err: ErrInvalidOperation}
+	}
+
+	count, err := store.CFCount(cmd.Key, item)
+	if err != nil {
+		return IntResult{Result: 0, Err: err}
+	}
+
+	return IntResult{Result: int(count), Err: nil}
+}
+
+// executeCFInfo returns information about the Cuckoo filter
+// Args: []
+func executeCFInfo(cmd *Command, store *storage.Store) interface{} {
+	info, err := store.CFInfo(cmd.Key)
+	if err != nil {
+		return CuckooFilterInfoResult{Info: nil, Err: err}
+	}
+
+	return CuckooFilterInfoResult{Info: info, Err: nil}
+}
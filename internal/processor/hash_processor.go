@@ -27,6 +27,18 @@ func (p *Processor) executeHashCommand(cmd *Command) {
 		p.executeHIncrBy(cmd)
 	case CmdHIncrByFloat:
 		p.executeHIncrByFloat(cmd)
+	case CmdHRandField:
+		p.executeHRandField(cmd)
+	case CmdHExpire:
+		p.executeHExpire(cmd)
+	case CmdHTTL:
+		p.executeHTTL(cmd)
+	case CmdHPersist:
+		p.executeHPersist(cmd)
+	case CmdHGetDel:
+		p.executeHGetDel(cmd)
+	case CmdHGetEx:
+		p.executeHGetEx(cmd)
 	}
 }
 
@@ -85,7 +97,7 @@ func (p *Processor) executeHVals(cmd *Command) {
 
 // executeHGetAll returns all field-value pairs in a hash
 func (p *Processor) executeHGetAll(cmd *Command) {
-	result, err := p.store.HGetAll(cmd.Key)
+	result, err := p.store.HGetAllContext(cmd.Context(), cmd.Key)
 	cmd.Response <- StringSliceResult{Result: result, Err: err}
 }
 
@@ -112,3 +124,50 @@ func (p *Processor) executeHIncrByFloat(cmd *Command) {
 	result, err := p.store.HIncrByFloat(cmd.Key, field, increment)
 	cmd.Response <- Float64Result{Result: result, Err: err}
 }
+
+// executeHRandField returns random fields from a hash
+func (p *Processor) executeHRandField(cmd *Command) {
+	count := cmd.Args[0].(int)
+	withValues := cmd.Args[1].(bool)
+	result, err := p.store.HRandField(cmd.Key, count, withValues)
+	cmd.Response <- StringSliceResult{Result: result, Err: err}
+}
+
+// executeHExpire sets the expiry time of hash fields
+// Args: [condition string, fields []string]; the absolute expiry is in cmd.Expiry
+func (p *Processor) executeHExpire(cmd *Command) {
+	condition := cmd.Args[0].(string)
+	fields := cmd.Args[1].([]string)
+	result, err := p.store.HExpireAt(cmd.Key, *cmd.Expiry, condition, fields)
+	cmd.Response <- IntSliceResult{Result: result, Err: err}
+}
+
+// executeHTTL returns the remaining TTL of hash fields in milliseconds
+func (p *Processor) executeHTTL(cmd *Command) {
+	fields := cmd.Args[0].([]string)
+	result, err := p.store.HFieldTTL(cmd.Key, fields)
+	cmd.Response <- Int64SliceResult{Result: result, Err: err}
+}
+
+// executeHPersist removes the TTL of hash fields
+func (p *Processor) executeHPersist(cmd *Command) {
+	fields := cmd.Args[0].([]string)
+	result, err := p.store.HPersist(cmd.Key, fields)
+	cmd.Response <- IntSliceResult{Result: result, Err: err}
+}
+
+// executeHGetDel returns the values of hash fields and deletes them
+func (p *Processor) executeHGetDel(cmd *Command) {
+	fields := cmd.Args[0].([]string)
+	result, err := p.store.HGetDel(cmd.Key, fields)
+	cmd.Response <- InterfaceSliceResult{Result: result, Err: err}
+}
+
+// executeHGetEx returns the values of hash fields and updates their TTL
+// Args: [fields []string, persist bool]; the new absolute expiry (if any) is in cmd.Expiry
+func (p *Processor) executeHGetEx(cmd *Command) {
+	fields := cmd.Args[0].([]string)
+	persist := cmd.Args[1].(bool)
+	result, err := p.store.HGetEx(cmd.Key, fields, cmd.Expiry, persist)
+	cmd.Response <- InterfaceSliceResult{Result: result, Err: err}
+}
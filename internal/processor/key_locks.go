@@ -0,0 +1,33 @@
+package processor
+
+// stripedCommands are the commands that run on the stripes of their keys
+// when per-key locking is on (see Submit). Their store methods touch only
+// the values of their own keys and what the store guards itself
+var stripedCommands = map[CommandType]bool{
+	CmdGet: true, CmdSet: true, CmdDelete: true, CmdExists: true, CmdTTL: true,
+	CmdIncr: true, CmdIncrBy: true, CmdDecr: true, CmdDecrBy: true,
+	CmdAppend: true, CmdStrLen: true, CmdGetRange: true, CmdSetRange: true,
+}
+
+// stripedKeys returns the keys whose stripes cmd locks
+// EXISTS with several keys carries them in Args[0]
+func stripedKeys(cmd *Command) []string {
+	if cmd.Type == CmdExists && len(cmd.Args) > 0 {
+		if keys, ok := cmd.Args[0].([]string); ok {
+			return keys
+		}
+	}
+	return []string{cmd.Key}
+}
+
+// executeStriped runs cmd on the calling goroutine, holding the stripes of
+// its keys, and replies on cmd.Response like the processor goroutine would
+func (p *Processor) executeStriped(cmd *Command) {
+	p.exclusive.RLock()
+	defer p.exclusive.RUnlock()
+
+	unlock := p.store.LockKeys(stripedKeys(cmd)...)
+	defer unlock()
+
+	p.runCommand(cmd, make(chan interface{}, 1))
+}
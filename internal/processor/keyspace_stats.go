@@ -0,0 +1,57 @@
+package processor
+
+import "sync/atomic"
+
+// KeyspaceStats counts key lookups made by read commands
+// A hit is a lookup of a key that exists and has not expired; anything else
+// is a miss, so hits / (hits + misses) is the cache hit ratio
+type KeyspaceStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// keyspaceStats holds the counters; INFO reads them from other goroutines
+type keyspaceStats struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// keyspaceReadCommands are the single-key read commands whose lookup of
+// cmd.Key counts towards keyspace hits and misses
+var keyspaceReadCommands = map[CommandType]bool{
+	CmdGet: true, CmdTTL: true, CmdStrLen: true, CmdGetRange: true,
+	CmdGetBit: true, CmdBitCount: true, CmdBitPos: true,
+	CmdLLen: true, CmdLRange: true, CmdLIndex: true, CmdLPos: true,
+	CmdHGet: true, CmdHMGet: true, CmdHExists: true, CmdHLen: true, CmdHKeys: true,
+	CmdHVals: true, CmdHGetAll: true, CmdHRandField: true, CmdHTTL: true,
+	CmdSIsMember: true, CmdSMembers: true, CmdSCard: true, CmdSRandMember: true,
+	CmdZScore: true, CmdZRank: true, CmdZRevRank: true, CmdZCard: true, CmdZCount: true,
+	CmdZRange: true, CmdZRevRange: true, CmdZRangeByScore: true, CmdZRevRangeByScore: true,
+	CmdGeoPos: true, CmdGeoDist: true, CmdGeoHash: true, CmdGeoRadius: true, CmdGeoRadiusByMember: true,
+	CmdBFExists: true, CmdBFMExists: true, CmdBFInfo: true,
+	CmdCFExists: true, CmdCFCount: true, CmdCFInfo: true,
+	CmdCMSQuery: true, CmdCMSInfo: true,
+}
+
+// recordKeyspaceLookup counts a read command's lookup of its key as a hit
+// or a miss, before the command runs
+// An expired key is removed here, exactly as the command itself would
+func (p *Processor) recordKeyspaceLookup(cmd *Command) {
+	if !keyspaceReadCommands[cmd.Type] {
+		return
+	}
+
+	if p.store.Exists(cmd.Key) {
+		p.keyspace.hits.Add(1)
+	} else {
+		p.keyspace.misses.Add(1)
+	}
+}
+
+// KeyspaceStats returns the keyspace hit and miss counters
+func (p *Processor) KeyspaceStats() KeyspaceStats {
+	return KeyspaceStats{
+		Hits:   p.keyspace.hits.Load(),
+		Misses: p.keyspace.misses.Load(),
+	}
+}
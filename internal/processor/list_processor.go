@@ -25,9 +25,23 @@ func (p *Processor) executeListCommand(cmd *Command) {
 		p.executeLTrim(cmd)
 	case CmdLInsert:
 		p.executeLInsert(cmd)
+	case CmdLMPop:
+		p.executeLMPop(cmd)
+	case CmdLPos:
+		p.executeLPos(cmd)
 	}
 }
 
+// executeLMPop pops elements from the first non-empty list of several
+// Args: [keys []string, left bool, count int]
+func (p *Processor) executeLMPop(cmd *Command) {
+	keys := cmd.Args[0].([]string)
+	left := cmd.Args[1].(bool)
+	count := cmd.Args[2].(int)
+	key, elements, err := p.store.LMPop(keys, left, count)
+	cmd.Response <- MPopResult{Key: key, Elements: elements, Err: err}
+}
+
 // executeLPush prepends values to a list
 func (p *Processor) executeLPush(cmd *Command) {
 	values := cmd.Args[0].([]string)
@@ -66,7 +80,7 @@ func (p *Processor) executeLLen(cmd *Command) {
 func (p *Processor) executeLRange(cmd *Command) {
 	start := cmd.Args[0].(int)
 	stop := cmd.Args[1].(int)
-	result, err := p.store.LRange(cmd.Key, start, stop)
+	result, err := p.store.LRangeContext(cmd.Context(), cmd.Key, start, stop)
 	cmd.Response <- StringSliceResult{Result: result, Err: err}
 }
 
@@ -93,6 +107,17 @@ func (p *Processor) executeLRem(cmd *Command) {
 	cmd.Response <- IntResult{Result: result, Err: err}
 }
 
+// executeLPos returns the indexes of the elements matching a value
+// Args: [value string, rank int, count int, maxLen int]
+func (p *Processor) executeLPos(cmd *Command) {
+	value := cmd.Args[0].(string)
+	rank := cmd.Args[1].(int)
+	count := cmd.Args[2].(int)
+	maxLen := cmd.Args[3].(int)
+	result, err := p.store.LPos(cmd.Key, value, rank, count, maxLen)
+	cmd.Response <- IntSliceResult{Result: result, Err: err}
+}
+
 // executeLTrim trims a list to the specified range
 func (p *Processor) executeLTrim(cmd *Command) {
 	start := cmd.Args[0].(int)
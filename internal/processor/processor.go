@@ -3,6 +3,8 @@ package processor
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"redis/internal/storage"
@@ -16,7 +18,9 @@ const (
 	CmdDelete
 	CmdExists
 	CmdKeys
+	CmdScan
 	CmdFlush
+	CmdDBSize
 	CmdCleanup
 	CmdExpire
 	CmdTTL
@@ -24,8 +28,26 @@ const (
 	CmdIncrBy
 	CmdDecr
 	CmdDecrBy
+	CmdAppend
+	CmdStrLen
+	CmdGetRange
+	CmdSetRange
+	CmdObjectEncoding
+	CmdDebugObject
+	CmdDebugDumpJSON
+	CmdDebugDigest
+	CmdDebugDigestValue
+	CmdDebugListpackEntries
+	CmdDebugConvert
+	CmdMemoryStats
+	CmdMemoryUsage
+	CmdEncodingStats
+	CmdCopy
+	CmdDump
+	CmdRestore
 	CmdSnapshot     // For AOF rewrite (returns [][]string commands)
 	CmdDataSnapshot // For RDB snapshots (returns map[string]*Value)
+	CmdScript       // Runs a Lua script with exclusive store access (Args[0] is func())
 	// List commands
 	CmdLPush
 	CmdRPush
@@ -38,6 +60,7 @@ const (
 	CmdLRem
 	CmdLTrim
 	CmdLInsert
+	CmdLMPop
 	// Hash commands
 	CmdHSet
 	CmdHGet
@@ -51,6 +74,12 @@ const (
 	CmdHSetNX
 	CmdHIncrBy
 	CmdHIncrByFloat
+	CmdHRandField
+	CmdHExpire
+	CmdHTTL
+	CmdHPersist
+	CmdHGetDel
+	CmdHGetEx
 	// Set commands
 	CmdSAdd
 	CmdSRem
@@ -83,6 +112,7 @@ const (
 	CmdZPopMax
 	CmdZRemRangeByScore
 	CmdZRemRangeByRank
+	CmdZMPop
 	// Geospatial commands
 	CmdGeoAdd
 	CmdGeoPos
@@ -97,6 +127,19 @@ const (
 	CmdBFExists
 	CmdBFMExists
 	CmdBFInfo
+	CmdBFInsert
+	// Cuckoo Filter commands
+	CmdCFReserve
+	CmdCFAdd
+	CmdCFExists
+	CmdCFDel
+	CmdCFCount
+	CmdCFInfo
+	// Count-Min Sketch commands
+	CmdCMSInitByDim
+	CmdCMSIncrBy
+	CmdCMSQuery
+	CmdCMSInfo
 	// HyperLogLog commands
 	CmdPFAdd
 	CmdPFCount
@@ -116,6 +159,10 @@ const (
 	CmdUnsubscribe
 	CmdPSubscribe
 	CmdPUnsubscribe
+	// Keyspace replacement (DEBUG RELOAD)
+	CmdReplaceDataset
+	// List commands added later; appended so existing values don't shift
+	CmdLPos
 )
 
 // Result types for command responses
@@ -129,6 +176,13 @@ type StringSliceResult struct {
 	Err    error
 }
 
+// ScanResult is the cursor to continue from and the keys returned by one SCAN call
+type ScanResult struct {
+	Cursor uint64
+	Keys   []string
+	Err    error
+}
+
 type IndexResult struct {
 	Value  string
 	Exists bool
@@ -138,6 +192,9 @@ type IndexResult struct {
 type GetResult struct {
 	Value  interface{}
 	Exists bool
+
+	// Negative is set by GET when the key is a negative-cache tombstone
+	Negative bool
 }
 
 type Int64Result struct {
@@ -165,6 +222,40 @@ type BoolSliceResult struct {
 	Err     error
 }
 
+type IntSliceResult struct {
+	Result []int
+	Err    error
+}
+
+type Int64SliceResult struct {
+	Result []int64
+	Err    error
+}
+
+// ZAddIncrResult is the reply of ZADD ... INCR
+// Applied is false when NX/XX/GT/LT suppressed the increment
+type ZAddIncrResult struct {
+	Score   float64
+	Applied bool
+	Err     error
+}
+
+// MPopResult is the reply of LMPOP: the key popped from and its elements
+// Key is empty when every list was empty
+type MPopResult struct {
+	Key      string
+	Elements []string
+	Err      error
+}
+
+// ZMPopResult is the reply of ZMPOP: the key popped from and its members
+// Key is empty when every sorted set was empty
+type ZMPopResult struct {
+	Key     string
+	Members []storage.ZSetMember
+	Err     error
+}
+
 type InterfaceSliceResult struct {
 	Result []interface{}
 	Err    error
@@ -175,11 +266,20 @@ type Command struct {
 	Key      string
 	Value    interface{}
 	Expiry   *time.Time
-	Args     []interface{} // Additional arguments for complex commands
-	ClientID int64         // Client ID for pub/sub subscriptions
+	Args     []interface{}   // Additional arguments for complex commands
+	ClientID int64           // Client ID for pub/sub subscriptions
+	Ctx      context.Context // Optional deadline; long-running operations abort when it is done
 	Response chan interface{}
 }
 
+// Context returns the command's context, or a background context if none was set
+func (c *Command) Context() context.Context {
+	if c.Ctx == nil {
+		return context.Background()
+	}
+	return c.Ctx
+}
+
 // GetSubscriberID returns a string representation of the client ID for pub/sub
 func (c *Command) GetSubscriberID() string {
 	if c.ClientID == 0 {
@@ -191,21 +291,76 @@ func (c *Command) GetSubscriberID() string {
 // CommandExecutor is a function type for command executors
 type CommandExecutor func(cmd *Command)
 
+// ActiveExpireConfig controls the background (active) expiry cycle
+type ActiveExpireConfig struct {
+	Interval   time.Duration // How often a cycle runs
+	SampleSize int           // Keys with a TTL sampled per iteration
+	TimeBudget time.Duration // Max time a single cycle may spend deleting keys
+}
+
+// DefaultActiveExpireConfig returns Redis-like active expiry defaults
+func DefaultActiveExpireConfig() ActiveExpireConfig {
+	return ActiveExpireConfig{
+		Interval:   100 * time.Millisecond,
+		SampleSize: 20,
+		TimeBudget: 1 * time.Millisecond,
+	}
+}
+
 type Processor struct {
 	store       *storage.Store
 	commandChan chan *Command
 	ctx         context.Context
 	cancel      context.CancelFunc
 	executors   map[CommandType]CommandExecutor
+
+	// Active expiry
+	expireConfig   ActiveExpireConfig
+	expirePaused   bool                // Set by DEBUG SET-ACTIVE-EXPIRE 0
+	onKeysExpired  func(keys []string) // Called with keys removed by lazy or active expiry
+	expireConfigMu sync.RWMutex
+
+	// Called with sliding expiries extended by GET
+	onExpiriesRefreshed func(refreshed []storage.RefreshedExpiry)
+
+	// Keyspace hits and misses of read commands
+	keyspace keyspaceStats
+
+	// heldReply takes the executor's reply so it reaches the handler only
+	// after the command's expiries were propagated (see executeCommand)
+	heldReply chan interface{}
+
+	// With per-key locking, commands on the processor goroutine hold
+	// exclusive while commands on stripes hold it shared (see Submit);
+	// propagateMu keeps a command's reply behind the expiries it caused
+	// even when another command drains them (see runCommand)
+	exclusive   sync.RWMutex
+	propagateMu sync.Mutex
+
+	// Submitters blocked in WaitForCapacity; while there are any, every
+	// command taken off the queue closes queueRoom to wake them
+	roomWaiters atomic.Int32
+	roomMu      sync.Mutex
+	queueRoom   chan struct{}
 }
 
 func NewProcessor(store *storage.Store) *Processor {
+	return NewProcessorWithConfig(store, DefaultActiveExpireConfig())
+}
+
+// NewProcessorWithConfig creates a processor with a custom active expiry configuration
+func NewProcessorWithConfig(store *storage.Store, expireConfig ActiveExpireConfig) *Processor {
+	if expireConfig.Interval <= 0 {
+		expireConfig.Interval = DefaultActiveExpireConfig().Interval
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	p := &Processor{
-		store:       store,
-		commandChan: make(chan *Command, 1000),
-		ctx:         ctx,
-		cancel:      cancel,
+		store:        store,
+		commandChan:  make(chan *Command, 1000),
+		ctx:          ctx,
+		cancel:       cancel,
+		expireConfig: expireConfig,
+		heldReply:    make(chan interface{}, 1),
 	}
 	p.registerExecutors()
 	go p.run()
@@ -218,6 +373,44 @@ func (p *Processor) GetStore() *storage.Store {
 	return p.store
 }
 
+// SetExpiredKeysCallback sets the callback invoked with keys removed by lazy or
+// active expiry (used to propagate DEL to AOF and replicas)
+func (p *Processor) SetExpiredKeysCallback(callback func(keys []string)) {
+	p.expireConfigMu.Lock()
+	defer p.expireConfigMu.Unlock()
+	p.onKeysExpired = callback
+}
+
+// SetRefreshedExpiriesCallback sets the callback invoked with sliding
+// expiries extended by GET (used to propagate the new deadlines to AOF and replicas)
+func (p *Processor) SetRefreshedExpiriesCallback(callback func(refreshed []storage.RefreshedExpiry)) {
+	p.expireConfigMu.Lock()
+	defer p.expireConfigMu.Unlock()
+	p.onExpiriesRefreshed = callback
+}
+
+// GetActiveExpireConfig returns the current active expiry configuration
+func (p *Processor) GetActiveExpireConfig() ActiveExpireConfig {
+	p.expireConfigMu.RLock()
+	defer p.expireConfigMu.RUnlock()
+	return p.expireConfig
+}
+
+// SetActiveExpireEnabled pauses or resumes the active expiry cycle
+// Lazy expiry on access keeps working while the cycle is paused
+func (p *Processor) SetActiveExpireEnabled(enabled bool) {
+	p.expireConfigMu.Lock()
+	defer p.expireConfigMu.Unlock()
+	p.expirePaused = !enabled
+}
+
+// IsActiveExpireEnabled reports whether the active expiry cycle is running
+func (p *Processor) IsActiveExpireEnabled() bool {
+	p.expireConfigMu.RLock()
+	defer p.expireConfigMu.RUnlock()
+	return !p.expirePaused
+}
+
 // registerExecutors initializes the executor map
 func (p *Processor) registerExecutors() {
 	p.executors = make(map[CommandType]CommandExecutor)
@@ -243,6 +436,12 @@ func (p *Processor) registerExecutors() {
 	// Bloom Filter commands
 	p.registerBloomExecutors()
 
+	// Cuckoo Filter commands
+	p.registerCuckooExecutors()
+
+	// Count-Min Sketch commands
+	p.registerCountMinExecutors()
+
 	// HyperLogLog commands
 	p.registerHyperLogLogExecutors()
 
@@ -255,14 +454,22 @@ func (p *Processor) registerExecutors() {
 	// Snapshot commands for AOF rewrite and RDB snapshots
 	p.executors[CmdSnapshot] = p.executeSnapshot
 	p.executors[CmdDataSnapshot] = p.executeDataSnapshot
+
+	// Lua scripts
+	p.executors[CmdScript] = p.executeScript
 }
 
 // registerStringExecutors registers string command executors
 func (p *Processor) registerStringExecutors() {
 	stringCmds := []CommandType{
 		CmdSet, CmdGet, CmdDelete, CmdExists,
-		CmdKeys, CmdFlush, CmdCleanup, CmdExpire, CmdTTL,
+		CmdKeys, CmdScan, CmdFlush, CmdDBSize, CmdCleanup, CmdExpire, CmdTTL,
 		CmdIncr, CmdIncrBy, CmdDecr, CmdDecrBy,
+		CmdAppend, CmdStrLen, CmdGetRange, CmdSetRange,
+		CmdObjectEncoding, CmdDebugObject, CmdDebugDumpJSON, CmdDebugDigest,
+		CmdDebugDigestValue, CmdDebugListpackEntries, CmdDebugConvert,
+		CmdMemoryStats, CmdMemoryUsage, CmdEncodingStats, CmdCopy, CmdDump, CmdRestore,
+		CmdReplaceDataset,
 	}
 	for _, cmdType := range stringCmds {
 		p.executors[cmdType] = p.executeStringCommand
@@ -274,6 +481,7 @@ func (p *Processor) registerListExecutors() {
 	listCmds := []CommandType{
 		CmdLPush, CmdRPush, CmdLPop, CmdRPop, CmdLLen,
 		CmdLRange, CmdLIndex, CmdLSet, CmdLRem, CmdLTrim, CmdLInsert,
+		CmdLMPop, CmdLPos,
 	}
 	for _, cmdType := range listCmds {
 		p.executors[cmdType] = p.executeListCommand
@@ -285,7 +493,8 @@ func (p *Processor) registerHashExecutors() {
 	hashCmds := []CommandType{
 		CmdHSet, CmdHGet, CmdHMGet, CmdHDel, CmdHExists,
 		CmdHLen, CmdHKeys, CmdHVals, CmdHGetAll, CmdHSetNX,
-		CmdHIncrBy, CmdHIncrByFloat,
+		CmdHIncrBy, CmdHIncrByFloat, CmdHRandField,
+		CmdHExpire, CmdHTTL, CmdHPersist, CmdHGetDel, CmdHGetEx,
 	}
 	for _, cmdType := range hashCmds {
 		p.executors[cmdType] = p.executeHashCommand
@@ -310,7 +519,7 @@ func (p *Processor) registerZSetExecutors() {
 		CmdZAdd, CmdZRem, CmdZScore, CmdZRank, CmdZRevRank,
 		CmdZCard, CmdZRange, CmdZRevRange, CmdZRangeByScore, CmdZRevRangeByScore,
 		CmdZIncrBy, CmdZCount, CmdZPopMin, CmdZPopMax,
-		CmdZRemRangeByScore, CmdZRemRangeByRank,
+		CmdZRemRangeByScore, CmdZRemRangeByRank, CmdZMPop,
 	}
 	for _, cmdType := range zsetCmds {
 		p.executors[cmdType] = p.executeZSetCommand
@@ -332,13 +541,34 @@ func (p *Processor) registerGeoExecutors() {
 func (p *Processor) registerBloomExecutors() {
 	bloomCmds := []CommandType{
 		CmdBFReserve, CmdBFAdd, CmdBFMAdd,
-		CmdBFExists, CmdBFMExists, CmdBFInfo,
+		CmdBFExists, CmdBFMExists, CmdBFInfo, CmdBFInsert,
 	}
 	for _, cmdType := range bloomCmds {
 		p.executors[cmdType] = p.executeBloomCommand
 	}
 }
 
+// registerCuckooExecutors registers Cuckoo filter command executors
+func (p *Processor) registerCuckooExecutors() {
+	cuckooCmds := []CommandType{
+		CmdCFReserve, CmdCFAdd, CmdCFExists,
+		CmdCFDel, CmdCFCount, CmdCFInfo,
+	}
+	for _, cmdType := range cuckooCmds {
+		p.executors[cmdType] = p.executeCuckooCommand
+	}
+}
+
+// registerCountMinExecutors registers Count-Min sketch command executors
+func (p *Processor) registerCountMinExecutors() {
+	cmsCmds := []CommandType{
+		CmdCMSInitByDim, CmdCMSIncrBy, CmdCMSQuery, CmdCMSInfo,
+	}
+	for _, cmdType := range cmsCmds {
+		p.executors[cmdType] = p.executeCountMinCommand
+	}
+}
+
 // registerHyperLogLogExecutors registers HyperLogLog command executors
 func (p *Processor) registerHyperLogLogExecutors() {
 	hllCmds := []CommandType{
@@ -377,7 +607,10 @@ func (p *Processor) run() {
 			// Drain remaining commands before exiting
 			p.drainCommands()
 			return
-		case cmd := <-p.commandChan:
+		case cmd, ok := <-p.commandChan:
+			if !ok {
+				return // Closed by Shutdown
+			}
 			p.executeCommand(cmd)
 		}
 	}
@@ -386,7 +619,10 @@ func (p *Processor) run() {
 func (p *Processor) drainCommands() {
 	for {
 		select {
-		case cmd := <-p.commandChan:
+		case cmd, ok := <-p.commandChan:
+			if !ok {
+				return // Closed by Shutdown
+			}
 			p.executeCommand(cmd)
 		default:
 			// Channel empty
@@ -395,14 +631,90 @@ func (p *Processor) drainCommands() {
 	}
 }
 
+// executeCommand runs a command and then propagates the expiries it caused
+// The handler logs and replicates a write once it has the reply, so the reply
+// is held back until the DELs of keys the command found expired were handed
+// off: in the AOF and on replicas they come before the command, as the
+// command itself saw the keys already gone
 func (p *Processor) executeCommand(cmd *Command) {
+	p.signalQueueRoom() // cmd left the queue
+	if p.store.KeyLocksEnabled() {
+		p.exclusive.Lock()
+		defer p.exclusive.Unlock()
+	}
+	p.runCommand(cmd, p.heldReply)
+}
+
+// runCommand runs cmd with its reply held in heldReply, a buffered channel
+// of one, until the expiries it caused were propagated
+// With per-key locking commands on stripes run concurrently, and one of them
+// may drain the expiries another caused. The drain and its callbacks run
+// under propagateMu, so the command that caused them can't take the lock and
+// reply before they were handed off
+func (p *Processor) runCommand(cmd *Command, heldReply chan interface{}) {
+	reply := cmd.Response
 	if executor, exists := p.executors[cmd.Type]; exists {
-		executor(cmd)
+		p.recordKeyspaceLookup(cmd)
+		// The submitter reads cmd.Response concurrently, so the executor
+		// replies through a copy rather than a rewritten field
+		held := *cmd
+		if reply != nil {
+			held.Response = heldReply
+		}
+		executor(&held)
+	}
+
+	p.propagateMu.Lock()
+	p.propagateExpiredKeys()
+	p.propagateRefreshedExpiries()
+	p.propagateMu.Unlock()
+
+	// Executors reply exactly once, into the buffered channel
+	select {
+	case result := <-heldReply:
+		reply <- result
+	default:
 	}
 }
 
+// propagateExpiredKeys hands keys removed by lazy or active expiry during the
+// last command to the expired-keys callback. The store records a key only when
+// it actually removes it, and only this goroutine touches the store, so every
+// expired key produces exactly one DEL no matter which path noticed it first
+func (p *Processor) propagateExpiredKeys() {
+	expired := p.store.DrainExpiredKeys()
+	if len(expired) == 0 {
+		return
+	}
+
+	p.expireConfigMu.RLock()
+	callback := p.onKeysExpired
+	p.expireConfigMu.RUnlock()
+	if callback != nil {
+		callback(expired)
+	}
+}
+
+// propagateRefreshedExpiries hands sliding expiries extended during the last
+// command to the refreshed-expiries callback
+func (p *Processor) propagateRefreshedExpiries() {
+	refreshed := p.store.DrainRefreshedExpiries()
+	if len(refreshed) == 0 {
+		return
+	}
+
+	p.expireConfigMu.RLock()
+	callback := p.onExpiriesRefreshed
+	p.expireConfigMu.RUnlock()
+	if callback != nil {
+		callback(refreshed)
+	}
+}
+
+// periodicCleanup runs the active expiry cycle on every tick
+// Removed keys are propagated by executeCommand like lazily expired ones
 func (p *Processor) periodicCleanup() {
-	ticker := time.NewTicker(100 * time.Millisecond)
+	ticker := time.NewTicker(p.GetActiveExpireConfig().Interval)
 	defer ticker.Stop()
 
 	for {
@@ -410,6 +722,10 @@ func (p *Processor) periodicCleanup() {
 		case <-p.ctx.Done():
 			return
 		case <-ticker.C:
+			if !p.IsActiveExpireEnabled() {
+				continue
+			}
+
 			cmd := &Command{
 				Type:     CmdCleanup,
 				Response: make(chan interface{}, 1),
@@ -420,10 +736,103 @@ func (p *Processor) periodicCleanup() {
 	}
 }
 
+// Submit queues cmd for the processor goroutine
+// With per-key locking (key-lock-stripes), the single-key string commands in
+// stripedCommands instead run right away on the caller's goroutine, holding
+// the stripes of their keys: commands on different stripes run in parallel,
+// commands on one key still one at a time. Commands on the processor
+// goroutine wait for every stripe holder to finish and keep new ones out,
+// so everything else still sees the store to itself
 func (p *Processor) Submit(cmd *Command) {
+	if p.store.KeyLocksEnabled() && stripedCommands[cmd.Type] {
+		p.executeStriped(cmd)
+		return
+	}
 	p.commandChan <- cmd
 }
 
+// KeyspaceSize returns the number of keys and how many of them have a TTL
+func (p *Processor) KeyspaceSize() (keys int, expires int) {
+	cmd := &Command{
+		Type:     CmdDBSize,
+		Response: make(chan interface{}, 1),
+	}
+	p.Submit(cmd)
+	res := (<-cmd.Response).(IntSliceResult)
+	return res.Result[0], res.Result[1]
+}
+
+// EncodingStats returns how many list, set, hash and sorted set keys use a
+// compact or a large encoding, and how many converted from compact to large
+func (p *Processor) EncodingStats() []storage.EncodingStats {
+	cmd := &Command{
+		Type:     CmdEncodingStats,
+		Response: make(chan interface{}, 1),
+	}
+	p.Submit(cmd)
+	return (<-cmd.Response).([]storage.EncodingStats)
+}
+
+// QueueDepth returns the number of commands waiting to be executed
+func (p *Processor) QueueDepth() int {
+	return len(p.commandChan)
+}
+
+// QueueCapacity returns the maximum number of commands that can be queued
+func (p *Processor) QueueCapacity() int {
+	return cap(p.commandChan)
+}
+
+// WaitForCapacity blocks until fewer than threshold commands are queued.
+// Returns false if ctx is done first, so callers can shed load instead of
+// blocking on Submit past their deadline.
+// The processor wakes waiters each time it takes a command off the queue
+func (p *Processor) WaitForCapacity(ctx context.Context, threshold int) bool {
+	if p.QueueDepth() < threshold {
+		return true
+	}
+
+	p.roomWaiters.Add(1)
+	defer p.roomWaiters.Add(-1)
+	for {
+		// Take the signal before checking the depth: a command dequeued
+		// after the check then closes the channel waited on below
+		room := p.queueRoomSignal()
+		if p.QueueDepth() < threshold {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-room:
+		}
+	}
+}
+
+// queueRoomSignal returns the channel closed when the next command leaves the queue
+func (p *Processor) queueRoomSignal() <-chan struct{} {
+	p.roomMu.Lock()
+	defer p.roomMu.Unlock()
+	if p.queueRoom == nil {
+		p.queueRoom = make(chan struct{})
+	}
+	return p.queueRoom
+}
+
+// signalQueueRoom wakes the submitters waiting in WaitForCapacity
+// Called by the processor goroutine after taking a command off the queue
+func (p *Processor) signalQueueRoom() {
+	if p.roomWaiters.Load() == 0 {
+		return
+	}
+	p.roomMu.Lock()
+	defer p.roomMu.Unlock()
+	if p.queueRoom != nil {
+		close(p.queueRoom)
+		p.queueRoom = nil
+	}
+}
+
 func (p *Processor) Shutdown() {
 	p.cancel()
 	close(p.commandChan)
@@ -533,6 +942,19 @@ func (p *Processor) GetSnapshot() map[string]*storage.Value {
 	return result.(map[string]*storage.Value)
 }
 
+// RunScript runs fn on the processor goroutine and waits for it to return
+// Lua scripts access the store directly, so running them here makes each
+// script atomic with respect to every other command
+func (p *Processor) RunScript(fn func()) {
+	cmd := &Command{
+		Type:     CmdScript,
+		Args:     []interface{}{fn},
+		Response: make(chan interface{}, 1),
+	}
+	p.Submit(cmd)
+	<-cmd.Response
+}
+
 // GetDataSnapshot returns a shallow copy snapshot of raw storage data for RDB snapshots
 // This is used by BGSAVE to get the actual data structures, not command representations
 // Uses copy-on-write optimization - MUST call ReleaseSnapshot() when done!
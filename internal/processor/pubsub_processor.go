@@ -139,30 +139,29 @@ func (p *Processor) executeSubscribe(cmd *Command) SubscribeResult {
 		}
 	}
 
-	// Create subscriber if doesn't exist
+	// Use the subscriber built by the handler (sized by client-output-buffer-limit
+	// pubsub); PubSub keeps an already registered one instead
 	subscriberID := cmd.GetSubscriberID()
-	subscriber := &storage.Subscriber{
-		ID:       subscriberID,
-		Channels: make(chan *storage.Message, 100), // Buffered channel
+	subscriber, ok := cmd.Value.(*storage.Subscriber)
+	if !ok {
+		subscriber = storage.NewSubscriber(subscriberID, storage.DefaultSubscriberBufferSize)
 	}
 
-	// Subscribe to channels (will reuse existing subscriber if exists)
-	subscribed := p.store.PubSub.Subscribe(subscriberID, subscriber, channels...)
-
-	// Get the actual subscriber (might be reused)
-	actualSubscriber := p.store.PubSub.GetSubscriber(subscriberID)
-
-	// Create confirmation messages
-	messages := make([]*storage.Message, len(subscribed))
-	for i, channel := range subscribed {
-		count := p.store.PubSub.GetSubscriberCount(subscriberID)
-		messages[i] = &storage.Message{
+	// Subscribe one channel at a time so each confirmation carries the
+	// channel+pattern count right after that subscription, like Redis
+	messages := make([]*storage.Message, 0, len(channels))
+	for _, channel := range channels {
+		p.store.PubSub.Subscribe(subscriberID, subscriber, channel)
+		messages = append(messages, &storage.Message{
 			Type:    "subscribe",
 			Channel: channel,
-			Count:   count,
-		}
+			Count:   p.store.PubSub.GetSubscriberCount(subscriberID),
+		})
 	}
 
+	// Get the actual subscriber (might be reused)
+	actualSubscriber := p.store.PubSub.GetSubscriber(subscriberID)
+
 	return SubscribeResult{
 		Subscriber: actualSubscriber,
 		Messages:   messages,
@@ -181,21 +180,27 @@ func (p *Processor) executeUnsubscribe(cmd *Command) UnsubscribeResult {
 		}
 	}
 
-	// Unsubscribe from channels
-	unsubscribed := p.store.PubSub.Unsubscribe(subscriberID, channels...)
-
-	// Create confirmation messages
-	messages := make([]*storage.Message, len(unsubscribed))
-	totalCount := p.store.PubSub.GetSubscriberCount(subscriberID)
+	if len(channels) == 0 {
+		channels = p.store.PubSub.SubscriberChannels(subscriberID)
+	}
 
-	for i, channel := range unsubscribed {
-		// Count decreases with each unsubscription
-		count := totalCount - i
-		messages[i] = &storage.Message{
+	// Unsubscribe one channel at a time so each confirmation carries the
+	// remaining channel+pattern count (channels not subscribed leave it unchanged)
+	messages := make([]*storage.Message, 0, len(channels))
+	for _, channel := range channels {
+		p.store.PubSub.Unsubscribe(subscriberID, channel)
+		messages = append(messages, &storage.Message{
 			Type:    "unsubscribe",
 			Channel: channel,
-			Count:   count,
-		}
+			Count:   p.store.PubSub.GetSubscriberCount(subscriberID),
+		})
+	}
+
+	totalCount := p.store.PubSub.GetSubscriberCount(subscriberID)
+
+	// Redis still confirms an argument-less UNSUBSCRIBE with no subscriptions
+	if len(messages) == 0 {
+		messages = append(messages, &storage.Message{Type: "unsubscribe", Count: totalCount})
 	}
 
 	return UnsubscribeResult{
@@ -220,30 +225,29 @@ func (p *Processor) executePSubscribe(cmd *Command) SubscribeResult {
 		}
 	}
 
-	// Create subscriber if doesn't exist
+	// Use the subscriber built by the handler (sized by client-output-buffer-limit
+	// pubsub); PubSub keeps an already registered one instead
 	subscriberID := cmd.GetSubscriberID()
-	subscriber := &storage.Subscriber{
-		ID:       subscriberID,
-		Channels: make(chan *storage.Message, 100), // Buffered channel
+	subscriber, ok := cmd.Value.(*storage.Subscriber)
+	if !ok {
+		subscriber = storage.NewSubscriber(subscriberID, storage.DefaultSubscriberBufferSize)
 	}
 
-	// Subscribe to patterns (will reuse existing subscriber if exists)
-	subscribed := p.store.PubSub.PSubscribe(subscriberID, subscriber, patterns...)
-
-	// Get the actual subscriber (might be reused)
-	actualSubscriber := p.store.PubSub.GetSubscriber(subscriberID)
-
-	// Create confirmation messages
-	messages := make([]*storage.Message, len(subscribed))
-	for i, pattern := range subscribed {
-		count := p.store.PubSub.GetSubscriberCount(subscriberID)
-		messages[i] = &storage.Message{
+	// Subscribe one pattern at a time so each confirmation carries the
+	// channel+pattern count right after that subscription
+	messages := make([]*storage.Message, 0, len(patterns))
+	for _, pattern := range patterns {
+		p.store.PubSub.PSubscribe(subscriberID, subscriber, pattern)
+		messages = append(messages, &storage.Message{
 			Type:    "psubscribe",
 			Pattern: pattern,
-			Count:   count,
-		}
+			Count:   p.store.PubSub.GetSubscriberCount(subscriberID),
+		})
 	}
 
+	// Get the actual subscriber (might be reused)
+	actualSubscriber := p.store.PubSub.GetSubscriber(subscriberID)
+
 	return SubscribeResult{
 		Subscriber: actualSubscriber,
 		Messages:   messages,
@@ -262,21 +266,27 @@ func (p *Processor) executePUnsubscribe(cmd *Command) UnsubscribeResult {
 		}
 	}
 
-	// Unsubscribe from patterns
-	unsubscribed := p.store.PubSub.PUnsubscribe(subscriberID, patterns...)
-
-	// Create confirmation messages
-	messages := make([]*storage.Message, len(unsubscribed))
-	totalCount := p.store.PubSub.GetSubscriberCount(subscriberID)
+	if len(patterns) == 0 {
+		patterns = p.store.PubSub.SubscriberPatterns(subscriberID)
+	}
 
-	for i, pattern := range unsubscribed {
-		// Count decreases with each unsubscription
-		count := totalCount - i
-		messages[i] = &storage.Message{
+	// Unsubscribe one pattern at a time so each confirmation carries the
+	// remaining channel+pattern count
+	messages := make([]*storage.Message, 0, len(patterns))
+	for _, pattern := range patterns {
+		p.store.PubSub.PUnsubscribe(subscriberID, pattern)
+		messages = append(messages, &storage.Message{
 			Type:    "punsubscribe",
 			Pattern: pattern,
-			Count:   count,
-		}
+			Count:   p.store.PubSub.GetSubscriberCount(subscriberID),
+		})
+	}
+
+	totalCount := p.store.PubSub.GetSubscriberCount(subscriberID)
+
+	// Redis still confirms an argument-less PUNSUBSCRIBE with no subscriptions
+	if len(messages) == 0 {
+		messages = append(messages, &storage.Message{Type: "punsubscribe", Count: totalCount})
 	}
 
 	return UnsubscribeResult{
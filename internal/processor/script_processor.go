@@ -0,0 +1,10 @@
+package processor
+
+// executeScript runs a Lua script submitted through RunScript
+// The script reads and writes the store directly; nothing else touches the
+// store until it returns
+func (p *Processor) executeScript(cmd *Command) {
+	fn := cmd.Args[0].(func())
+	fn()
+	cmd.Response <- true
+}
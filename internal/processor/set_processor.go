@@ -57,8 +57,8 @@ func (p *Processor) executeSIsMember(cmd *Command) {
 
 // executeSMembers returns all members of a set
 func (p *Processor) executeSMembers(cmd *Command) {
-	result := p.store.SMembers(cmd.Key)
-	cmd.Response <- StringSliceResult{Result: result, Err: nil}
+	result, err := p.store.SMembersContext(cmd.Context(), cmd.Key)
+	cmd.Response <- StringSliceResult{Result: result, Err: err}
 }
 
 // executeSCard returns the cardinality (size) of a set
@@ -83,8 +83,8 @@ func (p *Processor) executeSRandMember(cmd *Command) {
 	if len(cmd.Args) > 0 {
 		count = cmd.Args[0].(int)
 	}
-	result := p.store.SRandMember(cmd.Key, count)
-	cmd.Response <- StringSliceResult{Result: result, Err: nil}
+	result, err := p.store.SRandMember(cmd.Key, count)
+	cmd.Response <- StringSliceResult{Result: result, Err: err}
 }
 
 // executeSUnion returns the union of multiple sets
@@ -1,5 +1,11 @@
 package processor
 
+import (
+	"time"
+
+	"redis/internal/storage"
+)
+
 // executeStringCommand handles string/basic commands
 func (p *Processor) executeStringCommand(cmd *Command) {
 	switch cmd.Type {
@@ -13,8 +19,14 @@ func (p *Processor) executeStringCommand(cmd *Command) {
 		p.executeExists(cmd)
 	case CmdKeys:
 		p.executeKeys(cmd)
+	case CmdScan:
+		p.executeScan(cmd)
 	case CmdFlush:
 		p.executeFlush(cmd)
+	case CmdReplaceDataset:
+		p.executeReplaceDataset(cmd)
+	case CmdDBSize:
+		p.executeDBSize(cmd)
 	case CmdCleanup:
 		p.executeCleanup(cmd)
 	case CmdExpire:
@@ -29,11 +41,60 @@ func (p *Processor) executeStringCommand(cmd *Command) {
 		p.executeDecr(cmd)
 	case CmdDecrBy:
 		p.executeDecrBy(cmd)
+	case CmdAppend:
+		p.executeAppend(cmd)
+	case CmdStrLen:
+		p.executeStrLen(cmd)
+	case CmdGetRange:
+		p.executeGetRange(cmd)
+	case CmdSetRange:
+		p.executeSetRange(cmd)
+	case CmdObjectEncoding:
+		p.executeObjectEncoding(cmd)
+	case CmdDebugObject:
+		p.executeDebugObject(cmd)
+	case CmdDebugDumpJSON:
+		p.executeDebugDumpJSON(cmd)
+	case CmdDebugDigest:
+		p.executeDebugDigest(cmd)
+	case CmdDebugDigestValue:
+		p.executeDebugDigestValue(cmd)
+	case CmdDebugListpackEntries:
+		p.executeDebugListpackEntries(cmd)
+	case CmdDebugConvert:
+		p.executeDebugConvert(cmd)
+	case CmdMemoryStats:
+		p.executeMemoryStats(cmd)
+	case CmdMemoryUsage:
+		p.executeMemoryUsage(cmd)
+	case CmdEncodingStats:
+		p.executeEncodingStats(cmd)
+	case CmdCopy:
+		p.executeCopy(cmd)
+	case CmdDump:
+		p.executeDump(cmd)
+	case CmdRestore:
+		p.executeRestore(cmd)
 	}
 }
 
 // executeSet sets a key-value pair
+// Optional storage.SetOptions in Args[0] enable NX/XX/KEEPTTL; the response is false
+// when the condition prevented the write. With opts.Get the response is an IndexResult
+// holding the previous value instead
 func (p *Processor) executeSet(cmd *Command) {
+	if len(cmd.Args) > 0 {
+		if opts, ok := cmd.Args[0].(storage.SetOptions); ok {
+			if opts.Get {
+				old, exists, err := p.store.SetGet(cmd.Key, cmd.Value, opts)
+				cmd.Response <- IndexResult{Value: old, Exists: exists, Err: err}
+				return
+			}
+			cmd.Response <- p.store.SetWithOptions(cmd.Key, cmd.Value, opts)
+			return
+		}
+	}
+
 	p.store.Set(cmd.Key, cmd.Value, cmd.Expiry)
 	cmd.Response <- true
 }
@@ -41,7 +102,10 @@ func (p *Processor) executeSet(cmd *Command) {
 // executeGet retrieves a value by key
 func (p *Processor) executeGet(cmd *Command) {
 	val, exists := p.store.Get(cmd.Key)
-	cmd.Response <- GetResult{Value: val, Exists: exists}
+	if exists {
+		p.store.RefreshSlidingTTL(cmd.Key)
+	}
+	cmd.Response <- GetResult{Value: val, Exists: exists, Negative: exists && p.store.IsNegative(cmd.Key)}
 }
 
 // executeDelete deletes one or more keys
@@ -51,31 +115,87 @@ func (p *Processor) executeDelete(cmd *Command) {
 }
 
 // executeExists checks if a key exists
+// With Args[0] as []string it instead counts how many of the keys exist, counting
+// a key once per occurrence (EXISTS a a returns 2 when a exists) and responding with an int
 func (p *Processor) executeExists(cmd *Command) {
+	if len(cmd.Args) > 0 {
+		if keys, ok := cmd.Args[0].([]string); ok {
+			count := 0
+			for _, key := range keys {
+				if p.store.Exists(key) {
+					count++
+				}
+			}
+			cmd.Response <- count
+			return
+		}
+	}
+
 	result := p.store.Exists(cmd.Key)
 	cmd.Response <- result
 }
 
 // executeKeys returns all keys matching pattern
+// Args: [pattern string]
 func (p *Processor) executeKeys(cmd *Command) {
-	keys := p.store.Keys()
-	cmd.Response <- keys
+	pattern := cmd.Args[0].(string)
+	keys, err := p.store.KeysContext(cmd.Context(), pattern)
+	cmd.Response <- StringSliceResult{Result: keys, Err: err}
+}
+
+// executeScan returns the next batch of keys for SCAN
+// Args: [cursor uint64, pattern string, count int, typeName string]
+func (p *Processor) executeScan(cmd *Command) {
+	cursor := cmd.Args[0].(uint64)
+	pattern := cmd.Args[1].(string)
+	count := cmd.Args[2].(int)
+	typeName := cmd.Args[3].(string)
+
+	next, keys, err := p.store.ScanContext(cmd.Context(), cursor, pattern, count, typeName)
+	cmd.Response <- ScanResult{Cursor: next, Keys: keys, Err: err}
 }
 
 // executeFlush clears all keys
+// Args: [async bool] (optional) - free the old keyspace on a background goroutine
 func (p *Processor) executeFlush(cmd *Command) {
+	if len(cmd.Args) > 0 {
+		if async, ok := cmd.Args[0].(bool); ok && async {
+			p.store.FlushAsync()
+			cmd.Response <- true
+			return
+		}
+	}
 	p.store.Flush()
 	cmd.Response <- true
 }
 
+// executeReplaceDataset swaps in the keyspace of the store in cmd.Value
+func (p *Processor) executeReplaceDataset(cmd *Command) {
+	p.store.ReplaceDataset(cmd.Value.(*storage.Store))
+	cmd.Response <- true
+}
+
+// executeDBSize returns the key count and the number of keys with a TTL
+func (p *Processor) executeDBSize(cmd *Command) {
+	keys, expires := p.store.DBSize()
+	cmd.Response <- IntSliceResult{Result: []int{keys, expires}}
+}
+
 // executeCleanup removes expired keys
 func (p *Processor) executeCleanup(cmd *Command) {
-	p.store.CleanupExpiredKeys()
-	cmd.Response <- true
+	cfg := p.GetActiveExpireConfig()
+	cmd.Response <- p.store.CleanupExpiredKeys(cfg.SampleSize, cfg.TimeBudget)
 }
 
 // executeExpire sets expiry on a key
+// With Args[0] as a time.Duration the expiry slides: GET extends it by that window
 func (p *Processor) executeExpire(cmd *Command) {
+	if len(cmd.Args) > 0 && cmd.Expiry != nil {
+		if window, ok := cmd.Args[0].(time.Duration); ok {
+			cmd.Response <- p.store.ExpireSliding(cmd.Key, *cmd.Expiry, window)
+			return
+		}
+	}
 	result := p.store.Expire(cmd.Key, cmd.Expiry)
 	cmd.Response <- result
 }
@@ -111,3 +231,117 @@ func (p *Processor) executeDecrBy(cmd *Command) {
 	result, err := p.store.DecrBy(cmd.Key, decrement)
 	cmd.Response <- Int64Result{Result: result, Err: err}
 }
+
+// executeAppend appends cmd.Value to the string at cmd.Key
+func (p *Processor) executeAppend(cmd *Command) {
+	result, err := p.store.Append(cmd.Key, cmd.Value.(string))
+	cmd.Response <- Int64Result{Result: result, Err: err}
+}
+
+// executeStrLen returns the length in bytes of the string at cmd.Key
+func (p *Processor) executeStrLen(cmd *Command) {
+	result, err := p.store.StrLen(cmd.Key)
+	cmd.Response <- Int64Result{Result: result, Err: err}
+}
+
+// executeGetRange returns a byte range of the string at cmd.Key
+// Args: [start int64, end int64]
+func (p *Processor) executeGetRange(cmd *Command) {
+	start := cmd.Args[0].(int64)
+	end := cmd.Args[1].(int64)
+	result, err := p.store.GetRange(cmd.Key, start, end)
+	cmd.Response <- StringResult{Result: result, Err: err}
+}
+
+// executeSetRange overwrites the string at cmd.Key from an offset
+// Args: [offset int64]; cmd.Value is the bytes to write
+func (p *Processor) executeSetRange(cmd *Command) {
+	offset := cmd.Args[0].(int64)
+	result, err := p.store.SetRange(cmd.Key, offset, cmd.Value.(string))
+	cmd.Response <- Int64Result{Result: result, Err: err}
+}
+
+// executeObjectEncoding returns the internal encoding of a key
+func (p *Processor) executeObjectEncoding(cmd *Command) {
+	encoding, exists := p.store.ObjectEncoding(cmd.Key)
+	cmd.Response <- GetResult{Value: encoding, Exists: exists}
+}
+
+// executeDebugObject returns the internal representation details of a key
+func (p *Processor) executeDebugObject(cmd *Command) {
+	info, exists := p.store.DebugObject(cmd.Key)
+	cmd.Response <- GetResult{Value: info, Exists: exists}
+}
+
+// executeDebugListpackEntries returns how many entries a key holds in listpack encoding
+func (p *Processor) executeDebugListpackEntries(cmd *Command) {
+	entries, exists := p.store.ListpackEntries(cmd.Key)
+	cmd.Response <- GetResult{Value: entries, Exists: exists}
+}
+
+// executeDebugConvert forces a listpack-encoded key into its large encoding
+func (p *Processor) executeDebugConvert(cmd *Command) {
+	encoding, err := p.store.ConvertEncoding(cmd.Key)
+	cmd.Response <- StringResult{Result: encoding, Err: err}
+}
+
+// executeDebugDumpJSON returns the JSON dump of a key
+func (p *Processor) executeDebugDumpJSON(cmd *Command) {
+	dump, err := p.store.DumpJSON(cmd.Key)
+	cmd.Response <- StringResult{Result: dump, Err: err}
+}
+
+// executeDebugDigest computes the keyspace digest
+// Runs on the processor goroutine so it sees a consistent point-in-time view
+func (p *Processor) executeDebugDigest(cmd *Command) {
+	cmd.Response <- p.store.Digest()
+}
+
+// executeMemoryStats reports key counts and estimated sizes per data type
+func (p *Processor) executeMemoryStats(cmd *Command) {
+	cmd.Response <- p.store.MemoryStatsByType()
+}
+
+// executeMemoryUsage estimates the bytes used by a key and its value
+func (p *Processor) executeMemoryUsage(cmd *Command) {
+	bytes, exists := p.store.MemoryUsage(cmd.Key)
+	cmd.Response <- GetResult{Value: bytes, Exists: exists}
+}
+
+// executeEncodingStats returns the per-type encoding counters
+func (p *Processor) executeEncodingStats(cmd *Command) {
+	cmd.Response <- p.store.EncodingStats()
+}
+
+// executeCopy copies a key's value and TTL to another key
+// Args: [destination string, replace bool]
+func (p *Processor) executeCopy(cmd *Command) {
+	dst := cmd.Args[0].(string)
+	replace := cmd.Args[1].(bool)
+	cmd.Response <- p.store.Copy(cmd.Key, dst, replace)
+}
+
+// executeDump returns a deep copy of the value at key for serialization
+func (p *Processor) executeDump(cmd *Command) {
+	val, exists := p.store.DumpValue(cmd.Key)
+	cmd.Response <- GetResult{Value: val, Exists: exists}
+}
+
+// executeRestore stores a decoded DUMP payload (cmd.Value) at key
+// Expiry comes from cmd.Expiry; Args: [replace bool]
+func (p *Processor) executeRestore(cmd *Command) {
+	replace := cmd.Args[0].(bool)
+	err := p.store.Restore(cmd.Key, cmd.Value.(*storage.Value), cmd.Expiry, replace)
+	cmd.Response <- err
+}
+
+// executeDebugDigestValue computes the value digest of each key
+// Args: [keys []string]
+func (p *Processor) executeDebugDigestValue(cmd *Command) {
+	keys := cmd.Args[0].([]string)
+	digests := make([]string, len(keys))
+	for i, key := range keys {
+		digests[i] = p.store.DigestValue(key)
+	}
+	cmd.Response <- StringSliceResult{Result: digests}
+}
@@ -37,16 +37,33 @@ func (p *Processor) executeZSetCommand(cmd *Command) {
 		p.executeZRemRangeByScore(cmd)
 	case CmdZRemRangeByRank:
 		p.executeZRemRangeByRank(cmd)
+	case CmdZMPop:
+		p.executeZMPop(cmd)
 	default:
 		cmd.Response <- IntResult{Result: 0, Err: nil}
 	}
 }
 
 // executeZAdd adds one or more members with scores to a sorted set
+// Optional Args[1] (storage.ZAddOptions) and Args[2] (incr bool) carry the ZADD flags;
+// with INCR the response is a ZAddIncrResult instead of an IntResult
 func (p *Processor) executeZAdd(cmd *Command) {
 	members := cmd.Args[0].([]storage.ZSetMember)
-	count := p.store.ZAdd(cmd.Key, members)
-	cmd.Response <- IntResult{Result: count}
+	if len(cmd.Args) < 3 {
+		count := p.store.ZAdd(cmd.Key, members)
+		cmd.Response <- IntResult{Result: count}
+		return
+	}
+
+	opts := cmd.Args[1].(storage.ZAddOptions)
+	if cmd.Args[2].(bool) {
+		score, applied, err := p.store.ZAddIncr(cmd.Key, members[0].Member, members[0].Score, opts)
+		cmd.Response <- ZAddIncrResult{Score: score, Applied: applied, Err: err}
+		return
+	}
+
+	count, err := p.store.ZAddWithOptions(cmd.Key, members, opts)
+	cmd.Response <- IntResult{Result: count, Err: err}
 }
 
 // executeZRem removes one or more members from a sorted set
@@ -171,6 +188,16 @@ func (p *Processor) executeZPopMax(cmd *Command) {
 	cmd.Response <- member
 }
 
+// executeZMPop pops members from the first non-empty sorted set of several
+// Args: [keys []string, max bool, count int]
+func (p *Processor) executeZMPop(cmd *Command) {
+	keys := cmd.Args[0].([]string)
+	max := cmd.Args[1].(bool)
+	count := cmd.Args[2].(int)
+	key, members, err := p.store.ZMPop(keys, max, count)
+	cmd.Response <- ZMPopResult{Key: key, Members: members, Err: err}
+}
+
 // executeZRemRangeByScore removes all members with scores in range [min, max]
 func (p *Processor) executeZRemRangeByScore(cmd *Command) {
 	min := cmd.Args[0].(float64)
@@ -3,31 +3,114 @@ package protocol
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 type Command struct {
 	Args []string
+	ctx  context.Context
 }
 
-func ParseCommand(reader *bufio.Reader) (*Command, error) {
-	line, err := readLine(reader)
-	if err != nil {
-		return nil, err
+// Context returns the command's execution context (background if none was attached)
+func (c *Command) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
 	}
+	return c.ctx
+}
 
-	if len(line) == 0 {
-		return nil, fmt.Errorf("empty command")
-	}
+// WithContext returns a shallow copy of the command carrying ctx
+// Used to pass the per-command timeout down to long-running operations
+func (c *Command) WithContext(ctx context.Context) *Command {
+	copied := *c
+	copied.ctx = ctx
+	return &copied
+}
 
-	switch line[0] {
-	case '*':
-		return parseArray(reader, line)
-	default:
-		return parseInline(line)
+// DefaultMaxBulkLen is the default proto-max-bulk-len (512MB, same as Redis)
+const DefaultMaxBulkLen = 512 * 1024 * 1024
+
+// MaxMultiBulkLen caps the number of arguments in a single request (same as Redis)
+const MaxMultiBulkLen = 1024 * 1024
+
+// MaxInlineLen caps a protocol line, such as an inline command, so a client
+// that never sends a newline can't make the server buffer without bound
+// (64KB, same as Redis)
+const MaxInlineLen = 64 * 1024
+
+// maxBulkLen is the largest bulk string a request may declare
+var maxBulkLen atomic.Int64
+
+func init() {
+	maxBulkLen.Store(DefaultMaxBulkLen)
+}
+
+// SetMaxBulkLen sets proto-max-bulk-len, the largest accepted bulk string
+func SetMaxBulkLen(n int64) {
+	maxBulkLen.Store(n)
+}
+
+// MaxBulkLen returns the current proto-max-bulk-len
+func MaxBulkLen() int64 {
+	return maxBulkLen.Load()
+}
+
+// ProtocolError reports a malformed request after which the stream cannot be
+// resynchronized; callers should reply and close the connection
+type ProtocolError struct {
+	Msg string
+}
+
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.Msg
+}
+
+// IsProtocolError reports whether err is a fatal ProtocolError
+func IsProtocolError(err error) bool {
+	var protoErr *ProtocolError
+	return errors.As(err, &protoErr)
+}
+
+func ParseCommand(reader *bufio.Reader) (*Command, error) {
+	for {
+		// A frame header is held to the same length as an inline command
+		tooBig := errTooBigInline
+		if first, err := reader.Peek(1); err == nil && first[0] == '*' {
+			tooBig = errTooBigMultiBulk
+		}
+		line, err := readLineLimited(reader, tooBig)
+		if err != nil {
+			return nil, err
+		}
+
+		// Like Redis, silently skip blank lines sent by telnet-style clients
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		switch line[0] {
+		case '*', '>', '~', '%':
+			// RESP3 push (>), set (~) and map (%) frames carry arguments like an array
+			return parseArray(reader, line)
+		case '_', ',', '#', '(':
+			// Stray RESP3 scalar frame (null, double, boolean, big number):
+			// there is nothing to execute, skip it instead of failing the connection
+			continue
+		case '=':
+			// Stray RESP3 verbatim string: consume its payload and skip it
+			if _, err := readBulkPayload(reader, line); err != nil {
+				return nil, err
+			}
+			continue
+		default:
+			return parseInline(line)
+		}
 	}
 }
 
@@ -40,60 +123,250 @@ func parseArray(reader *bufio.Reader, firstLine string) (*Command, error) {
 	if count <= 0 {
 		return nil, fmt.Errorf("invalid array length: %d", count)
 	}
+	if count > MaxMultiBulkLen {
+		return nil, &ProtocolError{Msg: "invalid multibulk length"}
+	}
+	if firstLine[0] == '%' {
+		// A map of N entries holds N keys and N values
+		count *= 2
+	}
 
-	args := make([]string, 0, count)
+	// The count is only a claim until the arguments arrive, so it bounds
+	// the allocation only up to a point
+	args := make([]string, 0, min(count, 1024))
 
 	for i := 0; i < count; i++ {
-		line, err := readLine(reader)
+		arg, err := parseArgument(reader)
 		if err != nil {
 			return nil, err
 		}
+		args = append(args, arg)
+	}
 
-		if len(line) == 0 || line[0] != '$' {
-			return nil, fmt.Errorf("expected bulk string, got: %s", line)
-		}
+	return &Command{Args: args}, nil
+}
 
-		length, err := strconv.Atoi(line[1:])
-		if err != nil {
-			return nil, fmt.Errorf("invalid bulk string length: %v", err)
-		}
+// parseArgument reads a single element of a command array
+// Besides bulk strings, RESP3 scalar types are accepted and converted to their
+// textual value so a client that negotiated the wrong protocol still works
+func parseArgument(reader *bufio.Reader) (string, error) {
+	line, err := readLineLimited(reader, errTooBigBulk)
+	if err != nil {
+		return "", err
+	}
 
-		if length < 0 {
-			args = append(args, "")
-			continue
-		}
+	if len(line) == 0 {
+		return "", fmt.Errorf("expected bulk string, got: %s", line)
+	}
 
-		data := make([]byte, length)
-		_, err = io.ReadFull(reader, data)
+	switch line[0] {
+	case '$':
+		return readBulkPayload(reader, line)
+	case '=':
+		// Verbatim string: payload is "fmt:data", the 3-byte format is dropped
+		data, err := readBulkPayload(reader, line)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
-
-		_, err = readLine(reader)
-		if err != nil {
-			return nil, err
+		if len(data) >= 4 && data[3] == ':' {
+			data = data[4:]
+		}
+		return data, nil
+	case '+', ':', ',', '(':
+		return line[1:], nil
+	case '#':
+		if line[1:] == "t" {
+			return "1", nil
 		}
+		return "0", nil
+	case '_':
+		return "", nil
+	default:
+		return "", fmt.Errorf("expected bulk string, got: %s", line)
+	}
+}
 
-		args = append(args, string(data))
+// readBulkPayload reads the body of a length-prefixed string ($ or =) whose
+// header line has already been consumed; a negative length yields ""
+func readBulkPayload(reader *bufio.Reader, header string) (string, error) {
+	length, err := strconv.Atoi(header[1:])
+	if err != nil {
+		return "", fmt.Errorf("invalid bulk string length: %v", err)
 	}
 
-	return &Command{Args: args}, nil
+	if length < 0 {
+		return "", nil
+	}
+
+	// Refuse oversized bulks before allocating the buffer
+	if int64(length) > MaxBulkLen() {
+		return "", &ProtocolError{Msg: "invalid bulk length"}
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(reader, data)
+	if err != nil {
+		return "", err
+	}
+
+	// Skip the CRLF after the payload, like Redis does
+	if _, err := reader.Discard(2); err != nil {
+		return "", err
+	}
+
+	return string(data), nil
 }
 
+// parseInline parses an inline command (space-separated text, as sent by telnet
+// or health-check probes). Quoting follows Redis: "double quotes" support escapes
+// like \n and \x41, 'single quotes' are taken literally.
 func parseInline(line string) (*Command, error) {
-	args := strings.Fields(line)
+	args, err := splitInlineArgs(line)
+	if err != nil {
+		return nil, err
+	}
 	if len(args) == 0 {
 		return nil, fmt.Errorf("empty command")
 	}
 	return &Command{Args: args}, nil
 }
 
-func readLine(reader *bufio.Reader) (string, error) {
-	line, err := reader.ReadString('\n')
-	if err != nil {
-		return "", err
+// splitInlineArgs splits an inline command line into arguments
+func splitInlineArgs(line string) ([]string, error) {
+	args := make([]string, 0, 4)
+	i := 0
+
+	for {
+		// Skip whitespace between arguments
+		for i < len(line) && isInlineSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+
+		var current []byte
+		inDouble, inSingle := false, false
+
+		for done := false; !done; {
+			switch {
+			case inDouble:
+				if i >= len(line) {
+					return nil, fmt.Errorf("Protocol error: unbalanced quotes in request")
+				}
+				c := line[i]
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					b, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					current = append(current, byte(b))
+					i += 3
+				} else if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						current = append(current, '\n')
+					case 'r':
+						current = append(current, '\r')
+					case 't':
+						current = append(current, '\t')
+					case 'b':
+						current = append(current, '\b')
+					case 'a':
+						current = append(current, '\a')
+					default:
+						current = append(current, line[i])
+					}
+				} else if c == '"' {
+					// Closing quote must be followed by a space or end of line
+					if i+1 < len(line) && !isInlineSpace(line[i+1]) {
+						return nil, fmt.Errorf("Protocol error: unbalanced quotes in request")
+					}
+					done = true
+				} else {
+					current = append(current, c)
+				}
+			case inSingle:
+				if i >= len(line) {
+					return nil, fmt.Errorf("Protocol error: unbalanced quotes in request")
+				}
+				c := line[i]
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					current = append(current, '\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isInlineSpace(line[i+1]) {
+						return nil, fmt.Errorf("Protocol error: unbalanced quotes in request")
+					}
+					done = true
+				} else {
+					current = append(current, c)
+				}
+			default:
+				if i >= len(line) {
+					done = true
+					break
+				}
+				c := line[i]
+				switch {
+				case isInlineSpace(c):
+					done = true
+				case c == '"' && len(current) == 0:
+					inDouble = true
+				case c == '\'' && len(current) == 0:
+					inSingle = true
+				default:
+					current = append(current, c)
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+
+		args = append(args, string(current))
+	}
+}
+
+func isInlineSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// Errors returned for a line longer than MaxInlineLen, by the kind of line
+var (
+	errTooBigInline    = &ProtocolError{Msg: "too big inline request"}
+	errTooBigMultiBulk = &ProtocolError{Msg: "too big mbulk count string"}
+	errTooBigBulk      = &ProtocolError{Msg: "too big bulk count string"}
+	errTooBigLine      = &ProtocolError{Msg: "too big line"}
+)
+
+// ReadLine reads a line of at most MaxInlineLen bytes, without its newline,
+// for readers of a RESP stream other than ParseCommand (e.g. a replica
+// reading its master's stream)
+func ReadLine(reader *bufio.Reader) (string, error) {
+	return readLineLimited(reader, errTooBigLine)
+}
+
+// readLineLimited reads a line of at most MaxInlineLen bytes, without its
+// newline, returning tooBig for a longer one
+func readLineLimited(reader *bufio.Reader, tooBig error) (string, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(line)+len(chunk) > MaxInlineLen+2 {
+			return "", tooBig
+		}
+		line = append(line, chunk...)
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return "", err
+		}
 	}
-	return strings.TrimRight(line, "\r\n"), nil
+	return strings.TrimRight(string(line), "\r\n"), nil
 }
 
 // HasCompleteCommand checks if the buffer contains at least one complete RESP command
@@ -113,130 +386,135 @@ func HasCompleteCommand(reader *bufio.Reader) bool {
 	return hasCompleteRESP(buf)
 }
 
-// hasCompleteRESP checks if buf contains a complete RESP message
+// Results of argumentEnd and bulkEnd besides an index past the element
+const (
+	frameIncomplete = -1 // more bytes are needed
+	frameMalformed  = -2 // ParseCommand fails without reading further
+)
+
+// hasCompleteRESP checks if buf holds enough for ParseCommand to return
+// without blocking. It follows ParseCommand prefix by prefix; anything it
+// cannot vouch for counts as incomplete, which only costs an early flush
 func hasCompleteRESP(buf []byte) bool {
-	if len(buf) == 0 {
-		return false
-	}
+	for {
+		line, next := nextLine(buf, 0)
+		if next < 0 {
+			return false
+		}
 
-	switch buf[0] {
-	case '*':
-		// Array (most common for commands)
-		return hasCompleteArray(buf)
-	case '$':
-		// Bulk string
-		return hasCompleteBulkString(buf)
-	case '+', '-', ':':
-		// Simple string, error, or integer - just needs CRLF
-		return bytes.Contains(buf, []byte("\r\n"))
-	default:
-		// Inline command - just needs newline
-		return bytes.Contains(buf, []byte("\n"))
+		// Blank lines are skipped by ParseCommand, so look past them
+		if len(bytes.TrimSpace(line)) == 0 {
+			buf = buf[next:]
+			continue
+		}
+
+		switch line[0] {
+		case '*', '>', '~', '%':
+			return hasCompleteArray(buf, line, next)
+		case '_', ',', '#', '(':
+			// Stray RESP3 scalar, skipped by ParseCommand
+			buf = buf[next:]
+		case '=':
+			// Stray verbatim string, skipped once its payload is read
+			end := bulkEnd(buf, line, next)
+			if end == frameIncomplete {
+				return false
+			}
+			if end == frameMalformed {
+				return true
+			}
+			buf = buf[end:]
+		default:
+			// Inline command
+			return true
+		}
 	}
 }
 
-// hasCompleteArray checks if buf contains a complete RESP array
-func hasCompleteArray(buf []byte) bool {
-	// Find first CRLF to get array count
-	crlfIdx := bytes.Index(buf, []byte("\r\n"))
-	if crlfIdx == -1 {
-		return false
+// hasCompleteArray checks if the array whose header line ends at next is
+// complete; a header ParseCommand rejects is complete, as it will not block
+func hasCompleteArray(buf, header []byte, next int) bool {
+	count, err := strconv.Atoi(string(header[1:]))
+	if err != nil || count <= 0 || count > MaxMultiBulkLen {
+		return true
 	}
-
-	// Parse array count
-	countStr := string(buf[1:crlfIdx])
-	count, err := strconv.Atoi(countStr)
-	if err != nil || count <= 0 {
-		return count == 0 // Empty array is complete
+	if header[0] == '%' {
+		count *= 2
 	}
 
-	// Move past the array header
-	idx := crlfIdx + 2
-
-	// Check each element
+	idx := next
 	for i := 0; i < count; i++ {
-		if idx >= len(buf) {
+		end := argumentEnd(buf, idx)
+		if end == frameIncomplete {
 			return false
 		}
-
-		switch buf[idx] {
-		case '$':
-			// Bulk string
-			endIdx := hasCompleteBulkStringAt(buf, idx)
-			if endIdx == -1 {
-				return false
-			}
-			idx = endIdx
-		case ':':
-			// Integer
-			nextCRLF := bytes.Index(buf[idx:], []byte("\r\n"))
-			if nextCRLF == -1 {
-				return false
-			}
-			idx += nextCRLF + 2
-		case '+', '-':
-			// Simple string or error
-			nextCRLF := bytes.Index(buf[idx:], []byte("\r\n"))
-			if nextCRLF == -1 {
-				return false
-			}
-			idx += nextCRLF + 2
-		default:
-			return false
+		if end == frameMalformed {
+			return true
 		}
+		idx = end
 	}
-
 	return true
 }
 
-// hasCompleteBulkString checks if buf starts with a complete bulk string
-func hasCompleteBulkString(buf []byte) bool {
-	return hasCompleteBulkStringAt(buf, 0) != -1
-}
-
-// hasCompleteBulkStringAt checks if a complete bulk string starts at idx
-// Returns the index after the bulk string, or -1 if incomplete
-func hasCompleteBulkStringAt(buf []byte, idx int) int {
-	if idx >= len(buf) || buf[idx] != '$' {
-		return -1
+// argumentEnd returns the index past the array element at idx, as read by
+// parseArgument
+func argumentEnd(buf []byte, idx int) int {
+	line, next := nextLine(buf, idx)
+	if next < 0 {
+		return frameIncomplete
 	}
-
-	// Find CRLF after length
-	remaining := buf[idx:]
-	crlfIdx := bytes.Index(remaining, []byte("\r\n"))
-	if crlfIdx == -1 {
-		return -1
+	if len(line) == 0 {
+		return frameMalformed
 	}
 
-	// Parse length
-	lengthStr := string(remaining[1:crlfIdx])
-	length, err := strconv.Atoi(lengthStr)
-	if err != nil {
-		return -1
+	switch line[0] {
+	case '$', '=':
+		return bulkEnd(buf, line, next)
+	case '+', ':', ',', '(', '#', '_':
+		return next
+	default:
+		return frameMalformed
 	}
+}
 
-	// Null bulk string
+// bulkEnd returns the index past the payload of the length-prefixed string
+// whose header line ends at next, as read by readBulkPayload
+func bulkEnd(buf, header []byte, next int) int {
+	length, err := strconv.Atoi(string(header[1:]))
+	if err != nil || int64(length) > MaxBulkLen() {
+		return frameMalformed
+	}
 	if length < 0 {
-		return idx + crlfIdx + 2
+		return next
 	}
-
-	// Check if we have enough bytes: $N\r\n + data + \r\n
-	totalNeeded := crlfIdx + 2 + length + 2
-	if len(remaining) < totalNeeded {
-		return -1
+	if len(buf)-next < length+2 {
+		return frameIncomplete
 	}
+	return next + length + 2
+}
 
-	return idx + totalNeeded
+// nextLine returns the line starting at idx without its line ending, and the
+// index past its newline, or -1 if the newline has not arrived
+func nextLine(buf []byte, idx int) ([]byte, int) {
+	nl := bytes.IndexByte(buf[idx:], '\n')
+	if nl < 0 {
+		return nil, -1
+	}
+	return bytes.TrimRight(buf[idx:idx+nl], "\r\n"), idx + nl + 1
 }
 
 func EncodeSimpleString(s string) []byte {
 	return []byte(fmt.Sprintf("+%s\r\n", s))
 }
 
+// EncodeError encodes an error reply. Line breaks (a Lua traceback, say)
+// would end the reply early and desync the client, so they become spaces
 func EncodeError(s string) []byte {
-	return []byte(fmt.Sprintf("-%s\r\n", s))
+	return []byte(fmt.Sprintf("-%s\r\n", errorLineReplacer.Replace(s)))
 }
 
+var errorLineReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
 func EncodeInteger(i int) []byte {
 	return []byte(fmt.Sprintf(":%d\r\n", i))
 }
@@ -283,6 +561,27 @@ func EncodeRawArray(items [][]byte) []byte {
 	return result
 }
 
+// EncodePush encodes a RESP3 push of already-encoded elements
+// Pushes are out-of-band data (client tracking invalidations) that a RESP3
+// client tells apart from command replies by their '>' type
+func EncodePush(items [][]byte) []byte {
+	result := []byte(fmt.Sprintf(">%d\r\n", len(items)))
+	for _, item := range items {
+		result = append(result, item...)
+	}
+	return result
+}
+
+// EncodeRawMap encodes a RESP3 map from already-encoded items, given as
+// alternating keys and values
+func EncodeRawMap(items [][]byte) []byte {
+	result := []byte(fmt.Sprintf("%%%d\r\n", len(items)/2))
+	for _, item := range items {
+		result = append(result, item...)
+	}
+	return result
+}
+
 // EncodeInterfaceArray encodes an array that may contain nil values
 func EncodeInterfaceArray(items []interface{}) []byte {
 	result := fmt.Sprintf("*%d\r\n", len(items))
@@ -0,0 +1,145 @@
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// parse runs ParseCommand over input
+func parse(input string) (*Command, error) {
+	return ParseCommand(bufio.NewReader(strings.NewReader(input)))
+}
+
+// Inline commands are accepted up to MaxInlineLen; a longer line, with or
+// without its newline, is a protocol error rather than unbounded buffering
+func TestInlineLineLimit(t *testing.T) {
+	longest := "ECHO " + strings.Repeat("a", MaxInlineLen-len("ECHO "))
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"inline command", "PING\r\n", false},
+		{"longest inline command", longest + "\r\n", false},
+		{"inline command over the limit", longest + "a\r\n", true},
+		{"line never terminated", strings.Repeat("a", 4*MaxInlineLen), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := parse(tt.input)
+			if tt.wantErr {
+				if !IsProtocolError(err) {
+					t.Fatalf("ParseCommand = %v, %v, want a protocol error", cmd, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCommand: %v", err)
+			}
+			if got := strings.Join(cmd.Args, " "); got != strings.TrimSuffix(tt.input, "\r\n") {
+				t.Fatalf("ParseCommand args = %.40q...", got)
+			}
+		})
+	}
+}
+
+// Multibulk and bulk headers are held to the same line limit, and a bulk
+// length over proto-max-bulk-len is refused before its payload is allocated
+func TestHeaderLimits(t *testing.T) {
+	defer SetMaxBulkLen(MaxBulkLen())
+	SetMaxBulkLen(1024)
+	digits := strings.Repeat("1", 2*MaxInlineLen)
+
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"oversized multibulk header", "*" + digits + "\r\n", errTooBigMultiBulk},
+		{"oversized bulk header", "*1\r\n$" + digits + "\r\n", errTooBigBulk},
+		{"bulk length over the cap", "*1\r\n$1025\r\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := parse(tt.input)
+			if !IsProtocolError(err) {
+				t.Fatalf("ParseCommand = %v, %v, want a protocol error", cmd, err)
+			}
+			if tt.want != nil && err != tt.want {
+				t.Fatalf("ParseCommand error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	cmd, err := parse("*1\r\n$1024\r\n" + strings.Repeat("a", 1024) + "\r\n")
+	if err != nil || len(cmd.Args[0]) != 1024 {
+		t.Fatalf("bulk at the cap = %v, %v", cmd, err)
+	}
+}
+
+// A frame is complete only once all of it is buffered, whatever RESP3 types
+// it carries, so the pipeline never blocks in a read with replies unflushed
+func TestHasCompleteRESPSplitFrames(t *testing.T) {
+	frames := []struct {
+		name  string
+		frame string
+	}{
+		{"array of bulks", "*2\r\n$3\r\nGET\r\n$1\r\nk\r\n"},
+		{"null bulk", "*2\r\n$4\r\nECHO\r\n$-1\r\n"},
+		{"push", ">2\r\n$4\r\nECHO\r\n$1\r\na\r\n"},
+		{"set", "~2\r\n$4\r\nECHO\r\n$1\r\na\r\n"},
+		{"map", "%1\r\n$4\r\nECHO\r\n$1\r\na\r\n"},
+		{"RESP3 scalars", "*7\r\n$4\r\nECHO\r\n,1.5\r\n(12345\r\n#t\r\n_\r\n+ok\r\n:1\r\n"},
+		{"verbatim string", "*2\r\n$4\r\nECHO\r\n=7\r\ntxt:abc\r\n"},
+		{"after stray scalars", "_\r\n,1.5\r\n#f\r\n(1\r\n*1\r\n$4\r\nPING\r\n"},
+		{"after stray verbatim string", "=7\r\ntxt:abc\r\n*1\r\n$4\r\nPING\r\n"},
+		{"after blank lines", "\r\n\r\n*1\r\n$4\r\nPING\r\n"},
+		{"inline", "PING\r\n"},
+		{"bare LF line endings", "*1\n$4\nPING\r\n"},
+	}
+	for _, tt := range frames {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parse(tt.frame); err != nil {
+				t.Fatalf("ParseCommand(%q): %v", tt.frame, err)
+			}
+			if !hasCompleteRESP([]byte(tt.frame)) {
+				t.Fatalf("hasCompleteRESP(%q) = false", tt.frame)
+			}
+			for i := 1; i < len(tt.frame); i++ {
+				if hasCompleteRESP([]byte(tt.frame[:i])) {
+					t.Fatalf("hasCompleteRESP(%q) = true for a partial frame", tt.frame[:i])
+				}
+			}
+		})
+	}
+}
+
+// Whatever the buffer holds, a complete verdict means ParseCommand returns
+// without reading past it
+func TestHasCompleteRESPNeverBlocks(t *testing.T) {
+	inputs := []string{
+		"*1\r\n?x\r\n",
+		"*0\r\n",
+		"*x\r\n",
+		"*1\r\n$x\r\n",
+		"*1\r\n\r\n",
+		"*1\r\n=x\r\n",
+		"=x\r\n",
+		"*2\r\n$3\r\nGET\r\n",
+		"%1\r\n$3\r\nGET\r\n",
+		"*1\r\n$3\r\nGET",
+		"=7\r\ntxt:abc\r\n",
+		"_\r\n",
+	}
+	for _, input := range inputs {
+		_, err := parse(input)
+		blocks := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if hasCompleteRESP([]byte(input)) && blocks {
+			t.Errorf("hasCompleteRESP(%q) = true, but ParseCommand needs more: %v", input, err)
+		}
+	}
+}
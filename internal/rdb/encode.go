@@ -0,0 +1,369 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"math"
+	"time"
+
+	"redis/internal/storage"
+)
+
+// ErrBadDumpPayload is returned by DecodeDump when the payload is truncated,
+// was produced by a newer RDB version or fails its checksum
+var ErrBadDumpPayload = errors.New("ERR DUMP payload version or checksum are wrong")
+
+// WriteEntry writes one key in RDB format: the optional sliding window,
+// tombstone and expiry opcodes, the type byte, the key and the value payload
+// Types without an RDB encoding (Bloom filters, HyperLogLogs) are skipped
+// This is the single per-type encoder shared by BGSAVE, replication full
+// sync and DUMP, so every path serializes values the same way
+func WriteEntry(writer io.Writer, key string, value *storage.Value) error {
+	typeByte, ok := valueTypeByte(value)
+	if !ok {
+		return nil
+	}
+
+	// Write expiry if exists
+	if value.ExpiresAt != nil && time.Now().Before(*value.ExpiresAt) {
+		writeKeyMetadata(writer, value)
+		writer.Write([]byte{OpCodeExpireTimeMS})
+		binary.Write(writer, binary.LittleEndian, value.ExpiresAt.UnixMilli())
+	}
+
+	writer.Write([]byte{typeByte})
+	writeString(writer, key)
+	writeObject(writer, value)
+	return nil
+}
+
+// EncodeDump serializes a value the way DUMP returns it: the sliding window
+// and tombstone opcodes if the key has them, the type byte and payload from
+// the RDB encoder,
+// followed by the 2-byte RDB version and a CRC64 of everything before it
+// The key's TTL is not part of the payload; RESTORE takes it as an argument
+func EncodeDump(value *storage.Value) ([]byte, error) {
+	typeByte, ok := valueTypeByte(value)
+	if !ok {
+		return nil, fmt.Errorf("ERR DUMP is not supported for this data type")
+	}
+
+	var body bytes.Buffer
+	writeKeyMetadata(&body, value)
+	body.WriteByte(typeByte)
+	writeObject(&body, value)
+	return frameDump(body.Bytes()), nil
+}
+
+// DumpPayload frames an already RDB-encoded object as a DUMP payload
+// Used by loaders that read the RDB format themselves and hand opaque
+// values to RESTORE
+func DumpPayload(typeByte byte, object []byte) []byte {
+	return frameDump(append([]byte{typeByte}, object...))
+}
+
+// frameDump appends the RDB version and the CRC64 to a DUMP payload body
+func frameDump(body []byte) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(body)+10))
+	buf.Write(body)
+	binary.Write(buf, binary.LittleEndian, uint16(RDBVersion))
+
+	checksum := crc64.Checksum(buf.Bytes(), crc64.MakeTable(crc64.ECMA))
+	binary.Write(buf, binary.LittleEndian, checksum)
+	return buf.Bytes()
+}
+
+// DumpLength returns the byte length of the payload EncodeDump produces for
+// a value, by running the same encoder into a byte counter
+func DumpLength(value *storage.Value) (int, error) {
+	if _, ok := valueTypeByte(value); !ok {
+		return 0, fmt.Errorf("ERR DUMP is not supported for this data type")
+	}
+
+	var counter byteCounter
+	writeKeyMetadata(&counter, value)
+	writeObject(&counter, value)
+
+	// Metadata + type byte + payload + RDB version + checksum
+	return int(counter) + 1 + 2 + 8, nil
+}
+
+// writeKeyMetadata writes the opcodes that carry per-key state other than
+// the value and its deadline: the window of a sliding expiry and the
+// negative-cache flag
+// Both only exist on keys with a TTL
+func writeKeyMetadata(writer io.Writer, value *storage.Value) {
+	if value.ExpiresAt == nil {
+		return
+	}
+	if value.SlidingTTL != 0 {
+		writer.Write([]byte{OpCodeSlidingTTL})
+		binary.Write(writer, binary.LittleEndian, value.SlidingTTL.Milliseconds())
+	}
+	if value.Negative {
+		writer.Write([]byte{OpCodeNegative})
+	}
+}
+
+// byteCounter is an io.Writer that only counts the bytes written to it
+type byteCounter int
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// DecodeDump parses a DUMP payload back into a value without an expiry
+// A sliding window or tombstone flag in the payload is kept; RESTORE drops
+// them without a TTL
+func DecodeDump(payload []byte) (*storage.Value, error) {
+	// Type byte + RDB version + checksum at minimum
+	if len(payload) < 11 {
+		return nil, ErrBadDumpPayload
+	}
+
+	footer := len(payload) - 10
+	version := binary.LittleEndian.Uint16(payload[footer:])
+	checksum := binary.LittleEndian.Uint64(payload[footer+2:])
+	if version > RDBVersion || checksum != crc64.Checksum(payload[:footer+2], crc64.MakeTable(crc64.ECMA)) {
+		return nil, ErrBadDumpPayload
+	}
+
+	body := payload[:footer]
+	var sliding time.Duration
+	if body[0] == OpCodeSlidingTTL {
+		if len(body) < 10 {
+			return nil, ErrBadDumpPayload
+		}
+		window, ok := slidingWindow(binary.LittleEndian.Uint64(body[1:9]))
+		if !ok {
+			return nil, ErrBadDumpPayload
+		}
+		sliding = window
+		body = body[9:]
+	}
+	negative := false
+	if body[0] == OpCodeNegative {
+		if len(body) < 2 {
+			return nil, ErrBadDumpPayload
+		}
+		negative = true
+		body = body[1:]
+	}
+
+	r := &Reader{reader: bufio.NewReader(bytes.NewReader(body[1:]))}
+	data, _, err := r.readValue(body[0])
+	if err != nil {
+		return nil, ErrBadDumpPayload
+	}
+	if _, err := r.reader.ReadByte(); err != io.EOF {
+		return nil, ErrBadDumpPayload // Trailing bytes after the value
+	}
+
+	value, err := newStorageValue(body[0], data)
+	if err != nil {
+		return nil, err
+	}
+	if negative && value.Type != storage.StringType {
+		return nil, ErrBadDumpPayload // Only SET writes tombstones
+	}
+	value.SlidingTTL = sliding
+	value.Negative = negative
+	return value, nil
+}
+
+// slidingWindow converts the millisecond window of OpCodeSlidingTTL to a
+// duration, rejecting zero and windows that overflow time.Duration
+func slidingWindow(ms uint64) (time.Duration, bool) {
+	if ms == 0 || ms > math.MaxInt64/uint64(time.Millisecond) {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// valueTypeByte returns the RDB type byte for a value, or false if the
+// value's type has no RDB encoding
+func valueTypeByte(value *storage.Value) (byte, bool) {
+	switch value.Type {
+	case storage.StringType:
+		if _, ok := value.StringValue(); ok {
+			return TypeString, true
+		}
+	case storage.ListType:
+		if _, ok := value.Data.(*storage.List); ok {
+			return TypeList, true
+		}
+	case storage.SetType:
+		if _, ok := value.Data.(*storage.Set); ok {
+			return TypeSet, true
+		}
+	case storage.ZSetType:
+		if _, ok := value.Data.(*storage.ZSet); ok {
+			return TypeZSet, true
+		}
+	case storage.HashType:
+		if hash, ok := value.Data.(*storage.Hash); ok {
+			if hash.HasFieldExpiries() {
+				return TypeHashFieldTTL, true
+			}
+			return TypeHash, true
+		}
+	case storage.CuckooFilterType:
+		if _, ok := value.Data.(*storage.CuckooFilter); ok {
+			return TypeCuckooFilter, true
+		}
+	case storage.CountMinSketchType:
+		if _, ok := value.Data.(*storage.CountMinSketch); ok {
+			return TypeCountMinSketch, true
+		}
+	}
+	return 0, false
+}
+
+// writeObject writes the payload of a value whose type valueTypeByte accepted
+func writeObject(writer io.Writer, value *storage.Value) {
+	switch data := value.Data.(type) {
+	case *storage.List:
+		items := data.ToSlice()
+		writeLength(writer, len(items))
+		for _, item := range items {
+			writeString(writer, item)
+		}
+
+	case *storage.Set:
+		members := data.GetMembers()
+		writeLength(writer, len(members))
+		for _, member := range members {
+			writeString(writer, member)
+		}
+
+	case *storage.ZSet:
+		members := data.GetAll()
+		writeLength(writer, len(members))
+		for _, member := range members {
+			writeString(writer, member.Member)
+			// Write score as 8-byte float64
+			binary.Write(writer, binary.LittleEndian, member.Score)
+		}
+
+	case *storage.Hash:
+		// TypeHashFieldTTL adds each field's deadline in Unix ms (0 = none)
+		withTTLs := data.HasFieldExpiries()
+		pairs := data.GetAll()
+		writeLength(writer, len(pairs)/2)
+		for i := 0; i < len(pairs); i += 2 {
+			writeString(writer, pairs[i])
+			writeString(writer, pairs[i+1])
+			if withTTLs {
+				var deadline int64
+				if at, ok := data.FieldExpiry(pairs[i]); ok {
+					deadline = at.UnixMilli()
+				}
+				binary.Write(writer, binary.LittleEndian, deadline)
+			}
+		}
+
+	case *storage.CuckooFilter:
+		// Opaque blob: header and fingerprint slots from MarshalBinary
+		writeString(writer, string(data.MarshalBinary()))
+
+	case *storage.CountMinSketch:
+		// Opaque blob: dimensions, count and counters from MarshalBinary
+		writeString(writer, string(data.MarshalBinary()))
+
+	default:
+		str, _ := value.StringValue()
+		writeString(writer, str)
+	}
+}
+
+// newStorageValue builds a store value from data decoded by readValue
+func newStorageValue(typeByte byte, data interface{}) (*storage.Value, error) {
+	switch typeByte {
+	case TypeString:
+		return &storage.Value{Data: data.(string), Type: storage.StringType}, nil
+
+	case TypeList:
+		list := storage.NewList()
+		for _, item := range data.([]string) {
+			list.PushBack(item)
+		}
+		return &storage.Value{Data: list, Type: storage.ListType}, nil
+
+	case TypeSet:
+		set := storage.NewSet()
+		for member := range data.(map[string]struct{}) {
+			set.Add(member)
+		}
+		return &storage.Value{Data: set, Type: storage.SetType}, nil
+
+	case TypeZSet:
+		zset := storage.NewZSet()
+		for _, member := range data.([]ZSetMember) {
+			zset.Add(member.Member, member.Score)
+		}
+		return &storage.Value{Data: zset, Type: storage.ZSetType}, nil
+
+	case TypeHash:
+		hash := storage.NewHash()
+		for field, val := range data.(map[string]string) {
+			hash.Set(field, val)
+		}
+		return &storage.Value{Data: hash, Type: storage.HashType}, nil
+
+	case TypeHashFieldTTL:
+		decoded := data.(hashWithFieldTTLs)
+		hash := storage.NewHash()
+		for field, val := range decoded.fields {
+			hash.Set(field, val)
+		}
+		for field, deadline := range decoded.deadlines {
+			hash.SetFieldExpiry(field, time.UnixMilli(deadline))
+		}
+		return &storage.Value{Data: hash, Type: storage.HashType}, nil
+
+	case TypeCuckooFilter:
+		cf, err := storage.UnmarshalCuckooFilter([]byte(data.(string)))
+		if err != nil {
+			return nil, ErrBadDumpPayload
+		}
+		return &storage.Value{Data: cf, Type: storage.CuckooFilterType}, nil
+
+	case TypeCountMinSketch:
+		cms, err := storage.UnmarshalCountMinSketch([]byte(data.(string)))
+		if err != nil {
+			return nil, ErrBadDumpPayload
+		}
+		return &storage.Value{Data: cms, Type: storage.CountMinSketchType}, nil
+	}
+	return nil, ErrBadDumpPayload
+}
+
+// writeString writes a length-prefixed string
+func writeString(writer io.Writer, s string) {
+	writeLength(writer, len(s))
+	writer.Write([]byte(s))
+}
+
+// writeLength writes a length-encoded integer
+func writeLength(writer io.Writer, length int) {
+	if length < 64 {
+		// 6-bit length
+		writer.Write([]byte{byte(length)})
+	} else if length < 16384 {
+		// 14-bit length
+		writer.Write([]byte{
+			byte(0x40 | (length >> 8)),
+			byte(length & 0xFF),
+		})
+	} else {
+		// 32-bit length
+		writer.Write([]byte{0x80})
+		binary.Write(writer, binary.BigEndian, uint32(length))
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"redis/internal/storage"
+	"redis/internal/version"
 )
 
 // RDB file format constants
@@ -24,16 +25,21 @@ const (
 	OpCodeExpireTimeMS = 0xFC
 	OpCodeResizeDB     = 0xFB
 	OpCodeAux          = 0xFA
+	OpCodeSlidingTTL   = 0xF4 // Window of a sliding expiry in ms (8 bytes LE), precedes the key's expiry
+	OpCodeNegative     = 0xF3 // The next key is a negative-cache tombstone (SET ... NEGATIVE), no payload
 
 	// Type codes
-	TypeString      = 0
-	TypeList        = 1
-	TypeSet         = 2
-	TypeZSet        = 3
-	TypeHash        = 4
-	TypeBloomFilter = 5
-	TypeHyperLogLog = 6
-	TypeListQuick   = 14
+	TypeString         = 0
+	TypeList           = 1
+	TypeSet            = 2
+	TypeZSet           = 3
+	TypeHash           = 4
+	TypeBloomFilter    = 5
+	TypeHyperLogLog    = 6
+	TypeCuckooFilter   = 7
+	TypeCountMinSketch = 8
+	TypeListQuick      = 14
+	TypeHashFieldTTL   = 24 // Hash with per-field TTLs: each value is followed by its deadline
 )
 
 // Writer handles RDB snapshot writes
@@ -79,12 +85,12 @@ func (w *Writer) Save(snapshot map[string]*storage.Value) error {
 
 	// Write resize DB hint
 	multiWriter.Write([]byte{OpCodeResizeDB})
-	w.writeLengthToWriter(multiWriter, len(snapshot))
-	w.writeLengthToWriter(multiWriter, 0) // Number of keys with expiry
+	writeLength(multiWriter, len(snapshot))
+	writeLength(multiWriter, 0) // Number of keys with expiry
 
 	// Write all keys
 	for key, value := range snapshot {
-		if err := w.writeKeyToWriter(multiWriter, key, value); err != nil {
+		if err := WriteEntry(multiWriter, key, value); err != nil {
 			os.Remove(tempPath)
 			return err
 		}
@@ -128,114 +134,12 @@ func (w *Writer) writeHeader(writer io.Writer) error {
 
 	// Auxiliary fields (metadata)
 	writer.Write([]byte{OpCodeAux})
-	w.writeStringToWriter(writer, "redis-ver")
-	w.writeStringToWriter(writer, "7.0.0")
+	writeString(writer, "redis-ver")
+	writeString(writer, version.Version)
 
 	writer.Write([]byte{OpCodeAux})
-	w.writeStringToWriter(writer, "ctime")
-	w.writeStringToWriter(writer, fmt.Sprintf("%d", time.Now().Unix()))
+	writeString(writer, "ctime")
+	writeString(writer, fmt.Sprintf("%d", time.Now().Unix()))
 
 	return nil
 }
-
-// writeKeyToWriter writes a single key-value pair to io.Writer (for checksum)
-func (w *Writer) writeKeyToWriter(writer io.Writer, key string, value *storage.Value) error {
-	// Write expiry if exists
-	if value.ExpiresAt != nil && time.Now().Before(*value.ExpiresAt) {
-		writer.Write([]byte{OpCodeExpireTimeMS})
-		expiryMS := value.ExpiresAt.UnixMilli()
-		binary.Write(writer, binary.LittleEndian, expiryMS)
-	}
-
-	// Write value type and data
-	switch value.Type {
-	case storage.StringType:
-		if str, ok := value.Data.(string); ok {
-			writer.Write([]byte{TypeString})
-			w.writeStringToWriter(writer, key)
-			w.writeStringToWriter(writer, str)
-		}
-
-	case storage.ListType:
-		if list, ok := value.Data.([]string); ok {
-			writer.Write([]byte{TypeList})
-			w.writeStringToWriter(writer, key)
-			w.writeLengthToWriter(writer, len(list))
-			for _, item := range list {
-				w.writeStringToWriter(writer, item)
-			}
-		}
-
-	case storage.HashType:
-		if hash, ok := value.Data.(map[string]string); ok {
-			writer.Write([]byte{TypeHash})
-			w.writeStringToWriter(writer, key)
-			w.writeLengthToWriter(writer, len(hash))
-			for field, val := range hash {
-				w.writeStringToWriter(writer, field)
-				w.writeStringToWriter(writer, val)
-			}
-		}
-
-	case storage.SetType:
-		if setStruct, ok := value.Data.(*storage.Set); ok && setStruct != nil {
-			writer.Write([]byte{TypeSet})
-			w.writeStringToWriter(writer, key)
-			w.writeLengthToWriter(writer, len(setStruct.Members))
-			for member := range setStruct.Members {
-				w.writeStringToWriter(writer, member)
-			}
-		}
-
-	case storage.ZSetType:
-		if zsetStruct, ok := value.Data.(*storage.ZSet); ok && zsetStruct != nil {
-			members := zsetStruct.GetAll()
-			writer.Write([]byte{TypeZSet})
-			w.writeStringToWriter(writer, key)
-			w.writeLengthToWriter(writer, len(members))
-			for _, member := range members {
-				w.writeStringToWriter(writer, member.Member)
-				// Write score as 8-byte float64
-				binary.Write(writer, binary.LittleEndian, member.Score)
-			}
-		}
-
-	case storage.BloomFilterType:
-		// BloomFilter serialization not yet implemented in RDB format
-		// Would require exporting internal bit array and metadata
-		// For now, skip in RDB snapshots (similar to AOF behavior)
-		// TODO: Implement BF.DUMP/BF.RESTORE commands for persistence
-
-	case storage.HyperLogLogType:
-		// HyperLogLog serialization not yet implemented in RDB format
-		// Would require exporting internal registers array
-		// For now, skip in RDB snapshots (similar to AOF behavior)
-		// TODO: Implement PFDUMP/PFRESTORE or raw register export
-	}
-
-	return nil
-}
-
-// writeStringToWriter writes a length-prefixed string to io.Writer
-func (w *Writer) writeStringToWriter(writer io.Writer, s string) {
-	w.writeLengthToWriter(writer, len(s))
-	writer.Write([]byte(s))
-}
-
-// writeLengthToWriter writes length to io.Writer (for checksum)
-func (w *Writer) writeLengthToWriter(writer io.Writer, length int) {
-	if length < 64 {
-		// 6-bit length
-		writer.Write([]byte{byte(length)})
-	} else if length < 16384 {
-		// 14-bit length
-		writer.Write([]byte{
-			byte(0x40 | (length >> 8)),
-			byte(length & 0xFF),
-		})
-	} else {
-		// 32-bit length
-		writer.Write([]byte{0x80})
-		binary.Write(writer, binary.BigEndian, uint32(length))
-	}
-}
@@ -16,16 +16,38 @@ const (
 	opEOF          = OpCodeEOF
 	opExpireTime   = OpCodeExpireTime
 	opExpireTimeMs = OpCodeExpireTimeMS
-
-	typeString      = TypeString
-	typeList        = TypeList
-	typeSet         = TypeSet
-	typeZSet        = TypeZSet
-	typeHash        = TypeHash
-	typeBloomFilter = TypeBloomFilter
-	typeHyperLogLog = TypeHyperLogLog
+	opSelectDB     = OpCodeSelectDB
+	opResizeDB     = OpCodeResizeDB
+	opAux          = OpCodeAux
+	opSlidingTTL   = OpCodeSlidingTTL
+	opNegative     = OpCodeNegative
+
+	typeString         = TypeString
+	typeList           = TypeList
+	typeSet            = TypeSet
+	typeZSet           = TypeZSet
+	typeHash           = TypeHash
+	typeBloomFilter    = TypeBloomFilter
+	typeHyperLogLog    = TypeHyperLogLog
+	typeCuckooFilter   = TypeCuckooFilter
+	typeCountMinSketch = TypeCountMinSketch
+	typeHashFieldTTL   = TypeHashFieldTTL
 )
 
+// maxPrealloc bounds the elements (or string bytes) allocated up front from a
+// length prefix. Lengths come from the file or a RESTORE payload and can't be
+// trusted, so anything larger grows as the data is actually read, keeping
+// memory proportional to the input instead of to what the prefix claims
+const maxPrealloc = 64 * 1024
+
+// preallocHint returns the capacity to allocate for length elements
+func preallocHint(length uint32) int {
+	if length > maxPrealloc {
+		return maxPrealloc
+	}
+	return int(length)
+}
+
 // Reader handles reading RDB files
 type Reader struct {
 	filepath string
@@ -64,6 +86,12 @@ type LoadCommand struct {
 	Value      interface{}
 	Expiration *time.Time
 	Type       byte
+
+	// SlidingTTL is the window of a sliding expiry, zero for a fixed one
+	SlidingTTL time.Duration
+
+	// Negative marks a negative-cache tombstone written by SET ... NEGATIVE
+	Negative bool
 }
 
 // Load reads and parses the RDB file, returning commands to restore the database
@@ -89,6 +117,8 @@ func (r *Reader) Load() ([]LoadCommand, error) {
 
 	commands := make([]LoadCommand, 0)
 	var currentExpiration *time.Time
+	var currentSliding time.Duration
+	currentNegative := false
 
 	// Create CRC64 hasher for checksum verification
 	table := crc64.MakeTable(crc64.ECMA)
@@ -136,6 +166,54 @@ func (r *Reader) Load() ([]LoadCommand, error) {
 			t := time.Unix(int64(timestamp/1000), int64((timestamp%1000)*1000000))
 			currentExpiration = &t
 
+		case opSlidingTTL:
+			// Sliding window of the next key, 8-byte milliseconds
+			var window uint64
+			if err := binary.Read(r.reader, binary.LittleEndian, &window); err != nil {
+				return nil, fmt.Errorf("failed to read sliding window: %w", err)
+			}
+			windowBytes := make([]byte, 8)
+			binary.LittleEndian.PutUint64(windowBytes, window)
+			hasher.Write(windowBytes)
+
+			sliding, ok := slidingWindow(window)
+			if !ok {
+				return nil, fmt.Errorf("invalid sliding window: %d", window)
+			}
+			currentSliding = sliding
+
+		case opNegative:
+			// The next key is a negative-cache tombstone
+			currentNegative = true
+
+		case opAux:
+			// Auxiliary metadata field (redis-ver, ctime, ...): key and value strings, ignored
+			for i := 0; i < 2; i++ {
+				_, auxBytes, err := r.readString()
+				if err != nil {
+					return nil, fmt.Errorf("failed to read aux field: %w", err)
+				}
+				hasher.Write(auxBytes)
+			}
+
+		case opSelectDB:
+			// Database selector - only DB 0 is supported, so the number is ignored
+			_, dbBytes, err := r.readLength()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read database number: %w", err)
+			}
+			hasher.Write(dbBytes)
+
+		case opResizeDB:
+			// Resize hint: key count and expiring key count, ignored
+			for i := 0; i < 2; i++ {
+				_, sizeBytes, err := r.readLength()
+				if err != nil {
+					return nil, fmt.Errorf("failed to read resize hint: %w", err)
+				}
+				hasher.Write(sizeBytes)
+			}
+
 		case opEOF:
 			// Read CRC64 checksum (8 bytes)
 			var storedChecksum uint64
@@ -160,22 +238,7 @@ func (r *Reader) Load() ([]LoadCommand, error) {
 			hasher.Write(keyBytes)
 
 			// Read value based on type
-			var value interface{}
-			var valueBytes []byte
-
-			switch typeByte {
-			case typeString:
-				value, valueBytes, err = r.readString()
-			case typeList:
-				value, valueBytes, err = r.readList()
-			case typeHash:
-				value, valueBytes, err = r.readHash()
-			case typeSet:
-				value, valueBytes, err = r.readSet()
-			case typeZSet:
-				value, valueBytes, err = r.readZSet()
-			}
-
+			value, valueBytes, err := r.readValue(typeByte)
 			if err != nil {
 				return nil, fmt.Errorf("failed to read value for key %s: %w", key, err)
 			}
@@ -186,10 +249,47 @@ func (r *Reader) Load() ([]LoadCommand, error) {
 				Value:      value,
 				Expiration: currentExpiration,
 				Type:       typeByte,
+				SlidingTTL: currentSliding,
+				Negative:   currentNegative,
 			})
 
 			// Reset expiration for next key
 			currentExpiration = nil
+			currentSliding = 0
+			currentNegative = false
+
+		case typeCuckooFilter, typeCountMinSketch, typeHashFieldTTL:
+			// Cuckoo filters, Count-Min sketches and hashes with field TTLs
+			// are loaded as a *storage.Value, which loaders restore through RESTORE rather
+			// than a per-type command
+			key, keyBytes, err := r.readString()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read key: %w", err)
+			}
+			hasher.Write(keyBytes)
+
+			data, valueBytes, err := r.readValue(typeByte)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read value for key %s: %w", key, err)
+			}
+			hasher.Write(valueBytes)
+
+			value, err := newStorageValue(typeByte, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode value for key %s: %w", key, err)
+			}
+
+			commands = append(commands, LoadCommand{
+				Key:        key,
+				Value:      value,
+				Expiration: currentExpiration,
+				Type:       typeByte,
+				SlidingTTL: currentSliding,
+				Negative:   currentNegative,
+			})
+			currentExpiration = nil
+			currentSliding = 0
+			currentNegative = false
 
 		case typeBloomFilter:
 			// BloomFilter not supported in RDB load - skip this entry
@@ -207,6 +307,28 @@ func (r *Reader) Load() ([]LoadCommand, error) {
 	}
 }
 
+// readValue reads the payload of a value of the given type and returns both
+// the decoded value and the raw bytes for hashing
+func (r *Reader) readValue(typeByte byte) (interface{}, []byte, error) {
+	switch typeByte {
+	case typeString:
+		return r.readString()
+	case typeList:
+		return r.readList()
+	case typeHash:
+		return r.readHash()
+	case typeHashFieldTTL:
+		return r.readHashFieldTTL()
+	case typeSet:
+		return r.readSet()
+	case typeZSet:
+		return r.readZSet()
+	case typeCuckooFilter, typeCountMinSketch:
+		return r.readString()
+	}
+	return nil, nil, fmt.Errorf("unknown type byte: %d", typeByte)
+}
+
 // readString reads a length-prefixed string and returns both the string and raw bytes for hashing
 func (r *Reader) readString() (string, []byte, error) {
 	// Read length
@@ -215,10 +337,22 @@ func (r *Reader) readString() (string, []byte, error) {
 		return "", nil, fmt.Errorf("failed to read string length: %w", err)
 	}
 
-	// Read string data
-	data := make([]byte, length)
-	if _, err := io.ReadFull(r.reader, data); err != nil {
-		return "", nil, fmt.Errorf("failed to read string data: %w", err)
+	// Read string data; a long one is read in chunks so a bogus length fails
+	// at the end of the input rather than allocating what it claims
+	var data []byte
+	if length <= maxPrealloc {
+		data = make([]byte, length)
+		if _, err := io.ReadFull(r.reader, data); err != nil {
+			return "", nil, fmt.Errorf("failed to read string data: %w", err)
+		}
+	} else {
+		data, err = io.ReadAll(io.LimitReader(r.reader, int64(length)))
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read string data: %w", err)
+		}
+		if uint32(len(data)) != length {
+			return "", nil, fmt.Errorf("failed to read string data: %w", io.ErrUnexpectedEOF)
+		}
 	}
 
 	// Combine length bytes and data for hashing
@@ -234,13 +368,13 @@ func (r *Reader) readList() ([]string, []byte, error) {
 	}
 
 	allBytes := lengthBytes
-	list := make([]string, length)
+	list := make([]string, 0, preallocHint(length))
 	for i := uint32(0); i < length; i++ {
 		elem, elemBytes, err := r.readString()
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to read list element %d: %w", i, err)
 		}
-		list[i] = elem
+		list = append(list, elem)
 		allBytes = append(allBytes, elemBytes...)
 	}
 
@@ -255,7 +389,7 @@ func (r *Reader) readHash() (map[string]string, []byte, error) {
 	}
 
 	allBytes := lengthBytes
-	hash := make(map[string]string, length)
+	hash := make(map[string]string, preallocHint(length))
 	for i := uint32(0); i < length; i++ {
 		field, fieldBytes, err := r.readString()
 		if err != nil {
@@ -275,6 +409,53 @@ func (r *Reader) readHash() (map[string]string, []byte, error) {
 	return hash, allBytes, nil
 }
 
+// hashWithFieldTTLs is a decoded TypeHashFieldTTL value; deadlines holds
+// the Unix ms deadline of the fields that have a TTL
+type hashWithFieldTTLs struct {
+	fields    map[string]string
+	deadlines map[string]int64
+}
+
+// readHashFieldTTL reads a hash value whose fields carry their deadline
+func (r *Reader) readHashFieldTTL() (hashWithFieldTTLs, []byte, error) {
+	length, lengthBytes, err := r.readLength()
+	if err != nil {
+		return hashWithFieldTTLs{}, nil, fmt.Errorf("failed to read hash length: %w", err)
+	}
+
+	allBytes := lengthBytes
+	hash := hashWithFieldTTLs{
+		fields:    make(map[string]string, preallocHint(length)),
+		deadlines: make(map[string]int64),
+	}
+	for i := uint32(0); i < length; i++ {
+		field, fieldBytes, err := r.readString()
+		if err != nil {
+			return hashWithFieldTTLs{}, nil, fmt.Errorf("failed to read hash field %d: %w", i, err)
+		}
+		allBytes = append(allBytes, fieldBytes...)
+
+		value, valueBytes, err := r.readString()
+		if err != nil {
+			return hashWithFieldTTLs{}, nil, fmt.Errorf("failed to read hash value %d: %w", i, err)
+		}
+		allBytes = append(allBytes, valueBytes...)
+
+		deadlineBytes := make([]byte, 8)
+		if _, err := io.ReadFull(r.reader, deadlineBytes); err != nil {
+			return hashWithFieldTTLs{}, nil, fmt.Errorf("failed to read hash field TTL %d: %w", i, err)
+		}
+		allBytes = append(allBytes, deadlineBytes...)
+
+		hash.fields[field] = value
+		if deadline := int64(binary.LittleEndian.Uint64(deadlineBytes)); deadline != 0 {
+			hash.deadlines[field] = deadline
+		}
+	}
+
+	return hash, allBytes, nil
+}
+
 // readSet reads a set value
 func (r *Reader) readSet() (map[string]struct{}, []byte, error) {
 	length, lengthBytes, err := r.readLength()
@@ -283,7 +464,7 @@ func (r *Reader) readSet() (map[string]struct{}, []byte, error) {
 	}
 
 	allBytes := lengthBytes
-	set := make(map[string]struct{}, length)
+	set := make(map[string]struct{}, preallocHint(length))
 	for i := uint32(0); i < length; i++ {
 		member, memberBytes, err := r.readString()
 		if err != nil {
@@ -310,7 +491,7 @@ func (r *Reader) readZSet() ([]ZSetMember, []byte, error) {
 	}
 
 	allBytes := lengthBytes
-	zset := make([]ZSetMember, length)
+	zset := make([]ZSetMember, 0, preallocHint(length))
 	for i := uint32(0); i < length; i++ {
 		// Read member string
 		member, memberBytes, err := r.readString()
@@ -328,10 +509,10 @@ func (r *Reader) readZSet() ([]ZSetMember, []byte, error) {
 		binary.LittleEndian.PutUint64(scoreBytes, math.Float64bits(score))
 		allBytes = append(allBytes, scoreBytes...)
 
-		zset[i] = ZSetMember{
+		zset = append(zset, ZSetMember{
 			Member: member,
 			Score:  score,
-		}
+		})
 	}
 
 	return zset, allBytes, nil
@@ -3,16 +3,99 @@ package replication
 import (
 	"bufio"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/crc64"
+	"io"
 	"log"
+	"math"
 	"net"
+	"strconv"
 	"strings"
 	"time"
+
+	"redis/internal/protocol"
+	"redis/internal/rdb"
 )
 
 // ==================== REPLICA CLIENT OPERATIONS ====================
 
+var (
+	// ErrReplicateToSelf is returned when REPLICAOF targets this server's own address
+	ErrReplicateToSelf = errors.New("ERR Can't replicate to self")
+	// ErrReplicationCycle is returned when REPLICAOF targets one of our own replicas
+	ErrReplicationCycle = errors.New("ERR Can't replicate from a replica of this server")
+)
+
+// ValidateMasterAddress checks that host:port is a legal master for this server
+// Rejects our own listening address and any replica currently attached to us,
+// both of which would create a replication loop
+func (rm *ReplicationManager) ValidateMasterAddress(host string, port int) error {
+	if port == rm.GetListeningPort() && isLocalHost(host) {
+		return ErrReplicateToSelf
+	}
+
+	for _, replica := range rm.GetAllReplicas() {
+		if replica.ListeningPort != port {
+			continue
+		}
+		replicaHost, _ := parseAddr(replica.Addr)
+		if sameHost(host, replicaHost) || (replica.AnnounceIP != "" && sameHost(host, replica.AnnounceIP)) {
+			return ErrReplicationCycle
+		}
+	}
+
+	return nil
+}
+
+// isLocalHost reports whether host resolves to an address of this machine
+func isLocalHost(host string) bool {
+	ips := resolveHost(host)
+	if len(ips) == 0 {
+		return false
+	}
+
+	ifaceAddrs, _ := net.InterfaceAddrs()
+	for _, ip := range ips {
+		if ip.IsLoopback() || ip.IsUnspecified() {
+			return true
+		}
+		for _, addr := range ifaceAddrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameHost reports whether two host names refer to the same machine
+func sameHost(a, b string) bool {
+	if isLocalHost(a) && isLocalHost(b) {
+		return true
+	}
+	for _, ipA := range resolveHost(a) {
+		for _, ipB := range resolveHost(b) {
+			if ipA.Equal(ipB) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveHost returns the IPs for host, which may be a literal address
+func resolveHost(host string) []net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil
+	}
+	return ips
+}
+
 // ConnectToMaster connects to a master server as a replica
 func (rm *ReplicationManager) ConnectToMaster(host string, port int) error {
 	rm.masterInfoMu.Lock()
@@ -26,6 +109,14 @@ func (rm *ReplicationManager) ConnectToMaster(host string, port int) error {
 		savedReplID = rm.masterInfo.MasterReplID
 		savedOffset = rm.masterInfo.Offset
 
+		// A master accepted writes of its own, so its data has diverged from any
+		// earlier replication history (e.g. an old master rejoining after a
+		// failover). Forget it so PSYNC ? -1 forces a full resync
+		if rm.GetRole() == RoleMaster {
+			savedReplID = ""
+			savedOffset = 0
+		}
+
 		// Close existing connection if any
 		if rm.masterInfo.Conn != nil {
 			rm.masterInfo.Conn.Close()
@@ -61,7 +152,7 @@ func (rm *ReplicationManager) ConnectToMaster(host string, port int) error {
 	}
 
 	// Change role to replica
-	rm.role = RoleReplica
+	rm.setRole(RoleReplica)
 
 	log.Printf("[REPLICATION] Connected to master %s, role changed to replica", addr)
 
@@ -84,52 +175,74 @@ func (rm *ReplicationManager) performHandshake() {
 	// Step 1: Send PING
 	if err := rm.sendToMaster("PING\r\n"); err != nil {
 		log.Printf("[REPLICATION] Handshake failed at PING: %v", err)
-		rm.handleMasterDisconnect()
+		rm.handleMasterDisconnect(master)
 		return
 	}
 
 	resp, err := rm.readFromMaster()
 	if err != nil || !strings.Contains(resp, "PONG") {
 		log.Printf("[REPLICATION] Invalid PING response: %v", err)
-		rm.handleMasterDisconnect()
+		rm.handleMasterDisconnect(master)
 		return
 	}
 
 	log.Printf("[REPLICATION] Handshake: PING OK")
 
-	// Step 2: Send REPLCONF listening-port
-	port := rm.GetListeningPort()
+	// Step 2: Send REPLCONF listening-port (replica-announce-port overrides the real port)
+	announceIP, port := rm.GetAnnounceAddress()
+	if port == 0 {
+		port = rm.GetListeningPort()
+	}
 	if port == 0 {
 		port = 6379 // Default port if not set
 	}
 	cmd := fmt.Sprintf("*3\r\n$8\r\nREPLCONF\r\n$14\r\nlistening-port\r\n$%d\r\n%d\r\n", len(fmt.Sprint(port)), port)
 	if err := rm.sendToMaster(cmd); err != nil {
 		log.Printf("[REPLICATION] Handshake failed at REPLCONF listening-port: %v", err)
-		rm.handleMasterDisconnect()
+		rm.handleMasterDisconnect(master)
 		return
 	}
 
 	resp, err = rm.readFromMaster()
 	if err != nil || !strings.Contains(resp, "OK") {
 		log.Printf("[REPLICATION] Invalid REPLCONF listening-port response: %v", err)
-		rm.handleMasterDisconnect()
+		rm.handleMasterDisconnect(master)
 		return
 	}
 
 	log.Printf("[REPLICATION] Handshake: REPLCONF listening-port OK")
 
+	// Step 2b: Send REPLCONF ip-address if replica-announce-ip is configured
+	if announceIP != "" {
+		cmd = fmt.Sprintf("*3\r\n$8\r\nREPLCONF\r\n$10\r\nip-address\r\n$%d\r\n%s\r\n", len(announceIP), announceIP)
+		if err := rm.sendToMaster(cmd); err != nil {
+			log.Printf("[REPLICATION] Handshake failed at REPLCONF ip-address: %v", err)
+			rm.handleMasterDisconnect(master)
+			return
+		}
+
+		resp, err = rm.readFromMaster()
+		if err != nil || !strings.Contains(resp, "OK") {
+			log.Printf("[REPLICATION] Invalid REPLCONF ip-address response: %v", err)
+			rm.handleMasterDisconnect(master)
+			return
+		}
+
+		log.Printf("[REPLICATION] Handshake: REPLCONF ip-address %s OK", announceIP)
+	}
+
 	// Step 3: Send REPLCONF capa psync2
 	cmd = "*3\r\n$8\r\nREPLCONF\r\n$4\r\ncapa\r\n$6\r\npsync2\r\n"
 	if err := rm.sendToMaster(cmd); err != nil {
 		log.Printf("[REPLICATION] Handshake failed at REPLCONF capa: %v", err)
-		rm.handleMasterDisconnect()
+		rm.handleMasterDisconnect(master)
 		return
 	}
 
 	resp, err = rm.readFromMaster()
 	if err != nil || !strings.Contains(resp, "OK") {
 		log.Printf("[REPLICATION] Invalid REPLCONF capa response: %v", err)
-		rm.handleMasterDisconnect()
+		rm.handleMasterDisconnect(master)
 		return
 	}
 
@@ -156,14 +269,14 @@ func (rm *ReplicationManager) performHandshake() {
 
 	if err := rm.sendToMaster(cmd); err != nil {
 		log.Printf("[REPLICATION] Handshake failed at PSYNC: %v", err)
-		rm.handleMasterDisconnect()
+		rm.handleMasterDisconnect(master)
 		return
 	}
 
 	resp, err = rm.readFromMaster()
 	if err != nil {
 		log.Printf("[REPLICATION] PSYNC response error: %v", err)
-		rm.handleMasterDisconnect()
+		rm.handleMasterDisconnect(master)
 		return
 	}
 
@@ -227,7 +340,7 @@ func (rm *ReplicationManager) readFromMaster() (string, error) {
 		return "", fmt.Errorf("not connected to master")
 	}
 
-	line, err := rm.masterInfo.Reader.ReadString('\n')
+	line, err := protocol.ReadLine(rm.masterInfo.Reader)
 	if err != nil {
 		return "", err
 	}
@@ -240,10 +353,21 @@ func (rm *ReplicationManager) readFromMaster() (string, error) {
 func (rm *ReplicationManager) receiveReplicationStream() {
 	log.Printf("[REPLICATION] Starting replication stream receiver")
 
+	// The connection this receiver serves; REPLICAOF may replace it
+	rm.masterInfoMu.RLock()
+	master := rm.masterInfo
+	rm.masterInfoMu.RUnlock()
+
+	// Commands of a MULTI ... EXEC block are collected and applied together
+	// on EXEC; a block cut short by a disconnect is never applied
+	var txBlock [][]string
+	var txBytes int64
+	inTx := false
+
 	for {
 		// Check if still connected
 		rm.masterInfoMu.RLock()
-		if rm.masterInfo == nil || rm.masterInfo.Conn == nil {
+		if rm.masterInfo == nil || rm.masterInfo != master || rm.masterInfo.Conn == nil {
 			rm.masterInfoMu.RUnlock()
 			break
 		}
@@ -256,10 +380,10 @@ func (rm *ReplicationManager) receiveReplicationStream() {
 		conn.SetReadDeadline(time.Now().Add(65 * time.Second))
 
 		// Read RESP command
-		line, err := reader.ReadString('\n')
+		line, err := protocol.ReadLine(reader)
 		if err != nil {
 			log.Printf("[REPLICATION] Error reading from master: %v", err)
-			rm.handleMasterDisconnect()
+			rm.handleMasterDisconnect(master)
 			break
 		}
 
@@ -276,14 +400,21 @@ func (rm *ReplicationManager) receiveReplicationStream() {
 			var size int
 			fmt.Sscanf(line, "$%d", &size)
 
+			// Never trust the master with an unbounded allocation
+			if size < 0 || int64(size) > protocol.MaxBulkLen() {
+				log.Printf("[REPLICATION] Invalid RDB size %d (proto-max-bulk-len %d)", size, protocol.MaxBulkLen())
+				rm.handleMasterDisconnect(master)
+				break
+			}
+
 			log.Printf("[REPLICATION] Receiving RDB file: %d bytes", size)
 
 			// Read RDB data
 			rdbData := make([]byte, size)
-			_, err := reader.Read(rdbData)
+			_, err := io.ReadFull(reader, rdbData)
 			if err != nil {
 				log.Printf("[REPLICATION] Error reading RDB: %v", err)
-				rm.handleMasterDisconnect()
+				rm.handleMasterDisconnect(master)
 				break
 			}
 
@@ -295,8 +426,14 @@ func (rm *ReplicationManager) receiveReplicationStream() {
 			}
 			rm.masterInfoMu.Unlock()
 
+			// A full resync replaces the whole dataset: drop local keys first so
+			// nothing the master doesn't have survives the load
+			if err := rm.executeReplicatedCommand([]string{"FLUSHALL"}); err != nil {
+				log.Printf("[REPLICATION] Error flushing before RDB load: %v", err)
+			}
+
 			// Load RDB into store
-			if err := rm.loadRDBIntoStore(rdbData); err != nil {
+			if err := rm.loadRDBIntoStore(rdbData, rm.executeReplicatedCommand); err != nil {
 				log.Printf("[REPLICATION] Error loading RDB: %v", err)
 			} else {
 				log.Printf("[REPLICATION] RDB loaded successfully")
@@ -309,38 +446,52 @@ func (rm *ReplicationManager) receiveReplicationStream() {
 			// Parse array length
 			var arrayLen int
 			fmt.Sscanf(line, "*%d", &arrayLen)
+			if arrayLen < 0 || arrayLen > protocol.MaxMultiBulkLen {
+				log.Printf("[REPLICATION] Invalid multibulk length %d from master", arrayLen)
+				rm.handleMasterDisconnect(master)
+				return
+			}
 
-			args := make([]string, arrayLen)
+			args := make([]string, 0, min(arrayLen, 1024))
 			for i := 0; i < arrayLen; i++ {
 				// Read bulk string length
-				lenLine, err := reader.ReadString('\n')
+				lenLine, err := protocol.ReadLine(reader)
 				if err != nil {
 					log.Printf("[REPLICATION] Error reading command length: %v", err)
-					rm.handleMasterDisconnect()
+					rm.handleMasterDisconnect(master)
 					return
 				}
 
 				var argLen int
 				fmt.Sscanf(strings.TrimSpace(lenLine), "$%d", &argLen)
+				if argLen < 0 || int64(argLen) > protocol.MaxBulkLen() {
+					log.Printf("[REPLICATION] Invalid bulk length %d from master", argLen)
+					rm.handleMasterDisconnect(master)
+					return
+				}
 
 				// Read bulk string data
 				argData := make([]byte, argLen)
-				_, err = reader.Read(argData)
+				_, err = io.ReadFull(reader, argData)
 				if err != nil {
 					log.Printf("[REPLICATION] Error reading command data: %v", err)
-					rm.handleMasterDisconnect()
+					rm.handleMasterDisconnect(master)
 					return
 				}
 
-				args[i] = string(argData)
+				args = append(args, string(argData))
 
-				// Read trailing \r\n
-				reader.ReadString('\n')
+				// Skip the trailing \r\n
+				reader.Discard(2)
 			}
 
 			// Process command
 			log.Printf("[REPLICATION] Received command from master: %v", args)
 
+			// The offset counts stream bytes, same as the master's master_repl_offset,
+			// so the two can be compared to tell whether this replica is caught up
+			streamBytes := int64(len(encodeCommandRESP(args)))
+
 			// Handle special replication commands
 			if len(args) > 0 {
 				cmdName := strings.ToUpper(args[0])
@@ -348,6 +499,7 @@ func (rm *ReplicationManager) receiveReplicationStream() {
 				// Respond to PING from master to keep connection alive
 				if cmdName == "PING" {
 					rm.sendToMaster("+PONG\r\n")
+					rm.advanceOffset(streamBytes)
 					continue
 				}
 
@@ -357,32 +509,65 @@ func (rm *ReplicationManager) receiveReplicationStream() {
 					offsetStr := fmt.Sprintf("%d", offset)
 					resp := fmt.Sprintf("*3\r\n$8\r\nREPLCONF\r\n$3\r\nACK\r\n$%d\r\n%s\r\n", len(offsetStr), offsetStr)
 					rm.sendToMaster(resp)
+					rm.advanceOffset(streamBytes)
 					continue
 				}
 			}
 
+			// Collect transaction blocks and apply them in one go on EXEC, so
+			// clients never read a partially applied transaction
+			if len(args) > 0 {
+				switch strings.ToUpper(args[0]) {
+				case "MULTI":
+					inTx, txBlock, txBytes = true, nil, streamBytes
+					continue
+				case "EXEC":
+					if inTx {
+						if err := rm.executeReplicatedTransaction(txBlock); err != nil {
+							log.Printf("[REPLICATION] Error executing replicated transaction: %v", err)
+						}
+						rm.advanceOffset(txBytes + streamBytes)
+						inTx, txBlock, txBytes = false, nil, 0
+						continue
+					}
+				default:
+					if inTx {
+						txBlock = append(txBlock, args)
+						txBytes += streamBytes
+						continue
+					}
+				}
+			}
+
 			// Execute command on local store
 			if err := rm.executeReplicatedCommand(args); err != nil {
 				log.Printf("[REPLICATION] Error executing replicated command %v: %v", args, err)
 			}
 
 			// Update offset
-			rm.masterInfoMu.Lock()
-			if rm.masterInfo != nil {
-				rm.masterInfo.Offset++
-			}
-			rm.masterInfoMu.Unlock()
+			rm.advanceOffset(streamBytes)
 		}
 	}
 
 	log.Printf("[REPLICATION] Replication stream receiver stopped")
 }
 
+// advanceOffset adds n processed stream bytes to our replication offset
+func (rm *ReplicationManager) advanceOffset(n int64) {
+	rm.masterInfoMu.Lock()
+	if rm.masterInfo != nil {
+		rm.masterInfo.Offset += n
+	}
+	rm.masterInfoMu.Unlock()
+}
+
 // handleMasterDisconnect handles disconnection from master
-func (rm *ReplicationManager) handleMasterDisconnect() {
+// master is the connection that failed; if REPLICAOF already replaced it,
+// there is nothing to tear down or reconnect
+func (rm *ReplicationManager) handleMasterDisconnect(master *MasterInfo) {
 	rm.masterInfoMu.Lock()
 
-	if rm.masterInfo == nil {
+	if rm.masterInfo == nil || rm.masterInfo != master {
 		rm.masterInfoMu.Unlock()
 		return
 	}
@@ -402,6 +587,11 @@ func (rm *ReplicationManager) handleMasterDisconnect() {
 	go func() {
 		time.Sleep(5 * time.Second)
 
+		// REPLICAOF NO ONE may have promoted us in the meantime
+		if rm.GetRole() != RoleReplica {
+			return
+		}
+
 		log.Printf("[REPLICATION] Attempting to reconnect to master %s:%d", host, port)
 		if err := rm.ConnectToMaster(host, port); err != nil {
 			log.Printf("[REPLICATION] Reconnection failed: %v", err)
@@ -435,11 +625,25 @@ func (rm *ReplicationManager) DisconnectFromMaster() {
 		log.Printf("[REPLICATION] Manually disconnected from master (preserved replid=%s, offset=%d)", savedReplID, savedOffset)
 	}
 
+	// A promoted replica starts a new replication history, so nodes still
+	// carrying our old replid (such as a former master) can't partially resync
+	if rm.GetRole() == RoleReplica {
+		rm.ChangeReplID()
+	}
+
 	// Change role to master
-	rm.role = RoleMaster
+	rm.setRole(RoleMaster)
 	log.Printf("[REPLICATION] Role changed to master")
 }
 
+// IsMasterLinkUp reports whether the link with the master is fully established
+func (rm *ReplicationManager) IsMasterLinkUp() bool {
+	rm.masterInfoMu.RLock()
+	defer rm.masterInfoMu.RUnlock()
+
+	return rm.masterInfo != nil && rm.masterInfo.State == MasterStateConnected
+}
+
 // GetMasterInfo returns master connection info
 func (rm *ReplicationManager) GetMasterInfo() *MasterInfo {
 	rm.masterInfoMu.RLock()
@@ -455,10 +659,15 @@ func (rm *ReplicationManager) sendReplicationHeartbeat() {
 
 	log.Printf("[REPLICATION] Starting heartbeat sender")
 
+	// The connection this heartbeat serves; REPLICAOF may replace it
+	rm.masterInfoMu.RLock()
+	master := rm.masterInfo
+	rm.masterInfoMu.RUnlock()
+
 	for range ticker.C {
 		// Check if still connected
 		rm.masterInfoMu.RLock()
-		if rm.masterInfo == nil || rm.masterInfo.Conn == nil || rm.masterInfo.State != MasterStateConnected {
+		if rm.masterInfo == nil || rm.masterInfo != master || rm.masterInfo.Conn == nil || rm.masterInfo.State != MasterStateConnected {
 			rm.masterInfoMu.RUnlock()
 			log.Printf("[REPLICATION] Stopping heartbeat - not connected")
 			return
@@ -472,7 +681,7 @@ func (rm *ReplicationManager) sendReplicationHeartbeat() {
 
 		if err := rm.sendToMaster(cmd); err != nil {
 			log.Printf("[REPLICATION] Failed to send heartbeat: %v", err)
-			rm.handleMasterDisconnect()
+			rm.handleMasterDisconnect(master)
 			return
 		}
 
@@ -480,8 +689,8 @@ func (rm *ReplicationManager) sendReplicationHeartbeat() {
 	}
 }
 
-// loadRDBIntoStore loads an RDB file into the store by executing commands
-func (rm *ReplicationManager) loadRDBIntoStore(rdbData []byte) error {
+// loadRDBIntoStore loads an RDB file by running a command per key through exec
+func (rm *ReplicationManager) loadRDBIntoStore(rdbData []byte, exec func(args []string) error) error {
 	if len(rdbData) < 18 {
 		return fmt.Errorf("RDB file too small: %d bytes (minimum 18 bytes)", len(rdbData))
 	}
@@ -517,6 +726,11 @@ func (rm *ReplicationManager) loadRDBIntoStore(rdbData []byte) error {
 	// Start parsing from byte 9
 	pos := 9
 
+	// Sliding window (OpCodeSlidingTTL) and tombstone flag (OpCodeNegative) of
+	// the next key, applied once the key is loaded
+	var slidingMs int64
+	negative := false
+
 	for pos < len(rdbData) {
 		if pos >= len(rdbData) {
 			break
@@ -535,14 +749,46 @@ func (rm *ReplicationManager) loadRDBIntoStore(rdbData []byte) error {
 			pos++
 			log.Printf("[REPLICATION] Selecting database %d", dbNum)
 
+		case 0xFA: // AUX (metadata field written by SAVE/BGSAVE)
+			auxKey, n, err := readString(rdbData, pos)
+			if err != nil {
+				return fmt.Errorf("error reading aux field: %v", err)
+			}
+			pos += n
+			auxValue, n, err := readString(rdbData, pos)
+			if err != nil {
+				return fmt.Errorf("error reading aux value: %v", err)
+			}
+			pos += n
+			log.Printf("[REPLICATION] RDB aux field %s=%s", auxKey, auxValue)
+
 		case 0xFB: // RESIZEDB
 			// Read hash table sizes
-			dbSize, n := readLength(rdbData, pos)
+			dbSize, n, err := readLength(rdbData, pos)
+			if err != nil {
+				return fmt.Errorf("error reading db size: %v", err)
+			}
 			pos += n
-			expiresSize, n := readLength(rdbData, pos)
+			expiresSize, n, err := readLength(rdbData, pos)
+			if err != nil {
+				return fmt.Errorf("error reading expires size: %v", err)
+			}
 			pos += n
 			log.Printf("[REPLICATION] DB size: %d, expires: %d", dbSize, expiresSize)
 
+		case rdb.OpCodeSlidingTTL:
+			if pos+8 > len(rdbData) {
+				return fmt.Errorf("unexpected EOF reading sliding window")
+			}
+			slidingMs = int64(binary.LittleEndian.Uint64(rdbData[pos:]))
+			pos += 8
+			if slidingMs <= 0 || slidingMs > math.MaxInt64/int64(time.Millisecond) {
+				return fmt.Errorf("invalid sliding window: %d", slidingMs)
+			}
+
+		case rdb.OpCodeNegative:
+			negative = true
+
 		case 0xFC: // EXPIRETIME_MS
 			// Read expiry time in milliseconds
 			if pos+8 > len(rdbData) {
@@ -569,10 +815,18 @@ func (rm *ReplicationManager) loadRDBIntoStore(rdbData []byte) error {
 			pos += n
 
 			// Read value based on type
-			pos, err = rm.loadRDBValue(valueType, key, rdbData, pos, expiryMs)
+			pos, err = rm.loadRDBValue(valueType, key, rdbData, pos, expiryMs, negative, exec)
+			negative = false
 			if err != nil {
 				return err
 			}
+			if slidingMs > 0 {
+				err = exec([]string{"PEXPIREAT", key, strconv.FormatInt(expiryMs, 10), "SLIDING", strconv.FormatInt(slidingMs, 10)})
+				slidingMs = 0
+				if err != nil {
+					return err
+				}
+			}
 
 		case 0xFD: // EXPIRETIME (seconds)
 			// Read expiry time in seconds
@@ -599,18 +853,26 @@ func (rm *ReplicationManager) loadRDBIntoStore(rdbData []byte) error {
 			pos += n
 
 			// Read value based on type
-			pos, err = rm.loadRDBValue(valueType, key, rdbData, pos, expiryMs)
+			pos, err = rm.loadRDBValue(valueType, key, rdbData, pos, expiryMs, negative, exec)
+			negative = false
 			if err != nil {
 				return err
 			}
+			if slidingMs > 0 {
+				err = exec([]string{"PEXPIREAT", key, strconv.FormatInt(expiryMs, 10), "SLIDING", strconv.FormatInt(slidingMs, 10)})
+				slidingMs = 0
+				if err != nil {
+					return err
+				}
+			}
 
 		case 0xFF: // EOF
 			log.Printf("[REPLICATION] Reached end of RDB file")
 			return nil
 
 		default:
-			// This is a value type opcode (0-14)
-			if opcode > 14 {
+			// This is a value type opcode (0-14, or a hash with field TTLs)
+			if opcode > 14 && opcode != rdb.TypeHashFieldTTL {
 				return fmt.Errorf("unknown opcode: 0x%02X at position %d", opcode, pos-1)
 			}
 
@@ -621,19 +883,28 @@ func (rm *ReplicationManager) loadRDBIntoStore(rdbData []byte) error {
 			}
 			pos += n
 
-			// Read value based on type (no expiry)
-			pos, err = rm.loadRDBValue(opcode, key, rdbData, pos, 0)
+			// Read value based on type (no expiry, so no sliding window or tombstone either)
+			slidingMs, negative = 0, false
+			pos, err = rm.loadRDBValue(opcode, key, rdbData, pos, 0, false, exec)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	return nil
+	return fmt.Errorf("unexpected EOF: no end-of-file opcode")
+}
+
+// LoadRDB parses an RDB payload the way a full resync does and runs the
+// command that restores each key through exec, without flushing first
+// Malformed input is reported as an error; it is what DEBUG LOADRDB uses to
+// fuzz the loader
+func (rm *ReplicationManager) LoadRDB(rdbData []byte, exec func(args []string) error) error {
+	return rm.loadRDBIntoStore(rdbData, exec)
 }
 
 // loadRDBValue loads a single key-value pair from RDB
-func (rm *ReplicationManager) loadRDBValue(valueType byte, key string, rdbData []byte, pos int, expiryMs int64) (int, error) {
+func (rm *ReplicationManager) loadRDBValue(valueType byte, key string, rdbData []byte, pos int, expiryMs int64, negative bool, exec func(args []string) error) (int, error) {
 	switch valueType {
 	case 0: // String
 		value, n, err := readString(rdbData, pos)
@@ -650,12 +921,18 @@ func (rm *ReplicationManager) loadRDBValue(valueType byte, key string, rdbData [
 			ttl := expiryMs - now
 			if ttl > 0 {
 				args = append(args, "PX", fmt.Sprintf("%d", ttl))
+				if negative {
+					args = append(args, "NEGATIVE")
+				}
 			}
 		}
-		rm.executeReplicatedCommand(args)
+		exec(args)
 
 	case 1: // List
-		length, n := readLength(rdbData, pos)
+		length, n, err := readCollectionLength(rdbData, pos)
+		if err != nil {
+			return pos, fmt.Errorf("error reading list length: %v", err)
+		}
 		pos += n
 
 		// Read all list elements
@@ -667,7 +944,7 @@ func (rm *ReplicationManager) loadRDBValue(valueType byte, key string, rdbData [
 			pos += n
 
 			// Execute RPUSH command
-			rm.executeReplicatedCommand([]string{"RPUSH", key, element})
+			exec([]string{"RPUSH", key, element})
 		}
 
 		// Set expiry if needed
@@ -675,12 +952,15 @@ func (rm *ReplicationManager) loadRDBValue(valueType byte, key string, rdbData [
 			now := time.Now().UnixNano() / int64(time.Millisecond)
 			ttl := expiryMs - now
 			if ttl > 0 {
-				rm.executeReplicatedCommand([]string{"PEXPIRE", key, fmt.Sprintf("%d", ttl)})
+				exec([]string{"PEXPIRE", key, fmt.Sprintf("%d", ttl)})
 			}
 		}
 
 	case 2: // Set
-		length, n := readLength(rdbData, pos)
+		length, n, err := readCollectionLength(rdbData, pos)
+		if err != nil {
+			return pos, fmt.Errorf("error reading set length: %v", err)
+		}
 		pos += n
 
 		// Read all set members
@@ -692,7 +972,7 @@ func (rm *ReplicationManager) loadRDBValue(valueType byte, key string, rdbData [
 			pos += n
 
 			// Execute SADD command
-			rm.executeReplicatedCommand([]string{"SADD", key, member})
+			exec([]string{"SADD", key, member})
 		}
 
 		// Set expiry if needed
@@ -700,12 +980,15 @@ func (rm *ReplicationManager) loadRDBValue(valueType byte, key string, rdbData [
 			now := time.Now().UnixNano() / int64(time.Millisecond)
 			ttl := expiryMs - now
 			if ttl > 0 {
-				rm.executeReplicatedCommand([]string{"PEXPIRE", key, fmt.Sprintf("%d", ttl)})
+				exec([]string{"PEXPIRE", key, fmt.Sprintf("%d", ttl)})
 			}
 		}
 
 	case 3: // Sorted Set
-		length, n := readLength(rdbData, pos)
+		length, n, err := readCollectionLength(rdbData, pos)
+		if err != nil {
+			return pos, fmt.Errorf("error reading zset length: %v", err)
+		}
 		pos += n
 
 		// Read all sorted set members with scores
@@ -716,14 +999,15 @@ func (rm *ReplicationManager) loadRDBValue(valueType byte, key string, rdbData [
 			}
 			pos += n
 
-			score, n, err := readString(rdbData, pos)
-			if err != nil {
-				return pos, fmt.Errorf("error reading zset score: %v", err)
+			// Score is an 8-byte little-endian float64
+			if pos+8 > len(rdbData) {
+				return pos, fmt.Errorf("unexpected EOF reading zset score")
 			}
-			pos += n
+			score := math.Float64frombits(binary.LittleEndian.Uint64(rdbData[pos : pos+8]))
+			pos += 8
 
 			// Execute ZADD command
-			rm.executeReplicatedCommand([]string{"ZADD", key, score, member})
+			exec([]string{"ZADD", key, strconv.FormatFloat(score, 'g', -1, 64), member})
 		}
 
 		// Set expiry if needed
@@ -731,12 +1015,15 @@ func (rm *ReplicationManager) loadRDBValue(valueType byte, key string, rdbData [
 			now := time.Now().UnixNano() / int64(time.Millisecond)
 			ttl := expiryMs - now
 			if ttl > 0 {
-				rm.executeReplicatedCommand([]string{"PEXPIRE", key, fmt.Sprintf("%d", ttl)})
+				exec([]string{"PEXPIRE", key, fmt.Sprintf("%d", ttl)})
 			}
 		}
 
 	case 4: // Hash
-		length, n := readLength(rdbData, pos)
+		length, n, err := readCollectionLength(rdbData, pos)
+		if err != nil {
+			return pos, fmt.Errorf("error reading hash length: %v", err)
+		}
 		pos += n
 
 		// Read all hash fields and values
@@ -754,7 +1041,7 @@ func (rm *ReplicationManager) loadRDBValue(valueType byte, key string, rdbData [
 			pos += n
 
 			// Execute HSET command
-			rm.executeReplicatedCommand([]string{"HSET", key, field, value})
+			exec([]string{"HSET", key, field, value})
 		}
 
 		// Set expiry if needed
@@ -762,10 +1049,27 @@ func (rm *ReplicationManager) loadRDBValue(valueType byte, key string, rdbData [
 			now := time.Now().UnixNano() / int64(time.Millisecond)
 			ttl := expiryMs - now
 			if ttl > 0 {
-				rm.executeReplicatedCommand([]string{"PEXPIRE", key, fmt.Sprintf("%d", ttl)})
+				exec([]string{"PEXPIRE", key, fmt.Sprintf("%d", ttl)})
 			}
 		}
 
+	case rdb.TypeCuckooFilter, rdb.TypeCountMinSketch, rdb.TypeHashFieldTTL:
+		// No write command rebuilds these in one step, so the encoded object
+		// is handed to RESTORE as a DUMP payload
+		end, err := skipOpaqueObject(valueType, rdbData, pos)
+		if err != nil {
+			return pos, err
+		}
+		payload := rdb.DumpPayload(valueType, rdbData[pos:end])
+		pos = end
+
+		args := []string{"RESTORE", key, "0", string(payload), "REPLACE"}
+		if expiryMs > 0 {
+			args[2] = strconv.FormatInt(expiryMs, 10)
+			args = append(args, "ABSTTL")
+		}
+		exec(args)
+
 	default:
 		return pos, fmt.Errorf("unsupported value type: %d", valueType)
 	}
@@ -773,10 +1077,46 @@ func (rm *ReplicationManager) loadRDBValue(valueType byte, key string, rdbData [
 	return pos, nil
 }
 
+// skipOpaqueObject returns the position just past an object loaded through
+// RESTORE: a single string for a cuckoo filter or Count-Min sketch,
+// field-value pairs each followed by an 8-byte deadline for a hash with
+// field TTLs
+func skipOpaqueObject(valueType byte, rdbData []byte, pos int) (int, error) {
+	if valueType == rdb.TypeCuckooFilter || valueType == rdb.TypeCountMinSketch {
+		_, n, err := readString(rdbData, pos)
+		if err != nil {
+			return pos, fmt.Errorf("error reading value: %v", err)
+		}
+		return pos + n, nil
+	}
+
+	length, n, err := readCollectionLength(rdbData, pos)
+	if err != nil {
+		return pos, fmt.Errorf("error reading hash length: %v", err)
+	}
+	pos += n
+	for i := 0; i < length; i++ {
+		for j := 0; j < 2; j++ {
+			_, n, err := readString(rdbData, pos)
+			if err != nil {
+				return pos, fmt.Errorf("error reading hash entry: %v", err)
+			}
+			pos += n
+		}
+		if pos+8 > len(rdbData) {
+			return pos, fmt.Errorf("unexpected EOF reading hash field TTL")
+		}
+		pos += 8
+	}
+	return pos, nil
+}
+
 // readLength reads a length-encoded integer from RDB
-func readLength(data []byte, pos int) (int, int) {
+// Returns the length and the number of bytes it took, or an error if the data
+// is truncated or uses an encoding this loader does not support
+func readLength(data []byte, pos int) (int, int, error) {
 	if pos >= len(data) {
-		return 0, 0
+		return 0, 0, fmt.Errorf("unexpected EOF reading length at position %d", pos)
 	}
 
 	first := data[pos]
@@ -784,35 +1124,51 @@ func readLength(data []byte, pos int) (int, int) {
 
 	switch encType {
 	case 0: // 6-bit length
-		return int(first & 0x3F), 1
+		return int(first & 0x3F), 1, nil
 
 	case 1: // 14-bit length
 		if pos+1 >= len(data) {
-			return 0, 0
+			return 0, 0, fmt.Errorf("unexpected EOF reading 14-bit length at position %d", pos)
 		}
 		length := (int(first&0x3F) << 8) | int(data[pos+1])
-		return length, 2
+		return length, 2, nil
 
 	case 2: // 32-bit length
 		if pos+4 >= len(data) {
-			return 0, 0
+			return 0, 0, fmt.Errorf("unexpected EOF reading 32-bit length at position %d", pos)
 		}
-		length := int(data[pos+1])<<24 | int(data[pos+2])<<16 |
-			int(data[pos+3])<<8 | int(data[pos+4])
-		return length, 5
+		length := int(binary.BigEndian.Uint32(data[pos+1 : pos+5]))
+		return length, 5, nil
 
 	default:
-		// Special encoding (not implemented)
-		return 0, 0
+		// Special encoding (integer or LZF strings, not implemented)
+		return 0, 0, fmt.Errorf("unsupported length encoding 0x%02X at position %d", first, pos)
 	}
 }
 
+// readCollectionLength reads the element count of a list, set, sorted set or hash
+// Every element takes at least one byte, so a count larger than the bytes left
+// is rejected up front instead of looping over garbage
+func readCollectionLength(data []byte, pos int) (int, int, error) {
+	length, n, err := readLength(data, pos)
+	if err != nil {
+		return 0, 0, err
+	}
+	if length > len(data)-pos-n {
+		return 0, 0, fmt.Errorf("length %d at position %d exceeds the remaining %d bytes", length, pos, len(data)-pos-n)
+	}
+	return length, n, nil
+}
+
 // readString reads a length-prefixed string from RDB
 func readString(data []byte, pos int) (string, int, error) {
-	length, n := readLength(data, pos)
+	length, n, err := readLength(data, pos)
+	if err != nil {
+		return "", 0, err
+	}
 	pos += n
 
-	if pos+length > len(data) {
+	if length > len(data)-pos {
 		return "", n, fmt.Errorf("string extends beyond data")
 	}
 
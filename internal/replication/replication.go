@@ -2,7 +2,9 @@ package replication
 
 import (
 	"bufio"
+	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -22,20 +24,41 @@ const (
 )
 
 // ReplicaInfo represents a connected replica
+// Its bookkeeping fields (offsets, state, addresses, LastPingAt) are guarded
+// by the manager's replicasMu; mu only serializes writes to Conn and Writer
 type ReplicaInfo struct {
 	Conn             net.Conn
 	Writer           *bufio.Writer
 	ID               string
 	Addr             string
-	ListeningPort    int // Port replica is listening on (from REPLCONF)
+	ListeningPort    int    // Port replica is listening on (from REPLCONF)
+	AnnounceIP       string // Address replica wants to be reached at (from REPLCONF ip-address)
 	ConnectedAt      time.Time
 	LastPingAt       time.Time
 	Offset           int64 // Replication offset
+	AckOffset        int64 // Last offset acknowledged via REPLCONF ACK
 	State            ReplicaState
-	CapabilityPSYNC2 bool // Supports partial resync
-	mu               sync.Mutex
+	CapabilityPSYNC2 bool       // Supports partial resync
+	mu               sync.Mutex // Serializes writes to the replication stream
+
+	// Outgoing replication stream, drained by the replica's writer goroutine
+	// so a slow replica never blocks propagation to the others
+	sendQueue chan replicaWrite
+	quit      chan struct{} // Closed to stop the writer goroutine
+	quitOnce  sync.Once
+	done      chan struct{} // Closed when the writer goroutine exits
+}
+
+// replicaWrite is one propagated command queued for a replica
+type replicaWrite struct {
+	data   []byte
+	offset int64 // Master offset after this command
 }
 
+// replicaSendQueueSize is how many propagated commands a replica may fall
+// behind before it is disconnected as too slow
+const replicaSendQueueSize = 10000
+
 // ReplicaState represents the state of replica connection
 type ReplicaState string
 
@@ -72,9 +95,9 @@ const (
 
 // ReplicationManager manages replication for both master and replica
 type ReplicationManager struct {
-	role   Role
+	role   Role   // Protected by mu
 	replID string // Our replication ID (40 char random string)
-	offset int64  // Master replication offset
+	offset int64  // Master replication offset (protected by backlogMu)
 
 	// Master-specific fields
 	replicas   map[string]*ReplicaInfo // Connected replicas (key = replica ID)
@@ -83,8 +106,10 @@ type ReplicationManager struct {
 	// Replica-specific fields
 	masterInfo    *MasterInfo
 	masterInfoMu  sync.RWMutex
-	listeningPort int // Server's listening port (for REPLCONF)
-	priority      int // Replica priority for Sentinel failover (0-100)
+	listeningPort int    // Server's listening port (for REPLCONF)
+	announceIP    string // replica-announce-ip: address advertised to the master
+	announcePort  int    // replica-announce-port: port advertised to the master (0 = listening port)
+	priority      int    // Replica priority for Sentinel failover (0-100)
 
 	// Backlog for partial resync
 	backlog   *ReplicationBacklog
@@ -97,17 +122,28 @@ type ReplicationManager struct {
 
 	// Command execution (for replica)
 	commandExecutor func([]string) error
-	mu              sync.RWMutex // Protects commandExecutor
+	txExecutor      func([][]string) error // Applies a MULTI ... EXEC block atomically
+	mu              sync.RWMutex           // Protects role, commandExecutor, txExecutor and replID
 
 	// Store access (for RDB generation)
 	storeGetter   func() interface{}
 	storeGetterMu sync.RWMutex
+
+	// Called whenever the role changes (protected by mu)
+	onRoleChange func(role Role)
 }
 
 // Command represents a command to be propagated to replicas
 type Command struct {
 	Args      []string
 	Timestamp time.Time
+	OffsetCh  chan int64 // If set, receives the replication offset just before this command
+	// A Command without Args is a marker: it sends nothing and only reports on
+	// OffsetCh the offset after every command queued before it
+
+	// Block, if set instead of Args, holds commands sent back to back with
+	// nothing from other clients in between (a MULTI ... EXEC block)
+	Block [][]string
 }
 
 // ReplicationBacklog is a circular buffer for storing recent commands
@@ -200,11 +236,11 @@ func NewReplicationManager(role Role) *ReplicationManager {
 		priority:     100, // Default priority
 	}
 
-	// Start command propagation goroutine for master
-	if role == RoleMaster {
-		rm.wg.Add(1)
-		go rm.propagateCommands()
-	}
+	// Start command propagation goroutine regardless of role: a replica
+	// promoted with REPLICAOF NO ONE must stream its writes too, and
+	// PropagateCommand already ignores commands while we are a replica
+	rm.wg.Add(1)
+	go rm.propagateCommands()
 
 	return rm
 }
@@ -219,6 +255,19 @@ func (rm *ReplicationManager) GetListeningPort() int {
 	return rm.listeningPort
 }
 
+// SetAnnounceAddress sets the address this server advertises to its master
+// Used when the replica sits behind NAT and its connection source address
+// is not reachable by Sentinel or other clients; empty ip / zero port keep the defaults
+func (rm *ReplicationManager) SetAnnounceAddress(ip string, port int) {
+	rm.announceIP = ip
+	rm.announcePort = port
+}
+
+// GetAnnounceAddress returns the configured replica-announce-ip and replica-announce-port
+func (rm *ReplicationManager) GetAnnounceAddress() (string, int) {
+	return rm.announceIP, rm.announcePort
+}
+
 // SetPriority sets the replica priority for Sentinel failover
 func (rm *ReplicationManager) SetPriority(priority int) {
 	rm.priority = priority
@@ -231,9 +280,35 @@ func (rm *ReplicationManager) GetPriority() int {
 
 // GetRole returns the current role (master or replica)
 func (rm *ReplicationManager) GetRole() Role {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
 	return rm.role
 }
 
+// setRole changes the role and reports it to the role-change callback
+func (rm *ReplicationManager) setRole(role Role) {
+	rm.mu.Lock()
+	rm.role = role
+	callback := rm.onRoleChange
+	rm.mu.Unlock()
+	if callback != nil {
+		callback(role)
+	}
+}
+
+// SetRoleChangeCallback sets the callback invoked whenever the role changes
+// It is called once right away with the current role
+func (rm *ReplicationManager) SetRoleChangeCallback(callback func(role Role)) {
+	rm.mu.Lock()
+	rm.onRoleChange = callback
+	role := rm.role
+	rm.mu.Unlock()
+
+	if callback != nil {
+		callback(role)
+	}
+}
+
 // generateReplID generates a random 40-character replication ID
 // Uses crypto/rand for cryptographically secure random generation
 func generateReplID() string {
@@ -247,6 +322,17 @@ func generateReplID() string {
 	return fmt.Sprintf("%x", b)
 }
 
+// ChangeReplID replaces our replication ID with a freshly generated one
+// Replicas that PSYNC with the old ID can no longer partially resync and
+// fall back to a full resync (used by DEBUG CHANGE-REPL-ID)
+func (rm *ReplicationManager) ChangeReplID() string {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.replID = generateReplID()
+	log.Printf("[REPLICATION] Replication ID changed to %s", rm.replID)
+	return rm.replID
+}
+
 // ==================== MASTER OPERATIONS ====================
 
 // AddReplica adds a new replica connection
@@ -263,9 +349,18 @@ func (rm *ReplicationManager) AddReplica(conn net.Conn, id string) *ReplicaInfo
 		LastPingAt:  time.Now(),
 		Offset:      0,
 		State:       ReplicaStateConnecting,
+		sendQueue:   make(chan replicaWrite, replicaSendQueueSize),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	// A replica re-syncing under the same ID replaces the old entry
+	if old, exists := rm.replicas[id]; exists {
+		old.stop()
 	}
 
 	rm.replicas[id] = replica
+	go rm.replicaWriter(replica)
 	log.Printf("[REPLICATION] Replica connected: %s (%s)", id, replica.Addr)
 
 	return replica
@@ -277,6 +372,7 @@ func (rm *ReplicationManager) RemoveReplica(id string) {
 	defer rm.replicasMu.Unlock()
 
 	if replica, exists := rm.replicas[id]; exists {
+		replica.stop()
 		replica.Conn.Close()
 		delete(rm.replicas, id)
 		log.Printf("[REPLICATION] Replica disconnected: %s", id)
@@ -312,10 +408,38 @@ func (rm *ReplicationManager) UpdateReplicaOffset(id string, offset int64) {
 
 	if replica, exists := rm.replicas[id]; exists {
 		replica.Offset = offset
+		replica.AckOffset = offset
 		replica.LastPingAt = time.Now()
 	}
 }
 
+// MarkReplicaOnline starts streaming to a replica whose sync is complete
+// offset is the master offset its initial data covers
+func (rm *ReplicationManager) MarkReplicaOnline(id string, offset int64) {
+	rm.replicasMu.Lock()
+	defer rm.replicasMu.Unlock()
+
+	if replica, exists := rm.replicas[id]; exists {
+		replica.State = ReplicaStateOnline
+		replica.Offset = offset
+	}
+}
+
+// setReplicaSentOffset records the master offset written to a replica
+func (rm *ReplicationManager) setReplicaSentOffset(replica *ReplicaInfo, offset int64) {
+	rm.replicasMu.Lock()
+	defer rm.replicasMu.Unlock()
+	replica.Offset = offset
+}
+
+// dropReplica marks a replica offline and removes it
+func (rm *ReplicationManager) dropReplica(replica *ReplicaInfo) {
+	rm.replicasMu.Lock()
+	replica.State = ReplicaStateOffline
+	rm.replicasMu.Unlock()
+	rm.RemoveReplica(replica.ID)
+}
+
 // SetReplicaListeningPort sets the listening port for a replica
 func (rm *ReplicationManager) SetReplicaListeningPort(id string, port int) {
 	rm.replicasMu.Lock()
@@ -327,6 +451,17 @@ func (rm *ReplicationManager) SetReplicaListeningPort(id string, port int) {
 	}
 }
 
+// SetReplicaAnnounceIP sets the announced IP address for a replica
+func (rm *ReplicationManager) SetReplicaAnnounceIP(id string, ip string) {
+	rm.replicasMu.Lock()
+	defer rm.replicasMu.Unlock()
+
+	if replica, exists := rm.replicas[id]; exists {
+		replica.AnnounceIP = ip
+		log.Printf("[REPLICATION] Set announced ip %s for replica %s", ip, id)
+	}
+}
+
 // GetAllReplicas returns all connected replicas
 func (rm *ReplicationManager) GetAllReplicas() []*ReplicaInfo {
 	rm.replicasMu.RLock()
@@ -342,7 +477,7 @@ func (rm *ReplicationManager) GetAllReplicas() []*ReplicaInfo {
 
 // PropagateCommand queues a command for propagation to replicas
 func (rm *ReplicationManager) PropagateCommand(args []string) {
-	if rm.role != RoleMaster {
+	if rm.GetRole() != RoleMaster {
 		return
 	}
 
@@ -358,6 +493,134 @@ func (rm *ReplicationManager) PropagateCommand(args []string) {
 	}
 }
 
+// PropagateTransaction queues the write commands of an EXEC for propagation
+// to replicas wrapped in MULTI/EXEC, so a replica applies all of them or none
+// A single command needs no wrapping and is propagated as is
+func (rm *ReplicationManager) PropagateTransaction(cmds [][]string) {
+	if len(cmds) < 2 {
+		for _, args := range cmds {
+			rm.PropagateCommand(args)
+		}
+		return
+	}
+	if rm.GetRole() != RoleMaster {
+		return
+	}
+
+	block := make([][]string, 0, len(cmds)+2)
+	block = append(block, []string{"MULTI"})
+	block = append(block, cmds...)
+	block = append(block, []string{"EXEC"})
+
+	cmd := &Command{
+		Block:     block,
+		Timestamp: time.Now(),
+	}
+
+	select {
+	case rm.commandChan <- cmd:
+	default:
+		log.Printf("[REPLICATION] WARNING: Command queue full, dropping transaction")
+	}
+}
+
+// ErrReplicationStopped is returned for an offset requested while
+// replication shuts down, as the propagation queue is no longer served
+var ErrReplicationStopped = errors.New("replication is shutting down")
+
+// RequestAck asks every replica for its offset with REPLCONF GETACK
+// It returns the master offset just before the GETACK, i.e. the offset a
+// replica must acknowledge to have received every earlier write. Going
+// through the propagation queue guarantees writes still queued at the time
+// of the call are counted, so it waits for room in a full queue
+func (rm *ReplicationManager) RequestAck(ctx context.Context) (int64, error) {
+	return rm.queueOffsetMarker(ctx, &Command{
+		Args:      []string{"REPLCONF", "GETACK", "*"},
+		Timestamp: time.Now(),
+	})
+}
+
+// queueOffsetMarker queues cmd for propagation and returns the master offset
+// the propagation goroutine reports for it
+func (rm *ReplicationManager) queueOffsetMarker(ctx context.Context, cmd *Command) (int64, error) {
+	offsetCh := make(chan int64, 1)
+	cmd.OffsetCh = offsetCh
+
+	select {
+	case rm.commandChan <- cmd:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-rm.shutdownChan:
+		return 0, ErrReplicationStopped
+	}
+
+	select {
+	case offset := <-offsetCh:
+		return offset, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-rm.shutdownChan:
+		return 0, ErrReplicationStopped
+	}
+}
+
+// SyncOffset returns the master offset once every command queued for
+// propagation so far is counted in it, i.e. the offset a replica must reach
+// to have applied all writes made before the call
+func (rm *ReplicationManager) SyncOffset(ctx context.Context) (int64, error) {
+	return rm.queueOffsetMarker(ctx, &Command{Timestamp: time.Now()})
+}
+
+// AppliedOffset returns the replication offset this server has applied:
+// the master offset on a master, the offset processed from the master's
+// stream on a replica
+func (rm *ReplicationManager) AppliedOffset() int64 {
+	if rm.GetRole() == RoleMaster {
+		return rm.GetOffset()
+	}
+
+	rm.masterInfoMu.RLock()
+	defer rm.masterInfoMu.RUnlock()
+	if rm.masterInfo == nil {
+		return 0
+	}
+	return rm.masterInfo.Offset
+}
+
+// GetOffset returns the master replication offset
+func (rm *ReplicationManager) GetOffset() int64 {
+	rm.backlogMu.Lock()
+	defer rm.backlogMu.Unlock()
+	return rm.offset
+}
+
+// CountAckedReplicas returns how many online replicas acknowledged at least offset
+func (rm *ReplicationManager) CountAckedReplicas(offset int64) int {
+	rm.replicasMu.RLock()
+	defer rm.replicasMu.RUnlock()
+
+	count := 0
+	for _, replica := range rm.replicas {
+		if replica.State == ReplicaStateOnline && replica.AckOffset >= offset {
+			count++
+		}
+	}
+	return count
+}
+
+// ReplicaAckOffset returns the offset an online replica last acknowledged,
+// or false if it is no longer connected and online
+func (rm *ReplicationManager) ReplicaAckOffset(id string) (int64, bool) {
+	rm.replicasMu.RLock()
+	defer rm.replicasMu.RUnlock()
+
+	replica, exists := rm.replicas[id]
+	if !exists || replica.State != ReplicaStateOnline {
+		return 0, false
+	}
+	return replica.AckOffset, true
+}
+
 // propagateCommands handles command propagation to all replicas
 func (rm *ReplicationManager) propagateCommands() {
 	defer rm.wg.Done()
@@ -374,11 +637,28 @@ func (rm *ReplicationManager) propagateCommands() {
 
 // propagateToReplicas sends a command to all connected replicas
 func (rm *ReplicationManager) propagateToReplicas(cmd *Command) {
-	// Encode command in RESP format
-	respData := encodeCommandRESP(cmd.Args)
+	// Offset markers from SyncOffset carry nothing to send
+	if len(cmd.Args) == 0 && len(cmd.Block) == 0 {
+		cmd.OffsetCh <- rm.GetOffset()
+		return
+	}
+
+	// Encode command in RESP format; a block is sent as one write so it
+	// reaches the backlog and every replica in one piece
+	var respData []byte
+	if len(cmd.Block) > 0 {
+		for _, args := range cmd.Block {
+			respData = append(respData, encodeCommandRESP(args)...)
+		}
+	} else {
+		respData = encodeCommandRESP(cmd.Args)
+	}
 
 	// Add to backlog
 	rm.backlogMu.Lock()
+	if cmd.OffsetCh != nil {
+		cmd.OffsetCh <- rm.offset
+	}
 	rm.backlog.Append(respData)
 	rm.offset += int64(len(respData))
 	currentOffset := rm.offset
@@ -394,29 +674,70 @@ func (rm *ReplicationManager) propagateToReplicas(cmd *Command) {
 	}
 	rm.replicasMu.RUnlock()
 
+	// Hand the command to each replica's writer without blocking; a replica
+	// whose queue is full has fallen too far behind and is disconnected
+	write := replicaWrite{data: respData, offset: currentOffset}
 	for _, replica := range replicas {
-		replica.mu.Lock()
-		_, err := replica.Writer.Write(respData)
-		if err != nil {
-			log.Printf("[REPLICATION] Error sending to replica %s: %v", replica.ID, err)
-			replica.State = ReplicaStateOffline
-			replica.mu.Unlock()
-			rm.RemoveReplica(replica.ID)
-			continue
+		select {
+		case replica.sendQueue <- write:
+		default:
+			log.Printf("[REPLICATION] Replica %s send queue full, disconnecting slow replica", replica.ID)
+			rm.dropReplica(replica)
+		}
+	}
+}
+
+// replicaWriter streams queued commands to one replica until it is stopped
+// Commands already queued are written together before each flush, so a
+// replica that fell behind catches up in large writes
+func (rm *ReplicationManager) replicaWriter(replica *ReplicaInfo) {
+	defer close(replica.done)
+
+	for {
+		select {
+		case write := <-replica.sendQueue:
+			offset, err := replica.writeBatch(write)
+			if err != nil {
+				log.Printf("[REPLICATION] Error sending to replica %s: %v", replica.ID, err)
+				rm.dropReplica(replica)
+				return
+			}
+			rm.setReplicaSentOffset(replica, offset)
+		case <-replica.quit:
+			return
 		}
+	}
+}
 
-		err = replica.Writer.Flush()
-		if err != nil {
-			log.Printf("[REPLICATION] Error flushing to replica %s: %v", replica.ID, err)
-			replica.State = ReplicaStateOffline
-			replica.mu.Unlock()
-			rm.RemoveReplica(replica.ID)
-			continue
+// writeBatch writes the given command plus everything else already queued,
+// then flushes once; it returns the master offset after the last write
+func (r *ReplicaInfo) writeBatch(write replicaWrite) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	offset := write.offset
+	if _, err := r.Writer.Write(write.data); err != nil {
+		return 0, err
+	}
+
+	// Only this replica's writer goroutine receives from the queue
+	for len(r.sendQueue) > 0 {
+		next := <-r.sendQueue
+		if _, err := r.Writer.Write(next.data); err != nil {
+			return 0, err
 		}
+		offset = next.offset
+	}
 
-		replica.Offset = currentOffset
-		replica.mu.Unlock()
+	if err := r.Writer.Flush(); err != nil {
+		return 0, err
 	}
+	return offset, nil
+}
+
+// stop signals the replica's writer goroutine to exit
+func (r *ReplicaInfo) stop() {
+	r.quitOnce.Do(func() { close(r.quit) })
 }
 
 // encodeCommandRESP encodes a command in RESP array format
@@ -441,15 +762,32 @@ func parseAddr(addr string) (string, int) {
 	return host, port
 }
 
+// AdvertisedAddr returns the address other nodes should use to reach the replica
+// Prefers the ip-address and listening-port sent via REPLCONF, falling back to
+// the connection's source address
+func (r *ReplicaInfo) AdvertisedAddr() (string, int) {
+	ip, port := parseAddr(r.Addr)
+	if r.AnnounceIP != "" {
+		ip = r.AnnounceIP
+	}
+	if r.ListeningPort > 0 {
+		port = r.ListeningPort
+	}
+	return ip, port
+}
+
 // GetInfo returns replication info
 func (rm *ReplicationManager) GetInfo() map[string]interface{} {
 	info := make(map[string]interface{})
 
-	info["role"] = string(rm.role)
+	rm.mu.RLock()
+	role := rm.role
 	info["master_repl_id"] = rm.replID
-	info["master_repl_offset"] = rm.offset
+	rm.mu.RUnlock()
+	info["role"] = string(role)
+	info["master_repl_offset"] = rm.GetOffset()
 
-	if rm.role == RoleMaster {
+	if role == RoleMaster {
 		rm.replicasMu.RLock()
 		info["connected_slaves"] = len(rm.replicas)
 
@@ -457,13 +795,7 @@ func (rm *ReplicationManager) GetInfo() map[string]interface{} {
 		slaves := make([]map[string]interface{}, 0, len(rm.replicas))
 		i := 0
 		for _, replica := range rm.replicas {
-			ip, port := parseAddr(replica.Addr)
-
-			// Use the listening port if available (sent via REPLCONF)
-			// Otherwise fall back to the port from the connection address
-			if replica.ListeningPort > 0 {
-				port = replica.ListeningPort
-			}
+			ip, port := replica.AdvertisedAddr()
 
 			slaveInfo := map[string]interface{}{
 				"id":     replica.ID,
@@ -523,9 +855,18 @@ func (rm *ReplicationManager) Shutdown() {
 	log.Println("[REPLICATION] Command queue drained")
 
 	// Flush and close all replica connections
-	rm.replicasMu.Lock()
-	for _, replica := range rm.replicas {
+	// Writers are stopped without holding replicasMu, since a writer that
+	// fails removes its replica under that lock
+	for _, replica := range rm.GetAllReplicas() {
+		// Stop the writer, then send whatever it had not written yet
+		// The deadline bounds how long a stalled replica can delay shutdown
+		replica.Conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		replica.stop()
+		<-replica.done
 		replica.mu.Lock()
+		for len(replica.sendQueue) > 0 {
+			replica.Writer.Write((<-replica.sendQueue).data)
+		}
 
 		// Flush any buffered data
 		if err := replica.Writer.Flush(); err != nil {
@@ -538,7 +879,6 @@ func (rm *ReplicationManager) Shutdown() {
 
 		log.Printf("[REPLICATION] Closed replica %s", replica.ID)
 	}
-	rm.replicasMu.Unlock()
 
 	// Close master connection
 	rm.masterInfoMu.Lock()
@@ -564,6 +904,14 @@ func (rm *ReplicationManager) SetCommandExecutor(executor func(args []string) er
 	rm.commandExecutor = executor
 }
 
+// SetTransactionExecutor sets the callback for applying a MULTI ... EXEC
+// block received from master as one unit
+func (rm *ReplicationManager) SetTransactionExecutor(executor func(cmds [][]string) error) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.txExecutor = executor
+}
+
 // SetStoreGetter sets the callback for getting store snapshot (for RDB generation)
 func (rm *ReplicationManager) SetStoreGetter(getter func() interface{}) {
 	rm.storeGetterMu.Lock()
@@ -597,3 +945,22 @@ func (rm *ReplicationManager) executeReplicatedCommand(args []string) error {
 
 	return executor(args)
 }
+
+// executeReplicatedTransaction applies the commands of a MULTI ... EXEC block
+// received from master, one by one if no transaction executor is set
+func (rm *ReplicationManager) executeReplicatedTransaction(cmds [][]string) error {
+	rm.mu.RLock()
+	executor := rm.txExecutor
+	rm.mu.RUnlock()
+
+	if executor == nil {
+		for _, args := range cmds {
+			if err := rm.executeReplicatedCommand(args); err != nil {
+				log.Printf("[REPLICATION] Error executing replicated command %v: %v", args, err)
+			}
+		}
+		return nil
+	}
+
+	return executor(cmds)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +23,7 @@ type Sentinel struct {
 	quorum       int // Number of sentinels that need to agree master is down
 	downAfter    time.Duration
 	failoverTime time.Duration
+	maxLag       int64 // Max bytes a replica may trail the master and still be promoted (0 = no limit)
 
 	// State
 	master             *MonitoredInstance
@@ -65,9 +67,10 @@ type SentinelConfig struct {
 	MasterName      string
 	MasterHost      string
 	MasterPort      int
-	Quorum          int // Number of sentinels for quorum (for now, 1 = single sentinel)
-	DownAfterMillis int // Milliseconds before marking instance as down
-	FailoverTimeout int // Milliseconds for failover timeout
+	Quorum          int   // Number of sentinels for quorum (for now, 1 = single sentinel)
+	DownAfterMillis int   // Milliseconds before marking instance as down
+	FailoverTimeout int   // Milliseconds for failover timeout
+	MaxReplicaLag   int64 // Max replication lag in bytes for a promotable replica (0 = no limit)
 }
 
 // ==================== SENTINEL CREATION AND LIFECYCLE ====================
@@ -97,6 +100,7 @@ func NewSentinel(config SentinelConfig) *Sentinel {
 		downAfter:    downAfter,
 		pubsub:       storage.NewPubSub(),
 		failoverTime: failoverTime,
+		maxLag:       config.MaxReplicaLag,
 		replicas:     make(map[string]*MonitoredInstance),
 		stopChan:     make(chan struct{}),
 	}
@@ -263,6 +267,14 @@ func (s *Sentinel) checkMasterHealth() {
 	downSince := s.master.DownSince
 	s.master.mu.Unlock()
 
+	// A master stopped with SHUTDOWN FAILOVER promoted a replica before
+	// exiting; follow it right away instead of waiting for down-after
+	if isDown && time.Since(downSince) < s.downAfter {
+		if s.adoptPromotedReplica() {
+			return
+		}
+	}
+
 	// Trigger failover ONCE when master crosses down threshold
 	// Don't spam every second - let election timer handle it
 	if isDown && time.Since(downSince) >= s.downAfter {
@@ -281,6 +293,9 @@ func (s *Sentinel) checkMasterHealth() {
 
 // checkReplicasHealth pings all replicas in parallel
 func (s *Sentinel) checkReplicasHealth() {
+	// Refresh the master offset first so replica offsets are compared against a recent value
+	s.refreshMasterOffset()
+
 	s.replicasMu.RLock()
 	replicas := make([]*MonitoredInstance, 0, len(s.replicas))
 	for _, replica := range s.replicas {
@@ -305,9 +320,40 @@ func (s *Sentinel) checkReplicasHealth() {
 
 			ok := s.pingInstance(host, port)
 
+			// Ask the replica how far it has processed the replication stream
+			// and which failover priority it is configured with
+			offset, hasOffset := int64(0), false
+			priority, hasPriority := 0, false
+			role := ""
+			if ok {
+				if info, err := queryReplicationInfo(host, port); err == nil {
+					role = info["role"]
+					if v, exists := info["slave_repl_offset"]; exists {
+						_, scanErr := fmt.Sscanf(v, "%d", &offset)
+						hasOffset = scanErr == nil
+					}
+					if v, exists := info["slave_priority"]; exists {
+						_, scanErr := fmt.Sscanf(v, "%d", &priority)
+						hasPriority = scanErr == nil
+					}
+				}
+			}
+
 			r.mu.Lock()
 			r.LastPing = time.Now()
 			r.LastPingOK = ok
+			switch role {
+			case "master":
+				r.Role = "master"
+			case "slave":
+				r.Role = "slave"
+			}
+			if hasOffset {
+				r.ReplOffset = offset
+			}
+			if hasPriority {
+				r.Priority = priority
+			}
 
 			if !ok && !r.IsDown {
 				r.IsDown = true
@@ -318,6 +364,12 @@ func (s *Sentinel) checkReplicasHealth() {
 				log.Printf("[SENTINEL] Replica %s:%d is UP", host, port)
 			}
 			r.mu.Unlock()
+
+			// A replica reporting itself as master is typically the old master
+			// coming back after a failover; point it at the current master
+			if role == "master" {
+				s.convertToReplica(host, port)
+			}
 		}(replica)
 	}
 
@@ -338,48 +390,24 @@ func (s *Sentinel) discoverReplicas() {
 		return
 	}
 
-	addr := fmt.Sprintf("%s:%d", host, port)
-	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
-	if err != nil {
-		return
-	}
-	defer conn.Close()
-
-	conn.SetDeadline(time.Now().Add(2 * time.Second))
-
-	// Send INFO replication command
-	_, err = conn.Write([]byte("*2\r\n$4\r\nINFO\r\n$11\r\nreplication\r\n"))
-	if err != nil {
-		return
-	}
-
-	// Read response
-	buffer := make([]byte, 4096)
-	n, err := conn.Read(buffer)
+	info, err := queryReplicationInfo(host, port)
 	if err != nil {
 		return
 	}
 
-	response := string(buffer[:n])
+	// Track the master offset so replicas can be checked for being in sync
+	s.updateMasterOffset(info)
 
 	// Parse INFO replication response to find replicas
 	// Format: slave0:ip=127.0.0.1,port=6380,state=online,offset=123,lag=0
-	lines := strings.Split(response, "\r\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "slave") {
-			// Parse replica info
-			parts := strings.Split(line, ":")
-			if len(parts) < 2 {
-				continue
-			}
-
-			info := parts[1]
+	for field, value := range info {
+		if strings.HasPrefix(field, "slave") && strings.HasPrefix(value, "ip=") {
 			replicaHost := ""
 			replicaPort := 0
 			offset := int64(0)
 
 			// Parse key=value pairs
-			pairs := strings.Split(info, ",")
+			pairs := strings.Split(value, ",")
 			for _, pair := range pairs {
 				kv := strings.Split(pair, "=")
 				if len(kv) != 2 {
@@ -424,6 +452,69 @@ func (s *Sentinel) discoverReplicas() {
 	}
 }
 
+// refreshMasterOffset reads master_repl_offset from the master, unless it is down
+func (s *Sentinel) refreshMasterOffset() {
+	s.master.mu.RLock()
+	host := s.master.Host
+	port := s.master.Port
+	isDown := s.master.IsDown
+	s.master.mu.RUnlock()
+
+	if isDown {
+		return
+	}
+
+	if info, err := queryReplicationInfo(host, port); err == nil {
+		s.updateMasterOffset(info)
+	}
+}
+
+// updateMasterOffset stores master_repl_offset from a parsed INFO replication reply
+func (s *Sentinel) updateMasterOffset(info map[string]string) {
+	var offset int64
+	if _, err := fmt.Sscanf(info["master_repl_offset"], "%d", &offset); err != nil {
+		return
+	}
+
+	s.master.mu.Lock()
+	s.master.ReplOffset = offset
+	s.master.mu.Unlock()
+}
+
+// queryReplicationInfo sends INFO replication to an instance and returns its
+// "field:value" lines as a map
+func queryReplicationInfo(host string, port int) (map[string]string, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// Send INFO replication command
+	_, err = conn.Write([]byte("*2\r\n$4\r\nINFO\r\n$11\r\nreplication\r\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Read response
+	buffer := make([]byte, 4096)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	info := make(map[string]string)
+	for _, line := range strings.Split(string(buffer[:n]), "\r\n") {
+		field, value, found := strings.Cut(line, ":")
+		if found {
+			info[field] = value
+		}
+	}
+	return info, nil
+}
+
 // pingInstance attempts to connect and send PING
 func (s *Sentinel) pingInstance(host string, port int) bool {
 	addr := fmt.Sprintf("%s:%d", host, port)
@@ -521,6 +612,63 @@ func (s *Sentinel) performFailover() {
 		return
 	}
 
+	s.switchMaster(newMasterHost, newMasterPort, startTime)
+}
+
+// adoptPromotedReplica looks for a replica that now reports role master while
+// the master is down, which is what SHUTDOWN FAILOVER leaves behind: the old
+// master promoted its most up-to-date replica before exiting. That replica
+// becomes the monitored master without a vote, since there is nothing left to
+// promote and every Sentinel finds the same replica. Only replicas last seen
+// replicating and eligible for promotion qualify, so a former master that
+// restarts with role master is not taken for one
+func (s *Sentinel) adoptPromotedReplica() bool {
+	s.replicasMu.RLock()
+	candidates := make([]*MonitoredInstance, 0, len(s.replicas))
+	for _, replica := range s.replicas {
+		replica.mu.RLock()
+		eligible := !replica.IsDown && replica.Role == "slave" && replica.Priority > 0
+		replica.mu.RUnlock()
+		if eligible {
+			candidates = append(candidates, replica)
+		}
+	}
+	s.replicasMu.RUnlock()
+
+	for _, replica := range candidates {
+		replica.mu.RLock()
+		host := replica.Host
+		port := replica.Port
+		replica.mu.RUnlock()
+
+		info, err := queryReplicationInfo(host, port)
+		if err != nil || info["role"] != "master" {
+			continue
+		}
+
+		s.failoverMu.Lock()
+		if s.failoverInProgress {
+			s.failoverMu.Unlock()
+			return false
+		}
+		s.failoverInProgress = true
+		s.failoverTriggered = true
+		s.failoverMu.Unlock()
+
+		log.Printf("[SENTINEL] Replica %s:%d was promoted by its master, following it", host, port)
+		s.switchMaster(host, port, time.Now())
+
+		s.failoverMu.Lock()
+		s.failoverInProgress = false
+		s.failoverMu.Unlock()
+		return true
+	}
+	return false
+}
+
+// switchMaster makes an already promoted replica the monitored master,
+// repoints the other replicas at it and announces +switch-master
+func (s *Sentinel) switchMaster(newMasterHost string, newMasterPort int, startTime time.Time) {
 	// Step 3: Update master reference
 	s.master.mu.Lock()
 	oldMasterHost := s.master.Host
@@ -585,10 +733,26 @@ func (s *Sentinel) performFailover() {
 }
 
 // selectBestReplica chooses the best replica for promotion
+// Replicas trailing the best-known master offset by more than maxLag bytes are
+// skipped: failing over to them would silently drop that window of writes
 func (s *Sentinel) selectBestReplica() *MonitoredInstance {
+	s.master.mu.RLock()
+	masterOffset := s.master.ReplOffset
+	s.master.mu.RUnlock()
+
 	s.replicasMu.RLock()
 	defer s.replicasMu.RUnlock()
 
+	// The last master offset we saw may be stale; a replica that got further proves
+	// the master reached at least that offset
+	for _, replica := range s.replicas {
+		replica.mu.RLock()
+		if replica.ReplOffset > masterOffset {
+			masterOffset = replica.ReplOffset
+		}
+		replica.mu.RUnlock()
+	}
+
 	var bestReplica *MonitoredInstance
 	var bestScore int64 = -1
 
@@ -604,6 +768,18 @@ func (s *Sentinel) selectBestReplica() *MonitoredInstance {
 			continue
 		}
 
+		// Priority 0 marks a replica that must never be promoted
+		if priority <= 0 {
+			continue
+		}
+
+		// Skip replicas missing too many writes
+		if s.maxLag > 0 && masterOffset-offset > s.maxLag {
+			log.Printf("[SENTINEL] Replica %s:%d lags master by %d bytes (max %d), not eligible for promotion",
+				replica.Host, replica.Port, masterOffset-offset, s.maxLag)
+			continue
+		}
+
 		// Calculate score: priority * 1000000 + offset
 		// Higher priority and higher offset = better candidate
 		score := int64(priority)*1000000 + offset
@@ -680,6 +856,26 @@ func (s *Sentinel) reconfigureReplicas(newMasterHost string, newMasterPort int)
 	}
 }
 
+// convertToReplica reconfigures an instance that still believes it is a master
+// to follow the current master. Having been a master, it discards its
+// replication state and does a full resync, so writes it accepted that never
+// reached the new master are dropped instead of merged
+func (s *Sentinel) convertToReplica(host string, port int) {
+	s.master.mu.RLock()
+	masterHost := s.master.Host
+	masterPort := s.master.Port
+	masterDown := s.master.IsDown
+	s.master.mu.RUnlock()
+
+	if masterDown || (host == masterHost && port == masterPort) {
+		return
+	}
+
+	log.Printf("[SENTINEL] %s:%d reports role master, converting it to a replica of %s:%d",
+		host, port, masterHost, masterPort)
+	s.reconfigureReplica(host, port, masterHost, masterPort)
+}
+
 // reconfigureReplica tells a replica to follow new master
 func (s *Sentinel) reconfigureReplica(replicaHost string, replicaPort int, masterHost string, masterPort int) bool {
 	addr := fmt.Sprintf("%s:%d", replicaHost, replicaPort)
@@ -769,12 +965,19 @@ func (s *Sentinel) GetStatus() map[string]interface{} {
 	status["master_host"] = s.master.Host
 	status["master_port"] = s.master.Port
 	status["master_status"] = s.getMasterStatus(s.master)
+	status["master_offset"] = s.master.ReplOffset
+	masterOffset := s.master.ReplOffset
 	s.master.mu.RUnlock()
 
 	s.replicasMu.RLock()
 	replicaList := make([]map[string]interface{}, 0, len(s.replicas))
+	inSync := 0
 	for _, replica := range s.replicas {
 		replica.mu.RLock()
+		// A replica is in sync when it is up and has processed everything the master has
+		if !replica.IsDown && replica.ReplOffset >= masterOffset {
+			inSync++
+		}
 		replicaInfo := map[string]interface{}{
 			"host":     replica.Host,
 			"port":     replica.Port,
@@ -789,6 +992,7 @@ func (s *Sentinel) GetStatus() map[string]interface{} {
 
 	status["replicas"] = replicaList
 	status["replicas_count"] = len(replicaList)
+	status["in_sync_replicas_count"] = inSync
 
 	s.failoverMu.Lock()
 	status["failover_in_progress"] = s.failoverInProgress
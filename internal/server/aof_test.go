@@ -0,0 +1,287 @@
+package server
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"redis/internal/aof"
+)
+
+// startAOFServer starts a test server that fsyncs its AOF on every write, so
+// a command is in the file by the time its reply arrives
+func startAOFServer(t *testing.T, configure func(cfg *Config)) (*RedisServer, int) {
+	t.Helper()
+	return startTestServer(t, func(cfg *Config) {
+		cfg.AOF.Enabled = true
+		cfg.AOF.Filepath = filepath.Join(t.TempDir(), "appendonly.aof")
+		cfg.AOF.SyncPolicy = aof.SyncAlways
+		if configure != nil {
+			configure(cfg)
+		}
+	})
+}
+
+// readAOF returns the commands logged in the server's AOF
+func readAOF(t *testing.T, s *RedisServer) [][]string {
+	t.Helper()
+	reader, err := aof.NewReader(s.config.AOF.Filepath)
+	if err != nil || reader == nil {
+		t.Fatalf("open AOF: %v", err)
+	}
+	defer reader.Close()
+	commands, err := reader.LoadAll()
+	if err != nil {
+		t.Fatalf("read AOF: %v", err)
+	}
+	return commands
+}
+
+// loggedCommands returns the logged commands whose name is one of names
+func loggedCommands(t *testing.T, s *RedisServer, names ...string) [][]string {
+	t.Helper()
+	var matched [][]string
+	for _, args := range readAOF(t, s) {
+		for _, name := range names {
+			if strings.EqualFold(args[0], name) {
+				matched = append(matched, args)
+			}
+		}
+	}
+	return matched
+}
+
+// rewriteAOF runs BGREWRITEAOF and waits for the rewritten file
+func rewriteAOF(t *testing.T, c *testClient) {
+	t.Helper()
+	if reply := c.do("BGREWRITEAOF"); isErrorReply(reply) {
+		t.Fatalf("BGREWRITEAOF: %v", reply)
+	}
+	waitFor(t, 5*time.Second, "the AOF rewrite to finish", func() bool {
+		info, _ := c.do("INFO", "persistence").(string)
+		return strings.Contains(info, "aof_rewrite_in_progress:0")
+	})
+}
+
+// checkDeadline fails unless arg is a Unix ms deadline within 1s of want
+func checkDeadline(t *testing.T, what, arg string, want time.Time) {
+	t.Helper()
+	ms, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		t.Fatalf("%s deadline %q is not an integer", what, arg)
+	}
+	if diff := time.UnixMilli(ms).Sub(want); diff < -time.Second || diff > time.Second {
+		t.Fatalf("%s deadline %v is %v off %v", what, time.UnixMilli(ms), diff, want)
+	}
+}
+
+// SETEX and PSETEX are logged as one SET with an absolute PXAT deadline
+func TestSetExLoggedAsSetPXAT(t *testing.T) {
+	s, port := startAOFServer(t, nil)
+	c := dialTestClient(t, port)
+
+	start := time.Now()
+	if reply := c.do("SETEX", "k", "100", "v"); reply != "OK" {
+		t.Fatalf("SETEX: %v", reply)
+	}
+	if reply := c.do("PSETEX", "p", "5000", "w"); reply != "OK" {
+		t.Fatalf("PSETEX: %v", reply)
+	}
+
+	logged := loggedCommands(t, s, "SET", "SETEX", "PSETEX", "PEXPIREAT")
+	if len(logged) != 2 {
+		t.Fatalf("logged %v, want two SET commands", logged)
+	}
+	for i, want := range []struct {
+		key, value string
+		ttl        time.Duration
+	}{{"k", "v", 100 * time.Second}, {"p", "w", 5 * time.Second}} {
+		args := logged[i]
+		if len(args) != 5 || args[0] != "SET" || args[1] != want.key || args[2] != want.value || args[3] != "PXAT" {
+			t.Fatalf("logged %v, want SET %s %s PXAT <ms>", args, want.key, want.value)
+		}
+		checkDeadline(t, args[1], args[4], start.Add(want.ttl))
+	}
+}
+
+// With expire jitter the AOF and replicas get the deadline the master set,
+// not one recomputed from the command's TTL
+func TestJitteredExpiryPropagated(t *testing.T) {
+	master, masterPort := startAOFServer(t, func(cfg *Config) {
+		cfg.ExpireJitterPercent = 50
+	})
+	_, replicaPort := startTestServer(t, func(cfg *Config) {
+		cfg.ReplicationRole = "replica"
+		cfg.ReplicationMasterHost = "127.0.0.1"
+		cfg.ReplicationMasterPort = masterPort
+	})
+	c := dialTestClient(t, masterPort)
+	replica := dialTestClient(t, replicaPort)
+
+	keys := []string{"set", "setex", "expire"}
+	start := time.Now()
+	if reply := c.do("SET", "set", "v", "EX", "1000"); reply != "OK" {
+		t.Fatalf("SET: %v", reply)
+	}
+	if reply := c.do("SETEX", "setex", "1000", "v"); reply != "OK" {
+		t.Fatalf("SETEX: %v", reply)
+	}
+	c.do("SET", "expire", "v")
+	if reply := c.do("EXPIRE", "expire", "1000"); reply != int64(1) {
+		t.Fatalf("EXPIRE: %v", reply)
+	}
+
+	waitFor(t, 5*time.Second, "the keys to reach the replica", func() bool {
+		return replica.do("TTL", "expire") != int64(-1) && replica.do("EXISTS", keys[0], keys[1], keys[2]) == int64(3)
+	})
+
+	deadlines := make(map[string]string)
+	for _, args := range loggedCommands(t, master, "SET", "PEXPIREAT") {
+		if args[0] == "PEXPIREAT" {
+			deadlines[args[1]] = args[2]
+		} else if len(args) == 5 && args[3] == "PXAT" {
+			deadlines[args[1]] = args[4]
+		}
+	}
+
+	for _, key := range keys {
+		ttl, ok := c.do("TTL", key).(int64)
+		if !ok || ttl <= 0 {
+			t.Fatalf("master TTL %s = %v", key, ttl)
+		}
+		if replicaTTL := replica.do("TTL", key).(int64); replicaTTL < ttl-1 || replicaTTL > ttl+1 {
+			t.Fatalf("replica TTL %s = %d, master %d", key, replicaTTL, ttl)
+		}
+		// TTL drops the fraction of a second, so the deadline is up to a
+		// second past start + ttl: aim at the middle
+		checkDeadline(t, key, deadlines[key], start.Add(time.Duration(ttl)*time.Second+500*time.Millisecond))
+	}
+}
+
+// A rewritten AOF stores absolute deadlines, so a server that replays it
+// later sees the remaining TTL, not the original one counted again
+func TestRewrittenAOFKeepsRemainingTTL(t *testing.T) {
+	s, port := startAOFServer(t, nil)
+	c := dialTestClient(t, port)
+
+	c.do("SET", "str", "v", "EX", "3600")
+	c.do("RPUSH", "list", "a", "b")
+	c.do("EXPIRE", "list", "3600")
+	c.do("HSET", "hash", "f", "v")
+	c.do("EXPIRE", "hash", "3600")
+	keys := []string{"str", "list", "hash"}
+
+	rewriteAOF(t, c)
+	for _, args := range readAOF(t, s) {
+		switch strings.ToUpper(args[0]) {
+		case "EXPIRE", "PEXPIRE", "SETEX", "PSETEX":
+			t.Fatalf("rewritten AOF has relative expiry %v", args)
+		}
+	}
+
+	// Let a second of the TTL pass before replaying the file
+	time.Sleep(1100 * time.Millisecond)
+	c.conn.Close()
+	s.Shutdown()
+	_, port = startTestServer(t, func(cfg *Config) {
+		cfg.AOF = s.config.AOF
+	})
+	c = dialTestClient(t, port)
+
+	for _, key := range keys {
+		ttl, ok := c.do("TTL", key).(int64)
+		if !ok || ttl < 3590 || ttl > 3598 {
+			t.Fatalf("TTL %s after replaying the rewritten AOF = %v, want 3590..3598", key, ttl)
+		}
+	}
+}
+
+// RESTORE with a relative TTL is logged with its deadline and ABSTTL, and a
+// TTL that would overflow is refused
+func TestRestoreLoggedWithAbsTTL(t *testing.T) {
+	s, port := startAOFServer(t, nil)
+	c := dialTestClient(t, port)
+
+	c.do("SET", "src", "v")
+	payload, ok := c.do("DUMP", "src").(string)
+	if !ok {
+		t.Fatalf("DUMP: %v", payload)
+	}
+
+	if err, ok := c.do("RESTORE", "big", "9223372036854775807", payload).(error); !ok || !strings.HasPrefix(err.Error(), "ERR invalid expire time") {
+		t.Fatalf("RESTORE with an overflowing TTL = %v", err)
+	}
+
+	start := time.Now()
+	if reply := c.do("RESTORE", "rel", "100000", payload); reply != "OK" {
+		t.Fatalf("RESTORE: %v", reply)
+	}
+	abs := strconv.FormatInt(start.Add(time.Hour).UnixMilli(), 10)
+	if reply := c.do("RESTORE", "abs", abs, payload, "ABSTTL"); reply != "OK" {
+		t.Fatalf("RESTORE ABSTTL: %v", reply)
+	}
+
+	logged := loggedCommands(t, s, "RESTORE")
+	if len(logged) != 2 {
+		t.Fatalf("logged %d RESTORE commands, want 2", len(logged))
+	}
+	if args := logged[0]; len(args) != 5 || args[1] != "rel" || args[4] != "ABSTTL" {
+		t.Fatalf("logged %q, want RESTORE rel <ms> <payload> ABSTTL", args)
+	} else {
+		checkDeadline(t, "rel", args[2], start.Add(100*time.Second))
+	}
+	if args := logged[1]; len(args) != 5 || args[1] != "abs" || args[2] != abs || args[4] != "ABSTTL" {
+		t.Fatalf("logged %q, want RESTORE abs %s <payload> ABSTTL", args, abs)
+	}
+}
+
+// Sorted set, Bloom filter, HyperLogLog and bitmap writes are logged, so the
+// keys they build come back when the AOF is replayed
+func TestAOFReplaysSortedSetAndBloomWrites(t *testing.T) {
+	s, port := startAOFServer(t, nil)
+	c := dialTestClient(t, port)
+
+	for _, args := range [][]string{
+		{"ZADD", "zset", "1", "a", "2", "b", "3", "c"},
+		{"ZINCRBY", "zset", "5", "a"},
+		{"ZREM", "zset", "b"},
+		{"ZMPOP", "1", "zset", "MAX", "COUNT", "1"},
+		{"BF.RESERVE", "bloom", "0.01", "100"},
+		{"BF.ADD", "bloom", "x"},
+		{"PFADD", "hll", "x", "y"},
+		{"SETBIT", "bits", "7", "1"},
+	} {
+		if reply := c.do(args...); isErrorReply(reply) {
+			t.Fatalf("%v: %v", args, reply)
+		}
+	}
+	count := c.do("PFCOUNT", "hll")
+	for _, name := range []string{"ZADD", "ZINCRBY", "ZREM", "BF.RESERVE", "BF.ADD", "PFADD", "SETBIT"} {
+		if len(loggedCommands(t, s, name)) != 1 {
+			t.Fatalf("%s was not logged to the AOF", name)
+		}
+	}
+
+	c.conn.Close()
+	s.Shutdown()
+	_, port = startTestServer(t, func(cfg *Config) {
+		cfg.AOF = s.config.AOF
+	})
+	c = dialTestClient(t, port)
+
+	// ZMPOP popped a (score 6), leaving c
+	if reply := c.do("ZRANGE", "zset", "0", "-1", "WITHSCORES"); !sameReply(reply, []interface{}{"c", "3"}) {
+		t.Fatalf("ZRANGE after replaying the AOF = %v, want [c 3]", reply)
+	}
+	if reply := c.do("BF.EXISTS", "bloom", "x"); reply != int64(1) {
+		t.Fatalf("BF.EXISTS after replaying the AOF = %v, want 1", reply)
+	}
+	if reply := c.do("PFCOUNT", "hll"); reply != count {
+		t.Fatalf("PFCOUNT after replaying the AOF = %v, want %v", reply, count)
+	}
+	if reply := c.do("GETBIT", "bits", "7"); reply != int64(1) {
+		t.Fatalf("GETBIT after replaying the AOF = %v, want 1", reply)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package server
+
+import "net"
+
+// setListenBacklog is a no-op on platforms where the backlog can't be resized
+// after the listener is created (the OS default is used)
+func setListenBacklog(listener net.Listener, backlog int) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// setListenBacklog resizes the accept queue of a listening TCP socket
+// Calling listen(2) again on a listening socket updates its backlog
+func setListenBacklog(listener net.Listener, backlog int) error {
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		return fmt.Errorf("not a TCP listener")
+	}
+
+	rawConn, err := tcpListener.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var listenErr error
+	err = rawConn.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	return listenErr
+}
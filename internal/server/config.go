@@ -1,9 +1,13 @@
 package server
 
 import (
+	"os"
 	"time"
 
 	"redis/internal/aof"
+	"redis/internal/handler"
+	"redis/internal/protocol"
+	"redis/internal/storage"
 )
 
 // RDBSavePoint defines automatic RDB save conditions (Redis-style)
@@ -19,25 +23,85 @@ type Config struct {
 	ReadBufferSize  int
 	WriteBufferSize int
 
+	// TCP configuration
+	TCPKeepAlive time.Duration // Keepalive period for client connections (0 = Go's default of 15s, negative = disabled)
+	TCPBacklog   int           // Listen backlog size (capped by the OS, e.g. somaxconn)
+
+	// UNIX socket configuration
+	UnixSocket     string      // Path of a UNIX domain socket to listen on as well ("" = TCP only)
+	UnixSocketPerm os.FileMode // Permissions of the socket file (0 = leave the umask default)
+
+	// Protocol limits
+	ProtoMaxBulkLen int64 // Largest bulk string a client may send (proto-max-bulk-len)
+
 	// Pipeline configuration
 	MaxPipelineCommands int           // Max commands in a single pipeline batch
 	SlowLogThreshold    time.Duration // Commands slower than this are logged
+	SlowLogMaxArgs      int           // slowlog-max-args: arguments kept per entry, command name included
+	SlowLogMaxArgLen    int           // slowlog-max-arg-len: bytes kept of each argument
 	CommandTimeout      time.Duration // Max time for a single command before client disconnect
 	ReadTimeout         time.Duration // Timeout for reading client data (idle timeout)
 	PipelineTimeout     time.Duration // Short timeout for waiting for in-flight pipelined commands
 
+	// PipelineMaxPendingBytes caps unflushed pipelined replies per connection;
+	// reaching it forces a flush before the batch ends. It sizes a buffer
+	// allocated for every connection (0 = WriteBufferSize)
+	PipelineMaxPendingBytes int
+
+	// Load shedding: once the processor queue holds LoadShedQueueDepth commands,
+	// new commands wait up to LoadShedWait for room and are then refused with
+	// an OVERLOADED error
+	LoadShedQueueDepth int           // 0 disables load shedding
+	LoadShedWait       time.Duration // Max wait for queue room before shedding
+
+	// Active expiry configuration
+	ActiveExpireInterval   time.Duration // How often the active expiry cycle runs
+	ActiveExpireSampleSize int           // Keys with a TTL sampled per iteration
+	ActiveExpireTimeBudget time.Duration // Max time spent per active expiry cycle
+
+	// Expiry randomization
+	ExpireJitterPercent int // expire-jitter-percentage: random ±% added to TTLs from SET EX/PX, SETEX, PSETEX and EXPIRE (0 = off)
+
+	// Pub/sub configuration
+	PubSubPingInterval time.Duration // Server-initiated keepalive ping to subscribers (0 = disabled)
+	PubSubBufferSize   int           // client-output-buffer-limit pubsub: messages buffered per subscriber
+
+	// Observability configuration
+	MetricsPort int // Port of the HTTP /metrics endpoint in Prometheus format (0 = disabled)
+
+	// Scripting configuration
+	LuaTimeLimit time.Duration // After this, a running script makes the server reply BUSY
+
+	// Encoding configuration
+	ListMaxListpackSize    int // Max size of a list kept as listpack (entries if > 0, -1..-5 = 4KB..64KB)
+	SetMaxIntsetEntries    int // Max members of an all-integer set kept as intset
+	ZSetMaxListpackEntries int // Max members of a sorted set kept as listpack
+	ZSetMaxListpackValue   int // Max member length (bytes) of a sorted set kept as listpack
+	HashMaxListpackEntries int // Max fields of a hash kept as listpack
+	HashMaxListpackValue   int // Max field or value length (bytes) of a hash kept as listpack
+
+	// Concurrency configuration
+	KeyLockStripes int // key-lock-stripes: per-key lock stripes single-key string commands run on (0 = off, the processor runs every command)
+
+	// Security configuration
+	RenameCommands map[string]string // rename-command: OLD -> NEW ("" disables the command)
+
 	// AOF (Append-Only File) configuration
 	AOF aof.Config
 
 	// RDB (Redis Database) configuration
-	RDBFilepath  string       // Path to RDB dump file
-	RDBSavePoint RDBSavePoint // Automatic save conditions
+	RDBFilepath            string       // Path to RDB dump file
+	RDBSavePoint           RDBSavePoint // Automatic save conditions
+	RejectWritesDuringSave bool         // Reject writes (TRYAGAIN) while BGSAVE/BGREWRITEAOF runs
 
 	// Replication configuration
 	ReplicationRole       string // "master" or "replica"
 	ReplicationMasterHost string // Master host (if replica)
 	ReplicationMasterPort int    // Master port (if replica)
 	ReplicaPriority       int    // Priority for Sentinel failover (0-100, higher = preferred)
+	ReplicaServeStaleData bool   // Serve reads while the link with the master is down
+	ReplicaAnnounceIP     string // Address advertised to the master instead of the connection source (NAT)
+	ReplicaAnnouncePort   int    // Port advertised to the master (0 = use Port)
 
 	// Cluster configuration
 	ClusterEnabled bool   // Enable cluster mode
@@ -53,12 +117,58 @@ func DefaultConfig() *Config {
 		ReadBufferSize:  4096,
 		WriteBufferSize: 4096,
 
+		// TCP defaults (same as Redis)
+		TCPKeepAlive: 300 * time.Second,
+		TCPBacklog:   511,
+
+		// Protocol defaults
+		ProtoMaxBulkLen: protocol.DefaultMaxBulkLen, // 512MB, same as Redis
+
 		// Pipeline defaults
-		MaxPipelineCommands: 1000,
-		SlowLogThreshold:    10 * time.Millisecond, // Log commands slower than 10ms
-		CommandTimeout:      30 * time.Second,      // Disconnect after 30s for a single command
-		ReadTimeout:         60 * time.Second,      // 60 second read timeout for partial commands
-		PipelineTimeout:     1 * time.Second,       // Short timeout for waiting for in-flight pipelined commands
+		MaxPipelineCommands:     1000,
+		SlowLogThreshold:        10 * time.Millisecond, // Log commands slower than 10ms
+		CommandTimeout:          30 * time.Second,      // Disconnect after 30s for a single command
+		ReadTimeout:             60 * time.Second,      // 60 second read timeout for partial commands
+		PipelineTimeout:         1 * time.Second,       // Short timeout for waiting for in-flight pipelined commands
+		PipelineMaxPendingBytes: 64 * 1024,             // Flush early once 64KB of replies is pending
+
+		// Slow log defaults (same as Redis)
+		SlowLogMaxArgs:   handler.DefaultSlowLogMaxArgs,
+		SlowLogMaxArgLen: handler.DefaultSlowLogMaxArgLen,
+
+		// Load shedding is off by default: a full queue makes commands wait.
+		// When enabled, pick a depth below the queue's 1000 commands
+		LoadShedQueueDepth: 0,
+		LoadShedWait:       50 * time.Millisecond,
+
+		// Active expiry defaults (Redis-style: 10 cycles/sec, 20 keys per sample)
+		ActiveExpireInterval:   100 * time.Millisecond,
+		ActiveExpireSampleSize: 20,
+		ActiveExpireTimeBudget: 1 * time.Millisecond,
+
+		// Expiry randomization defaults
+		ExpireJitterPercent: 0, // TTLs are applied exactly by default
+
+		// Pub/sub defaults
+		PubSubPingInterval: 0, // Disabled; dead subscribers are detected on the next publish
+		PubSubBufferSize:   storage.DefaultSubscriberBufferSize,
+
+		// Observability defaults
+		MetricsPort: 0, // Metrics endpoint disabled by default
+
+		// Scripting defaults
+		LuaTimeLimit: 5 * time.Second, // Redis default lua-time-limit
+
+		// Encoding defaults
+		ListMaxListpackSize:    -2,  // Redis default (8KB)
+		SetMaxIntsetEntries:    512, // Redis default
+		ZSetMaxListpackEntries: 128, // Redis default
+		ZSetMaxListpackValue:   64,  // Redis default
+		HashMaxListpackEntries: 128, // Redis default
+		HashMaxListpackValue:   64,  // Redis default
+
+		// Concurrency defaults
+		KeyLockStripes: 0, // Every command runs on the processor goroutine
 
 		// AOF defaults
 		AOF: aof.DefaultConfig(),
@@ -69,10 +179,12 @@ func DefaultConfig() *Config {
 			Seconds: 60,
 			Changes: 1000,
 		},
+		RejectWritesDuringSave: false, // Writes are served during snapshots by default
 
 		// Replication defaults
-		ReplicaPriority: 100,      // Default priority for failover
-		ReplicationRole: "master", // Default role is master
+		ReplicaPriority:       100,      // Default priority for failover
+		ReplicaServeStaleData: true,     // Redis default: keep serving reads when the master link drops
+		ReplicationRole:       "master", // Default role is master
 
 		// Cluster defaults
 		ClusterEnabled: false,        // Cluster mode disabled by default
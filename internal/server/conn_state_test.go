@@ -0,0 +1,238 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clientInfo returns the fields of the connection's CLIENT INFO line
+func clientInfo(t *testing.T, c *testClient) map[string]string {
+	t.Helper()
+	line, ok := c.do("CLIENT", "INFO").(string)
+	if !ok {
+		t.Fatalf("CLIENT INFO did not return a line")
+	}
+	fields := make(map[string]string)
+	for _, field := range strings.Fields(line) {
+		if k, v, ok := strings.Cut(field, "="); ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// checkClientInfo fails unless CLIENT INFO shows the wanted values
+func checkClientInfo(t *testing.T, c *testClient, want map[string]string) {
+	t.Helper()
+	info := clientInfo(t, c)
+	for k, v := range want {
+		if info[k] != v {
+			t.Fatalf("CLIENT INFO %s=%q, want %q", k, info[k], v)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	cases := []struct {
+		args []string
+		want interface{}
+	}{
+		{[]string{"AUTH", "secret"}, errorString("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")},
+		{[]string{"AUTH", "bob", "secret"}, errorString("WRONGPASS invalid username-password pair or user is disabled.")},
+		{[]string{"AUTH", "a", "b", "c"}, errorString("ERR wrong number of arguments for 'auth' command")},
+		{[]string{"AUTH", "default", "anything"}, "OK"},
+	}
+	for _, tc := range cases {
+		reply := c.do(tc.args...)
+		if err, ok := reply.(error); ok {
+			if wantErr, ok := tc.want.(error); !ok || err.Error() != wantErr.Error() {
+				t.Fatalf("%v = %v, want %v", tc.args, err, tc.want)
+			}
+		} else if reply != tc.want {
+			t.Fatalf("%v = %v, want %v", tc.args, reply, tc.want)
+		}
+		checkClientInfo(t, c, map[string]string{"user": "default"})
+	}
+}
+
+func TestHello(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	c.do("CLIENT", "SETNAME", "before")
+	unchanged := map[string]string{"resp": "2", "name": "before", "user": "default"}
+
+	// A rejected HELLO changes nothing, not even the parts that were valid
+	for _, args := range [][]string{
+		{"HELLO", "3", "AUTH", "bob", "secret", "SETNAME", "after"},
+		{"HELLO", "3", "SETNAME", "after", "AUTH", "bob", "secret"},
+		{"HELLO", "3", "AUTH", "default", "secret", "SETNAME", "bad\nname"},
+		{"HELLO", "3", "AUTH", "default"},
+		{"HELLO", "3", "SETNAME"},
+		{"HELLO", "3", "FOO"},
+		{"HELLO", "4", "SETNAME", "after"},
+		{"HELLO", "three"},
+	} {
+		if reply := c.do(args...); !isErrorReply(reply) {
+			t.Fatalf("%q = %v, want an error", args, reply)
+		}
+		checkClientInfo(t, c, unchanged)
+	}
+
+	// HELLO without a version keeps the protocol and just describes the server
+	hello, ok := c.do("HELLO").([]interface{})
+	if !ok || len(hello) != 14 || hello[4] != "proto" || hello[5] != int64(2) {
+		t.Fatalf("HELLO = %v, want the RESP2 server description", hello)
+	}
+	checkClientInfo(t, c, unchanged)
+
+	hello, ok = c.do("HELLO", "3", "AUTH", "default", "secret", "SETNAME", "after").([]interface{})
+	if !ok || len(hello) != 14 || hello[5] != int64(3) {
+		t.Fatalf("HELLO 3 = %v, want the RESP3 server description", hello)
+	}
+	checkClientInfo(t, c, map[string]string{"resp": "3", "name": "after", "user": "default"})
+	if reply := c.do("CLIENT", "GETNAME"); reply != "after" {
+		t.Fatalf("CLIENT GETNAME = %v, want after", reply)
+	}
+
+	// Going back to RESP2 keeps the name
+	c.do("HELLO", "2")
+	checkClientInfo(t, c, map[string]string{"resp": "2", "name": "after"})
+}
+
+func TestClientSetInfo(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	if reply := c.do("CLIENT", "SETINFO", "LIB-NAME", "go-redis"); reply != "OK" {
+		t.Fatalf("SETINFO LIB-NAME: %v", reply)
+	}
+	if reply := c.do("CLIENT", "SETINFO", "lib-ver", "9.1.0"); reply != "OK" {
+		t.Fatalf("SETINFO lib-ver: %v", reply)
+	}
+	set := map[string]string{"lib-name": "go-redis", "lib-ver": "9.1.0"}
+	checkClientInfo(t, c, set)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"CLIENT", "SETINFO", "LIB-NAME", "go redis"}, "ERR lib-name cannot contain spaces, newlines or special characters."},
+		{[]string{"CLIENT", "SETINFO", "LIB-VER", "1.0\n"}, "ERR lib-ver cannot contain spaces, newlines or special characters."},
+		{[]string{"CLIENT", "SETINFO", "LIB-ARCH", "x86"}, "ERR Unrecognized option 'LIB-ARCH'"},
+		{[]string{"CLIENT", "SETINFO", "LIB-NAME"}, "ERR wrong number of arguments for 'client|setinfo' command"},
+	}
+	for _, tc := range cases {
+		if err, ok := c.do(tc.args...).(error); !ok || err.Error() != tc.want {
+			t.Fatalf("%q = %v, want %q", tc.args, err, tc.want)
+		}
+		checkClientInfo(t, c, set)
+	}
+
+	// Another connection starts without them
+	other := connectTestClient(t, s)
+	checkClientInfo(t, other, map[string]string{"lib-name": "", "lib-ver": ""})
+}
+
+// A client changing its own state while writers deliver it invalidations:
+// the writers read its state from their own goroutines, so run under -race
+// this checks State and updateState share a lock. The invalidations are
+// redirected to it from a tracking client that keeps re-reading the key, so
+// they keep coming whatever the target does
+func TestInvalidationsReadStateConcurrently(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	target := connectTestClient(t, s)
+	target.do("HELLO", "3")
+	targetID, _ := target.do("CLIENT", "ID").(int64)
+	tracker := connectTestClient(t, s)
+	if reply := tracker.do("CLIENT", "TRACKING", "ON", "REDIRECT", fmt.Sprint(targetID)); reply != "OK" {
+		t.Fatalf("CLIENT TRACKING ON REDIRECT: %v", reply)
+	}
+
+	// No t.Fatal off the test goroutine: failures are reported on done
+	const writers, writes = 4, 200
+	done := make(chan error, writers)
+	write := func(c *testClient, args ...string) {
+		var cmd strings.Builder
+		fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+		c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+		for i := 0; i < writes; i++ {
+			if _, err := c.conn.Write([]byte(cmd.String())); err != nil {
+				done <- err
+				return
+			}
+			if reply, err := readReply(c.reader); err != nil || reply != "OK" {
+				done <- fmt.Errorf("%v: %v %v", args, reply, err)
+				return
+			}
+		}
+		done <- nil
+	}
+	for w := 0; w < writers; w++ {
+		go write(connectTestClient(t, s), "SET", "k", "v")
+	}
+	stopTracker := make(chan struct{})
+	go func() {
+		tracker.conn.SetDeadline(time.Now().Add(10 * time.Second))
+		for {
+			select {
+			case <-stopTracker:
+				return
+			default:
+			}
+			tracker.send("GET", "k")
+			if _, err := readReply(tracker.reader); err != nil {
+				return
+			}
+		}
+	}()
+	defer close(stopTracker)
+
+	invalidations := 0
+	reply := func(args ...string) interface{} {
+		target.send(args...)
+		for {
+			r := target.read()
+			if push, ok := r.([]interface{}); ok && len(push) == 2 && push[0] == "invalidate" {
+				invalidations++
+				continue
+			}
+			return r
+		}
+	}
+	for finished := 0; finished < writers; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			finished++
+			continue
+		default:
+		}
+		if r := reply("HELLO", "3", "SETNAME", fmt.Sprintf("target-%d", invalidations)); isErrorReply(r) {
+			t.Fatalf("HELLO 3 SETNAME: %v", r)
+		}
+		if r := reply("CLIENT", "SETINFO", "LIB-VER", "1.0"); r != "OK" {
+			t.Fatalf("CLIENT SETINFO: %v", r)
+		}
+	}
+
+	if invalidations == 0 {
+		t.Fatalf("no invalidation was delivered")
+	}
+	line, _ := reply("CLIENT", "INFO").(string)
+	for _, want := range []string{" resp=3 ", " lib-ver=1.0"} {
+		if !strings.Contains(line, want) {
+			t.Fatalf("CLIENT INFO = %q, want %q", line, want)
+		}
+	}
+}
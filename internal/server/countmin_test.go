@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// A Count-Min sketch survives the AOF, an AOF rewrite, DEBUG RELOAD,
+// DUMP/RESTORE and a replica's full sync with its counters intact
+func TestCountMinSketchPersisted(t *testing.T) {
+	s, port := startAOFServer(t, nil)
+	c := dialTestClient(t, port)
+
+	if reply := c.do("CMS.INITBYDIM", "sketch", "100", "5"); reply != "OK" {
+		t.Fatalf("CMS.INITBYDIM: %v", reply)
+	}
+	if reply := c.do("CMS.INCRBY", "sketch", "a", "3", "b", "2"); isErrorReply(reply) {
+		t.Fatalf("CMS.INCRBY: %v", reply)
+	}
+	if logged := loggedCommands(t, s, "CMS.INITBYDIM", "CMS.INCRBY"); len(logged) != 2 {
+		t.Fatalf("AOF has %v, want CMS.INITBYDIM and CMS.INCRBY", logged)
+	}
+
+	want := fmt.Sprint(c.do("CMS.QUERY", "sketch", "a", "b", "c"))
+	if want != "[3 2 0]" {
+		t.Fatalf("CMS.QUERY = %s, want [3 2 0]", want)
+	}
+	check := func(what string, client *testClient, key string) {
+		t.Helper()
+		if got := fmt.Sprint(client.do("CMS.QUERY", key, "a", "b", "c")); got != want {
+			t.Fatalf("CMS.QUERY after %s = %s, want %s", what, got, want)
+		}
+		if got := fmt.Sprint(client.do("CMS.INFO", key)); got != "[width 100 depth 5 count 5]" {
+			t.Fatalf("CMS.INFO after %s = %s", what, got)
+		}
+	}
+
+	rewriteAOF(t, c)
+	if logged := loggedCommands(t, s, "RESTORE"); len(logged) != 1 {
+		t.Fatalf("rewritten AOF has %v, want one RESTORE", logged)
+	}
+
+	if reply := c.do("DEBUG", "RELOAD"); reply != "OK" {
+		t.Fatalf("DEBUG RELOAD: %v", reply)
+	}
+	check("DEBUG RELOAD", c, "sketch")
+
+	payload, ok := c.do("DUMP", "sketch").(string)
+	if !ok {
+		t.Fatalf("DUMP did not return a payload")
+	}
+	if reply := c.do("RESTORE", "copy", "0", payload); reply != "OK" {
+		t.Fatalf("RESTORE: %v", reply)
+	}
+	check("RESTORE", c, "copy")
+
+	_, replicaPort := startTestServer(t, func(cfg *Config) {
+		cfg.ReplicationRole = "replica"
+		cfg.ReplicationMasterHost = "127.0.0.1"
+		cfg.ReplicationMasterPort = port
+	})
+	replica := dialTestClient(t, replicaPort)
+	waitFor(t, 5*time.Second, "the full sync", func() bool {
+		return replica.do("EXISTS", "sketch") == int64(1)
+	})
+	check("a full sync", replica, "sketch")
+}
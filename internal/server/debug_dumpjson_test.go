@@ -0,0 +1,35 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Infinite scores are dumped as Redis formats them, and dumping the same
+// data twice gives the same document
+func TestDumpJSONStable(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	c.do("ZADD", "z", "-inf", "low", "1.5", "mid", "inf", "high")
+	c.do("PEXPIRE", "z", "100000")
+
+	first, ok := c.do("DEBUG", "DUMP-JSON", "z").(string)
+	if !ok {
+		t.Fatalf("DEBUG DUMP-JSON z: %v", first)
+	}
+	want := `"value":[{"member":"low","score":"-inf"},{"member":"mid","score":"1.5"},{"member":"high","score":"inf"}]`
+	if !strings.Contains(first, want) {
+		t.Fatalf("DEBUG DUMP-JSON z = %s, want it to hold %s", first, want)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if second := c.do("DEBUG", "DUMP-JSON", "z"); second != first {
+		t.Fatalf("second dump = %v, differs from the first %s", second, first)
+	}
+
+	if err, ok := c.do("DEBUG", "DUMP-JSON", "missing").(error); !ok || err.Error() != "ERR no such key" {
+		t.Fatalf("DEBUG DUMP-JSON missing = %v", err)
+	}
+}
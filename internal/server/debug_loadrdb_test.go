@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"redis/internal/rdb"
+	"redis/internal/storage"
+)
+
+// DEBUG LOADRDB checks a payload against a throwaway store: the live
+// dataset neither gains its keys nor loses its own
+func TestDebugLoadRDBLeavesDatasetAlone(t *testing.T) {
+	_, port := startTestServer(t, nil)
+	c := dialTestClient(t, port)
+
+	path := filepath.Join(t.TempDir(), "payload.rdb")
+	snapshot := map[string]*storage.Value{
+		"loaded": {Type: storage.StringType, Data: "from-payload"},
+	}
+	if err := rdb.NewWriter(path).Save(snapshot); err != nil {
+		t.Fatalf("save payload: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read payload: %v", err)
+	}
+
+	if reply := c.do("SET", "live", "1"); reply != "OK" {
+		t.Fatalf("SET: %v", reply)
+	}
+	if reply := c.do("DEBUG", "LOADRDB", base64.StdEncoding.EncodeToString(data)); reply != "OK" {
+		t.Fatalf("DEBUG LOADRDB valid payload = %v, want OK", reply)
+	}
+
+	// Truncated payloads fail without a partial load
+	reply := c.do("DEBUG", "LOADRDB", base64.StdEncoding.EncodeToString(data[:len(data)-12]))
+	if err, ok := reply.(error); !ok || !strings.Contains(err.Error(), "Error loading the RDB payload") {
+		t.Fatalf("DEBUG LOADRDB truncated payload = %v, want an error", reply)
+	}
+
+	if reply := c.do("EXISTS", "loaded"); reply != int64(0) {
+		t.Fatalf("EXISTS loaded = %v, want 0", reply)
+	}
+	if reply := c.do("GET", "live"); reply != "1" {
+		t.Fatalf("GET live = %v, want 1", reply)
+	}
+}
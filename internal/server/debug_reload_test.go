@@ -0,0 +1,118 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"redis/internal/rdb"
+	"redis/internal/storage"
+)
+
+// DEBUG RELOAD replaces the dataset only with an RDB that loaded in full
+func TestDebugReloadSwapsOnlyOnSuccess(t *testing.T) {
+	s, port := startTestServer(t, nil)
+	c := dialTestClient(t, port)
+
+	if reply := c.do("SET", "live", "1"); reply != "OK" {
+		t.Fatalf("SET: %v", reply)
+	}
+
+	// No RDB file yet: an error, not an empty dataset
+	reply := c.do("DEBUG", "RELOAD", "NOSAVE")
+	if err, ok := reply.(error); !ok || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("DEBUG RELOAD NOSAVE without an RDB = %v, want an error", reply)
+	}
+	if reply := c.do("GET", "live"); reply != "1" {
+		t.Fatalf("GET live after a missing RDB = %v, want 1", reply)
+	}
+
+	// A broken RDB fails before anything is replaced
+	if err := os.WriteFile(s.config.RDBFilepath, []byte("REDIS0009garbage"), 0644); err != nil {
+		t.Fatalf("write RDB: %v", err)
+	}
+	if reply := c.do("DEBUG", "RELOAD", "NOSAVE"); !isErrorReply(reply) {
+		t.Fatalf("DEBUG RELOAD NOSAVE with a broken RDB = %v, want an error", reply)
+	}
+	if reply := c.do("GET", "live"); reply != "1" {
+		t.Fatalf("GET live after a broken RDB = %v, want 1", reply)
+	}
+
+	// A valid fixture replaces the dataset
+	fixture := map[string]*storage.Value{
+		"fixture": {Type: storage.StringType, Data: "from-rdb"},
+	}
+	if err := rdb.NewWriter(s.config.RDBFilepath).Save(fixture); err != nil {
+		t.Fatalf("save fixture: %v", err)
+	}
+	if reply := c.do("DEBUG", "RELOAD", "NOSAVE"); reply != "OK" {
+		t.Fatalf("DEBUG RELOAD NOSAVE with a fixture = %v, want OK", reply)
+	}
+	if reply := c.do("GET", "fixture"); reply != "from-rdb" {
+		t.Fatalf("GET fixture = %v, want from-rdb", reply)
+	}
+	if reply := c.do("EXISTS", "live"); reply != int64(0) {
+		t.Fatalf("EXISTS live after reload = %v, want 0", reply)
+	}
+
+	// Saving first round-trips the dataset
+	if reply := c.do("RPUSH", "list", "a", "b"); reply != int64(2) {
+		t.Fatalf("RPUSH: %v", reply)
+	}
+	digest := c.do("DEBUG", "DIGEST")
+	if reply := c.do("DEBUG", "RELOAD"); reply != "OK" {
+		t.Fatalf("DEBUG RELOAD = %v, want OK", reply)
+	}
+	if reply := c.do("DEBUG", "DIGEST"); reply != digest {
+		t.Fatalf("DEBUG DIGEST after RELOAD = %v, want %v", reply, digest)
+	}
+	if reply := c.do("SCAN", "0", "COUNT", "100"); len(reply.([]interface{})[1].([]interface{})) != 2 {
+		t.Fatalf("SCAN after RELOAD = %v, want 2 keys", reply)
+	}
+}
+
+// DEBUG RELOAD-VERIFY checks the persisted files against throwaway stores
+// and leaves the live dataset as it was, even a key neither file can hold
+func TestDebugReloadVerifyLeavesDatasetAlone(t *testing.T) {
+	_, port := startTestServer(t, func(cfg *Config) {
+		cfg.AOF.Enabled = true
+		cfg.AOF.Filepath = filepath.Join(t.TempDir(), "appendonly.aof")
+	})
+	c := dialTestClient(t, port)
+
+	for _, args := range [][]string{
+		{"SET", "str", "v", "EX", "1000"},
+		{"RPUSH", "list", "a", "b", "c"},
+		{"HSET", "hash", "f1", "v1", "f2", "v2"},
+		{"SADD", "set", "x", "y"},
+		{"ZADD", "zset", "1", "m1", "2.5", "m2"},
+	} {
+		if reply := c.do(args...); isErrorReply(reply) {
+			t.Fatalf("%v: %v", args, reply)
+		}
+	}
+	digest := c.do("DEBUG", "DIGEST")
+
+	if reply := c.do("DEBUG", "RELOAD-VERIFY"); reply != "OK" {
+		t.Fatalf("DEBUG RELOAD-VERIFY = %v, want OK", reply)
+	}
+	if reply := c.do("DEBUG", "DIGEST"); reply != digest {
+		t.Fatalf("DEBUG DIGEST after RELOAD-VERIFY = %v, want %v", reply, digest)
+	}
+
+	// Whatever the verdict on a key, checking it must not drop it
+	if reply := c.do("CMS.INITBYDIM", "sketch", "100", "5"); reply != "OK" {
+		t.Fatalf("CMS.INITBYDIM: %v", reply)
+	}
+	c.do("DEBUG", "RELOAD-VERIFY")
+	if reply := c.do("EXISTS", "sketch", "str", "list"); reply != int64(3) {
+		t.Fatalf("EXISTS after RELOAD-VERIFY = %v, want 3", reply)
+	}
+}
+
+// isErrorReply reports whether a reply read by testClient is an error reply
+func isErrorReply(reply interface{}) bool {
+	_, ok := reply.(error)
+	return ok
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// Hash field TTLs survive DUMP/RESTORE and an RDB save and reload, and
+// fields past their TTL are never returned or persisted
+func TestHashFieldTTLPersistence(t *testing.T) {
+	_, port := startTestServer(t, nil)
+	c := dialTestClient(t, port)
+
+	if reply := c.do("HSET", "h", "keep", "1", "ttl", "2", "short", "3"); reply != int64(3) {
+		t.Fatalf("HSET: %v", reply)
+	}
+	if reply := c.do("HEXPIRE", "h", "1000", "FIELDS", "1", "ttl"); !sameReply(reply, []interface{}{int64(1)}) {
+		t.Fatalf("HEXPIRE: %v", reply)
+	}
+	if reply := c.do("HPEXPIRE", "h", "100", "FIELDS", "1", "short"); !sameReply(reply, []interface{}{int64(1)}) {
+		t.Fatalf("HPEXPIRE: %v", reply)
+	}
+
+	// Times that overflow a duration are rejected
+	if reply := c.do("HEXPIRE", "h", "9223372036854775807", "FIELDS", "1", "keep"); !isErrorReply(reply) {
+		t.Fatalf("HEXPIRE with an overflowing TTL = %v, want an error", reply)
+	}
+
+	dump := c.do("DUMP", "h")
+	if reply := c.do("RESTORE", "copy", "0", dump.(string)); reply != "OK" {
+		t.Fatalf("RESTORE: %v", reply)
+	}
+	if reply := c.do("DEBUG", "RELOAD"); reply != "OK" {
+		t.Fatalf("DEBUG RELOAD: %v", reply)
+	}
+
+	for _, key := range []string{"h", "copy"} {
+		ttls := c.do("HTTL", key, "FIELDS", "2", "keep", "ttl").([]interface{})
+		if ttls[0] != int64(-1) || ttls[1].(int64) < 990 {
+			t.Fatalf("HTTL %s = %v, want [-1 ~1000]", key, ttls)
+		}
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if reply := c.do("HGETALL", "h"); len(reply.([]interface{})) != 4 {
+		t.Fatalf("HGETALL after the short TTL = %v, want 2 fields", reply)
+	}
+	if reply := c.do("DEBUG", "RELOAD"); reply != "OK" {
+		t.Fatalf("DEBUG RELOAD: %v", reply)
+	}
+	if reply := c.do("HEXISTS", "copy", "short"); reply != int64(0) {
+		t.Fatalf("HEXISTS copy short after reload = %v, want 0", reply)
+	}
+}
+
+// sameReply compares two replies read by testClient
+func sameReply(a, b interface{}) bool {
+	as, aok := a.([]interface{})
+	bs, bok := b.([]interface{})
+	if !aok || !bok {
+		return a == b
+	}
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		if !sameReply(as[i], bs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// HGETEX rejects EX/PX/EXAT/PXAT times that would overflow a duration and
+// leaves the field's TTL alone
+func TestHGetExRejectsOverflowingTTL(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	if reply := c.do("HSET", "h", "f", "v"); reply != int64(1) {
+		t.Fatalf("HSET: %v", reply)
+	}
+	for _, option := range []string{"EX", "PX", "EXAT", "PXAT"} {
+		reply := c.do("HGETEX", "h", option, "9223372036854775807", "FIELDS", "1", "f")
+		if err, ok := reply.(error); !ok || err.Error() != "ERR invalid expire time in 'hgetex' command" {
+			t.Fatalf("HGETEX %s with an overflowing time = %v, want invalid expire time", option, reply)
+		}
+	}
+	if reply := c.do("HTTL", "h", "FIELDS", "1", "f"); !sameReply(reply, []interface{}{int64(-1)}) {
+		t.Fatalf("HTTL after rejected HGETEX = %v, want [-1]", reply)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Counters updated by many pipelining clients at once never lose an update:
+// every read-modify-write command (and a script's INCR) is one processor step
+func TestConcurrentIncrementsAreAtomic(t *testing.T) {
+	s := startInProcessServer(t, nil)
+
+	const clients = 20
+	const rounds = 20 // Pipelined batches per client
+	const batch = 10  // Commands of each kind per batch
+
+	batchCommands := [][]string{
+		{"INCR", "counter"},
+		{"INCRBY", "counter", "3"},
+		{"DECR", "counter"},
+		{"HINCRBY", "hash", "field", "2"},
+		{"ZINCRBY", "zset", "1", "member"},
+		{"EVAL", "return redis.call('INCR', KEYS[1])", "1", "scripted"},
+	}
+	var pipeline strings.Builder
+	for i := 0; i < batch; i++ {
+		for _, args := range batchCommands {
+			fmt.Fprintf(&pipeline, "*%d\r\n", len(args))
+			for _, arg := range args {
+				fmt.Fprintf(&pipeline, "$%d\r\n%s\r\n", len(arg), arg)
+			}
+		}
+	}
+	payload := []byte(pipeline.String())
+	replies := batch * len(batchCommands)
+
+	conns := make([]*testClient, clients)
+	for i := range conns {
+		conns[i] = connectTestClient(t, s)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *testClient) {
+			defer wg.Done()
+			// No t.Fatal off the test goroutine: failures are reported on errs
+			for round := 0; round < rounds; round++ {
+				c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+				if _, err := c.conn.Write(payload); err != nil {
+					errs <- err
+					return
+				}
+				for i := 0; i < replies; i++ {
+					reply, err := readReply(c.reader)
+					if err == nil {
+						err, _ = reply.(error)
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("client failed: %v", err)
+	}
+
+	c := connectTestClient(t, s)
+	perKind := int64(clients * rounds * batch)
+	for _, check := range []struct {
+		args []string
+		want int64
+	}{
+		{[]string{"GET", "counter"}, perKind * (1 + 3 - 1)},
+		{[]string{"HGET", "hash", "field"}, perKind * 2},
+		{[]string{"ZSCORE", "zset", "member"}, perKind},
+		{[]string{"GET", "scripted"}, perKind},
+	} {
+		reply, _ := c.do(check.args...).(string)
+		got, err := strconv.ParseInt(reply, 10, 64)
+		if err != nil || got != check.want {
+			t.Fatalf("%v = %q, want %d", check.args, reply, check.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"redis/internal/handler"
+	"redis/internal/processor"
+	"redis/internal/protocol"
+	"redis/internal/replication"
+	"redis/internal/storage"
+)
+
+// InProcessServer runs the command handler, processor and store without a
+// network listener, so commands can be executed directly and their encoded
+// RESP replies inspected (e.g. from tests)
+//
+// Persistence and replication are stubbed out: AOF is disabled, RDB
+// auto-save never runs, and the replication manager is a master with no
+// replicas. Execute and Do go through CommandHandler.ExecuteCommand, the path
+// used for AOF replay, so connection-scoped commands (MULTI/EXEC, SUBSCRIBE,
+// CLIENT) and pipeline-level checks are not available there; Connect serves
+// a full client connection over an in-memory pipe instead
+type InProcessServer struct {
+	store          *storage.Store
+	processor      *processor.Processor
+	handler        *handler.CommandHandler
+	replicationMgr *replication.ReplicationManager
+	closeOnce      sync.Once
+
+	// Connections opened with Connect
+	ctx     context.Context
+	cancel  context.CancelFunc
+	connIDs atomic.Int64
+	conns   sync.Map // Connection ID -> server end of the pipe
+	wg      sync.WaitGroup
+}
+
+// NewInProcessServer creates an in-process server from cfg (nil for
+// DefaultConfig); network, persistence and replication settings are ignored
+func NewInProcessServer(cfg *Config) *InProcessServer {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+
+	store := newStore(cfg)
+	proc := newProcessor(cfg, store)
+	replMgr := replication.NewReplicationManager(replication.RoleMaster)
+	replMgr.SetStoreGetter(func() interface{} {
+		return proc.GetStore()
+	})
+
+	cmdHandler := handler.NewCommandHandler(proc, newHandlerConfig(cfg), nil, replMgr, cfg.Port)
+	proc.SetExpiredKeysCallback(cmdHandler.PropagateExpiredKeys)
+	proc.SetRefreshedExpiriesCallback(cmdHandler.PropagateRefreshedExpiries)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &InProcessServer{
+		store:          store,
+		processor:      proc,
+		handler:        cmdHandler,
+		replicationMgr: replMgr,
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// Connect opens a client connection served in process: the returned end of
+// an in-memory pipe goes through the same pipeline as a TCP client. Each
+// write on the server side is delivered on its own, so the returned
+// connection also shows how replies are flushed
+func (s *InProcessServer) Connect() net.Conn {
+	serverConn, clientConn := net.Pipe()
+	client := &handler.Client{
+		ID:        s.connIDs.Add(1),
+		Conn:      serverConn,
+		CreatedAt: time.Now(),
+	}
+
+	s.conns.Store(client.ID, serverConn)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.conns.Delete(client.ID)
+		defer serverConn.Close()
+		s.handler.Handle(s.ctx, client)
+	}()
+
+	return clientConn
+}
+
+// Execute runs a single command and returns its RESP-encoded reply
+func (s *InProcessServer) Execute(cmd *protocol.Command) []byte {
+	return s.handler.ExecuteCommand(cmd)
+}
+
+// Do runs the command given as arguments, e.g. Do("SET", "key", "value")
+func (s *InProcessServer) Do(args ...string) []byte {
+	return s.Execute(&protocol.Command{Args: args})
+}
+
+// LoadReplicaRDB loads an RDB payload with the loader replicas use for a full
+// resync, the way DEBUG LOADRDB checks a payload
+func (s *InProcessServer) LoadReplicaRDB(data []byte) error {
+	return s.replicationMgr.LoadRDB(data, s.exec)
+}
+
+// exec runs a command for a loader, turning an error reply into an error
+func (s *InProcessServer) exec(args []string) error {
+	if response := s.Do(args...); len(response) > 0 && response[0] == '-' {
+		return fmt.Errorf("command failed: %s", string(response))
+	}
+	return nil
+}
+
+// Handler returns the command handler
+func (s *InProcessServer) Handler() *handler.CommandHandler {
+	return s.handler
+}
+
+// Store returns the underlying store
+// It is owned by the processor goroutine, so only read it while no command runs
+func (s *InProcessServer) Store() *storage.Store {
+	return s.store
+}
+
+// Close closes the connections opened with Connect, then stops the processor
+// and the replication manager
+func (s *InProcessServer) Close() {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		s.conns.Range(func(_, conn interface{}) bool {
+			conn.(net.Conn).Close()
+			return true
+		})
+		s.wg.Wait()
+		s.replicationMgr.Shutdown()
+		s.processor.Shutdown()
+	})
+}
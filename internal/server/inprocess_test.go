@@ -0,0 +1,65 @@
+package server
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// Do runs commands on the store shared with in-process connections
+func TestInProcessDo(t *testing.T) {
+	s := startInProcessServer(t, nil)
+
+	if reply := string(s.Do("SET", "k", "v")); reply != "+OK\r\n" {
+		t.Fatalf("SET = %q", reply)
+	}
+	if reply := string(s.Do("GET", "k")); reply != "$1\r\nv\r\n" {
+		t.Fatalf("GET = %q", reply)
+	}
+	if reply := string(s.Do("NOSUCHCOMMAND")); reply != "-ERR unknown command 'NOSUCHCOMMAND'\r\n" {
+		t.Fatalf("unknown command = %q", reply)
+	}
+
+	c := connectTestClient(t, s)
+	if reply := c.do("GET", "k"); reply != "v" {
+		t.Fatalf("GET over a connection = %v", reply)
+	}
+}
+
+// Connect serves connection-scoped commands, which Do cannot run
+func TestInProcessConnect(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	if reply := c.do("CLIENT", "SETNAME", "harness"); reply != "OK" {
+		t.Fatalf("CLIENT SETNAME: %v", reply)
+	}
+	if reply := c.do("CLIENT", "GETNAME"); reply != "harness" {
+		t.Fatalf("CLIENT GETNAME: %v", reply)
+	}
+
+	c.do("MULTI")
+	c.do("SET", "a", "1")
+	c.do("INCR", "a")
+	if reply := c.do("EXEC"); !sameReply(reply, []interface{}{"OK", int64(2)}) {
+		t.Fatalf("EXEC: %v", reply)
+	}
+	if reply := string(s.Do("GET", "a")); reply != "$1\r\n2\r\n" {
+		t.Fatalf("GET a after EXEC = %q", reply)
+	}
+}
+
+// Close ends the connections opened with Connect
+func TestInProcessCloseEndsConnections(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+	if reply := c.do("PING"); reply != "PONG" {
+		t.Fatalf("PING: %v", reply)
+	}
+
+	s.Close()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("read after Close = %v, want EOF", err)
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// With key-lock-stripes, string commands on stripes and scripts on the
+// processor goroutine update the same counters without losing an update
+func TestKeyLockStripesKeepIncrementsAtomic(t *testing.T) {
+	s := startInProcessServer(t, func(cfg *Config) {
+		cfg.KeyLockStripes = 4
+	})
+
+	const clients = 16
+	const rounds = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	for i := 0; i < clients; i++ {
+		c := connectTestClient(t, s)
+		own := fmt.Sprintf("own:%d", i)
+		commands := [][]string{
+			{"INCR", "shared"},
+			{"INCRBY", own, "2"},
+			{"APPEND", "log:" + own, "x"},
+			{"EVAL", "return redis.call('INCRBY', KEYS[1], 10)", "1", "shared"},
+			{"EXISTS", "shared", own, "missing"},
+			{"DECR", "shared"},
+		}
+		var pipeline strings.Builder
+		for _, args := range commands {
+			fmt.Fprintf(&pipeline, "*%d\r\n", len(args))
+			for _, arg := range args {
+				fmt.Fprintf(&pipeline, "$%d\r\n%s\r\n", len(arg), arg)
+			}
+		}
+		payload := []byte(pipeline.String())
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// No t.Fatal off the test goroutine: failures are reported on errs
+			for round := 0; round < rounds; round++ {
+				c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+				if _, err := c.conn.Write(payload); err != nil {
+					errs <- err
+					return
+				}
+				for range commands {
+					reply, err := readReply(c.reader)
+					if err == nil {
+						err, _ = reply.(error)
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("client failed: %v", err)
+	}
+
+	c := connectTestClient(t, s)
+	if got, _ := c.do("GET", "shared").(string); got != strconv.Itoa(clients*rounds*10) {
+		t.Fatalf("GET shared = %q, want %d", got, clients*rounds*10)
+	}
+	for i := 0; i < clients; i++ {
+		own := fmt.Sprintf("own:%d", i)
+		if got, _ := c.do("GET", own).(string); got != strconv.Itoa(rounds*2) {
+			t.Fatalf("GET %s = %q, want %d", own, got, rounds*2)
+		}
+		if got := c.do("STRLEN", "log:"+own); got != int64(rounds) {
+			t.Fatalf("STRLEN log:%s = %v, want %d", own, got, rounds)
+		}
+	}
+	if got := c.do("DBSIZE"); got != int64(1+2*clients) {
+		t.Fatalf("DBSIZE = %v, want %d", got, 1+2*clients)
+	}
+}
+
+// A key that expires under a command on a stripe is removed once and its
+// DEL reaches the AOF
+func TestKeyLockStripesPropagateExpiry(t *testing.T) {
+	s, port := startAOFServer(t, func(cfg *Config) {
+		cfg.KeyLockStripes = 4
+	})
+	c := dialTestClient(t, port)
+
+	if got := c.do("SET", "session", "v", "PX", "20"); got != "OK" {
+		t.Fatalf("SET = %v", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := c.do("GET", "session"); got != nil {
+		t.Fatalf("GET of an expired key = %v, want nil", got)
+	}
+	if got := c.do("EXISTS", "session"); got != int64(0) {
+		t.Fatalf("EXISTS = %v, want 0", got)
+	}
+
+	waitFor(t, 2*time.Second, "DEL of the expired key in the AOF", func() bool {
+		for _, args := range loggedCommands(t, s, "DEL") {
+			if len(args) == 2 && args[1] == "session" {
+				return true
+			}
+		}
+		return false
+	})
+}
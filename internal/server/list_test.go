@@ -0,0 +1,288 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// listFixture holds "a" at 0, 3, 5 and 7 so head and tail scans disagree
+var listFixture = []string{"a", "b", "c", "a", "b", "a", "c", "a"}
+
+// seedList replaces key with listFixture
+func seedList(t *testing.T, c *testClient, key string) {
+	t.Helper()
+	c.do("DEL", key)
+	if reply := c.do(append([]string{"RPUSH", key}, listFixture...)...); reply != int64(len(listFixture)) {
+		t.Fatalf("RPUSH: %v", reply)
+	}
+}
+
+// forEachListEncoding runs fn against a server keeping the fixture list in
+// each encoding: listpack by default, quicklist with list-max-listpack-size 0
+func forEachListEncoding(t *testing.T, fn func(t *testing.T, c *testClient)) {
+	for _, tc := range []struct {
+		encoding string
+		maxSize  int
+	}{
+		{"listpack", -2},
+		{"quicklist", 0},
+	} {
+		t.Run(tc.encoding, func(t *testing.T) {
+			s := startInProcessServer(t, func(cfg *Config) {
+				cfg.ListMaxListpackSize = tc.maxSize
+			})
+			c := connectTestClient(t, s)
+			seedList(t, c, "l")
+			if reply := c.do("OBJECT", "ENCODING", "l"); reply != tc.encoding {
+				t.Fatalf("OBJECT ENCODING = %v, want %s", reply, tc.encoding)
+			}
+			fn(t, c)
+		})
+	}
+}
+
+// asReply converts expected values to the shape testClient reads back
+func asReply(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case []int:
+		items := make([]interface{}, len(v))
+		for i, n := range v {
+			items[i] = int64(n)
+		}
+		return items
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, s := range v {
+			items[i] = s
+		}
+		return items
+	}
+	return v
+}
+
+// runListCase runs args against a fresh fixture, directly and through a
+// script, and checks both get want and leave the list as after (nil = as
+// seeded)
+func runListCase(t *testing.T, c *testClient, args []string, want interface{}, after []string) {
+	t.Helper()
+	if after == nil {
+		after = listFixture
+	}
+	script := "return redis.call(unpack(ARGV))"
+	for _, via := range [][]string{nil, {"EVAL", script, "0"}} {
+		seedList(t, c, "l")
+		reply := c.do(append(via, args...)...)
+		if wantErr, ok := want.(error); ok {
+			// Scripts wrap the error with their position and a traceback
+			if err, ok := reply.(error); !ok || err.Error() != wantErr.Error() && (via == nil || !strings.Contains(err.Error(), wantErr.Error())) {
+				t.Fatalf("%v via %v = %v, want error %q", args, via, reply, wantErr)
+			}
+			continue
+		}
+		if !sameReply(reply, asReply(want)) {
+			t.Fatalf("%v via %v = %v, want %v", args, via, reply, want)
+		}
+		if got := c.do("LRANGE", "l", "0", "-1"); !sameReply(got, asReply(after)) {
+			t.Fatalf("%v via %v left %v, want %v", args, via, got, after)
+		}
+	}
+}
+
+func TestLPos(t *testing.T) {
+	forEachListEncoding(t, func(t *testing.T, c *testClient) {
+
+		rankZero := errorString("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the last match")
+		cases := []struct {
+			args []string
+			want interface{}
+		}{
+			{[]string{"LPOS", "l", "a"}, 0},
+			{[]string{"LPOS", "l", "a", "RANK", "2"}, 3},
+			{[]string{"LPOS", "l", "a", "RANK", "-1"}, 7},
+			{[]string{"LPOS", "l", "a", "RANK", "-2"}, 5},
+			{[]string{"LPOS", "l", "a", "RANK", "5"}, nil},
+			{[]string{"LPOS", "l", "a", "RANK", "-5"}, nil},
+			{[]string{"LPOS", "l", "a", "RANK", "9223372036854775807"}, nil},
+			{[]string{"LPOS", "l", "a", "RANK", "-9223372036854775807"}, nil},
+			{[]string{"LPOS", "l", "x"}, nil},
+			{[]string{"LPOS", "missing", "a"}, nil},
+
+			{[]string{"LPOS", "l", "a", "COUNT", "2"}, []int{0, 3}},
+			{[]string{"LPOS", "l", "a", "COUNT", "0"}, []int{0, 3, 5, 7}},
+			{[]string{"LPOS", "l", "a", "RANK", "-1", "COUNT", "2"}, []int{7, 5}},
+			{[]string{"LPOS", "l", "a", "RANK", "-1", "COUNT", "0"}, []int{7, 5, 3, 0}},
+			{[]string{"LPOS", "l", "a", "RANK", "2", "COUNT", "0"}, []int{3, 5, 7}},
+			{[]string{"LPOS", "l", "x", "COUNT", "0"}, []int{}},
+			{[]string{"LPOS", "missing", "a", "COUNT", "0"}, []int{}},
+
+			// MAXLEN bounds the comparisons, counted from where the scan starts
+			{[]string{"LPOS", "l", "a", "COUNT", "0", "MAXLEN", "4"}, []int{0, 3}},
+			{[]string{"LPOS", "l", "a", "RANK", "2", "COUNT", "0", "MAXLEN", "4"}, []int{3}},
+			{[]string{"LPOS", "l", "a", "RANK", "-1", "COUNT", "0", "MAXLEN", "3"}, []int{7, 5}},
+			{[]string{"LPOS", "l", "a", "RANK", "-2", "MAXLEN", "2"}, nil},
+			{[]string{"LPOS", "l", "a", "MAXLEN", "0", "COUNT", "0"}, []int{0, 3, 5, 7}},
+
+			{[]string{"LPOS", "l", "a", "RANK", "0"}, rankZero},
+			{[]string{"LPOS", "l", "a", "RANK", "-9223372036854775808"}, errorString("ERR value is out of range, value must between -9223372036854775807 and 9223372036854775807")},
+			{[]string{"LPOS", "l", "a", "COUNT", "-1"}, errorString("ERR COUNT can't be negative")},
+			{[]string{"LPOS", "l", "a", "MAXLEN", "-1"}, errorString("ERR MAXLEN can't be negative")},
+			{[]string{"LPOS", "l", "a", "RANK"}, errorString("ERR syntax error")},
+			{[]string{"LPOS", "l", "a", "FIRST", "1"}, errorString("ERR syntax error")},
+		}
+		for _, tc := range cases {
+			runListCase(t, c, tc.args, tc.want, nil)
+		}
+	})
+}
+
+func TestLRem(t *testing.T) {
+	forEachListEncoding(t, func(t *testing.T, c *testClient) {
+
+		cases := []struct {
+			args  []string
+			want  interface{}
+			after []string
+		}{
+			{[]string{"LREM", "l", "2", "a"}, 2, []string{"b", "c", "b", "a", "c", "a"}},
+			{[]string{"LREM", "l", "-2", "a"}, 2, []string{"a", "b", "c", "a", "b", "c"}},
+			{[]string{"LREM", "l", "-1", "c"}, 1, []string{"a", "b", "c", "a", "b", "a", "a"}},
+			{[]string{"LREM", "l", "1", "c"}, 1, []string{"a", "b", "a", "b", "a", "c", "a"}},
+			{[]string{"LREM", "l", "0", "a"}, 4, []string{"b", "c", "b", "c"}},
+			{[]string{"LREM", "l", "9223372036854775807", "a"}, 4, []string{"b", "c", "b", "c"}},
+			{[]string{"LREM", "l", "-9223372036854775808", "a"}, 4, []string{"b", "c", "b", "c"}},
+			{[]string{"LREM", "l", "1", "x"}, 0, nil},
+			{[]string{"LREM", "l", "x", "a"}, errorString("ERR value is not an integer or out of range"), nil},
+		}
+		for _, tc := range cases {
+			runListCase(t, c, tc.args, tc.want, tc.after)
+		}
+
+		// Removing every element deletes the key
+		c.do("RPUSH", "only", "a", "a")
+		if reply := c.do("LREM", "only", "-1", "a"); reply != int64(1) {
+			t.Fatalf("LREM -1: %v", reply)
+		}
+		if reply := c.do("LREM", "only", "0", "a"); reply != int64(1) {
+			t.Fatalf("LREM 0: %v", reply)
+		}
+		if reply := c.do("EXISTS", "only"); reply != int64(0) {
+			t.Fatalf("EXISTS after emptying = %v, want 0", reply)
+		}
+		if reply := c.do("LREM", "only", "0", "a"); reply != int64(0) {
+			t.Fatalf("LREM on a missing key = %v, want 0", reply)
+		}
+	})
+}
+
+func TestLInsert(t *testing.T) {
+	forEachListEncoding(t, func(t *testing.T, c *testClient) {
+
+		cases := []struct {
+			args  []string
+			want  interface{}
+			after []string
+		}{
+			// The pivot is the first match from the head
+			{[]string{"LINSERT", "l", "BEFORE", "a", "X"}, 9, []string{"X", "a", "b", "c", "a", "b", "a", "c", "a"}},
+			{[]string{"LINSERT", "l", "AFTER", "a", "X"}, 9, []string{"a", "X", "b", "c", "a", "b", "a", "c", "a"}},
+			{[]string{"LINSERT", "l", "before", "c", "X"}, 9, []string{"a", "b", "X", "c", "a", "b", "a", "c", "a"}},
+			{[]string{"LINSERT", "l", "after", "c", "X"}, 9, []string{"a", "b", "c", "X", "a", "b", "a", "c", "a"}},
+			{[]string{"LINSERT", "l", "BEFORE", "x", "X"}, -1, nil},
+			{[]string{"LINSERT", "missing", "BEFORE", "a", "X"}, 0, nil},
+			{[]string{"LINSERT", "l", "MIDDLE", "a", "X"}, errorString("ERR syntax error"), nil},
+		}
+		for _, tc := range cases {
+			runListCase(t, c, tc.args, tc.want, tc.after)
+		}
+		if reply := c.do("EXISTS", "missing"); reply != int64(0) {
+			t.Fatalf("LINSERT created a missing key")
+		}
+	})
+}
+
+// errorString is an expected error reply
+type errorString string
+
+func (e errorString) Error() string { return string(e) }
+
+// A list holds its elements in one slice until it grows past
+// list-max-listpack-size, and reads the same on either side of the switch
+func TestListEncodingTransition(t *testing.T) {
+	s := startInProcessServer(t, func(cfg *Config) {
+		cfg.ListMaxListpackSize = 4
+	})
+	c := connectTestClient(t, s)
+
+	c.do("RPUSH", "l", "b", "c")
+	c.do("LPUSH", "l", "a")
+	c.do("RPUSH", "l", "d")
+	c.do("LSET", "l", "-1", "D")
+	want := []string{"a", "b", "c", "D"}
+	check := func(encoding string, entries int64) {
+		t.Helper()
+		if reply := c.do("OBJECT", "ENCODING", "l"); reply != encoding {
+			t.Fatalf("OBJECT ENCODING = %v, want %s", reply, encoding)
+		}
+		if reply := c.do("DEBUG", "LISTPACK-ENTRIES", "l"); reply != entries {
+			t.Fatalf("DEBUG LISTPACK-ENTRIES = %v, want %d", reply, entries)
+		}
+		if reply := c.do("LRANGE", "l", "0", "-1"); !sameReply(reply, asReply(want)) {
+			t.Fatalf("LRANGE = %v, want %v", reply, want)
+		}
+		for i, v := range want {
+			if reply := c.do("LINDEX", "l", fmt.Sprint(i-len(want))); reply != v {
+				t.Fatalf("LINDEX %d = %v, want %s", i-len(want), reply, v)
+			}
+		}
+	}
+	check("listpack", 4)
+	listpackBytes, _ := c.do("MEMORY", "USAGE", "l").(int64)
+
+	c.do("RPUSH", "l", "e")
+	want = append(want, "e")
+	check("quicklist", 0)
+
+	// Shrinking back does not convert back
+	c.do("RPOP", "l")
+	c.do("LTRIM", "l", "0", "3")
+	want = want[:4]
+	check("quicklist", 0)
+	if quicklistBytes, _ := c.do("MEMORY", "USAGE", "l").(int64); quicklistBytes <= listpackBytes {
+		t.Fatalf("MEMORY USAGE listpack %d, quicklist %d: want the listpack smaller", listpackBytes, quicklistBytes)
+	}
+}
+
+// DEBUG OBJECT on a quicklist reports the nodes and element counts of the
+// list it walked and the list-max-listpack-size it was checked against
+func TestDebugObjectListNodes(t *testing.T) {
+	s := startInProcessServer(t, func(cfg *Config) {
+		cfg.ListMaxListpackSize = 4
+	})
+	c := connectTestClient(t, s)
+
+	c.do("RPUSH", "small", "a", "b")
+	reply, _ := c.do("DEBUG", "OBJECT", "small").(string)
+	if !strings.Contains(reply, "encoding:listpack") || strings.Contains(reply, "ql_") {
+		t.Fatalf("DEBUG OBJECT of a listpack = %q, want no quicklist fields", reply)
+	}
+
+	c.do("RPUSH", "big", "a", "bb", "ccc", "dddd", "eeeee", "f")
+	reply, _ = c.do("DEBUG", "OBJECT", "big").(string)
+	for _, field := range []string{
+		"encoding:quicklist", "ql_nodes:6", "ql_avg_node:1.00", "ql_max_node:1",
+		"ql_listpack_max:4", "ql_compressed:0", "ql_uncompressed_size:16",
+	} {
+		if !strings.Contains(reply, field) {
+			t.Fatalf("DEBUG OBJECT = %q, missing %s", reply, field)
+		}
+	}
+
+	c.do("LPOP", "big", "2")
+	reply, _ = c.do("DEBUG", "OBJECT", "big").(string)
+	if !strings.Contains(reply, "ql_nodes:4") || !strings.Contains(reply, "ql_uncompressed_size:13") {
+		t.Fatalf("DEBUG OBJECT after LPOP = %q, want 4 nodes of 13 bytes", reply)
+	}
+}
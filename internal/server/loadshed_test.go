@@ -0,0 +1,76 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// busyScript holds the processor for a second
+const busyScript = "local t = os.clock() + 1 while os.clock() < t do end return 1"
+
+// startSaturatedServer starts a server shedding past one queued command,
+// occupies its processor with busyScript and queues a GET behind it
+// Returns the server's port and the clients running the script and the GET
+func startSaturatedServer(t *testing.T, wait time.Duration) (port int, script, queued *testClient) {
+	s, port := startTestServer(t, func(cfg *Config) {
+		cfg.LoadShedQueueDepth = 1
+		cfg.LoadShedWait = wait
+		cfg.LuaTimeLimit = 0 // Never BUSY: the queue is what's being tested
+	})
+	// The expiry cycle would take the queue's one slot whenever it ticks
+	s.processor.SetActiveExpireEnabled(false)
+	script = dialTestClient(t, port)
+	script.send("EVAL", busyScript, "0")
+	time.Sleep(100 * time.Millisecond)
+	waitFor(t, time.Second, "the script to leave the queue", func() bool { return s.processor.QueueDepth() == 0 })
+	queued = dialTestClient(t, port)
+	queued.send("GET", "k")
+	waitFor(t, time.Second, "the GET to be queued", func() bool { return s.processor.QueueDepth() == 1 })
+	return port, script, queued
+}
+
+// Past the queue depth a command waits LoadShedWait for room, then is
+// refused with an error of its own rather than a script's BUSY
+func TestLoadSheddingRefusesPastDepth(t *testing.T) {
+	port, script, queued := startSaturatedServer(t, 50*time.Millisecond)
+
+	c := dialTestClient(t, port)
+	err, ok := c.do("GET", "k").(error)
+	if !ok || !strings.HasPrefix(err.Error(), "OVERLOADED ") {
+		t.Fatalf("GET on a saturated queue = %v, want an OVERLOADED error", err)
+	}
+
+	if reply := script.read(); reply != int64(1) {
+		t.Fatalf("EVAL: %v", reply)
+	}
+	if reply := queued.read(); reply != nil {
+		t.Fatalf("queued GET: %v", reply)
+	}
+	if reply := c.do("GET", "k"); reply != nil {
+		t.Fatalf("GET once the queue drained: %v", reply)
+	}
+}
+
+// A waiting command is admitted as soon as the queue has room again
+func TestLoadSheddingAdmitsWhenQueueDrains(t *testing.T) {
+	port, script, queued := startSaturatedServer(t, 10*time.Second)
+
+	c := dialTestClient(t, port)
+	start := time.Now()
+	if reply := c.do("GET", "k"); reply != nil {
+		t.Fatalf("GET waiting for room: %v", reply)
+	}
+	if waited := time.Since(start); waited > 2*time.Second {
+		t.Fatalf("GET waited %v for room, the script only runs 1s", waited)
+	}
+	script.read()
+	queued.read()
+}
+
+// Load shedding is off unless configured
+func TestLoadSheddingOffByDefault(t *testing.T) {
+	if depth := DefaultConfig().LoadShedQueueDepth; depth != 0 {
+		t.Fatalf("default LoadShedQueueDepth = %d, want 0", depth)
+	}
+}
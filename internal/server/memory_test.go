@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+// memoryStats returns the MEMORY STATS fields by name; values are bulk strings
+func memoryStats(t *testing.T, c *testClient) map[string]interface{} {
+	t.Helper()
+	reply, ok := c.do("MEMORY", "STATS").([]interface{})
+	if !ok || len(reply)%2 != 0 {
+		t.Fatalf("MEMORY STATS = %v", reply)
+	}
+	stats := make(map[string]interface{})
+	for i := 0; i < len(reply); i += 2 {
+		stats[fmt.Sprint(reply[i])] = reply[i+1]
+	}
+	return stats
+}
+
+// checkKeyCounts fails unless MEMORY STATS reports the wanted key counts
+// (a missing type counts as 0)
+func checkKeyCounts(t *testing.T, c *testClient, want map[string]int64) {
+	t.Helper()
+	stats := memoryStats(t, c)
+	for field, n := range want {
+		got, ok := stats[field]
+		if !ok {
+			got = "0"
+		}
+		if got != fmt.Sprint(n) {
+			t.Fatalf("MEMORY STATS %s = %v, want %d", field, got, n)
+		}
+	}
+}
+
+// The key counts follow every way a key is created, retyped or removed,
+// without MEMORY STATS walking the keyspace
+func TestMemoryStatsKeyCounts(t *testing.T) {
+	_, port := startTestServer(t, nil)
+	c := dialTestClient(t, port)
+
+	c.do("SET", "s1", "a")
+	c.do("SET", "s2", "b")
+	c.do("SET", "s3", "c")
+	c.do("RPUSH", "l1", "a", "b")
+	c.do("RPUSH", "l2", "a")
+	c.do("HSET", "h", "f", "v")
+	checkKeyCounts(t, c, map[string]int64{"keys.count": 6, "keys.string": 3, "keys.list": 2, "keys.hash": 1})
+
+	c.do("DEL", "s1")
+	c.do("SET", "l1", "now a string")
+	c.do("LPOP", "l2") // Emptied lists are deleted
+	c.do("RENAME", "h", "h2")
+	checkKeyCounts(t, c, map[string]int64{"keys.count": 4, "keys.string": 3, "keys.list": 0, "keys.hash": 1})
+
+	if reply := c.do("DEBUG", "RELOAD"); reply != "OK" {
+		t.Fatalf("DEBUG RELOAD: %v", reply)
+	}
+	checkKeyCounts(t, c, map[string]int64{"keys.count": 4, "keys.string": 3, "keys.hash": 1})
+
+	c.do("FLUSHALL")
+	checkKeyCounts(t, c, map[string]int64{"keys.count": 0, "keys.string": 0, "keys.hash": 0})
+}
+
+// Sizes are extrapolated from a sample of the elements; for a list of
+// same-sized elements that matches MEMORY USAGE, which sizes every element
+func TestMemoryStatsSamplesLargeValues(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	args := []string{"RPUSH", "big"}
+	for i := 0; i < 5000; i++ {
+		args = append(args, fmt.Sprintf("element-%05d", i))
+	}
+	c.do(args...)
+
+	usage, _ := c.do("MEMORY", "USAGE", "big").(int64)
+	stats := memoryStats(t, c)
+	if usage == 0 || stats["bytes.list"] != fmt.Sprint(usage) {
+		t.Fatalf("MEMORY STATS bytes.list = %v, want MEMORY USAGE's %d", stats["bytes.list"], usage)
+	}
+}
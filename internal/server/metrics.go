@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// opsSampleInterval is how often the instantaneous ops/sec gauge is recomputed
+const opsSampleInterval = 1 * time.Second
+
+// startMetricsServer serves Prometheus-format metrics on /metrics
+// It listens on its own port so scrapers never compete with RESP clients
+func (s *RedisServer) startMetricsServer() error {
+	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.MetricsPort)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start metrics listener: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	s.metricsServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go s.sampleOpsPerSec()
+	go func() {
+		if err := s.metricsServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics server error: %v", err)
+		}
+	}()
+
+	log.Printf("Metrics endpoint listening on http://%s/metrics", addr)
+	return nil
+}
+
+// stopMetricsServer shuts down the metrics HTTP server if it is running
+func (s *RedisServer) stopMetricsServer() {
+	if s.metricsServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.metricsServer.Shutdown(ctx)
+}
+
+// sampleOpsPerSec derives the instantaneous ops/sec gauge from the command counter
+func (s *RedisServer) sampleOpsPerSec() {
+	ticker := time.NewTicker(opsSampleInterval)
+	defer ticker.Stop()
+
+	last := s.handler.Stats().Total()
+	for {
+		select {
+		case <-s.shutdownChan:
+			return
+		case <-ticker.C:
+			total := s.handler.Stats().Total()
+			s.opsPerSec.Store(int64(float64(total-last) / opsSampleInterval.Seconds()))
+			last = total
+		}
+	}
+}
+
+// handleMetrics renders server counters in the Prometheus text exposition format
+func (s *RedisServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+
+	// Clients
+	writeMetric(&b, "redis_connected_clients", "gauge", "Number of client connections", s.activeConnCount.Load())
+	writeMetric(&b, "redis_connections_received_total", "counter", "Connections accepted since startup", s.connIDCounter.Load())
+	writeMetric(&b, "redis_rejected_connections_total", "counter", "Connections refused because maxclients was reached", s.rejectedConns.Load())
+
+	// Commands
+	stats := s.handler.Stats()
+	writeMetric(&b, "redis_commands_processed_total", "counter", "Commands processed since startup", stats.Total())
+	writeMetric(&b, "redis_instantaneous_ops_per_sec", "gauge", "Commands processed per second over the last second", s.opsPerSec.Load())
+
+	calls := stats.Calls()
+	names := make([]string, 0, len(calls))
+	for name := range calls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeMetricHeader(&b, "redis_commands_total", "counter", "Calls per command since startup")
+	for _, name := range names {
+		fmt.Fprintf(&b, "redis_commands_total{cmd=\"%s\"} %d\n", escapeLabelValue(name), calls[name])
+	}
+
+	// Keyspace
+	keys, expires := s.processor.KeyspaceSize()
+	writeMetric(&b, "redis_db_keys", "gauge", "Number of keys", int64(keys))
+	writeMetric(&b, "redis_db_keys_expiring", "gauge", "Number of keys with a TTL", int64(expires))
+	keyspace := s.processor.KeyspaceStats()
+	writeMetric(&b, "redis_keyspace_hits_total", "counter", "Key lookups by read commands that found the key", keyspace.Hits)
+	writeMetric(&b, "redis_keyspace_misses_total", "counter", "Key lookups by read commands that did not find the key", keyspace.Misses)
+	// No maxmemory eviction policy exists, so nothing is ever evicted
+	writeMetric(&b, "redis_evicted_keys_total", "counter", "Keys evicted by the maxmemory policy", 0)
+
+	// Replication
+	if s.replicationMgr != nil {
+		s.writeReplicationMetrics(&b)
+	}
+
+	// AOF
+	if s.aofWriter != nil {
+		aofStats := s.aofWriter.GetStats()
+		writeMetric(&b, "redis_aof_enabled", "gauge", "Whether the append-only file is enabled", boolMetric(aofStats.Enabled))
+		writeMetric(&b, "redis_aof_writes_total", "counter", "Commands appended to the AOF since startup", aofStats.TotalWrites)
+		if fi, err := os.Stat(aofStats.FilePath); err == nil {
+			writeMetric(&b, "redis_aof_current_size_bytes", "gauge", "Current size of the AOF file", fi.Size())
+		}
+	} else {
+		writeMetric(&b, "redis_aof_enabled", "gauge", "Whether the append-only file is enabled", 0)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	io.WriteString(w, b.String())
+}
+
+// writeReplicationMetrics renders the replication offset and per-replica lag
+// from the same data INFO replication reports
+func (s *RedisServer) writeReplicationMetrics(b *strings.Builder) {
+	info := s.replicationMgr.GetInfo()
+	masterOffset, _ := info["master_repl_offset"].(int64)
+
+	if info["role"] == "master" {
+		writeMetric(b, "redis_master_repl_offset", "gauge", "Replication offset of this master", masterOffset)
+		connected, _ := info["connected_slaves"].(int)
+		writeMetric(b, "redis_connected_slaves", "gauge", "Number of connected replicas", int64(connected))
+
+		slaves, _ := info["slaves"].([]map[string]interface{})
+		if len(slaves) == 0 {
+			return
+		}
+		writeMetricHeader(b, "redis_slave_lag_seconds", "gauge", "Seconds since the last interaction with each replica")
+		for _, slave := range slaves {
+			lag, _ := slave["lag"].(float64)
+			fmt.Fprintf(b, "redis_slave_lag_seconds{addr=\"%s\"} %g\n", replicaAddrLabel(slave), lag)
+		}
+		writeMetricHeader(b, "redis_slave_offset_lag_bytes", "gauge", "Bytes of replication stream each replica is behind")
+		for _, slave := range slaves {
+			offset, _ := slave["offset"].(int64)
+			fmt.Fprintf(b, "redis_slave_offset_lag_bytes{addr=\"%s\"} %d\n", replicaAddrLabel(slave), masterOffset-offset)
+		}
+		return
+	}
+
+	linkUp := info["master_link_status"] == "connected"
+	writeMetric(b, "redis_master_link_up", "gauge", "Whether the link with the master is up", boolMetric(linkUp))
+	replicaOffset, _ := info["slave_repl_offset"].(int64)
+	writeMetric(b, "redis_slave_repl_offset", "gauge", "Replication offset processed by this replica", replicaOffset)
+	if lastIO, ok := info["master_last_io_seconds_ago"].(float64); ok {
+		writeMetricHeader(b, "redis_master_last_io_seconds_ago", "gauge", "Seconds since the last interaction with the master")
+		fmt.Fprintf(b, "redis_master_last_io_seconds_ago %g\n", lastIO)
+	}
+}
+
+// writeMetricHeader writes the HELP and TYPE lines of a metric family
+func writeMetricHeader(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeMetric writes a single-sample metric family
+func writeMetric(b *strings.Builder, name, metricType, help string, value int64) {
+	writeMetricHeader(b, name, metricType, help)
+	fmt.Fprintf(b, "%s %d\n", name, value)
+}
+
+// labelValueEscaper escapes a label value for the Prometheus text format,
+// which only knows backslash, double quote and newline escapes
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue escapes a label value for the Prometheus text format
+// Go's %q is not a substitute: it also escapes tabs and non-printable or
+// non-ASCII characters with sequences Prometheus does not decode
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// replicaAddrLabel returns the escaped addr label of a replica
+// The address is the one the replica announced, so it is not trusted
+func replicaAddrLabel(slave map[string]interface{}) string {
+	return escapeLabelValue(fmt.Sprintf("%s:%d", slave["ip"], slave["port"]))
+}
+
+// boolMetric converts a flag to a 0/1 sample value
+func boolMetric(v bool) int64 {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Only commands from the command table get a redis_commands_total series
+func TestMetricsCountKnownCommandsOnly(t *testing.T) {
+	metricsPort := freePort(t)
+	_, port := startTestServer(t, func(cfg *Config) {
+		cfg.MetricsPort = metricsPort
+	})
+	c := dialTestClient(t, port)
+
+	c.do("SET", "k", "v")
+	c.do("get", "k")
+	if reply := c.do("NOSUCHCMD\"x", "k"); !isErrorReply(reply) {
+		t.Fatalf("unknown command = %v, want an error", reply)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", metricsPort))
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	metrics := string(body)
+
+	for _, want := range []string{`redis_commands_total{cmd="set"} 1`, `redis_commands_total{cmd="get"} 1`} {
+		if !strings.Contains(metrics, want) {
+			t.Fatalf("metrics lack %s:\n%s", want, metrics)
+		}
+	}
+	if strings.Contains(strings.ToLower(metrics), "nosuchcmd") {
+		t.Fatalf("metrics count an unknown command:\n%s", metrics)
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"get", "get"},
+		{`a"b`, `a\"b`},
+		{`a\b`, `a\\b`},
+		{"a\nb", `a\nb`},
+		{"a\tb", "a\tb"}, // Tabs and non-ASCII are valid as is
+		{"é", "é"},
+	}
+	for _, tt := range tests {
+		if got := escapeLabelValue(tt.in); got != tt.want {
+			t.Errorf("escapeLabelValue(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
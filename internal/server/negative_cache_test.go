@@ -0,0 +1,53 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// A SET ... NEGATIVE tombstone is logged with an absolute deadline and keeps
+// its flag across an AOF rewrite, DEBUG RELOAD and DUMP/RESTORE
+func TestNegativeCachePersisted(t *testing.T) {
+	s, port := startAOFServer(t, nil)
+	c := dialTestClient(t, port)
+
+	start := time.Now()
+	if reply := c.do("SET", "k", "v", "EX", "100", "NEGATIVE"); reply != "OK" {
+		t.Fatalf("SET NEGATIVE: %v", reply)
+	}
+	checkTombstone := func(what string, logged [][]string) {
+		t.Helper()
+		if len(logged) != 1 || len(logged[0]) != 6 || logged[0][3] != "PXAT" || logged[0][5] != "NEGATIVE" {
+			t.Fatalf("%s has %v, want SET k v PXAT <ms> NEGATIVE", what, logged)
+		}
+		checkDeadline(t, what, logged[0][4], start.Add(100*time.Second))
+	}
+	checkTombstone("AOF", loggedCommands(t, s, "SET", "PEXPIREAT"))
+
+	rewriteAOF(t, c)
+	checkTombstone("rewritten AOF", loggedCommands(t, s, "SET", "PEXPIREAT"))
+
+	if reply := c.do("DEBUG", "RELOAD"); reply != "OK" {
+		t.Fatalf("DEBUG RELOAD: %v", reply)
+	}
+	payload, ok := c.do("DUMP", "k").(string)
+	if !ok {
+		t.Fatalf("DUMP did not return a payload")
+	}
+	if reply := c.do("RESTORE", "copy", "100000", payload); reply != "OK" {
+		t.Fatalf("RESTORE: %v", reply)
+	}
+	for _, key := range []string{"k", "copy"} {
+		if reply := c.do("GET", key); !isErrorReply(reply) {
+			t.Fatalf("GET %s = %v, want the NEGATIVE error", key, reply)
+		}
+	}
+
+	// Without a TTL the tombstone can't expire, so RESTORE keeps only the value
+	if reply := c.do("RESTORE", "persistent", "0", payload); reply != "OK" {
+		t.Fatalf("RESTORE without TTL: %v", reply)
+	}
+	if reply := c.do("GET", "persistent"); reply != "v" {
+		t.Fatalf("GET persistent = %v, want v", reply)
+	}
+}
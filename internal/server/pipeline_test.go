@@ -0,0 +1,51 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Pipelined replies are batched up to pipeline-max-pending-bytes, however
+// small the write buffer, and flushed once that many are pending
+func TestPipelineFlushesAtMaxPendingBytes(t *testing.T) {
+	const maxPending = 16 * 1024
+	s := startInProcessServer(t, func(cfg *Config) {
+		cfg.WriteBufferSize = 4096
+		cfg.PipelineMaxPendingBytes = maxPending
+	})
+	value := strings.Repeat("v", 1000)
+	s.Do("SET", "k", value)
+
+	// Each write on the server end of the pipe is read on its own, so every
+	// chunk read here is one flush
+	c := connectTestClient(t, s)
+	const gets = 100
+	go func() {
+		var b strings.Builder
+		for i := 0; i < gets; i++ {
+			b.WriteString("*2\r\n$3\r\nGET\r\n$1\r\nk\r\n")
+		}
+		c.conn.Write([]byte(b.String()))
+	}()
+
+	want := gets * len("$1000\r\n"+value+"\r\n")
+	buf := make([]byte, 4*maxPending)
+	received, largest := 0, 0
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for received < want {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read after %d of %d bytes: %v", received, want, err)
+		}
+		received += n
+		largest = max(largest, n)
+	}
+
+	if largest > maxPending {
+		t.Fatalf("flushed %d bytes at once, over the %d byte cap", largest, maxPending)
+	}
+	if largest <= 4096 {
+		t.Fatalf("largest flush is %d bytes: replies were flushed at the write buffer size, not the cap", largest)
+	}
+}
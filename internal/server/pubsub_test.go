@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// pubSubSizesEmpty is DEBUG PUBSUB-SIZES with no subscribed clients
+const pubSubSizesEmpty = "channels:0 patterns:0 subscribers:0 subscriber_channels:0 subscriber_patterns:0"
+
+// A subscriber that disconnects, even with messages in flight, leaves no
+// entry behind in any pub/sub map
+func TestPubSubReleasedOnDisconnect(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	subscriber := connectTestClient(t, s)
+	subscriber.send("SUBSCRIBE", "news", "sports")
+	subscriber.read()
+	subscriber.read()
+	subscriber.send("PSUBSCRIBE", "user:*")
+	subscriber.read()
+
+	if sizes := c.do("DEBUG", "PUBSUB-SIZES"); sizes == pubSubSizesEmpty {
+		t.Fatalf("DEBUG PUBSUB-SIZES with a subscriber = %v", sizes)
+	}
+
+	// Leave messages queued for the subscriber, then drop its connection
+	for i := 0; i < 100; i++ {
+		c.do("PUBLISH", "news", "message")
+		c.do("PUBLISH", "user:1", "message")
+	}
+	subscriber.conn.Close()
+
+	waitFor(t, 5*time.Second, "the subscriber's pub/sub state to be released", func() bool {
+		return c.do("DEBUG", "PUBSUB-SIZES") == pubSubSizesEmpty
+	})
+	if reply := c.do("PUBLISH", "news", "message"); reply != int64(0) {
+		t.Fatalf("PUBLISH after the disconnect reached %v subscribers, want 0", reply)
+	}
+}
+
+// A client that unsubscribes from everything holds no pub/sub state while
+// still connected, and one that subscribes again is cleaned up on disconnect
+func TestPubSubReleasedOnUnsubscribe(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	subscriber := connectTestClient(t, s)
+	subscriber.send("SUBSCRIBE", "news")
+	subscriber.read()
+	subscriber.send("PSUBSCRIBE", "user:*")
+	subscriber.read()
+	subscriber.send("UNSUBSCRIBE")
+	subscriber.read()
+	subscriber.send("PUNSUBSCRIBE")
+	subscriber.read()
+
+	if sizes := c.do("DEBUG", "PUBSUB-SIZES"); sizes != pubSubSizesEmpty {
+		t.Fatalf("DEBUG PUBSUB-SIZES after unsubscribing = %v, want %s", sizes, pubSubSizesEmpty)
+	}
+
+	// Subscribing again starts a new message pump
+	subscriber.send("SUBSCRIBE", "news")
+	subscriber.read()
+	if reply := c.do("PUBLISH", "news", "hello"); reply != int64(1) {
+		t.Fatalf("PUBLISH after re-subscribing reached %v subscribers, want 1", reply)
+	}
+	if msg, _ := subscriber.read().([]interface{}); len(msg) != 3 || msg[2] != "hello" {
+		t.Fatalf("re-subscribed client got %v, want the message", msg)
+	}
+
+	subscriber.conn.Close()
+	waitFor(t, 5*time.Second, "the subscriber's pub/sub state to be released", func() bool {
+		return c.do("DEBUG", "PUBSUB-SIZES") == pubSubSizesEmpty
+	})
+}
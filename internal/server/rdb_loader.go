@@ -3,24 +3,34 @@ package server
 import (
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
-	"redis/internal/protocol"
 	"redis/internal/rdb"
+	"redis/internal/storage"
 )
 
 // loadRDB loads and restores data from the RDB file
 func (s *RedisServer) loadRDB() error {
+	found, err := s.loadRDBFile(s.executeCommand)
+	if err == nil && !found {
+		// File doesn't exist - first startup
+		log.Println("No RDB file found")
+	}
+	return err
+}
+
+// loadRDBFile restores the keys of the RDB file by running their commands
+// through exec; found is false when there is no RDB file
+func (s *RedisServer) loadRDBFile(exec func(args []string) error) (found bool, err error) {
 	startTime := time.Now()
 
 	reader, err := rdb.NewReader(s.config.RDBFilepath)
 	if err != nil {
-		return fmt.Errorf("failed to create RDB reader: %w", err)
+		return false, fmt.Errorf("failed to create RDB reader: %w", err)
 	}
 	if reader == nil {
-		// File doesn't exist - first startup
-		log.Println("No RDB file found")
-		return nil
+		return false, nil
 	}
 	defer reader.Close()
 
@@ -29,13 +39,13 @@ func (s *RedisServer) loadRDB() error {
 	// Load all data from RDB file
 	commands, err := reader.Load()
 	if err != nil {
-		return fmt.Errorf("failed to load RDB data: %w", err)
+		return true, fmt.Errorf("failed to load RDB data: %w", err)
 	}
 
 	// Restore data by executing appropriate commands
 	errorCount := 0
 	for _, cmd := range commands {
-		if err := s.restoreFromRDB(cmd); err != nil {
+		if err := restoreFromRDB(cmd, exec); err != nil {
 			log.Printf("RDB restore error for key %s: %v", cmd.Key, err)
 			errorCount++
 			// Continue loading despite errors
@@ -48,11 +58,11 @@ func (s *RedisServer) loadRDB() error {
 		log.Printf("Warning: %d errors during RDB restore", errorCount)
 	}
 
-	return nil
+	return true, nil
 }
 
-// restoreFromRDB restores a single key from RDB data
-func (s *RedisServer) restoreFromRDB(cmd rdb.LoadCommand) error {
+// restoreFromRDB restores a single key from RDB data through exec
+func restoreFromRDB(cmd rdb.LoadCommand, exec func(args []string) error) error {
 	var args []string
 
 	// Build command based on data type
@@ -64,9 +74,12 @@ func (s *RedisServer) restoreFromRDB(cmd rdb.LoadCommand) error {
 		}
 
 		if cmd.Expiration != nil {
-			// SET key value PXAT timestamp
+			// SET key value PXAT timestamp [NEGATIVE]
 			expireMs := cmd.Expiration.UnixMilli()
 			args = []string{"SET", cmd.Key, value, "PXAT", fmt.Sprintf("%d", expireMs)}
+			if cmd.Negative {
+				args = append(args, "NEGATIVE")
+			}
 		} else {
 			// SET key value
 			args = []string{"SET", cmd.Key, value}
@@ -83,7 +96,7 @@ func (s *RedisServer) restoreFromRDB(cmd rdb.LoadCommand) error {
 
 		// Set expiration separately if needed
 		if cmd.Expiration != nil {
-			if err := s.executeCommand(args); err != nil {
+			if err := exec(args); err != nil {
 				return err
 			}
 			expireMs := cmd.Expiration.UnixMilli()
@@ -104,7 +117,7 @@ func (s *RedisServer) restoreFromRDB(cmd rdb.LoadCommand) error {
 
 		// Set expiration separately if needed
 		if cmd.Expiration != nil {
-			if err := s.executeCommand(args); err != nil {
+			if err := exec(args); err != nil {
 				return err
 			}
 			expireMs := cmd.Expiration.UnixMilli()
@@ -125,19 +138,67 @@ func (s *RedisServer) restoreFromRDB(cmd rdb.LoadCommand) error {
 
 		// Set expiration separately if needed
 		if cmd.Expiration != nil {
-			if err := s.executeCommand(args); err != nil {
+			if err := exec(args); err != nil {
 				return err
 			}
 			expireMs := cmd.Expiration.UnixMilli()
 			args = []string{"PEXPIREAT", cmd.Key, fmt.Sprintf("%d", expireMs)}
 		}
 
+	case rdb.TypeZSet:
+		zset, ok := cmd.Value.([]rdb.ZSetMember)
+		if !ok {
+			return fmt.Errorf("invalid zset value type")
+		}
+
+		// ZADD key score1 member1 score2 member2 ...
+		args = []string{"ZADD", cmd.Key}
+		for _, member := range zset {
+			args = append(args, strconv.FormatFloat(member.Score, 'g', -1, 64), member.Member)
+		}
+
+		// Set expiration separately if needed
+		if cmd.Expiration != nil {
+			if err := exec(args); err != nil {
+				return err
+			}
+			expireMs := cmd.Expiration.UnixMilli()
+			args = []string{"PEXPIREAT", cmd.Key, fmt.Sprintf("%d", expireMs)}
+		}
+
+	case rdb.TypeCuckooFilter, rdb.TypeCountMinSketch, rdb.TypeHashFieldTTL:
+		value, ok := cmd.Value.(*storage.Value)
+		if !ok {
+			return fmt.Errorf("invalid value type for type %d", cmd.Type)
+		}
+
+		// No command rebuilds these, so restore the value from its DUMP payload
+		// RESTORE key ttl payload REPLACE [ABSTTL]
+		payload, err := rdb.EncodeDump(value)
+		if err != nil {
+			return err
+		}
+		args = []string{"RESTORE", cmd.Key, "0", string(payload), "REPLACE"}
+		if cmd.Expiration != nil {
+			args[2] = strconv.FormatInt(cmd.Expiration.UnixMilli(), 10)
+			args = append(args, "ABSTTL")
+		}
+
 	default:
 		return fmt.Errorf("unknown data type: %d", cmd.Type)
 	}
 
 	// Execute the command
-	return s.executeCommand(args)
+	if err := exec(args); err != nil {
+		return err
+	}
+
+	// A sliding expiry is restored as its deadline plus the window
+	if cmd.SlidingTTL != 0 && cmd.Expiration != nil {
+		return exec([]string{"PEXPIREAT", cmd.Key, strconv.FormatInt(cmd.Expiration.UnixMilli(), 10),
+			"SLIDING", strconv.FormatInt(cmd.SlidingTTL.Milliseconds(), 10)})
+	}
+	return nil
 }
 
 // startBackgroundRDBSave starts a background goroutine that periodically checks
@@ -155,22 +216,18 @@ func (s *RedisServer) startBackgroundRDBSave() {
 			case <-s.rdbTicker.C:
 				// Check if save conditions are met
 				changes := s.changesSinceLastSave.Load()
+				s.saveMu.Lock()
 				elapsed := time.Since(s.lastSaveTime)
+				s.saveMu.Unlock()
 
 				if changes >= int64(s.config.RDBSavePoint.Changes) &&
 					elapsed >= time.Duration(s.config.RDBSavePoint.Seconds)*time.Second {
 
 					log.Printf("RDB auto-save triggered: %d changes in %v", changes, elapsed)
 
-					// Trigger BGSAVE
-					if err := s.performBackgroundSave(); err != nil {
+					// Trigger BGSAVE; the counters are reset once it succeeds
+					if err := s.handler.BackgroundSave(); err != nil {
 						log.Printf("RDB auto-save failed: %v", err)
-					} else {
-						// Reset counters after successful save
-						s.saveMu.Lock()
-						s.changesSinceLastSave.Store(0)
-						s.lastSaveTime = time.Now()
-						s.saveMu.Unlock()
 					}
 				}
 
@@ -181,20 +238,6 @@ func (s *RedisServer) startBackgroundRDBSave() {
 	}()
 }
 
-// performBackgroundSave executes BGSAVE command
-func (s *RedisServer) performBackgroundSave() error {
-	// Execute BGSAVE through the handler
-	cmd := &protocol.Command{Args: []string{"BGSAVE"}}
-	response := s.handler.ExecuteCommand(cmd)
-
-	// Check if result indicates an error
-	if len(response) > 0 && response[0] == '-' {
-		return fmt.Errorf("BGSAVE failed: %s", string(response))
-	}
-
-	return nil
-}
-
 // IncrementChanges increments the change counter (called after each write operation)
 func (s *RedisServer) IncrementChanges() {
 	s.changesSinceLastSave.Add(1)
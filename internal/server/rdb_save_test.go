@@ -0,0 +1,54 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// persistenceInfo returns the INFO persistence fields by name
+func persistenceInfo(t *testing.T, c *testClient) map[string]string {
+	t.Helper()
+	info, ok := c.do("INFO", "persistence").(string)
+	if !ok {
+		t.Fatalf("INFO persistence did not return a bulk string")
+	}
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\r\n") {
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// Saves started by the save point report in INFO persistence like BGSAVE,
+// and only a successful one clears the change counter
+func TestAutoSaveReportsStatus(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "not-yet")
+	_, port := startTestServer(t, func(cfg *Config) {
+		cfg.RDBFilepath = filepath.Join(dir, "dump.rdb")
+		cfg.RDBSavePoint = RDBSavePoint{Seconds: 1, Changes: 1}
+	})
+	c := dialTestClient(t, port)
+	c.do("SET", "k", "v")
+
+	waitFor(t, 5*time.Second, "the auto-save to fail", func() bool {
+		return persistenceInfo(t, c)["rdb_last_bgsave_status"] == "err"
+	})
+	if changes := persistenceInfo(t, c)["rdb_changes_since_last_save"]; changes != "1" {
+		t.Fatalf("rdb_changes_since_last_save = %s after a failed save, want 1", changes)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "the auto-save to succeed", func() bool {
+		return persistenceInfo(t, c)["rdb_last_bgsave_status"] == "ok"
+	})
+	waitFor(t, time.Second, "the change counter to clear", func() bool {
+		return persistenceInfo(t, c)["rdb_changes_since_last_save"] == "0"
+	})
+}
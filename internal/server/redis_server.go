@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -25,6 +27,7 @@ import (
 type RedisServer struct {
 	config          *Config
 	listener        net.Listener
+	unixListener    net.Listener // nil unless UnixSocket is set
 	processor       *processor.Processor
 	handler         *handler.CommandHandler
 	aofWriter       *aof.Writer
@@ -32,6 +35,7 @@ type RedisServer struct {
 	connections     sync.Map
 	connIDCounter   atomic.Int64
 	activeConnCount atomic.Int64
+	rejectedConns   atomic.Int64
 	wg              sync.WaitGroup
 	shutdownChan    chan struct{}
 	mu              sync.RWMutex
@@ -43,6 +47,10 @@ type RedisServer struct {
 	saveMu               sync.Mutex
 	rdbTicker            *time.Ticker
 	rdbStopChan          chan struct{}
+
+	// Prometheus metrics endpoint (nil unless MetricsPort is set)
+	metricsServer *http.Server
+	opsPerSec     atomic.Int64
 }
 
 // NewRedisServer creates a new Redis server instance
@@ -51,17 +59,12 @@ func NewRedisServer(cfg *Config) *RedisServer {
 		cfg = DefaultConfig()
 	}
 
-	store := storage.NewStore()
-
-	// Initialize cluster if enabled
-	if cfg.ClusterEnabled {
-		if err := initializeCluster(cfg, store); err != nil {
-			log.Printf("Warning: Failed to initialize cluster: %v", err)
-			log.Printf("Continuing without cluster support")
-		}
+	if cfg.ProtoMaxBulkLen > 0 {
+		protocol.SetMaxBulkLen(cfg.ProtoMaxBulkLen)
 	}
 
-	proc := processor.NewProcessor(store)
+	store := newStore(cfg)
+	proc := newProcessor(cfg, store)
 
 	// Create AOF writer
 	var aofWriter *aof.Writer
@@ -98,19 +101,7 @@ func NewRedisServer(cfg *Config) *RedisServer {
 		return proc.GetStore()
 	})
 
-	// Build handler config from server config
-	handlerConfig := handler.HandlerConfig{
-		ReadBufferSize:  cfg.ReadBufferSize,
-		WriteBufferSize: cfg.WriteBufferSize,
-		Pipeline: handler.PipelineConfig{
-			MaxCommands:     cfg.MaxPipelineCommands,
-			SlowThreshold:   cfg.SlowLogThreshold,
-			CommandTimeout:  cfg.CommandTimeout,
-			ReadTimeout:     cfg.ReadTimeout,
-			PipelineTimeout: cfg.PipelineTimeout,
-		},
-	}
-	cmdHandler := handler.NewCommandHandler(proc, handlerConfig, aofWriter, replMgr, cfg.Port)
+	cmdHandler := handler.NewCommandHandler(proc, newHandlerConfig(cfg), aofWriter, replMgr, cfg.Port)
 
 	s := &RedisServer{
 		config:         cfg,
@@ -128,22 +119,67 @@ func NewRedisServer(cfg *Config) *RedisServer {
 		s.IncrementChanges()
 	})
 
-	// Set command executor for replica (to execute commands received from master)
-	if replRole == replication.RoleReplica {
-		replMgr.SetCommandExecutor(func(args []string) error {
-			cmd := &protocol.Command{Args: args}
-			// Use ExecuteReplicatedCommand which bypasses read-only check
-			response := cmdHandler.ExecuteReplicatedCommand(cmd)
-			// Check if response is an error
-			if len(response) > 0 && response[0] == '-' {
-				return fmt.Errorf("command failed: %s", string(response))
-			}
-			return nil
-		})
-	}
+	// Propagate keys removed by the active expiry cycle as DEL to AOF and replicas
+	proc.SetExpiredKeysCallback(cmdHandler.PropagateExpiredKeys)
+	proc.SetRefreshedExpiriesCallback(cmdHandler.PropagateRefreshedExpiries)
+
+	// Replicas only hide expired keys and wait for the master's DEL
+	replMgr.SetRoleChangeCallback(func(role replication.Role) {
+		proc.GetStore().SetPassiveExpiry(role == replication.RoleReplica)
+	})
+
+	// SHUTDOWN stops the server the same way a signal does
+	cmdHandler.SetShutdownFunc(s.Shutdown)
+
+	// INFO reports the connection counters tracked by the accept loop
+	cmdHandler.SetConnStatsFunc(func() handler.ConnStats {
+		return handler.ConnStats{
+			Connected:     s.activeConnCount.Load(),
+			MaxClients:    int64(s.config.MaxConnections),
+			TotalReceived: s.connIDCounter.Load(),
+			Rejected:      s.rejectedConns.Load(),
+		}
+	})
+
+	// INFO persistence reports the auto-save change counter; a successful
+	// BGSAVE takes off the changes counted when it started, keeping the
+	// writes made while it ran
+	cmdHandler.SetSaveCounter(s.changesSinceLastSave.Load, func(saved int64) {
+		s.saveMu.Lock()
+		s.changesSinceLastSave.Add(-saved)
+		s.lastSaveTime = time.Now()
+		s.saveMu.Unlock()
+	})
+
+	// DEBUG RELOAD loads the RDB into a staging store with the startup loader
+	cmdHandler.SetReloadFunc(s.stageRDB)
+
+	// DEBUG RELOAD-VERIFY loads the AOF and the RDB into throwaway stores
+	cmdHandler.SetAOFDigestFunc(s.digestAOF)
+	cmdHandler.SetRDBDigestFunc(s.digestRDB)
+
+	// DEBUG LOADRDB loads its payload into a throwaway store
+	cmdHandler.SetRDBCheckFunc(s.checkRDBPayload)
+
+	// Set command executor for replication (to execute commands received from master)
+	// Installed for masters too, since REPLICAOF can turn any server into a replica
+	replMgr.SetCommandExecutor(func(args []string) error {
+		cmd := &protocol.Command{Args: args}
+		// Use ExecuteReplicatedCommand which bypasses read-only check
+		response := cmdHandler.ExecuteReplicatedCommand(cmd)
+		// Check if response is an error
+		if len(response) > 0 && response[0] == '-' {
+			return fmt.Errorf("command failed: %s", string(response))
+		}
+		return nil
+	})
+
+	// MULTI ... EXEC blocks from the master are applied as one unit
+	replMgr.SetTransactionExecutor(cmdHandler.ExecuteReplicatedTransaction)
 
 	// Set listening port for replication
 	replMgr.SetListeningPort(cfg.Port)
+	replMgr.SetAnnounceAddress(cfg.ReplicaAnnounceIP, cfg.ReplicaAnnouncePort)
 
 	// Load persistence files (AOF takes priority, fallback to RDB)
 	if cfg.AOF.Enabled {
@@ -224,22 +260,149 @@ func (s *RedisServer) loadAOF() error {
 	}
 
 	// Replay all commands
+	errorCount := replayAOF(commands, s.executeCommand)
+
+	duration := time.Since(startTime)
+	log.Printf("AOF loaded: %d commands replayed in %v", len(commands), duration)
+	if errorCount > 0 {
+		log.Printf("Warning: %d errors during AOF replay", errorCount)
+	}
+
+	return nil
+}
+
+// replayAOF runs the commands read from an AOF file through exec and returns
+// how many failed
+// Commands between MULTI and EXEC are only replayed once EXEC is read, so a
+// transaction cut short by a crash is dropped rather than half-applied
+func replayAOF(commands [][]string, exec func(args []string) error) int {
 	errorCount := 0
+	var txBlock [][]string
+	inTx := false
 	for _, cmd := range commands {
-		if err := s.executeCommand(cmd); err != nil {
+		switch strings.ToUpper(cmd[0]) {
+		case "MULTI":
+			inTx, txBlock = true, nil
+			continue
+		case "EXEC":
+			if inTx {
+				for _, txCmd := range txBlock {
+					if err := exec(txCmd); err != nil {
+						log.Printf("AOF replay error for command %v: %v", txCmd, err)
+						errorCount++
+					}
+				}
+				inTx, txBlock = false, nil
+				continue
+			}
+		default:
+			if inTx {
+				txBlock = append(txBlock, cmd)
+				continue
+			}
+		}
+
+		if err := exec(cmd); err != nil {
 			log.Printf("AOF replay error for command %v: %v", cmd, err)
 			errorCount++
 			// Continue loading despite errors
 		}
 	}
+	if inTx {
+		log.Printf("Warning: AOF ends inside a MULTI block, discarding %d commands of the incomplete transaction", len(txBlock))
+	}
+	return errorCount
+}
+
+// digestAOF loads the AOF file into a throwaway in-process server and returns
+// the DEBUG DIGEST of the result (used by DEBUG RELOAD-VERIFY)
+func (s *RedisServer) digestAOF() (string, error) {
+	reader, err := aof.NewReader(s.config.AOF.Filepath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create AOF reader: %w", err)
+	}
+	if reader == nil {
+		return "", fmt.Errorf("AOF file %s not found", s.config.AOF.Filepath)
+	}
+	defer reader.Close()
 
-	duration := time.Since(startTime)
-	log.Printf("AOF loaded: %d commands replayed in %v", len(commands), duration)
-	if errorCount > 0 {
-		log.Printf("Warning: %d errors during AOF replay", errorCount)
+	commands, err := reader.LoadAll()
+	if err != nil {
+		return "", fmt.Errorf("failed to load AOF commands: %w", err)
 	}
 
-	return nil
+	scratch := s.newScratchServer()
+	defer scratch.Close()
+
+	replayAOF(commands, scratch.exec)
+
+	return scratch.Store().Digest(), nil
+}
+
+// digestRDB loads the RDB file into a throwaway in-process server and returns
+// the DEBUG DIGEST of the result (used by DEBUG RELOAD-VERIFY)
+func (s *RedisServer) digestRDB() (string, error) {
+	scratch := s.newScratchServer()
+	defer scratch.Close()
+
+	found, err := s.loadRDBFile(scratch.exec)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("RDB file %s not found", s.config.RDBFilepath)
+	}
+
+	return scratch.Store().Digest(), nil
+}
+
+// stageRDB loads the RDB file into a throwaway in-process server and returns
+// its store for DEBUG RELOAD to swap in; any key failing to restore fails
+// the whole load, as does a missing file
+func (s *RedisServer) stageRDB() (*storage.Store, error) {
+	scratch := s.newScratchServer()
+	defer scratch.Close()
+
+	var restoreErr error
+	found, err := s.loadRDBFile(func(args []string) error {
+		err := scratch.exec(args)
+		if err != nil && restoreErr == nil {
+			restoreErr = err
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("RDB file %s not found", s.config.RDBFilepath)
+	}
+	if restoreErr != nil {
+		return nil, restoreErr
+	}
+
+	// Closing stops the scratch processor, so the store is no longer in use
+	scratch.Close()
+	return scratch.Store(), nil
+}
+
+// newScratchServer creates a throwaway in-process server with this server's
+// settings, except that TTLs are applied exactly as given and active expiry
+// is off, so only the commands run on it touch its store
+func (s *RedisServer) newScratchServer() *InProcessServer {
+	cfg := *s.config
+	cfg.ExpireJitterPercent = 0
+	scratch := NewInProcessServer(&cfg)
+	scratch.processor.SetActiveExpireEnabled(false)
+	return scratch
+}
+
+// checkRDBPayload loads an RDB payload into a throwaway in-process server
+// with the full-resync loader and reports whether it loaded (DEBUG LOADRDB)
+func (s *RedisServer) checkRDBPayload(data []byte) error {
+	scratch := s.newScratchServer()
+	defer scratch.Close()
+	return scratch.LoadReplicaRDB(data)
 }
 
 // executeCommand executes a single command during AOF replay
@@ -270,16 +433,51 @@ func (s *RedisServer) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to start listener: %w", err)
 	}
 
+	// Size the accept queue (the OS caps it, e.g. net.core.somaxconn on Linux)
+	if s.config.TCPBacklog > 0 {
+		if err := setListenBacklog(listener, s.config.TCPBacklog); err != nil {
+			log.Printf("Warning: Failed to set tcp-backlog to %d: %v", s.config.TCPBacklog, err)
+		}
+	}
+
 	s.listener = listener
 	log.Printf("Redis server listening on %s", addr)
 
-	go s.acceptConnections(ctx)
+	if s.config.UnixSocket != "" {
+		unixListener, err := s.listenUnix()
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		s.unixListener = unixListener
+	}
+
+	if s.config.MetricsPort > 0 {
+		if err := s.startMetricsServer(); err != nil {
+			listener.Close()
+			if s.unixListener != nil {
+				s.unixListener.Close()
+			}
+			return err
+		}
+	}
+
+	go s.acceptConnections(ctx, listener)
+	if s.unixListener != nil {
+		go s.acceptConnections(ctx, s.unixListener)
+	}
 
-	<-ctx.Done()
+	// Return on cancellation or when SHUTDOWN stopped the server
+	select {
+	case <-ctx.Done():
+	case <-s.shutdownChan:
+	}
 	return nil
 }
 
-func (s *RedisServer) acceptConnections(ctx context.Context) {
+// acceptConnections serves a listener (TCP or UNIX socket) until shutdown
+// Both listeners share maxclients and the same connection handling
+func (s *RedisServer) acceptConnections(ctx context.Context, listener net.Listener) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -287,7 +485,7 @@ func (s *RedisServer) acceptConnections(ctx context.Context) {
 		case <-s.shutdownChan:
 			return
 		default:
-			conn, err := s.listener.Accept()
+			conn, err := listener.Accept()
 			if err != nil {
 				s.mu.RLock()
 				if s.isShutdown {
@@ -300,17 +498,41 @@ func (s *RedisServer) acceptConnections(ctx context.Context) {
 			}
 
 			if s.activeConnCount.Load() >= int64(s.config.MaxConnections) {
+				s.rejectedConns.Add(1)
 				log.Printf("Max connections reached, rejecting connection from %s", conn.RemoteAddr())
 				conn.Close()
 				continue
 			}
 
+			s.configureTCPConn(conn)
+
 			s.wg.Add(1)
 			go s.handleConnection(ctx, conn)
 		}
 	}
 }
 
+// configureTCPConn applies tcp-keepalive to an accepted client connection
+// Keepalive probes detect peers that vanished behind a NAT or firewall
+// A period of 0 keeps Go's default keepalive (15s); a negative one disables it
+func (s *RedisServer) configureTCPConn(conn net.Conn) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	switch {
+	case s.config.TCPKeepAlive == 0:
+		return // Accepted connections already have Go's default
+	case s.config.TCPKeepAlive < 0:
+		tcpConn.SetKeepAlive(false)
+		return
+	}
+
+	tcpConn.SetKeepAlive(true)
+	tcpConn.SetKeepAlivePeriod(s.config.TCPKeepAlive)
+}
+
 func (s *RedisServer) handleConnection(ctx context.Context, conn net.Conn) {
 	defer s.wg.Done()
 
@@ -325,8 +547,9 @@ func (s *RedisServer) handleConnection(ctx context.Context, conn net.Conn) {
 	startTime := time.Now()
 
 	client := &handler.Client{
-		ID:   connID,
-		Conn: conn,
+		ID:        connID,
+		Conn:      conn,
+		CreatedAt: startTime,
 	}
 
 	s.handler.Handle(ctx, client)
@@ -339,6 +562,71 @@ func (s *RedisServer) handleConnection(ctx context.Context, conn net.Conn) {
 	}
 }
 
+// newStore creates the keyspace with the configured encoding thresholds and
+// key lock stripes, setting up cluster mode if enabled
+func newStore(cfg *Config) *storage.Store {
+	store := storage.NewStore()
+	if cfg.SetMaxIntsetEntries > 0 {
+		store.SetMaxIntsetEntries(cfg.SetMaxIntsetEntries)
+	}
+	store.SetListMaxListpackSize(cfg.ListMaxListpackSize)
+	store.SetZSetListpackLimits(cfg.ZSetMaxListpackEntries, cfg.ZSetMaxListpackValue)
+	store.SetHashListpackLimits(cfg.HashMaxListpackEntries, cfg.HashMaxListpackValue)
+	store.SetKeyLockStripes(cfg.KeyLockStripes)
+
+	// Initialize cluster if enabled
+	if cfg.ClusterEnabled {
+		if err := initializeCluster(cfg, store); err != nil {
+			log.Printf("Warning: Failed to initialize cluster: %v", err)
+			log.Printf("Continuing without cluster support")
+		}
+	}
+
+	return store
+}
+
+// newProcessor starts the single-threaded command processor over store
+func newProcessor(cfg *Config, store *storage.Store) *processor.Processor {
+	return processor.NewProcessorWithConfig(store, processor.ActiveExpireConfig{
+		Interval:   cfg.ActiveExpireInterval,
+		SampleSize: cfg.ActiveExpireSampleSize,
+		TimeBudget: cfg.ActiveExpireTimeBudget,
+	})
+}
+
+// newHandlerConfig builds the handler config from server config
+func newHandlerConfig(cfg *Config) handler.HandlerConfig {
+	return handler.HandlerConfig{
+		ReadBufferSize:  cfg.ReadBufferSize,
+		WriteBufferSize: cfg.WriteBufferSize,
+		Pipeline: handler.PipelineConfig{
+			MaxCommands:     cfg.MaxPipelineCommands,
+			SlowThreshold:   cfg.SlowLogThreshold,
+			CommandTimeout:  cfg.CommandTimeout,
+			ReadTimeout:     cfg.ReadTimeout,
+			PipelineTimeout: cfg.PipelineTimeout,
+			MaxPendingBytes: cfg.PipelineMaxPendingBytes,
+		},
+		RejectWritesDuringSave: cfg.RejectWritesDuringSave,
+		ReplicaServeStaleData:  cfg.ReplicaServeStaleData,
+		LuaTimeLimit:           cfg.LuaTimeLimit,
+		PubSubPingInterval:     cfg.PubSubPingInterval,
+		PubSubBufferSize:       cfg.PubSubBufferSize,
+		RenameCommands:         cfg.RenameCommands,
+		LoadShedQueueDepth:     cfg.LoadShedQueueDepth,
+		LoadShedWait:           cfg.LoadShedWait,
+		ExpireJitterPercent:    cfg.ExpireJitterPercent,
+		SlowLogMaxArgs:         cfg.SlowLogMaxArgs,
+		SlowLogMaxArgLen:       cfg.SlowLogMaxArgLen,
+		RDBFilepath:            cfg.RDBFilepath,
+	}
+}
+
+// Handler returns the command handler
+func (s *RedisServer) Handler() *handler.CommandHandler {
+	return s.handler
+}
+
 // Shutdown gracefully shuts down the server
 func (s *RedisServer) Shutdown() {
 	s.mu.Lock()
@@ -359,9 +647,15 @@ func (s *RedisServer) Shutdown() {
 
 	close(s.shutdownChan)
 
+	s.stopMetricsServer()
+
 	if s.listener != nil {
 		s.listener.Close()
 	}
+	// Closing a UNIX listener also removes its socket file
+	if s.unixListener != nil {
+		s.unixListener.Close()
+	}
 
 	// Close all connections
 	s.connections.Range(func(key, value interface{}) bool {
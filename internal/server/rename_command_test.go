@@ -0,0 +1,73 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// renameSetAndClient renames SET to MYSET, swaps MULTI and DISCARD and
+// disables CLIENT
+func renameSetAndClient(cfg *Config) {
+	cfg.RenameCommands = map[string]string{
+		"SET":     "MYSET",
+		"MULTI":   "DISCARD",
+		"DISCARD": "MULTI",
+		"CLIENT":  "",
+	}
+}
+
+// A renamed command behaves as the original in every respect: it is logged,
+// propagated and refused on a replica under its canonical name
+func TestRenamedCommandKeepsItsBehavior(t *testing.T) {
+	master, masterPort := startAOFServer(t, renameSetAndClient)
+	_, replicaPort := startTestServer(t, func(cfg *Config) {
+		renameSetAndClient(cfg)
+		cfg.ReplicationRole = "replica"
+		cfg.ReplicationMasterHost = "127.0.0.1"
+		cfg.ReplicationMasterPort = masterPort
+	})
+	c := dialTestClient(t, masterPort)
+	replica := dialTestClient(t, replicaPort)
+
+	if reply := c.do("MYSET", "k", "v"); reply != "OK" {
+		t.Fatalf("MYSET: %v", reply)
+	}
+	if logged := loggedCommands(t, master, "SET", "MYSET"); len(logged) != 1 || logged[0][0] != "SET" {
+		t.Fatalf("logged %v, want one SET", logged)
+	}
+	waitFor(t, 5*time.Second, "the write to reach the replica", func() bool {
+		return replica.do("GET", "k") == "v"
+	})
+	if err, ok := replica.do("MYSET", "k", "w").(error); !ok || !strings.HasPrefix(err.Error(), "READONLY ") {
+		t.Fatalf("MYSET on the replica = %v, want READONLY", err)
+	}
+
+	// The swapped transaction commands keep their own behavior
+	if reply := c.do("DISCARD"); reply != "OK" {
+		t.Fatalf("renamed MULTI: %v", reply)
+	}
+	if reply := c.do("MYSET", "k", "w"); reply != "QUEUED" {
+		t.Fatalf("MYSET in a transaction: %v", reply)
+	}
+	if reply := c.do("EXEC"); !sameReply(reply, []interface{}{"OK"}) {
+		t.Fatalf("EXEC: %v", reply)
+	}
+}
+
+// The original name of a renamed or disabled command is unknown, including
+// for the commands handled before the command map
+func TestRenamedCommandOriginalNameRejected(t *testing.T) {
+	_, port := startTestServer(t, renameSetAndClient)
+	c := dialTestClient(t, port)
+
+	for _, args := range [][]string{{"SET", "k", "v"}, {"CLIENT", "ID"}} {
+		err, ok := c.do(args...).(error)
+		if !ok || !strings.HasPrefix(err.Error(), "ERR unknown command") {
+			t.Fatalf("%v = %v, want an unknown command error", args, err)
+		}
+	}
+	if reply := c.do("GET", "k"); reply != nil {
+		t.Fatalf("GET k = %v after a rejected SET", reply)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// A replica hides a key whose PX deadline passed but leaves removing it to
+// the master, whose DEL must reach the replica before the write that found
+// the key expired
+func TestReplicaPassiveExpiry(t *testing.T) {
+	master, replica := startReplicatedPair(t)
+
+	// Without active expiry the master only expires the key when touched
+	if reply := master.do("DEBUG", "SET-ACTIVE-EXPIRE", "0"); reply != "OK" {
+		t.Fatalf("DEBUG SET-ACTIVE-EXPIRE 0: %v", reply)
+	}
+	if reply := master.do("SET", "counter", "5", "PX", "300"); reply != "OK" {
+		t.Fatalf("SET: %v", reply)
+	}
+	waitFor(t, 5*time.Second, "the key to reach the replica", func() bool {
+		return replica.do("GET", "counter") == "5"
+	})
+
+	time.Sleep(400 * time.Millisecond)
+
+	// The replica hides the expired key from reads
+	if reply := replica.do("GET", "counter"); reply != nil {
+		t.Fatalf("replica GET after expiry = %v, want nil", reply)
+	}
+	if reply := replica.do("EXISTS", "counter"); reply != int64(0) {
+		t.Fatalf("replica EXISTS after expiry = %v, want 0", reply)
+	}
+
+	// The master finds the key expired, so INCR starts from 0; the replica
+	// must apply the DEL first instead of incrementing the stale 5
+	if reply := master.do("INCR", "counter"); reply != int64(1) {
+		t.Fatalf("master INCR = %v, want 1", reply)
+	}
+	waitFor(t, 5*time.Second, "the INCR to reach the replica", func() bool {
+		return replica.do("GET", "counter") != nil
+	})
+	if reply := replica.do("GET", "counter"); reply != "1" {
+		t.Fatalf("replica GET after INCR = %v, want 1", reply)
+	}
+	if reply := replica.do("TTL", "counter"); reply != int64(-1) {
+		t.Fatalf("replica TTL after INCR = %v, want -1", reply)
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// Only writes reach replicas: a command that concerns the master alone, like
+// SCRIPT FLUSH, leaves the replica as it is
+func TestOnlyWritesReplicated(t *testing.T) {
+	master, replica := startReplicatedPair(t)
+
+	sha, ok := replica.do("SCRIPT", "LOAD", "return 1").(string)
+	if !ok {
+		t.Fatalf("SCRIPT LOAD on the replica: %v", sha)
+	}
+	master.do("SCRIPT", "FLUSH")
+	master.do("SET", "k", "v")
+	waitFor(t, 5*time.Second, "the write to reach the replica", func() bool {
+		return replica.do("GET", "k") == "v"
+	})
+
+	if reply := replica.do("SCRIPT", "EXISTS", sha); !sameReply(reply, []interface{}{int64(1)}) {
+		t.Fatalf("SCRIPT EXISTS on the replica = %v after SCRIPT FLUSH on the master", reply)
+	}
+}
+
+// A script run with EVALSHA reaches replicas that never loaded it
+func TestEvalSHAReplicated(t *testing.T) {
+	master, replica := startReplicatedPair(t)
+
+	sha, ok := master.do("SCRIPT", "LOAD", "redis.call('SET', KEYS[1], ARGV[1]) return 1").(string)
+	if !ok {
+		t.Fatalf("SCRIPT LOAD: %v", sha)
+	}
+	if reply := master.do("EVALSHA", sha, "1", "k", "v"); reply != int64(1) {
+		t.Fatalf("EVALSHA: %v", reply)
+	}
+	waitFor(t, 5*time.Second, "the script's write to reach the replica", func() bool {
+		return replica.do("GET", "k") == "v"
+	})
+}
+
+// Pops of blocking commands reach replicas when the master runs without AOF
+func TestBlockingPopsReplicatedWithoutAOF(t *testing.T) {
+	master, replica := startReplicatedPair(t)
+
+	master.do("RPUSH", "list", "a", "b", "c", "d")
+	master.do("ZADD", "zset", "1", "a", "2", "b", "3", "c")
+	for _, args := range [][]string{
+		{"BLMPOP", "1", "1", "list", "LEFT", "COUNT", "2"},
+		{"BLPOP", "list", "1"},
+		{"BZMPOP", "1", "1", "zset", "MAX", "COUNT", "1"},
+		{"BZPOPMIN", "zset", "1"},
+	} {
+		if reply := master.do(args...); reply == nil {
+			t.Fatalf("%v = nil, want a popped element", args)
+		}
+	}
+	master.do("SET", "marker", "1")
+	waitFor(t, 5*time.Second, "the writes to reach the replica", func() bool {
+		return replica.do("GET", "marker") == "1"
+	})
+
+	if reply := replica.do("LRANGE", "list", "0", "-1"); !sameReply(reply, []interface{}{"d"}) {
+		t.Fatalf("LRANGE on the replica = %v, want [d]", reply)
+	}
+	if reply := replica.do("ZRANGE", "zset", "0", "-1"); !sameReply(reply, []interface{}{"b"}) {
+		t.Fatalf("ZRANGE on the replica = %v, want [b]", reply)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// A transaction on a replica never sees part of a MULTI block applied from
+// the master: both counters always read the same
+func TestReplicaTransactionNotTorn(t *testing.T) {
+	master, replica := startReplicatedPair(t)
+
+	const rounds = 300
+	done := incrementPairs(master, rounds)
+	readPairsUntil(t, replica, done)
+
+	want := strconv.Itoa(rounds)
+	waitFor(t, 5*time.Second, "the replica to catch up", func() bool {
+		return replica.do("GET", "b") == want
+	})
+}
+
+// EXEC with an implicit WAIT is refused before it runs when too few replicas
+// are online, and otherwise replies with its results once they acknowledged
+func TestExecWaitDefault(t *testing.T) {
+	master, replica := startReplicatedPair(t)
+	master.do("SET", "k", "0")
+	waitFor(t, 5*time.Second, "the replica to sync", func() bool {
+		return replica.do("GET", "k") == "0"
+	})
+
+	exec := func(numReplicas string) interface{} {
+		master.do("CLIENT", "WAIT-DEFAULT", numReplicas, "1000")
+		master.do("MULTI")
+		master.do("INCR", "k")
+		return master.do("EXEC")
+	}
+
+	if err, ok := exec("2").(error); !ok || err.Error() != "NOREPLICAS Not enough good replicas to write." {
+		t.Fatalf("EXEC waiting for 2 of 1 replicas = %v, want NOREPLICAS", err)
+	}
+	if reply := master.do("GET", "k"); reply != "0" {
+		t.Fatalf("refused EXEC still ran: k = %v", reply)
+	}
+
+	if reply := exec("1"); !sameReply(reply, []interface{}{int64(1)}) {
+		t.Fatalf("EXEC waiting for 1 replica = %v", reply)
+	}
+	if reply := replica.do("GET", "k"); reply != "1" {
+		t.Fatalf("replica has k = %v after the acknowledged EXEC", reply)
+	}
+}
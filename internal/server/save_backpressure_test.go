@@ -0,0 +1,90 @@
+//go:build unix
+
+package server
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startStalledSave starts a server rejecting writes during saves and a BGSAVE
+// that stays in progress until the returned finish is called: the RDB temp
+// file is a FIFO, so the save blocks until it is read
+func startStalledSave(t *testing.T) (c *testClient, finish func()) {
+	dir := t.TempDir()
+	fifo := filepath.Join(dir, "dump.rdb.tmp")
+	if err := syscall.Mkfifo(fifo, 0o644); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+	_, port := startTestServer(t, func(cfg *Config) {
+		cfg.RDBFilepath = filepath.Join(dir, "dump.rdb")
+		cfg.RejectWritesDuringSave = true
+	})
+	c = dialTestClient(t, port)
+
+	var once sync.Once
+	finish = func() {
+		once.Do(func() {
+			f, err := os.Open(fifo)
+			if err != nil {
+				return
+			}
+			io.Copy(io.Discard, f)
+			f.Close()
+		})
+	}
+	t.Cleanup(finish)
+
+	if reply := c.do("BGSAVE"); reply != "Background saving started" {
+		t.Fatalf("BGSAVE: %v", reply)
+	}
+	return c, finish
+}
+
+// A transaction overlapping a save is discarded as a whole, scripts included,
+// rather than applied up to the first rejected write
+func TestExecDuringSaveIsAtomic(t *testing.T) {
+	c, finish := startStalledSave(t)
+
+	c.do("MULTI")
+	c.do("SET", "a", "1")
+	c.do("EVAL", "return redis.call('SET', 'b', '2')", "0")
+	err, ok := c.do("EXEC").(error)
+	if !ok || !strings.HasPrefix(err.Error(), "EXECABORT ") {
+		t.Fatalf("EXEC during a save = %v, want EXECABORT", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if reply := c.do("GET", key); reply != nil {
+			t.Fatalf("GET %s = %v after the discarded transaction", key, reply)
+		}
+	}
+
+	// Scripts are writes outside transactions too
+	if err, ok := c.do("EVAL", "return redis.call('SET', 'b', '2')", "0").(error); !ok || !strings.HasPrefix(err.Error(), "TRYAGAIN ") {
+		t.Fatalf("EVAL during a save = %v, want TRYAGAIN", err)
+	}
+
+	// Reads still run, inside a transaction or not
+	c.do("MULTI")
+	c.do("GET", "a")
+	if reply := c.do("EXEC"); !sameReply(reply, []interface{}{nil}) {
+		t.Fatalf("read-only EXEC during a save = %v", reply)
+	}
+
+	finish()
+	waitFor(t, 5*time.Second, "the save to finish", func() bool {
+		return persistenceInfo(t, c)["rdb_bgsave_in_progress"] == "0"
+	})
+	c.do("MULTI")
+	c.do("SET", "a", "1")
+	c.do("EVAL", "return redis.call('SET', 'b', '2')", "0")
+	if reply := c.do("EXEC"); !sameReply(reply, []interface{}{"OK", "OK"}) {
+		t.Fatalf("EXEC after the save = %v", reply)
+	}
+}
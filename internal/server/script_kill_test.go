@@ -0,0 +1,65 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// spin keeps a script busy for a second without writing
+const spin = "local t = os.clock() while os.clock() - t < 1 do end "
+
+// runBusyScript sends script on its own connection and waits until the
+// server replies BUSY to others
+func runBusyScript(t *testing.T, port int, script string) (*testClient, *testClient) {
+	t.Helper()
+	runner := dialTestClient(t, port)
+	runner.send("EVAL", script, "0")
+
+	// A command sent before lua-time-limit waits for the script to end, so
+	// only probe once the limit has passed
+	time.Sleep(200 * time.Millisecond)
+	c := dialTestClient(t, port)
+	waitFor(t, 5*time.Second, "the script to make the server busy", func() bool {
+		err, ok := c.do("GET", "x").(error)
+		return ok && strings.HasPrefix(err.Error(), "BUSY")
+	})
+	return runner, c
+}
+
+// A script that has started writing cannot be killed, so it is never left
+// half applied
+func TestScriptKillRefusedAfterWrite(t *testing.T) {
+	_, port := startTestServer(t, func(cfg *Config) {
+		cfg.LuaTimeLimit = 50 * time.Millisecond
+	})
+	runner, c := runBusyScript(t, port, "redis.call('SET', 'a', '1') "+spin+"redis.call('SET', 'b', '1') return 1")
+
+	if err, ok := c.do("SCRIPT", "KILL").(error); !ok || !strings.HasPrefix(err.Error(), "UNKILLABLE") {
+		t.Fatalf("SCRIPT KILL = %v, want UNKILLABLE", err)
+	}
+	if reply := runner.read(); reply != int64(1) {
+		t.Fatalf("EVAL = %v", reply)
+	}
+	if a, b := c.do("GET", "a"), c.do("GET", "b"); a != "1" || b != "1" {
+		t.Fatalf("a = %v, b = %v after the script, want both written", a, b)
+	}
+}
+
+// A script killed before its first write makes no write at all
+func TestScriptKillBeforeWrite(t *testing.T) {
+	_, port := startTestServer(t, func(cfg *Config) {
+		cfg.LuaTimeLimit = 50 * time.Millisecond
+	})
+	runner, c := runBusyScript(t, port, spin+"redis.call('SET', 'a', '1') return 1")
+
+	if reply := c.do("SCRIPT", "KILL"); reply != "OK" {
+		t.Fatalf("SCRIPT KILL = %v", reply)
+	}
+	if err, ok := runner.read().(error); !ok || !strings.Contains(err.Error(), "SCRIPT KILL") {
+		t.Fatalf("EVAL of a killed script = %v", err)
+	}
+	if reply := c.do("GET", "a"); reply != nil {
+		t.Fatalf("a = %v after the script was killed", reply)
+	}
+}
@@ -11,6 +11,7 @@ type SentinelConfig struct {
 	Quorum          int      // Number of sentinels that need to agree for failover
 	DownAfterMillis int      // Milliseconds before marking instance down
 	FailoverTimeout int      // Milliseconds for failover timeout
+	MaxReplicaLag   int64    // Max bytes a replica may lag the master and still be promoted (0 = no limit)
 	MaxConnections  int      // Max client connections
 }
 
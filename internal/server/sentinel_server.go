@@ -66,6 +66,7 @@ func NewSentinelServer(cfg *SentinelConfig) *SentinelServer {
 		Quorum:          cfg.Quorum,
 		DownAfterMillis: cfg.DownAfterMillis,
 		FailoverTimeout: cfg.FailoverTimeout,
+		MaxReplicaLag:   cfg.MaxReplicaLag,
 	}
 
 	sentinelInstance := sentinel.NewSentinel(sentinelConfig)
@@ -676,6 +677,7 @@ func (s *SentinelServer) executeSentinelCommand(cmd *protocol.Command) []byte {
 //
 // Response Format: *3\r\n:<down_state>\r\n$<leader_len>\r\n<leader>\r\n:<epoch>\r\n
 // - down_state: 1 if we voted for requester, 0 if rejected
+// (queries with runid "*" are answered by handleDownStateQuery instead)
 // - leader: Sentinel ID we voted for in this epoch
 // - epoch: Current epoch number
 func (s *SentinelServer) handleVoteRequest(masterHost string, masterPort int, requestEpoch int64, candidateID string) []byte {
@@ -812,10 +814,37 @@ func (s *SentinelServer) handleIsMasterDownByAddr(args []string) []byte {
 
 	candidateID := args[3]
 
+	// runid "*" only asks for our view of the master, not for a vote
+	if candidateID == "*" {
+		return s.handleDownStateQuery(masterHost, masterPort)
+	}
+
 	// Process vote request with epoch-based consensus
 	return s.handleVoteRequest(masterHost, masterPort, epoch, candidateID)
 }
 
+// handleDownStateQuery answers IS-MASTER-DOWN-BY-ADDR with runid "*"
+// Replies with whether we consider the master down plus the leader we voted for
+// and the current epoch, without recording a vote or moving the epoch forward,
+// so periodic down-state gossip never uses up a vote slot
+func (s *SentinelServer) handleDownStateQuery(masterHost string, masterPort int) []byte {
+	downState := 0
+	currentMasterHost, currentMasterPort := s.sentinel.GetMasterAddr()
+	if masterHost == currentMasterHost && masterPort == currentMasterPort && s.isMasterDown() {
+		downState = 1
+	}
+
+	s.votingState.mu.Lock()
+	defer s.votingState.mu.Unlock()
+
+	leader := "*"
+	if s.votingState.votedFor != "" && s.votingState.votedEpoch == s.votingState.currentEpoch {
+		leader = s.votingState.votedFor
+	}
+
+	return s.encodeVoteResponse(downState, leader, s.votingState.currentEpoch)
+}
+
 // handleGetMasterAddrByName returns the master address
 func (s *SentinelServer) handleGetMasterAddrByName(args []string) []byte {
 	if len(args) < 1 {
@@ -842,6 +871,9 @@ func (s *SentinelServer) handleSentinelMasters() []byte {
 		"port", status["master_port"],
 		"status", status["master_status"],
 		"replicas", status["replicas_count"],
+		"num-slaves", status["replicas_count"],
+		"num-in-sync-slaves", status["in_sync_replicas_count"],
+		"master-repl-offset", status["master_offset"],
 		"quorum", s.config.Quorum,
 	}
 
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestServer starts a server on a free local port with persistence
+// confined to a temporary directory; configure adjusts the config first
+func startTestServer(t *testing.T, configure func(cfg *Config)) (*RedisServer, int) {
+	t.Helper()
+
+	cfg := DefaultConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = freePort(t)
+	cfg.PipelineTimeout = time.Millisecond
+	cfg.AOF.Enabled = false
+	cfg.RDBFilepath = filepath.Join(t.TempDir(), "dump.rdb")
+	cfg.RDBSavePoint = RDBSavePoint{}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	s := NewRedisServer(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		s.Shutdown()
+	})
+
+	// Start returns only at shutdown, so wait for the listener
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.Port))
+		if err == nil {
+			conn.Close()
+			return s, cfg.Port
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server on port %d did not start: %v", cfg.Port, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// startInProcessServer starts a server without a network listener; its
+// clients connect over in-memory pipes (see connectTestClient)
+func startInProcessServer(t *testing.T, configure func(cfg *Config)) *InProcessServer {
+	t.Helper()
+
+	cfg := DefaultConfig()
+	cfg.PipelineTimeout = time.Millisecond
+	if configure != nil {
+		configure(cfg)
+	}
+
+	s := NewInProcessServer(cfg)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// waitFor polls cond until it holds or the timeout passes
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// startReplicatedPair starts a master and a replica connected to it
+func startReplicatedPair(t *testing.T) (master, replica *testClient) {
+	t.Helper()
+	_, masterPort := startTestServer(t, nil)
+	_, replicaPort := startTestServer(t, func(cfg *Config) {
+		cfg.ReplicationRole = "replica"
+		cfg.ReplicationMasterHost = "127.0.0.1"
+		cfg.ReplicationMasterPort = masterPort
+	})
+	return dialTestClient(t, masterPort), dialTestClient(t, replicaPort)
+}
+
+// freePort returns a local TCP port that was free a moment ago
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// testClient is a minimal RESP client for driving a test server
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialTestClient connects to a test server; the connection is closed at cleanup
+func dialTestClient(t *testing.T, port int) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// connectTestClient connects to an in-process test server; the connection
+// is closed at cleanup
+func connectTestClient(t *testing.T, s *InProcessServer) *testClient {
+	t.Helper()
+	conn := s.Connect()
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// send writes a command without reading its reply
+func (c *testClient) send(args ...string) {
+	c.t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		c.t.Fatalf("write %v: %v", args, err)
+	}
+}
+
+// do sends a command and returns its reply: a string for simple and bulk
+// strings, int64, nil, []interface{}, or an error for error replies
+func (c *testClient) do(args ...string) interface{} {
+	c.t.Helper()
+	c.send(args...)
+	return c.read()
+}
+
+// read reads one reply
+func (c *testClient) read() interface{} {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := readReply(c.reader)
+	if err != nil {
+		c.t.Fatalf("read reply: %v", err)
+	}
+	return reply
+}
+
+// readReply parses one RESP2 or RESP3 reply
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("short reply line %q", line)
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return fmt.Errorf("%s", line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '_':
+		return nil, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*', '%', '>', '~':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		if line[0] == '%' {
+			n *= 2
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// A set of integers is held as a sorted slice until it gets a member that is
+// not an integer or grows past set-max-intset-entries
+func TestSetEncodingTransition(t *testing.T) {
+	s := startInProcessServer(t, func(cfg *Config) {
+		cfg.SetMaxIntsetEntries = 4
+	})
+	c := connectTestClient(t, s)
+
+	checkEncoding := func(key, want string) {
+		t.Helper()
+		if reply := c.do("OBJECT", "ENCODING", key); reply != want {
+			t.Fatalf("OBJECT ENCODING %s = %v, want %s", key, reply, want)
+		}
+	}
+
+	c.do("SADD", "ints", "3", "-1", "2", "3")
+	checkEncoding("ints", "intset")
+	if reply := c.do("SMEMBERS", "ints"); !sameReply(reply, asReply([]string{"-1", "2", "3"})) {
+		t.Fatalf("SMEMBERS = %v, want the intset in ascending order", reply)
+	}
+	if reply := c.do("SISMEMBER", "ints", "02"); reply != int64(0) {
+		t.Fatalf("SISMEMBER 02 = %v, want 0: only 2 is a member", reply)
+	}
+	if reply := c.do("SREM", "ints", "-1", "7"); reply != int64(1) {
+		t.Fatalf("SREM = %v, want 1", reply)
+	}
+	c.do("SADD", "ints", "1", "4")
+	checkEncoding("ints", "intset")
+	intsetBytes, _ := c.do("MEMORY", "USAGE", "ints").(int64)
+
+	// Past the entry limit
+	c.do("SADD", "ints", "5")
+	checkEncoding("ints", "hashtable")
+	if reply := c.do("SCARD", "ints"); reply != int64(5) {
+		t.Fatalf("SCARD after converting = %v, want 5", reply)
+	}
+
+	// A member that is not an integer, which stays hashtable once removed
+	c.do("SADD", "mixed", "1", "2", "3", "4")
+	c.do("SADD", "mixed", "02")
+	checkEncoding("mixed", "hashtable")
+	c.do("SREM", "mixed", "02")
+	checkEncoding("mixed", "hashtable")
+	if reply, _ := c.do("SINTER", "mixed", "ints").([]interface{}); len(reply) != 4 {
+		t.Fatalf("SINTER = %v, want 1 2 3 4", reply)
+	}
+	if hashtableBytes, _ := c.do("MEMORY", "USAGE", "mixed").(int64); hashtableBytes <= intsetBytes {
+		t.Fatalf("MEMORY USAGE intset %d, hashtable %d: want the intset smaller", intsetBytes, hashtableBytes)
+	}
+}
+
+// SINTERCARD through redis.call counts the intersection, stops at LIMIT,
+// reads a missing key as empty and refuses keys that aren't sets
+func TestScriptSInterCard(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	c.do("SADD", "a", "1", "2", "3", "4", "x")
+	c.do("SADD", "b", "2", "3", "4", "x", "y")
+	c.do("SET", "str", "v")
+
+	sintercard := func(args ...string) interface{} {
+		t.Helper()
+		keys := make([]string, len(args))
+		for i := range args {
+			keys[i] = "ARGV[" + strconv.Itoa(i+1) + "]"
+		}
+		script := "return redis.call('SINTERCARD', " + strings.Join(keys, ", ") + ")"
+		return c.do(append([]string{"EVAL", script, "0"}, args...)...)
+	}
+
+	for _, tc := range []struct {
+		args []string
+		want int64
+	}{
+		{[]string{"2", "a", "b"}, 4},
+		{[]string{"2", "a", "b", "LIMIT", "2"}, 2},
+		{[]string{"2", "a", "b", "LIMIT", "10"}, 4},
+		{[]string{"2", "a", "b", "LIMIT", "0"}, 4},
+		{[]string{"1", "a"}, 5},
+		{[]string{"2", "a", "missing"}, 0},
+		{[]string{"3", "missing", "a", "b"}, 0},
+	} {
+		if reply := sintercard(tc.args...); reply != tc.want {
+			t.Fatalf("SINTERCARD %v = %v, want %d", tc.args, reply, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"2", "a", "str"}, "WRONGTYPE"},
+		{[]string{"2", "missing", "str"}, "WRONGTYPE"},
+		{[]string{"2", "a", "b", "LIMIT", "-1"}, "LIMIT can't be negative"},
+		{[]string{"2", "a", "b", "LIMIT", "abc"}, "LIMIT can't be negative"},
+		{[]string{"2", "a", "b", "COUNT", "1"}, "syntax error"},
+		{[]string{"0", "a"}, "numkeys should be greater than 0"},
+	} {
+		err, ok := sintercard(tc.args...).(error)
+		if !ok || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("SINTERCARD %v = %v, want an error with %q", tc.args, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// Reads of a sliding key are propagated only when they push the deadline
+// past the one last propagated, and always with their window
+func TestSlidingTTLReadsLoggedSparingly(t *testing.T) {
+	s, port := startAOFServer(t, nil)
+	c := dialTestClient(t, port)
+
+	c.do("SET", "k", "v")
+	start := time.Now()
+	if reply := c.do("EXPIRE", "k", "100", "SLIDING"); reply != int64(1) {
+		t.Fatalf("EXPIRE SLIDING: %v", reply)
+	}
+	for i := 0; i < 50; i++ {
+		if reply := c.do("GET", "k"); reply != "v" {
+			t.Fatalf("GET: %v", reply)
+		}
+	}
+
+	logged := loggedCommands(t, s, "EXPIRE", "PEXPIREAT")
+	if len(logged) != 2 {
+		t.Fatalf("logged %v, want the EXPIRE and one refresh", logged)
+	}
+	for i, want := range []time.Duration{100 * time.Second, 150 * time.Second} {
+		args := logged[i]
+		if len(args) != 5 || args[0] != "PEXPIREAT" || args[3] != "SLIDING" || args[4] != "100000" {
+			t.Fatalf("logged %v, want PEXPIREAT k <ms> SLIDING 100000", args)
+		}
+		checkDeadline(t, "k", args[2], start.Add(want))
+	}
+}
+
+// The window survives an AOF rewrite, DEBUG RELOAD and DUMP/RESTORE
+func TestSlidingTTLPersisted(t *testing.T) {
+	s, port := startAOFServer(t, nil)
+	c := dialTestClient(t, port)
+
+	c.do("SET", "k", "v")
+	c.do("EXPIRE", "k", "100", "SLIDING")
+
+	rewriteAOF(t, c)
+	rewritten := loggedCommands(t, s, "PEXPIREAT")
+	if len(rewritten) != 1 || len(rewritten[0]) != 5 || rewritten[0][3] != "SLIDING" || rewritten[0][4] != "100000" {
+		t.Fatalf("rewritten AOF has %v, want PEXPIREAT k <ms> SLIDING 100000", rewritten)
+	}
+
+	if reply := c.do("DEBUG", "RELOAD"); reply != "OK" {
+		t.Fatalf("DEBUG RELOAD: %v", reply)
+	}
+	payload, ok := c.do("DUMP", "k").(string)
+	if !ok {
+		t.Fatalf("DUMP did not return a payload")
+	}
+	if reply := c.do("RESTORE", "copy", "100000", payload); reply != "OK" {
+		t.Fatalf("RESTORE: %v", reply)
+	}
+
+	// A sliding key read after a second is back to its full window; TTL
+	// rounds down, so that is 99 against at most 98 before the read
+	time.Sleep(1100 * time.Millisecond)
+	for _, key := range []string{"k", "copy"} {
+		if ttl, _ := c.do("TTL", key).(int64); ttl > 98 {
+			t.Fatalf("TTL %s before GET = %d, want at most 98", key, ttl)
+		}
+		c.do("GET", key)
+		if ttl := c.do("TTL", key); ttl != int64(99) {
+			t.Fatalf("TTL %s after GET = %v, want 99: the window was lost", key, ttl)
+		}
+	}
+}
+
+// EXPIRE refuses TTLs whose duration would overflow, with or without
+// SLIDING, instead of expiring the key at once, and takes whole integers only
+func TestExpireRejectsOverflowingTTL(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+	c.do("SET", "k", "v")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"EXPIRE", "k", "9223372037"}, "ERR invalid expire time in 'expire' command"},
+		{[]string{"EXPIRE", "k", "9223372037", "SLIDING"}, "ERR invalid expire time in 'expire' command"},
+		{[]string{"EXPIRE", "k", "0"}, "ERR invalid expire time in 'expire' command"},
+		{[]string{"EXPIRE", "k", "10abc"}, "ERR value is not an integer or out of range"},
+	}
+	for _, tt := range tests {
+		if err, ok := c.do(tt.args...).(error); !ok || err.Error() != tt.want {
+			t.Errorf("%v = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+
+	if reply := c.do("GET", "k"); reply != "v" {
+		t.Fatalf("GET k = %v after the rejected EXPIREs", reply)
+	}
+	if reply := c.do("EXPIRE", "k", "9223372036", "SLIDING"); reply != int64(1) {
+		t.Fatalf("EXPIRE with the largest TTL = %v", reply)
+	}
+	if reply := c.do("GET", "k"); reply != "v" {
+		t.Fatalf("GET k = %v after EXPIRE with the largest TTL", reply)
+	}
+}
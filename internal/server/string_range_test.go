@@ -0,0 +1,137 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+// APPEND, SETRANGE, GETRANGE and STRLEN count bytes, so values with embedded
+// NULs and invalid UTF-8 round-trip unchanged
+func TestStringRangeBinaryValues(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	bin := "a\x00b\xff\xfe"
+	c.do("SET", "k", bin)
+	if got := c.do("STRLEN", "k"); got != int64(5) {
+		t.Fatalf("STRLEN = %v, want 5", got)
+	}
+	if got := c.do("APPEND", "k", "\x00\xc3"); got != int64(7) {
+		t.Fatalf("APPEND = %v, want 7", got)
+	}
+	if got := c.do("GET", "k"); got != bin+"\x00\xc3" {
+		t.Fatalf("GET = %q, want %q", got, bin+"\x00\xc3")
+	}
+
+	for _, tc := range []struct {
+		start, end string
+		want       string
+	}{
+		{"1", "3", "\x00b\xff"},
+		{"-2", "-1", "\x00\xc3"},
+		{"0", "100", bin + "\x00\xc3"},
+		{"5", "2", ""},
+	} {
+		if got := c.do("GETRANGE", "k", tc.start, tc.end); got != tc.want {
+			t.Fatalf("GETRANGE k %s %s = %q, want %q", tc.start, tc.end, got, tc.want)
+		}
+	}
+
+	if got := c.do("SETRANGE", "k", "1", "\xc0"); got != int64(7) {
+		t.Fatalf("SETRANGE inside the value = %v, want 7", got)
+	}
+	if got := c.do("GET", "k"); got != "a\xc0b\xff\xfe\x00\xc3" {
+		t.Fatalf("GET after SETRANGE = %q", got)
+	}
+}
+
+// SETRANGE past the end pads with zero bytes, and an empty value never
+// creates a key
+func TestSetRangePadsWithZeroBytes(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	if got := c.do("SETRANGE", "pad", "3", "\xff\x00"); got != int64(5) {
+		t.Fatalf("SETRANGE on a missing key = %v, want 5", got)
+	}
+	if got := c.do("GET", "pad"); got != "\x00\x00\x00\xff\x00" {
+		t.Fatalf("GET = %q, want 3 zero bytes then \\xff\\x00", got)
+	}
+	if got := c.do("SETRANGE", "pad", "7", "z"); got != int64(8) {
+		t.Fatalf("SETRANGE past the end = %v, want 8", got)
+	}
+	if got := c.do("GET", "pad"); got != "\x00\x00\x00\xff\x00\x00\x00z" {
+		t.Fatalf("GET = %q after padding an existing value", got)
+	}
+
+	if got := c.do("SETRANGE", "none", "5", ""); got != int64(0) {
+		t.Fatalf("SETRANGE with an empty value = %v, want 0", got)
+	}
+	if got := c.do("EXISTS", "none"); got != int64(0) {
+		t.Fatalf("EXISTS after an empty SETRANGE = %v, want 0", got)
+	}
+}
+
+// Offsets that are negative or would grow the string past 512MB are refused
+// without touching the value
+func TestSetRangeRejectsBadOffsets(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	c.do("SET", "k", "v")
+	for _, tc := range []struct {
+		offset string
+		want   string
+	}{
+		{"-1", "ERR offset is out of range"},
+		{"536870912", "ERR string exceeds maximum allowed size"},
+		{"9223372036854775807", "ERR string exceeds maximum allowed size"},
+		{"abc", "ERR value is not an integer or out of range"},
+	} {
+		err, ok := c.do("SETRANGE", "k", tc.offset, "x").(error)
+		if !ok || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Fatalf("SETRANGE k %s = %v, want %q", tc.offset, err, tc.want)
+		}
+	}
+	if got := c.do("GET", "k"); got != "v" {
+		t.Fatalf("GET after refused SETRANGEs = %q, want v", got)
+	}
+}
+
+// APPEND and SETRANGE modify the value in place, so the key keeps its TTL
+func TestStringRangeKeepsTTL(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	c.do("SET", "k", "v", "EX", "100")
+	c.do("APPEND", "k", "\x00")
+	c.do("SETRANGE", "k", "4", "\xff")
+	if ttl, ok := c.do("TTL", "k").(int64); !ok || ttl < 95 || ttl > 100 {
+		t.Fatalf("TTL after APPEND and SETRANGE = %v, want 95..100", ttl)
+	}
+	if got := c.do("GET", "k"); got != "v\x00\x00\x00\xff" {
+		t.Fatalf("GET = %q", got)
+	}
+}
+
+// The byte range commands refuse keys that don't hold a string
+func TestStringRangeWrongType(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+
+	c.do("RPUSH", "list", "a")
+	for _, args := range [][]string{
+		{"APPEND", "list", "x"},
+		{"SETRANGE", "list", "0", "x"},
+		{"GETRANGE", "list", "0", "-1"},
+		{"STRLEN", "list"},
+	} {
+		err, ok := c.do(args...).(error)
+		if !ok || !strings.HasPrefix(err.Error(), "WRONGTYPE") {
+			t.Fatalf("%v = %v, want WRONGTYPE", args, err)
+		}
+	}
+	if got := c.do("LRANGE", "list", "0", "-1"); !sameReply(got, []interface{}{"a"}) {
+		t.Fatalf("LRANGE after the refused writes = %v, want [a]", got)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTracker connects a RESP3 client tracking the keys it reads
+func startTracker(t *testing.T, s *InProcessServer) *testClient {
+	t.Helper()
+	c := connectTestClient(t, s)
+	c.do("HELLO", "3")
+	if reply := c.do("CLIENT", "TRACKING", "ON"); reply != "OK" {
+		t.Fatalf("CLIENT TRACKING ON: %v", reply)
+	}
+	return c
+}
+
+// A script invalidates the keys it writes, including ones it did not
+// declare, and not the declared keys it only reads
+func TestScriptWritesInvalidated(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	tracker := startTracker(t, s)
+	c := connectTestClient(t, s)
+	c.do("SET", "declared", "1")
+	c.do("SET", "written", "1")
+
+	tracker.do("GET", "declared")
+	tracker.do("GET", "written")
+	script := "redis.call('GET', KEYS[1]) redis.call('SET', 'written', '2') return 1"
+	if reply := c.do("EVAL", script, "1", "declared"); reply != int64(1) {
+		t.Fatalf("EVAL: %v", reply)
+	}
+
+	push := tracker.read()
+	if !sameReply(push, []interface{}{"invalidate", []interface{}{"written"}}) {
+		t.Fatalf("push after the script = %v, want an invalidation of written only", push)
+	}
+	if reply := tracker.do("GET", "written"); reply != "2" {
+		t.Fatalf("GET written = %v after the invalidation", reply)
+	}
+}
+
+// An invalidation is written between two replies, never inside one, however
+// the replies of a pipeline are split across writes
+func TestInvalidationBetweenPipelinedReplies(t *testing.T) {
+	s := startInProcessServer(t, func(cfg *Config) {
+		cfg.WriteBufferSize = 4096
+		cfg.PipelineMaxPendingBytes = 4096
+	})
+	big := strings.Repeat("b", 10000)
+	s.Do("SET", "big", big)
+	s.Do("SET", "k", "v")
+	tracker := startTracker(t, s)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		writer := connectTestClient(t, s)
+		writer.conn.SetDeadline(time.Now().Add(10 * time.Second))
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			writer.send("SET", "k", "v")
+			if _, err := readReply(writer.reader); err != nil {
+				return
+			}
+		}
+	}()
+
+	const rounds = 200
+	var batch strings.Builder
+	for i := 0; i < rounds; i++ {
+		batch.WriteString("*2\r\n$3\r\nGET\r\n$1\r\nk\r\n*2\r\n$3\r\nGET\r\n$3\r\nbig\r\n")
+	}
+	go tracker.conn.Write([]byte(batch.String()))
+
+	invalidation := []interface{}{"invalidate", []interface{}{"k"}}
+	for replies := 0; replies < 2*rounds; {
+		switch reply := tracker.read().(type) {
+		case []interface{}:
+			if !sameReply(reply, invalidation) {
+				t.Fatalf("push = %v", reply)
+			}
+		case string:
+			if want := map[bool]string{true: "v", false: big}[replies%2 == 0]; reply != want {
+				t.Fatalf("reply %d is %d bytes, want %d: a push was written inside it", replies, len(reply), len(want))
+			}
+			replies++
+		default:
+			t.Fatalf("reply %d = %v", replies, reply)
+		}
+	}
+
+	// The writer keeps invalidating the k read last, so one more arrives
+	if push := tracker.read(); !sameReply(push, invalidation) {
+		t.Fatalf("push after the pipeline = %v", push)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// fillerReads sit between the two reads of a pair to widen the window for a
+// write to land in between
+const fillerReads = 20
+
+// incrementPairs pipelines rounds of MULTI / INCR a / INCR b / EXEC on c and
+// returns a channel that delivers nil, or the first failure, once all replied
+func incrementPairs(c *testClient, rounds int) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < rounds; i++ {
+			c.send("MULTI")
+			c.send("INCR", "a")
+			c.send("INCR", "b")
+			c.send("EXEC")
+		}
+		c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		for i := 0; i < rounds*4; i++ {
+			if _, err := readReply(c.reader); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	return done
+}
+
+// readPairsUntil reads a and b in one read-only transaction on c until done
+// delivers, failing if a transaction ever sees them differ
+func readPairsUntil(t *testing.T, c *testClient, done <-chan error) {
+	t.Helper()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("writer: %v", err)
+			}
+			return
+		default:
+		}
+
+		c.send("MULTI")
+		c.send("GET", "a")
+		for i := 0; i < fillerReads; i++ {
+			c.send("EXISTS", "a")
+		}
+		c.send("GET", "b")
+		c.send("EXEC")
+		for i := 0; i < fillerReads+3; i++ {
+			c.read()
+		}
+		reply, ok := c.read().([]interface{})
+		if !ok || len(reply) != fillerReads+2 {
+			t.Fatalf("EXEC reply = %v", reply)
+		}
+		if a, b := reply[0], reply[fillerReads+1]; a != b {
+			t.Fatalf("transaction read a=%v b=%v, half of another transaction", a, b)
+		}
+	}
+}
+
+// A read-only transaction sees no write from another client between its
+// reads, so it never observes half of a concurrent transaction
+func TestReadOnlyTransactionConsistent(t *testing.T) {
+	_, port := startTestServer(t, nil)
+	writer, reader := dialTestClient(t, port), dialTestClient(t, port)
+
+	const rounds = 300
+	readPairsUntil(t, reader, incrementPairs(writer, rounds))
+
+	if reply := reader.do("GET", "b"); reply != "300" {
+		t.Fatalf("GET b = %v, want 300", reply)
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+)
+
+// listenUnix opens the UNIX domain socket listener configured with
+// unixsocket, applying unixsocketperm to the socket file
+// A socket file left behind by a server that did not shut down cleanly is
+// removed first; any other file at the path is an error rather than replaced
+func (s *RedisServer) listenUnix() (net.Listener, error) {
+	path := s.config.UnixSocket
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("unixsocket %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale unixsocket %s: %w", path, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on unixsocket %s: %w", path, err)
+	}
+
+	if s.config.UnixSocketPerm != 0 {
+		if err := os.Chmod(path, s.config.UnixSocketPerm); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to set unixsocketperm %o on %s: %w", s.config.UnixSocketPerm, path, err)
+		}
+	}
+
+	log.Printf("Redis server listening on unix socket %s", path)
+	return listener, nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// WAIT blocks for its own timeout, however short the command timeout is
+func TestWaitOutlastsCommandTimeout(t *testing.T) {
+	_, port := startTestServer(t, func(cfg *Config) {
+		cfg.CommandTimeout = 50 * time.Millisecond
+	})
+	c := dialTestClient(t, port)
+
+	start := time.Now()
+	if reply := c.do("WAIT", "1", "300"); reply != int64(0) {
+		t.Fatalf("WAIT without replicas = %v, want 0", reply)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Fatalf("WAIT returned after %v, before its 300ms timeout", elapsed)
+	}
+}
+
+// WAIT counts a replica once it acknowledged the writes made before it
+func TestWaitCountsAcknowledgedReplicas(t *testing.T) {
+	master, replica := startReplicatedPair(t)
+	master.do("SET", "k", "0")
+	waitFor(t, 5*time.Second, "the replica to sync", func() bool {
+		return replica.do("GET", "k") == "0"
+	})
+
+	master.do("SET", "k", "1")
+	if reply := master.do("WAIT", "1", "5000"); reply != int64(1) {
+		t.Fatalf("WAIT 1 = %v, want 1", reply)
+	}
+	if reply := replica.do("GET", "k"); reply != "1" {
+		t.Fatalf("replica has k = %v after WAIT", reply)
+	}
+}
+
+// WAITOFFSET on a replica blocks for its own timeout too, and then replies
+// with the offset applied so far
+func TestWaitOffsetOutlastsCommandTimeout(t *testing.T) {
+	_, masterPort := startTestServer(t, nil)
+	_, replicaPort := startTestServer(t, func(cfg *Config) {
+		cfg.CommandTimeout = 50 * time.Millisecond
+		cfg.ReplicationRole = "replica"
+		cfg.ReplicationMasterHost = "127.0.0.1"
+		cfg.ReplicationMasterPort = masterPort
+	})
+	replica := dialTestClient(t, replicaPort)
+
+	start := time.Now()
+	reply, ok := replica.do("WAITOFFSET", "1000000000", "300").(int64)
+	if !ok || reply >= 1000000000 {
+		t.Fatalf("WAITOFFSET past the stream = %v, want the applied offset", reply)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Fatalf("WAITOFFSET returned after %v, before its 300ms timeout", elapsed)
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"testing"
+)
+
+// NaN is not a valid score or score bound, so it never enters a sorted set
+func TestZSetRejectsNaN(t *testing.T) {
+	s := startInProcessServer(t, nil)
+	c := connectTestClient(t, s)
+	c.do("ZADD", "z", "1", "a")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ZADD", "z", "nan", "b"}, "ERR value is not a valid float"},
+		{[]string{"ZADD", "z", "INCR", "NaN", "a"}, "ERR value is not a valid float"},
+		{[]string{"ZINCRBY", "z", "nan", "a"}, "ERR value is not a valid float"},
+		{[]string{"ZRANGEBYSCORE", "z", "nan", "1"}, "ERR min or max is not a float"},
+		{[]string{"ZREVRANGEBYSCORE", "z", "1", "nan"}, "ERR min or max is not a float"},
+		{[]string{"ZCOUNT", "z", "-inf", "nan"}, "ERR min or max is not a float"},
+		{[]string{"ZREMRANGEBYSCORE", "z", "nan", "nan"}, "ERR min or max is not a float"},
+	}
+	for _, tt := range tests {
+		if err, ok := c.do(tt.args...).(error); !ok || err.Error() != tt.want {
+			t.Errorf("%v = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+
+	if reply := c.do("ZRANGE", "z", "0", "-1", "WITHSCORES"); !sameReply(reply, []interface{}{"a", "1"}) {
+		t.Fatalf("ZRANGE after the rejected commands = %v", reply)
+	}
+}
@@ -55,10 +55,10 @@ func (s *Store) SetBit(key string, offset int64, value int) (int, error) {
 	}
 
 	// Save back to storage
-	s.data[key] = &Value{
+	s.putData(key, &Value{
 		Data: string(bytes),
 		Type: StringType,
-	}
+	})
 
 	return oldBit, nil
 }
@@ -93,8 +93,8 @@ func (s *Store) GetBit(key string, offset int64) (int, error) {
 }
 
 // BitCount returns the number of bits set to 1 in the string
-// Optional start and end parameters specify byte range (not bit range)
-func (s *Store) BitCount(key string, start, end *int64) (int64, error) {
+// Optional start and end parameters specify a byte range, or a bit range when bitUnit is set
+func (s *Store) BitCount(key string, start, end *int64, bitUnit bool) (int64, error) {
 	str, err := s.getString(key)
 	if err == ErrKeyNotFound {
 		return 0, nil
@@ -102,52 +102,34 @@ func (s *Store) BitCount(key string, start, end *int64) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	strLen := int64(len(str))
 
-	if strLen == 0 {
+	if len(str) == 0 {
 		return 0, nil
 	}
 
-	// Determine byte range
-	startByte := int64(0)
-	endByte := strLen - 1
-
-	if start != nil {
-		startByte = *start
-		if startByte < 0 {
-			startByte = strLen + startByte
-		}
-		if startByte < 0 {
-			startByte = 0
-		}
-	}
-
-	if end != nil {
-		endByte = *end
-		if endByte < 0 {
-			endByte = strLen + endByte
-		}
-		if endByte >= strLen {
-			endByte = strLen - 1
-		}
-	}
-
-	if startByte > endByte || startByte >= strLen {
+	startBit, endBit, ok := bitRange(int64(len(str)), start, end, bitUnit)
+	if !ok {
 		return 0, nil
 	}
 
-	// Count bits in the specified range
+	// Count bits in the specified range, a whole byte at a time where aligned
 	count := int64(0)
-	for i := startByte; i <= endByte; i++ {
-		count += int64(bits.OnesCount8(uint8(str[i])))
+	for i := startBit; i <= endBit; {
+		if i%8 == 0 && i+7 <= endBit {
+			count += int64(bits.OnesCount8(uint8(str[i/8])))
+			i += 8
+			continue
+		}
+		count += int64(bitAt(str, i))
+		i++
 	}
 
 	return count, nil
 }
 
 // BitPos returns the position of the first bit set to 1 or 0 in the string
-// Optional start and end parameters specify byte range
-func (s *Store) BitPos(key string, bit int, start, end *int64) (int64, error) {
+// Optional start and end parameters specify a byte range, or a bit range when bitUnit is set
+func (s *Store) BitPos(key string, bit int, start, end *int64, bitUnit bool) (int64, error) {
 	if bit != 0 && bit != 1 {
 		return 0, ErrInvalidOperation
 	}
@@ -164,58 +146,75 @@ func (s *Store) BitPos(key string, bit int, start, end *int64) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	strLen := int64(len(str))
 
-	if strLen == 0 {
+	if len(str) == 0 {
 		if bit == 0 {
 			return 0, nil
 		}
 		return -1, nil
 	}
 
-	// Determine byte range
-	startByte := int64(0)
-	endByte := strLen - 1
+	startBit, endBit, ok := bitRange(int64(len(str)), start, end, bitUnit)
+	if !ok {
+		return -1, nil
+	}
+
+	// Search for the bit
+	for i := startBit; i <= endBit; i++ {
+		if bitAt(str, i) == bit {
+			return i, nil
+		}
+	}
+
+	// Bit not found in range
+	return -1, nil
+}
+
+// bitRange resolves BITCOUNT/BITPOS start and end arguments into an inclusive bit range
+// Indices are bytes unless bitUnit is set; negative indices count from the end.
+// ok is false when the range is empty
+func bitRange(strLen int64, start, end *int64, bitUnit bool) (startBit, endBit int64, ok bool) {
+	length := strLen
+	if bitUnit {
+		length = strLen * 8
+	}
+
+	first := int64(0)
+	last := length - 1
 
 	if start != nil {
-		startByte = *start
-		if startByte < 0 {
-			startByte = strLen + startByte
+		first = *start
+		if first < 0 {
+			first = length + first
 		}
-		if startByte < 0 {
-			startByte = 0
+		if first < 0 {
+			first = 0
 		}
 	}
 
 	if end != nil {
-		endByte = *end
-		if endByte < 0 {
-			endByte = strLen + endByte
+		last = *end
+		if last < 0 {
+			last = length + last
 		}
-		if endByte >= strLen {
-			endByte = strLen - 1
+		if last >= length {
+			last = length - 1
 		}
 	}
 
-	if startByte > endByte || startByte >= strLen {
-		return -1, nil
+	if first > last || first >= length {
+		return 0, 0, false
 	}
 
-	// Search for the bit
-	for i := startByte; i <= endByte; i++ {
-		currentByte := uint8(str[i])
-
-		// Check each bit in the byte
-		for bitOffset := uint(0); bitOffset < 8; bitOffset++ {
-			bitValue := int((currentByte >> (7 - bitOffset)) & 1)
-			if bitValue == bit {
-				return i*8 + int64(bitOffset), nil
-			}
-		}
+	if bitUnit {
+		return first, last, true
 	}
+	return first * 8, last*8 + 7, true
+}
 
-	// Bit not found in range
-	return -1, nil
+// bitAt returns the bit at position pos, counting from the most significant bit of the first byte
+func bitAt(str string, pos int64) int {
+	return int((str[pos/8] >> (7 - uint(pos%8))) & 1)
 }
 
 // BitOpAnd performs bitwise AND between multiple keys and stores result in destkey
@@ -238,10 +237,10 @@ func (s *Store) BitOpNot(destKey string, srcKey string) (int64, error) {
 	str, err := s.getString(srcKey)
 	if err == ErrKeyNotFound {
 		// NOT of empty string is empty string
-		s.data[destKey] = &Value{
+		s.putData(destKey, &Value{
 			Data: "",
 			Type: StringType,
-		}
+		})
 		return 0, nil
 	}
 	if err != nil {
@@ -253,10 +252,10 @@ func (s *Store) BitOpNot(destKey string, srcKey string) (int64, error) {
 		result[i] = ^str[i]
 	}
 
-	s.data[destKey] = &Value{
+	s.putData(destKey, &Value{
 		Data: string(result),
 		Type: StringType,
-	}
+	})
 
 	return int64(len(result)), nil
 }
@@ -265,14 +264,14 @@ func (s *Store) BitOpNot(destKey string, srcKey string) (int64, error) {
 
 // getString retrieves a string value from storage with expiry and type checking
 func (s *Store) getString(key string) (string, error) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
 		return "", ErrKeyNotFound
 	}
 
 	// Check expiry
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return "", ErrKeyNotFound
 	}
 
@@ -280,7 +279,8 @@ func (s *Store) getString(key string) (string, error) {
 		return "", ErrWrongType
 	}
 
-	return val.Data.(string), nil
+	str, _ := val.StringValue()
+	return str, nil
 }
 
 // bitOperation performs a bitwise operation between multiple keys
@@ -311,10 +311,10 @@ func (s *Store) bitOperation(destKey string, srcKeys []string, op func(byte, byt
 
 	// If all sources are empty, result is empty
 	if maxLen == 0 {
-		s.data[destKey] = &Value{
+		s.putData(destKey, &Value{
 			Data: "",
 			Type: StringType,
-		}
+		})
 		return 0, nil
 	}
 
@@ -343,10 +343,10 @@ func (s *Store) bitOperation(destKey string, srcKeys []string, op func(byte, byt
 		}
 	}
 
-	s.data[destKey] = &Value{
+	s.putData(destKey, &Value{
 		Data: string(result),
 		Type: StringType,
-	}
+	})
 
 	return int64(len(result)), nil
 }
@@ -1,14 +1,49 @@
 package storage
 
 import (
+	"errors"
 	"hash/fnv"
 	"math"
+	"math/bits"
 	"time"
 )
 
+// Defaults for filters created implicitly by BF.INSERT (same as RedisBloom)
+const (
+	DefaultBloomCapacity  = 100
+	DefaultBloomErrorRate = 0.01
+	DefaultBloomExpansion = 2
+)
+
+// Limits on filter sizes; bits are allocated up front, so the handlers
+// refuse larger values and a scaling filter stops growing at MaxBloomCapacity
+const (
+	MaxBloomCapacity  = 1 << 30 // Items per sub-filter
+	MaxBloomExpansion = 1 << 15 // Capacity growth factor
+)
+
+// bloomTighteningRatio scales the error rate of each new sub-filter, so the
+// compound false positive rate of a scaling filter stays bounded
+const bloomTighteningRatio = 0.5
+
+// ErrBloomFull is returned when a non-scaling filter reached its capacity
+var ErrBloomFull = errors.New("ERR non scaling filter is full")
+
+// ErrBloomMaxExpansion is returned when the next sub-filter of a scaling
+// filter would exceed MaxBloomCapacity
+var ErrBloomMaxExpansion = errors.New("ERR Maximum expansions reached")
+
 // BloomFilter represents a probabilistic data structure for set membership testing
+// It is a chain of fixed-size sub-filters: once the newest one holds its
+// capacity, a scaling filter appends a sub-filter expansion times larger
 // Note: No locking needed - all operations execute sequentially in the single processor goroutine
 type BloomFilter struct {
+	layers    []*bloomLayer // Sub-filters, oldest first; items are added to the last one
+	expansion uint32        // Capacity growth factor of new sub-filters (0 = non-scaling)
+}
+
+// bloomLayer is one fixed-size Bloom filter of the chain
+type bloomLayer struct {
 	bits      []uint64 // Bit array stored as uint64 slices for efficiency
 	size      uint64   // Size of bit array (m)
 	numHashes uint32   // Number of hash functions (k)
@@ -20,11 +55,15 @@ type BloomFilter struct {
 // BloomFilterInfo contains information about a Bloom filter
 type BloomFilterInfo struct {
 	Capacity    uint64
-	Size        uint64
+	Size        uint64 // Bits in the bit array (m)
+	Bytes       int64  // Memory used by the filter, bit array included
+	NumFilters  int    // Sub-filters making up the filter
+	Expansion   int    // Capacity growth factor of a scaling filter (0 = non-scaling)
 	NumHashes   uint32
 	Count       uint64
 	ErrorRate   float64
 	BitsPerItem float64
+	FillRatio   float64 // Fraction of bits set; false positives rise quickly past ~0.5
 }
 
 // ==================== BLOOM FILTER CREATION ====================
@@ -60,8 +99,17 @@ func calculateOptimalParams(capacity uint64, errorRate float64) (size uint64, nu
 	return size, numHashes
 }
 
-// newBloomFilter creates a new Bloom filter with specified parameters
-func newBloomFilter(capacity uint64, errorRate float64) *BloomFilter {
+// newBloomFilter creates a new Bloom filter with a single sub-filter
+// expansion is the capacity growth factor of later sub-filters (0 = non-scaling)
+func newBloomFilter(capacity uint64, errorRate float64, expansion uint32) *BloomFilter {
+	return &BloomFilter{
+		layers:    []*bloomLayer{newBloomLayer(capacity, errorRate)},
+		expansion: expansion,
+	}
+}
+
+// newBloomLayer creates a fixed-size Bloom filter with specified parameters
+func newBloomLayer(capacity uint64, errorRate float64) *bloomLayer {
 	if capacity == 0 {
 		capacity = 100 // Default capacity
 	}
@@ -75,7 +123,7 @@ func newBloomFilter(capacity uint64, errorRate float64) *BloomFilter {
 	// size is already a multiple of 64 from calculateOptimalParams
 	numElements := size / 64
 
-	return &BloomFilter{
+	return &bloomLayer{
 		bits:      make([]uint64, numElements),
 		size:      size,
 		numHashes: numHashes,
@@ -85,11 +133,75 @@ func newBloomFilter(capacity uint64, errorRate float64) *BloomFilter {
 	}
 }
 
+// Clone creates a deep copy of the Bloom filter
+func (bf *BloomFilter) Clone() *BloomFilter {
+	clone := &BloomFilter{
+		layers:    make([]*bloomLayer, len(bf.layers)),
+		expansion: bf.expansion,
+	}
+	for i, layer := range bf.layers {
+		layerClone := *layer
+		layerClone.bits = make([]uint64, len(layer.bits))
+		copy(layerClone.bits, layer.bits)
+		clone.layers[i] = &layerClone
+	}
+	return clone
+}
+
+// mightContain reports whether any sub-filter may hold item
+func (bf *BloomFilter) mightContain(item string) bool {
+	for _, layer := range bf.layers {
+		if layer.mightContain(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// add inserts item into the newest sub-filter, first appending a larger one
+// if the newest is full
+// Returns false if the item probably existed already, ErrBloomFull if a
+// non-scaling filter has no room left, ErrBloomMaxExpansion if the next
+// sub-filter would be too large
+func (bf *BloomFilter) add(item string) (bool, error) {
+	if bf.mightContain(item) {
+		return false, nil
+	}
+
+	last := bf.layers[len(bf.layers)-1]
+	if last.count >= last.capacity {
+		if bf.expansion == 0 {
+			return false, ErrBloomFull
+		}
+		// Checked by division so the multiplication below can't overflow
+		if last.capacity > MaxBloomCapacity/uint64(bf.expansion) {
+			return false, ErrBloomMaxExpansion
+		}
+		last = newBloomLayer(last.capacity*uint64(bf.expansion), last.errorRate*bloomTighteningRatio)
+		bf.layers = append(bf.layers, last)
+	}
+
+	for _, hash := range last.hash(item) {
+		last.setBit(hash)
+	}
+	last.count++
+	return true, nil
+}
+
+// count returns the approximate number of items added across all sub-filters
+func (bf *BloomFilter) count() uint64 {
+	total := uint64(0)
+	for _, layer := range bf.layers {
+		total += layer.count
+	}
+	return total
+}
+
 // ==================== HASH FUNCTIONS ====================
 
 // hash generates k different hash values for the given key
 // Uses FNV-1a hash with different seeds for each hash function
-func (bf *BloomFilter) hash(key string) []uint64 {
+func (bf *bloomLayer) hash(key string) []uint64 {
 	hashes := make([]uint64, bf.numHashes)
 
 	// Primary hash
@@ -115,38 +227,74 @@ func (bf *BloomFilter) hash(key string) []uint64 {
 // ==================== BIT OPERATIONS ====================
 
 // setBit sets the bit at the specified position to 1
-func (bf *BloomFilter) setBit(position uint64) {
+func (bf *bloomLayer) setBit(position uint64) {
 	index := position / 64
 	offset := position % 64
 	bf.bits[index] |= (1 << offset)
 }
 
 // getBit returns the value of the bit at the specified position
-func (bf *BloomFilter) getBit(position uint64) bool {
+func (bf *bloomLayer) getBit(position uint64) bool {
 	index := position / 64
 	offset := position % 64
 	return (bf.bits[index] & (1 << offset)) != 0
 }
 
+// mightContain reports whether every bit of item is set
+func (bf *bloomLayer) mightContain(item string) bool {
+	for _, hash := range bf.hash(item) {
+		if !bf.getBit(hash) {
+			return false // Definitely not in this sub-filter
+		}
+	}
+	return true
+}
+
 // ==================== BLOOM FILTER OPERATIONS ====================
 
 // BFReserve creates a new Bloom filter with specified error rate and capacity
-func (s *Store) BFReserve(key string, errorRate float64, capacity uint64) error {
+// expansion is the capacity growth factor of sub-filters added once the
+// filter is full (0 = non-scaling)
+func (s *Store) BFReserve(key string, errorRate float64, capacity uint64, expansion uint32) error {
 	// Check if key already exists
-	if _, exists := s.data[key]; exists {
+	if _, exists := s.lookup(key); exists {
 		return ErrInvalidOperation
 	}
 
-	bf := newBloomFilter(capacity, errorRate)
+	bf := newBloomFilter(capacity, errorRate, expansion)
 
-	s.data[key] = &Value{
+	s.putData(key, &Value{
 		Data: bf,
 		Type: BloomFilterType,
-	}
+	})
 
 	return nil
 }
 
+// BloomInsertOptions holds the creation options of BF.INSERT
+// They only apply when the filter does not exist yet
+type BloomInsertOptions struct {
+	Capacity  uint64
+	ErrorRate float64
+	Expansion uint32 // 0 = non-scaling
+	NoCreate  bool   // Fail instead of creating a missing filter
+}
+
+// BFInsert adds items to the Bloom filter at key, creating it with opts
+// unless it exists or opts.NoCreate is set
+// Returns a slice of booleans indicating which items were newly added
+func (s *Store) BFInsert(key string, opts BloomInsertOptions, items []string) ([]bool, error) {
+	if _, err := s.getBloomFilter(key); err == ErrKeyNotFound {
+		if opts.NoCreate {
+			return nil, ErrKeyNotFound
+		}
+		if err := s.BFReserve(key, opts.ErrorRate, opts.Capacity, opts.Expansion); err != nil {
+			return nil, err
+		}
+	}
+	return s.BFMAdd(key, items)
+}
+
 // BFAdd adds an item to the Bloom filter
 // Returns true if item was newly added, false if it probably already existed
 func (s *Store) BFAdd(key string, item string) (bool, error) {
@@ -155,33 +303,12 @@ func (s *Store) BFAdd(key string, item string) (bool, error) {
 		return false, err
 	}
 
-	hashes := bf.hash(item)
-
-	// Check if all bits are already set (item might exist)
-	allBitsSet := true
-	for _, hash := range hashes {
-		if !bf.getBit(hash) {
-			allBitsSet = false
-			break
-		}
-	}
-
-	// Set all bits
-	for _, hash := range hashes {
-		bf.setBit(hash)
-	}
-
-	// Increment count if item is new
-	if !allBitsSet {
-		bf.count++
-		return true, nil // Item newly added
-	}
-
-	return false, nil // Item probably existed
+	return bf.add(item)
 }
 
 // BFMAdd adds multiple items to the Bloom filter
 // Returns a slice of booleans indicating which items were newly added
+// Items before the one that finds a non-scaling filter full stay added
 func (s *Store) BFMAdd(key string, items []string) ([]bool, error) {
 	bf, err := s.getBloomFilter(key)
 	if err != nil {
@@ -191,29 +318,11 @@ func (s *Store) BFMAdd(key string, items []string) ([]bool, error) {
 	results := make([]bool, len(items))
 
 	for i, item := range items {
-		hashes := bf.hash(item)
-
-		// Check if all bits are already set
-		allBitsSet := true
-		for _, hash := range hashes {
-			if !bf.getBit(hash) {
-				allBitsSet = false
-				break
-			}
-		}
-
-		// Set all bits
-		for _, hash := range hashes {
-			bf.setBit(hash)
-		}
-
-		// Record result and update count
-		if !allBitsSet {
-			bf.count++
-			results[i] = true // Item newly added
-		} else {
-			results[i] = false // Item probably existed
+		added, err := bf.add(item)
+		if err != nil {
+			return nil, err
 		}
+		results[i] = added
 	}
 
 	return results, nil
@@ -227,16 +336,7 @@ func (s *Store) BFExists(key string, item string) (bool, error) {
 		return false, err
 	}
 
-	hashes := bf.hash(item)
-
-	// Check if all bits are set
-	for _, hash := range hashes {
-		if !bf.getBit(hash) {
-			return false, nil // Definitely doesn't exist
-		}
-	}
-
-	return true, nil // Might exist (or false positive)
+	return bf.mightContain(item), nil
 }
 
 // BFMExists checks if multiple items exist in the Bloom filter
@@ -250,41 +350,51 @@ func (s *Store) BFMExists(key string, items []string) ([]bool, error) {
 	results := make([]bool, len(items))
 
 	for i, item := range items {
-		hashes := bf.hash(item)
-
-		exists := true
-		for _, hash := range hashes {
-			if !bf.getBit(hash) {
-				exists = false
-				break
-			}
-		}
-
-		results[i] = exists
+		results[i] = bf.mightContain(item)
 	}
 
 	return results, nil
 }
 
 // BFInfo returns information about the Bloom filter
+// Capacity and sizes cover every sub-filter; the error rate and number of
+// hash functions are those the filter was created with
 func (s *Store) BFInfo(key string) (*BloomFilterInfo, error) {
 	bf, err := s.getBloomFilter(key)
 	if err != nil {
 		return nil, err
 	}
 
+	var capacity, size, setBits uint64
+	for _, layer := range bf.layers {
+		capacity += layer.capacity
+		size += layer.size
+		setBits += layer.setBits()
+	}
+	count := bf.count()
+
 	bitsPerItem := 0.0
-	if bf.count > 0 {
-		bitsPerItem = float64(bf.size) / float64(bf.count)
+	if count > 0 {
+		bitsPerItem = float64(size) / float64(count)
+	}
+
+	fillRatio := 0.0
+	if size > 0 {
+		fillRatio = float64(setBits) / float64(size)
 	}
 
+	first := bf.layers[0]
 	return &BloomFilterInfo{
-		Capacity:    bf.capacity,
-		Size:        bf.size,
-		NumHashes:   bf.numHashes,
-		Count:       bf.count,
-		ErrorRate:   bf.errorRate,
+		Capacity:    capacity,
+		Size:        size,
+		Bytes:       bf.memoryBytes(),
+		NumFilters:  len(bf.layers),
+		Expansion:   int(bf.expansion),
+		NumHashes:   first.numHashes,
+		Count:       count,
+		ErrorRate:   first.errorRate,
 		BitsPerItem: bitsPerItem,
+		FillRatio:   fillRatio,
 	}, nil
 }
 
@@ -292,7 +402,7 @@ func (s *Store) BFInfo(key string) (*BloomFilterInfo, error) {
 
 // getBloomFilter retrieves a Bloom filter from storage
 func (s *Store) getBloomFilter(key string) (*BloomFilter, error) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 
 	if !exists {
 		return nil, ErrKeyNotFound
@@ -300,7 +410,7 @@ func (s *Store) getBloomFilter(key string) (*BloomFilter, error) {
 
 	// Check expiry
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return nil, ErrKeyNotFound // Expired
 	}
 
@@ -316,18 +426,27 @@ func (s *Store) getBloomFilter(key string) (*BloomFilter, error) {
 	return bf, nil
 }
 
-// calculateActualErrorRate calculates the actual false positive rate
-// based on current fill rate of the bit array
-func (bf *BloomFilter) calculateActualErrorRate() float64 {
-	// Count set bits
-	setBits := uint64(0)
+// memoryBytes returns the memory used by the filter, bit arrays included
+func (bf *BloomFilter) memoryBytes() int64 {
+	total := int64(0)
+	for _, layer := range bf.layers {
+		total += int64(len(layer.bits))*8 + bloomFilterOverhead
+	}
+	return total
+}
+
+// setBits counts the bits set in the bit array
+func (bf *bloomLayer) setBits() uint64 {
+	count := uint64(0)
 	for _, word := range bf.bits {
-		// Count bits using Brian Kernighan's algorithm
-		for w := word; w != 0; w &= w - 1 {
-			setBits++
-		}
+		count += uint64(bits.OnesCount64(word))
 	}
+	return count
+}
 
+// calculateActualErrorRate calculates the actual false positive rate
+// based on current fill rate of the bit array
+func (bf *bloomLayer) calculateActualErrorRate() float64 {
 	if bf.size == 0 {
 		return 0.0
 	}
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"time"
+)
+
+// ErrCMSOverflow is returned when an increment would overflow a counter
+var ErrCMSOverflow = errors.New("ERR CMS: INCRBY overflow")
+
+// CountMinSketch estimates how often each item of a stream was seen, using
+// depth rows of width counters instead of one counter per item
+// Every row hashes an item to one of its counters; the item's estimate is
+// the smallest of its depth counters, which never undercounts and
+// overcounts by roughly total/width with high probability
+// Note: No locking needed - all operations execute sequentially in the single processor goroutine
+type CountMinSketch struct {
+	counters []int64 // depth rows of width counters, row-major
+	width    uint32
+	depth    uint32
+	count    int64 // Sum of all increments
+}
+
+// CountMinSketchInfo contains information about a Count-Min sketch
+type CountMinSketchInfo struct {
+	Width uint32
+	Depth uint32
+	Count int64
+}
+
+// ==================== COUNT-MIN SKETCH CREATION ====================
+
+// newCountMinSketch creates a zeroed sketch of depth rows by width counters
+func newCountMinSketch(width, depth uint32) *CountMinSketch {
+	return &CountMinSketch{
+		counters: make([]int64, uint64(width)*uint64(depth)),
+		width:    width,
+		depth:    depth,
+	}
+}
+
+// Clone creates a deep copy of the sketch
+func (cms *CountMinSketch) Clone() *CountMinSketch {
+	clone := *cms
+	clone.counters = make([]int64, len(cms.counters))
+	copy(clone.counters, cms.counters)
+	return &clone
+}
+
+// cmsHeaderSize is the width, depth and count fields MarshalBinary writes
+// before the counters
+const cmsHeaderSize = 16
+
+// MarshalBinary encodes the sketch for RDB and DUMP: width and depth as
+// little-endian uint32s, count as a little-endian int64, then every counter
+// row by row as a little-endian int64
+func (cms *CountMinSketch) MarshalBinary() []byte {
+	buf := make([]byte, cmsHeaderSize, cmsHeaderSize+len(cms.counters)*8)
+	binary.LittleEndian.PutUint32(buf[0:], cms.width)
+	binary.LittleEndian.PutUint32(buf[4:], cms.depth)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(cms.count))
+	for _, counter := range cms.counters {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(counter))
+	}
+	return buf
+}
+
+// UnmarshalCountMinSketch decodes a sketch encoded by MarshalBinary
+// Counters must lie between 0 and count, which CMSIncrBy relies on to rule
+// out overflow
+func UnmarshalCountMinSketch(data []byte) (*CountMinSketch, error) {
+	invalid := errors.New("invalid Count-Min sketch encoding")
+	if len(data) < cmsHeaderSize {
+		return nil, invalid
+	}
+	width := binary.LittleEndian.Uint32(data[0:])
+	depth := binary.LittleEndian.Uint32(data[4:])
+	if width == 0 || depth == 0 || uint64(len(data)-cmsHeaderSize) != uint64(width)*uint64(depth)*8 {
+		return nil, invalid
+	}
+
+	cms := newCountMinSketch(width, depth)
+	cms.count = int64(binary.LittleEndian.Uint64(data[8:]))
+	if cms.count < 0 {
+		return nil, invalid
+	}
+	pos := cmsHeaderSize
+	for i := range cms.counters {
+		counter := int64(binary.LittleEndian.Uint64(data[pos:]))
+		if counter < 0 || counter > cms.count {
+			return nil, invalid
+		}
+		cms.counters[i] = counter
+		pos += 8
+	}
+	return cms, nil
+}
+
+// ==================== HASH FUNCTIONS ====================
+
+// positions returns the index in counters of item's counter in every row
+// Uses double hashing like the Bloom filter: row i uses hash1 + i*hash2
+func (cms *CountMinSketch) positions(item string) []uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	hash1 := h.Sum64()
+
+	h.Reset()
+	h.Write([]byte(item + "salt"))
+	hash2 := h.Sum64()
+
+	positions := make([]uint64, cms.depth)
+	for i := uint32(0); i < cms.depth; i++ {
+		column := (hash1 + uint64(i)*hash2) % uint64(cms.width)
+		positions[i] = uint64(i)*uint64(cms.width) + column
+	}
+	return positions
+}
+
+// ==================== SKETCH OPERATIONS ====================
+
+// estimate returns the smallest of item's counters
+func (cms *CountMinSketch) estimate(item string) int64 {
+	min := int64(math.MaxInt64)
+	for _, pos := range cms.positions(item) {
+		if cms.counters[pos] < min {
+			min = cms.counters[pos]
+		}
+	}
+	return min
+}
+
+// incrBy adds increment to every counter of item
+// Returns the item's new estimate
+func (cms *CountMinSketch) incrBy(item string, increment int64) int64 {
+	for _, pos := range cms.positions(item) {
+		cms.counters[pos] += increment
+	}
+	cms.count += increment
+	return cms.estimate(item)
+}
+
+// memoryBytes returns the memory used by the sketch, counters included
+func (cms *CountMinSketch) memoryBytes() int64 {
+	return int64(len(cms.counters))*8 + countMinSketchOverhead
+}
+
+// ==================== COUNT-MIN SKETCH COMMANDS ====================
+
+// CMSInitByDim creates a new Count-Min sketch with the given dimensions
+func (s *Store) CMSInitByDim(key string, width, depth uint32) error {
+	// Check if key already exists
+	if _, exists := s.lookup(key); exists {
+		return ErrInvalidOperation
+	}
+
+	s.putData(key, &Value{
+		Data: newCountMinSketch(width, depth),
+		Type: CountMinSketchType,
+	})
+
+	return nil
+}
+
+// CMSIncrBy increments the count of each item by the matching (non-negative)
+// increment
+// Returns the new estimate of every item
+// Nothing is applied if the increments would overflow a counter
+func (s *Store) CMSIncrBy(key string, items []string, increments []int64) ([]int64, error) {
+	cms, err := s.getCountMinSketch(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// No counter exceeds the total of all increments, so checking the total
+	// is enough to rule out overflow before applying anything
+	total := cms.count
+	for _, increment := range increments {
+		if total > math.MaxInt64-increment {
+			return nil, ErrCMSOverflow
+		}
+		total += increment
+	}
+
+	cms = s.writableCountMinSketch(key, cms)
+	results := make([]int64, len(items))
+	for i, item := range items {
+		results[i] = cms.incrBy(item, increments[i])
+	}
+	return results, nil
+}
+
+// CMSQuery returns the estimated count of each item
+func (s *Store) CMSQuery(key string, items []string) ([]int64, error) {
+	cms, err := s.getCountMinSketch(key)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]int64, len(items))
+	for i, item := range items {
+		results[i] = cms.estimate(item)
+	}
+	return results, nil
+}
+
+// CMSInfo returns information about the Count-Min sketch
+func (s *Store) CMSInfo(key string) (*CountMinSketchInfo, error) {
+	cms, err := s.getCountMinSketch(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CountMinSketchInfo{
+		Width: cms.width,
+		Depth: cms.depth,
+		Count: cms.count,
+	}, nil
+}
+
+// ==================== HELPER FUNCTIONS ====================
+
+// writableCountMinSketch returns the sketch at key for modification
+// Copy-on-write: while a snapshot is being serialized it holds the current
+// sketch, so a clone replaces it in the keyspace instead
+func (s *Store) writableCountMinSketch(key string, cms *CountMinSketch) *CountMinSketch {
+	if !s.isSnapshotActive() {
+		return cms
+	}
+	clone := cms.Clone()
+	s.putData(key, &Value{
+		Data:      clone,
+		ExpiresAt: s.currentExpiry(key),
+		Type:      CountMinSketchType,
+	})
+	return clone
+}
+
+// getCountMinSketch retrieves a Count-Min sketch from storage
+func (s *Store) getCountMinSketch(key string) (*CountMinSketch, error) {
+	val, exists := s.lookup(key)
+
+	if !exists {
+		return nil, ErrKeyNotFound
+	}
+
+	// Check expiry
+	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
+		s.expireKey(key)
+		return nil, ErrKeyNotFound // Expired
+	}
+
+	cms, ok := val.Data.(*CountMinSketch)
+	if !ok || val.Type != CountMinSketchType {
+		return nil, ErrWrongType
+	}
+
+	return cms, nil
+}
@@ -0,0 +1,396 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math/bits"
+	"math/rand"
+	"time"
+)
+
+// Cuckoo filter sizing (same defaults as RedisBloom)
+const (
+	DefaultCuckooCapacity = 1024
+	MaxCuckooCapacity     = 1 << 30 // 2^28 buckets, 2GB of fingerprints
+	cuckooBucketSize      = 4       // Fingerprints per bucket
+	cuckooMaxKicks        = 500     // Relocations tried before an insert fails
+)
+
+// ErrCuckooFull is returned when an item cannot be placed even after
+// relocating existing fingerprints
+var ErrCuckooFull = errors.New("ERR Filter is full")
+
+// CuckooFilter is a probabilistic set that, unlike a Bloom filter, supports
+// deleting items
+// Each item is reduced to a 16-bit fingerprint stored in one of two candidate
+// buckets; the second bucket is derived from the first and the fingerprint,
+// so a fingerprint can always be moved to its alternate bucket
+// Note: No locking needed - all operations execute sequentially in the single processor goroutine
+type CuckooFilter struct {
+	buckets  [][cuckooBucketSize]uint16 // 0 marks an empty slot
+	capacity uint64                     // Requested capacity
+	count    uint64                     // Fingerprints currently stored
+	deleted  uint64                     // Items removed with CF.DEL
+}
+
+// CuckooFilterInfo contains information about a Cuckoo filter
+type CuckooFilterInfo struct {
+	Capacity   uint64
+	Bytes      int64 // Memory used by the filter, buckets included
+	NumBuckets uint64
+	BucketSize int
+	Count      uint64
+	Deleted    uint64
+}
+
+// ==================== CUCKOO FILTER CREATION ====================
+
+// newCuckooFilter creates a Cuckoo filter able to hold capacity items
+// (at most MaxCuckooCapacity, which callers check)
+// The bucket count is rounded up to a power of two so alternate bucket
+// indexes can be computed with a mask
+func newCuckooFilter(capacity uint64) *CuckooFilter {
+	if capacity == 0 {
+		capacity = DefaultCuckooCapacity
+	}
+
+	numBuckets := uint64(1) << bits.Len64((min(capacity, MaxCuckooCapacity)-1)/cuckooBucketSize)
+
+	return &CuckooFilter{
+		buckets:  make([][cuckooBucketSize]uint16, numBuckets),
+		capacity: capacity,
+	}
+}
+
+// Clone creates a deep copy of the Cuckoo filter
+func (cf *CuckooFilter) Clone() *CuckooFilter {
+	clone := *cf
+	clone.buckets = make([][cuckooBucketSize]uint16, len(cf.buckets))
+	copy(clone.buckets, cf.buckets)
+	return &clone
+}
+
+// cuckooHeaderSize is the capacity, count and deleted fields MarshalBinary
+// writes before the buckets
+const cuckooHeaderSize = 24
+
+// MarshalBinary encodes the filter for RDB and DUMP: capacity, count and
+// deleted as little-endian uint64s, then every slot as a little-endian uint16
+func (cf *CuckooFilter) MarshalBinary() []byte {
+	buf := make([]byte, cuckooHeaderSize, cuckooHeaderSize+len(cf.buckets)*cuckooBucketSize*2)
+	binary.LittleEndian.PutUint64(buf[0:], cf.capacity)
+	binary.LittleEndian.PutUint64(buf[8:], cf.count)
+	binary.LittleEndian.PutUint64(buf[16:], cf.deleted)
+	for _, bucket := range cf.buckets {
+		for _, fp := range bucket {
+			buf = binary.LittleEndian.AppendUint16(buf, fp)
+		}
+	}
+	return buf
+}
+
+// UnmarshalCuckooFilter decodes a filter encoded by MarshalBinary
+// The bucket count must be a power of two, as lookups mask hashes with it
+func UnmarshalCuckooFilter(data []byte) (*CuckooFilter, error) {
+	bucketBytes := cuckooBucketSize * 2
+	if len(data) < cuckooHeaderSize+bucketBytes || (len(data)-cuckooHeaderSize)%bucketBytes != 0 {
+		return nil, errors.New("invalid Cuckoo filter encoding")
+	}
+	numBuckets := (len(data) - cuckooHeaderSize) / bucketBytes
+	if numBuckets&(numBuckets-1) != 0 {
+		return nil, errors.New("invalid Cuckoo filter encoding")
+	}
+
+	cf := &CuckooFilter{
+		buckets:  make([][cuckooBucketSize]uint16, numBuckets),
+		capacity: binary.LittleEndian.Uint64(data[0:]),
+		count:    binary.LittleEndian.Uint64(data[8:]),
+		deleted:  binary.LittleEndian.Uint64(data[16:]),
+	}
+	pos := cuckooHeaderSize
+	for i := range cf.buckets {
+		for slot := range cf.buckets[i] {
+			cf.buckets[i][slot] = binary.LittleEndian.Uint16(data[pos:])
+			pos += 2
+		}
+	}
+	return cf, nil
+}
+
+// ==================== HASH FUNCTIONS ====================
+
+// locate returns the fingerprint of item and its two candidate buckets
+func (cf *CuckooFilter) locate(item string) (fp uint16, i1, i2 uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	hash := h.Sum64()
+
+	// Fingerprint from the high bits, bucket from the low bits; 0 is reserved
+	// for empty slots
+	fp = uint16(hash >> 48)
+	if fp == 0 {
+		fp = 1
+	}
+	i1 = hash & cf.mask()
+	return fp, i1, cf.altIndex(i1, fp)
+}
+
+// altIndex returns the other candidate bucket of a fingerprint stored at i
+// altIndex(altIndex(i, fp), fp) == i, which is what lets fingerprints move
+// without knowing the item they came from
+func (cf *CuckooFilter) altIndex(i uint64, fp uint16) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{byte(fp), byte(fp >> 8)})
+	return (i ^ h.Sum64()) & cf.mask()
+}
+
+// mask returns the bit mask that maps a hash onto a bucket index
+func (cf *CuckooFilter) mask() uint64 {
+	return uint64(len(cf.buckets)) - 1
+}
+
+// ==================== BUCKET OPERATIONS ====================
+
+// insertInto stores fp in a free slot of bucket i
+// Returns false if the bucket is full
+func (cf *CuckooFilter) insertInto(i uint64, fp uint16) bool {
+	for slot, stored := range cf.buckets[i] {
+		if stored == 0 {
+			cf.buckets[i][slot] = fp
+			return true
+		}
+	}
+	return false
+}
+
+// removeFrom clears one slot of bucket i holding fp
+// Returns false if the bucket does not hold fp
+func (cf *CuckooFilter) removeFrom(i uint64, fp uint16) bool {
+	for slot, stored := range cf.buckets[i] {
+		if stored == fp {
+			cf.buckets[i][slot] = 0
+			return true
+		}
+	}
+	return false
+}
+
+// countIn returns how many slots of bucket i hold fp
+func (cf *CuckooFilter) countIn(i uint64, fp uint16) uint64 {
+	count := uint64(0)
+	for _, stored := range cf.buckets[i] {
+		if stored == fp {
+			count++
+		}
+	}
+	return count
+}
+
+// add stores the fingerprint of item, relocating existing fingerprints to
+// their alternate buckets when both candidates are full
+// Returns ErrCuckooFull if no room was found; the filter is left unchanged
+func (cf *CuckooFilter) add(item string) error {
+	fp, i1, i2 := cf.locate(item)
+	if cf.insertInto(i1, fp) || cf.insertInto(i2, fp) {
+		cf.count++
+		return nil
+	}
+
+	// Both buckets are full: evict a random fingerprint and move it to its
+	// alternate bucket, repeating until one lands in a free slot
+	type kick struct {
+		bucket uint64
+		slot   int
+		fp     uint16
+	}
+	var kicks []kick
+
+	i := i1
+	if rand.Intn(2) == 1 {
+		i = i2
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		slot := rand.Intn(cuckooBucketSize)
+		kicks = append(kicks, kick{bucket: i, slot: slot, fp: cf.buckets[i][slot]})
+		fp, cf.buckets[i][slot] = cf.buckets[i][slot], fp
+
+		i = cf.altIndex(i, fp)
+		if cf.insertInto(i, fp) {
+			cf.count++
+			return nil
+		}
+	}
+
+	// Undo the relocations so no previously stored fingerprint is lost
+	for n := len(kicks) - 1; n >= 0; n-- {
+		k := kicks[n]
+		cf.buckets[k.bucket][k.slot] = k.fp
+	}
+	return ErrCuckooFull
+}
+
+// mightContain reports whether item may have been added
+func (cf *CuckooFilter) mightContain(item string) bool {
+	fp, i1, i2 := cf.locate(item)
+	return cf.countIn(i1, fp) > 0 || cf.countIn(i2, fp) > 0
+}
+
+// remove deletes one copy of the fingerprint of item
+// Only items known to have been added should be removed: deleting an item
+// that merely shares a fingerprint removes the other item instead
+func (cf *CuckooFilter) remove(item string) bool {
+	fp, i1, i2 := cf.locate(item)
+	if cf.removeFrom(i1, fp) || cf.removeFrom(i2, fp) {
+		cf.count--
+		cf.deleted++
+		return true
+	}
+	return false
+}
+
+// occurrences returns how many copies of the fingerprint of item are stored
+func (cf *CuckooFilter) occurrences(item string) uint64 {
+	fp, i1, i2 := cf.locate(item)
+	count := cf.countIn(i1, fp)
+	if i2 != i1 {
+		count += cf.countIn(i2, fp)
+	}
+	return count
+}
+
+// memoryBytes returns the memory used by the filter, buckets included
+func (cf *CuckooFilter) memoryBytes() int64 {
+	return int64(len(cf.buckets))*cuckooBucketSize*2 + cuckooFilterOverhead
+}
+
+// ==================== CUCKOO FILTER OPERATIONS ====================
+
+// CFReserve creates a new Cuckoo filter able to hold capacity items
+func (s *Store) CFReserve(key string, capacity uint64) error {
+	// Check if key already exists
+	if _, exists := s.lookup(key); exists {
+		return ErrInvalidOperation
+	}
+
+	s.putData(key, &Value{
+		Data: newCuckooFilter(capacity),
+		Type: CuckooFilterType,
+	})
+
+	return nil
+}
+
+// CFAdd adds an item to the Cuckoo filter, creating the filter with the
+// default capacity if it does not exist
+// Items may be added more than once; each copy needs its own CF.DEL
+func (s *Store) CFAdd(key string, item string) error {
+	cf, err := s.getCuckooFilter(key)
+	if err == ErrKeyNotFound {
+		if err := s.CFReserve(key, DefaultCuckooCapacity); err != nil {
+			return err
+		}
+		cf, err = s.getCuckooFilter(key)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.writableCuckooFilter(key, cf).add(item)
+}
+
+// CFExists checks if an item exists in the Cuckoo filter
+// Returns true if item might exist, false if it definitely doesn't exist
+func (s *Store) CFExists(key string, item string) (bool, error) {
+	cf, err := s.getCuckooFilter(key)
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return cf.mightContain(item), nil
+}
+
+// CFDel removes one copy of an item from the Cuckoo filter
+// Returns true if a matching fingerprint was removed
+func (s *Store) CFDel(key string, item string) (bool, error) {
+	cf, err := s.getCuckooFilter(key)
+	if err != nil {
+		return false, err
+	}
+
+	return s.writableCuckooFilter(key, cf).remove(item), nil
+}
+
+// CFCount returns how many times an item may have been added to the Cuckoo
+// filter (0 if the filter does not exist)
+func (s *Store) CFCount(key string, item string) (int64, error) {
+	cf, err := s.getCuckooFilter(key)
+	if err == ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(cf.occurrences(item)), nil
+}
+
+// CFInfo returns information about the Cuckoo filter
+func (s *Store) CFInfo(key string) (*CuckooFilterInfo, error) {
+	cf, err := s.getCuckooFilter(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CuckooFilterInfo{
+		Capacity:   cf.capacity,
+		Bytes:      cf.memoryBytes(),
+		NumBuckets: uint64(len(cf.buckets)),
+		BucketSize: cuckooBucketSize,
+		Count:      cf.count,
+		Deleted:    cf.deleted,
+	}, nil
+}
+
+// ==================== HELPER FUNCTIONS ====================
+
+// writableCuckooFilter returns the filter at key for modification
+// Copy-on-write: while a snapshot is being serialized it holds the current
+// filter, so a clone replaces it in the keyspace instead
+func (s *Store) writableCuckooFilter(key string, cf *CuckooFilter) *CuckooFilter {
+	if !s.isSnapshotActive() {
+		return cf
+	}
+	clone := cf.Clone()
+	s.putData(key, &Value{
+		Data:      clone,
+		ExpiresAt: s.currentExpiry(key),
+		Type:      CuckooFilterType,
+	})
+	return clone
+}
+
+// getCuckooFilter retrieves a Cuckoo filter from storage
+func (s *Store) getCuckooFilter(key string) (*CuckooFilter, error) {
+	val, exists := s.lookup(key)
+
+	if !exists {
+		return nil, ErrKeyNotFound
+	}
+
+	// Check expiry
+	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
+		s.expireKey(key)
+		return nil, ErrKeyNotFound // Expired
+	}
+
+	cf, ok := val.Data.(*CuckooFilter)
+	if !ok || val.Type != CuckooFilterType {
+		return nil, ErrWrongType
+	}
+
+	return cf, nil
+}
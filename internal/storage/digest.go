@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math"
+	"strconv"
+	"time"
+)
+
+// digest is a SHA1 sum; digests are combined with XOR so order never matters
+type digest [sha1.Size]byte
+
+// xor folds other into d
+func (d *digest) xor(other digest) {
+	for i := range d {
+		d[i] ^= other[i]
+	}
+}
+
+// Digest returns an order-independent digest of the whole keyspace as 40 hex chars
+// Every live key contributes a SHA1 of its name, type, value and absolute expiry,
+// XORed together, so two nodes holding the same data report the same digest
+// regardless of insertion order. An empty keyspace digests to all zeros
+func (s *Store) Digest() string {
+	var total digest
+	now := time.Now()
+
+	for key, val := range s.data {
+		if val.ExpiresAt != nil && now.After(*val.ExpiresAt) {
+			continue
+		}
+		total.xor(keyDigest(key, val))
+	}
+
+	return hex.EncodeToString(total[:])
+}
+
+// DigestValue returns the digest of the value stored at key as 40 hex chars
+// Only the type and value are hashed (not the key name or TTL), so the same value
+// under different names compares equal. Missing keys digest to all zeros
+func (s *Store) DigestValue(key string) string {
+	val, exists := s.lookup(key)
+	if !exists || (val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt)) {
+		var zero digest
+		return hex.EncodeToString(zero[:])
+	}
+
+	vd := valueDigest(val)
+	d := sumDigest(valueTypeName(val.Type), string(vd[:]))
+	return hex.EncodeToString(d[:])
+}
+
+// keyDigest hashes a key together with its type, value digest and expiry
+func keyDigest(key string, val *Value) digest {
+	h := sha1.New()
+	writeDigestString(h, key)
+	writeDigestString(h, valueTypeName(val.Type))
+
+	vd := valueDigest(val)
+	h.Write(vd[:])
+
+	expiresAt := int64(-1)
+	if val.ExpiresAt != nil {
+		expiresAt = val.ExpiresAt.UnixMilli()
+	}
+	writeDigestInt(h, expiresAt)
+
+	var d digest
+	copy(d[:], h.Sum(nil))
+	return d
+}
+
+// valueDigest hashes a value according to its type
+// Lists are hashed in order; sets, hashes and sorted sets XOR their per-element
+// digests so the internal iteration order does not affect the result
+func valueDigest(val *Value) digest {
+	switch data := val.Data.(type) {
+	case string:
+		return sumDigest(data)
+	case int64:
+		return sumDigest(strconv.FormatInt(data, 10))
+	case *List:
+		h := sha1.New()
+		data.forEach(true, func(_ int, value string) bool {
+			writeDigestString(h, value)
+			return true
+		})
+		var d digest
+		copy(d[:], h.Sum(nil))
+		return d
+	case *Set:
+		var d digest
+		for _, member := range data.GetMembers() {
+			d.xor(sumDigest(member))
+		}
+		return d
+	case *Hash:
+		var d digest
+		pairs := data.GetAll()
+		for i := 0; i < len(pairs); i += 2 {
+			d.xor(sumDigest(pairs[i], pairs[i+1]))
+		}
+		return d
+	case *ZSet:
+		var d digest
+		for _, m := range data.GetAll() {
+			d.xor(sumDigest(m.Member, strconv.FormatFloat(m.Score, 'g', 17, 64)))
+		}
+		return d
+	case *HyperLogLog:
+		return sumDigest(strconv.Itoa(int(data.GetPrecision())), string(data.GetRegisters()))
+	case *BloomFilter:
+		h := sha1.New()
+		writeDigestInt(h, int64(data.expansion))
+		for _, layer := range data.layers {
+			writeDigestInt(h, int64(layer.size))
+			writeDigestInt(h, int64(layer.numHashes))
+			writeDigestInt(h, int64(layer.capacity))
+			writeDigestInt(h, int64(math.Float64bits(layer.errorRate)))
+			writeDigestInt(h, int64(layer.count))
+			for _, word := range layer.bits {
+				writeDigestInt(h, int64(word))
+			}
+		}
+		var d digest
+		copy(d[:], h.Sum(nil))
+		return d
+	case *CuckooFilter:
+		h := sha1.New()
+		writeDigestInt(h, int64(data.capacity))
+		writeDigestInt(h, int64(data.deleted))
+		for _, bucket := range data.buckets {
+			for _, fp := range bucket {
+				writeDigestInt(h, int64(fp))
+			}
+		}
+		var d digest
+		copy(d[:], h.Sum(nil))
+		return d
+	case *CountMinSketch:
+		h := sha1.New()
+		writeDigestInt(h, int64(data.width))
+		writeDigestInt(h, int64(data.depth))
+		writeDigestInt(h, data.count)
+		for _, counter := range data.counters {
+			writeDigestInt(h, counter)
+		}
+		var d digest
+		copy(d[:], h.Sum(nil))
+		return d
+	default:
+		return sumDigest(fmt.Sprintf("%v", data))
+	}
+}
+
+// sumDigest hashes a sequence of length-prefixed strings
+func sumDigest(parts ...string) digest {
+	h := sha1.New()
+	for _, part := range parts {
+		writeDigestString(h, part)
+	}
+	var d digest
+	copy(d[:], h.Sum(nil))
+	return d
+}
+
+// writeDigestString writes a length-prefixed string so adjacent fields can't run together
+func writeDigestString(h hash.Hash, s string) {
+	writeDigestInt(h, int64(len(s)))
+	h.Write([]byte(s))
+}
+
+// writeDigestInt writes a fixed-width integer
+func writeDigestInt(h hash.Hash, n int64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	h.Write(buf[:])
+}
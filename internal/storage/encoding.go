@@ -0,0 +1,427 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Object encodings reported by OBJECT ENCODING (same names as Redis)
+const (
+	EncodingInt       = "int"
+	EncodingRaw       = "raw"
+	EncodingEmbstr    = "embstr"
+	EncodingQuicklist = "quicklist"
+	EncodingIntset    = "intset"
+	EncodingHashtable = "hashtable"
+	EncodingSkiplist  = "skiplist"
+	EncodingListpack  = "listpack"
+)
+
+// embstrSizeLimit is the longest string Redis stores as embstr
+const embstrSizeLimit = 44
+
+// DefaultSetMaxIntsetEntries is the default set-max-intset-entries threshold
+const DefaultSetMaxIntsetEntries = 512
+
+// DefaultListMaxListpackSize is the default list-max-listpack-size (8KB of elements)
+const DefaultListMaxListpackSize = -2
+
+// SetListMaxListpackSize sets list-max-listpack-size
+// Lists created afterwards switch from listpack to quicklist once they hold more
+// than n elements (n > 0) or more element bytes than the size class n (-1..-5)
+func (s *Store) SetListMaxListpackSize(n int) {
+	s.listMaxListpackSize = n
+}
+
+// SetMaxIntsetEntries sets the largest set that keeps the intset encoding
+// Sets growing past the threshold are converted to hashtable
+func (s *Store) SetMaxIntsetEntries(n int) {
+	if n < 0 {
+		n = 0
+	}
+	s.setMaxIntsetEntries = n
+}
+
+// SetZSetListpackLimits sets zset-max-listpack-entries and zset-max-listpack-value
+// Sorted sets created afterwards switch from listpack to skiplist once they
+// hold more than maxEntries members or a member longer than maxValue bytes
+func (s *Store) SetZSetListpackLimits(maxEntries, maxValue int) {
+	if maxEntries < 0 {
+		maxEntries = 0
+	}
+	if maxValue < 0 {
+		maxValue = 0
+	}
+	s.zsetMaxListpackEntries = maxEntries
+	s.zsetMaxListpackValue = maxValue
+}
+
+// SetHashListpackLimits sets hash-max-listpack-entries and hash-max-listpack-value
+// Hashes switch from listpack to hashtable once they hold more than
+// maxEntries fields or a field or value longer than maxValue bytes
+func (s *Store) SetHashListpackLimits(maxEntries, maxValue int) {
+	if maxEntries < 0 {
+		maxEntries = 0
+	}
+	if maxValue < 0 {
+		maxValue = 0
+	}
+	s.hashMaxListpackEntries = maxEntries
+	s.hashMaxListpackValue = maxValue
+}
+
+// ObjectEncoding returns the internal encoding of the value stored at key
+// Returns false if the key does not exist
+func (s *Store) ObjectEncoding(key string) (string, bool) {
+	val, exists := s.lookup(key)
+	if !exists {
+		return "", false
+	}
+
+	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
+		s.expireKey(key)
+		return "", false
+	}
+
+	switch val.Type {
+	case StringType:
+		if _, ok := val.Data.(int64); ok {
+			return EncodingInt, true
+		}
+		if str, ok := val.Data.(string); ok && len(str) <= embstrSizeLimit {
+			return EncodingEmbstr, true
+		}
+		return EncodingRaw, true
+	case ListType:
+		if list, ok := val.Data.(*List); ok && list.IsListpack() {
+			return EncodingListpack, true
+		}
+		return EncodingQuicklist, true
+	case SetType:
+		if set, ok := val.Data.(*Set); ok && set.IsIntset() {
+			return EncodingIntset, true
+		}
+		return EncodingHashtable, true
+	case HashType:
+		if hash, ok := val.Data.(*Hash); ok && hash.IsListpack() {
+			return EncodingListpack, true
+		}
+		return EncodingHashtable, true
+	case ZSetType:
+		if zset, ok := val.Data.(*ZSet); ok && zset.IsListpack() {
+			return EncodingListpack, true
+		}
+		return EncodingSkiplist, true
+	default:
+		return EncodingRaw, true
+	}
+}
+
+// maxCanonicalIntLen is the length of the longest int64 ("-9223372036854775808")
+const maxCanonicalIntLen = 20
+
+// parseCanonicalInt parses str if it is the canonical base-10 form of an int64
+// ("12" but not "012", "+12" or " 12"), so converting back yields the same bytes
+func parseCanonicalInt(str string) (int64, bool) {
+	if len(str) == 0 || len(str) > maxCanonicalIntLen {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != str {
+		return 0, false
+	}
+	return n, true
+}
+
+// encodeStringValue returns the stored form of a string value
+// Canonical integers are kept as int64 (OBJECT ENCODING int) so INCR and friends
+// work on them without parsing; anything else is stored unchanged
+func encodeStringValue(value interface{}) interface{} {
+	if str, ok := value.(string); ok {
+		if n, ok := parseCanonicalInt(str); ok {
+			return n
+		}
+	}
+	return value
+}
+
+// StringValue returns the contents of a string value regardless of its encoding
+func (v *Value) StringValue() (string, bool) {
+	switch data := v.Data.(type) {
+	case string:
+		return data, true
+	case int64:
+		return strconv.FormatInt(data, 10), true
+	default:
+		return "", false
+	}
+}
+
+// ObjectDebugInfo holds the internals reported by DEBUG OBJECT
+type ObjectDebugInfo struct {
+	Address  string // Address of the underlying value
+	Type     ValueType
+	Encoding string
+
+	// Quicklist internals, counted by walking the nodes
+	ListNodes            int // Number of nodes
+	ListEntries          int // Elements held by all nodes
+	ListMaxNodeEntries   int // Most elements held by one node
+	ListUncompressedSize int // Total bytes of all elements
+	ListMaxListpackSize  int // list-max-listpack-size the list was checked against
+}
+
+// DebugObject returns the internal representation details of the value at key
+// Returns false if the key does not exist
+func (s *Store) DebugObject(key string) (ObjectDebugInfo, bool) {
+	encoding, exists := s.ObjectEncoding(key)
+	if !exists {
+		return ObjectDebugInfo{}, false
+	}
+
+	val, _ := s.lookup(key)
+	info := ObjectDebugInfo{
+		Address:  fmt.Sprintf("%p", val),
+		Type:     val.Type,
+		Encoding: encoding,
+	}
+
+	// Only a quicklist has nodes; a listpack is one slice
+	if list, ok := val.Data.(*List); ok && val.Type == ListType && !list.IsListpack() {
+		info.ListMaxListpackSize = s.listMaxListpackSize
+		for node := list.Head; node != nil; node = node.Next {
+			entries := node.entries()
+			info.ListNodes++
+			info.ListEntries += entries
+			info.ListMaxNodeEntries = max(info.ListMaxNodeEntries, entries)
+			info.ListUncompressedSize += len(node.Value)
+		}
+	}
+
+	return info, true
+}
+
+// ListpackEntries returns how many entries the value at key holds in the
+// listpack encoding: the length of a listpack-encoded list, hash or sorted
+// set, and 0 for any other encoding
+// Returns false if the key does not exist
+func (s *Store) ListpackEntries(key string) (int, bool) {
+	encoding, exists := s.ObjectEncoding(key)
+	if !exists {
+		return 0, false
+	}
+	if encoding != EncodingListpack {
+		return 0, true
+	}
+
+	switch data := s.data[key].Data.(type) {
+	case *List:
+		return data.Length, true
+	case *Hash:
+		return data.Len(), true
+	case *ZSet:
+		return data.Len(), true
+	}
+	return 0, true
+}
+
+// ConvertEncoding forces a listpack-encoded list, hash or sorted set into its
+// large encoding (quicklist / hashtable / skiplist), as if it had crossed the
+// size threshold
+// Returns the resulting encoding; already converted values are left as is
+func (s *Store) ConvertEncoding(key string) (string, error) {
+	if _, exists := s.ObjectEncoding(key); !exists {
+		return "", ErrNoSuchKey
+	}
+
+	val, _ := s.lookup(key)
+	switch data := val.Data.(type) {
+	case *List:
+		if data.IsListpack() {
+			// Copy-on-write: clone list if snapshot is active
+			if s.isSnapshotActive() {
+				data = data.Clone()
+			}
+			data.convertToQuicklist()
+			s.saveList(key, data)
+		}
+		return EncodingQuicklist, nil
+	case *Hash:
+		if data.IsListpack() {
+			// Copy-on-write: clone hash if snapshot is active
+			if s.isSnapshotActive() {
+				data = data.Clone()
+			}
+			data.convertToHashtable()
+			s.saveHash(key, data)
+		}
+		return EncodingHashtable, nil
+	case *ZSet:
+		if data.IsListpack() {
+			// Copy-on-write: clone zset if snapshot is active
+			if s.isSnapshotActive() {
+				data = data.Clone()
+			}
+			data.convertToSkiplist()
+			s.saveZSet(key, data)
+		}
+		return EncodingSkiplist, nil
+	}
+	return "", ErrWrongType
+}
+
+// keyDump is the JSON document produced by DumpJSON
+// It holds nothing that changes between two dumps of the same data, so the
+// encoding and the remaining TTL are left out
+type keyDump struct {
+	Key       string      `json:"key"`
+	Type      string      `json:"type"`
+	ExpiresAt *int64      `json:"expires_at_ms"` // Absolute unix ms (null = no TTL)
+	Value     interface{} `json:"value"`
+}
+
+// DumpJSON returns a fully materialized JSON representation of the value at key
+// Elements are emitted in a canonical order (sets sorted, hash fields sorted by
+// encoding/json, sorted sets by score) so dumps from different nodes compare equal
+// Returns ErrNoSuchKey if the key does not exist
+func (s *Store) DumpJSON(key string) (string, error) {
+	val, exists := s.lookup(key)
+	if !exists {
+		return "", ErrNoSuchKey
+	}
+	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
+		s.expireKey(key)
+		return "", ErrNoSuchKey
+	}
+
+	dump := keyDump{
+		Key:  key,
+		Type: valueTypeName(val.Type),
+	}
+	if val.ExpiresAt != nil {
+		expiresAt := val.ExpiresAt.UnixMilli()
+		dump.ExpiresAt = &expiresAt
+	}
+
+	switch data := val.Data.(type) {
+	case string:
+		dump.Value = data
+	case int64:
+		dump.Value = strconv.FormatInt(data, 10)
+	case *List:
+		elements := make([]string, 0, data.Length)
+		data.forEach(true, func(_ int, value string) bool {
+			elements = append(elements, value)
+			return true
+		})
+		dump.Value = elements
+	case *Set:
+		members := data.GetMembers()
+		sort.Strings(members)
+		dump.Value = members
+	case *Hash:
+		fields := make(map[string]string, data.Len())
+		pairs := data.GetAll()
+		for i := 0; i < len(pairs); i += 2 {
+			fields[pairs[i]] = pairs[i+1]
+		}
+		dump.Value = fields
+	case *ZSet:
+		type zsetEntry struct {
+			Member string `json:"member"`
+			Score  string `json:"score"`
+		}
+		all := data.GetAll()
+		entries := make([]zsetEntry, len(all))
+		for i, m := range all {
+			entries[i] = zsetEntry{Member: m.Member, Score: formatScore(m.Score)}
+		}
+		dump.Value = entries
+	case *HyperLogLog:
+		dump.Value = map[string]interface{}{
+			"precision": data.GetPrecision(),
+			"count":     data.Count(),
+			"registers": data.GetRegisters(),
+		}
+	case *BloomFilter:
+		filters := make([]map[string]interface{}, len(data.layers))
+		for i, layer := range data.layers {
+			filters[i] = map[string]interface{}{
+				"capacity":   layer.capacity,
+				"error_rate": layer.errorRate,
+				"size":       layer.size,
+				"hashes":     layer.numHashes,
+				"items":      layer.count,
+			}
+		}
+		dump.Value = map[string]interface{}{
+			"expansion": data.expansion,
+			"filters":   filters,
+		}
+	case *CuckooFilter:
+		dump.Value = map[string]interface{}{
+			"capacity":    data.capacity,
+			"buckets":     len(data.buckets),
+			"bucket_size": cuckooBucketSize,
+			"items":       data.count,
+			"deleted":     data.deleted,
+		}
+	case *CountMinSketch:
+		dump.Value = map[string]interface{}{
+			"width":    data.width,
+			"depth":    data.depth,
+			"count":    data.count,
+			"counters": data.counters,
+		}
+	default:
+		dump.Value = fmt.Sprintf("%v", data)
+	}
+
+	out, err := json.Marshal(dump)
+	if err != nil {
+		return "", fmt.Errorf("ERR failed to encode key: %v", err)
+	}
+	return string(out), nil
+}
+
+// formatScore formats a sorted set score the way Redis replies with it,
+// including "inf" and "-inf", which JSON numbers cannot hold
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'g', 17, 64)
+}
+
+// valueTypeName returns the TYPE name of a value type
+func valueTypeName(t ValueType) string {
+	switch t {
+	case StringType:
+		return "string"
+	case ListType:
+		return "list"
+	case SetType:
+		return "set"
+	case HashType:
+		return "hash"
+	case ZSetType:
+		return "zset"
+	case BloomFilterType:
+		return "MBbloom--"
+	case HyperLogLogType:
+		return "string" // HyperLogLogs are strings in Redis
+	case CuckooFilterType:
+		return "MBbloomCF"
+	case CountMinSketchType:
+		return "CMSk-TYPE"
+	default:
+		return "none"
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import "log"
+
+// encodingClass tells compact encodings (listpack / intset) from large ones
+// (quicklist / hashtable / skiplist); putData records it on every collection
+// value so INFO can count keys per class without walking the keyspace
+type encodingClass uint8
+
+const (
+	encodingUntracked encodingClass = iota // Strings and probabilistic types
+	encodingCompact
+	encodingLarge
+)
+
+// trackedEncodingTypes are the types with a compact and a large encoding, in
+// the order INFO lists them
+var trackedEncodingTypes = []ValueType{ListType, SetType, HashType, ZSetType}
+
+// EncodingStats counts the keys of one collection type by encoding class
+type EncodingStats struct {
+	Type        string // TYPE name: list, set, hash or zset
+	Compact     int    // Keys in listpack or intset
+	Large       int    // Keys in quicklist, hashtable or skiplist
+	Conversions int64  // Times a compact key was stored back in the large encoding
+}
+
+// newEncodingStats returns zeroed counters for every tracked type
+func newEncodingStats() map[ValueType]*EncodingStats {
+	stats := make(map[ValueType]*EncodingStats, len(trackedEncodingTypes))
+	for _, t := range trackedEncodingTypes {
+		stats[t] = &EncodingStats{Type: valueTypeName(t)}
+	}
+	return stats
+}
+
+// encodingClassOf returns the encoding class of a value
+func encodingClassOf(val *Value) encodingClass {
+	switch data := val.Data.(type) {
+	case *List:
+		if data.IsListpack() {
+			return encodingCompact
+		}
+	case *Set:
+		if data.IsIntset() {
+			return encodingCompact
+		}
+	case *Hash:
+		if data.IsListpack() {
+			return encodingCompact
+		}
+	case *ZSet:
+		if data.IsListpack() {
+			return encodingCompact
+		}
+	default:
+		return encodingUntracked
+	}
+	return encodingLarge
+}
+
+// countEncoding adds delta to the counter of the class a value was stored with
+func (s *Store) countEncoding(val *Value, delta int) {
+	stats, ok := s.encodingStats[val.Type]
+	if !ok {
+		return
+	}
+	switch val.encoding {
+	case encodingCompact:
+		stats.Compact += delta
+	case encodingLarge:
+		stats.Large += delta
+	}
+}
+
+// trackEncoding records the encoding class of val, which replaces old (nil
+// for a new key), and moves the key between the per-class counters
+// A key that goes from a compact to a large encoding is counted as a
+// conversion and logged, so a collection that unexpectedly grew shows up
+func (s *Store) trackEncoding(key string, old, val *Value) {
+	oldClass := encodingUntracked
+	if old != nil {
+		oldClass = old.encoding
+		s.countEncoding(old, -1)
+	}
+	val.encoding = encodingClassOf(val)
+	s.countEncoding(val, 1)
+
+	if old == nil || old.Type != val.Type || oldClass != encodingCompact || val.encoding != encodingLarge {
+		return
+	}
+	s.encodingStats[val.Type].Conversions++
+
+	from, to := encodingNames(val.Type)
+	log.Printf("Key '%s' converted from %s to %s", key, from, to)
+}
+
+// encodingNames returns the compact and large encoding names of a type
+func encodingNames(t ValueType) (compact, large string) {
+	switch t {
+	case ListType:
+		return EncodingListpack, EncodingQuicklist
+	case SetType:
+		return EncodingIntset, EncodingHashtable
+	case HashType:
+		return EncodingListpack, EncodingHashtable
+	default:
+		return EncodingListpack, EncodingSkiplist
+	}
+}
+
+// resetEncodingCounts zeroes the per-class key counts after the keyspace is
+// emptied; conversion counts are cumulative and survive
+func (s *Store) resetEncodingCounts() {
+	for _, stats := range s.encodingStats {
+		stats.Compact = 0
+		stats.Large = 0
+	}
+}
+
+// EncodingStats returns the encoding counters of every tracked type
+func (s *Store) EncodingStats() []EncodingStats {
+	out := make([]EncodingStats, 0, len(trackedEncodingTypes))
+	for _, t := range trackedEncodingTypes {
+		out = append(out, *s.encodingStats[t])
+	}
+	return out
+}
@@ -7,6 +7,13 @@ var (
 	ErrKeyNotFound      = errors.New("key not found")
 	ErrInvalidOperation = errors.New("invalid operation")
 	ErrWrongType        = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrCommandTimeout   = errors.New("ERR command timeout") // Long-running operation aborted by its context
+	ErrBusyKey          = errors.New("BUSYKEY Target key name already exists.")
+	ErrCountOutOfRange  = errors.New("ERR value is out of range")
+
+	// String errors
+	ErrIncrOverflow  = errors.New("ERR increment or decrement would overflow")
+	ErrStringTooLong = errors.New("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
 
 	// List errors
 	ErrNoSuchKey       = errors.New("ERR no such key")
@@ -17,6 +24,9 @@ var (
 	ErrHashValueNotInteger = errors.New("ERR hash value is not an integer")
 	ErrHashValueNotFloat   = errors.New("ERR hash value is not a float")
 
+	// Sorted set errors
+	ErrScoreNaN = errors.New("ERR resulting score is not a number (NaN)")
+
 	// HyperLogLog errors
 	ErrPrecisionMismatch    = errors.New("HyperLogLog precision mismatch")
 	ErrInvalidRegisterCount = errors.New("invalid register count")
@@ -0,0 +1,133 @@
+package storage
+
+// ==================== GLOB MATCHING ====================
+// The glob-style patterns of KEYS, SCAN MATCH, PSUBSCRIBE and PUBSUB CHANNELS,
+// with the semantics of Redis's stringmatchlen:
+//
+//	?        any single byte
+//	*        any sequence of bytes, including none ("**" is the same as "*")
+//	[abc]    one of the listed bytes; [^abc] any byte but those
+//	[a-z]    a byte in the range (a reversed range like [z-a] works too)
+//	\x       the byte x literally, also inside [...]
+//
+// A class left open ("[abc") ends with the pattern, and a trailing "\" matches
+// a backslash. Matching works on bytes, so a multibyte UTF-8 character is
+// several bytes for "?".
+
+// GlobMatch reports whether str matches the glob-style pattern
+// Runs in O(len(pattern) * len(str)) at worst: only the most recent "*" is
+// backtracked to, which is enough since every "*" matches any sequence
+func GlobMatch(pattern, str string) bool {
+	p, s := 0, 0
+	starP, starS := -1, 0
+
+	for s < len(str) {
+		if p < len(pattern) {
+			if pattern[p] == '*' {
+				for p < len(pattern) && pattern[p] == '*' {
+					p++
+				}
+				if p == len(pattern) {
+					return true // A trailing "*" matches the rest
+				}
+				starP, starS = p, s
+				continue
+			}
+			if width, ok := globMatchByte(pattern, p, str[s]); ok {
+				p += width
+				s++
+				continue
+			}
+		}
+
+		// Mismatch: let the last "*" absorb one more byte and retry
+		if starP < 0 {
+			return false
+		}
+		starS++
+		p, s = starP, starS
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// MatchPattern reports whether key matches a KEYS or SCAN MATCH pattern
+// "*" matches every key without scanning it; an empty pattern matches only
+// the empty key, as in Redis
+func MatchPattern(pattern, key string) bool {
+	switch pattern {
+	case "*":
+		return true
+	case "":
+		return key == ""
+	}
+	return GlobMatch(pattern, key)
+}
+
+// globMatchByte matches c against the single-byte pattern element at p (not
+// "*") and returns the width of that element in the pattern
+func globMatchByte(pattern string, p int, c byte) (int, bool) {
+	switch pattern[p] {
+	case '?':
+		return 1, true
+	case '[':
+		return globMatchClass(pattern, p, c)
+	case '\\':
+		if p+1 < len(pattern) {
+			return 2, pattern[p+1] == c
+		}
+	}
+	return 1, pattern[p] == c
+}
+
+// globMatchClass matches c against the [...] class starting at p and returns
+// the width of the class in the pattern
+func globMatchClass(pattern string, p int, c byte) (int, bool) {
+	i := p + 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+
+	matched := false
+	for i < len(pattern) && pattern[i] != ']' {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			if pattern[i] == c {
+				matched = true
+			}
+		case i+2 < len(pattern) && pattern[i+1] == '-':
+			lo, hi := pattern[i], pattern[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			i += 2
+		case pattern[i] == c:
+			matched = true
+		}
+		i++
+	}
+	if i < len(pattern) {
+		i++ // Closing ]
+	}
+	return i - p, matched != negate
+}
+
+// globLiteralPrefix returns the part of pattern before its first special
+// character; every string the pattern matches starts with it
+func globLiteralPrefix(pattern string) string {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[', '\\':
+			return pattern[:i]
+		}
+	}
+	return pattern
+}
@@ -0,0 +1,88 @@
+package storage
+
+import "testing"
+
+// Glob semantics follow Redis's stringmatchlen
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, str string
+		want         bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"**", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "users:1", false},
+		{"*a*b", "xaxxb", true},
+		{"a*b", "acbd", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"?", "", false},
+		{"?", "é", false}, // Two bytes
+		{"??", "é", true},
+		{"a?b", "a\x00b", true},
+
+		// Escaped metacharacters match themselves only
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{`h\?llo`, "h?llo", true},
+		{`h\?llo`, "hello", false},
+		{`\[a]`, "[a]", true},
+		{`\[a]`, "a", false},
+		{`a\b`, "ab", true},
+
+		// Classes, negated with ^ only: [!...] lists "!" like any byte
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[!e]llo", "h!llo", true},
+		{"h[!e]llo", "hallo", false},
+		{`[\]]`, "]", true},
+		{`[\^]`, "^", true},
+		{`[\^]`, "a", false},
+
+		// Ranges, reversed ones included
+		{"[a-c]", "b", true},
+		{"[a-c]", "d", false},
+		{"[c-a]", "b", true},
+		{"[^a-c]", "b", false},
+		{"[^a-c]", "d", true},
+		{"[0-9a-f]x", "ex", true},
+
+		// A trailing backslash matches a backslash
+		{`a\`, `a\`, true},
+		{`a\`, "a", false},
+
+		// An unterminated class ends with the pattern
+		{"x[ab", "xa", true},
+		{"x[ab", "xc", false},
+		{"x[", "x", false},
+		{"x[", "x[", false},
+	}
+	for _, tt := range tests {
+		if got := GlobMatch(tt.pattern, tt.str); got != tt.want {
+			t.Errorf("GlobMatch(%q, %q) = %v, want %v", tt.pattern, tt.str, got, tt.want)
+		}
+	}
+}
+
+// An empty KEYS pattern matches only the empty key, while "*" matches every key
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"", "", true},
+		{"", "k", false},
+		{"*", "", true},
+		{"*", "k", true},
+		{`k\*`, "k*", true},
+		{`k\*`, "kx", false},
+	}
+	for _, tt := range tests {
+		if got := MatchPattern(tt.pattern, tt.key); got != tt.want {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
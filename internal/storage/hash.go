@@ -1,97 +1,398 @@
 package storage
 
+import (
+	"math/rand"
+	"time"
+)
+
+// Default hash-max-listpack-entries / hash-max-listpack-value thresholds (Redis defaults)
+const (
+	DefaultHashMaxListpackEntries = 128
+	DefaultHashMaxListpackValue   = 64
+)
+
 // Hash represents a Redis hash (field-value map)
+// Small hashes use the compact listpack encoding: one slice of field-value
+// pairs in insertion order, searched linearly. Once a hash grows past
+// maxListpackEntries fields or gets a field or value longer than
+// maxListpackValue bytes it switches to the hashtable encoding, as soon as
+// the write that crosses the threshold happens
 type Hash struct {
-	Fields map[string]string
+	listpack []hashEntry       // Field-value pairs while listpack-encoded (dict == nil)
+	dict     map[string]string // Field-value map once hashtable-encoded
+
+	// expires holds per-field expiry times set by HEXPIRE and friends.
+	// It stays nil until the first field gets a TTL.
+	expires map[string]time.Time
+
+	maxListpackEntries int
+	maxListpackValue   int
+}
+
+// hashEntry is one field-value pair of a listpack-encoded hash
+type hashEntry struct {
+	field string
+	value string
 }
 
-// NewHash creates a new empty hash
+// NewHash creates a new empty listpack-encoded hash with the default thresholds
 func NewHash() *Hash {
+	return newHashWithLimits(DefaultHashMaxListpackEntries, DefaultHashMaxListpackValue)
+}
+
+// newHashWithLimits creates a new empty listpack-encoded hash that converts
+// to hashtable past the given thresholds
+func newHashWithLimits(maxEntries, maxValue int) *Hash {
 	return &Hash{
-		Fields: make(map[string]string),
+		listpack:           make([]hashEntry, 0),
+		maxListpackEntries: maxEntries,
+		maxListpackValue:   maxValue,
 	}
 }
 
 // Clone creates a deep copy of the hash (for copy-on-write)
 func (h *Hash) Clone() *Hash {
-	if h == nil || len(h.Fields) == 0 {
+	if h == nil {
 		return NewHash()
 	}
 
-	newHash := &Hash{
-		Fields: make(map[string]string, len(h.Fields)),
+	newHash := newHashWithLimits(h.maxListpackEntries, h.maxListpackValue)
+	if h.Len() == 0 {
+		return newHash
+	}
+	if h.IsListpack() {
+		newHash.listpack = make([]hashEntry, len(h.listpack))
+		copy(newHash.listpack, h.listpack)
+	} else {
+		newHash.dict = make(map[string]string, len(h.dict))
+		for k, v := range h.dict {
+			newHash.dict[k] = v
+		}
 	}
-	for k, v := range h.Fields {
-		newHash.Fields[k] = v
+	if len(h.expires) > 0 {
+		newHash.expires = make(map[string]time.Time, len(h.expires))
+		for k, t := range h.expires {
+			newHash.expires[k] = t
+		}
 	}
 	return newHash
 }
 
+// IsListpack reports whether the hash currently uses the listpack encoding
+func (h *Hash) IsListpack() bool {
+	return h.dict == nil
+}
+
+// setListpackLimits applies new thresholds to a hash, such as one decoded by
+// RESTORE, and switches it to hashtable if it already exceeds them
+// Like Redis, a converted hash never goes back to listpack
+func (h *Hash) setListpackLimits(maxEntries, maxValue int) {
+	h.maxListpackEntries = maxEntries
+	h.maxListpackValue = maxValue
+	if !h.IsListpack() {
+		return
+	}
+
+	oversized := len(h.listpack) > maxEntries
+	for _, e := range h.listpack {
+		if oversized {
+			break
+		}
+		oversized = len(e.field) > maxValue || len(e.value) > maxValue
+	}
+	if oversized {
+		h.convertToHashtable()
+	}
+}
+
+// convertToHashtable moves the listpack entries into a hash map
+func (h *Hash) convertToHashtable() {
+	h.dict = make(map[string]string, len(h.listpack))
+	for _, e := range h.listpack {
+		h.dict[e.field] = e.value
+	}
+	h.listpack = nil
+}
+
+// listpackIndex returns the position of field in the listpack, or -1
+func (h *Hash) listpackIndex(field string) int {
+	for i, e := range h.listpack {
+		if e.field == field {
+			return i
+		}
+	}
+	return -1
+}
+
+// remove deletes a field without touching its TTL, returns true if it existed
+func (h *Hash) remove(field string) bool {
+	if !h.IsListpack() {
+		_, exists := h.dict[field]
+		delete(h.dict, field)
+		return exists
+	}
+
+	i := h.listpackIndex(field)
+	if i < 0 {
+		return false
+	}
+	h.listpack = append(h.listpack[:i], h.listpack[i+1:]...)
+	return true
+}
+
 // Set sets a field to a value, returns true if field is new
+// Overwriting a field clears its TTL, as in Redis
 func (h *Hash) Set(field, value string) bool {
-	_, exists := h.Fields[field]
-	h.Fields[field] = value
-	return !exists
+	delete(h.expires, field)
+
+	if !h.IsListpack() {
+		_, exists := h.dict[field]
+		h.dict[field] = value
+		return !exists
+	}
+
+	i := h.listpackIndex(field)
+	if len(value) > h.maxListpackValue || (i < 0 && !h.fitsListpack(field)) {
+		h.convertToHashtable()
+		_, exists := h.dict[field]
+		h.dict[field] = value
+		return !exists
+	}
+
+	if i >= 0 {
+		h.listpack[i].value = value
+		return false
+	}
+	h.listpack = append(h.listpack, hashEntry{field: field, value: value})
+	return true
+}
+
+// fitsListpack reports whether adding field keeps the hash within the listpack thresholds
+func (h *Hash) fitsListpack(field string) bool {
+	return len(h.listpack) < h.maxListpackEntries && len(field) <= h.maxListpackValue
 }
 
 // Get returns the value of a field
 func (h *Hash) Get(field string) (string, bool) {
-	val, exists := h.Fields[field]
-	return val, exists
+	if !h.IsListpack() {
+		val, exists := h.dict[field]
+		return val, exists
+	}
+
+	if i := h.listpackIndex(field); i >= 0 {
+		return h.listpack[i].value, true
+	}
+	return "", false
 }
 
 // Delete removes a field, returns true if field existed
 func (h *Hash) Delete(field string) bool {
-	_, exists := h.Fields[field]
+	exists := h.remove(field)
 	if exists {
-		delete(h.Fields, field)
+		delete(h.expires, field)
 	}
 	return exists
 }
 
 // Exists checks if a field exists
 func (h *Hash) Exists(field string) bool {
-	_, exists := h.Fields[field]
+	_, exists := h.Get(field)
 	return exists
 }
 
 // Len returns the number of fields
 func (h *Hash) Len() int {
-	return len(h.Fields)
+	if !h.IsListpack() {
+		return len(h.dict)
+	}
+	return len(h.listpack)
 }
 
 // Keys returns all field names
 func (h *Hash) Keys() []string {
-	keys := make([]string, 0, len(h.Fields))
-	for k := range h.Fields {
-		keys = append(keys, k)
+	keys := make([]string, 0, h.Len())
+	if !h.IsListpack() {
+		for k := range h.dict {
+			keys = append(keys, k)
+		}
+		return keys
+	}
+
+	for _, e := range h.listpack {
+		keys = append(keys, e.field)
 	}
 	return keys
 }
 
 // Values returns all values
 func (h *Hash) Values() []string {
-	vals := make([]string, 0, len(h.Fields))
-	for _, v := range h.Fields {
-		vals = append(vals, v)
+	vals := make([]string, 0, h.Len())
+	if !h.IsListpack() {
+		for _, v := range h.dict {
+			vals = append(vals, v)
+		}
+		return vals
+	}
+
+	for _, e := range h.listpack {
+		vals = append(vals, e.value)
 	}
 	return vals
 }
 
 // GetAll returns all fields and values as alternating slice [field1, val1, field2, val2, ...]
+// Fields whose TTL has passed are left out, so snapshots taken from a hash
+// that no read has purged yet don't bring them back
 func (h *Hash) GetAll() []string {
-	result := make([]string, 0, len(h.Fields)*2)
-	for k, v := range h.Fields {
-		result = append(result, k, v)
+	now := time.Now()
+	result := make([]string, 0, h.Len()*2)
+	if !h.IsListpack() {
+		for k, v := range h.dict {
+			if !h.fieldExpired(k, now) {
+				result = append(result, k, v)
+			}
+		}
+		return result
+	}
+
+	for _, e := range h.listpack {
+		if !h.fieldExpired(e.field, now) {
+			result = append(result, e.field, e.value)
+		}
 	}
 	return result
 }
 
+// forEachSample calls fn for up to n field-value pairs, in no particular order
+func (h *Hash) forEachSample(n int, fn func(field, value string)) {
+	if h.IsListpack() {
+		for _, e := range h.listpack[:min(n, len(h.listpack))] {
+			fn(e.field, e.value)
+		}
+		return
+	}
+	for field, value := range h.dict {
+		if n == 0 {
+			return
+		}
+		fn(field, value)
+		n--
+	}
+}
+
 // SetNX sets field only if it doesn't exist, returns true if set
 func (h *Hash) SetNX(field, value string) bool {
-	if _, exists := h.Fields[field]; exists {
+	if h.Exists(field) {
 		return false
 	}
-	h.Fields[field] = value
+	h.Set(field, value)
 	return true
 }
+
+// MaxRandomCount bounds a negative HRANDFIELD or SRANDMEMBER count: the
+// repeated picks are allocated up front, so -count can't be left to the client
+const MaxRandomCount = 1 << 22
+
+// RandomFields returns random fields (with their values if withValues is set)
+// A positive count returns up to count distinct fields; a negative count
+// returns exactly -count fields (at most MaxRandomCount) and may repeat
+// them, like HRANDFIELD
+func (h *Hash) RandomFields(count int, withValues bool) []string {
+	if h.Len() == 0 || count == 0 {
+		return []string{}
+	}
+	if count < -MaxRandomCount {
+		count = -MaxRandomCount
+	}
+
+	fields := h.Keys()
+	var picked []string
+
+	if count < 0 {
+		picked = make([]string, -count)
+		for i := range picked {
+			picked[i] = fields[rand.Intn(len(fields))]
+		}
+	} else {
+		if count > len(fields) {
+			count = len(fields)
+		}
+		rand.Shuffle(len(fields), func(i, j int) {
+			fields[i], fields[j] = fields[j], fields[i]
+		})
+		picked = fields[:count]
+	}
+
+	if !withValues {
+		return picked
+	}
+
+	result := make([]string, 0, len(picked)*2)
+	for _, field := range picked {
+		value, _ := h.Get(field)
+		result = append(result, field, value)
+	}
+	return result
+}
+
+// SetFieldExpiry sets the expiry time of an existing field, returns false if the field doesn't exist
+func (h *Hash) SetFieldExpiry(field string, at time.Time) bool {
+	if !h.Exists(field) {
+		return false
+	}
+	if h.expires == nil {
+		h.expires = make(map[string]time.Time)
+	}
+	h.expires[field] = at
+	return true
+}
+
+// FieldExpiry returns the expiry time of a field and whether it has one
+func (h *Hash) FieldExpiry(field string) (time.Time, bool) {
+	at, ok := h.expires[field]
+	return at, ok
+}
+
+// HasFieldExpiries reports whether any field has a TTL
+func (h *Hash) HasFieldExpiries() bool {
+	return len(h.expires) > 0
+}
+
+// fieldExpired reports whether field has a TTL that has passed at now
+func (h *Hash) fieldExpired(field string, now time.Time) bool {
+	at, ok := h.expires[field]
+	return ok && !now.Before(at)
+}
+
+// PersistField removes the TTL of a field, returns true if it had one
+func (h *Hash) PersistField(field string) bool {
+	if _, ok := h.expires[field]; !ok {
+		return false
+	}
+	delete(h.expires, field)
+	return true
+}
+
+// hasExpiredFields reports whether any field's TTL has passed at now
+func (h *Hash) hasExpiredFields(now time.Time) bool {
+	for _, at := range h.expires {
+		if !now.Before(at) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeExpiredFields deletes every field whose TTL has passed at now,
+// returns the number of fields removed
+func (h *Hash) removeExpiredFields(now time.Time) int {
+	removed := 0
+	for field, at := range h.expires {
+		if !now.Before(at) {
+			h.remove(field)
+			delete(h.expires, field)
+			removed++
+		}
+	}
+	return removed
+}
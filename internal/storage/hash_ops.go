@@ -1,23 +1,30 @@
 package storage
 
 import (
+	"context"
 	"strconv"
 	"time"
 )
 
 // ==================== HASH OPERATIONS ====================
 
+// newHash creates an empty hash using the store's listpack thresholds
+func (s *Store) newHash() *Hash {
+	return newHashWithLimits(s.hashMaxListpackEntries, s.hashMaxListpackValue)
+}
+
 // getOrCreateHash returns existing hash or creates new one
 func (s *Store) getOrCreateHash(key string) (*Hash, bool) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
-		return NewHash(), true // New hash
+		return s.newHash(), true // New hash
 	}
 
-	// Check expiry
-	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
-		return NewHash(), true // Expired, treat as new
+	// Check expiry; with passive expiry the write comes from the master,
+	// which still has the key, so it applies to the existing value
+	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) && !s.isPassiveExpiry() {
+		s.expireKey(key)
+		return s.newHash(), true // Expired, treat as new
 	}
 
 	// Check type
@@ -27,20 +34,23 @@ func (s *Store) getOrCreateHash(key string) (*Hash, bool) {
 
 	// Check if existing value is a hash
 	if hash, ok := val.Data.(*Hash); ok {
+		if hash = s.purgeExpiredFields(key, hash); hash == nil {
+			return s.newHash(), true // Every field expired, treat as new
+		}
 		return hash, true
 	}
-	return NewHash(), true
+	return s.newHash(), true
 }
 
 // getExistingHash returns existing hash or nil
 func (s *Store) getExistingHash(key string) (*Hash, error) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
 		return nil, nil // Key doesn't exist
 	}
 
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return nil, nil
 	}
 
@@ -49,11 +59,34 @@ func (s *Store) getExistingHash(key string) (*Hash, error) {
 	}
 
 	if hash, ok := val.Data.(*Hash); ok {
-		return hash, nil
+		return s.purgeExpiredFields(key, hash), nil
 	}
 	return nil, nil
 }
 
+// purgeExpiredFields drops fields whose TTL has passed so that no hash read
+// can see them. Returns the (possibly cloned) hash, or nil if every field
+// expired, in which case the key itself is expired.
+func (s *Store) purgeExpiredFields(key string, hash *Hash) *Hash {
+	now := time.Now()
+	if !hash.hasExpiredFields(now) {
+		return hash
+	}
+
+	// Copy-on-write: clone hash if snapshot is active
+	if s.isSnapshotActive() {
+		hash = hash.Clone()
+	}
+	hash.removeExpiredFields(now)
+
+	if hash.Len() == 0 {
+		s.expireKey(key)
+		return nil
+	}
+	s.saveHash(key, hash)
+	return hash
+}
+
 // saveHash saves the hash to storage
 func (s *Store) saveHash(key string, hash *Hash) {
 	if hash.Len() == 0 {
@@ -61,11 +94,11 @@ func (s *Store) saveHash(key string, hash *Hash) {
 		return
 	}
 
-	s.data[key] = &Value{
+	s.putData(key, &Value{
 		Data:      hash,
-		ExpiresAt: nil,
+		ExpiresAt: s.currentExpiry(key),
 		Type:      HashType,
-	}
+	})
 }
 
 // HSet sets field(s) in hash, returns number of new fields added
@@ -207,6 +240,11 @@ func (s *Store) HVals(key string) ([]string, error) {
 
 // HGetAll returns all fields and values
 func (s *Store) HGetAll(key string) ([]string, error) {
+	return s.HGetAllContext(context.Background(), key)
+}
+
+// HGetAllContext is HGetAll that aborts with ErrCommandTimeout when ctx is done
+func (s *Store) HGetAllContext(ctx context.Context, key string) ([]string, error) {
 	hash, err := s.getExistingHash(key)
 	if err != nil {
 		return nil, err
@@ -214,7 +252,25 @@ func (s *Store) HGetAll(key string) ([]string, error) {
 	if hash == nil {
 		return []string{}, nil
 	}
-	return hash.GetAll(), nil
+
+	// A listpack holds at most hash-max-listpack-entries fields
+	if hash.IsListpack() {
+		return hash.GetAll(), nil
+	}
+
+	now := time.Now()
+	result := make([]string, 0, len(hash.dict)*2)
+	i := 0
+	for field, value := range hash.dict {
+		if err := checkCanceled(ctx, i); err != nil {
+			return nil, err
+		}
+		i++
+		if !hash.fieldExpired(field, now) {
+			result = append(result, field, value)
+		}
+	}
+	return result, nil
 }
 
 // HSetNX sets field only if it doesn't exist
@@ -274,3 +330,226 @@ func (s *Store) HIncrByFloat(key, field string, increment float64) (float64, err
 	s.saveHash(key, hash)
 	return newVal, nil
 }
+
+// HRandField returns random fields from a hash (see Hash.RandomFields)
+// Returns ErrCountOutOfRange if a negative count asks for more than
+// MaxRandomCount fields
+func (s *Store) HRandField(key string, count int, withValues bool) ([]string, error) {
+	if count < -MaxRandomCount {
+		return nil, ErrCountOutOfRange
+	}
+	hash, err := s.getExistingHash(key)
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil {
+		return []string{}, nil
+	}
+	return hash.RandomFields(count, withValues), nil
+}
+
+// Per-field expiry reply codes shared by HEXPIRE, HTTL and HPERSIST
+const (
+	HashFieldMissing    = -2 // Field (or key) doesn't exist
+	HashFieldNoExpiry   = -1 // Field exists but has no TTL
+	HashFieldNotSet     = 0  // NX/XX/GT/LT condition not met
+	HashFieldExpirySet  = 1  // TTL set (HEXPIRE) or removed (HPERSIST)
+	HashFieldExpiredNow = 2  // Expiry time already passed, field deleted
+)
+
+// HExpireAt sets the expiry of hash fields to at, honoring the NX/XX/GT/LT
+// condition (empty for none). Returns one reply code per field.
+func (s *Store) HExpireAt(key string, at time.Time, condition string, fields []string) ([]int, error) {
+	result := make([]int, len(fields))
+	hash, err := s.getExistingHash(key)
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil {
+		for i := range result {
+			result[i] = HashFieldMissing
+		}
+		return result, nil
+	}
+
+	// Copy-on-write: clone hash if snapshot is active
+	if s.isSnapshotActive() {
+		hash = hash.Clone()
+	}
+
+	now := time.Now()
+	for i, field := range fields {
+		if !hash.Exists(field) {
+			result[i] = HashFieldMissing
+			continue
+		}
+
+		current, hasTTL := hash.FieldExpiry(field)
+		switch condition {
+		case "NX":
+			if hasTTL {
+				result[i] = HashFieldNotSet
+				continue
+			}
+		case "XX":
+			if !hasTTL {
+				result[i] = HashFieldNotSet
+				continue
+			}
+		case "GT":
+			// A field without TTL counts as infinite
+			if !hasTTL || !at.After(current) {
+				result[i] = HashFieldNotSet
+				continue
+			}
+		case "LT":
+			if hasTTL && !at.Before(current) {
+				result[i] = HashFieldNotSet
+				continue
+			}
+		}
+
+		if !now.Before(at) {
+			hash.Delete(field)
+			result[i] = HashFieldExpiredNow
+			continue
+		}
+		hash.SetFieldExpiry(field, at)
+		result[i] = HashFieldExpirySet
+	}
+
+	s.saveHash(key, hash)
+	return result, nil
+}
+
+// HFieldTTL returns the remaining TTL of each field in milliseconds, or
+// HashFieldMissing / HashFieldNoExpiry for fields without one
+func (s *Store) HFieldTTL(key string, fields []string) ([]int64, error) {
+	result := make([]int64, len(fields))
+	hash, err := s.getExistingHash(key)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, field := range fields {
+		if hash == nil || !hash.Exists(field) {
+			result[i] = HashFieldMissing
+			continue
+		}
+		at, hasTTL := hash.FieldExpiry(field)
+		if !hasTTL {
+			result[i] = HashFieldNoExpiry
+			continue
+		}
+		result[i] = time.Until(at).Milliseconds()
+	}
+	return result, nil
+}
+
+// HPersist removes the TTL of hash fields, returns one reply code per field
+func (s *Store) HPersist(key string, fields []string) ([]int, error) {
+	result := make([]int, len(fields))
+	hash, err := s.getExistingHash(key)
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil {
+		for i := range result {
+			result[i] = HashFieldMissing
+		}
+		return result, nil
+	}
+
+	// Copy-on-write: clone hash if snapshot is active
+	if s.isSnapshotActive() {
+		hash = hash.Clone()
+	}
+
+	for i, field := range fields {
+		switch {
+		case !hash.Exists(field):
+			result[i] = HashFieldMissing
+		case hash.PersistField(field):
+			result[i] = HashFieldExpirySet
+		default:
+			result[i] = HashFieldNoExpiry
+		}
+	}
+
+	s.saveHash(key, hash)
+	return result, nil
+}
+
+// HGetDel returns the values of hash fields (nil for missing ones) and
+// deletes them; the key is removed once its last field is gone
+func (s *Store) HGetDel(key string, fields []string) ([]interface{}, error) {
+	result := make([]interface{}, len(fields))
+	hash, err := s.getExistingHash(key)
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil {
+		return result, nil
+	}
+
+	// Copy-on-write: clone hash if snapshot is active
+	if s.isSnapshotActive() {
+		hash = hash.Clone()
+	}
+
+	for i, field := range fields {
+		if val, exists := hash.Get(field); exists {
+			result[i] = val
+			hash.Delete(field)
+		}
+	}
+
+	s.saveHash(key, hash)
+	return result, nil
+}
+
+// HGetEx returns the values of hash fields (nil for missing ones) and sets
+// their expiry to at, or removes it when persist is true; with neither it
+// only reads. A time that already passed deletes the fields after reading them
+func (s *Store) HGetEx(key string, fields []string, at *time.Time, persist bool) ([]interface{}, error) {
+	result := make([]interface{}, len(fields))
+	hash, err := s.getExistingHash(key)
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil {
+		return result, nil
+	}
+
+	for i, field := range fields {
+		if val, exists := hash.Get(field); exists {
+			result[i] = val
+		}
+	}
+	if at == nil && !persist {
+		return result, nil
+	}
+
+	// Copy-on-write: clone hash if snapshot is active
+	if s.isSnapshotActive() {
+		hash = hash.Clone()
+	}
+
+	now := time.Now()
+	for i, field := range fields {
+		if result[i] == nil {
+			continue
+		}
+		switch {
+		case persist:
+			hash.PersistField(field)
+		case !now.Before(*at):
+			hash.Delete(field)
+		default:
+			hash.SetFieldExpiry(field, *at)
+		}
+	}
+
+	s.saveHash(key, hash)
+	return result, nil
+}
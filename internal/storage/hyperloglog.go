@@ -236,10 +236,10 @@ func (s *Store) PFAdd(key string, elements []string) (bool, error) {
 	}
 
 	// Save HLL back to storage
-	s.data[key] = &Value{
+	s.putData(key, &Value{
 		Data: hll,
 		Type: HyperLogLogType,
-	}
+	})
 
 	return updated, nil
 }
@@ -324,10 +324,10 @@ func (s *Store) PFMerge(destKey string, sourceKeys []string) error {
 	// If no sources exist, create empty HLL at destination
 	if len(sourceHLLs) == 0 {
 		emptyHLL := NewHyperLogLog(DefaultPrecision)
-		s.data[destKey] = &Value{
+		s.putData(destKey, &Value{
 			Data: emptyHLL,
 			Type: HyperLogLogType,
-		}
+		})
 		return nil
 	}
 
@@ -340,17 +340,17 @@ func (s *Store) PFMerge(destKey string, sourceKeys []string) error {
 	}
 
 	// Store at destination (overwrites if exists)
-	s.data[destKey] = &Value{
+	s.putData(destKey, &Value{
 		Data: destHLL,
 		Type: HyperLogLogType,
-	}
+	})
 
 	return nil
 }
 
 // getHyperLogLog retrieves a HyperLogLog from storage
 func (s *Store) getHyperLogLog(key string) (*HyperLogLog, error) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 
 	if !exists {
 		return nil, ErrKeyNotFound
@@ -358,7 +358,7 @@ func (s *Store) getHyperLogLog(key string) (*HyperLogLog, error) {
 
 	// Check expiry
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return nil, ErrKeyNotFound // Expired
 	}
 
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"hash/maphash"
+	"slices"
+	"sync"
+)
+
+// keyLocks is a fixed set of mutexes, one per stripe, that keys hash onto
+// Commands on keys of different stripes can hold their locks at the same
+// time; two commands on one key always share a stripe and run one by one
+type keyLocks struct {
+	seed    maphash.Seed
+	stripes []sync.Mutex
+}
+
+func newKeyLocks(n int) *keyLocks {
+	return &keyLocks{
+		seed:    maphash.MakeSeed(),
+		stripes: make([]sync.Mutex, n),
+	}
+}
+
+// stripeOf returns the stripe key hashes onto
+func (l *keyLocks) stripeOf(key string) int {
+	return int(maphash.String(l.seed, key) % uint64(len(l.stripes)))
+}
+
+// lock locks the stripes of keys and returns the function that unlocks them
+// Stripes are locked in ascending order, each once, so two commands locking
+// overlapping sets of stripes can't deadlock
+func (l *keyLocks) lock(keys []string) func() {
+	stripes := make([]int, len(keys))
+	for i, key := range keys {
+		stripes[i] = l.stripeOf(key)
+	}
+	slices.Sort(stripes)
+	stripes = slices.Compact(stripes)
+
+	for _, i := range stripes {
+		l.stripes[i].Lock()
+	}
+	return func() {
+		for i := len(stripes) - 1; i >= 0; i-- {
+			l.stripes[stripes[i]].Unlock()
+		}
+	}
+}
+
+// SetKeyLockStripes turns on per-key locking with n stripes (key-lock-stripes)
+// It must be called before the store is used; n <= 0 leaves it off
+func (s *Store) SetKeyLockStripes(n int) {
+	if n <= 0 {
+		s.keyLocks = nil
+		return
+	}
+	s.keyLocks = newKeyLocks(n)
+}
+
+// KeyLocksEnabled reports whether per-key locking is on
+func (s *Store) KeyLocksEnabled() bool {
+	return s.keyLocks != nil
+}
+
+// LockKeys locks the stripes of keys and returns the function that unlocks
+// them. While a caller holds the stripes of its keys, it may run the store
+// methods of single-key string commands concurrently with other holders:
+// the keyspace maps, the SCAN index and the expiry lists those methods share
+// are guarded by the store's own mutex. Anything else needs the caller to
+// exclude every stripe holder (the processor does, see processor.Submit)
+func (s *Store) LockKeys(keys ...string) func() {
+	return s.keyLocks.lock(keys)
+}
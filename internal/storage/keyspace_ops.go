@@ -0,0 +1,126 @@
+package storage
+
+import "time"
+
+// ==================== COPY / DUMP / RESTORE ====================
+
+// liveValue returns the value at key, expiring it first if its TTL has passed
+func (s *Store) liveValue(key string) (*Value, bool) {
+	val, exists := s.lookup(key)
+	if !exists {
+		return nil, false
+	}
+
+	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
+		s.expireKey(key)
+		return nil, false
+	}
+	return val, true
+}
+
+// cloneValue returns a deep copy of a value, including its TTL
+func cloneValue(val *Value) *Value {
+	clone := &Value{
+		Data:      val.Data,
+		ExpiresAt: copyTimePtr(val.ExpiresAt),
+		Type:      val.Type,
+		Negative:  val.Negative,
+
+		SlidingTTL:        val.SlidingTTL,
+		slidingPropagated: val.slidingPropagated,
+	}
+
+	switch data := val.Data.(type) {
+	case *List:
+		clone.Data = data.Clone()
+	case *Set:
+		clone.Data = data.Clone()
+	case *Hash:
+		clone.Data = data.Clone()
+	case *ZSet:
+		clone.Data = data.Clone()
+	case *BloomFilter:
+		clone.Data = data.Clone()
+	case *CuckooFilter:
+		clone.Data = data.Clone()
+	case *CountMinSketch:
+		clone.Data = data.Clone()
+	case *HyperLogLog:
+		clone.Data = data.Clone()
+	}
+	// Strings (string / int64) are immutable and shared as is
+
+	return clone
+}
+
+// setValue stores val at key, replacing whatever was there, and keeps the
+// expiry index in sync with the value's TTL
+func (s *Store) setValue(key string, val *Value) {
+	s.putData(key, val)
+	s.indexExpiry(key, val.ExpiresAt)
+}
+
+// Copy copies the value at src to dst, keeping its remaining TTL
+// Returns false if src does not exist, or dst exists and replace is false
+func (s *Store) Copy(src, dst string, replace bool) bool {
+	val, exists := s.liveValue(src)
+	if !exists {
+		return false
+	}
+
+	if _, exists := s.liveValue(dst); exists && !replace {
+		return false
+	}
+
+	s.setValue(dst, cloneValue(val))
+	return true
+}
+
+// DumpValue returns a deep copy of the value at key, so it can be serialized
+// outside the processor goroutine
+// Returns false if the key does not exist
+func (s *Store) DumpValue(key string) (*Value, bool) {
+	val, exists := s.liveValue(key)
+	if !exists {
+		return nil, false
+	}
+	return cloneValue(val), true
+}
+
+// Restore stores a value decoded from a DUMP payload at key with the given
+// expiry (nil for none)
+// Returns ErrBusyKey if the key exists and replace is false
+func (s *Store) Restore(key string, val *Value, expiresAt *time.Time, replace bool) error {
+	if _, exists := s.liveValue(key); exists && !replace {
+		return ErrBusyKey
+	}
+
+	// Re-apply this server's encoding thresholds to the decoded aggregate
+	switch data := val.Data.(type) {
+	case string:
+		val.Data = encodeStringValue(data)
+	case *List:
+		data.convertIfOversized(s.listMaxListpackSize)
+	case *Set:
+		data.convertIfOversized(s.setMaxIntsetEntries)
+	case *Hash:
+		data.setListpackLimits(s.hashMaxListpackEntries, s.hashMaxListpackValue)
+	case *ZSet:
+		zset := s.newZSet()
+		for _, member := range data.GetAll() {
+			zset.Add(member.Member, member.Score)
+		}
+		val.Data = zset
+	}
+
+	val.ExpiresAt = expiresAt
+	if expiresAt == nil {
+		// A sliding window needs a deadline to slide, and a tombstone one to expire
+		val.SlidingTTL = 0
+		val.Negative = false
+	} else if val.SlidingTTL != 0 {
+		val.slidingPropagated = *expiresAt
+	}
+	s.setValue(key, val)
+	return nil
+}
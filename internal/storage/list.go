@@ -1,5 +1,7 @@
 package storage
 
+import "context"
+
 // ==================== DOUBLY LINKED LIST ====================
 
 // ListNode represents a node in the doubly linked list
@@ -9,20 +11,79 @@ type ListNode struct {
 	Next  *ListNode
 }
 
-// List represents a doubly linked list
+// entries returns the number of elements the node holds
+// Unlike a Redis quicklist node, which packs up to list-max-listpack-size
+// elements, a node here holds a single one
+func (n *ListNode) entries() int {
+	return 1
+}
+
+// List represents a Redis list
+// Small lists use the compact listpack encoding: one slice holding the
+// elements in order. Once a list grows past list-max-listpack-size it
+// switches to the quicklist encoding, a doubly linked list of nodes, when the
+// write that crosses the threshold is saved
 type List struct {
-	Head   *ListNode
-	Tail   *ListNode
-	Length int
+	Head      *ListNode // First node once quicklist-encoded (nil while listpack)
+	Tail      *ListNode // Last node once quicklist-encoded (nil while listpack)
+	Length    int
+	listpack  []string // Elements while listpack-encoded (quicklist == false)
+	quicklist bool     // True once converted; the elements are then in the nodes
 }
 
-// NewList creates a new empty list
+// NewList creates a new empty listpack-encoded list
 func NewList() *List {
-	return &List{
-		Head:   nil,
-		Tail:   nil,
-		Length: 0,
+	return &List{}
+}
+
+// IsListpack reports whether the list currently uses the listpack encoding
+func (l *List) IsListpack() bool {
+	return !l.quicklist
+}
+
+// convertIfOversized switches the list to quicklist once it exceeds maxSize
+// A positive maxSize limits the number of elements, a negative one the total
+// element bytes (-1 = 4KB, -2 = 8KB, ... -5 = 64KB), like list-max-listpack-size
+// Like Redis sets and sorted sets here, the list never converts back
+func (l *List) convertIfOversized(maxSize int) {
+	if l.quicklist {
+		return
+	}
+	if maxSize >= 0 {
+		if l.Length > maxSize {
+			l.convertToQuicklist()
+		}
+		return
+	}
+
+	limit := listpackByteLimit(maxSize)
+	size := 0
+	for _, value := range l.listpack {
+		size += len(value)
+		if size > limit {
+			l.convertToQuicklist()
+			return
+		}
+	}
+}
+
+// convertToQuicklist moves the listpack elements into linked nodes
+func (l *List) convertToQuicklist() {
+	elements := l.listpack
+	l.listpack = nil
+	l.quicklist = true
+	l.Length = 0
+	for _, value := range elements {
+		l.PushBack(value)
+	}
+}
+
+// listpackByteLimit maps a negative list-max-listpack-size to a byte limit
+func listpackByteLimit(maxSize int) int {
+	if maxSize < -5 {
+		maxSize = -5
 	}
+	return 4096 << (-maxSize - 1)
 }
 
 // Clone creates a deep copy of the list (for copy-on-write)
@@ -32,6 +93,14 @@ func (l *List) Clone() *List {
 	}
 
 	newList := NewList()
+	if !l.quicklist {
+		newList.listpack = make([]string, len(l.listpack))
+		copy(newList.listpack, l.listpack)
+		newList.Length = l.Length
+		return newList
+	}
+
+	newList.quicklist = true
 	current := l.Head
 	for current != nil {
 		newList.PushBack(current.Value)
@@ -40,8 +109,51 @@ func (l *List) Clone() *List {
 	return newList
 }
 
-// PushFront adds element to the head - O(1)
+// forEach calls fn with every element and its index, walking from the head
+// or from the tail, until fn returns false
+func (l *List) forEach(fromHead bool, fn func(index int, value string) bool) {
+	if !l.quicklist {
+		if fromHead {
+			for i, value := range l.listpack {
+				if !fn(i, value) {
+					return
+				}
+			}
+		} else {
+			for i := len(l.listpack) - 1; i >= 0; i-- {
+				if !fn(i, l.listpack[i]) {
+					return
+				}
+			}
+		}
+		return
+	}
+
+	if fromHead {
+		for node, index := l.Head, 0; node != nil; node, index = node.Next, index+1 {
+			if !fn(index, node.Value) {
+				return
+			}
+		}
+	} else {
+		for node, index := l.Tail, l.Length-1; node != nil; node, index = node.Prev, index-1 {
+			if !fn(index, node.Value) {
+				return
+			}
+		}
+	}
+}
+
+// PushFront adds element to the head - O(1), O(n) while listpack-encoded
 func (l *List) PushFront(value string) {
+	if !l.quicklist {
+		l.listpack = append(l.listpack, "")
+		copy(l.listpack[1:], l.listpack)
+		l.listpack[0] = value
+		l.Length++
+		return
+	}
+
 	node := &ListNode{Value: value}
 
 	if l.Head == nil {
@@ -57,6 +169,12 @@ func (l *List) PushFront(value string) {
 
 // PushBack adds element to the tail - O(1)
 func (l *List) PushBack(value string) {
+	if !l.quicklist {
+		l.listpack = append(l.listpack, value)
+		l.Length++
+		return
+	}
+
 	node := &ListNode{Value: value}
 
 	if l.Tail == nil {
@@ -70,12 +188,19 @@ func (l *List) PushBack(value string) {
 	l.Length++
 }
 
-// PopFront removes and returns the first element - O(1)
+// PopFront removes and returns the first element - O(1), O(n) while listpack-encoded
 func (l *List) PopFront() (string, bool) {
-	if l.Head == nil {
+	if l.Length == 0 {
 		return "", false
 	}
 
+	if !l.quicklist {
+		value := l.listpack[0]
+		l.listpack = append(l.listpack[:0], l.listpack[1:]...)
+		l.Length--
+		return value, true
+	}
+
 	value := l.Head.Value
 	l.Head = l.Head.Next
 
@@ -91,10 +216,17 @@ func (l *List) PopFront() (string, bool) {
 
 // PopBack removes and returns the last element - O(1)
 func (l *List) PopBack() (string, bool) {
-	if l.Tail == nil {
+	if l.Length == 0 {
 		return "", false
 	}
 
+	if !l.quicklist {
+		value := l.listpack[l.Length-1]
+		l.listpack = l.listpack[:l.Length-1]
+		l.Length--
+		return value, true
+	}
+
 	value := l.Tail.Value
 	l.Tail = l.Tail.Prev
 
@@ -108,8 +240,16 @@ func (l *List) PopBack() (string, bool) {
 	return value, true
 }
 
-// GetAt returns element at index - O(n)
+// GetAt returns element at index - O(n), O(1) while listpack-encoded
 func (l *List) GetAt(index int) (string, bool) {
+	if !l.quicklist {
+		i, ok := l.normalizeIndex(index)
+		if !ok {
+			return "", false
+		}
+		return l.listpack[i], true
+	}
+
 	node := l.getNodeAt(index)
 	if node == nil {
 		return "", false
@@ -117,8 +257,17 @@ func (l *List) GetAt(index int) (string, bool) {
 	return node.Value, true
 }
 
-// SetAt sets element at index - O(n)
+// SetAt sets element at index - O(n), O(1) while listpack-encoded
 func (l *List) SetAt(index int, value string) bool {
+	if !l.quicklist {
+		i, ok := l.normalizeIndex(index)
+		if !ok {
+			return false
+		}
+		l.listpack[i] = value
+		return true
+	}
+
 	node := l.getNodeAt(index)
 	if node == nil {
 		return false
@@ -127,18 +276,20 @@ func (l *List) SetAt(index int, value string) bool {
 	return true
 }
 
-// getNodeAt returns node at index (handles negative indices)
-func (l *List) getNodeAt(index int) *ListNode {
-	if l.Length == 0 {
-		return nil
-	}
-
-	// Handle negative index
+// normalizeIndex resolves a negative index from the tail and reports whether
+// the index is within the list
+func (l *List) normalizeIndex(index int) (int, bool) {
 	if index < 0 {
 		index = l.Length + index
 	}
+	return index, index >= 0 && index < l.Length
+}
 
-	if index < 0 || index >= l.Length {
+// getNodeAt returns node at index (handles negative indices)
+// Only quicklist-encoded lists have nodes
+func (l *List) getNodeAt(index int) *ListNode {
+	index, ok := l.normalizeIndex(index)
+	if !ok || !l.quicklist {
 		return nil
 	}
 
@@ -162,8 +313,42 @@ func (l *List) getNodeAt(index int) *ListNode {
 
 // Range returns elements from start to stop (inclusive) - O(n)
 func (l *List) Range(start, stop int) []string {
+	result, _ := l.RangeContext(context.Background(), start, stop)
+	return result
+}
+
+// RangeContext is Range that aborts with ErrCommandTimeout when ctx is done
+func (l *List) RangeContext(ctx context.Context, start, stop int) ([]string, error) {
+	start, stop, ok := l.clampRange(start, stop)
+	if !ok {
+		return []string{}, nil
+	}
+
+	if !l.quicklist {
+		result := make([]string, stop-start+1)
+		copy(result, l.listpack[start:stop+1])
+		return result, nil
+	}
+
+	result := make([]string, 0, stop-start+1)
+	node := l.getNodeAt(start)
+
+	for i := start; i <= stop && node != nil; i++ {
+		if err := checkCanceled(ctx, i-start); err != nil {
+			return nil, err
+		}
+		result = append(result, node.Value)
+		node = node.Next
+	}
+
+	return result, nil
+}
+
+// clampRange resolves negative indices of an inclusive range and clamps it
+// to the list; returns false if the range is empty
+func (l *List) clampRange(start, stop int) (int, int, bool) {
 	if l.Length == 0 {
-		return []string{}
+		return 0, 0, false
 	}
 
 	// Handle negative indices
@@ -182,33 +367,110 @@ func (l *List) Range(start, stop int) []string {
 		stop = l.Length - 1
 	}
 
-	if start > stop || start >= l.Length {
-		return []string{}
-	}
+	return start, stop, start <= stop && start < l.Length
+}
 
-	result := make([]string, 0, stop-start+1)
-	node := l.getNodeAt(start)
+// ToSlice converts list to slice - O(n)
+func (l *List) ToSlice() []string {
+	result := make([]string, 0, l.Length)
+	l.forEach(true, func(_ int, value string) bool {
+		result = append(result, value)
+		return true
+	})
+	return result
+}
 
-	for i := start; i <= stop && node != nil; i++ {
-		result = append(result, node.Value)
-		node = node.Next
+// Remove deletes up to limit elements equal to value, scanning from the head
+// or from the tail, and returns how many were removed - O(n)
+func (l *List) Remove(value string, limit int, fromHead bool) int {
+	removed := 0
+	if !l.quicklist {
+		kept := l.listpack[:0]
+		if fromHead {
+			for _, v := range l.listpack {
+				if v == value && removed < limit {
+					removed++
+					continue
+				}
+				kept = append(kept, v)
+			}
+		} else {
+			// Keep the elements in place, compacting towards the tail
+			n := len(l.listpack)
+			for i := n - 1; i >= 0; i-- {
+				if v := l.listpack[i]; v == value && removed < limit {
+					removed++
+				} else {
+					l.listpack[i+removed] = v
+				}
+			}
+			kept = append(kept, l.listpack[removed:]...)
+		}
+		for i := len(kept); i < len(l.listpack); i++ {
+			l.listpack[i] = "" // Drop references past the new end
+		}
+		l.listpack = kept
+		l.Length = len(kept)
+		return removed
 	}
 
-	return result
+	if fromHead {
+		node := l.Head
+		for node != nil && removed < limit {
+			next := node.Next
+			if node.Value == value {
+				l.RemoveNode(node)
+				removed++
+			}
+			node = next
+		}
+	} else {
+		node := l.Tail
+		for node != nil && removed < limit {
+			prev := node.Prev
+			if node.Value == value {
+				l.RemoveNode(node)
+				removed++
+			}
+			node = prev
+		}
+	}
+	return removed
 }
 
-// ToSlice converts list to slice - O(n)
-func (l *List) ToSlice() []string {
-	result := make([]string, 0, l.Length)
-	node := l.Head
-	for node != nil {
-		result = append(result, node.Value)
-		node = node.Next
+// Insert adds value before or after the first element equal to pivot,
+// scanning from the head; returns false if pivot is not in the list - O(n)
+func (l *List) Insert(pivot, value string, before bool) bool {
+	if !l.quicklist {
+		for i, v := range l.listpack {
+			if v != pivot {
+				continue
+			}
+			if !before {
+				i++
+			}
+			l.listpack = append(l.listpack, "")
+			copy(l.listpack[i+1:], l.listpack[i:])
+			l.listpack[i] = value
+			l.Length++
+			return true
+		}
+		return false
 	}
-	return result
+
+	node := l.FindNode(pivot, true)
+	if node == nil {
+		return false
+	}
+	if before {
+		l.InsertBefore(node, value)
+	} else {
+		l.InsertAfter(node, value)
+	}
+	return true
 }
 
-// RemoveNode removes a specific node - O(1)
+// RemoveNode removes a specific node of a quicklist-encoded list - O(1)
 func (l *List) RemoveNode(node *ListNode) {
 	if node == nil {
 		return
@@ -229,7 +491,7 @@ func (l *List) RemoveNode(node *ListNode) {
 	l.Length--
 }
 
-// InsertBefore inserts value before the given node - O(1)
+// InsertBefore inserts value before the given node of a quicklist-encoded list - O(1)
 func (l *List) InsertBefore(node *ListNode, value string) {
 	if node == nil {
 		return
@@ -249,7 +511,7 @@ func (l *List) InsertBefore(node *ListNode, value string) {
 	l.Length++
 }
 
-// InsertAfter inserts value after the given node - O(1)
+// InsertAfter inserts value after the given node of a quicklist-encoded list - O(1)
 func (l *List) InsertAfter(node *ListNode, value string) {
 	if node == nil {
 		return
@@ -270,6 +532,7 @@ func (l *List) InsertAfter(node *ListNode, value string) {
 }
 
 // FindNode finds node with value, starting from head or tail
+// Only quicklist-encoded lists have nodes; a listpack-encoded one returns nil
 func (l *List) FindNode(value string, fromHead bool) *ListNode {
 	if fromHead {
 		node := l.Head
@@ -293,34 +556,26 @@ func (l *List) FindNode(value string, fromHead bool) *ListNode {
 
 // Trim keeps only elements from start to stop - O(n)
 func (l *List) Trim(start, stop int) {
-	if l.Length == 0 {
-		return
-	}
-
-	// Handle negative indices
-	if start < 0 {
-		start = l.Length + start
-	}
-	if stop < 0 {
-		stop = l.Length + stop
-	}
-
-	// Clamp to valid range
-	if start < 0 {
-		start = 0
-	}
-	if stop >= l.Length {
-		stop = l.Length - 1
-	}
-
-	if start > stop || start >= l.Length {
+	start, stop, ok := l.clampRange(start, stop)
+	if !ok {
 		// Empty the list
 		l.Head = nil
 		l.Tail = nil
+		l.listpack = nil
 		l.Length = 0
 		return
 	}
 
+	if !l.quicklist {
+		n := copy(l.listpack, l.listpack[start:stop+1])
+		for i := n; i < len(l.listpack); i++ {
+			l.listpack[i] = "" // Drop references past the new end
+		}
+		l.listpack = l.listpack[:n]
+		l.Length = n
+		return
+	}
+
 	// Get new head
 	newHead := l.getNodeAt(start)
 	newTail := l.getNodeAt(stop)
@@ -1,22 +1,24 @@
 package storage
 
 import (
-	"time"
+	"context"
 	"log"
+	"time"
 )
 
 // ==================== LIST OPERATIONS ====================
 
 // getOrCreateList returns existing list or creates new one
 func (s *Store) getOrCreateList(key string) (*List, bool) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
 		return NewList(), true // New list
 	}
 
-	// Check expiry
-	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+	// Check expiry; with passive expiry the write comes from the master,
+	// which still has the key, so it applies to the existing value
+	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) && !s.isPassiveExpiry() {
+		s.expireKey(key)
 		return NewList(), true // Expired, treat as new
 	}
 
@@ -34,13 +36,13 @@ func (s *Store) getOrCreateList(key string) (*List, bool) {
 
 // getExistingList returns existing list or nil
 func (s *Store) getExistingList(key string) (*List, error) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
 		return nil, nil // Key doesn't exist
 	}
 
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return nil, nil
 	}
 
@@ -61,11 +63,13 @@ func (s *Store) saveList(key string, list *List) {
 		return
 	}
 
-	s.data[key] = &Value{
+	list.convertIfOversized(s.listMaxListpackSize)
+
+	s.putData(key, &Value{
 		Data:      list,
-		ExpiresAt: nil,
+		ExpiresAt: s.currentExpiry(key),
 		Type:      ListType,
-	}
+	})
 }
 
 // LPush adds elements to the head of the list - O(1) per element
@@ -177,6 +181,27 @@ func (s *Store) RPop(key string, count int) ([]string, error) {
 	return result, nil
 }
 
+// LMPop pops up to count elements from the first non-empty list among keys,
+// from the head if left is set and from the tail otherwise
+// Returns the key popped from and the elements, or "" if every list is empty
+// A key holding another type fails with ErrWrongType, as it would for LPOP
+func (s *Store) LMPop(keys []string, left bool, count int) (string, []string, error) {
+	for _, key := range keys {
+		pop := s.RPop
+		if left {
+			pop = s.LPop
+		}
+		elements, err := pop(key, count)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(elements) > 0 {
+			return key, elements, nil
+		}
+	}
+	return "", nil, nil
+}
+
 // LLen returns the length of the list - O(1)
 func (s *Store) LLen(key string) (int, error) {
 	list, err := s.getExistingList(key)
@@ -191,6 +216,11 @@ func (s *Store) LLen(key string) (int, error) {
 
 // LRange returns elements from start to stop (inclusive) - O(n)
 func (s *Store) LRange(key string, start, stop int) ([]string, error) {
+	return s.LRangeContext(context.Background(), key, start, stop)
+}
+
+// LRangeContext is LRange that aborts with ErrCommandTimeout when ctx is done
+func (s *Store) LRangeContext(ctx context.Context, key string, start, stop int) ([]string, error) {
 	list, err := s.getExistingList(key)
 	if err != nil {
 		return nil, err
@@ -198,7 +228,7 @@ func (s *Store) LRange(key string, start, stop int) ([]string, error) {
 	if list == nil {
 		return []string{}, nil
 	}
-	return list.Range(start, stop), nil
+	return list.RangeContext(ctx, start, stop)
 }
 
 // LIndex returns the element at index - O(n)
@@ -257,39 +287,21 @@ func (s *Store) LRem(key string, count int, value string) (int, error) {
 		list = list.Clone()
 	}
 
-	removed := 0
 	toRemove := count
-	if count == 0 {
-		toRemove = list.Length // Remove all
-	} else if count < 0 {
+	if count < 0 {
 		toRemove = -count
 	}
-
-	if count >= 0 {
-		// Remove from head to tail
-		node := list.Head
-		for node != nil && removed < toRemove {
-			next := node.Next
-			if node.Value == value {
-				list.RemoveNode(node)
-				removed++
-			}
-			node = next
-		}
-	} else {
-		// Remove from tail to head
-		node := list.Tail
-		for node != nil && removed < toRemove {
-			prev := node.Prev
-			if node.Value == value {
-				list.RemoveNode(node)
-				removed++
-			}
-			node = prev
-		}
+	if count == 0 || toRemove < 0 {
+		toRemove = list.Length // Remove all (toRemove < 0 when -count overflows)
 	}
 
-	s.saveList(key, list)
+	// A negative count removes from tail to head
+	removed := list.Remove(value, toRemove, count >= 0)
+
+	// Leave the key untouched when nothing matched; an emptied list is deleted
+	if removed > 0 {
+		s.saveList(key, list)
+	}
 	return removed, nil
 }
 
@@ -328,18 +340,50 @@ func (s *Store) LInsert(key string, before bool, pivot, value string) (int, erro
 		list = list.Clone()
 	}
 
-	// Find pivot node
-	node := list.FindNode(pivot, true)
-	if node == nil {
+	if !list.Insert(pivot, value, before) {
 		return -1, nil // Pivot not found
 	}
 
-	if before {
-		list.InsertBefore(node, value)
-	} else {
-		list.InsertAfter(node, value)
-	}
-
 	s.saveList(key, list)
 	return list.Length, nil
 }
+
+// LPos returns the indexes of the elements equal to value - O(n)
+// rank > 0: start from the rank-th match scanning from the head
+// rank < 0: start from the -rank-th match scanning from the tail
+// count is the number of matches to return (0 = all of them) and maxLen the
+// number of elements to compare (0 = the whole list)
+// Indexes always count from the head; a missing key has no matches
+func (s *Store) LPos(key, value string, rank, count, maxLen int) ([]int, error) {
+	list, err := s.getExistingList(key)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		return nil, nil
+	}
+
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
+	}
+
+	var positions []int
+	compared := 0
+	list.forEach(rank > 0, func(index int, element string) bool {
+		if maxLen > 0 && compared == maxLen {
+			return false
+		}
+		compared++
+		if element != value {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		positions = append(positions, index)
+		return count == 0 || len(positions) < count
+	})
+	return positions, nil
+}
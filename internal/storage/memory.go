@@ -0,0 +1,182 @@
+package storage
+
+import "math"
+
+// Rough per-entry overheads used by the memory estimates (pointers, map buckets, headers)
+const (
+	keyOverhead       = 48 // map entry + Value struct
+	listNodeOverhead  = 32 // prev/next pointers and string header
+	setEntryOverhead  = 40 // map entry plus string header in the dense slice
+	hashEntryOverhead = 32 // map entry with two string headers
+	zsetEntryOverhead = 64 // dict entry plus skiplist node
+
+	listListpackEntryOverhead = 16 // string header in the listpack slice
+	setIntsetEntrySize        = 8  // int64 in the intset slice
+	zsetListpackEntryOverhead = 24 // string header plus float64 score in the listpack slice
+	bloomFilterOverhead       = 64 // Per sub-filter: layer struct and bit slice header
+	cuckooFilterOverhead      = 64 // Filter struct and bucket slice header
+	countMinSketchOverhead    = 48 // Sketch struct and counter slice header
+)
+
+// MEMORY STATS runs on the processor, so it sizes a sample rather than the
+// whole dataset: at most memoryStatsSampleKeys keys, and of each sampled
+// collection at most memoryStatsSampleElements elements
+const (
+	memoryStatsSampleKeys     = 1024
+	memoryStatsSampleElements = 64
+)
+
+// TypeMemoryStats holds the key count and estimated size of all keys of one type
+type TypeMemoryStats struct {
+	Keys  int64
+	Bytes int64
+}
+
+// MemoryStatsByType reports the keys of each type and estimates the bytes
+// they use
+// Key counts come from the counters putData and deleteKey keep, so like
+// DBSIZE they include expired keys not reclaimed yet. Bytes are the average
+// size of the sampled keys of a type times its key count; a type no sampled
+// key had is counted at keyOverhead per key. The sizes are approximations of
+// payload plus bookkeeping, meant for spotting which data type dominates
+// memory rather than exact accounting
+func (s *Store) MemoryStatsByType() map[string]TypeMemoryStats {
+	type sample struct{ keys, bytes int64 }
+	samples := make(map[ValueType]sample)
+
+	// Map iteration starts at a random bucket, so the first keys are a
+	// random enough sample
+	sampled := 0
+	for key, val := range s.data {
+		if sampled == memoryStatsSampleKeys {
+			break
+		}
+		sampled++
+		entry := samples[val.Type]
+		entry.keys++
+		entry.bytes += int64(len(key)) + keyOverhead + estimateValueSize(val, memoryStatsSampleElements)
+		samples[val.Type] = entry
+	}
+
+	stats := make(map[string]TypeMemoryStats)
+	for t, keys := range s.keysByType {
+		if keys <= 0 {
+			continue
+		}
+		bytes := keys * keyOverhead
+		if entry := samples[t]; entry.keys > 0 {
+			bytes = entry.bytes * keys / entry.keys
+		}
+		stats[memoryTypeName(t)] = TypeMemoryStats{Keys: keys, Bytes: bytes}
+	}
+	return stats
+}
+
+// MemoryUsage estimates the bytes used by key and its value, the same way
+// MemoryStatsByType sizes each key but counting every element
+// Returns false if the key does not exist
+func (s *Store) MemoryUsage(key string) (int64, bool) {
+	val, exists := s.liveValue(key)
+	if !exists {
+		return 0, false
+	}
+	return int64(len(key)) + keyOverhead + estimateValueSize(val, 0), true
+}
+
+// estimateValueSize approximates the bytes held by a value
+// For a collection with more than samples elements (when samples > 0) only
+// the first samples are sized and the total is scaled up from them
+func estimateValueSize(val *Value, samples int) int64 {
+	if samples <= 0 {
+		samples = math.MaxInt
+	}
+	switch data := val.Data.(type) {
+	case string:
+		return int64(len(data))
+	case int64:
+		return 8
+	case *List:
+		overhead := int64(listNodeOverhead)
+		if data.IsListpack() {
+			overhead = listListpackEntryOverhead
+		}
+		size, sized := int64(0), 0
+		data.forEach(true, func(_ int, value string) bool {
+			if sized == samples {
+				return false
+			}
+			size += int64(len(value)) + overhead
+			sized++
+			return true
+		})
+		return scaleSample(size, sized, data.Length)
+	case *Set:
+		// An intset member is a bare int64
+		if data.IsIntset() {
+			return int64(data.Len()) * setIntsetEntrySize
+		}
+		size, sized := int64(0), 0
+		data.forEach(func(member string) bool {
+			if sized == samples {
+				return false
+			}
+			size += int64(len(member)) + setEntryOverhead
+			sized++
+			return true
+		})
+		return scaleSample(size, sized, data.Len())
+	case *Hash:
+		size, sized := int64(0), 0
+		data.forEachSample(samples, func(field, value string) {
+			size += int64(len(field)+len(value)) + hashEntryOverhead
+			sized++
+		})
+		return scaleSample(size, sized, data.Len())
+	case *ZSet:
+		overhead := int64(zsetEntryOverhead)
+		if data.IsListpack() {
+			overhead = zsetListpackEntryOverhead
+		}
+		size, sized := int64(0), 0
+		data.forEachSample(samples, func(member string) {
+			size += int64(len(member)) + overhead
+			sized++
+		})
+		return scaleSample(size, sized, data.Len())
+	case *HyperLogLog:
+		return int64(len(data.GetRegisters()))
+	case *BloomFilter:
+		return data.memoryBytes()
+	case *CuckooFilter:
+		return data.memoryBytes()
+	case *CountMinSketch:
+		return data.memoryBytes()
+	default:
+		return 0
+	}
+}
+
+// scaleSample scales the size of the first sized of total elements to all of them
+func scaleSample(size int64, sized, total int) int64 {
+	if sized == 0 || sized == total {
+		return size
+	}
+	return size * int64(total) / int64(sized)
+}
+
+// memoryTypeName names a value type in MEMORY STATS (HyperLogLogs and Bloom
+// filters are reported separately rather than as strings / modules)
+func memoryTypeName(t ValueType) string {
+	switch t {
+	case HyperLogLogType:
+		return "hyperloglog"
+	case BloomFilterType:
+		return "bloom"
+	case CuckooFilterType:
+		return "cuckoo"
+	case CountMinSketchType:
+		return "cms"
+	default:
+		return valueTypeName(t)
+	}
+}
@@ -1,10 +1,6 @@
 package storage
 
-import (
-	"regexp"
-	"strings"
-	"sync"
-)
+import "sync"
 
 // ==================== PUB/SUB DATA STRUCTURES ====================
 
@@ -14,6 +10,22 @@ type Subscriber struct {
 	Channels chan *Message // Channel to send messages to subscriber
 }
 
+// DefaultSubscriberBufferSize is how many messages a subscriber buffers by
+// default; Publish drops messages for a subscriber whose buffer is full
+const DefaultSubscriberBufferSize = 100
+
+// NewSubscriber creates a subscriber whose message channel buffers up to
+// bufferSize messages (DefaultSubscriberBufferSize if bufferSize <= 0)
+func NewSubscriber(id string, bufferSize int) *Subscriber {
+	if bufferSize <= 0 {
+		bufferSize = DefaultSubscriberBufferSize
+	}
+	return &Subscriber{
+		ID:       id,
+		Channels: make(chan *Message, bufferSize),
+	}
+}
+
 // Message represents a pub/sub message
 type Message struct {
 	Type    string // "message", "pmessage", "subscribe", "unsubscribe", "psubscribe", "punsubscribe"
@@ -45,20 +57,12 @@ func NewPatternTrie() *PatternTrie {
 }
 
 // Insert adds a pattern to the trie
-// Only inserts up to the first wildcard (* or ?)
+// Only inserts up to the first wildcard (*, ?, [ or an escape)
 func (pt *PatternTrie) Insert(pattern string) {
 	node := pt.root
 
 	// Extract prefix before first wildcard
-	prefixLen := 0
-	for i := 0; i < len(pattern); i++ {
-		if pattern[i] == '*' || pattern[i] == '?' {
-			break
-		}
-		prefixLen++
-	}
-
-	prefix := pattern[:prefixLen]
+	prefix := globLiteralPrefix(pattern)
 
 	// Traverse/create nodes for the prefix
 	for i := 0; i < len(prefix); i++ {
@@ -79,15 +83,7 @@ func (pt *PatternTrie) Insert(pattern string) {
 // Remove removes a pattern from the trie
 func (pt *PatternTrie) Remove(pattern string) {
 	// Extract prefix before first wildcard
-	prefixLen := 0
-	for i := 0; i < len(pattern); i++ {
-		if pattern[i] == '*' || pattern[i] == '?' {
-			break
-		}
-		prefixLen++
-	}
-
-	prefix := pattern[:prefixLen]
+	prefix := globLiteralPrefix(pattern)
 
 	// Navigate to the node
 	node := pt.root
@@ -152,9 +148,6 @@ type PubSub struct {
 	// OPTIMIZATION: Trie for efficient pattern prefix lookup
 	patternTrie *PatternTrie
 
-	// OPTIMIZATION: Pre-compiled regex cache for patterns
-	compiledPatterns map[string]*regexp.Regexp
-
 	mu sync.RWMutex
 }
 
@@ -167,7 +160,6 @@ func NewPubSub() *PubSub {
 		subscriberPatterns: make(map[string]map[string]bool),
 		subscribers:        make(map[string]*Subscriber),
 		patternTrie:        NewPatternTrie(),
-		compiledPatterns:   make(map[string]*regexp.Regexp),
 	}
 }
 
@@ -241,6 +233,7 @@ func (ps *PubSub) Unsubscribe(subscriberID string, channels ...string) []string
 		unsubscribed = append(unsubscribed, channel)
 	}
 
+	ps.dropIfIdle(subscriberID)
 	return unsubscribed
 }
 
@@ -270,9 +263,6 @@ func (ps *PubSub) PSubscribe(subscriberID string, sub *Subscriber, patterns ...s
 
 			// OPTIMIZATION: Add pattern to trie for efficient prefix lookup
 			ps.patternTrie.Insert(pattern)
-
-			// OPTIMIZATION: Pre-compile regex for this pattern
-			ps.compiledPatterns[pattern] = compilePattern(pattern)
 		}
 
 		// Add subscriber to pattern
@@ -308,9 +298,8 @@ func (ps *PubSub) PUnsubscribe(subscriberID string, patterns ...string) []string
 			if len(subs) == 0 {
 				delete(ps.patterns, pattern)
 
-				// OPTIMIZATION: Remove pattern from trie and compiled cache
+				// OPTIMIZATION: Remove pattern from trie
 				ps.patternTrie.Remove(pattern)
-				delete(ps.compiledPatterns, pattern)
 			}
 		}
 
@@ -322,9 +311,22 @@ func (ps *PubSub) PUnsubscribe(subscriberID string, patterns ...string) []string
 		unsubscribed = append(unsubscribed, pattern)
 	}
 
+	ps.dropIfIdle(subscriberID)
 	return unsubscribed
 }
 
+// dropIfIdle forgets a subscriber once it has no channels and no patterns left,
+// so a client that unsubscribed from everything holds no pub/sub state
+// Must be called with lock held
+func (ps *PubSub) dropIfIdle(subscriberID string) {
+	if len(ps.subscriberChannels[subscriberID]) > 0 || len(ps.subscriberPatterns[subscriberID]) > 0 {
+		return
+	}
+	delete(ps.subscriberChannels, subscriberID)
+	delete(ps.subscriberPatterns, subscriberID)
+	delete(ps.subscribers, subscriberID)
+}
+
 // ==================== PUBLISHING OPERATIONS ====================
 
 // Publish publishes a message to a channel
@@ -364,9 +366,7 @@ func (ps *PubSub) Publish(channel string, payload string) int {
 			continue
 		}
 
-		// OPTIMIZATION: Use pre-compiled regex instead of compiling on every publish
-		compiledRegex := ps.compiledPatterns[pattern]
-		if compiledRegex != nil && compiledRegex.MatchString(channel) {
+		if GlobMatch(pattern, channel) {
 			msg := &Message{
 				Type:    "pmessage",
 				Pattern: pattern,
@@ -425,7 +425,7 @@ func (ps *PubSub) Channels(pattern string) []string {
 	channels := make([]string, 0)
 
 	for channel := range ps.channels {
-		if pattern == "" || matchPattern(pattern, channel) {
+		if pattern == "" || GlobMatch(pattern, channel) {
 			channels = append(channels, channel)
 		}
 	}
@@ -451,8 +451,31 @@ func (ps *PubSub) GetSubscriberCount(subscriberID string) int {
 	return count
 }
 
-// RemoveSubscriber removes all subscriptions for a subscriber (cleanup on disconnect)
-// RemoveSubscriber removes a subscriber from all channels and patterns
+// SubscriberChannels returns the channels a subscriber is subscribed to
+func (ps *PubSub) SubscriberChannels(subscriberID string) []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	channels := make([]string, 0, len(ps.subscriberChannels[subscriberID]))
+	for channel := range ps.subscriberChannels[subscriberID] {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// SubscriberPatterns returns the patterns a subscriber is subscribed to
+func (ps *PubSub) SubscriberPatterns(subscriberID string) []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	patterns := make([]string, 0, len(ps.subscriberPatterns[subscriberID]))
+	for pattern := range ps.subscriberPatterns[subscriberID] {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// RemoveSubscriber removes a subscriber from all channels and patterns (cleanup on disconnect)
 func (ps *PubSub) RemoveSubscriber(subscriberID string) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
@@ -474,6 +497,7 @@ func (ps *PubSub) RemoveSubscriber(subscriberID string) {
 			delete(subs, subscriberID)
 			if len(subs) == 0 {
 				delete(ps.patterns, pattern)
+				ps.patternTrie.Remove(pattern)
 			}
 		}
 	}
@@ -483,46 +507,33 @@ func (ps *PubSub) RemoveSubscriber(subscriberID string) {
 	delete(ps.subscribers, subscriberID)
 }
 
-// GetSubscriber returns the subscriber object for a subscriber ID
-func (ps *PubSub) GetSubscriber(subscriberID string) *Subscriber {
-	ps.mu.RLock()
-	defer ps.mu.RUnlock()
-	return ps.subscribers[subscriberID]
+// PubSubSizes reports the number of entries in each PubSub map
+// Everything is zero once all subscribers unsubscribed or disconnected
+type PubSubSizes struct {
+	Channels           int // Channels with at least one subscriber
+	Patterns           int // Patterns with at least one subscriber
+	Subscribers        int // Registered subscribers
+	SubscriberChannels int // Subscribers with a channel list
+	SubscriberPatterns int // Subscribers with a pattern list
 }
 
-// ==================== HELPER FUNCTIONS ====================
-
-// compilePattern pre-compiles a glob pattern to regex for efficient reuse
-func compilePattern(pattern string) *regexp.Regexp {
-	// Convert glob pattern to regex
-	// Escape special regex characters except * and ?
-	regexPattern := regexp.QuoteMeta(pattern)
-
-	// Replace escaped \* with .* (match any characters)
-	regexPattern = strings.ReplaceAll(regexPattern, `\*`, `.*`)
-
-	// Replace escaped \? with . (match single character)
-	regexPattern = strings.ReplaceAll(regexPattern, `\?`, `.`)
-
-	// Anchor pattern to match entire string
-	regexPattern = "^" + regexPattern + "$"
+// Sizes returns the current size of every PubSub map (used to check for leaked subscribers)
+func (ps *PubSub) Sizes() PubSubSizes {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
 
-	// Compile and return
-	re, err := regexp.Compile(regexPattern)
-	if err != nil {
-		return nil
+	return PubSubSizes{
+		Channels:           len(ps.channels),
+		Patterns:           len(ps.patterns),
+		Subscribers:        len(ps.subscribers),
+		SubscriberChannels: len(ps.subscriberChannels),
+		SubscriberPatterns: len(ps.subscriberPatterns),
 	}
-
-	return re
 }
 
-// matchPattern matches a channel name against a glob-style pattern
-// Supports * (any characters) and ? (single character)
-// NOTE: This function is kept for backward compatibility (used by Channels introspection)
-func matchPattern(pattern, channel string) bool {
-	re := compilePattern(pattern)
-	if re == nil {
-		return false
-	}
-	return re.MatchString(channel)
+// GetSubscriber returns the subscriber object for a subscriber ID
+func (ps *PubSub) GetSubscriber(subscriberID string) *Subscriber {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.subscribers[subscriberID]
 }
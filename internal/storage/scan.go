@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"hash/maphash"
+	"math/bits"
+	"time"
+)
+
+// ==================== SCAN ====================
+
+// keyIndexMinSize is the smallest bucket table a non-empty key index uses
+const keyIndexMinSize = 4
+
+// keyIndexEmptyVisits bounds the empty buckets one rehash step may skip, so a
+// step stays cheap even in a sparse table
+const keyIndexEmptyVisits = 10
+
+// keyIndex mirrors the keyspace as a power-of-two table of hash buckets, the
+// way a Redis dict lays out its keys. Go maps hide their buckets, so SCAN
+// walks this table instead.
+//
+// The table doubles once it holds more keys than buckets and halves once it
+// is less than 1/8 full. A key lives in bucket hash & mask, so after a resize
+// the keys of one bucket end up in buckets that share its low bits. SCAN
+// relies on that (see next).
+//
+// Like a Redis dict, a resize is incremental: the new table is allocated
+// as target and every add or remove moves one more bucket into it, so no
+// single write pays for rehashing the whole keyspace. Until the last bucket
+// moved, keys live in either table: buckets below rehashIdx were moved and
+// are empty, new keys go straight to target.
+type keyIndex struct {
+	seed      maphash.Seed
+	buckets   [][]string
+	target    [][]string // Table being rehashed into, nil when not resizing
+	rehashIdx int        // Next bucket of buckets to move into target
+	count     int
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{seed: maphash.MakeSeed()}
+}
+
+// bucketOf returns the bucket key belongs to in a table of the given mask
+func (ix *keyIndex) bucketOf(key string, mask uint64) uint64 {
+	return maphash.String(ix.seed, key) & mask
+}
+
+// rehashing reports whether a resize is in progress
+func (ix *keyIndex) rehashing() bool {
+	return ix.target != nil
+}
+
+// add records a key that was not in the keyspace before
+func (ix *keyIndex) add(key string) {
+	if ix.rehashing() {
+		ix.rehashStep()
+	} else if ix.count >= len(ix.buckets) {
+		ix.resize(max(keyIndexMinSize, len(ix.buckets)*2))
+	}
+
+	table := ix.buckets
+	if ix.rehashing() {
+		table = ix.target
+	}
+	b := ix.bucketOf(key, uint64(len(table)-1))
+	table[b] = append(table[b], key)
+	ix.count++
+}
+
+// remove drops a key that left the keyspace
+func (ix *keyIndex) remove(key string) {
+	if len(ix.buckets) == 0 {
+		return
+	}
+	if ix.rehashing() {
+		ix.rehashStep()
+	}
+
+	// While rehashing the key may be in either table, like in a Redis dict
+	if !removeFromTable(ix.buckets, ix.bucketOf(key, uint64(len(ix.buckets)-1)), key) &&
+		!(ix.rehashing() && removeFromTable(ix.target, ix.bucketOf(key, uint64(len(ix.target)-1)), key)) {
+		return
+	}
+	ix.count--
+
+	if !ix.rehashing() && len(ix.buckets) > keyIndexMinSize && ix.count*8 < len(ix.buckets) {
+		ix.resize(len(ix.buckets) / 2)
+	}
+}
+
+// removeFromTable removes key from bucket b of table, reporting whether it was there
+func removeFromTable(table [][]string, b uint64, key string) bool {
+	bucket := table[b]
+	for i, k := range bucket {
+		if k == key {
+			last := len(bucket) - 1
+			bucket[i] = bucket[last]
+			bucket[last] = ""
+			table[b] = bucket[:last]
+			return true
+		}
+	}
+	return false
+}
+
+// resize starts rehashing into a table of size buckets (a power of two)
+// An empty index switches tables at once, as there is nothing to move
+func (ix *keyIndex) resize(size int) {
+	if ix.count == 0 {
+		ix.buckets = make([][]string, size)
+		return
+	}
+	ix.target = make([][]string, size)
+	ix.rehashIdx = 0
+}
+
+// rehashStep moves the next non-empty bucket into target, skipping at most
+// keyIndexEmptyVisits empty ones, and switches tables after the last bucket
+func (ix *keyIndex) rehashStep() {
+	mask := uint64(len(ix.target) - 1)
+	for visits := keyIndexEmptyVisits; ix.rehashIdx < len(ix.buckets); visits-- {
+		bucket := ix.buckets[ix.rehashIdx]
+		ix.buckets[ix.rehashIdx] = nil
+		ix.rehashIdx++
+		for _, key := range bucket {
+			b := ix.bucketOf(key, mask)
+			ix.target[b] = append(ix.target[b], key)
+		}
+		if len(bucket) > 0 || visits == 0 {
+			break
+		}
+	}
+
+	if ix.rehashIdx == len(ix.buckets) {
+		ix.buckets = ix.target
+		ix.target = nil
+		ix.rehashIdx = 0
+	}
+}
+
+// next calls fn for every key in the bucket at cursor and returns the cursor
+// of the following bucket, or 0 once the whole table was visited.
+//
+// Cursors count up with their bits reversed, so the high bits change fastest.
+// After the table grows, a visited bucket's keys are split across buckets
+// that share its low bits. Those buckets all have cursors below the current
+// one, so they are not visited again. After the table shrinks, unvisited keys
+// merge into buckets whose cursors are still ahead. Either way, every key
+// present for the whole scan is returned at least once. A key can be returned
+// twice only when the table shrinks during the scan.
+//
+// While rehashing, the cursor's bucket in the smaller table is visited along
+// with every bucket of the larger table that it expands to, as Redis's
+// dictScan does, so keys are found whichever table currently holds them.
+func (ix *keyIndex) next(cursor uint64, fn func(key string)) uint64 {
+	if len(ix.buckets) == 0 {
+		return 0
+	}
+
+	if !ix.rehashing() {
+		mask := uint64(len(ix.buckets) - 1)
+		for _, key := range ix.buckets[cursor&mask] {
+			fn(key)
+		}
+		return nextCursor(cursor, mask)
+	}
+
+	small, large := ix.buckets, ix.target
+	if len(small) > len(large) {
+		small, large = large, small
+	}
+	smallMask, largeMask := uint64(len(small)-1), uint64(len(large)-1)
+
+	for _, key := range small[cursor&smallMask] {
+		fn(key)
+	}
+	for {
+		for _, key := range large[cursor&largeMask] {
+			fn(key)
+		}
+		cursor = nextCursor(cursor, largeMask)
+		// Stop once the bits the larger table adds wrapped back to zero
+		if cursor&(smallMask^largeMask) == 0 {
+			return cursor
+		}
+	}
+}
+
+// nextCursor increments a reversed cursor within a table of the given mask
+func nextCursor(cursor, mask uint64) uint64 {
+	// Set the bits above the mask so the increment carries out of the
+	// table, then increment the reversed cursor
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return bits.Reverse64(cursor)
+}
+
+// putData stores val at key, records new keys in the SCAN index and updates
+// the encoding and per-type key counts
+// Every write that may create a key goes through here instead of s.data directly
+func (s *Store) putData(key string, val *Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, exists := s.data[key]
+	if !exists {
+		s.scanIndex.add(key)
+	} else {
+		s.keysByType[old.Type]--
+	}
+	s.keysByType[val.Type]++
+	s.trackEncoding(key, old, val)
+	s.data[key] = val
+}
+
+// ScanContext returns the next batch of keys for SCAN and the cursor to
+// continue from (0 once the iteration is complete). It visits buckets until it
+// has collected count keys, or has visited 10*count buckets. Keys that don't
+// match pattern (see MatchPattern) or typeName (when not empty), or whose TTL has passed, are
+// then filtered out. So a batch can come back smaller than count, or even
+// empty, before the scan is finished.
+// A huge COUNT makes one call visit that many buckets, so it aborts with
+// ErrCommandTimeout once ctx is done
+func (s *Store) ScanContext(ctx context.Context, cursor uint64, pattern string, count int, typeName string) (uint64, []string, error) {
+	if count <= 0 {
+		count = 10
+	}
+
+	var keys []string
+	for visits := count * 10; visits > 0; visits-- {
+		if err := checkCanceled(ctx, visits); err != nil {
+			return 0, nil, err
+		}
+		cursor = s.scanIndex.next(cursor, func(key string) {
+			keys = append(keys, key)
+		})
+		if cursor == 0 || len(keys) >= count {
+			break
+		}
+	}
+
+	now := time.Now()
+	filtered := keys[:0]
+	for i, key := range keys {
+		if err := checkCanceled(ctx, i); err != nil {
+			return 0, nil, err
+		}
+		val, _ := s.lookup(key)
+		if val.ExpiresAt != nil && now.After(*val.ExpiresAt) {
+			continue
+		}
+		if !MatchPattern(pattern, key) {
+			continue
+		}
+		if typeName != "" && valueTypeName(val.Type) != typeName {
+			continue
+		}
+		filtered = append(filtered, key)
+	}
+	return cursor, filtered, nil
+}
@@ -1,129 +1,273 @@
 package storage
 
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
 // Set represents a Redis set (unique members)
+// Small sets of integers use the compact intset encoding: the members parsed
+// into one sorted slice of int64, searched by bisection. A set that gets a
+// member that is not an integer, or grows past set-max-intset-entries when
+// saved, switches to the hashtable encoding: Members maps each member to its
+// position in dense, which holds the members contiguously so a random one can
+// be picked in O(1) like Redis's dictGetRandomKey
 type Set struct {
-	Members map[string]struct{}
+	Members map[string]int // Member positions once hashtable-encoded (nil while intset)
+	dense   []string
+	intset  []int64 // Sorted members while intset-encoded (Members == nil)
 }
 
-// NewSet creates a new empty set
+// NewSet creates a new empty intset-encoded set
 func NewSet() *Set {
-	return &Set{
-		Members: make(map[string]struct{}),
-	}
+	return &Set{}
 }
 
 // Clone creates a deep copy of the set (for copy-on-write)
 func (s *Set) Clone() *Set {
-	if s == nil || len(s.Members) == 0 {
+	if s == nil || s.Len() == 0 {
 		return NewSet()
 	}
 
+	if s.IsIntset() {
+		newSet := &Set{intset: make([]int64, len(s.intset))}
+		copy(newSet.intset, s.intset)
+		return newSet
+	}
+
 	newSet := &Set{
-		Members: make(map[string]struct{}, len(s.Members)),
+		Members: make(map[string]int, len(s.Members)),
+		dense:   make([]string, len(s.dense)),
 	}
-	for member := range s.Members {
-		newSet.Members[member] = struct{}{}
+	copy(newSet.dense, s.dense)
+	for member, pos := range s.Members {
+		newSet.Members[member] = pos
 	}
 	return newSet
 }
 
 // Add adds a member to the set, returns true if member is new
 func (s *Set) Add(member string) bool {
+	if s.IsIntset() {
+		n, ok := parseCanonicalInt(member)
+		if ok {
+			i, found := s.intsetSearch(n)
+			if found {
+				return false
+			}
+			s.intset = append(s.intset, 0)
+			copy(s.intset[i+1:], s.intset[i:])
+			s.intset[i] = n
+			return true
+		}
+		s.convertToHashtable() // Like Redis, never converts back to intset
+	}
+
 	if _, exists := s.Members[member]; exists {
 		return false
 	}
-	s.Members[member] = struct{}{}
+	s.Members[member] = len(s.dense)
+	s.dense = append(s.dense, member)
 	return true
 }
 
+// IsIntset reports whether the set currently uses the intset encoding
+func (s *Set) IsIntset() bool {
+	return s.Members == nil
+}
+
+// intsetSearch returns where n is or would be inserted in the intset, and
+// whether it is there
+func (s *Set) intsetSearch(n int64) (int, bool) {
+	i := sort.Search(len(s.intset), func(i int) bool { return s.intset[i] >= n })
+	return i, i < len(s.intset) && s.intset[i] == n
+}
+
+// convertIfOversized switches the set to hashtable once it exceeds maxEntries
+func (s *Set) convertIfOversized(maxEntries int) {
+	if s.IsIntset() && len(s.intset) > maxEntries {
+		s.convertToHashtable()
+	}
+}
+
+// convertToHashtable moves the intset members into the member map
+func (s *Set) convertToHashtable() {
+	s.Members = make(map[string]int, len(s.intset))
+	s.dense = make([]string, len(s.intset))
+	for i, n := range s.intset {
+		member := strconv.FormatInt(n, 10)
+		s.Members[member] = i
+		s.dense[i] = member
+	}
+	s.intset = nil
+}
+
 // Remove removes a member from the set, returns true if member existed
+// The last member takes the removed one's place in dense
 func (s *Set) Remove(member string) bool {
-	if _, exists := s.Members[member]; !exists {
+	if s.IsIntset() {
+		n, ok := parseCanonicalInt(member)
+		if !ok {
+			return false
+		}
+		i, found := s.intsetSearch(n)
+		if !found {
+			return false
+		}
+		s.intset = append(s.intset[:i], s.intset[i+1:]...)
+		return true
+	}
+
+	pos, exists := s.Members[member]
+	if !exists {
 		return false
 	}
+	last := len(s.dense) - 1
+	if pos != last {
+		moved := s.dense[last]
+		s.dense[pos] = moved
+		s.Members[moved] = pos
+	}
+	s.dense[last] = ""
+	s.dense = s.dense[:last]
 	delete(s.Members, member)
 	return true
 }
 
 // IsMember checks if member exists in set
 func (s *Set) IsMember(member string) bool {
+	if s.IsIntset() {
+		n, ok := parseCanonicalInt(member)
+		if !ok {
+			return false
+		}
+		_, found := s.intsetSearch(n)
+		return found
+	}
+
 	_, exists := s.Members[member]
 	return exists
 }
 
 // Len returns the number of members
 func (s *Set) Len() int {
+	if s.IsIntset() {
+		return len(s.intset)
+	}
 	return len(s.Members)
 }
 
 // Members returns all members as a slice
+// An intset lists them in ascending order, like Redis
 func (s *Set) GetMembers() []string {
-	members := make([]string, 0, len(s.Members))
-	for m := range s.Members {
-		members = append(members, m)
+	if s.IsIntset() {
+		members := make([]string, len(s.intset))
+		for i, n := range s.intset {
+			members[i] = strconv.FormatInt(n, 10)
+		}
+		return members
 	}
+
+	members := make([]string, len(s.dense))
+	copy(members, s.dense)
 	return members
 }
 
+// member returns the member at position i of the intset or of dense
+func (s *Set) member(i int) string {
+	if s.IsIntset() {
+		return strconv.FormatInt(s.intset[i], 10)
+	}
+	return s.dense[i]
+}
+
+// forEach calls fn with every member until fn returns false
+func (s *Set) forEach(fn func(member string) bool) {
+	for i, n := 0, s.Len(); i < n; i++ {
+		if !fn(s.member(i)) {
+			return
+		}
+	}
+}
+
 // Pop removes and returns a random member
 func (s *Set) Pop() (string, bool) {
-	for m := range s.Members {
-		delete(s.Members, m)
-		return m, true
+	m, ok := s.RandomMember()
+	if ok {
+		s.Remove(m)
 	}
-	return "", false
+	return m, ok
 }
 
 // RandomMember returns a random member without removing
 func (s *Set) RandomMember() (string, bool) {
-	for m := range s.Members {
-		return m, true
+	n := s.Len()
+	if n == 0 {
+		return "", false
 	}
-	return "", false
+	return s.member(rand.Intn(n)), true
 }
 
-// RandomMembers returns n random members without removing
-// If count is negative, allows duplicates
+// RandomMembers returns random members without removing, like SRANDMEMBER
+// A positive count returns up to count distinct members (the whole set when
+// count exceeds its size); a negative count returns exactly -count members
+// (at most MaxRandomCount) and may repeat them
 func (s *Set) RandomMembers(count int) []string {
-	if len(s.Members) == 0 {
+	size := s.Len()
+	if size == 0 || count == 0 {
 		return []string{}
 	}
 
-	allowDuplicates := count < 0
 	if count < 0 {
-		count = -count
+		if count < -MaxRandomCount {
+			count = -MaxRandomCount
+		}
+		result := make([]string, -count)
+		for i := range result {
+			result[i], _ = s.RandomMember()
+		}
+		return result
 	}
 
-	members := s.GetMembers()
-	result := make([]string, 0, count)
+	if count >= size {
+		return s.GetMembers()
+	}
 
-	if allowDuplicates {
-		// With duplicates allowed, just pick randomly
-		for i := 0; i < count; i++ {
-			idx := i % len(members) // Simple distribution
-			result = append(result, members[idx])
+	// Few members out of many: draw until count distinct ones were seen,
+	// which costs O(count) instead of copying the whole set
+	if count*3 <= size {
+		seen := make(map[string]struct{}, count)
+		result := make([]string, 0, count)
+		for len(result) < count {
+			m, _ := s.RandomMember()
+			if _, dup := seen[m]; !dup {
+				seen[m] = struct{}{}
+				result = append(result, m)
+			}
 		}
-	} else {
-		// Without duplicates, limit to set size
-		if count > len(members) {
-			count = len(members)
-		}
-		result = members[:count]
+		return result
 	}
 
-	return result
+	// Partial Fisher-Yates: only the first count positions need shuffling
+	members := s.GetMembers()
+	for i := 0; i < count; i++ {
+		j := i + rand.Intn(len(members)-i)
+		members[i], members[j] = members[j], members[i]
+	}
+	return members[:count]
 }
 
 // Union returns a new set with all members from both sets
 func (s *Set) Union(other *Set) *Set {
 	result := NewSet()
-	for m := range s.Members {
+	add := func(m string) bool {
 		result.Add(m)
+		return true
 	}
+	s.forEach(add)
 	if other != nil {
-		for m := range other.Members {
-			result.Add(m)
-		}
+		other.forEach(add)
 	}
 	return result
 }
@@ -137,25 +281,27 @@ func (s *Set) Intersect(other *Set) *Set {
 
 	// Iterate over smaller set for efficiency
 	smaller, larger := s, other
-	if len(s.Members) > len(other.Members) {
+	if s.Len() > other.Len() {
 		smaller, larger = other, s
 	}
 
-	for m := range smaller.Members {
+	smaller.forEach(func(m string) bool {
 		if larger.IsMember(m) {
 			result.Add(m)
 		}
-	}
+		return true
+	})
 	return result
 }
 
 // Diff returns a new set with members in s but not in other
 func (s *Set) Diff(other *Set) *Set {
 	result := NewSet()
-	for m := range s.Members {
+	s.forEach(func(m string) bool {
 		if other == nil || !other.IsMember(m) {
 			result.Add(m)
 		}
-	}
+		return true
+	})
 	return result
 }
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"time"
 )
 
@@ -8,14 +9,15 @@ import (
 
 // getOrCreateSet returns existing set or creates new one
 func (s *Store) getOrCreateSet(key string) (*Set, bool) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
 		return NewSet(), true // New set
 	}
 
-	// Check expiry
-	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+	// Check expiry; with passive expiry the write comes from the master,
+	// which still has the key, so it applies to the existing value
+	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) && !s.isPassiveExpiry() {
+		s.expireKey(key)
 		return NewSet(), true // Expired, treat as new
 	}
 
@@ -33,14 +35,14 @@ func (s *Store) getOrCreateSet(key string) (*Set, bool) {
 
 // getExistingSet returns existing set or nil if not found/not a set
 func (s *Store) getExistingSet(key string) *Set {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
 		return nil
 	}
 
 	// Check expiry
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return nil
 	}
 
@@ -63,11 +65,13 @@ func (s *Store) saveSet(key string, set *Set) {
 		return
 	}
 
-	s.data[key] = &Value{
+	set.convertIfOversized(s.setMaxIntsetEntries)
+
+	s.putData(key, &Value{
 		Data:      set,
-		ExpiresAt: nil,
+		ExpiresAt: s.currentExpiry(key),
 		Type:      SetType,
-	}
+	})
 }
 
 // SAdd adds members to a set
@@ -131,11 +135,30 @@ func (s *Store) SIsMember(key, member string) bool {
 
 // SMembers returns all members of a set
 func (s *Store) SMembers(key string) []string {
+	members, _ := s.SMembersContext(context.Background(), key)
+	return members
+}
+
+// SMembersContext is SMembers that aborts with ErrCommandTimeout when ctx is done
+func (s *Store) SMembersContext(ctx context.Context, key string) ([]string, error) {
 	set := s.getExistingSet(key)
 	if set == nil {
-		return []string{}
+		return []string{}, nil
+	}
+
+	members := make([]string, 0, set.Len())
+	var err error
+	set.forEach(func(member string) bool {
+		if err = checkCanceled(ctx, len(members)); err != nil {
+			return false
+		}
+		members = append(members, member)
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
-	return set.GetMembers()
+	return members, nil
 }
 
 // SCard returns the cardinality (number of members) of a set
@@ -150,28 +173,36 @@ func (s *Store) SCard(key string) int {
 // SRandMember returns random members from a set without removing
 // If count > 0, returns up to count distinct members
 // If count < 0, returns abs(count) members (may include duplicates)
-func (s *Store) SRandMember(key string, count int) []string {
-	set := s.getExistingSet(key)
-	if set == nil {
-		return []string{}
+// Returns ErrCountOutOfRange if abs(count) of a negative count exceeds MaxRandomCount
+func (s *Store) SRandMember(key string, count int) ([]string, error) {
+	if count < -MaxRandomCount {
+		return nil, ErrCountOutOfRange
 	}
 
-	if count == 0 {
-		return []string{}
+	set := s.getExistingSet(key)
+	if set == nil || count == 0 {
+		return []string{}, nil
 	}
 
-	return set.RandomMembers(count)
+	return set.RandomMembers(count), nil
 }
 
-// SPop removes and returns random members from a set
+// SPop removes and returns up to count distinct random members from a set
+// A count larger than the set pops the whole set
 func (s *Store) SPop(key string, count int) []string {
 	set := s.getExistingSet(key)
-	if set == nil {
+	if set == nil || count <= 0 {
 		return []string{}
 	}
 
-	result := make([]string, 0, count)
-	for i := 0; i < count; i++ {
+	// Copy-on-write: clone set if snapshot is active
+	if s.isSnapshotActive() {
+		set = set.Clone()
+	}
+
+	// Each pop is an O(1) random pick, so the cost follows count, not the set size
+	result := make([]string, 0, min(count, set.Len()))
+	for len(result) < count {
 		member, ok := set.Pop()
 		if !ok {
 			break
@@ -179,10 +210,8 @@ func (s *Store) SPop(key string, count int) []string {
 		result = append(result, member)
 	}
 
-	// Remove key if set is empty
-	if set.Len() == 0 {
-		s.deleteKey(key)
-	}
+	// saveSet removes the key once the set is empty
+	s.saveSet(key, set)
 
 	return result
 }
@@ -237,6 +266,54 @@ func (s *Store) SInter(keys ...string) []string {
 	return result.GetMembers()
 }
 
+// SInterCard returns the cardinality of the intersection of all given sets
+// without materializing it. Counting stops once limit is reached (0 = no limit)
+// Returns ErrWrongType if any key holds another type
+func (s *Store) SInterCard(keys []string, limit int) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	// Resolve all sets, tracking the smallest one to iterate over
+	// Every key is type checked, even after a missing one
+	sets := make([]*Set, 0, len(keys))
+	smallest := -1
+	missing := false
+	for _, key := range keys {
+		isSet, err := s.isSet(key)
+		if err != nil {
+			return 0, err
+		}
+		if !isSet {
+			missing = true
+			continue
+		}
+		set := s.getExistingSet(key)
+		if smallest == -1 || set.Len() < sets[smallest].Len() {
+			smallest = len(sets)
+		}
+		sets = append(sets, set)
+	}
+	if missing {
+		return 0, nil // Missing key means empty intersection
+	}
+
+	count := 0
+	sets[smallest].forEach(func(member string) bool {
+		for i, set := range sets {
+			if i != smallest && !set.IsMember(member) {
+				return true
+			}
+		}
+
+		count++
+		// Early exit: caller only needs to know the limit was reached
+		return limit <= 0 || count < limit
+	})
+
+	return count, nil
+}
+
 // SDiff returns the difference between the first set and all subsequent sets
 func (s *Store) SDiff(keys ...string) []string {
 	if len(keys) == 0 {
@@ -278,16 +355,24 @@ func (s *Store) SMove(srcKey, destKey, member string) bool {
 		return false // Type mismatch on destination
 	}
 
+	if srcKey == destKey {
+		return true
+	}
+
+	// Copy-on-write: clone both sets if snapshot is active
+	if s.isSnapshotActive() {
+		srcSet = srcSet.Clone()
+		if s.data[destKey] != nil {
+			destSet = destSet.Clone()
+		}
+	}
+
 	// Move the member
 	srcSet.Remove(member)
 	destSet.Add(member)
 
-	// Clean up empty source set
-	if srcSet.Len() == 0 {
-		s.deleteKey(srcKey)
-	}
-
-	// Save destination set
+	// saveSet removes the source key once it is empty
+	s.saveSet(srcKey, srcSet)
 	s.saveSet(destKey, destSet)
 
 	return true
@@ -306,6 +391,8 @@ func (s *Store) SUnionStore(destKey string, keys ...string) int {
 	for _, member := range result {
 		newSet.Add(member)
 	}
+	// The destination is overwritten, so any previous TTL is dropped
+	s.deleteKey(destKey)
 	s.saveSet(destKey, newSet)
 
 	return len(result)
@@ -324,6 +411,8 @@ func (s *Store) SInterStore(destKey string, keys ...string) int {
 	for _, member := range result {
 		newSet.Add(member)
 	}
+	// The destination is overwritten, so any previous TTL is dropped
+	s.deleteKey(destKey)
 	s.saveSet(destKey, newSet)
 
 	return len(result)
@@ -342,6 +431,8 @@ func (s *Store) SDiffStore(destKey string, keys ...string) int {
 	for _, member := range result {
 		newSet.Add(member)
 	}
+	// The destination is overwritten, so any previous TTL is dropped
+	s.deleteKey(destKey)
 	s.saveSet(destKey, newSet)
 
 	return len(result)
@@ -349,13 +440,13 @@ func (s *Store) SDiffStore(destKey string, keys ...string) int {
 
 // Type check for sets
 func (s *Store) isSet(key string) (bool, error) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
 		return false, nil // Key doesn't exist, not an error
 	}
 
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return false, nil
 	}
 
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"context"
 	"redis/internal/cluster"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -12,12 +14,76 @@ type Store struct {
 	snapshotCount  int32            // Atomic counter for active snapshots (COW optimization)
 	PubSub         *PubSub          // Publish/Subscribe manager
 	Cluster        *cluster.Cluster // Cluster manager (nil if cluster mode disabled)
+
+	// Encoding thresholds
+	listMaxListpackSize    int // Lists past this size (entries if > 0, bytes class if < 0) switch from listpack to quicklist
+	setMaxIntsetEntries    int // Sets larger than this switch from intset to hashtable
+	zsetMaxListpackEntries int // Sorted sets larger than this switch from listpack to skiplist
+	zsetMaxListpackValue   int // Sorted sets with a longer member switch from listpack to skiplist
+	hashMaxListpackEntries int // Hashes with more fields than this switch from listpack to hashtable
+	hashMaxListpackValue   int // Hashes with a longer field or value switch from listpack to hashtable
+
+	// Keys removed by lazy or active expiry since the last DrainExpiredKeys
+	expiredKeys []string
+
+	// Sliding expiries extended by a read since the last DrainRefreshedExpiries
+	refreshedExpiries []RefreshedExpiry
+
+	// Bucket table SCAN iterates; holds the same keys as data
+	scanIndex *keyIndex
+
+	// Keys per encoding class and conversion counts, by collection type
+	encodingStats map[ValueType]*EncodingStats
+
+	// Keys per type, for MEMORY STATS
+	keysByType map[ValueType]int64
+
+	// passiveExpiry is set while running as a replica: expired keys are hidden
+	// from reads but stay until the master's DEL removes them (atomic, 1 = on)
+	passiveExpiry int32
+
+	// Stripes of per-key locks, nil unless key-lock-stripes is set (see
+	// LockKeys). Commands holding stripes run at the same time, so mu guards
+	// what their keys share: data and dataWithExpiry, the SCAN index, the
+	// key counts and the expiry lists. The methods of single-key string
+	// commands reach them only through lookup, putData, deleteKey and
+	// indexExpiry, which take it
+	keyLocks *keyLocks
+	mu       sync.Mutex
 }
 
 type Value struct {
 	Data      interface{}
 	ExpiresAt *time.Time
 	Type      ValueType
+
+	// Negative marks a negative-cache tombstone written by SET ... NEGATIVE:
+	// the application recorded the key as known to be absent upstream
+	// Any later write that replaces the value clears it, and so does removing
+	// its TTL: a tombstone always has an expiry
+	Negative bool
+
+	// encoding is the encoding class recorded by putData for the per-class
+	// key counts reported by INFO
+	encoding encodingClass
+
+	// SlidingTTL is the window set by EXPIRE ... SLIDING: every GET pushes
+	// ExpiresAt back to now + SlidingTTL. Zero for a fixed expiry; any other
+	// change of the expiry or a write that replaces the value clears it
+	SlidingTTL time.Duration
+
+	// slidingPropagated is the latest deadline of a sliding key handed to
+	// the AOF and replicas; reads that keep ExpiresAt at or before it need
+	// not be propagated
+	slidingPropagated time.Time
+}
+
+// RefreshedExpiry records the deadline to propagate for a key whose sliding
+// expiry was extended by a read, and the key's window
+type RefreshedExpiry struct {
+	Key       string
+	ExpiresAt time.Time
+	Window    time.Duration
 }
 
 type ValueType int
@@ -30,22 +96,154 @@ const (
 	ZSetType
 	BloomFilterType
 	HyperLogLogType
+	CuckooFilterType
+	CountMinSketchType
 )
 
 func NewStore() *Store {
 	return &Store{
 		data:           make(map[string]*Value),
 		dataWithExpiry: make(map[string]time.Time),
+		scanIndex:      newKeyIndex(),
+		encodingStats:  newEncodingStats(),
+		keysByType:     make(map[ValueType]int64),
 		PubSub:         NewPubSub(),
+
+		listMaxListpackSize:    DefaultListMaxListpackSize,
+		setMaxIntsetEntries:    DefaultSetMaxIntsetEntries,
+		zsetMaxListpackEntries: DefaultZSetMaxListpackEntries,
+		zsetMaxListpackValue:   DefaultZSetMaxListpackValue,
+		hashMaxListpackEntries: DefaultHashMaxListpackEntries,
+		hashMaxListpackValue:   DefaultHashMaxListpackValue,
+	}
+}
+
+// cancelCheckInterval is how many items long-running operations process
+// between checks of their context
+const cancelCheckInterval = 1024
+
+// checkCanceled returns ErrCommandTimeout once ctx is done
+// The context is only consulted every cancelCheckInterval iterations to keep loops cheap
+func checkCanceled(ctx context.Context, iteration int) error {
+	if iteration%cancelCheckInterval != 0 {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ErrCommandTimeout
+	}
+	return nil
+}
+
+// lookup returns the value stored at key, expired or not
+func (s *Store) lookup(key string) (*Value, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	val, exists := s.data[key]
+	return val, exists
+}
+
+// indexExpiry records the TTL of key in the expiry index, or drops key from
+// the index when expiry is nil
+func (s *Store) indexExpiry(key string, expiry *time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expiry != nil {
+		s.dataWithExpiry[key] = *expiry
+	} else {
+		delete(s.dataWithExpiry, key)
 	}
 }
 
+// currentExpiry returns the TTL of an existing key so in-place updates of
+// aggregate values keep it (Redis only clears TTLs on overwrite, not on modification)
+func (s *Store) currentExpiry(key string) *time.Time {
+	if val, exists := s.lookup(key); exists {
+		return val.ExpiresAt
+	}
+	return nil
+}
+
 // deleteKey is a helper to delete from both maps
 func (s *Store) deleteKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if val, exists := s.data[key]; exists {
+		s.scanIndex.remove(key)
+		s.countEncoding(val, -1)
+		s.keysByType[val.Type]--
+	}
 	delete(s.data, key)
 	delete(s.dataWithExpiry, key)
 }
 
+// expireKey removes a key whose TTL has passed and records it for propagation
+// Lazy (on access) and active expiry both go through here; since the key is
+// gone after the first call, each expired key is recorded exactly once
+// With passive expiry a key whose TTL has passed is left in place and not
+// recorded: the replica waits for the master's DEL instead of issuing its own
+func (s *Store) expireKey(key string) {
+	val, exists := s.lookup(key)
+	if !exists {
+		return
+	}
+	if s.isPassiveExpiry() && val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
+		return
+	}
+	s.deleteKey(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expiredKeys = append(s.expiredKeys, key)
+}
+
+// SetPassiveExpiry turns passive expiry on or off
+// Replicas enable it so the master's DEL stays the only way an expired key
+// goes away: reads still treat the key as missing, but neither lazy nor active
+// expiry removes it or reports it for propagation
+func (s *Store) SetPassiveExpiry(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&s.passiveExpiry, v)
+}
+
+// isPassiveExpiry reports whether expired keys are only hidden, not removed
+func (s *Store) isPassiveExpiry() bool {
+	return atomic.LoadInt32(&s.passiveExpiry) == 1
+}
+
+// DBSize returns the number of keys and how many of them have a TTL
+// Keys that expired but were not reclaimed yet are still counted, as in Redis
+func (s *Store) DBSize() (keys int, expires int) {
+	return len(s.data), len(s.dataWithExpiry)
+}
+
+// DrainExpiredKeys returns the keys removed by expiry since the last call and resets the list
+func (s *Store) DrainExpiredKeys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.expiredKeys) == 0 {
+		return nil
+	}
+	keys := s.expiredKeys
+	s.expiredKeys = nil
+	return keys
+}
+
+// DrainRefreshedExpiries returns the sliding expiries extended since the last
+// call and resets the list
+func (s *Store) DrainRefreshedExpiries() []RefreshedExpiry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.refreshedExpiries) == 0 {
+		return nil
+	}
+	refreshed := s.refreshedExpiries
+	s.refreshedExpiries = nil
+	return refreshed
+}
+
 // GetAllData returns a SHALLOW COPY of all data for snapshot purposes
 // Uses copy-on-write (COW) optimization: clones Value structs but copies data pointers,
 // actual data is copied only when modified during an active snapshot.
@@ -62,6 +260,9 @@ func (s *Store) GetAllData() map[string]*Value {
 			Data:      value.Data,                   // Shallow copy data pointer
 			ExpiresAt: copyTimePtr(value.ExpiresAt), // Deep copy time
 			Type:      value.Type,
+			Negative:  value.Negative,
+
+			SlidingTTL: value.SlidingTTL,
 		}
 	}
 
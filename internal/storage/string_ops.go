@@ -1,43 +1,118 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"runtime"
+	"strconv"
 	"time"
 )
 
 // Set stores a string value with optional expiry
+// Values that are canonical integers are stored int-encoded
 func (s *Store) Set(key string, value interface{}, expiry *time.Time) {
-	s.data[key] = &Value{
-		Data:      value,
+	s.setString(key, encodeStringValue(value), expiry)
+}
+
+// SetRaw stores a string value without int-encoding it
+// Used for results of APPEND/SETRANGE, which Redis always leaves raw
+func (s *Store) SetRaw(key string, value string, expiry *time.Time) {
+	s.setString(key, value, expiry)
+}
+
+// setString stores already-encoded string data with optional expiry
+func (s *Store) setString(key string, data interface{}, expiry *time.Time) {
+	s.putData(key, &Value{
+		Data:      data,
 		ExpiresAt: expiry,
 		Type:      StringType,
+	})
+	s.indexExpiry(key, expiry)
+}
+
+// SetOptions holds the conditional and expiry flags of the SET command
+type SetOptions struct {
+	Expiry  *time.Time // New expiry (nil = no expiry unless KeepTTL)
+	NX      bool       // Only set if the key does not exist
+	XX      bool       // Only set if the key already exists
+	KeepTTL bool       // Retain the existing TTL
+	Get     bool       // Return the previous value (SET ... GET)
+
+	// Negative stores the value as a negative-cache tombstone (SET ... NEGATIVE)
+	Negative bool
+}
+
+// SetWithOptions stores a string value honoring NX/XX/KEEPTTL
+// Returns false if the NX/XX condition was not met and nothing was written
+func (s *Store) SetWithOptions(key string, value interface{}, opts SetOptions) bool {
+	exists := s.Exists(key)
+	if (opts.NX && exists) || (opts.XX && !exists) {
+		return false
+	}
+
+	expiry := opts.Expiry
+	if opts.KeepTTL && exists {
+		expiry = s.currentExpiry(key)
 	}
 
-	if expiry != nil {
-		s.dataWithExpiry[key] = *expiry
-	} else {
-		delete(s.dataWithExpiry, key)
+	s.Set(key, value, expiry)
+	if opts.Negative {
+		val, _ := s.lookup(key)
+		val.Negative = true
 	}
+	return true
+}
+
+// SetGet applies SET with the GET option and returns the previous string value
+// The write is skipped with ErrWrongType when the key holds a non-string value;
+// the old value is returned even when NX/XX prevented the write
+func (s *Store) SetGet(key string, value interface{}, opts SetOptions) (string, bool, error) {
+	old, exists := s.Get(key)
+	if val, _ := s.lookup(key); exists && val.Type != StringType {
+		return "", false, ErrWrongType
+	}
+
+	s.SetWithOptions(key, value, opts)
+
+	if !exists {
+		return "", false, nil
+	}
+	if str, ok := old.(string); ok {
+		return str, true, nil
+	}
+	return fmt.Sprint(old), true, nil
+}
+
+// IsNegative reports whether key holds a live negative-cache tombstone
+func (s *Store) IsNegative(key string) bool {
+	val, exists := s.liveValue(key)
+	return exists && val.Negative
 }
 
 // Get retrieves a value by key
 func (s *Store) Get(key string) (interface{}, bool) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
 		return nil, false
 	}
 
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return nil, false
 	}
 
+	// Callers always see strings, whatever the internal encoding
+	if str, ok := val.StringValue(); ok && val.Type == StringType {
+		return str, true
+	}
+
 	return val.Data, true
 }
 
 // Delete removes a key from the store
 func (s *Store) Delete(key string) bool {
-	_, exists := s.data[key]
+	_, exists := s.lookup(key)
 	if exists {
 		s.deleteKey(key)
 		return true
@@ -47,72 +122,175 @@ func (s *Store) Delete(key string) bool {
 
 // Exists checks if a key exists and is not expired
 func (s *Store) Exists(key string) bool {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
 		return false
 	}
 
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return false
 	}
 
 	return true
 }
 
-// Keys returns all non-expired keys
-func (s *Store) Keys() []string {
-	keys := make([]string, 0, len(s.data))
+// Keys returns the non-expired keys matching pattern
+func (s *Store) Keys(pattern string) []string {
+	keys, _ := s.KeysContext(context.Background(), pattern)
+	return keys
+}
+
+// KeysContext returns the non-expired keys matching pattern (see
+// MatchPattern), aborting with ErrCommandTimeout when ctx is done (KEYS on a
+// large keyspace can take a long time)
+func (s *Store) KeysContext(ctx context.Context, pattern string) ([]string, error) {
+	keys := make([]string, 0)
 	now := time.Now()
 
+	i := 0
 	for key, val := range s.data {
-		if val.ExpiresAt == nil || now.Before(*val.ExpiresAt) {
+		if err := checkCanceled(ctx, i); err != nil {
+			return nil, err
+		}
+		i++
+
+		if val.ExpiresAt != nil && !now.Before(*val.ExpiresAt) {
+			continue
+		}
+		if MatchPattern(pattern, key) {
 			keys = append(keys, key)
 		}
 	}
 
-	return keys
+	return keys, nil
 }
 
 // Flush clears all data from the store
 func (s *Store) Flush() {
 	s.data = make(map[string]*Value)
 	s.dataWithExpiry = make(map[string]time.Time)
+	s.scanIndex = newKeyIndex()
+	s.resetEncodingCounts()
+	s.keysByType = make(map[ValueType]int64)
+}
+
+// ReplaceDataset swaps in the keyspace of from, which must not be used
+// afterwards; conversion counts are cumulative and survive, as with Flush
+func (s *Store) ReplaceDataset(from *Store) {
+	s.data = from.data
+	s.dataWithExpiry = from.dataWithExpiry
+	s.scanIndex = from.scanIndex
+	s.keysByType = from.keysByType
+	for t, stats := range s.encodingStats {
+		stats.Compact = from.encodingStats[t].Compact
+		stats.Large = from.encodingStats[t].Large
+	}
+}
+
+// lazyFreeBatch is how many keys the background free releases before yielding
+const lazyFreeBatch = 1024
+
+// FlushAsync swaps in an empty keyspace and releases the old one on a background goroutine
+// The caller only pays for allocating the new maps; dropping the references to the old
+// values happens in batches so the collector can reclaim them incrementally
+func (s *Store) FlushAsync() {
+	oldData, oldExpiry := s.data, s.dataWithExpiry
+	s.Flush()
+
+	go lazyFree(oldData, oldExpiry)
+}
+
+// lazyFree drops every entry of a detached keyspace, yielding between batches
+func lazyFree(data map[string]*Value, expiry map[string]time.Time) {
+	released := 0
+	for key := range data {
+		delete(data, key)
+		released++
+		if released%lazyFreeBatch == 0 {
+			runtime.Gosched()
+		}
+	}
+	clear(expiry)
 }
 
 // Expire sets an expiry time on a key
 func (s *Store) Expire(key string, expiry *time.Time) bool {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
 		return false
 	}
 
 	// Check if already expired
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return false
 	}
 
 	val.ExpiresAt = expiry
-	if expiry != nil {
-		s.dataWithExpiry[key] = *expiry
-	} else {
-		delete(s.dataWithExpiry, key)
+	val.SlidingTTL = 0
+	s.indexExpiry(key, expiry)
+	if expiry == nil {
+		val.Negative = false
 	}
 	return true
 }
 
+// ExpireSliding sets an expiry time on a key like Expire and marks it as
+// sliding: every later GET extends the expiry to window from the read
+// The caller propagates expiry itself, so it becomes the propagated deadline
+func (s *Store) ExpireSliding(key string, expiry time.Time, window time.Duration) bool {
+	if !s.Expire(key, &expiry) {
+		return false
+	}
+	val, _ := s.lookup(key)
+	val.SlidingTTL = window
+	val.slidingPropagated = expiry
+	return true
+}
+
+// RefreshSlidingTTL extends the expiry of a key with a sliding TTL to a full
+// window from now
+// A refresh is recorded for propagation only when the new deadline passes
+// the one last propagated, and it then propagates half a window more than
+// the real deadline: the AOF and replicas never expire the key before the
+// master does (the master's DEL removes it on time), and a key read
+// continuously is logged about once per half window rather than on every
+// read. Replicas follow the master's deadline and never refresh
+// Keys without a sliding TTL are left untouched
+func (s *Store) RefreshSlidingTTL(key string) {
+	val, exists := s.lookup(key)
+	if !exists || val.SlidingTTL == 0 || s.isPassiveExpiry() {
+		return
+	}
+
+	expiry := time.Now().Add(val.SlidingTTL)
+	val.ExpiresAt = &expiry
+	s.indexExpiry(key, &expiry)
+
+	if expiry.After(val.slidingPropagated) {
+		val.slidingPropagated = expiry.Add(val.SlidingTTL / 2)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.refreshedExpiries = append(s.refreshedExpiries, RefreshedExpiry{
+			Key:       key,
+			ExpiresAt: val.slidingPropagated,
+			Window:    val.SlidingTTL,
+		})
+	}
+}
+
 // TTL returns the time-to-live for a key in seconds
 // Returns -2 if key doesn't exist, -1 if key has no expiry
 func (s *Store) TTL(key string) int64 {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
 		return -2 // Key doesn't exist
 	}
 
 	// Check if already expired
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return -2 // Key doesn't exist (expired)
 	}
 
@@ -123,7 +301,7 @@ func (s *Store) TTL(key string) int64 {
 	// Return seconds until expiry
 	ttl := time.Until(*val.ExpiresAt).Seconds()
 	if ttl < 0 {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return -2 // Already expired
 	}
 	return int64(ttl)
@@ -138,11 +316,12 @@ func (s *Store) Incr(key string) (int64, error) {
 // IncrBy increments the integer value of a key by the given amount
 // Returns the value after increment or error if value is not an integer
 func (s *Store) IncrBy(key string, increment int64) (int64, error) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 
-	// Check expiration if key exists
-	if exists && val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+	// Check expiration if key exists; with passive expiry the master's
+	// increment applies to the value it still has
+	if exists && val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) && !s.isPassiveExpiry() {
+		s.expireKey(key)
 		exists = false
 	}
 
@@ -165,15 +344,18 @@ func (s *Store) IncrBy(key string, increment int64) (int64, error) {
 		}
 	}
 
-	// Perform increment
-	newValue := current + increment
+	// Perform increment, refusing to wrap around like Redis does
+	newValue, err := AddInt64(current, increment)
+	if err != nil {
+		return 0, err
+	}
 
-	// Store as string to match Redis behavior
-	s.data[key] = &Value{
-		Data:      fmt.Sprintf("%d", newValue),
+	// Keep the result int-encoded so the next increment needs no parsing
+	s.putData(key, &Value{
+		Data:      newValue,
 		ExpiresAt: nil,
 		Type:      StringType,
-	}
+	})
 
 	return newValue, nil
 }
@@ -187,13 +369,25 @@ func (s *Store) Decr(key string) (int64, error) {
 // DecrBy decrements the integer value of a key by the given amount
 // Returns the value after decrement or error if value is not an integer
 func (s *Store) DecrBy(key string, decrement int64) (int64, error) {
+	// -math.MinInt64 is not representable
+	if decrement == math.MinInt64 {
+		return 0, ErrIncrOverflow
+	}
 	return s.IncrBy(key, -decrement)
 }
 
+// AddInt64 returns current+delta, or ErrIncrOverflow if the sum does not fit in an int64
+func AddInt64(current, delta int64) (int64, error) {
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrIncrOverflow
+	}
+	return current + delta, nil
+}
+
 // parseInt64 parses a string to int64, matching Redis behavior
+// The whole string must be the integer: "12abc" and " 12" are rejected
 func parseInt64(s string) (int64, error) {
-	var result int64
-	_, err := fmt.Sscanf(s, "%d", &result)
+	result, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
 		return 0, fmt.Errorf("value is not an integer or out of range")
 	}
@@ -201,16 +395,29 @@ func parseInt64(s string) (int64, error) {
 }
 
 // CleanupExpiredKeys performs active expiration using random sampling
-func (s *Store) CleanupExpiredKeys() {
-	const maxCleanupTime = 1 * time.Millisecond
-	const keysPerSample = 20
+// Each iteration samples sampleSize keys with a TTL and deletes the expired ones.
+// Like Redis's active-expire cycle, it keeps sampling while more than 25% of a
+// sample was expired and the time budget allows, so the effort adapts to how
+// many keys are actually expiring. Returns how many keys were removed; the keys
+// themselves are collected for DrainExpiredKeys like lazily expired ones.
+func (s *Store) CleanupExpiredKeys(sampleSize int, timeBudget time.Duration) int {
+	if s.isPassiveExpiry() {
+		return 0 // Replicas wait for the master's DEL
+	}
+	if sampleSize <= 0 {
+		sampleSize = 20
+	}
+	if timeBudget <= 0 {
+		timeBudget = 1 * time.Millisecond
+	}
 
+	expired := 0
 	startTime := time.Now()
 
 	// Loop until time budget exhausted
-	for time.Since(startTime) < maxCleanupTime {
+	for time.Since(startTime) < timeBudget {
 		// Sample random keys from dataWithExpiry
-		sampledKeys := s.getRandomKeysWithExpiry(keysPerSample)
+		sampledKeys := s.getRandomKeysWithExpiry(sampleSize)
 
 		if len(sampledKeys) == 0 {
 			break // No keys with expiry
@@ -221,31 +428,34 @@ func (s *Store) CleanupExpiredKeys() {
 
 		// Check each sampled key
 		for _, key := range sampledKeys {
-			val, exists := s.data[key]
+			val, exists := s.lookup(key)
 
 			if !exists {
 				// Consistency: key in expiry index but not in data
-				delete(s.dataWithExpiry, key)
+				s.indexExpiry(key, nil)
 				continue
 			}
 
 			// Check if expired
 			if val.ExpiresAt != nil && now.After(*val.ExpiresAt) {
-				s.deleteKey(key)
+				s.expireKey(key)
+				expired++
 				expiredInSample++
 			}
 		}
 
 		// Exit early if sample was small
-		if len(sampledKeys) < keysPerSample {
+		if len(sampledKeys) < sampleSize {
 			break
 		}
 
 		// Exit if less than 25% expired (soft hint)
-		if expiredInSample*4 < keysPerSample {
+		if expiredInSample*4 < sampleSize {
 			break
 		}
 	}
+
+	return expired
 }
 
 // getRandomKeysWithExpiry samples random keys that have expiry set
@@ -0,0 +1,109 @@
+package storage
+
+import "time"
+
+// ==================== BYTE RANGE OPERATIONS ====================
+// Strings are raw bytes: lengths and offsets below count bytes, never runes,
+// so binary values (embedded NULs, invalid UTF-8) round-trip unchanged
+
+// maxStringSize is the largest string APPEND and SETRANGE may build
+// (Redis's default proto-max-bulk-len)
+const maxStringSize = 512 * 1024 * 1024
+
+// stringForUpdate returns the string at key and its TTL for a command that
+// modifies it in place; a missing key reads as "" with no TTL
+func (s *Store) stringForUpdate(key string) (string, *time.Time, error) {
+	current, err := s.getString(key)
+	if err == ErrKeyNotFound {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return current, s.currentExpiry(key), nil
+}
+
+// StrLen returns the length in bytes of the string at key (0 if missing)
+func (s *Store) StrLen(key string) (int64, error) {
+	str, err := s.getString(key)
+	if err == ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(str)), nil
+}
+
+// Append appends value to the string at key, creating it if missing, and
+// returns the new length in bytes. The key keeps its TTL
+func (s *Store) Append(key, value string) (int64, error) {
+	current, expiry, err := s.stringForUpdate(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(current)+len(value) > maxStringSize {
+		return 0, ErrStringTooLong
+	}
+
+	result := current + value
+	s.setString(key, result, expiry)
+	return int64(len(result)), nil
+}
+
+// GetRange returns the bytes of the string at key between start and end,
+// both inclusive. Negative offsets count from the end; out of range offsets
+// are clamped, so a missing key or an empty range returns ""
+func (s *Store) GetRange(key string, start, end int64) (string, error) {
+	str, err := s.getString(key)
+	if err == ErrKeyNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	length := int64(len(str))
+	if start < 0 {
+		start += length
+	}
+	if end < 0 {
+		end += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= length {
+		end = length - 1
+	}
+	if length == 0 || start > end {
+		return "", nil
+	}
+	return str[start : end+1], nil
+}
+
+// SetRange overwrites the string at key from offset with value, padding with
+// zero bytes if the string is shorter than offset, and returns the new length
+// in bytes. The key keeps its TTL; an empty value never creates a key
+func (s *Store) SetRange(key string, offset int64, value string) (int64, error) {
+	current, expiry, err := s.stringForUpdate(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(value) == 0 {
+		return int64(len(current)), nil
+	}
+	// Compared without adding to offset, which can be close to MaxInt64
+	if offset > maxStringSize-int64(len(value)) {
+		return 0, ErrStringTooLong
+	}
+
+	buf := make([]byte, max(int64(len(current)), offset+int64(len(value))))
+	copy(buf, current)
+	copy(buf[offset:], value)
+	s.setString(key, string(buf), expiry)
+	return int64(len(buf)), nil
+}
@@ -1,28 +1,114 @@
 package storage
 
+import "sort"
+
 // ZSetMember represents a member in a sorted set with its score
 type ZSetMember struct {
 	Member string
 	Score  float64
 }
 
-// ZSet represents a sorted set (combination of skip list + hash map)
+// Default zset-max-listpack-entries / zset-max-listpack-value thresholds (Redis defaults)
+const (
+	DefaultZSetMaxListpackEntries = 128
+	DefaultZSetMaxListpackValue   = 64
+)
+
+// ZSet represents a sorted set
+// Small sets use the compact listpack encoding: one slice sorted by (score, member).
+// Once a set grows past maxListpackEntries members or gets a member longer than
+// maxListpackValue bytes it switches to the skiplist encoding (hash map + skip list)
+// and, like Redis, never converts back
 type ZSet struct {
+	listpack []ZSetMember       // Sorted members while listpack-encoded (skiplist == nil)
 	dict     map[string]float64 // Member -> Score mapping for O(1) lookup
 	skiplist *skipList          // Skip list for sorted operations
+
+	maxListpackEntries int
+	maxListpackValue   int
 }
 
-// NewZSet creates a new sorted set
+// NewZSet creates a new listpack-encoded sorted set with the default thresholds
 func NewZSet() *ZSet {
+	return newZSetWithLimits(DefaultZSetMaxListpackEntries, DefaultZSetMaxListpackValue)
+}
+
+// newZSetWithLimits creates a new listpack-encoded sorted set that converts to
+// skiplist past the given thresholds
+func newZSetWithLimits(maxEntries, maxValue int) *ZSet {
 	return &ZSet{
-		dict:     make(map[string]float64),
-		skiplist: newSkipList(),
+		listpack:           make([]ZSetMember, 0),
+		maxListpackEntries: maxEntries,
+		maxListpackValue:   maxValue,
+	}
+}
+
+// IsListpack reports whether the set currently uses the listpack encoding
+func (z *ZSet) IsListpack() bool {
+	return z.skiplist == nil
+}
+
+// fitsListpack reports whether adding member keeps the set within the listpack thresholds
+func (z *ZSet) fitsListpack(member string) bool {
+	return len(z.listpack) < z.maxListpackEntries && len(member) <= z.maxListpackValue
+}
+
+// convertToSkiplist switches the set to the skiplist encoding
+func (z *ZSet) convertToSkiplist() {
+	z.dict = make(map[string]float64, len(z.listpack))
+	z.skiplist = newSkipList()
+	for _, m := range z.listpack {
+		z.dict[m.Member] = m.Score
+		z.skiplist.insert(m.Member, m.Score)
 	}
+	z.listpack = nil
+}
+
+// listpackIndex returns the position of member in the listpack, or -1
+func (z *ZSet) listpackIndex(member string) int {
+	for i, m := range z.listpack {
+		if m.Member == member {
+			return i
+		}
+	}
+	return -1
+}
+
+// listpackInsert inserts an absent member at its sorted position
+func (z *ZSet) listpackInsert(member string, score float64) {
+	i := sort.Search(len(z.listpack), func(i int) bool {
+		e := z.listpack[i]
+		return score < e.Score || (score == e.Score && member < e.Member)
+	})
+	z.listpack = append(z.listpack, ZSetMember{})
+	copy(z.listpack[i+1:], z.listpack[i:])
+	z.listpack[i] = ZSetMember{Member: member, Score: score}
+}
+
+// listpackDelete removes the entry at position i
+func (z *ZSet) listpackDelete(i int) {
+	z.listpack = append(z.listpack[:i], z.listpack[i+1:]...)
 }
 
 // Add adds or updates a member with the given score
 // Returns true if new member was added, false if score was updated
 func (z *ZSet) Add(member string, score float64) bool {
+	if z.IsListpack() {
+		if i := z.listpackIndex(member); i >= 0 {
+			if z.listpack[i].Score == score {
+				return false
+			}
+			z.listpackDelete(i)
+			z.listpackInsert(member, score)
+			return true
+		}
+		if z.fitsListpack(member) {
+			z.listpackInsert(member, score)
+			return true
+		}
+		z.convertToSkiplist()
+	}
+
 	// Check if member exists
 	oldScore, exists := z.dict[member]
 	if exists {
@@ -46,6 +132,15 @@ func (z *ZSet) Add(member string, score float64) bool {
 // Remove removes a member from the sorted set
 // Returns true if member existed and was removed
 func (z *ZSet) Remove(member string) bool {
+	if z.IsListpack() {
+		i := z.listpackIndex(member)
+		if i < 0 {
+			return false
+		}
+		z.listpackDelete(i)
+		return true
+	}
+
 	score, exists := z.dict[member]
 	if !exists {
 		return false
@@ -58,6 +153,14 @@ func (z *ZSet) Remove(member string) bool {
 
 // Score returns the score for a member, or nil if not found
 func (z *ZSet) Score(member string) *float64 {
+	if z.IsListpack() {
+		if i := z.listpackIndex(member); i >= 0 {
+			score := z.listpack[i].Score
+			return &score
+		}
+		return nil
+	}
+
 	if score, exists := z.dict[member]; exists {
 		return &score
 	}
@@ -67,6 +170,10 @@ func (z *ZSet) Score(member string) *float64 {
 // Rank returns the 0-based rank of a member (ascending order)
 // Returns -1 if member not found
 func (z *ZSet) Rank(member string) int {
+	if z.IsListpack() {
+		return z.listpackIndex(member)
+	}
+
 	score, exists := z.dict[member]
 	if !exists {
 		return -1
@@ -86,34 +193,109 @@ func (z *ZSet) RevRank(member string) int {
 
 // Len returns the number of members in the sorted set
 func (z *ZSet) Len() int {
+	if z.IsListpack() {
+		return len(z.listpack)
+	}
 	return len(z.dict)
 }
 
 // Range returns members with scores in range [min, max]
-// count = -1 means return all
+// count = -1 means return all; a negative offset matches nothing
 func (z *ZSet) Range(min, max float64, offset, count int) []ZSetMember {
-	return z.skiplist.getRange(min, max, offset, count, false)
+	if offset < 0 {
+		return []ZSetMember{}
+	}
+	if !z.IsListpack() {
+		return z.skiplist.getRange(min, max, offset, count, false)
+	}
+
+	result := make([]ZSetMember, 0)
+	i := sort.Search(len(z.listpack), func(i int) bool { return z.listpack[i].Score >= min })
+	for i += offset; i < len(z.listpack) && z.listpack[i].Score <= max; i++ {
+		if count != -1 && len(result) >= count {
+			break
+		}
+		result = append(result, z.listpack[i])
+	}
+	return result
 }
 
 // RevRange returns members with scores in range [min, max] in descending order
 func (z *ZSet) RevRange(min, max float64, offset, count int) []ZSetMember {
-	return z.skiplist.getRange(min, max, offset, count, true)
+	if offset < 0 {
+		return []ZSetMember{}
+	}
+	if !z.IsListpack() {
+		return z.skiplist.getRange(min, max, offset, count, true)
+	}
+
+	result := make([]ZSetMember, 0)
+	i := sort.Search(len(z.listpack), func(i int) bool { return z.listpack[i].Score > max }) - 1
+	for i -= offset; i >= 0 && z.listpack[i].Score >= min; i-- {
+		if count != -1 && len(result) >= count {
+			break
+		}
+		result = append(result, z.listpack[i])
+	}
+	return result
 }
 
 // RangeByRank returns members by rank range [start, stop] (0-based, inclusive)
 func (z *ZSet) RangeByRank(start, stop int) []ZSetMember {
-	return z.skiplist.getRangeByRank(start, stop, false)
+	if !z.IsListpack() {
+		return z.skiplist.getRangeByRank(start, stop, false)
+	}
+
+	length := len(z.listpack)
+	if start < 0 || start >= length || stop < start {
+		return nil
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	result := make([]ZSetMember, stop-start+1)
+	copy(result, z.listpack[start:stop+1])
+	return result
 }
 
 // RevRangeByRank returns members by rank range in descending order
 func (z *ZSet) RevRangeByRank(start, stop int) []ZSetMember {
-	return z.skiplist.getRangeByRank(start, stop, true)
+	if !z.IsListpack() {
+		return z.skiplist.getRangeByRank(start, stop, true)
+	}
+
+	length := len(z.listpack)
+	if start < 0 || start >= length || stop < start {
+		return nil
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	result := make([]ZSetMember, 0, stop-start+1)
+	for rank := start; rank <= stop; rank++ {
+		result = append(result, z.listpack[length-1-rank])
+	}
+	return result
 }
 
 // IncrBy increments the score of a member by delta
 // If member doesn't exist, creates it with score = delta
 // Returns the new score
 func (z *ZSet) IncrBy(member string, delta float64) float64 {
+	if z.IsListpack() {
+		if i := z.listpackIndex(member); i >= 0 {
+			newScore := z.listpack[i].Score + delta
+			z.listpackDelete(i)
+			z.listpackInsert(member, newScore)
+			return newScore
+		}
+		if z.fitsListpack(member) {
+			z.listpackInsert(member, delta)
+			return delta
+		}
+		z.convertToSkiplist()
+	}
+
 	oldScore, exists := z.dict[member]
 	newScore := oldScore + delta
 
@@ -129,7 +311,7 @@ func (z *ZSet) IncrBy(member string, delta float64) float64 {
 
 // Count returns the number of members with scores in range [min, max]
 func (z *ZSet) Count(min, max float64) int {
-	members := z.skiplist.getRange(min, max, 0, -1, false)
+	members := z.Range(min, max, 0, -1)
 	return len(members)
 }
 
@@ -140,6 +322,12 @@ func (z *ZSet) PopMin() *ZSetMember {
 		return nil
 	}
 
+	if z.IsListpack() {
+		member := z.listpack[0]
+		z.listpackDelete(0)
+		return &member
+	}
+
 	// Get first member from skip list
 	first := z.skiplist.header.level[0]
 	if first == nil {
@@ -162,6 +350,13 @@ func (z *ZSet) PopMax() *ZSetMember {
 		return nil
 	}
 
+	if z.IsListpack() {
+		last := len(z.listpack) - 1
+		member := z.listpack[last]
+		z.listpackDelete(last)
+		return &member
+	}
+
 	// Get last member from skip list
 	last := z.skiplist.tail
 	if last == nil {
@@ -180,7 +375,7 @@ func (z *ZSet) PopMax() *ZSetMember {
 // RemoveRangeByScore removes all members with scores in range [min, max]
 // Returns the number of members removed
 func (z *ZSet) RemoveRangeByScore(min, max float64) int {
-	members := z.skiplist.getRange(min, max, 0, -1, false)
+	members := z.Range(min, max, 0, -1)
 	count := 0
 
 	for _, member := range members {
@@ -195,7 +390,7 @@ func (z *ZSet) RemoveRangeByScore(min, max float64) int {
 // RemoveRangeByRank removes all members in rank range [start, stop] (0-based)
 // Returns the number of members removed
 func (z *ZSet) RemoveRangeByRank(start, stop int) int {
-	members := z.skiplist.getRangeByRank(start, stop, false)
+	members := z.RangeByRank(start, stop)
 	count := 0
 
 	for _, member := range members {
@@ -209,9 +404,17 @@ func (z *ZSet) RemoveRangeByRank(start, stop int) int {
 
 // Clone creates a deep copy of the sorted set (for copy-on-write)
 func (z *ZSet) Clone() *ZSet {
-	newZSet := NewZSet()
+	newZSet := newZSetWithLimits(z.maxListpackEntries, z.maxListpackValue)
+
+	if z.IsListpack() {
+		newZSet.listpack = make([]ZSetMember, len(z.listpack))
+		copy(newZSet.listpack, z.listpack)
+		return newZSet
+	}
 
 	// Copy dict
+	newZSet.listpack = nil
+	newZSet.dict = make(map[string]float64, len(z.dict))
 	for member, score := range z.dict {
 		newZSet.dict[member] = score
 	}
@@ -227,5 +430,22 @@ func (z *ZSet) GetAll() []ZSetMember {
 	if z.Len() == 0 {
 		return nil
 	}
-	return z.skiplist.getRangeByRank(0, z.Len()-1, false)
+	return z.RangeByRank(0, z.Len()-1)
+}
+
+// forEachSample calls fn for up to n members, in no particular order
+func (z *ZSet) forEachSample(n int, fn func(member string)) {
+	if z.IsListpack() {
+		for _, m := range z.listpack[:min(n, len(z.listpack))] {
+			fn(m.Member)
+		}
+		return
+	}
+	for member := range z.dict {
+		if n == 0 {
+			return
+		}
+		fn(member)
+		n--
+	}
 }
@@ -1,22 +1,29 @@
 package storage
 
 import (
+	"math"
 	"time"
 )
 
 // ==================== SORTED SET HELPER FUNCTIONS ====================
 
+// newZSet creates an empty sorted set using the store's listpack thresholds
+func (s *Store) newZSet() *ZSet {
+	return newZSetWithLimits(s.zsetMaxListpackEntries, s.zsetMaxListpackValue)
+}
+
 // getOrCreateZSet returns existing sorted set or creates new one
 func (s *Store) getOrCreateZSet(key string) (*ZSet, bool) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
-		return NewZSet(), true // New sorted set
+		return s.newZSet(), true // New sorted set
 	}
 
-	// Check expiry
-	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
-		return NewZSet(), true // Expired, treat as new
+	// Check expiry; with passive expiry the write comes from the master,
+	// which still has the key, so it applies to the existing value
+	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) && !s.isPassiveExpiry() {
+		s.expireKey(key)
+		return s.newZSet(), true // Expired, treat as new
 	}
 
 	// Check type
@@ -28,18 +35,18 @@ func (s *Store) getOrCreateZSet(key string) (*ZSet, bool) {
 	if zset, ok := val.Data.(*ZSet); ok {
 		return zset, true
 	}
-	return NewZSet(), true
+	return s.newZSet(), true
 }
 
 // getExistingZSet returns existing sorted set or nil
 func (s *Store) getExistingZSet(key string) (*ZSet, error) {
-	val, exists := s.data[key]
+	val, exists := s.lookup(key)
 	if !exists {
 		return nil, nil // Key doesn't exist
 	}
 
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		s.deleteKey(key)
+		s.expireKey(key)
 		return nil, nil
 	}
 
@@ -60,11 +67,11 @@ func (s *Store) saveZSet(key string, zset *ZSet) {
 		return
 	}
 
-	s.data[key] = &Value{
+	s.putData(key, &Value{
 		Data:      zset,
-		ExpiresAt: nil,
+		ExpiresAt: s.currentExpiry(key),
 		Type:      ZSetType,
-	}
+	})
 }
 
 // ==================== SORTED SET OPERATIONS ====================
@@ -95,6 +102,100 @@ func (s *Store) ZAdd(key string, members []ZSetMember) int {
 	return added
 }
 
+// ZAddOptions holds the conditional flags of the ZADD command
+type ZAddOptions struct {
+	NX bool // Only add new members, never update existing ones
+	XX bool // Only update existing members, never add new ones
+	GT bool // Only update when the new score is greater than the current one
+	LT bool // Only update when the new score is less than the current one
+	CH bool // Count changed members as well as added ones
+}
+
+// allows reports whether the options let a member with the given current
+// score (nil if absent) be set to score
+// GT/LT only restrict updates; new members are still added
+func (o ZAddOptions) allows(current *float64, score float64) bool {
+	if current == nil {
+		return !o.XX
+	}
+	if o.NX {
+		return false
+	}
+	if o.GT && score <= *current {
+		return false
+	}
+	if o.LT && score >= *current {
+		return false
+	}
+	return true
+}
+
+// ZAddWithOptions adds or updates members honoring NX/XX/GT/LT
+// Returns the number of members added, or added plus updated with CH
+func (s *Store) ZAddWithOptions(key string, members []ZSetMember, opts ZAddOptions) (int, error) {
+	zset, ok := s.getOrCreateZSet(key)
+	if !ok {
+		return 0, ErrWrongType
+	}
+
+	// Copy-on-write: clone zset if snapshot is active
+	if s.isSnapshotActive() && s.data[key] != nil {
+		zset = zset.Clone()
+	}
+
+	added, changed := 0, 0
+	for _, member := range members {
+		current := zset.Score(member.Member)
+		if !opts.allows(current, member.Score) {
+			continue
+		}
+		if current == nil {
+			added++
+		} else if *current != member.Score {
+			changed++
+		}
+		zset.Add(member.Member, member.Score)
+	}
+
+	s.saveZSet(key, zset)
+	if opts.CH {
+		return added + changed, nil
+	}
+	return added, nil
+}
+
+// ZAddIncr implements ZADD ... INCR: increments member's score by delta
+// honoring NX/XX/GT/LT
+// Returns false (and leaves the set untouched) when the options suppress
+// the update, so the caller can reply with a null
+func (s *Store) ZAddIncr(key string, member string, delta float64, opts ZAddOptions) (float64, bool, error) {
+	zset, ok := s.getOrCreateZSet(key)
+	if !ok {
+		return 0, false, ErrWrongType
+	}
+
+	current := zset.Score(member)
+	newScore := delta
+	if current != nil {
+		newScore = *current + delta
+	}
+	if math.IsNaN(newScore) {
+		return 0, false, ErrScoreNaN
+	}
+	if !opts.allows(current, newScore) {
+		return 0, false, nil
+	}
+
+	// Copy-on-write: clone zset if snapshot is active
+	if s.isSnapshotActive() && s.data[key] != nil {
+		zset = zset.Clone()
+	}
+
+	zset.Add(member, newScore)
+	s.saveZSet(key, zset)
+	return newScore, true, nil
+}
+
 // ZRem removes one or more members from a sorted set
 // Returns the number of members removed
 func (s *Store) ZRem(key string, members []string) int {
@@ -333,6 +434,43 @@ func (s *Store) ZPopMax(key string) *ZSetMember {
 	return member
 }
 
+// ZMPop pops up to count members from the first non-empty sorted set among
+// keys, lowest scores first, or highest first if max is set
+// Returns the key popped from and the members, or "" if every set is empty
+func (s *Store) ZMPop(keys []string, max bool, count int) (string, []ZSetMember, error) {
+	for _, key := range keys {
+		zset, err := s.getExistingZSet(key)
+		if err != nil {
+			return "", nil, err
+		}
+		if zset == nil || zset.Len() == 0 {
+			continue
+		}
+
+		// Copy-on-write: clone zset if snapshot is active
+		if s.isSnapshotActive() {
+			zset = zset.Clone()
+		}
+
+		members := make([]ZSetMember, 0, min(count, zset.Len()))
+		for len(members) < count {
+			var member *ZSetMember
+			if max {
+				member = zset.PopMax()
+			} else {
+				member = zset.PopMin()
+			}
+			if member == nil {
+				break
+			}
+			members = append(members, *member)
+		}
+		s.saveZSet(key, zset)
+		return key, members, nil
+	}
+	return "", nil, nil
+}
+
 // ZRemRangeByScore removes all members with scores in range [min, max]
 func (s *Store) ZRemRangeByScore(key string, min, max float64) int {
 	zset, err := s.getExistingZSet(key)
@@ -0,0 +1,23 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Version is the Redis version this server reports (INFO, LOLWUT, RDB aux fields)
+const Version = "7.0.0"
+
+// Build metadata, set at link time:
+//
+//	go build -ldflags "-X redis/internal/version.GitSHA=$(git rev-parse --short HEAD)"
+var (
+	GitSHA  = "00000000"
+	BuildID = "dev"
+)
+
+// String returns a one-line version and build description
+func String() string {
+	return fmt.Sprintf("GoRedis ver. %s (git:%s build:%s %s %s/%s)",
+		Version, GitSHA, BuildID, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}